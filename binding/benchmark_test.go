@@ -0,0 +1,203 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package binding
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+)
+
+// benchEntries is the number of bindings the manager holds in the benchmarks.
+const benchEntries = 1000
+
+// benchAddrs returns n distinct peer addresses in the 10.<group>.0.0/16 range.
+func benchAddrs(group, n int) []net.Addr {
+	addrs := make([]net.Addr, n)
+	for i := range addrs {
+		addrs[i] = &net.UDPAddr{IP: net.IPv4(10, byte(group), byte(i>>8), byte(i)), Port: 5000}
+	}
+
+	return addrs
+}
+
+// newBenchManager returns a manager with benchEntries bindings, and them.
+func newBenchManager(b *testing.B) (*Manager, []*Binding) {
+	b.Helper()
+
+	mgr := NewManager(ManagerConfig{})
+	bindings := make([]*Binding, benchEntries)
+	for i, addr := range benchAddrs(0, benchEntries) {
+		bindings[i] = mustCreateBinding(b, mgr, addr)
+	}
+
+	return mgr, bindings
+}
+
+// runParallelChurn runs op in parallel, each goroutine passing op its own
+// peer addresses so that bindings created by one are not touched by others.
+func runParallelChurn(b *testing.B, op func(pb *testing.PB, addrs []net.Addr)) {
+	b.Helper()
+
+	var group atomic.Int32
+	b.RunParallel(func(pb *testing.PB) {
+		op(pb, benchAddrs(1+int(group.Add(1)), 256))
+	})
+}
+
+// BenchmarkBindingCreate measures Create. Serial creates fresh bindings next
+// to the existing ones, removing them off the clock now and then. Parallel
+// deletes each binding right after creating it, to keep the manager size.
+func BenchmarkBindingCreate(b *testing.B) {
+	b.Run("Serial", func(b *testing.B) {
+		mgr, _ := newBenchManager(b)
+		extra := benchAddrs(1, benchEntries)
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			j := i % len(extra)
+			if j == 0 && i > 0 {
+				b.StopTimer()
+				for _, addr := range extra {
+					mgr.DeleteByAddr(addr)
+				}
+				b.StartTimer()
+			}
+			if _, err := mgr.Create(extra[j]); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("Parallel", func(b *testing.B) {
+		mgr, _ := newBenchManager(b)
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		runParallelChurn(b, func(pb *testing.PB, addrs []net.Addr) {
+			for i := 0; pb.Next(); i++ {
+				bound, err := mgr.Create(addrs[i%len(addrs)])
+				if err != nil {
+					b.Error(err)
+
+					return
+				}
+				mgr.DeleteByChannel(bound.Number())
+			}
+		})
+	})
+}
+
+// BenchmarkBindingLookupByAddr measures FindByAddr hits.
+func BenchmarkBindingLookupByAddr(b *testing.B) {
+	mgr, bindings := newBenchManager(b)
+	addrs := make([]net.Addr, len(bindings))
+	for i, bound := range bindings {
+		addrs[i] = bound.Addr()
+	}
+
+	b.Run("Serial", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, ok := mgr.FindByAddr(addrs[i%len(addrs)]); !ok {
+				b.Fatal("binding not found")
+			}
+		}
+	})
+
+	b.Run("Parallel", func(b *testing.B) {
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for i := 0; pb.Next(); i++ {
+				if _, ok := mgr.FindByAddr(addrs[i%len(addrs)]); !ok {
+					b.Error("binding not found")
+
+					return
+				}
+			}
+		})
+	})
+}
+
+// BenchmarkBindingLookupByChannel measures FindByChannel hits.
+func BenchmarkBindingLookupByChannel(b *testing.B) {
+	mgr, bindings := newBenchManager(b)
+	numbers := make([]uint16, len(bindings))
+	for i, bound := range bindings {
+		numbers[i] = bound.Number()
+	}
+
+	b.Run("Serial", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, ok := mgr.FindByChannel(numbers[i%len(numbers)]); !ok {
+				b.Fatal("binding not found")
+			}
+		}
+	})
+
+	b.Run("Parallel", func(b *testing.B) {
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for i := 0; pb.Next(); i++ {
+				if _, ok := mgr.FindByChannel(numbers[i%len(numbers)]); !ok {
+					b.Error("binding not found")
+
+					return
+				}
+			}
+		})
+	})
+}
+
+// BenchmarkBindingDelete measures DeleteByAddr. Serial deletes bindings
+// created off the clock. Mixed has every goroutine look bindings up and
+// replace one of its own every tenth operation, as WriteTo and binding
+// recovery would, to show how writers hold up readers.
+func BenchmarkBindingDelete(b *testing.B) {
+	b.Run("Serial", func(b *testing.B) {
+		mgr, _ := newBenchManager(b)
+		extra := benchAddrs(1, benchEntries)
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			j := i % len(extra)
+			if j == 0 {
+				b.StopTimer()
+				for _, addr := range extra {
+					mustCreateBinding(b, mgr, addr)
+				}
+				b.StartTimer()
+			}
+			if !mgr.DeleteByAddr(extra[j]) {
+				b.Fatal("binding not found")
+			}
+		}
+	})
+
+	b.Run("Mixed", func(b *testing.B) {
+		mgr, bindings := newBenchManager(b)
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		runParallelChurn(b, func(pb *testing.PB, addrs []net.Addr) {
+			for i := 0; pb.Next(); i++ {
+				if i%10 != 0 {
+					mgr.FindByAddr(bindings[i%len(bindings)].Addr())
+
+					continue
+				}
+				addr := addrs[(i/10)%len(addrs)]
+				mgr.DeleteByAddr(addr)
+				if _, err := mgr.Create(addr); err != nil {
+					b.Error(err)
+
+					return
+				}
+			}
+		})
+	})
+}
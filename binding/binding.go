@@ -0,0 +1,539 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+// Package binding keeps track of TURN channel bindings (RFC 5766 Section 11):
+// which channel number is bound to which peer, and where each binding is in
+// its ChannelBind lifecycle. It sends no messages itself, so it can be shared
+// by the TURN client and by custom client or server implementations.
+package binding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/turn/v4/internal/ipnet"
+	"github.com/pion/turn/v4/internal/proto"
+)
+
+// Channel number:
+//
+//	0x4000 through 0x7FFF: These values are the allowed channel
+//	numbers (16,383 possible values).
+const (
+	minChannelNumber uint16 = 0x4000
+	maxChannelNumber uint16 = 0x7fff
+)
+
+// State is the state of a channel binding.
+type State int32
+
+const (
+	// StateIdle is a binding for which no ChannelBind was sent yet.
+	StateIdle State = iota
+	// StateRequest is a binding whose first ChannelBind is in flight.
+	StateRequest
+	// StateReady is a bound channel.
+	StateReady
+	// StateRefresh is a bound channel whose refreshing ChannelBind is in flight.
+	StateRefresh
+	// StateFailed is a binding whose last ChannelBind failed.
+	StateFailed
+)
+
+func (s State) String() string {
+	switch s {
+	case StateIdle:
+		return "idle"
+	case StateRequest:
+		return "request"
+	case StateReady:
+		return "ready"
+	case StateRefresh:
+		return "refresh"
+	case StateFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// StateChangeHandler is called whenever a channel binding moves from
+// one state to another. It is invoked synchronously from the goroutine that
+// changed the state, so it may be called concurrently and must not block.
+type StateChangeHandler func(addr net.Addr, oldState, newState State)
+
+// Binding is a channel number bound, or being bound, to a peer.
+type Binding struct {
+	number       uint16       // Read-only
+	st           State        // Thread-safe (atomic op)
+	addr         net.Addr     // Read-only
+	mgr          *Manager     // Read-only
+	muBind       sync.Mutex   // Thread-safe, for ChannelBind ops
+	_refreshedAt time.Time    // Protected by mutex
+	mutex        sync.RWMutex // Thread-safe
+}
+
+// Number returns the channel number of the binding.
+func (b *Binding) Number() uint16 {
+	return b.number
+}
+
+// Addr returns the peer the channel is bound to.
+func (b *Binding) Addr() net.Addr {
+	return b.addr
+}
+
+// SetState moves the binding to state.
+func (b *Binding) SetState(state State) {
+	old := State(atomic.SwapInt32((*int32)(&b.st), int32(state)))
+	if old != state && b.mgr != nil && b.mgr.onStateChange != nil {
+		b.mgr.onStateChange(b.addr, old, state)
+	}
+}
+
+// CompareAndSwapState moves the binding from old to state only if it is
+// still in old, and reports whether it did.
+func (b *Binding) CompareAndSwapState(old, state State) bool {
+	if !atomic.CompareAndSwapInt32((*int32)(&b.st), int32(old), int32(state)) {
+		return false
+	}
+	if old != state && b.mgr != nil && b.mgr.onStateChange != nil {
+		b.mgr.onStateChange(b.addr, old, state)
+	}
+
+	return true
+}
+
+// State returns the current state of the binding.
+func (b *Binding) State() State {
+	return State(atomic.LoadInt32((*int32)(&b.st)))
+}
+
+// SetRefreshedAt records when the binding was last confirmed by the server.
+func (b *Binding) SetRefreshedAt(at time.Time) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b._refreshedAt = at
+}
+
+// RefreshedAt returns when the binding was last confirmed by the server, or
+// created if it never was.
+func (b *Binding) RefreshedAt() time.Time {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	return b._refreshedAt
+}
+
+// OK reports whether the channel is bound and can carry ChannelData.
+func (b *Binding) OK() bool {
+	state := b.State()
+
+	return state == StateReady || state == StateRefresh
+}
+
+// Lock serializes the ChannelBind transactions of the binding.
+func (b *Binding) Lock() {
+	b.muBind.Lock()
+}
+
+// Unlock releases the lock taken by Lock.
+func (b *Binding) Unlock() {
+	b.muBind.Unlock()
+}
+
+// ChannelNumberAllocator picks the channel number of each new channel binding,
+// e.g. to reserve ranges of channel numbers for some peers.
+type ChannelNumberAllocator interface {
+	// AllocateChannelNumber returns a channel number in [0x4000, 0x7FFF] for
+	// peer for which inUse reports false. It is called with the bindings
+	// locked, so it must not block or create bindings itself.
+	AllocateChannelNumber(peer net.Addr, inUse func(number uint16) bool) (uint16, error)
+}
+
+// sequentialChannelNumberAllocator hands out free channel numbers in
+// [first, last] in ascending order, wrapping around to first. It is not
+// thread-safe, the Manager calls it with its mutex held.
+type sequentialChannelNumberAllocator struct {
+	first, last uint16 // Read-only
+	next        uint16 // Protected by the mutex of the Manager
+}
+
+// NewSequentialChannelNumberAllocator returns the default ChannelNumberAllocator,
+// which assigns free channel numbers in ascending order starting at 0x4000.
+func NewSequentialChannelNumberAllocator() ChannelNumberAllocator {
+	return newSequentialChannelNumberAllocator(minChannelNumber, maxChannelNumber)
+}
+
+func newSequentialChannelNumberAllocator(first, last uint16) *sequentialChannelNumberAllocator {
+	return &sequentialChannelNumberAllocator{first: first, last: last, next: first}
+}
+
+func (a *sequentialChannelNumberAllocator) assignChannelNumber() uint16 {
+	n := a.next
+	if a.next == a.last {
+		a.next = a.first
+	} else {
+		a.next++
+	}
+
+	return n
+}
+
+func (a *sequentialChannelNumberAllocator) AllocateChannelNumber(
+	_ net.Addr,
+	inUse func(number uint16) bool,
+) (uint16, error) {
+	for i := 0; a.first <= a.last && i <= int(a.last-a.first); i++ {
+		if n := a.assignChannelNumber(); !inUse(n) {
+			return n, nil
+		}
+	}
+
+	return 0, ErrChannelNumbersExhausted
+}
+
+// ManagerConfig is a bag of config parameters for Manager.
+type ManagerConfig struct {
+	// ChannelNumberAllocator picks the numbers of new bindings. Nil selects
+	// NewSequentialChannelNumberAllocator.
+	ChannelNumberAllocator ChannelNumberAllocator
+	// OnStateChange, if set, is notified of every binding state transition.
+	OnStateChange StateChangeHandler
+	// MinChannel and MaxChannel restrict the channel numbers of new bindings
+	// to [MinChannel, MaxChannel], e.g. to give managers sharing a peer
+	// separate sub-ranges. Zero selects 0x4000 and 0x7FFF respectively, and
+	// values outside of that are clamped to it.
+	MinChannel uint16
+	MaxChannel uint16
+	// HighWaterMark, if positive, makes Create call OnHighWaterMark whenever
+	// the number of bindings grows above it, e.g. to warn of an application
+	// that never deletes the bindings of peers it no longer talks to.
+	HighWaterMark int
+	// OnHighWaterMark is called with the number of bindings and the number
+	// of channels in the range once there are more than HighWaterMark
+	// bindings. It is called again only after the count fell back to
+	// HighWaterMark. It is not called with the mutex of the Manager held.
+	OnHighWaterMark func(current, max int)
+}
+
+// Manager is a thread-safe set of channel bindings, indexed by channel
+// number and by peer address.
+type Manager struct {
+	chanMap       map[uint16]*Binding
+	addrMap       map[string]*Binding
+	numbers       ChannelNumberAllocator // Protected by mutex
+	onStateChange StateChangeHandler     // Read-only, may be nil
+	minChannel    uint16                 // Read-only
+	maxChannel    uint16                 // Read-only
+	highWaterMark int                    // Read-only, zero disables onHighWater
+	onHighWater   func(current, max int) // Read-only, may be nil
+	closed        bool                   // Protected by mutex
+	ctx           context.Context        // Canceled by Close
+	cancel        context.CancelFunc
+	wg            sync.WaitGroup // Goroutines started with Go
+	mutex         sync.RWMutex
+}
+
+// NewManager creates a Manager without bindings.
+func NewManager(config ManagerConfig) *Manager {
+	minChannel, maxChannel := max(config.MinChannel, minChannelNumber), config.MaxChannel
+	if maxChannel == 0 || maxChannel > maxChannelNumber {
+		maxChannel = maxChannelNumber
+	}
+
+	numbers := config.ChannelNumberAllocator
+	if numbers == nil {
+		numbers = newSequentialChannelNumberAllocator(minChannel, maxChannel)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Manager{
+		ctx:           ctx,
+		cancel:        cancel,
+		chanMap:       map[uint16]*Binding{},
+		addrMap:       map[string]*Binding{},
+		numbers:       numbers,
+		onStateChange: config.OnStateChange,
+		minChannel:    minChannel,
+		maxChannel:    maxChannel,
+		highWaterMark: config.HighWaterMark,
+		onHighWater:   config.OnHighWaterMark,
+	}
+}
+
+// ChannelRange returns the channel numbers the Manager creates bindings with.
+func (mgr *Manager) ChannelRange() (first, last uint16) {
+	return mgr.minChannel, mgr.maxChannel
+}
+
+// capacity returns the number of channel numbers in the range.
+func (mgr *Manager) capacity() int {
+	return int(mgr.maxChannel) - int(mgr.minChannel) + 1
+}
+
+// restricted reports whether the channel range is smaller than RFC 5766 allows.
+func (mgr *Manager) restricted() bool {
+	return mgr.minChannel != minChannelNumber || mgr.maxChannel != maxChannelNumber
+}
+
+// Create returns the binding of addr, adding an idle one with a new channel
+// number if there is none, so that concurrent callers for the same peer get
+// the same binding. Once all channel numbers in the range are bound it fails
+// with ErrChannelNumbersExhausted.
+func (mgr *Manager) Create(addr net.Addr) (*Binding, error) {
+	mgr.mutex.Lock()
+	before := len(mgr.chanMap)
+	b, err := mgr.create(addr)
+	size := len(mgr.chanMap)
+	mgr.mutex.Unlock()
+
+	// Only the binding that crossed the mark reports it
+	if err == nil && size > before && mgr.onHighWater != nil && mgr.highWaterMark > 0 && size == mgr.highWaterMark+1 {
+		mgr.onHighWater(size, mgr.capacity())
+	}
+
+	return b, err
+}
+
+// create returns the binding of addr, adding one if there is none. The
+// caller holds the mutex.
+func (mgr *Manager) create(addr net.Addr) (*Binding, error) {
+	if mgr.closed {
+		return nil, ErrManagerClosed
+	}
+	if b, ok := mgr.addrMap[ipnet.FingerprintAddrPort(addr)]; ok {
+		return b, nil
+	}
+
+	// The allocator is not asked once the range is full, so it cannot hand
+	// out a number that is in use again.
+	if len(mgr.chanMap) >= mgr.capacity() {
+		return nil, mgr.exhaustedError(ErrChannelNumbersExhausted)
+	}
+
+	// Numbers outside of the range are reported in use, so that allocators
+	// unaware of it skip them.
+	number, err := mgr.numbers.AllocateChannelNumber(addr, func(number uint16) bool {
+		_, ok := mgr.chanMap[number]
+
+		return ok || number < mgr.minChannel || number > mgr.maxChannel
+	})
+	if errors.Is(err, ErrChannelNumbersExhausted) {
+		return nil, mgr.exhaustedError(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !proto.ChannelNumber(number).Valid() {
+		return nil, fmt.Errorf("%w: 0x%x", proto.ErrInvalidChannelNumber, number)
+	}
+	if number < mgr.minChannel || number > mgr.maxChannel {
+		return nil, fmt.Errorf("%w: 0x%x outside of [0x%x, 0x%x]",
+			proto.ErrInvalidChannelNumber, number, mgr.minChannel, mgr.maxChannel)
+	}
+	if _, ok := mgr.chanMap[number]; ok {
+		return nil, fmt.Errorf("%w: 0x%x", ErrChannelNumberInUse, number)
+	}
+
+	b := &Binding{
+		number:       number,
+		addr:         addr,
+		mgr:          mgr,
+		_refreshedAt: time.Now(),
+	}
+
+	mgr.chanMap[b.number] = b
+	mgr.addrMap[ipnet.FingerprintAddrPort(b.addr)] = b
+
+	return b, nil
+}
+
+// exhaustedError returns err, wrapped in ErrChannelRangeExhausted if the
+// range is restricted.
+func (mgr *Manager) exhaustedError(err error) error {
+	if !mgr.restricted() {
+		return err
+	}
+
+	return fmt.Errorf("%w [0x%x, 0x%x]: %w", ErrChannelRangeExhausted, mgr.minChannel, mgr.maxChannel, err)
+}
+
+// FindByAddr returns the binding of the peer addr. IPv6 zones are ignored and
+// IPv4-mapped IPv6 addresses match their IPv4 form.
+func (mgr *Manager) FindByAddr(addr net.Addr) (*Binding, bool) {
+	mgr.mutex.RLock()
+	defer mgr.mutex.RUnlock()
+
+	b, ok := mgr.addrMap[ipnet.FingerprintAddrPort(addr)]
+
+	return b, ok
+}
+
+// FindByChannel returns the binding with channel number number.
+func (mgr *Manager) FindByChannel(number uint16) (*Binding, bool) {
+	mgr.mutex.RLock()
+	defer mgr.mutex.RUnlock()
+
+	b, ok := mgr.chanMap[number]
+
+	return b, ok
+}
+
+// DeleteByAddr removes the binding of the peer addr and reports whether
+// there was one.
+func (mgr *Manager) DeleteByAddr(addr net.Addr) bool {
+	mgr.mutex.Lock()
+	defer mgr.mutex.Unlock()
+
+	b, ok := mgr.addrMap[ipnet.FingerprintAddrPort(addr)]
+	if !ok {
+		return false
+	}
+
+	delete(mgr.addrMap, ipnet.FingerprintAddrPort(addr))
+	delete(mgr.chanMap, b.number)
+
+	return true
+}
+
+// DeleteByChannel removes the binding with channel number number and reports
+// whether there was one.
+func (mgr *Manager) DeleteByChannel(number uint16) bool {
+	mgr.mutex.Lock()
+	defer mgr.mutex.Unlock()
+
+	b, ok := mgr.chanMap[number]
+	if !ok {
+		return false
+	}
+
+	delete(mgr.addrMap, ipnet.FingerprintAddrPort(b.addr))
+	delete(mgr.chanMap, number)
+
+	return true
+}
+
+// DeleteByState removes all bindings in state and returns how many were
+// removed. The bindings are removed in a single step, so a binding created
+// meanwhile is either removed or kept as a whole.
+func (mgr *Manager) DeleteByState(state State) int {
+	mgr.mutex.Lock()
+	defer mgr.mutex.Unlock()
+
+	deleted := 0
+	for number, b := range mgr.chanMap {
+		if b.State() != state {
+			continue
+		}
+		delete(mgr.addrMap, ipnet.FingerprintAddrPort(b.addr))
+		delete(mgr.chanMap, number)
+		deleted++
+	}
+
+	return deleted
+}
+
+// Go runs fn in a goroutine, e.g. a ChannelBind transaction, that Close
+// cancels through ctx and waits for. It reports false without running fn if
+// the Manager is closed.
+func (mgr *Manager) Go(fn func(ctx context.Context)) bool {
+	mgr.mutex.Lock()
+	defer mgr.mutex.Unlock()
+
+	if mgr.closed {
+		return false
+	}
+
+	mgr.wg.Add(1)
+	go func() {
+		defer mgr.wg.Done()
+		fn(mgr.ctx)
+	}()
+
+	return true
+}
+
+// Close cancels the goroutines started with Go, waits for them to return and
+// deletes all bindings. No bindings can be created afterwards.
+func (mgr *Manager) Close() error {
+	mgr.mutex.Lock()
+	if mgr.closed {
+		mgr.mutex.Unlock()
+
+		return ErrManagerClosed
+	}
+	mgr.closed = true
+	mgr.mutex.Unlock()
+
+	// The goroutines may use the Manager, so it must not be locked meanwhile
+	mgr.cancel()
+	mgr.wg.Wait()
+
+	mgr.mutex.Lock()
+	defer mgr.mutex.Unlock()
+
+	mgr.chanMap = map[uint16]*Binding{}
+	mgr.addrMap = map[string]*Binding{}
+
+	return nil
+}
+
+// Size returns the number of bindings.
+func (mgr *Manager) Size() int {
+	mgr.mutex.RLock()
+	defer mgr.mutex.RUnlock()
+
+	return len(mgr.chanMap)
+}
+
+// Info describes a channel binding at the time of a snapshot.
+type Info struct {
+	ChannelNumber   uint16
+	RemoteAddr      net.Addr
+	State           State
+	LastRefreshedAt time.Time
+}
+
+// Snapshot returns all bindings as of a single point in time, ordered by
+// channel number.
+func (mgr *Manager) Snapshot() []Info {
+	mgr.mutex.RLock()
+	defer mgr.mutex.RUnlock()
+
+	infos := make([]Info, 0, len(mgr.chanMap))
+	for _, b := range mgr.chanMap {
+		infos = append(infos, Info{
+			ChannelNumber:   b.number,
+			RemoteAddr:      b.addr,
+			State:           b.State(),
+			LastRefreshedAt: b.RefreshedAt(),
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ChannelNumber < infos[j].ChannelNumber
+	})
+
+	return infos
+}
+
+// All returns the bindings in no particular order.
+func (mgr *Manager) All() []*Binding {
+	mgr.mutex.RLock()
+	defer mgr.mutex.RUnlock()
+
+	list := make([]*Binding, 0, len(mgr.chanMap))
+	for _, b := range mgr.chanMap {
+		list = append(list, b)
+	}
+
+	return list
+}
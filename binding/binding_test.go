@@ -0,0 +1,645 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package binding
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/turn/v4/internal/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+// mustCreateBinding creates a binding for addr, failing the test on error.
+func mustCreateBinding(tb testing.TB, mgr *Manager, addr net.Addr) *Binding {
+	tb.Helper()
+
+	b, err := mgr.Create(addr)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	return b
+}
+
+func TestManager(t *testing.T) {
+	t.Run("number assignment", func(t *testing.T) {
+		seq := newSequentialChannelNumberAllocator(minChannelNumber, maxChannelNumber)
+		var chanNum uint16
+		for i := uint16(0); i < 10; i++ {
+			chanNum = seq.assignChannelNumber()
+			assert.Equal(t, minChannelNumber+i, chanNum, "should match")
+		}
+
+		seq.next = uint16(0x7ff0)
+		for i := uint16(0); i < 16; i++ {
+			chanNum = seq.assignChannelNumber()
+			assert.Equal(t, 0x7ff0+i, chanNum, "should match")
+		}
+
+		// Back to min
+		chanNum = seq.assignChannelNumber()
+		assert.Equal(t, minChannelNumber, chanNum, "should match")
+	})
+
+	t.Run("method test", func(t *testing.T) {
+		lo := net.IPv4(127, 0, 0, 1)
+		count := 100
+		bm := NewManager(ManagerConfig{})
+		for i := 0; i < count; i++ {
+			addr := &net.UDPAddr{IP: lo, Port: 10000 + i}
+			b0 := mustCreateBinding(t, bm, addr)
+			b1, ok := bm.FindByAddr(addr)
+			assert.True(t, ok, "should succeed")
+			b2, ok := bm.FindByChannel(b0.number)
+			assert.True(t, ok, "should succeed")
+
+			assert.Equal(t, b0, b1, "should match")
+			assert.Equal(t, b0, b2, "should match")
+		}
+
+		all := bm.All()
+		for _, b := range all {
+			found, ok := bm.FindByChannel(b.number)
+			assert.True(t, ok, "should exist")
+			assert.Equal(t, b, found, "should match")
+		}
+		assert.Equal(t, count, len(all), "should match")
+		assert.Equal(t, count, bm.Size(), "should match")
+		assert.Equal(t, count, len(bm.addrMap), "should match")
+
+		for i := 0; i < count; i++ {
+			addr := &net.UDPAddr{IP: lo, Port: 10000 + i}
+			if i%2 == 0 {
+				assert.True(t, bm.DeleteByAddr(addr), "should return true")
+			} else {
+				assert.True(t, bm.DeleteByChannel(minChannelNumber+uint16(i)), "should return true") // nolint:gosec // G115
+			}
+		}
+
+		assert.Equal(t, 0, bm.Size(), "should match")
+		assert.Equal(t, 0, len(bm.addrMap), "should match")
+		assert.Equal(t, 0, len(bm.All()), "should match")
+	})
+
+	t.Run("failure test", func(t *testing.T) {
+		addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 7777}
+		m := NewManager(ManagerConfig{})
+		var ok bool
+		_, ok = m.FindByAddr(addr)
+		assert.False(t, ok, "should fail")
+		_, ok = m.FindByChannel(uint16(5555))
+		assert.False(t, ok, "should fail")
+		ok = m.DeleteByAddr(addr)
+		assert.False(t, ok, "should fail")
+		ok = m.DeleteByChannel(uint16(5555))
+		assert.False(t, ok, "should fail")
+	})
+
+	t.Run("state change handler", func(t *testing.T) {
+		type event struct {
+			addr     net.Addr
+			oldState State
+			newState State
+		}
+
+		var events []event
+		m := NewManager(ManagerConfig{})
+		m.onStateChange = func(addr net.Addr, oldState, newState State) {
+			events = append(events, event{addr, oldState, newState})
+		}
+
+		addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 7777}
+		b := mustCreateBinding(t, m, addr)
+		b.SetState(StateRequest)
+		b.SetState(StateReady)
+		b.SetState(StateReady)
+		b.SetState(StateFailed)
+		assert.False(t, b.CompareAndSwapState(StateReady, StateIdle))
+		assert.True(t, b.CompareAndSwapState(StateFailed, StateIdle))
+
+		assert.Equal(t, []event{
+			{addr, StateIdle, StateRequest},
+			{addr, StateRequest, StateReady},
+			{addr, StateReady, StateFailed},
+			{addr, StateFailed, StateIdle},
+		}, events, "should not be called when the state does not change")
+	})
+
+	t.Run("state change handler concurrency", func(t *testing.T) {
+		var calls atomic.Int32
+		m := NewManager(ManagerConfig{})
+		m.onStateChange = func(net.Addr, State, State) {
+			calls.Add(1)
+		}
+
+		b := mustCreateBinding(t, m, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 7777})
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				b.SetState(StateReady)
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, int32(1), calls.Load(), "only one transition should be reported")
+	})
+
+	t.Run("state String()", func(t *testing.T) {
+		assert.Equal(t, "ready", StateReady.String())
+		assert.Equal(t, "failed", StateFailed.String())
+		assert.Equal(t, "unknown", State(42).String())
+	})
+
+	t.Run("IPv6 normalization", func(t *testing.T) {
+		m := NewManager(ManagerConfig{})
+
+		b := mustCreateBinding(t, m, &net.UDPAddr{IP: net.ParseIP("::1"), Zone: "lo", Port: 7777})
+		found, ok := m.FindByAddr(&net.UDPAddr{IP: net.ParseIP("::1"), Port: 7777})
+		assert.True(t, ok, "zone should be ignored")
+		assert.Equal(t, b, found)
+
+		b = mustCreateBinding(t, m, &net.UDPAddr{IP: net.ParseIP("::ffff:127.0.0.1"), Port: 7777})
+		found, ok = m.FindByAddr(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1).To4(), Port: 7777})
+		assert.True(t, ok, "IPv4-mapped IPv6 should match IPv4")
+		assert.Equal(t, b, found)
+
+		_, ok = m.FindByAddr(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 7778})
+		assert.False(t, ok, "port must still be part of the key")
+
+		assert.True(t, m.DeleteByAddr(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 7777}))
+		assert.True(t, m.DeleteByChannel(m.All()[0].number))
+		assert.Equal(t, 0, len(m.addrMap))
+	})
+
+	t.Run("channel number exhaustion", func(t *testing.T) {
+		m := NewManager(ManagerConfig{})
+		total := int(maxChannelNumber-minChannelNumber) + 1
+		for i := 0; i < total; i++ {
+			mustCreateBinding(t, m, &net.UDPAddr{IP: net.IPv4(10, 0, byte(i>>8), byte(i)), Port: 5000})
+		}
+		assert.Equal(t, total, m.Size())
+
+		_, err := m.Create(&net.UDPAddr{IP: net.IPv4(10, 1, 0, 0), Port: 5000})
+		assert.ErrorIs(t, err, ErrChannelNumbersExhausted)
+
+		// A freed number is handed out again
+		assert.True(t, m.DeleteByChannel(0x5000))
+		b := mustCreateBinding(t, m, &net.UDPAddr{IP: net.IPv4(10, 1, 0, 0), Port: 5000})
+		assert.Equal(t, uint16(0x5000), b.number)
+	})
+
+	// createConcurrently creates bindings for n peers from n goroutines and
+	// returns their channel numbers
+	createConcurrently := func(t *testing.T, m *Manager, n int) []uint16 {
+		t.Helper()
+
+		numbers := make([]uint16, n)
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				b, err := m.Create(&net.UDPAddr{IP: net.IPv4(10, 2, byte(i>>8), byte(i)), Port: 5000})
+				if assert.NoError(t, err) {
+					numbers[i] = b.Number()
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		return numbers
+	}
+
+	t.Run("concurrent Create", func(t *testing.T) {
+		m := NewManager(ManagerConfig{})
+		numbers := createConcurrently(t, m, 100)
+
+		seen := map[uint16]bool{}
+		for _, number := range numbers {
+			assert.False(t, seen[number], "channel 0x%x assigned twice", number)
+			seen[number] = true
+			assert.True(t, proto.ChannelNumber(number).Valid())
+			b, ok := m.FindByChannel(number)
+			assert.True(t, ok)
+			assert.Equal(t, number, b.Number())
+		}
+		assert.Equal(t, 100, m.Size())
+	})
+
+	t.Run("concurrent Create across the wrap", func(t *testing.T) {
+		m := NewManager(ManagerConfig{})
+		for i := 0; i < 50; i++ {
+			mustCreateBinding(t, m, &net.UDPAddr{IP: net.IPv4(10, 1, 0, byte(i)), Port: 5000})
+		}
+		seq, ok := m.numbers.(*sequentialChannelNumberAllocator)
+		assert.True(t, ok)
+		seq.next = maxChannelNumber - 49
+
+		// The last 50 numbers, then the first ones after those in use
+		numbers := createConcurrently(t, m, 100)
+		expected := map[uint16]bool{}
+		for i := uint16(0); i < 50; i++ {
+			expected[maxChannelNumber-i] = true
+			expected[minChannelNumber+50+i] = true
+		}
+		assigned := map[uint16]bool{}
+		for _, number := range numbers {
+			assert.False(t, assigned[number], "channel 0x%x assigned twice", number)
+			assigned[number] = true
+		}
+		assert.Equal(t, expected, assigned)
+		assert.Equal(t, 150, m.Size())
+	})
+
+	t.Run("concurrent Create of the same peer", func(t *testing.T) {
+		m := NewManager(ManagerConfig{})
+		addr := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+
+		const n = 100
+		bindings := make([]*Binding, n)
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			i := i
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				b, err := m.Create(addr)
+				assert.NoError(t, err)
+				bindings[i] = b
+			}()
+		}
+		wg.Wait()
+
+		// Every caller gets the one binding, with no orphan left behind
+		for _, b := range bindings {
+			assert.Same(t, bindings[0], b)
+		}
+		assert.Equal(t, 1, m.Size())
+		assert.True(t, m.DeleteByAddr(addr))
+		_, ok := m.FindByChannel(bindings[0].Number())
+		assert.False(t, ok)
+		assert.Equal(t, 0, m.Size())
+	})
+
+	t.Run("channel range", func(t *testing.T) {
+		audio := NewManager(ManagerConfig{MinChannel: 0x4000, MaxChannel: 0x4003})
+		video := NewManager(ManagerConfig{MinChannel: 0x5000, MaxChannel: 0x5003})
+		first, last := video.ChannelRange()
+		assert.Equal(t, uint16(0x5000), first)
+		assert.Equal(t, uint16(0x5003), last)
+
+		// The same peers get numbers from separate ranges
+		for i := 0; i < 4; i++ {
+			peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, byte(i)), Port: 5000}
+			a := mustCreateBinding(t, audio, peer)
+			v := mustCreateBinding(t, video, peer)
+			assert.Equal(t, uint16(0x4000+i), a.number)
+			assert.Equal(t, uint16(0x5000+i), v.number)
+		}
+
+		peer := &net.UDPAddr{IP: net.IPv4(10, 0, 1, 0), Port: 5000}
+		_, err := video.Create(peer)
+		assert.ErrorIs(t, err, ErrChannelRangeExhausted)
+		assert.ErrorIs(t, err, ErrChannelNumbersExhausted)
+
+		// A freed number is handed out again
+		assert.True(t, video.DeleteByChannel(0x5002))
+		assert.Equal(t, uint16(0x5002), mustCreateBinding(t, video, peer).number)
+	})
+
+	t.Run("channel range defaults", func(t *testing.T) {
+		for _, config := range []ManagerConfig{{}, {MinChannel: 1, MaxChannel: 0xffff}} {
+			first, last := NewManager(config).ChannelRange()
+			assert.Equal(t, minChannelNumber, first)
+			assert.Equal(t, maxChannelNumber, last)
+		}
+
+		// An empty range creates no bindings
+		m := NewManager(ManagerConfig{MinChannel: 0x5000, MaxChannel: 0x4fff})
+		_, err := m.Create(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000})
+		assert.ErrorIs(t, err, ErrChannelRangeExhausted)
+	})
+
+	t.Run("full channel range", func(t *testing.T) {
+		total := int(maxChannelNumber-minChannelNumber) + 1
+		m := NewManager(ManagerConfig{})
+		for i := 0; i < total; i++ {
+			mustCreateBinding(t, m, &net.UDPAddr{IP: net.IPv4(10, 0, byte(i>>8), byte(i)), Port: 5000})
+		}
+
+		// An allocator wrapping around to numbers in use
+		var asked bool
+		m.numbers = channelNumberAllocatorFunc(func(net.Addr, func(uint16) bool) (uint16, error) {
+			asked = true
+
+			return minChannelNumber, nil
+		})
+		_, err := m.Create(&net.UDPAddr{IP: net.IPv4(10, 1, 0, 0), Port: 5000})
+		assert.ErrorIs(t, err, ErrChannelNumbersExhausted)
+		assert.False(t, asked, "the allocator is not asked once all numbers are bound")
+		assert.Equal(t, total, m.Size())
+
+		m = NewManager(ManagerConfig{MinChannel: 0x5000, MaxChannel: 0x5000})
+		mustCreateBinding(t, m, &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000})
+		_, err = m.Create(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 5000})
+		assert.ErrorIs(t, err, ErrChannelRangeExhausted)
+		assert.ErrorIs(t, err, ErrChannelNumbersExhausted)
+	})
+
+	t.Run("high-water mark", func(t *testing.T) {
+		type call struct{ current, max int }
+		var calls []call
+		m := NewManager(ManagerConfig{
+			MinChannel:    0x4000,
+			MaxChannel:    0x40FF,
+			HighWaterMark: 2,
+			OnHighWaterMark: func(current, max int) {
+				calls = append(calls, call{current, max})
+			},
+		})
+		peer := func(i int) net.Addr { return &net.UDPAddr{IP: net.IPv4(10, 0, 0, byte(i)), Port: 5000} }
+
+		mustCreateBinding(t, m, peer(1))
+		mustCreateBinding(t, m, peer(2))
+		assert.Empty(t, calls, "the mark is not exceeded")
+		mustCreateBinding(t, m, peer(3))
+		mustCreateBinding(t, m, peer(4))
+		assert.Equal(t, []call{{3, 256}}, calls, "only crossing the mark is reported")
+
+		// Falling back to the mark arms the callback again
+		assert.True(t, m.DeleteByAddr(peer(4)))
+		assert.True(t, m.DeleteByAddr(peer(3)))
+		mustCreateBinding(t, m, peer(3))
+		assert.Equal(t, []call{{3, 256}, {3, 256}}, calls)
+		mustCreateBinding(t, m, peer(3))
+		assert.Len(t, calls, 2, "an existing binding is not reported again")
+
+		// Disabled without a mark
+		m = NewManager(ManagerConfig{OnHighWaterMark: func(int, int) { t.Fatal("called without a mark") }})
+		mustCreateBinding(t, m, peer(1))
+	})
+
+	t.Run("channel range with custom ChannelNumberAllocator", func(t *testing.T) {
+		m := NewManager(ManagerConfig{
+			MinChannel: 0x4002,
+			MaxChannel: 0x4003,
+			ChannelNumberAllocator: channelNumberAllocatorFunc(func(_ net.Addr, inUse func(uint16) bool) (uint16, error) {
+				for number := minChannelNumber; number <= maxChannelNumber; number++ {
+					if !inUse(number) {
+						return number, nil
+					}
+				}
+
+				return 0, ErrChannelNumbersExhausted
+			}),
+		})
+		assert.Equal(t, uint16(0x4002), mustCreateBinding(t, m, &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}).number)
+
+		m.numbers = channelNumberAllocatorFunc(func(net.Addr, func(uint16) bool) (uint16, error) {
+			return minChannelNumber, nil
+		})
+		_, err := m.Create(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 5000})
+		assert.ErrorIs(t, err, proto.ErrInvalidChannelNumber, "numbers outside of the range are rejected")
+	})
+
+	t.Run("custom ChannelNumberAllocator", func(t *testing.T) {
+		m := NewManager(ManagerConfig{})
+		m.numbers = channelNumberAllocatorFunc(func(peer net.Addr, inUse func(uint16) bool) (uint16, error) {
+			// Reserve 0x6000 and up for port 6000
+			number := uint16(0x6000)
+			if peer.(*net.UDPAddr).Port != 6000 { //nolint:forcetypeassert
+				number = minChannelNumber
+			}
+			for inUse(number) {
+				number++
+			}
+
+			return number, nil
+		})
+
+		b := mustCreateBinding(t, m, &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 6000})
+		assert.Equal(t, uint16(0x6000), b.number)
+		b = mustCreateBinding(t, m, &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 6000})
+		assert.Equal(t, uint16(0x6001), b.number)
+		b = mustCreateBinding(t, m, &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000})
+		assert.Equal(t, minChannelNumber, b.number)
+	})
+
+	t.Run("invalid channel numbers", func(t *testing.T) {
+		for _, number := range []uint16{0, minChannelNumber - 1, maxChannelNumber + 1} {
+			m := NewManager(ManagerConfig{})
+			m.numbers = channelNumberAllocatorFunc(func(net.Addr, func(uint16) bool) (uint16, error) {
+				return number, nil
+			})
+			_, err := m.Create(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000})
+			assert.ErrorIs(t, err, proto.ErrInvalidChannelNumber)
+			assert.Equal(t, 0, m.Size())
+		}
+
+		m := NewManager(ManagerConfig{})
+		m.numbers = channelNumberAllocatorFunc(func(net.Addr, func(uint16) bool) (uint16, error) {
+			return minChannelNumber, nil
+		})
+		mustCreateBinding(t, m, &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000})
+		_, err := m.Create(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 5000})
+		assert.ErrorIs(t, err, ErrChannelNumberInUse)
+		assert.Equal(t, 1, m.Size())
+	})
+
+	t.Run("snapshot", func(t *testing.T) {
+		m := NewManager(ManagerConfig{})
+		assert.Empty(t, m.Snapshot())
+
+		first := mustCreateBinding(t, m, &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000})
+		second := mustCreateBinding(t, m, &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 5000})
+		second.SetState(StateReady)
+		refreshedAt := time.Now().Add(-time.Minute)
+		second.SetRefreshedAt(refreshedAt)
+
+		assert.Equal(t, []Info{
+			{
+				ChannelNumber:   first.number,
+				RemoteAddr:      first.addr,
+				State:           StateIdle,
+				LastRefreshedAt: first.RefreshedAt(),
+			},
+			{
+				ChannelNumber:   second.number,
+				RemoteAddr:      second.addr,
+				State:           StateReady,
+				LastRefreshedAt: refreshedAt,
+			},
+		}, m.Snapshot())
+
+		// The snapshot is a copy
+		assert.True(t, m.DeleteByAddr(first.addr))
+		assert.Len(t, m.Snapshot(), 1)
+	})
+
+	t.Run("snapshot concurrency", func(t *testing.T) {
+		m := NewManager(ManagerConfig{})
+		done := make(chan struct{})
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; ; j++ {
+					select {
+					case <-done:
+						return
+					default:
+					}
+					addr := &net.UDPAddr{IP: net.IPv4(10, 0, byte(i), byte(j%8)), Port: 5000 + i}
+					if b, err := m.Create(addr); err == nil && j%2 == 0 {
+						m.DeleteByChannel(b.number)
+					} else {
+						m.DeleteByAddr(addr)
+					}
+				}
+			}(i)
+		}
+
+		for i := 0; i < 1000; i++ {
+			seen := map[string]bool{}
+			infos := m.Snapshot()
+			for j, info := range infos {
+				assert.True(t, proto.ChannelNumber(info.ChannelNumber).Valid())
+				if assert.NotNil(t, info.RemoteAddr) {
+					key := info.RemoteAddr.String()
+					assert.False(t, seen[key], "peer bound twice")
+					seen[key] = true
+				}
+				assert.False(t, info.LastRefreshedAt.IsZero())
+				if j > 0 {
+					assert.Less(t, infos[j-1].ChannelNumber, info.ChannelNumber)
+				}
+			}
+		}
+		close(done)
+		wg.Wait()
+	})
+
+	t.Run("DeleteByState", func(t *testing.T) {
+		m := NewManager(ManagerConfig{})
+		states := []State{StateIdle, StateFailed, StateReady, StateFailed, StateRefresh}
+		for i, state := range states {
+			mustCreateBinding(t, m, &net.UDPAddr{IP: net.IPv4(10, 0, 0, byte(i)), Port: 5000}).SetState(state)
+		}
+
+		assert.Equal(t, 2, m.DeleteByState(StateFailed))
+		assert.Equal(t, 3, m.Size())
+		for i, state := range states {
+			b, ok := m.FindByAddr(&net.UDPAddr{IP: net.IPv4(10, 0, 0, byte(i)), Port: 5000})
+			assert.Equal(t, state != StateFailed, ok)
+			if ok {
+				assert.Equal(t, state, b.State())
+				_, ok = m.FindByChannel(b.number)
+				assert.True(t, ok)
+			}
+		}
+		assert.Equal(t, 0, m.DeleteByState(StateFailed))
+	})
+
+	t.Run("DeleteByState concurrency", func(t *testing.T) {
+		m := NewManager(ManagerConfig{})
+		var wg sync.WaitGroup
+		var created atomic.Int32
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 200; j++ {
+					b, err := m.Create(&net.UDPAddr{IP: net.IPv4(10, 0, byte(i), byte(j)), Port: 5000})
+					if assert.NoError(t, err) {
+						created.Add(1)
+						if j%2 == 0 {
+							b.SetState(StateFailed)
+						}
+					}
+				}
+			}(i)
+		}
+
+		deleted := 0
+		for created.Load() < 800 {
+			deleted += m.DeleteByState(StateFailed)
+		}
+		wg.Wait()
+		deleted += m.DeleteByState(StateFailed)
+
+		assert.Equal(t, 400, deleted)
+		assert.Equal(t, 400, m.Size())
+		for _, info := range m.Snapshot() {
+			assert.Equal(t, StateIdle, info.State)
+		}
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		m := NewManager(ManagerConfig{})
+		mustCreateBinding(t, m, &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000})
+
+		var running, stopped atomic.Int32
+		for i := 0; i < 3; i++ {
+			assert.True(t, m.Go(func(ctx context.Context) {
+				running.Add(1)
+				<-ctx.Done()
+				time.Sleep(10 * time.Millisecond) // Close waits for the cleanup
+				stopped.Add(1)
+			}))
+		}
+		assert.Eventually(t, func() bool { return running.Load() == 3 }, time.Second, time.Millisecond)
+
+		assert.NoError(t, m.Close())
+		assert.Equal(t, int32(3), stopped.Load())
+		assert.Equal(t, 0, m.Size())
+
+		assert.False(t, m.Go(func(context.Context) { t.Error("ran after Close") }))
+		_, err := m.Create(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 5000})
+		assert.ErrorIs(t, err, ErrManagerClosed)
+		assert.ErrorIs(t, m.Close(), ErrManagerClosed)
+	})
+
+	t.Run("Close concurrency", func(t *testing.T) {
+		m := NewManager(ManagerConfig{})
+		var wg sync.WaitGroup
+		var started, stopped atomic.Int32
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					if _, err := m.Create(&net.UDPAddr{IP: net.IPv4(10, 0, byte(i), byte(j)), Port: 5000}); err != nil {
+						assert.ErrorIs(t, err, ErrManagerClosed)
+					}
+					m.Go(func(ctx context.Context) {
+						started.Add(1)
+						<-ctx.Done()
+						stopped.Add(1)
+					})
+				}
+			}(i)
+		}
+
+		assert.NoError(t, m.Close())
+		assert.Equal(t, started.Load(), stopped.Load(), "Close returned before all goroutines")
+		wg.Wait()
+		assert.Equal(t, started.Load(), stopped.Load())
+		assert.Equal(t, 0, m.Size())
+	})
+}
+
+type channelNumberAllocatorFunc func(peer net.Addr, inUse func(number uint16) bool) (uint16, error)
+
+func (f channelNumberAllocatorFunc) AllocateChannelNumber(peer net.Addr, inUse func(uint16) bool) (uint16, error) {
+	return f(peer, inUse)
+}
@@ -0,0 +1,25 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package binding
+
+import "errors"
+
+var (
+	// ErrChannelNumbersExhausted is returned by a ChannelNumberAllocator that
+	// has no free channel number left.
+	ErrChannelNumbersExhausted = errors.New("all channel numbers are in use")
+	// ErrChannelRangeExhausted is returned by Manager.Create if all channel
+	// numbers in the range set with ManagerConfig.MinChannel and MaxChannel
+	// are in use. It wraps ErrChannelNumbersExhausted.
+	ErrChannelRangeExhausted = errors.New("all channel numbers in the range are in use")
+	// ErrChannelNumberInUse is returned by Manager.Create if the
+	// ChannelNumberAllocator picked a number that is already bound.
+	ErrChannelNumberInUse = errors.New("channel number is already in use")
+	// ErrInvalidTransition is returned by StateMachine.Transition for an
+	// input that does not apply to the current state.
+	ErrInvalidTransition = errors.New("invalid channel binding state transition")
+	// ErrManagerClosed is returned by Manager.Create and Manager.Close once
+	// the Manager is closed.
+	ErrManagerClosed = errors.New("binding manager is closed")
+)
@@ -0,0 +1,108 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package binding
+
+import "fmt"
+
+// Input is an event moving a binding through its ChannelBind lifecycle.
+type Input int
+
+const (
+	// InputBind is a write to a peer whose channel is not bound yet.
+	InputBind Input = iota
+	// InputRefreshDue is a binding check finding a ready binding older than
+	// the refresh interval.
+	InputRefreshDue
+	// InputSucceeded is a successful ChannelBind response.
+	InputSucceeded
+	// InputFailed is a failed ChannelBind transaction.
+	InputFailed
+	// InputCooldownElapsed is the end of the wait before a failed binding
+	// may be tried again.
+	InputCooldownElapsed
+	// InputRebind is a new allocation on which bound channels are bound again.
+	InputRebind
+)
+
+func (i Input) String() string {
+	switch i {
+	case InputBind:
+		return "bind"
+	case InputRefreshDue:
+		return "refresh due"
+	case InputSucceeded:
+		return "succeeded"
+	case InputFailed:
+		return "failed"
+	case InputCooldownElapsed:
+		return "cooldown elapsed"
+	case InputRebind:
+		return "rebind"
+	default:
+		return "unknown"
+	}
+}
+
+// transitions is the ChannelBind lifecycle:
+//
+//	idle    --bind-------------> request
+//	request --succeeded--------> ready
+//	request --failed-----------> failed
+//	ready   --refresh due------> refresh
+//	ready   --rebind-----------> request
+//	refresh --succeeded--------> ready
+//	refresh --failed-----------> failed
+//	refresh --rebind-----------> request
+//	failed  --cooldown elapsed-> idle
+var transitions = map[State]map[Input]State{ //nolint:gochecknoglobals
+	StateIdle: {
+		InputBind: StateRequest,
+	},
+	StateRequest: {
+		InputSucceeded: StateReady,
+		InputFailed:    StateFailed,
+	},
+	StateReady: {
+		InputRefreshDue: StateRefresh,
+		InputRebind:     StateRequest,
+	},
+	StateRefresh: {
+		InputSucceeded: StateReady,
+		InputFailed:    StateFailed,
+		InputRebind:    StateRequest,
+	},
+	StateFailed: {
+		InputCooldownElapsed: StateIdle,
+	},
+}
+
+// StateMachine is the ChannelBind lifecycle of a Binding. The zero value is
+// ready to use.
+type StateMachine struct{}
+
+// Transition returns the state a binding in current moves to on input, or
+// ErrInvalidTransition if input does not apply to current.
+func (StateMachine) Transition(current State, input Input) (State, error) {
+	next, ok := transitions[current][input]
+	if !ok {
+		return current, fmt.Errorf("%w: %s on %s", ErrInvalidTransition, input, current)
+	}
+
+	return next, nil
+}
+
+// Apply moves the binding to the state the StateMachine reaches from its
+// current state on input, and returns that state.
+func (b *Binding) Apply(input Input) (State, error) {
+	for {
+		current := b.State()
+		next, err := StateMachine{}.Transition(current, input)
+		if err != nil {
+			return current, err
+		}
+		if b.CompareAndSwapState(current, next) {
+			return next, nil
+		}
+	}
+}
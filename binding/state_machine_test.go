@@ -0,0 +1,64 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package binding
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateMachine(t *testing.T) {
+	states := []State{StateIdle, StateRequest, StateReady, StateRefresh, StateFailed}
+	inputs := []Input{InputBind, InputRefreshDue, InputSucceeded, InputFailed, InputCooldownElapsed, InputRebind}
+
+	// Every valid transition, all other pairs of state and input are invalid
+	valid := map[State]map[Input]State{
+		StateIdle:    {InputBind: StateRequest},
+		StateRequest: {InputSucceeded: StateReady, InputFailed: StateFailed},
+		StateReady:   {InputRefreshDue: StateRefresh, InputRebind: StateRequest},
+		StateRefresh: {InputSucceeded: StateReady, InputFailed: StateFailed, InputRebind: StateRequest},
+		StateFailed:  {InputCooldownElapsed: StateIdle},
+	}
+
+	for _, state := range states {
+		for _, input := range inputs {
+			t.Run(fmt.Sprintf("%s on %s", input, state), func(t *testing.T) {
+				next, err := StateMachine{}.Transition(state, input)
+				want, ok := valid[state][input]
+				if !ok {
+					assert.ErrorIs(t, err, ErrInvalidTransition)
+					assert.Equal(t, state, next, "an invalid input keeps the state")
+
+					return
+				}
+				assert.NoError(t, err)
+				assert.Equal(t, want, next)
+			})
+		}
+	}
+
+	t.Run("Binding.Apply", func(t *testing.T) {
+		var changes []string
+		mgr := NewManager(ManagerConfig{OnStateChange: func(_ net.Addr, oldState, newState State) {
+			changes = append(changes, oldState.String()+"->"+newState.String())
+		}})
+		bound := mustCreateBinding(t, mgr, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5000})
+
+		next, err := bound.Apply(InputBind)
+		assert.NoError(t, err)
+		assert.Equal(t, StateRequest, next)
+
+		next, err = bound.Apply(InputBind)
+		assert.ErrorIs(t, err, ErrInvalidTransition)
+		assert.Equal(t, StateRequest, next)
+
+		_, err = bound.Apply(InputSucceeded)
+		assert.NoError(t, err)
+		assert.Equal(t, StateReady, bound.State())
+		assert.Equal(t, []string{"idle->request", "request->ready"}, changes)
+	})
+}
@@ -4,10 +4,14 @@
 package turn
 
 import (
+	"context"
+	"crypto/tls"
 	b64 "encoding/base64"
+	"errors"
 	"fmt"
 	"math"
 	"net"
+	"slices"
 	"sync"
 	"time"
 
@@ -17,12 +21,15 @@ import (
 	"github.com/pion/transport/v3/stdnet"
 	"github.com/pion/turn/v4/internal/client"
 	"github.com/pion/turn/v4/internal/proto"
+	"github.com/pion/turn/v4/metrics"
 )
 
 const (
 	defaultRTO        = 200 * time.Millisecond
-	maxRtxCount       = 7              // Total 7 requests (Rc)
-	maxDataBufferSize = math.MaxUint16 // Message size limit for Chromium
+	maxRtxCount       = 7                // Total 7 requests (Rc)
+	maxRealmChanges   = 3                // Credential refreshes per request for new realms
+	maxDataBufferSize = math.MaxUint16   // Message size limit for Chromium
+	tlsDialTimeout    = 10 * time.Second // Dialing the TURN server with WithTLS or WithWebSocket
 )
 
 //              interval [msec]
@@ -35,6 +42,56 @@ const (
 // 6: 31500 ms  +32000
 // -: 63500 ms  failed
 
+// RequestedAddressFamily is the family of a relayed address, as requested
+// with REQUESTED-ADDRESS-FAMILY, RFC 6156 Section 4.1.1.
+type RequestedAddressFamily = proto.RequestedAddressFamily
+
+const (
+	// RequestedFamilyIPv4 requests an IPv4 relayed address, AF_INET.
+	RequestedFamilyIPv4 = proto.RequestedFamilyIPv4
+	// RequestedFamilyIPv6 requests an IPv6 relayed address, AF_INET6.
+	RequestedFamilyIPv6 = proto.RequestedFamilyIPv6
+)
+
+// AllocateOptions control the UDP allocation made by AllocateWithOptions.
+type AllocateOptions struct {
+	// AddressFamily is the family of the relayed address to request. Zero
+	// sends no REQUESTED-ADDRESS-FAMILY, which servers answer with an IPv4
+	// address, RFC 6156 Section 4.2.
+	AddressFamily RequestedAddressFamily
+}
+
+// CredentialAlgorithm selects the algorithm used for long-term credentials.
+type CredentialAlgorithm int
+
+const (
+	// CredentialAlgorithmSHA1 authenticates with MESSAGE-INTEGRITY (HMAC-SHA1)
+	// and an MD5 key, as defined in RFC 5389. This is the default.
+	CredentialAlgorithmSHA1 CredentialAlgorithm = iota
+	// CredentialAlgorithmSHA256 authenticates with MESSAGE-INTEGRITY-SHA256
+	// (HMAC-SHA256) and a SHA-256 key, as defined in RFC 8489 Section 9.2.
+	// Responses to authenticated requests must carry a valid MESSAGE-INTEGRITY-SHA256.
+	CredentialAlgorithmSHA256
+	// CredentialAlgorithmAuto authenticates with CredentialAlgorithmSHA256 if
+	// the TURN server offers SHA-256 in the PASSWORD-ALGORITHMS of its 401
+	// response to the first Allocate, RFC 8489 Section 9.2.4, and with
+	// CredentialAlgorithmSHA1 otherwise.
+	CredentialAlgorithmAuto
+)
+
+func (a CredentialAlgorithm) String() string {
+	switch a {
+	case CredentialAlgorithmSHA1:
+		return "SHA1"
+	case CredentialAlgorithmSHA256:
+		return "SHA256"
+	case CredentialAlgorithmAuto:
+		return "Auto"
+	default:
+		return fmt.Sprintf("CredentialAlgorithm(%d)", int(a))
+	}
+}
+
 // ClientConfig is a bag of config parameters for Client.
 type ClientConfig struct {
 	STUNServerAddr string // STUN server address (e.g. "stun.abc.com:3478")
@@ -42,27 +99,56 @@ type ClientConfig struct {
 	Username       string
 	Password       string
 	Realm          string
-	Software       string
+	Software       string // SOFTWARE added to requests, "pion/turn <version>" if empty
 	RTO            time.Duration
 	Conn           net.PacketConn // Listening socket (net.PacketConn)
 	Net            transport.Net
 	LoggerFactory  logging.LoggerFactory
+
+	// CredentialAlgorithm used to authenticate with the TURN server, SHA1 by default.
+	CredentialAlgorithm CredentialAlgorithm
+
+	// Transport to the TURN server. By default it is TLS if TLSConfig is set,
+	// otherwise Conn.
+	Transport ClientTransport
+	// TLSConfig of ClientTransportTLS, like WithTLS.
+	TLSConfig *tls.Config
+
+	RetransmitCount int           // Like WithRetransmitCount, zero selects the default
+	RetransmitMax   time.Duration // Like WithRetransmitMax, zero selects the default
 }
 
 // Client is a STUN server client.
 type Client struct {
-	conn           net.PacketConn // Read-only
-	net            transport.Net  // Read-only
-	stunServerAddr net.Addr       // Read-only
-	turnServerAddr net.Addr       // Read-only
-
-	username      stun.Username          // Read-only
-	password      string                 // Read-only
-	realm         stun.Realm             // Read-only
-	integrity     stun.MessageIntegrity  // Read-only
+	_conn           net.PacketConn   // Protected by mutex, replaced by MigrateAllocation
+	tlsConfig       *tls.Config      // Read-only, set by WithTLS
+	webSocketURL    string           // Read-only, set by WithWebSocket
+	webSocketOrigin string           // Read-only, set by WithWebSocket
+	udpConnOpts     []UDPConnOption  // Read-only, set by WithUDPConnOptions
+	recorder        *sessionRecorder // Thread-safe, set by WithSessionRecorder, may be nil
+	ownsConn        bool             // Read-only, the conn was dialed by NewClient
+	net             transport.Net    // Read-only
+	stunServerAddr  net.Addr         // Read-only
+	turnServerAddr  net.Addr         // Read-only
+
+	username      stun.Username          // Protected by mutex, replaced by the credRefresher
+	password      string                 // Protected by mutex, replaced by the credRefresher
+	realm         stun.Realm             // Protected by mutex
+	credDeriver   CredentialDeriver      // Protected by mutex, replaced by the algorithm negotiation
+	negotiate     bool                   // Read-only, set by CredentialAlgorithmAuto
+	credRefresher CredentialRefresher    // Read-only, may be nil
+	accessToken   proto.AccessToken      // Read-only, set by NewThirdPartyAuthClient
+	integrity     proto.Integrity        // Protected by mutex
 	software      stun.Software          // Read-only
+	shortTerm     bool                   // Read-only, set by WithShortTermCredentials
+	mobility      bool                   // Read-only
+	verifyFP      bool                   // Read-only
+	breaker       *client.CircuitBreaker // Thread-safe, nil unless WithCircuitBreaker is used
+	trHistogram   *metrics.Histogram     // Thread-safe, may be nil
 	trMap         *client.TransactionMap // Thread-safe
 	rto           time.Duration          // Read-only
+	rtxCount      int                    // Read-only, requests sent per transaction (Rc)
+	rtxMax        time.Duration          // Read-only, zero means default
 	relayedConn   *client.UDPConn        // Protected by mutex ***
 	tcpAllocation *client.TCPAllocation  // Protected by mutex ***
 	allocTryLock  client.TryLock         // Thread-safe
@@ -74,7 +160,7 @@ type Client struct {
 
 // NewClient returns a new Client instance. listeningAddress is the address and port to listen on,
 // default "0.0.0.0:0".
-func NewClient(config *ClientConfig) (*Client, error) {
+func NewClient(config *ClientConfig, opts ...ClientOption) (*Client, error) {
 	loggerFactory := config.LoggerFactory
 	if loggerFactory == nil {
 		loggerFactory = logging.NewDefaultLoggerFactory()
@@ -82,8 +168,10 @@ func NewClient(config *ClientConfig) (*Client, error) {
 
 	log := loggerFactory.NewLogger("turnc")
 
-	if config.Conn == nil {
-		return nil, errNilConn
+	switch config.CredentialAlgorithm {
+	case CredentialAlgorithmSHA1, CredentialAlgorithmSHA256, CredentialAlgorithmAuto:
+	default:
+		return nil, fmt.Errorf("%w: %s", errUnknownCredentialAlgorithm, config.CredentialAlgorithm)
 	}
 
 	rto := defaultRTO
@@ -121,18 +209,80 @@ func NewClient(config *ClientConfig) (*Client, error) {
 	}
 
 	client := &Client{
-		conn:           config.Conn,
+		_conn:          config.Conn,
 		stunServerAddr: stunServ,
 		turnServerAddr: turnServ,
 		username:       stun.NewUsername(config.Username),
 		password:       config.Password,
 		realm:          stun.NewRealm(config.Realm),
+		credDeriver:    credentialDeriverFor(config.CredentialAlgorithm),
+		negotiate:      config.CredentialAlgorithm == CredentialAlgorithmAuto,
 		software:       stun.NewSoftware(config.Software),
 		trMap:          client.NewTransactionMap(),
 		net:            config.Net,
 		rto:            rto,
+		rtxCount:       maxRtxCount,
 		log:            log,
 	}
+	if len(client.software) == 0 {
+		client.software = stun.NewSoftware(defaultSoftware())
+	}
+
+	configOpts, err := config.options()
+	if err != nil {
+		return nil, err
+	}
+	for _, opt := range append(configOpts, opts...) {
+		if err := opt(client); err != nil {
+			return nil, err
+		}
+	}
+
+	if client.tlsConfig != nil {
+		if config.Conn != nil {
+			return nil, errConnWithTLS
+		}
+		tlsTransport, err := dialTLSTransport(config.Net, config.TURNServerAddr, client.tlsConfig, tlsDialTimeout)
+		if err != nil {
+			return nil, err
+		}
+		client._conn = tlsTransport
+		client.ownsConn = true
+	}
+
+	if client.webSocketURL != "" {
+		if client._conn != nil {
+			client.closeOwnedConn()
+
+			return nil, errConnWithWebSocket
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), tlsDialTimeout)
+		wsTransport, err := DialWebSocketTransport(ctx, client.webSocketURL, client.webSocketOrigin)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		client._conn = wsTransport
+		client.ownsConn = true
+	}
+
+	if client._conn == nil {
+		return nil, errNilConn
+	}
+
+	if client.recorder != nil {
+		if err := client.recorder.start(); err != nil {
+			client.closeOwnedConn()
+
+			return nil, err
+		}
+		client._conn = client.recorder.wrap(client._conn)
+	}
+
+	if client.shortTerm {
+		client.realm = nil
+		client.integrity = client.newIntegrity()
+	}
 
 	return client, nil
 }
@@ -149,17 +299,29 @@ func (c *Client) STUNServerAddr() net.Addr {
 
 // Username returns username.
 func (c *Client) Username() stun.Username {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
 	return c.username
 }
 
 // Realm return realm.
 func (c *Client) Realm() stun.Realm {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
 	return c.realm
 }
 
 // WriteTo sends data to the specified destination using the base socket.
 func (c *Client) WriteTo(data []byte, to net.Addr) (int, error) {
-	return c.conn.WriteTo(data, to)
+	if c.breaker != nil {
+		if err := c.breaker.AllowWrite(); err != nil {
+			return 0, err
+		}
+	}
+
+	return c.baseConn().WriteTo(data, to)
 }
 
 // Listen will have this client start listening on the conn provided via the config.
@@ -170,28 +332,35 @@ func (c *Client) Listen() error {
 		return fmt.Errorf("%w: %s", errAlreadyListening, err.Error())
 	}
 
-	go func() {
-		buf := make([]byte, maxDataBufferSize)
-		for {
-			n, from, err := c.conn.ReadFrom(buf)
-			if err != nil {
-				c.log.Debugf("Failed to read: %s. Exiting loop", err)
+	go c.readLoop(c.baseConn())
 
-				break
-			}
+	return nil
+}
 
-			_, err = c.HandleInbound(buf[:n], from)
-			if err != nil {
-				c.log.Debugf("Failed to handle inbound message: %s. Exiting loop", err)
+// readLoop handles everything read from conn until reading fails. Only the
+// loop of the current conn releases the listen lock, the loop of a conn
+// replaced by MigrateAllocation just exits.
+func (c *Client) readLoop(conn net.PacketConn) {
+	buf := make([]byte, maxDataBufferSize)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			c.log.Debugf("Failed to read: %s. Exiting loop", err)
 
-				break
-			}
+			break
 		}
 
-		c.listenTryLock.Unlock()
-	}()
+		_, err = c.HandleInbound(buf[:n], from)
+		if err != nil {
+			c.log.Debugf("Failed to handle inbound message: %s. Exiting loop", err)
 
-	return nil
+			break
+		}
+	}
+
+	if c.baseConn() == conn {
+		c.listenTryLock.Unlock()
+	}
 }
 
 // Close closes this client.
@@ -200,6 +369,16 @@ func (c *Client) Close() {
 	defer c.mutexTrMap.Unlock()
 
 	c.trMap.CloseAndDeleteAll()
+	c.closeOwnedConn()
+}
+
+// closeOwnedConn closes the conn if it was dialed by NewClient.
+func (c *Client) closeOwnedConn() {
+	if c.ownsConn {
+		if err := c.baseConn().Close(); err != nil {
+			c.log.Debugf("Failed to close conn: %s", err)
+		}
+	}
 }
 
 // TransactionID & Base64: https://play.golang.org/p/EEgmJDI971P
@@ -240,124 +419,621 @@ func (c *Client) SendBindingRequest() (net.Addr, error) {
 	return c.SendBindingRequestTo(c.stunServerAddr)
 }
 
-func (c *Client) sendAllocateRequest(protocol proto.Protocol) ( //nolint:cyclop
-	proto.RelayedAddress,
-	proto.Lifetime,
-	stun.Nonce,
-	error,
-) {
-	var relayed proto.RelayedAddress
-	var lifetime proto.Lifetime
-	var nonce stun.Nonce
+// allocateResult is what the server granted in an Allocate response.
+type allocateResult struct {
+	relayed  proto.RelayedAddress
+	mapped   stun.XORMappedAddress // Zero if the response carried none
+	lifetime proto.Lifetime
+	nonce    stun.Nonce
+	ticket   proto.MobilityTicket
+	token    proto.ReservationToken // Nil if the response carried none
+}
 
-	msg, err := stun.Build(
+// mappedAddr returns the server reflexive address, or nil if the response
+// carried none.
+func (r allocateResult) mappedAddr() net.Addr {
+	if r.mapped.IP == nil {
+		return nil
+	}
+
+	return &net.UDPAddr{IP: r.mapped.IP, Port: r.mapped.Port}
+}
+
+// sendAnonymousAllocateRequest sends an Allocate request without credentials,
+// storing the realm of the 401 response and returning its nonce, RFC 5766
+// Section 6.1, and the value of its PASSWORD-ALGORITHMS if there is one.
+func (c *Client) sendAnonymousAllocateRequest(
+	ctx context.Context,
+	protocol proto.Protocol,
+	requestMobility bool,
+	extra ...stun.Setter,
+) (stun.Nonce, []byte, error) {
+	attrs := []stun.Setter{
 		stun.TransactionID,
 		stun.NewType(stun.MethodAllocate, stun.ClassRequest),
 		proto.RequestedTransport{Protocol: protocol},
-		stun.Fingerprint,
-	)
+	}
+	if requestMobility {
+		attrs = append(attrs, proto.MobilityTicket(nil))
+	}
+	attrs = append(attrs, extra...)
+	if len(c.software) > 0 {
+		attrs = append(attrs, c.software)
+	}
+
+	msg, err := stun.Build(append(attrs, stun.Fingerprint)...)
 	if err != nil {
-		return relayed, lifetime, nonce, err
+		return nil, nil, err
 	}
 
-	trRes, err := c.PerformTransaction(msg, c.turnServerAddr, false)
+	trRes, err := c.PerformTransactionContext(ctx, msg, c.turnServerAddr, false)
 	if err != nil {
-		return relayed, lifetime, nonce, err
+		return nil, nil, err
 	}
 
 	res := trRes.Msg
 
 	// Anonymous allocate failed, trying to authenticate.
+	var nonce stun.Nonce
 	if err = nonce.GetFrom(res); err != nil {
-		return relayed, lifetime, nonce, err
+		return nil, nil, err
+	}
+	var realm stun.Realm
+	if err = realm.GetFrom(res); err != nil {
+		return nil, nil, err
+	}
+	algorithms, offered := passwordAlgorithms(res)
+	offer, _ := res.Get(stun.AttrPasswordAlgorithms)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.negotiate {
+		c.credDeriver = credentialDeriverFor(negotiateCredentialAlgorithm(algorithms))
 	}
-	if err = c.realm.GetFrom(res); err != nil {
-		return relayed, lifetime, nonce, err
+	if offered && !slices.Contains(algorithms, c.credDeriver.Algorithm()) {
+		return nil, nil, fmt.Errorf("%w: using %s, server offers %v",
+			errCredentialAlgorithmMismatch, c.credDeriver.Algorithm(), algorithms)
 	}
-	c.realm = append([]byte(nil), c.realm...)
-	c.integrity = stun.NewLongTermIntegrity(
-		c.username.String(), c.realm.String(), c.password,
-	)
+	c.realm = append(stun.Realm(nil), realm...)
+	c.integrity = c.newIntegrity()
+
+	return nonce, append([]byte(nil), offer...), nil
+}
+
+// sendAllocateRequest allocates a relayed address for protocol. The extra
+// attributes, e.g. EVEN-PORT, are added to the request.
+func (c *Client) sendAllocateRequest( //nolint:cyclop
+	ctx context.Context,
+	protocol proto.Protocol,
+	extra ...stun.Setter,
+) (allocateResult, error) {
+	var result allocateResult
+	var err error
+
+	// Mobility is only defined for UDP allocations, RFC 8016 Section 3.1.
+	requestMobility := c.mobility && protocol == proto.ProtoUDP
+
+	// Short-term credentials need no realm and nonce from the server
+	var offer []byte
+	if !c.shortTerm {
+		result.nonce, offer, err = c.sendAnonymousAllocateRequest(ctx, protocol, requestMobility, extra...)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	creds := c.credentials()
 	// Trying to authorize.
-	msg, err = stun.Build(
+	attrs := []stun.Setter{
 		stun.TransactionID,
 		stun.NewType(stun.MethodAllocate, stun.ClassRequest),
 		proto.RequestedTransport{Protocol: protocol},
-		&c.username,
-		&c.realm,
-		&nonce,
-		&c.integrity,
-		stun.Fingerprint,
-	)
+		creds.Username,
+	}
+	if len(creds.Realm) > 0 {
+		attrs = append(attrs, creds.Realm)
+	}
+	if requestMobility {
+		attrs = append(attrs, proto.MobilityTicket(nil))
+	}
+	attrs = append(attrs, extra...)
+	if len(c.software) > 0 {
+		attrs = append(attrs, c.software)
+	}
+	if c.accessToken != nil {
+		attrs = append(attrs, c.accessToken)
+	}
+	if len(result.nonce) > 0 {
+		attrs = append(attrs, &result.nonce)
+	}
+	if !c.shortTerm {
+		attrs = append(attrs, passwordAlgorithmAttrs(c.credentialAlgorithm(), offer)...)
+	}
+
+	msg, err := stun.Build(append(attrs, creds.Integrity, stun.Fingerprint)...)
 	if err != nil {
-		return relayed, lifetime, nonce, err
+		return result, err
 	}
 
-	trRes, err = c.PerformTransaction(msg, c.turnServerAddr, false)
+	trRes, err := c.PerformTransactionContext(ctx, msg, c.turnServerAddr, false)
 	if err != nil {
-		return relayed, lifetime, nonce, err
+		return result, err
 	}
-	res = trRes.Msg
+	res := trRes.Msg
 
 	if res.Type.Class == stun.ClassErrorResponse {
 		var code stun.ErrorCodeAttribute
 		if err = code.GetFrom(res); err == nil {
-			return relayed, lifetime, nonce, fmt.Errorf("%s (error %s)", res.Type, code) //nolint:err113
+			if code.Code == stun.CodeUnauthorized {
+				return result, fmt.Errorf("%w with %s: %s (error %s)",
+					errCredentialsRejected, c.credentialAlgorithm(), res.Type, code)
+			}
+			if code.Code == stun.CodeAllocQuotaReached {
+				return result, fmt.Errorf("%w: %s (error %s)", ErrAllocationQuotaReached, res.Type, code)
+			}
+
+			return result, fmt.Errorf("%s (error %s)", res.Type, code) //nolint:err113
 		}
 
-		return relayed, lifetime, nonce, fmt.Errorf("%s", res.Type) //nolint:err113
+		return result, fmt.Errorf("%s", res.Type) //nolint:err113
+	}
+
+	// Responses are expected to be protected with the SHA-256 key as well,
+	// RFC 8489 Section 9.2.5.
+	// The credentials may have been refreshed by PerformTransaction.
+	c.mutex.RLock()
+	algorithm, key := c.credDeriver.Algorithm(), c.credentialKey()
+	c.mutex.RUnlock()
+	if algorithm == CredentialAlgorithmSHA256 {
+		if err = verifyMessageSHA256(res, key); err != nil {
+			return result, fmt.Errorf("%w: %s", errResponseIntegrity, err.Error())
+		}
 	}
 
 	// Getting relayed addresses from response.
-	if err := relayed.GetFrom(res); err != nil {
-		return relayed, lifetime, nonce, err
+	if err := result.relayed.GetFrom(res); err != nil {
+		return result, err
+	}
+
+	// XOR-MAPPED-ADDRESS is mandatory (RFC 5766 Section 6.3), but it is
+	// only informational, so do not fail if a server omits it.
+	if err := result.mapped.GetFrom(res); err != nil {
+		c.log.Debug("TURN server did not return a mapped address")
 	}
 
 	// Getting lifetime from response
-	if err := lifetime.GetFrom(res); err != nil {
-		return relayed, lifetime, nonce, err
+	if err := result.lifetime.GetFrom(res); err != nil {
+		return result, err
+	}
+
+	// The server grants mobility by returning a ticket, a missing one is not
+	// an error.
+	if requestMobility {
+		if err := result.ticket.GetFrom(res); err != nil {
+			c.log.Debug("TURN server did not grant mobility")
+		}
+	}
+
+	// Only present if the next port was reserved, RFC 5766 Section 6.2.
+	if res.Contains(stun.AttrReservationToken) {
+		if err := result.token.GetFrom(res); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// credentials returns the current long-term credentials of the client,
+// without a nonce.
+func (c *Client) credentials() client.Credentials {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return client.Credentials{Username: c.username, Realm: c.realm, Integrity: c.integrity}
+}
+
+// credentialAlgorithm returns the algorithm the credentials are used with.
+func (c *Client) credentialAlgorithm() CredentialAlgorithm {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.credDeriver.Algorithm()
+}
+
+// credentialKey returns the key of the credentials. The caller must hold
+// the mutex.
+func (c *Client) credentialKey() []byte {
+	if c.shortTerm {
+		// The password is the key, RFC 5389 Section 15.4
+		return []byte(c.password)
 	}
 
-	return relayed, lifetime, nonce, nil
+	return c.credDeriver.Key(c.username.String(), c.realm.String(), c.password)
+}
+
+// newIntegrity returns the credential integrity for the configured
+// algorithm. The caller must hold the mutex.
+func (c *Client) newIntegrity() proto.Integrity {
+	return integrityFor(c.credDeriver.Algorithm(), c.credentialKey())
 }
 
 // Allocate sends a TURN allocation request to the given transport address.
+// The server identifies an allocation by the 5-tuple it was requested on
+// (RFC 5766 Section 2.2), so a Client holds a single UDP allocation and
+// further calls fail until it is closed. Use one Client, and conn, per
+// allocation, e.g. per ICE component; each gets its own relayed address,
+// permissions and channel bindings.
 func (c *Client) Allocate() (net.PacketConn, error) {
+	return c.AllocateContext(context.Background())
+}
+
+// AllocateContext acts like Allocate, abandoning the Allocate transaction
+// once ctx is done. A ClientTrace attached to ctx with WithClientTrace is
+// called on the events of the allocation.
+func (c *Client) AllocateContext(ctx context.Context) (net.PacketConn, error) {
+	relayedConn, _, err := c.allocateUDP(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return relayedConn, nil
+}
+
+// AllocateEvenPort allocates a relayed address with an even port, RFC 5766
+// Section 14.6, e.g. for RTP. If reserveNext is set the server also reserves
+// the next higher port, e.g. for RTCP, and returns a reservation token for it.
+// Pass the token to AllocateWithToken of another Client, as the server tells
+// allocations apart by their 5-tuple. The token is nil if the server did not
+// reserve the port.
+func (c *Client) AllocateEvenPort(ctx context.Context, reserveNext bool) (*client.UDPConn, []byte, error) {
+	relayedConn, result, err := c.allocateUDP(ctx, proto.EvenPort{ReservePort: reserveNext})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return relayedConn, result.token, nil
+}
+
+// AllocateWithToken allocates the relayed address reserved by an
+// AllocateEvenPort with reserveNext, using its reservation token, RFC 5766
+// Section 14.9.
+func (c *Client) AllocateWithToken(ctx context.Context, token []byte) (*client.UDPConn, error) {
+	relayedConn, _, err := c.allocateUDP(ctx, proto.ReservationToken(token))
+
+	return relayedConn, err
+}
+
+// AllocateWithOptions acts like AllocateContext, allocating as set by opts.
+// The relayed address has the requested family, the server rejects the
+// request with a 440 (Address Family not Supported) error otherwise.
+func (c *Client) AllocateWithOptions(ctx context.Context, opts AllocateOptions) (*client.UDPConn, error) {
+	var extra []stun.Setter
+	switch opts.AddressFamily {
+	case 0:
+	case RequestedFamilyIPv4, RequestedFamilyIPv6:
+		extra = append(extra, opts.AddressFamily)
+	default:
+		return nil, fmt.Errorf("%w: %d", errInvalidAddressFamily, opts.AddressFamily)
+	}
+
+	relayedConn, _, err := c.allocateUDP(ctx, extra...)
+
+	return relayedConn, err
+}
+
+// ResumeAllocation takes over the UDP allocation with the relayed address
+// prevRelayAddr that a previous Client held on the same local address, e.g.
+// after a restart shorter than the allocation lifetime. Instead of an
+// Allocate it sends a Refresh authenticated with prevNonce, see
+// UDPConn.Nonce, falling back to a fresh nonce if the server rejects it as
+// stale. Set ClientConfig.Realm to the realm of the previous allocation,
+// otherwise the Refresh is sent unauthenticated first to learn it.
+//
+// ErrAllocationExpired is returned if the server no longer holds the
+// allocation, call Allocate instead. Permissions and channel bindings of
+// the previous conn are not known, they are created again by the first
+// writes to each peer.
+func (c *Client) ResumeAllocation(
+	ctx context.Context,
+	prevRelayAddr net.Addr,
+	prevNonce []byte,
+) (*client.UDPConn, error) {
+	relayedAddr, ok := prevRelayAddr.(*net.UDPAddr)
+	if !ok || relayedAddr.IP == nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidRelayedAddr, prevRelayAddr)
+	}
+
 	if err := c.allocTryLock.Lock(); err != nil {
 		return nil, fmt.Errorf("%w: %s", errOneAllocateOnly, err.Error())
 	}
 	defer c.allocTryLock.Unlock()
 
-	relayedConn := c.relayedUDPConn()
-	if relayedConn != nil {
-		return nil, fmt.Errorf("%w: %s", errAlreadyAllocated, relayedConn.LocalAddr().String())
+	if existing := c.relayedUDPConn(); existing != nil {
+		return nil, fmt.Errorf("%w: %s", errAlreadyAllocated, existing.LocalAddr().String())
+	}
+
+	nonce := stun.Nonce(prevNonce)
+	lifetime, err := c.sendResumeRefresh(ctx, &nonce)
+	if err != nil {
+		return nil, err
 	}
 
-	relayed, lifetime, nonce, err := c.sendAllocateRequest(proto.ProtoUDP)
+	creds := c.credentials()
+	relayedConn, err := client.NewUDPConn(&client.AllocationConfig{
+		Client:      c,
+		RelayedAddr: &net.UDPAddr{IP: relayedAddr.IP, Port: relayedAddr.Port},
+		ServerAddr:  c.turnServerAddr,
+		Realm:       creds.Realm,
+		Username:    creds.Username,
+		Integrity:   creds.Integrity,
+		Nonce:       nonce,
+		Lifetime:    lifetime,
+		Net:         c.net,
+		Log:         c.log,
+		Software:    c.software,
+		Trace:       client.ContextClientTrace(ctx),
+	}, c.udpConnOpts...)
 	if err != nil {
 		return nil, err
 	}
+	c.setRelayedUDPConn(relayedConn)
+
+	return relayedConn, nil
+}
+
+// sendResumeRefresh refreshes the allocation on the 5-tuple of the client
+// and returns the lifetime granted. A 401 or 438 response replaces nonce,
+// and the realm if it carries one, for a single retry.
+func (c *Client) sendResumeRefresh(ctx context.Context, nonce *stun.Nonce) (time.Duration, error) {
+	// The integrity is only derived once the realm is known
+	c.mutex.Lock()
+	authenticate := len(c.realm) > 0 || c.shortTerm
+	if authenticate {
+		c.integrity = c.newIntegrity()
+	}
+	c.mutex.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		attrs := []stun.Setter{
+			stun.TransactionID,
+			stun.NewType(stun.MethodRefresh, stun.ClassRequest),
+		}
+		if len(c.software) > 0 {
+			attrs = append(attrs, c.software)
+		}
+		if authenticate {
+			creds := c.credentials()
+			attrs = append(attrs, creds.Username)
+			if !c.shortTerm {
+				attrs = append(attrs, creds.Realm, nonce)
+			}
+			attrs = append(attrs, creds.Integrity)
+		}
+
+		msg, err := stun.Build(append(attrs, stun.Fingerprint)...)
+		if err != nil {
+			return 0, err
+		}
+
+		trRes, err := c.PerformTransactionContext(ctx, msg, c.turnServerAddr, false)
+		if err != nil {
+			return 0, err
+		}
+		res := trRes.Msg
+
+		if res.Type.Class != stun.ClassErrorResponse {
+			var lifetime proto.Lifetime
+			if err := lifetime.GetFrom(res); err != nil {
+				return 0, err
+			}
+
+			return lifetime.Duration, nil
+		}
+
+		var code stun.ErrorCodeAttribute
+		if err := code.GetFrom(res); err != nil {
+			return 0, fmt.Errorf("%s", res.Type) //nolint:err113
+		}
+		switch {
+		case code.Code == stun.CodeAllocMismatch:
+			return 0, fmt.Errorf("%w: %s (error %s)", ErrAllocationExpired, res.Type, code)
+		case (code.Code == stun.CodeUnauthorized || code.Code == stun.CodeStaleNonce) && attempt == 0 && !c.shortTerm:
+			if err := nonce.GetFrom(res); err != nil {
+				return 0, err
+			}
+			var realm stun.Realm
+			if realm.GetFrom(res) == nil {
+				c.mutex.Lock()
+				c.realm = append(stun.Realm(nil), realm...)
+				c.integrity = c.newIntegrity()
+				c.mutex.Unlock()
+			}
+			authenticate = true
+		default:
+			return 0, fmt.Errorf("%s (error %s)", res.Type, code) //nolint:err113
+		}
+	}
+}
+
+// allocateUDP creates the UDP allocation of the client, with the extra
+// attributes added to the Allocate request.
+func (c *Client) allocateUDP(
+	ctx context.Context,
+	extra ...stun.Setter,
+) (relayedConn *client.UDPConn, result allocateResult, err error) {
+	trace := client.ContextClientTrace(ctx)
+	if trace != nil && trace.AllocateDone != nil {
+		defer func() {
+			if err != nil {
+				trace.AllocateDone(nil, err)
+			} else {
+				trace.AllocateDone(relayedConn.LocalAddr(), nil)
+			}
+		}()
+	}
+
+	if err := c.allocTryLock.Lock(); err != nil {
+		return nil, allocateResult{}, fmt.Errorf("%w: %s", errOneAllocateOnly, err.Error())
+	}
+	defer c.allocTryLock.Unlock()
+
+	if existing := c.relayedUDPConn(); existing != nil {
+		return nil, allocateResult{}, fmt.Errorf("%w: %s", errAlreadyAllocated, existing.LocalAddr().String())
+	}
+
+	result, err = c.sendAllocateRequest(ctx, proto.ProtoUDP, extra...)
+	if err != nil {
+		return nil, result, err
+	}
 
 	relayedAddr := &net.UDPAddr{
-		IP:   relayed.IP,
-		Port: relayed.Port,
+		IP:   result.relayed.IP,
+		Port: result.relayed.Port,
+	}
+	family := requestedFamily(extra)
+	if family != 0 && family != relayedFamily(relayedAddr.IP) {
+		return nil, result, fmt.Errorf("%w: requested %s, got %s", errRelayedAddressFamily, family, relayedAddr)
 	}
 
-	relayedConn = client.NewUDPConn(&client.AllocationConfig{
+	creds := c.credentials()
+	relayedConn, err = client.NewUDPConn(&client.AllocationConfig{
 		Client:      c,
 		RelayedAddr: relayedAddr,
+		MappedAddr:  result.mappedAddr(),
 		ServerAddr:  c.turnServerAddr,
-		Realm:       c.realm,
-		Username:    c.username,
-		Integrity:   c.integrity,
-		Nonce:       nonce,
-		Lifetime:    lifetime.Duration,
+		Realm:       creds.Realm,
+		Username:    creds.Username,
+		Integrity:   creds.Integrity,
+		Nonce:       result.nonce,
+		Lifetime:    result.lifetime.Duration,
 		Net:         c.net,
 		Log:         c.log,
-	})
+		Software:    c.software,
+		Trace:       trace,
+
+		AddressFamily:  family,
+		MobilityTicket: result.ticket,
+	}, c.udpConnOpts...)
+	if err != nil {
+		return nil, result, err
+	}
 	c.setRelayedUDPConn(relayedConn)
 
-	return relayedConn, nil
+	return relayedConn, result, nil
+}
+
+// requestedFamily returns the REQUESTED-ADDRESS-FAMILY among the attributes
+// of an Allocate request, or zero if there is none.
+func requestedFamily(attrs []stun.Setter) RequestedAddressFamily {
+	for _, attr := range attrs {
+		if family, ok := attr.(RequestedAddressFamily); ok {
+			return family
+		}
+	}
+
+	return 0
+}
+
+// relayedFamily returns the address family of ip.
+func relayedFamily(ip net.IP) RequestedAddressFamily {
+	if ip.To4() != nil {
+		return RequestedFamilyIPv4
+	}
+
+	return RequestedFamilyIPv6
+}
+
+// MigrateAllocation moves the UDP allocation to newConn, e.g. after the host
+// changed networks, using the TURN mobility extension (RFC 8016). The client
+// must have been created with WithMobility and the server must have granted
+// mobility at allocation time. The relayed conn returned by Allocate keeps
+// working with its permissions and channel bindings.
+//
+// newConn replaces the conn of the client, and is read from if the client is
+// listening. The previous conn is left open for the caller to close. If the
+// migration fails the previous conn is restored and newConn may be closed.
+func (c *Client) MigrateAllocation(newConn net.PacketConn) error {
+	if newConn == nil {
+		return errNilConn
+	}
+
+	relayedConn := c.relayedUDPConn()
+	if relayedConn == nil {
+		return errNoUDPAllocation
+	}
+
+	newConn = c.recording(newConn)
+	oldConn := c.setBaseConn(newConn)
+	if c.listenTryLock.Locked() {
+		go c.readLoop(newConn)
+	}
+
+	if err := relayedConn.Migrate(context.Background()); err != nil {
+		c.setBaseConn(oldConn)
+
+		return fmt.Errorf("%w: %w", errMigrationFailed, err)
+	}
+
+	return nil
+}
+
+// Reconnect moves the UDP allocation to a new allocation requested on
+// newConn, e.g. after the host changed networks and the TURN server does not
+// support mobility, see MigrateAllocation. The same credentials are used, and
+// the permissions and channel bindings of the relayed conn returned by
+// Allocate are created again. The relayed address changes, so peers must be
+// told the new LocalAddr of the relayed conn.
+//
+// Writes to the relayed conn fail with ErrReconnecting until Reconnect
+// returns. newConn replaces the conn of the client, and is read from if the
+// client is listening. The previous conn is left open for the caller to
+// close, the allocation on it expires on the server. If no new allocation
+// can be made the previous conn is restored and newConn may be closed.
+func (c *Client) Reconnect(newConn net.PacketConn) error {
+	if newConn == nil {
+		return errNilConn
+	}
+
+	relayedConn := c.relayedUDPConn()
+	if relayedConn == nil {
+		return errNoUDPAllocation
+	}
+
+	if err := c.allocTryLock.Lock(); err != nil {
+		return fmt.Errorf("%w: %s", errOneAllocateOnly, err.Error())
+	}
+	defer c.allocTryLock.Unlock()
+
+	newConn = c.recording(newConn)
+
+	return relayedConn.Reconnect(context.Background(), func() (client.Reallocation, error) {
+		oldConn := c.setBaseConn(newConn)
+		if c.listenTryLock.Locked() {
+			go c.readLoop(newConn)
+		}
+
+		// An IPv6 relayed address is requested again, IPv4 is the default
+		var extra []stun.Setter
+		if relayedConn.AddressFamily() == RequestedFamilyIPv6 {
+			extra = append(extra, RequestedFamilyIPv6)
+		}
+		result, err := c.sendAllocateRequest(context.Background(), proto.ProtoUDP, extra...)
+		if err != nil {
+			c.setBaseConn(oldConn)
+
+			return client.Reallocation{}, fmt.Errorf("%w: %w", errReconnectFailed, err)
+		}
+
+		return client.Reallocation{
+			RelayedAddr:    &net.UDPAddr{IP: result.relayed.IP, Port: result.relayed.Port},
+			MappedAddr:     result.mappedAddr(),
+			Nonce:          result.nonce,
+			Lifetime:       result.lifetime.Duration,
+			MobilityTicket: result.ticket,
+		}, nil
+	})
 }
 
 // AllocateTCP creates a new TCP allocation at the TURN server.
@@ -372,27 +1048,29 @@ func (c *Client) AllocateTCP() (*client.TCPAllocation, error) {
 		return nil, fmt.Errorf("%w: %s", errAlreadyAllocated, allocation.Addr())
 	}
 
-	relayed, lifetime, nonce, err := c.sendAllocateRequest(proto.ProtoTCP)
+	result, err := c.sendAllocateRequest(context.Background(), proto.ProtoTCP)
 	if err != nil {
 		return nil, err
 	}
 
 	relayedAddr := &net.TCPAddr{
-		IP:   relayed.IP,
-		Port: relayed.Port,
+		IP:   result.relayed.IP,
+		Port: result.relayed.Port,
 	}
 
+	creds := c.credentials()
 	allocation = client.NewTCPAllocation(&client.AllocationConfig{
 		Client:      c,
 		RelayedAddr: relayedAddr,
 		ServerAddr:  c.turnServerAddr,
-		Realm:       c.realm,
-		Username:    c.username,
-		Integrity:   c.integrity,
-		Nonce:       nonce,
-		Lifetime:    lifetime.Duration,
+		Realm:       creds.Realm,
+		Username:    creds.Username,
+		Integrity:   creds.Integrity,
+		Nonce:       result.nonce,
+		Lifetime:    result.lifetime.Duration,
 		Net:         c.net,
 		Log:         c.log,
+		Software:    c.software,
 	})
 
 	c.setTCPAllocation(allocation)
@@ -400,6 +1078,24 @@ func (c *Client) AllocateTCP() (*client.TCPAllocation, error) {
 	return allocation, nil
 }
 
+// ConnectToPeer opens a TCP connection to peer through the TCP allocation
+// made with AllocateTCP, RFC 6062 Section 4.3: a Connect request for peer
+// returns a CONNECTION-ID, which a ConnectionBind request binds to a new TCP
+// connection to the TURN server. That connection then carries the data to
+// and from peer. The permission for peer is created as needed.
+func (c *Client) ConnectToPeer(ctx context.Context, peer net.Addr) (net.Conn, error) {
+	allocation := c.getTCPAllocation()
+	if allocation == nil {
+		return nil, errNoTCPAllocation
+	}
+	tcpAddr, ok := peer.(*net.TCPAddr)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errInvalidPeerAddr, peer)
+	}
+
+	return allocation.DialTCPContext(ctx, "tcp", nil, tcpAddr)
+}
+
 // CreatePermission Issues a CreatePermission request for the supplied addresses
 // as described in https://datatracker.ietf.org/doc/html/rfc5766#section-9
 func (c *Client) CreatePermission(addrs ...net.Addr) error {
@@ -422,6 +1118,90 @@ func (c *Client) CreatePermission(addrs ...net.Addr) error {
 func (c *Client) PerformTransaction(msg *stun.Message, to net.Addr, ignoreResult bool) (client.TransactionResult,
 	error,
 ) {
+	return c.PerformTransactionContext(context.Background(), msg, to, ignoreResult)
+}
+
+// PerformTransactionContext performs STUN transaction. If ctx is done before
+// the transaction completes, the transaction is abandoned and ctx.Err() is returned.
+// With WithCircuitBreaker, it fails with ErrCircuitOpen while the circuit is open.
+// With WithCredentialRefresher, a request rejected with 401 is sent once more
+// with refreshed credentials. With WithTransactionHistogram, the time spent
+// waiting for the result is recorded.
+func (c *Client) PerformTransactionContext(
+	ctx context.Context,
+	msg *stun.Message,
+	to net.Addr,
+	ignoreResult bool,
+) (client.TransactionResult, error) {
+	if err := ctx.Err(); err != nil {
+		return client.TransactionResult{}, err
+	}
+	if c.trHistogram != nil && !ignoreResult {
+		defer func(start time.Time) { c.trHistogram.Observe(time.Since(start)) }(time.Now())
+	}
+	if c.accessToken != nil {
+		var err error
+		if msg, err = c.addAccessToken(msg); err != nil {
+			return client.TransactionResult{}, err
+		}
+	}
+
+	res, err := c.gatedTransaction(ctx, msg, to, ignoreResult)
+	if ignoreResult || c.credRefresher == nil {
+		return res, err
+	}
+
+	// Refreshed credentials are only refreshed again for a new realm, e.g.
+	// of a federated server the request ended up at
+	for refreshes := 0; err == nil && credentialsExpired(msg, res.Msg); refreshes++ {
+		if refreshes > 0 && (refreshes >= maxRealmChanges || !realmChanged(msg, res.Msg)) {
+			break
+		}
+		if msg, err = c.refreshCredentials(ctx, msg, res.Msg); err != nil {
+			return client.TransactionResult{}, err
+		}
+		res, err = c.gatedTransaction(ctx, msg, to, false)
+	}
+
+	return res, err
+}
+
+// gatedTransaction performs the transaction if the circuit breaker allows it.
+func (c *Client) gatedTransaction(
+	ctx context.Context,
+	msg *stun.Message,
+	to net.Addr,
+	ignoreResult bool,
+) (client.TransactionResult, error) {
+	if c.breaker == nil {
+		return c.performTransaction(ctx, msg, to, ignoreResult)
+	}
+
+	// Transactions without a result only tell whether they could be sent,
+	// so, like data, they are gated but do not count
+	if ignoreResult {
+		if err := c.breaker.AllowWrite(); err != nil {
+			return client.TransactionResult{}, err
+		}
+
+		return c.performTransaction(ctx, msg, to, ignoreResult)
+	}
+
+	if err := c.breaker.AllowTransaction(); err != nil {
+		return client.TransactionResult{}, err
+	}
+	res, err := c.performTransaction(ctx, msg, to, ignoreResult)
+	c.breaker.Done(err)
+
+	return res, err
+}
+
+func (c *Client) performTransaction(
+	ctx context.Context,
+	msg *stun.Message,
+	to net.Addr,
+	ignoreResult bool,
+) (client.TransactionResult, error) {
 	trKey := b64.StdEncoding.EncodeToString(msg.TransactionID[:])
 
 	raw := make([]byte, len(msg.Raw))
@@ -432,13 +1212,14 @@ func (c *Client) PerformTransaction(msg *stun.Message, to net.Addr, ignoreResult
 		Raw:          raw,
 		To:           to,
 		Interval:     c.rto,
+		MaxInterval:  c.rtxMax,
 		IgnoreResult: ignoreResult,
 	})
 
 	c.trMap.Insert(trKey, tr)
 
 	c.log.Tracef("Start %s transaction %s to %s", msg.Type, trKey, tr.To)
-	_, err := c.conn.WriteTo(tr.Raw, to)
+	_, err := c.baseConn().WriteTo(tr.Raw, to)
 	if err != nil {
 		return client.TransactionResult{}, err
 	}
@@ -450,14 +1231,43 @@ func (c *Client) PerformTransaction(msg *stun.Message, to net.Addr, ignoreResult
 		return client.TransactionResult{}, nil
 	}
 
-	res := tr.WaitForResult()
+	res := tr.WaitForResultContext(ctx)
 	if res.Err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil && errors.Is(res.Err, ctxErr) {
+			// Nobody is waiting for this transaction anymore
+			c.mutexTrMap.Lock()
+			tr.StopRtxTimer()
+			c.trMap.Delete(trKey)
+			c.mutexTrMap.Unlock()
+		}
+
 		return res, res.Err
 	}
 
 	return res, nil
 }
 
+// CancelTransaction aborts the pending transaction with transactionID. The
+// PerformTransaction waiting for it returns ErrTransactionCanceled right away
+// and no more retransmissions are sent. Completed transactions are not
+// affected.
+func (c *Client) CancelTransaction(transactionID [stun.TransactionIDSize]byte) {
+	trKey := b64.StdEncoding.EncodeToString(transactionID[:])
+
+	c.mutexTrMap.Lock()
+	defer c.mutexTrMap.Unlock()
+
+	tr, ok := c.trMap.Find(trKey)
+	if !ok {
+		return
+	}
+	tr.StopRtxTimer()
+	c.trMap.Delete(trKey)
+	if !tr.WriteResult(client.TransactionResult{Err: fmt.Errorf("%w %s", ErrTransactionCanceled, trKey)}) {
+		c.log.Debug("No listener for transaction")
+	}
+}
+
 // OnDeallocated is called when de-allocation of relay address has been complete.
 // (Called by UDPConn).
 func (c *Client) OnDeallocated(net.Addr) {
@@ -584,6 +1394,15 @@ func (c *Client) handleSTUNMessage(data []byte, from net.Addr) error { //nolint:
 	// - stun.ClassSuccessResponse
 	// - stun.ClassErrorResponse
 
+	if c.verifyFP && msg.Contains(stun.AttrFingerprint) {
+		if err := stun.Fingerprint.Check(msg); err != nil {
+			// Silently discard, the transaction waits for a valid response
+			c.log.Debugf("Failed to verify FINGERPRINT of %s: %s", msg, err)
+
+			return nil
+		}
+	}
+
 	trKey := b64.StdEncoding.EncodeToString(msg.TransactionID[:])
 
 	c.mutexTrMap.Lock()
@@ -605,6 +1424,7 @@ func (c *Client) handleSTUNMessage(data []byte, from net.Addr) error { //nolint:
 		Msg:     msg,
 		From:    from,
 		Retries: tr.Retries(),
+		RTT:     tr.RTT(),
 	}) {
 		c.log.Debugf("No listener for %s", msg)
 	}
@@ -649,7 +1469,7 @@ func (c *Client) onRtxTimeout(trKey string, nRtx int) {
 		return // Already gone
 	}
 
-	if nRtx == maxRtxCount {
+	if nRtx == c.rtxCount {
 		// All retransmissions failed
 		c.trMap.Delete(trKey)
 		if !tr.WriteResult(client.TransactionResult{
@@ -663,7 +1483,7 @@ func (c *Client) onRtxTimeout(trKey string, nRtx int) {
 
 	c.log.Tracef("Retransmitting transaction %s to %s (nRtx=%d)",
 		trKey, tr.To, nRtx)
-	_, err := c.conn.WriteTo(tr.Raw, tr.To)
+	_, err := c.baseConn().WriteTo(tr.Raw, tr.To)
 	if err != nil {
 		c.trMap.Delete(trKey)
 		if !tr.WriteResult(client.TransactionResult{
@@ -677,6 +1497,34 @@ func (c *Client) onRtxTimeout(trKey string, nRtx int) {
 	tr.StartRtxTimer(c.onRtxTimeout)
 }
 
+func (c *Client) baseConn() net.PacketConn {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c._conn
+}
+
+// recording returns conn recording its packets if WithSessionRecorder is
+// used, conn otherwise.
+func (c *Client) recording(conn net.PacketConn) net.PacketConn {
+	if c.recorder == nil {
+		return conn
+	}
+
+	return c.recorder.wrap(conn)
+}
+
+// setBaseConn replaces the conn and returns the previous one.
+func (c *Client) setBaseConn(conn net.PacketConn) net.PacketConn {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	old := c._conn
+	c._conn = conn
+
+	return old
+}
+
 func (c *Client) setRelayedUDPConn(conn *client.UDPConn) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
@@ -0,0 +1,251 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/transport/v3"
+)
+
+// ClientTransport is how a Client reaches the TURN server.
+type ClientTransport int
+
+const (
+	// ClientTransportDefault is ClientTransportTLS if ClientConfig.TLSConfig
+	// is set, otherwise ClientTransportUDP.
+	ClientTransportDefault ClientTransport = iota
+	// ClientTransportUDP sends over ClientConfig.Conn, usually a UDP socket.
+	ClientTransportUDP
+	// ClientTransportTLS dials ClientConfig.TURNServerAddr over TLS, like WithTLS.
+	ClientTransportTLS
+)
+
+func (t ClientTransport) String() string {
+	switch t {
+	case ClientTransportDefault:
+		return "Default"
+	case ClientTransportUDP:
+		return "UDP"
+	case ClientTransportTLS:
+		return "TLS"
+	default:
+		return fmt.Sprintf("ClientTransport(%d)", int(t))
+	}
+}
+
+// NewClientConfig returns an empty ClientConfig to be filled in with its
+// chainable setters, e.g.
+//
+//	config := turn.NewClientConfig().
+//		SetServer("turn.example.com:3478").
+//		SetCredentials("user", "pass").
+//		SetConn(conn)
+//	if err := config.Validate(); err != nil {
+//		return err
+//	}
+//	client, err := turn.NewClient(config)
+func NewClientConfig() *ClientConfig {
+	return &ClientConfig{}
+}
+
+// SetServer sets addr as both the STUN and the TURN server address.
+func (c *ClientConfig) SetServer(addr string) *ClientConfig {
+	c.STUNServerAddr, c.TURNServerAddr = addr, addr
+
+	return c
+}
+
+// SetSTUNServer sets the STUN server address.
+func (c *ClientConfig) SetSTUNServer(addr string) *ClientConfig {
+	c.STUNServerAddr = addr
+
+	return c
+}
+
+// SetTURNServer sets the TURN server address.
+func (c *ClientConfig) SetTURNServer(addr string) *ClientConfig {
+	c.TURNServerAddr = addr
+
+	return c
+}
+
+// SetCredentials sets the long-term credentials of the TURN server.
+func (c *ClientConfig) SetCredentials(username, password string) *ClientConfig {
+	c.Username, c.Password = username, password
+
+	return c
+}
+
+// SetRealm sets the realm of the credentials.
+func (c *ClientConfig) SetRealm(realm string) *ClientConfig {
+	c.Realm = realm
+
+	return c
+}
+
+// SetCredentialAlgorithm sets the algorithm of the credentials.
+func (c *ClientConfig) SetCredentialAlgorithm(algorithm CredentialAlgorithm) *ClientConfig {
+	c.CredentialAlgorithm = algorithm
+
+	return c
+}
+
+// SetConn sets the socket of ClientTransportUDP.
+func (c *ClientConfig) SetConn(conn net.PacketConn) *ClientConfig {
+	c.Conn = conn
+
+	return c
+}
+
+// SetTransport sets the transport to the TURN server.
+func (c *ClientConfig) SetTransport(t ClientTransport) *ClientConfig {
+	c.Transport = t
+
+	return c
+}
+
+// SetTLSConfig sets the TLS config of ClientTransportTLS.
+func (c *ClientConfig) SetTLSConfig(config *tls.Config) *ClientConfig {
+	c.TLSConfig = config
+
+	return c
+}
+
+// SetTimeout sets the initial retransmission timeout of STUN transactions.
+func (c *ClientConfig) SetTimeout(rto time.Duration) *ClientConfig {
+	c.RTO = rto
+
+	return c
+}
+
+// SetRetransmit sets how many times a STUN request is sent at most and the
+// cap of its retransmission timeout. Zero selects the defaults.
+func (c *ClientConfig) SetRetransmit(count int, maxInterval time.Duration) *ClientConfig {
+	c.RetransmitCount, c.RetransmitMax = count, maxInterval
+
+	return c
+}
+
+// SetLogger sets the factory of the loggers of the Client.
+func (c *ClientConfig) SetLogger(factory logging.LoggerFactory) *ClientConfig {
+	c.LoggerFactory = factory
+
+	return c
+}
+
+// SetNet sets the network the Client resolves and dials with.
+func (c *ClientConfig) SetNet(n transport.Net) *ClientConfig {
+	c.Net = n
+
+	return c
+}
+
+// Validate reports the first misconfiguration of c that NewClient would fail
+// on or that cannot work: no server address, an address without a port,
+// half of the credentials, out of range timeouts or a transport that does
+// not fit Conn and TLSConfig. NewClient does not call it, as its options
+// can complete c, e.g. WithWebSocket instead of Conn.
+func (c *ClientConfig) Validate() error {
+	if c.STUNServerAddr == "" && c.TURNServerAddr == "" {
+		return errNoServerAddr
+	}
+	for _, addr := range []string{c.STUNServerAddr, c.TURNServerAddr} {
+		if addr == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("%w: %w", errInvalidServerAddr, err)
+		}
+	}
+
+	switch {
+	case c.Username == "" && c.Password != "":
+		return errMissingUsername
+	case c.Username != "" && c.Password == "":
+		return errMissingPassword
+	}
+	switch c.CredentialAlgorithm {
+	case CredentialAlgorithmSHA1, CredentialAlgorithmSHA256, CredentialAlgorithmAuto:
+	default:
+		return fmt.Errorf("%w: %s", errUnknownCredentialAlgorithm, c.CredentialAlgorithm)
+	}
+
+	rto := defaultRTO
+	switch {
+	case c.RTO < 0:
+		return errNegativeRTO
+	case c.RTO > 0:
+		rto = c.RTO
+	}
+	switch {
+	case c.RetransmitCount < 0:
+		return errNegativeRetransmitCount
+	case c.RetransmitMax < 0:
+		return errNegativeRetransmitMax
+	case c.RetransmitMax > 0 && c.RetransmitMax < rto:
+		return fmt.Errorf("%w: %s < %s", errRetransmitMaxBelowRTO, c.RetransmitMax, rto)
+	}
+
+	switch c.transport() {
+	case ClientTransportUDP:
+		if c.TLSConfig != nil {
+			return errTLSConfigWithUDP
+		}
+		if c.Conn == nil {
+			return errNilConn
+		}
+	case ClientTransportTLS:
+		if c.Conn != nil {
+			return errConnWithTLS
+		}
+		if c.TURNServerAddr == "" {
+			return errTLSWithoutTURNServer
+		}
+	default:
+		return fmt.Errorf("%w: %s", errUnsupportedClientTransport, c.Transport)
+	}
+
+	return nil
+}
+
+// transport resolves ClientTransportDefault.
+func (c *ClientConfig) transport() ClientTransport {
+	if c.Transport != ClientTransportDefault {
+		return c.Transport
+	}
+	if c.TLSConfig != nil {
+		return ClientTransportTLS
+	}
+
+	return ClientTransportUDP
+}
+
+// options returns the ClientOptions equivalent to the fields of c that have
+// one, applied by NewClient before its own options.
+func (c *ClientConfig) options() ([]ClientOption, error) {
+	var opts []ClientOption
+	switch c.transport() {
+	case ClientTransportUDP:
+		if c.TLSConfig != nil {
+			return nil, errTLSConfigWithUDP
+		}
+	case ClientTransportTLS:
+		opts = append(opts, WithTLS(c.TLSConfig))
+	default:
+		return nil, fmt.Errorf("%w: %s", errUnsupportedClientTransport, c.Transport)
+	}
+	if c.RetransmitCount != 0 {
+		opts = append(opts, WithRetransmitCount(c.RetransmitCount))
+	}
+	if c.RetransmitMax != 0 {
+		opts = append(opts, WithRetransmitMax(c.RetransmitMax))
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,139 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package turn
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientConfig(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	require.NoError(t, err)
+	defer conn.Close() //nolint:errcheck
+
+	valid := func() *ClientConfig {
+		return NewClientConfig().
+			SetServer("127.0.0.1:3478").
+			SetCredentials("user", "pass").
+			SetConn(conn)
+	}
+
+	t.Run("Setters", func(t *testing.T) {
+		loggerFactory := logging.NewDefaultLoggerFactory()
+		tlsConfig := &tls.Config{ServerName: "turn.example.com"} //nolint:gosec
+		config := NewClientConfig().
+			SetServer("127.0.0.1:3478").
+			SetSTUNServer("127.0.0.1:3479").
+			SetCredentials("user", "pass").
+			SetRealm("pion.ly").
+			SetCredentialAlgorithm(CredentialAlgorithmSHA256).
+			SetTransport(ClientTransportTLS).
+			SetTLSConfig(tlsConfig).
+			SetTimeout(time.Second).
+			SetRetransmit(3, 4*time.Second).
+			SetLogger(loggerFactory)
+		assert.Equal(t, &ClientConfig{
+			STUNServerAddr:      "127.0.0.1:3479",
+			TURNServerAddr:      "127.0.0.1:3478",
+			Username:            "user",
+			Password:            "pass",
+			Realm:               "pion.ly",
+			RTO:                 time.Second,
+			LoggerFactory:       loggerFactory,
+			CredentialAlgorithm: CredentialAlgorithmSHA256,
+			Transport:           ClientTransportTLS,
+			TLSConfig:           tlsConfig,
+			RetransmitCount:     3,
+			RetransmitMax:       4 * time.Second,
+		}, config)
+		assert.NoError(t, config.Validate())
+	})
+
+	t.Run("Validate", func(t *testing.T) {
+		for _, test := range []struct {
+			name   string
+			config *ClientConfig
+			err    error
+		}{
+			{"Valid", valid(), nil},
+			{"STUN only", NewClientConfig().SetSTUNServer("127.0.0.1:3478").SetConn(conn), nil},
+			{"TLS by default", valid().SetConn(nil).SetTLSConfig(&tls.Config{}), nil}, //nolint:gosec
+			{"TLS without config", valid().SetConn(nil).SetTransport(ClientTransportTLS), nil},
+			{"No server", NewClientConfig().SetConn(conn), errNoServerAddr},
+			{"STUN server without port", valid().SetSTUNServer("127.0.0.1"), errInvalidServerAddr},
+			{"TURN server without port", valid().SetTURNServer("turn.example.com"), errInvalidServerAddr},
+			{"No username", valid().SetCredentials("", "pass"), errMissingUsername},
+			{"No password", valid().SetCredentials("user", ""), errMissingPassword},
+			{
+				"Credential algorithm", valid().SetCredentialAlgorithm(CredentialAlgorithm(42)),
+				errUnknownCredentialAlgorithm,
+			},
+			{"Negative timeout", valid().SetTimeout(-time.Second), errNegativeRTO},
+			{"Negative retransmit count", valid().SetRetransmit(-1, 0), errNegativeRetransmitCount},
+			{"Negative retransmit max", valid().SetRetransmit(0, -time.Second), errNegativeRetransmitMax},
+			{"Retransmit max below default RTO", valid().SetRetransmit(0, time.Millisecond), errRetransmitMaxBelowRTO},
+			{
+				"Retransmit max below RTO", valid().SetTimeout(2*time.Second).SetRetransmit(0, time.Second),
+				errRetransmitMaxBelowRTO,
+			},
+			{
+				"UDP with TLS config", valid().SetTransport(ClientTransportUDP).SetTLSConfig(&tls.Config{}), //nolint:gosec
+				errTLSConfigWithUDP,
+			},
+			{"UDP without conn", valid().SetConn(nil), errNilConn},
+			{"TLS with conn", valid().SetTransport(ClientTransportTLS), errConnWithTLS},
+			{
+				"TLS without TURN server",
+				NewClientConfig().SetSTUNServer("127.0.0.1:3478").SetTransport(ClientTransportTLS),
+				errTLSWithoutTURNServer,
+			},
+			{"Unknown transport", valid().SetTransport(ClientTransport(42)), errUnsupportedClientTransport},
+		} {
+			t.Run(test.name, func(t *testing.T) {
+				if test.err == nil {
+					assert.NoError(t, test.config.Validate())
+				} else {
+					assert.ErrorIs(t, test.config.Validate(), test.err)
+				}
+			})
+		}
+	})
+
+	t.Run("NewClient", func(t *testing.T) {
+		client, err := NewClient(valid().SetRetransmit(3, 4*time.Second))
+		require.NoError(t, err)
+		defer client.Close()
+		assert.Equal(t, 3, client.rtxCount)
+		assert.Equal(t, 4*time.Second, client.rtxMax)
+		assert.Nil(t, client.tlsConfig)
+
+		// Options override the config
+		client, err = NewClient(valid().SetRetransmit(3, 0), WithRetransmitCount(5))
+		require.NoError(t, err)
+		defer client.Close()
+		assert.Equal(t, 5, client.rtxCount)
+
+		_, err = NewClient(valid().SetRetransmit(-1, 0))
+		assert.ErrorIs(t, err, errNegativeRetransmitCount)
+		_, err = NewClient(valid().SetTransport(ClientTransportUDP).SetTLSConfig(&tls.Config{})) //nolint:gosec
+		assert.ErrorIs(t, err, errTLSConfigWithUDP)
+		_, err = NewClient(valid().SetTransport(ClientTransport(42)))
+		assert.ErrorIs(t, err, errUnsupportedClientTransport)
+		_, err = NewClient(valid().SetTransport(ClientTransportTLS))
+		assert.ErrorIs(t, err, errConnWithTLS)
+	})
+
+	assert.Equal(t, "TLS", ClientTransportTLS.String())
+	assert.Equal(t, "ClientTransport(42)", ClientTransport(42).String())
+}
@@ -0,0 +1,254 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"crypto/tls"
+	"io"
+	"log/slog"
+	"runtime/debug"
+	"time"
+
+	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4/internal/client"
+	"github.com/pion/turn/v4/metrics"
+)
+
+const modulePath = "github.com/pion/turn/v4"
+
+// ClientOption customizes a Client created by NewClient.
+type ClientOption func(c *Client) error
+
+// WithSoftware sets the SOFTWARE attribute added to every request sent by the
+// Client, overriding ClientConfig.Software. An empty string omits the attribute.
+func WithSoftware(software string) ClientOption {
+	return func(c *Client) error {
+		c.software = stun.NewSoftware(software)
+
+		return nil
+	}
+}
+
+// WithMobility requests the TURN mobility extension (RFC 8016) for UDP
+// allocations, so that they can be moved to a new conn with
+// Client.MigrateAllocation. Servers without mobility support ignore the request.
+func WithMobility() ClientOption {
+	return func(c *Client) error {
+		c.mobility = true
+
+		return nil
+	}
+}
+
+// WithCredentialDeriver sets how the long-term credential key is derived,
+// overriding ClientConfig.CredentialAlgorithm with the algorithm of deriver.
+// The algorithm is not negotiated with CredentialAlgorithmAuto then.
+func WithCredentialDeriver(deriver CredentialDeriver) ClientOption {
+	return func(c *Client) error {
+		if deriver != nil {
+			c.credDeriver = deriver
+			c.negotiate = false
+		}
+
+		return nil
+	}
+}
+
+// WithShortTermCredentials authenticates with ClientConfig.Username and
+// Password as short-term credentials, RFC 5389 Section 10.1: requests carry
+// no REALM or NONCE and MESSAGE-INTEGRITY is keyed with the password itself
+// instead of a key derived with the realm. Allocate is not challenged first,
+// and a 401 response fails the request instead of being retried with a new
+// nonce. ClientConfig.Realm is ignored.
+func WithShortTermCredentials() ClientOption {
+	return func(c *Client) error {
+		c.shortTerm = true
+
+		return nil
+	}
+}
+
+// WithCredentialRefresher makes the Client get new credentials from refresher
+// when a request signed with the current ones is rejected with 401
+// Unauthorized and a new nonce, e.g. because a short-lived TURN credential
+// expired. The request is then sent once more with the new credentials,
+// which are also used by the allocations from then on. A 401 naming another
+// realm is retried the same way, up to 3 times per request, with the
+// credentials of a RealmCredentialRefresher for that realm.
+func WithCredentialRefresher(refresher CredentialRefresher) ClientOption {
+	return func(c *Client) error {
+		c.credRefresher = refresher
+
+		return nil
+	}
+}
+
+// WithFingerprintVerification makes the Client check the FINGERPRINT
+// attribute (RFC 5389 Section 15.5) of the responses it receives. Responses
+// with a FINGERPRINT that does not match are dropped, leaving the transaction
+// waiting for a valid one; responses without one are accepted.
+func WithFingerprintVerification() ClientOption {
+	return func(c *Client) error {
+		c.verifyFP = true
+
+		return nil
+	}
+}
+
+// WithSlogHandler makes the Client and its allocations log to handler,
+// overriding ClientConfig.LoggerFactory. TURN events such as binding state
+// changes carry their details, e.g. the peer address, as attributes.
+func WithSlogHandler(handler slog.Handler) ClientOption {
+	return func(c *Client) error {
+		if handler != nil {
+			c.log = client.NewSlogLogger(handler)
+		}
+
+		return nil
+	}
+}
+
+// WithCircuitBreaker stops the Client from sending to a TURN server whose
+// transactions keep failing. After threshold consecutive transactions got no
+// response or could not be sent, requests and data fail with ErrCircuitOpen
+// without being sent. Once timeout has passed a single transaction is let
+// through as a probe, closing the circuit if it succeeds.
+func WithCircuitBreaker(threshold int, timeout time.Duration) ClientOption {
+	return func(c *Client) error {
+		breaker, err := client.NewCircuitBreaker(client.CircuitBreakerConfig{
+			Threshold: threshold,
+			Timeout:   timeout,
+		})
+		if err != nil {
+			return err
+		}
+		c.breaker = breaker
+
+		return nil
+	}
+}
+
+// WithTransactionHistogram records in histogram how long each transaction
+// waited for its result, including retransmissions, e.g. a histogram named
+// metrics.TransactionDuration. Transactions not waiting for a result are not
+// recorded.
+func WithTransactionHistogram(histogram *metrics.Histogram) ClientOption {
+	return func(c *Client) error {
+		c.trHistogram = histogram
+
+		return nil
+	}
+}
+
+// WithTLS makes the Client connect to ClientConfig.TURNServerAddr over TLS
+// instead of using ClientConfig.Conn, which must be nil. ALPNProtocol is
+// offered in the handshake as described in RFC 7350 Section 3.2.2. The server
+// name defaults to the host of TURNServerAddr. NewClient fails if the
+// connection is not established within 10 seconds. The connection is closed
+// by Client.Close.
+func WithTLS(config *tls.Config) ClientOption {
+	return func(c *Client) error {
+		if config == nil {
+			config = &tls.Config{} //nolint:gosec
+		}
+		c.tlsConfig = config
+
+		return nil
+	}
+}
+
+// WithWebSocket makes the Client connect to the TURN server through a
+// WebSocket to url, a ws:// or wss:// URL, with DialWebSocketTransport,
+// instead of using ClientConfig.Conn, which must be nil. origin is sent as
+// the Origin header. ClientConfig.Net is not used to dial. The connection is
+// closed by Client.Close.
+func WithWebSocket(url, origin string) ClientOption {
+	return func(c *Client) error {
+		c.webSocketURL, c.webSocketOrigin = url, origin
+
+		return nil
+	}
+}
+
+// WithSessionRecorder makes the Client write every packet it sends and
+// receives on its conn to w, in the pcap file format with nanosecond
+// timestamps, e.g. to replay the session in Wireshark. Packets are recorded
+// as raw IP packets with a UDP header made up from the addresses of the
+// conn, also for TCP, TLS and WebSocket transports. Writes to w are made
+// after the packet is sent or received, so w should not block, e.g. a
+// bufio.Writer. The first error of w stops the recording.
+func WithSessionRecorder(w io.Writer) ClientOption {
+	return func(c *Client) error {
+		c.recorder = newSessionRecorder(w)
+
+		return nil
+	}
+}
+
+// WithRTOInitial sets the initial retransmission timeout of STUN
+// transactions, RTO in RFC 5389 Section 7.2.1, overriding ClientConfig.RTO.
+// Zero selects the default of 200 milliseconds.
+func WithRTOInitial(rto time.Duration) ClientOption {
+	return func(c *Client) error {
+		switch {
+		case rto < 0:
+			return errNegativeRTO
+		case rto == 0:
+			c.rto = defaultRTO
+		default:
+			c.rto = rto
+		}
+
+		return nil
+	}
+}
+
+// WithRetransmitCount sets how many times a STUN request is sent at most, Rc
+// in RFC 5389 Section 7.2.1. The transaction fails when no response arrives
+// within the last, doubled, timeout after the last request. Zero selects the
+// default of 7.
+func WithRetransmitCount(count int) ClientOption {
+	return func(c *Client) error {
+		switch {
+		case count < 0:
+			return errNegativeRetransmitCount
+		case count == 0:
+			c.rtxCount = maxRtxCount
+		default:
+			c.rtxCount = count
+		}
+
+		return nil
+	}
+}
+
+// WithRetransmitMax caps the retransmission timeout, which doubles after
+// every request. Zero selects the default of 1.6 seconds.
+func WithRetransmitMax(maxInterval time.Duration) ClientOption {
+	return func(c *Client) error {
+		if maxInterval < 0 {
+			return errNegativeRetransmitMax
+		}
+		c.rtxMax = maxInterval
+
+		return nil
+	}
+}
+
+// defaultSoftware returns the SOFTWARE used when neither ClientConfig.Software
+// nor WithSoftware is set, e.g. "pion/turn v4.0.0".
+func defaultSoftware() string {
+	version := "v4"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range append([]*debug.Module{&info.Main}, info.Deps...) {
+			if dep.Path == modulePath && dep.Version != "" && dep.Version != "(devel)" {
+				version = dep.Version
+
+				break
+			}
+		}
+	}
+
+	return "pion/turn " + version
+}
@@ -0,0 +1,27 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"github.com/pion/turn/v4/internal/client"
+)
+
+// ClientPool spreads allocations over several TURN servers. Each allocation
+// goes to the Client with the fewest active allocations, falling back to the
+// next one if Allocate fails.
+type ClientPool = client.ClientPool
+
+// NewClientPool creates a pool of clients, each talking to a different TURN
+// server. The clients must be listening, and are not closed by the pool.
+func NewClientPool(clients ...*Client) (*ClientPool, error) {
+	members := make([]client.PoolMember, len(clients))
+	for i, c := range clients {
+		// Keep a nil *Client a nil interface, so that it is rejected
+		if c != nil {
+			members[i] = c
+		}
+	}
+
+	return client.NewClientPool(members...)
+}
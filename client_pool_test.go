@@ -0,0 +1,41 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package turn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientPool(t *testing.T) {
+	_, err := NewClientPool()
+	assert.Error(t, err)
+	_, err = NewClientPool(newLoopbackClient(t), nil)
+	assert.Error(t, err)
+
+	pool, err := NewClientPool(newLoopbackClient(t), newLoopbackClient(t))
+	require.NoError(t, err)
+
+	first, err := pool.Allocate()
+	require.NoError(t, err)
+	second, err := pool.Allocate()
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 1}, pool.Load())
+
+	// The slot of a closed allocation goes to the next one
+	assert.NoError(t, first.Close())
+	assert.Equal(t, []int{0, 1}, pool.Load())
+	third, err := pool.Allocate()
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 1}, pool.Load())
+
+	assert.NoError(t, second.Close())
+	assert.NoError(t, third.Close())
+	assert.Equal(t, []int{0, 0}, pool.Load())
+}
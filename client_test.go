@@ -7,14 +7,26 @@
 package turn
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
 	"net"
 	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/pion/logging"
 	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4/internal/client"
 	"github.com/pion/turn/v4/internal/proto"
+	"github.com/pion/turn/v4/metrics"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -140,14 +152,1171 @@ func TestClientWithSTUN(t *testing.T) {
 		assert.NotNil(t, err)
 		assert.NoError(t, pc.Close())
 	})
+
+	t.Run("PerformTransactionContext canceled", func(t *testing.T) {
+		c, pc, ok := createListeningTestClient(t, loggerFactory)
+		if !ok {
+			return
+		}
+		defer c.Close()
+
+		to, err := net.ResolveUDPAddr("udp4", "127.0.0.1:9")
+		assert.NoError(t, err)
+
+		msg, err := stun.Build(stun.TransactionID, stun.BindingRequest)
+		assert.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		_, err = c.PerformTransactionContext(ctx, msg, to, false)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Equal(t, 0, c.trMap.Size(), "should be no transaction left")
+		assert.NoError(t, pc.Close())
+	})
+}
+
+func TestClientRetransmission(t *testing.T) {
+	// startServer answers the Binding request it receives with the given
+	// count, and records when every request arrived.
+	startServer := func(t *testing.T, answer int) (net.PacketConn, func() []time.Time) {
+		t.Helper()
+
+		serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = serverConn.Close() })
+
+		var mutex sync.Mutex
+		arrivals := []time.Time{}
+		go func() {
+			buf := make([]byte, 1500)
+			for {
+				n, from, err := serverConn.ReadFrom(buf)
+				if err != nil {
+					return
+				}
+				req := new(stun.Message)
+				if _, err = req.Write(append([]byte(nil), buf[:n]...)); err != nil {
+					continue
+				}
+				mutex.Lock()
+				arrivals = append(arrivals, time.Now())
+				count := len(arrivals)
+				mutex.Unlock()
+				if count == answer {
+					res := stun.MustBuild(buildMsg(req.TransactionID, stun.BindingSuccess,
+						&stun.XORMappedAddress{IP: net.IPv4(192, 0, 2, 1), Port: 5000})...)
+					_, _ = serverConn.WriteTo(res.Raw, from)
+				}
+			}
+		}()
+
+		return serverConn, func() []time.Time {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			return append([]time.Time(nil), arrivals...)
+		}
+	}
+	newClient := func(t *testing.T, opts ...ClientOption) *Client {
+		t.Helper()
+
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = conn.Close() })
+
+		c, err := NewClient(&ClientConfig{Conn: conn}, opts...)
+		require.NoError(t, err)
+		require.NoError(t, c.Listen())
+		t.Cleanup(c.Close)
+
+		return c
+	}
+
+	t.Run("No response", func(t *testing.T) {
+		serverConn, arrivals := startServer(t, 0)
+		c := newClient(t, WithRTOInitial(10*time.Millisecond), WithRetransmitCount(4), WithRetransmitMax(40*time.Millisecond))
+
+		start := time.Now()
+		_, err := c.SendBindingRequestTo(serverConn.LocalAddr())
+		assert.ErrorIs(t, err, errAllRetransmissionsFailed)
+		// Timeouts of 10, 20, 40 and 40 ms
+		assert.GreaterOrEqual(t, time.Since(start), 110*time.Millisecond)
+
+		times := arrivals()
+		if assert.Len(t, times, 4, "Rc requests in total") {
+			for i, minGap := range []time.Duration{10, 20, 40} {
+				assert.GreaterOrEqual(t, times[i+1].Sub(times[i]), minGap*time.Millisecond*8/10)
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		assert.Len(t, arrivals(), 4, "no request after the transaction failed")
+	})
+
+	t.Run("Late response", func(t *testing.T) {
+		serverConn, arrivals := startServer(t, 3)
+		c := newClient(t, WithRTOInitial(10*time.Millisecond), WithRetransmitCount(3))
+
+		mappedAddr, err := c.SendBindingRequestTo(serverConn.LocalAddr())
+		assert.NoError(t, err)
+		assert.Equal(t, "192.0.2.1:5000", mappedAddr.String())
+		assert.Len(t, arrivals(), 3)
+	})
+
+	t.Run("RTT", func(t *testing.T) {
+		serverConn, _ := startServer(t, 1)
+		c := newClient(t, WithRTOInitial(time.Second))
+
+		start := time.Now()
+		msg := stun.MustBuild(stun.TransactionID, stun.BindingRequest)
+		res, err := c.PerformTransaction(msg, serverConn.LocalAddr(), false)
+		require.NoError(t, err)
+		assert.Equal(t, 0, res.Retries)
+		assert.Greater(t, res.RTT, time.Duration(0))
+		assert.LessOrEqual(t, res.RTT, time.Since(start))
+	})
+
+	t.Run("No RTT when retransmitted", func(t *testing.T) {
+		serverConn, _ := startServer(t, 2)
+		c := newClient(t, WithRTOInitial(20*time.Millisecond))
+
+		// Karn's algorithm: the response may answer either request
+		msg := stun.MustBuild(stun.TransactionID, stun.BindingRequest)
+		res, err := c.PerformTransaction(msg, serverConn.LocalAddr(), false)
+		require.NoError(t, err)
+		assert.Equal(t, 1, res.Retries)
+		assert.Equal(t, time.Duration(0), res.RTT)
+	})
+
+	t.Run("Histogram", func(t *testing.T) {
+		histogram, err := metrics.NewHistogram(metrics.TransactionDuration, "STUN transaction wait times.", []time.Duration{
+			10 * time.Millisecond, time.Second,
+		})
+		require.NoError(t, err)
+		serverConn, _ := startServer(t, 2)
+		c := newClient(t, WithRTOInitial(20*time.Millisecond), WithTransactionHistogram(histogram))
+
+		_, err = c.PerformTransaction(stun.MustBuild(stun.TransactionID, stun.BindingRequest), serverConn.LocalAddr(), false)
+		require.NoError(t, err)
+		_, err = c.PerformTransaction(stun.MustBuild(stun.TransactionID, stun.BindingRequest), serverConn.LocalAddr(), true)
+		require.NoError(t, err)
+
+		// Only the waited transaction, slowed down by the retransmission
+		snapshot := histogram.Snapshot()
+		assert.Equal(t, uint64(1), snapshot.Count)
+		assert.Equal(t, []metrics.Bucket{
+			{UpperBound: 10 * time.Millisecond, Count: 0},
+			{UpperBound: time.Second, Count: 1},
+		}, snapshot.Buckets)
+	})
+
+	t.Run("Defaults", func(t *testing.T) {
+		c := newClient(t, WithRTOInitial(0), WithRetransmitCount(0))
+		assert.Equal(t, defaultRTO, c.rto)
+		assert.Equal(t, maxRtxCount, c.rtxCount)
+
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		require.NoError(t, err)
+		defer conn.Close() //nolint:errcheck
+		for _, test := range []struct {
+			opt ClientOption
+			err error
+		}{
+			{WithRTOInitial(-time.Second), errNegativeRTO},
+			{WithRetransmitCount(-1), errNegativeRetransmitCount},
+			{WithRetransmitMax(-time.Second), errNegativeRetransmitMax},
+		} {
+			_, err = NewClient(&ClientConfig{Conn: conn}, test.opt)
+			assert.ErrorIs(t, err, test.err)
+		}
+	})
+}
+
+func TestClientCancelTransaction(t *testing.T) {
+	serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	require.NoError(t, err)
+	defer serverConn.Close() //nolint:errcheck
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	require.NoError(t, err)
+	defer conn.Close() //nolint:errcheck
+
+	c, err := NewClient(&ClientConfig{Conn: conn})
+	require.NoError(t, err)
+	require.NoError(t, c.Listen())
+	defer c.Close()
+
+	msg, err := stun.Build(stun.TransactionID, stun.BindingRequest)
+	require.NoError(t, err)
+
+	// The server never answers, so the transaction would run for seconds
+	done := make(chan error)
+	go func() {
+		_, err := c.PerformTransaction(msg, serverConn.LocalAddr(), false)
+		done <- err
+	}()
+	assert.Eventually(t, func() bool { return c.trMap.Size() == 1 }, time.Second, time.Millisecond)
+
+	c.CancelTransaction(msg.TransactionID)
+	select {
+	case err = <-done:
+		assert.ErrorIs(t, err, ErrTransactionCanceled)
+	case <-time.After(time.Second):
+		assert.Fail(t, "PerformTransaction did not return after CancelTransaction")
+	}
+	assert.Equal(t, 0, c.trMap.Size())
+
+	// Unknown and completed transactions are ignored
+	c.CancelTransaction(msg.TransactionID)
+	c.CancelTransaction([stun.TransactionIDSize]byte{1, 2, 3})
+}
+
+// Create an allocation, and then delete all nonces
+// The subsequent Write on the allocation will cause a CreatePermission
+// which will be forced to handle a stale nonce response.
+func TestClientNonceExpiration(t *testing.T) {
+	udpListener, err := net.ListenPacket("udp4", "0.0.0.0:3478") // nolint: noctx
+	assert.NoError(t, err)
+
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			return GenerateAuthKey(username, realm, "pass"), true
+		},
+		PacketConnConfigs: []PacketConnConfig{
+			{
+				PacketConn: udpListener,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "0.0.0.0",
+				},
+			},
+		},
+		Realm: "pion.ly",
+	})
+	assert.NoError(t, err)
+
+	conn, err := net.ListenPacket("udp4", "0.0.0.0:0") // nolint: noctx
+	assert.NoError(t, err)
+
+	// nolint: goconst
+	addr := "127.0.0.1:3478"
+
+	client, err := NewClient(&ClientConfig{
+		Conn:           conn,
+		STUNServerAddr: addr,
+		TURNServerAddr: addr,
+		Username:       "foo",
+		Password:       "pass",
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, client.Listen())
+
+	allocation, err := client.Allocate()
+	assert.NoError(t, err)
+
+	_, err = allocation.WriteTo([]byte{0x00}, &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 8080})
+	assert.NoError(t, err)
+
+	// Shutdown
+	assert.NoError(t, allocation.Close())
+	assert.NoError(t, conn.Close())
+	assert.NoError(t, server.Close())
+}
+
+// fakeAuthServer answers Allocate requests on conn like a TURN server with
+// long-term credentials, protecting success responses with respIntegrity.
+// A nil respIntegrity rejects the credentials. challenge is added to the 401
+// response to unauthenticated requests. Received authenticated requests are
+// sent to reqCh.
+func fakeAuthServer(
+	t *testing.T,
+	conn net.PacketConn,
+	respIntegrity proto.Integrity,
+	reqCh chan<- *stun.Message,
+	challenge ...stun.Setter,
+) {
+	t.Helper()
+
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		req := new(stun.Message)
+		if _, err = req.Write(append([]byte(nil), buf[:n]...)); err != nil || req.Type.Method != stun.MethodAllocate {
+			continue
+		}
+
+		var res *stun.Message
+		switch {
+		case !req.Contains(stun.AttrUsername):
+			res, err = stun.Build(
+				buildMsg(req.TransactionID, stun.NewType(stun.MethodAllocate, stun.ClassErrorResponse),
+					append([]stun.Setter{
+						stun.CodeUnauthorized, stun.NewNonce("nonce"), stun.NewRealm("pion.ly"),
+					}, challenge...)...)...,
+			)
+		case respIntegrity == nil:
+			reqCh <- req
+			res, err = stun.Build(
+				buildMsg(req.TransactionID, stun.NewType(stun.MethodAllocate, stun.ClassErrorResponse),
+					stun.CodeUnauthorized, stun.NewNonce("nonce"), stun.NewRealm("pion.ly"))...,
+			)
+		default:
+			reqCh <- req
+			res, err = stun.Build(
+				buildMsg(req.TransactionID, stun.NewType(stun.MethodAllocate, stun.ClassSuccessResponse),
+					&proto.RelayedAddress{IP: net.IPv4(127, 0, 0, 1), Port: 5000},
+					proto.Lifetime{Duration: time.Minute},
+					respIntegrity, stun.Fingerprint)...,
+			)
+		}
+		assert.NoError(t, err)
+		_, err = conn.WriteTo(res.Raw, from)
+		assert.NoError(t, err)
+	}
+}
+
+func TestClientCredentialAlgorithm(t *testing.T) {
+	const username, realm, password = "foo", "pion.ly", "pass"
+	sha1Key := stun.NewLongTermIntegrity(username, realm, password)
+	sha256Key := proto.NewLongTermIntegritySHA256(username, realm, password)
+
+	allocate := func(t *testing.T, algorithm CredentialAlgorithm, respIntegrity proto.Integrity) (*stun.Message, error) {
+		t.Helper()
+
+		serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		require.NoError(t, err)
+		defer serverConn.Close() //nolint:errcheck
+		reqCh := make(chan *stun.Message, 1)
+		go fakeAuthServer(t, serverConn, respIntegrity, reqCh)
+
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		require.NoError(t, err)
+		defer conn.Close() //nolint:errcheck
+
+		turnClient, err := NewClient(&ClientConfig{
+			Conn:                conn,
+			TURNServerAddr:      serverConn.LocalAddr().String(),
+			Username:            username,
+			Password:            password,
+			CredentialAlgorithm: algorithm,
+			RTO:                 50 * time.Millisecond,
+		})
+		require.NoError(t, err)
+		require.NoError(t, turnClient.Listen())
+		defer turnClient.Close()
+
+		relayConn, err := turnClient.Allocate()
+		if err == nil {
+			assert.NoError(t, relayConn.Close())
+		}
+
+		return <-reqCh, err
+	}
+
+	t.Run("SHA1", func(t *testing.T) {
+		req, err := allocate(t, CredentialAlgorithmSHA1, sha1Key)
+		assert.NoError(t, err)
+		assert.NoError(t, sha1Key.Check(req))
+		assert.False(t, req.Contains(stun.AttrMessageIntegritySHA256))
+		assert.False(t, req.Contains(stun.AttrPasswordAlgorithm), "MD5 is the default")
+	})
+	t.Run("SHA256", func(t *testing.T) {
+		req, err := allocate(t, CredentialAlgorithmSHA256, sha256Key)
+		assert.NoError(t, err)
+		assert.NoError(t, sha256Key.Check(req))
+		assert.False(t, req.Contains(stun.AttrMessageIntegrity))
+
+		// The algorithm is named, RFC 8489 Section 9.2.4
+		algorithm, err := req.Get(stun.AttrPasswordAlgorithm)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{0x00, 0x02, 0x00, 0x00}, algorithm)
+		assert.False(t, req.Contains(stun.AttrPasswordAlgorithms), "the server offered none")
+	})
+	t.Run("SHA256 response with wrong key", func(t *testing.T) {
+		_, err := allocate(t, CredentialAlgorithmSHA256, proto.NewLongTermIntegritySHA256(username, realm, "other"))
+		assert.ErrorIs(t, err, errResponseIntegrity)
+	})
+	t.Run("SHA256 response without SHA256 integrity", func(t *testing.T) {
+		_, err := allocate(t, CredentialAlgorithmSHA256, sha1Key)
+		assert.ErrorIs(t, err, errResponseIntegrity)
+	})
+	t.Run("Unsupported", func(t *testing.T) {
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		require.NoError(t, err)
+		defer conn.Close() //nolint:errcheck
+
+		_, err = NewClient(&ClientConfig{Conn: conn, CredentialAlgorithm: CredentialAlgorithm(42)})
+		assert.ErrorIs(t, err, errUnknownCredentialAlgorithm)
+	})
+	t.Run("String", func(t *testing.T) {
+		assert.Equal(t, "SHA1", CredentialAlgorithmSHA1.String())
+		assert.Equal(t, "SHA256", CredentialAlgorithmSHA256.String())
+		assert.Equal(t, "CredentialAlgorithm(42)", CredentialAlgorithm(42).String())
+	})
+}
+
+func TestClientRelayAddr(t *testing.T) {
+	for _, relayed := range []*net.UDPAddr{
+		{IP: net.IPv4(192, 0, 2, 10), Port: 50000},
+		{IP: net.ParseIP("2001:db8::10"), Port: 50001},
+	} {
+		t.Run(relayed.String(), func(t *testing.T) {
+			serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+			require.NoError(t, err)
+			defer serverConn.Close() //nolint:errcheck
+
+			resCh := make(chan *stun.Message, 1)
+			go func() {
+				buf := make([]byte, 1500)
+				for {
+					n, from, err := serverConn.ReadFrom(buf)
+					if err != nil {
+						return
+					}
+					req := new(stun.Message)
+					if _, err = req.Write(append([]byte(nil), buf[:n]...)); err != nil {
+						continue
+					}
+
+					var res *stun.Message
+					switch {
+					case req.Type.Method != stun.MethodAllocate:
+						res = stun.MustBuild(buildMsg(req.TransactionID,
+							stun.NewType(req.Type.Method, stun.ClassSuccessResponse))...)
+					case !req.Contains(stun.AttrUsername):
+						res = stun.MustBuild(buildMsg(req.TransactionID,
+							stun.NewType(stun.MethodAllocate, stun.ClassErrorResponse),
+							stun.CodeUnauthorized, stun.NewNonce("nonce"), stun.NewRealm("pion.ly"))...)
+					default:
+						res = stun.MustBuild(buildMsg(req.TransactionID,
+							stun.NewType(stun.MethodAllocate, stun.ClassSuccessResponse),
+							&proto.RelayedAddress{IP: relayed.IP, Port: relayed.Port},
+							proto.Lifetime{Duration: time.Minute})...)
+						resCh <- res
+					}
+					_, _ = serverConn.WriteTo(res.Raw, from)
+				}
+			}()
+
+			conn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+			require.NoError(t, err)
+			defer conn.Close() //nolint:errcheck
+
+			turnClient, err := NewClient(&ClientConfig{
+				Conn:           conn,
+				TURNServerAddr: serverConn.LocalAddr().String(),
+				Username:       "foo",
+				Password:       "pass",
+				RTO:            50 * time.Millisecond,
+			})
+			require.NoError(t, err)
+			require.NoError(t, turnClient.Listen())
+			defer turnClient.Close()
+
+			relayConn, err := turnClient.Allocate()
+			require.NoError(t, err)
+			defer relayConn.Close() //nolint:errcheck
+
+			var fromResponse proto.RelayedAddress
+			require.NoError(t, fromResponse.GetFrom(<-resCh))
+
+			udpConn, ok := relayConn.(*client.UDPConn)
+			require.True(t, ok)
+			relayAddr, ok := udpConn.RelayAddr().(*net.UDPAddr)
+			require.True(t, ok)
+			assert.True(t, fromResponse.IP.Equal(relayAddr.IP))
+			assert.Equal(t, fromResponse.Port, relayAddr.Port)
+			assert.Equal(t, relayed.String(), relayAddr.String())
+			assert.Equal(t, relayed.IP.To4() == nil, udpConn.AddressFamily() == proto.RequestedFamilyIPv6)
+			assert.Equal(t, relayAddr, relayConn.LocalAddr())
+		})
+	}
+}
+
+func TestClientSoftware(t *testing.T) {
+	const username, realm, password = "foo", "pion.ly", "pass"
+
+	allocateSoftware := func(t *testing.T, config *ClientConfig, opts ...ClientOption) (string, bool) {
+		t.Helper()
+
+		serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		require.NoError(t, err)
+		defer serverConn.Close() //nolint:errcheck
+		reqCh := make(chan *stun.Message, 1)
+		go fakeAuthServer(t, serverConn, stun.NewLongTermIntegrity(username, realm, password), reqCh)
+
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		require.NoError(t, err)
+		defer conn.Close() //nolint:errcheck
+
+		config.Conn = conn
+		config.TURNServerAddr = serverConn.LocalAddr().String()
+		config.Username = username
+		config.Password = password
+		turnClient, err := NewClient(config, opts...)
+		require.NoError(t, err)
+		require.NoError(t, turnClient.Listen())
+		defer turnClient.Close()
+
+		relayConn, err := turnClient.Allocate()
+		require.NoError(t, err)
+		assert.NoError(t, relayConn.Close())
+
+		var software stun.Software
+		if err := software.GetFrom(<-reqCh); err != nil {
+			return "", false
+		}
+
+		return software.String(), true
+	}
+
+	t.Run("Default", func(t *testing.T) {
+		software, ok := allocateSoftware(t, &ClientConfig{})
+		assert.True(t, ok)
+		assert.Equal(t, defaultSoftware(), software)
+		assert.True(t, strings.HasPrefix(software, "pion/turn v"))
+	})
+	t.Run("ClientConfig", func(t *testing.T) {
+		software, ok := allocateSoftware(t, &ClientConfig{Software: "config"})
+		assert.True(t, ok)
+		assert.Equal(t, "config", software)
+	})
+	t.Run("WithSoftware", func(t *testing.T) {
+		software, ok := allocateSoftware(t, &ClientConfig{Software: "config"}, WithSoftware("option"))
+		assert.True(t, ok)
+		assert.Equal(t, "option", software)
+	})
+	t.Run("Disabled", func(t *testing.T) {
+		_, ok := allocateSoftware(t, &ClientConfig{}, WithSoftware(""))
+		assert.False(t, ok)
+	})
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	buf bytes.Buffer
+	mu  sync.Mutex
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
+
+func TestClientSlogHandler(t *testing.T) {
+	serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	require.NoError(t, err)
+
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			return GenerateAuthKey(username, realm, "pass"), true
+		},
+		PacketConnConfigs: []PacketConnConfig{
+			{
+				PacketConn: serverConn,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "127.0.0.1",
+				},
+			},
+		},
+		Realm: "pion.ly",
+	})
+	require.NoError(t, err)
+	defer server.Close() //nolint:errcheck
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	require.NoError(t, err)
+	defer conn.Close() //nolint:errcheck
+
+	var logs syncBuffer
+	turnClient, err := NewClient(&ClientConfig{
+		Conn:           conn,
+		TURNServerAddr: serverConn.LocalAddr().String(),
+		Username:       "foo",
+		Password:       "pass",
+	}, WithSlogHandler(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	require.NoError(t, err)
+	require.NoError(t, turnClient.Listen())
+	defer turnClient.Close()
+
+	relayConn, err := turnClient.Allocate()
+	require.NoError(t, err)
+	defer relayConn.Close() //nolint:errcheck
+
+	// Allocations log through the handler, with the peer as an attribute
+	peer := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5000}
+	_, err = relayConn.WriteTo([]byte("hello"), peer)
+	require.NoError(t, err)
+	assert.Contains(t, logs.String(), `"msg":"Permission granted","peer":"127.0.0.1:5000"`)
+}
+
+func TestClientMultipleAllocations(t *testing.T) {
+	serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	require.NoError(t, err)
+
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			return GenerateAuthKey(username, realm, "pass"), true
+		},
+		PacketConnConfigs: []PacketConnConfig{
+			{
+				PacketConn: serverConn,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "127.0.0.1",
+				},
+			},
+		},
+		Realm: "pion.ly",
+	})
+	require.NoError(t, err)
+	defer server.Close() //nolint:errcheck
+
+	allocate := func() (*Client, *client.UDPConn) {
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = conn.Close() })
+
+		turnClient, err := NewClient(&ClientConfig{
+			Conn:           conn,
+			TURNServerAddr: serverConn.LocalAddr().String(),
+			Username:       "foo",
+			Password:       "pass",
+		})
+		require.NoError(t, err)
+		require.NoError(t, turnClient.Listen())
+		t.Cleanup(turnClient.Close)
+
+		relayConn, err := turnClient.Allocate()
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = relayConn.Close() })
+
+		udpConn, ok := relayConn.(*client.UDPConn)
+		require.True(t, ok)
+		assert.Equal(t, conn.LocalAddr().String(), udpConn.MappedAddr().String(),
+			"the server reflexive address should be kept")
+
+		return turnClient, udpConn
+	}
+
+	// One allocation per Client
+	first, relay1 := allocate()
+	_, err = first.Allocate()
+	assert.ErrorIs(t, err, errAlreadyAllocated)
+
+	// Another Client gets its own relayed address and permissions
+	_, relay2 := allocate()
+	assert.NotEqual(t, relay1.LocalAddr().String(), relay2.LocalAddr().String())
+
+	_, err = relay1.WriteTo([]byte("hello"), &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5000})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), relay1.Stats().Permissions)
+	assert.Equal(t, uint64(0), relay2.Stats().Permissions)
+}
+
+func TestClientFingerprintVerification(t *testing.T) {
+	type fingerprint int
+	const (
+		validFingerprint fingerprint = iota
+		corruptFingerprint
+		noFingerprint
+	)
+
+	// bindThrough answers the Binding request of a listening client with one
+	// response per fingerprint, the i-th mapping to 10.0.0.<i+1>:5000, and
+	// returns the mapped address the client got.
+	bindThrough := func(
+		t *testing.T,
+		turnClient *Client,
+		serverConn net.PacketConn,
+		fingerprints ...fingerprint,
+	) (net.Addr, error) {
+		t.Helper()
+
+		go func() {
+			buf := make([]byte, 1500)
+			n, from, err := serverConn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			req := &stun.Message{Raw: buf[:n]}
+			if req.Decode() != nil {
+				return
+			}
+			for i, fp := range fingerprints {
+				setters := []stun.Setter{
+					stun.NewTransactionIDSetter(req.TransactionID), stun.BindingSuccess,
+					&stun.XORMappedAddress{IP: net.IPv4(10, 0, 0, byte(i+1)), Port: 5000},
+				}
+				if fp != noFingerprint {
+					setters = append(setters, stun.Fingerprint)
+				}
+				res, err := stun.Build(setters...)
+				if !assert.NoError(t, err) {
+					return
+				}
+				if fp == corruptFingerprint {
+					res.Raw[len(res.Raw)-1] ^= 0xff
+				}
+				if _, err = serverConn.WriteTo(res.Raw, from); err != nil {
+					return
+				}
+			}
+		}()
+
+		return turnClient.SendBindingRequestTo(serverConn.LocalAddr())
+	}
+
+	listen := func(t *testing.T, opts ...ClientOption) (*Client, net.PacketConn) {
+		t.Helper()
+
+		serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = serverConn.Close() })
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = conn.Close() })
+
+		turnClient, err := NewClient(&ClientConfig{Conn: conn}, opts...)
+		require.NoError(t, err)
+		require.NoError(t, turnClient.Listen())
+		t.Cleanup(turnClient.Close)
+
+		return turnClient, serverConn
+	}
+
+	t.Run("correct FINGERPRINT", func(t *testing.T) {
+		turnClient, serverConn := listen(t, WithFingerprintVerification())
+		mapped, err := bindThrough(t, turnClient, serverConn, validFingerprint)
+		require.NoError(t, err)
+		assert.Equal(t, "10.0.0.1:5000", mapped.String())
+	})
+
+	t.Run("corrupted FINGERPRINT", func(t *testing.T) {
+		var logs syncBuffer
+		turnClient, serverConn := listen(t, WithFingerprintVerification(),
+			WithSlogHandler(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+		// The corrupted response is dropped, the next one completes the
+		// transaction
+		mapped, err := bindThrough(t, turnClient, serverConn, corruptFingerprint, validFingerprint)
+		require.NoError(t, err)
+		assert.Equal(t, "10.0.0.2:5000", mapped.String())
+		assert.Contains(t, logs.String(), "Failed to verify FINGERPRINT")
+
+		// The client keeps listening
+		mapped, err = bindThrough(t, turnClient, serverConn, validFingerprint)
+		require.NoError(t, err)
+		assert.Equal(t, "10.0.0.1:5000", mapped.String())
+	})
+
+	t.Run("without FINGERPRINT", func(t *testing.T) {
+		turnClient, serverConn := listen(t, WithFingerprintVerification())
+		mapped, err := bindThrough(t, turnClient, serverConn, noFingerprint)
+		require.NoError(t, err)
+		assert.Equal(t, "10.0.0.1:5000", mapped.String())
+	})
+
+	t.Run("not verified by default", func(t *testing.T) {
+		turnClient, serverConn := listen(t)
+		mapped, err := bindThrough(t, turnClient, serverConn, corruptFingerprint)
+		require.NoError(t, err)
+		assert.Equal(t, "10.0.0.1:5000", mapped.String())
+	})
+}
+
+// unreachableConn is a net.PacketConn whose writes fail, like a socket
+// getting ICMP unreachable errors.
+type unreachableConn struct {
+	net.PacketConn
+	writes atomic.Int32
+}
+
+func (c *unreachableConn) WriteTo([]byte, net.Addr) (int, error) {
+	c.writes.Add(1)
+
+	return 0, syscall.ECONNREFUSED
+}
+
+func TestClientCircuitBreaker(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	require.NoError(t, err)
+	defer conn.Close() //nolint:errcheck
+
+	unreachable := &unreachableConn{PacketConn: conn}
+	turnClient, err := NewClient(&ClientConfig{
+		Conn:           unreachable,
+		TURNServerAddr: "127.0.0.1:3478",
+	}, WithCircuitBreaker(2, 50*time.Millisecond))
+	require.NoError(t, err)
+	defer turnClient.Close()
+
+	for i := 0; i < 2; i++ {
+		_, err = turnClient.Allocate()
+		assert.ErrorIs(t, err, syscall.ECONNREFUSED)
+	}
+
+	// The circuit is open, nothing is sent
+	_, err = turnClient.Allocate()
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	_, err = turnClient.WriteTo([]byte("hello"), turnClient.turnServerAddr)
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, int32(2), unreachable.writes.Load())
+
+	// After the timeout a probe is sent
+	time.Sleep(50 * time.Millisecond)
+	_, err = turnClient.Allocate()
+	assert.ErrorIs(t, err, syscall.ECONNREFUSED)
+	assert.Equal(t, int32(3), unreachable.writes.Load())
+
+	_, err = NewClient(&ClientConfig{Conn: conn}, WithCircuitBreaker(0, time.Second))
+	assert.Error(t, err)
+}
+
+// inboundRecorder wraps a net.PacketConn and remembers the framing of
+// the last packet read that was not a STUN response.
+type inboundRecorder struct {
+	net.PacketConn
+	mu   sync.Mutex
+	last string
+}
+
+func (r *inboundRecorder) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, addr, err := r.PacketConn.ReadFrom(b)
+	if err == nil {
+		r.mu.Lock()
+		switch {
+		case proto.IsChannelData(b[:n]):
+			r.last = "ChannelData"
+		case stun.IsMessage(b[:n]):
+			msg := &stun.Message{Raw: append([]byte(nil), b[:n]...)}
+			if msg.Decode() == nil && msg.Type.Method == stun.MethodData {
+				r.last = "DataIndication"
+			}
+		}
+		r.mu.Unlock()
+	}
+
+	return n, addr, err
+}
+
+func (r *inboundRecorder) lastFraming() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.last
+}
+
+func TestClientReceive(t *testing.T) {
+	udpListener, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	require.NoError(t, err)
+
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			return GenerateAuthKey(username, realm, "pass"), true
+		},
+		PacketConnConfigs: []PacketConnConfig{
+			{
+				PacketConn: udpListener,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "127.0.0.1",
+				},
+			},
+		},
+		Realm: "pion.ly",
+	})
+	require.NoError(t, err)
+	defer server.Close() //nolint:errcheck
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	require.NoError(t, err)
+	recorder := &inboundRecorder{PacketConn: conn}
+	defer conn.Close() //nolint:errcheck
+
+	turnClient, err := NewClient(&ClientConfig{
+		Conn:           recorder,
+		STUNServerAddr: udpListener.LocalAddr().String(),
+		TURNServerAddr: udpListener.LocalAddr().String(),
+		Username:       "foo",
+		Password:       "pass",
+	})
+	require.NoError(t, err)
+	require.NoError(t, turnClient.Listen())
+	defer turnClient.Close()
+
+	relayConn, err := turnClient.Allocate()
+	require.NoError(t, err)
+	defer relayConn.Close() //nolint:errcheck
+
+	peer, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	require.NoError(t, err)
+	defer peer.Close() //nolint:errcheck
+
+	receive := func(payload string) {
+		t.Helper()
+
+		_, err := peer.WriteTo([]byte(payload), relayConn.LocalAddr())
+		require.NoError(t, err)
+
+		buf := make([]byte, 64)
+		require.NoError(t, relayConn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		n, from, err := relayConn.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.Equal(t, payload, string(buf[:n]))
+		assert.Equal(t, peer.LocalAddr().String(), from.String(), "peer should be the source")
+	}
+
+	// Without a channel binding the server relays with Data indications
+	require.NoError(t, turnClient.CreatePermission(peer.LocalAddr()))
+	receive("via indication")
+	assert.Equal(t, "DataIndication", recorder.lastFraming())
+
+	// Writing to the peer binds a channel, after which ChannelData is used
+	udpConn, ok := relayConn.(*client.UDPConn)
+	require.True(t, ok)
+	assert.Eventually(t, func() bool {
+		_, err := relayConn.WriteTo([]byte("ping"), peer.LocalAddr())
+
+		return err == nil && udpConn.Stats().ChannelSends > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	receive("via channel")
+	assert.Equal(t, "ChannelData", recorder.lastFraming())
+}
+
+// fakeMobilityServer is a TURN server granting RFC 8016 mobility. It relays
+// data sent to any peer straight back to the client, using the same framing.
+type fakeMobilityServer struct {
+	t            *testing.T
+	conn         net.PacketConn
+	mu           sync.Mutex
+	client       net.Addr // Current 5-tuple of the allocation
+	ticket       []byte
+	tickets      int
+	channelBinds int
+}
+
+func (s *fakeMobilityServer) state() (net.Addr, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.client, s.channelBinds
+}
+
+func (s *fakeMobilityServer) serve() {
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		data := append([]byte(nil), buf[:n]...)
+
+		s.mu.Lock()
+		if proto.IsChannelData(data) {
+			if s.client != nil && from.String() == s.client.String() {
+				_, _ = s.conn.WriteTo(data, from)
+			}
+		} else if req := new(stun.Message); req.UnmarshalBinary(data) == nil {
+			s.handle(req, from)
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (s *fakeMobilityServer) newTicket() proto.MobilityTicket {
+	s.tickets++
+	s.ticket = []byte(fmt.Sprintf("ticket-%d", s.tickets))
+
+	return s.ticket
+}
+
+func (s *fakeMobilityServer) handle(req *stun.Message, from net.Addr) { //nolint:cyclop
+	respond := func(class stun.MessageClass, attrs ...stun.Setter) {
+		res, err := stun.Build(buildMsg(req.TransactionID, stun.NewType(req.Type.Method, class), attrs...)...)
+		assert.NoError(s.t, err)
+		_, _ = s.conn.WriteTo(res.Raw, from) // The conn may be closed at the end of a test
+	}
+	lifetime := proto.Lifetime{Duration: time.Minute}
+
+	switch req.Type {
+	case stun.NewType(stun.MethodAllocate, stun.ClassRequest):
+		if !req.Contains(stun.AttrUsername) {
+			respond(stun.ClassErrorResponse, stun.CodeUnauthorized, stun.NewNonce("nonce"), stun.NewRealm("pion.ly"))
+
+			return
+		}
+		s.client = from
+		attrs := []stun.Setter{&proto.RelayedAddress{IP: net.IPv4(127, 0, 0, 1), Port: 5000}, lifetime}
+		if req.Contains(proto.AttrMobilityTicket) {
+			attrs = append(attrs, s.newTicket())
+		}
+		respond(stun.ClassSuccessResponse, attrs...)
+	case stun.NewType(stun.MethodRefresh, stun.ClassRequest):
+		var ticket proto.MobilityTicket
+		if ticket.GetFrom(req) == nil {
+			if string(ticket) != string(s.ticket) {
+				respond(stun.ClassErrorResponse, stun.CodeAllocMismatch)
+
+				return
+			}
+			s.client = from
+			respond(stun.ClassSuccessResponse, lifetime, s.newTicket())
+
+			return
+		}
+		respond(stun.ClassSuccessResponse, lifetime)
+	case stun.NewType(stun.MethodCreatePermission, stun.ClassRequest):
+		respond(stun.ClassSuccessResponse)
+	case stun.NewType(stun.MethodChannelBind, stun.ClassRequest):
+		s.channelBinds++
+		respond(stun.ClassSuccessResponse)
+	case stun.NewType(stun.MethodSend, stun.ClassIndication):
+		var peer proto.PeerAddress
+		var payload proto.Data
+		assert.NoError(s.t, peer.GetFrom(req))
+		assert.NoError(s.t, payload.GetFrom(req))
+		msg, err := stun.Build(stun.TransactionID, stun.NewType(stun.MethodData, stun.ClassIndication), peer, payload)
+		assert.NoError(s.t, err)
+		_, _ = s.conn.WriteTo(msg.Raw, s.client)
+	}
 }
 
-// Create an allocation, and then delete all nonces
-// The subsequent Write on the allocation will cause a CreatePermission
-// which will be forced to handle a stale nonce response.
-func TestClientNonceExpiration(t *testing.T) {
-	udpListener, err := net.ListenPacket("udp4", "0.0.0.0:3478") // nolint: noctx
-	assert.NoError(t, err)
+func TestClientMigrateAllocation(t *testing.T) {
+	newClient := func(t *testing.T, opts ...ClientOption) (*Client, *fakeMobilityServer) {
+		t.Helper()
+
+		serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = serverConn.Close() })
+		server := &fakeMobilityServer{t: t, conn: serverConn}
+		go server.serve()
+
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = conn.Close() })
+
+		turnClient, err := NewClient(&ClientConfig{
+			Conn:           conn,
+			TURNServerAddr: serverConn.LocalAddr().String(),
+			Username:       "foo",
+			Password:       "pass",
+			RTO:            50 * time.Millisecond,
+		}, opts...)
+		require.NoError(t, err)
+		require.NoError(t, turnClient.Listen())
+		t.Cleanup(turnClient.Close)
+
+		return turnClient, server
+	}
+	newConn := func(t *testing.T) net.PacketConn {
+		t.Helper()
+
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = conn.Close() })
+
+		return conn
+	}
+
+	t.Run("Migrate", func(t *testing.T) {
+		turnClient, server := newClient(t, WithMobility())
+		relayConn, err := turnClient.Allocate()
+		require.NoError(t, err)
+		udpConn, ok := relayConn.(*client.UDPConn)
+		require.True(t, ok)
+
+		peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+		echo := func(payload string) {
+			t.Helper()
+
+			_, err := relayConn.WriteTo([]byte(payload), peer)
+			require.NoError(t, err)
+
+			buf := make([]byte, 64)
+			require.NoError(t, relayConn.SetReadDeadline(time.Now().Add(5*time.Second)))
+			for {
+				n, from, err := relayConn.ReadFrom(buf)
+				require.NoError(t, err)
+				if string(buf[:n]) == payload {
+					assert.Equal(t, peer.String(), from.String())
+
+					return
+				}
+			}
+		}
+
+		// Bind a channel before moving
+		echo("via indication")
+		assert.Eventually(t, func() bool {
+			_, err := relayConn.WriteTo([]byte("ping"), peer)
+
+			return err == nil && udpConn.Stats().ChannelSends > 0
+		}, 5*time.Second, 10*time.Millisecond)
+		echo("via channel")
+		_, binds := server.state()
+		require.Equal(t, 1, binds)
+
+		for _, conn := range []net.PacketConn{newConn(t), newConn(t)} {
+			require.NoError(t, turnClient.MigrateAllocation(conn))
+			client, _ := server.state()
+			assert.Equal(t, conn.LocalAddr().String(), client.String(), "server should know the new 5-tuple")
+
+			// Data keeps flowing over the existing channel binding
+			sends := udpConn.Stats().ChannelSends
+			echo("after migration")
+			assert.Greater(t, udpConn.Stats().ChannelSends, sends)
+			_, binds = server.state()
+			assert.Equal(t, 1, binds, "binding should be preserved")
+			assert.Equal(t, uint64(1), udpConn.Stats().Bindings.Ready)
+		}
+		assert.NoError(t, relayConn.Close())
+	})
+
+	t.Run("Rejected", func(t *testing.T) {
+		turnClient, server := newClient(t, WithMobility())
+		relayConn, err := turnClient.Allocate()
+		require.NoError(t, err)
+		defer relayConn.Close() //nolint:errcheck
+
+		server.mu.Lock()
+		server.ticket = []byte("revoked")
+		server.mu.Unlock()
+
+		oldConn := turnClient.baseConn()
+		assert.ErrorIs(t, turnClient.MigrateAllocation(newConn(t)), errMigrationFailed)
+		assert.Equal(t, oldConn, turnClient.baseConn(), "previous conn should be restored")
+	})
+
+	t.Run("Not requested", func(t *testing.T) {
+		turnClient, _ := newClient(t)
+		assert.ErrorIs(t, turnClient.MigrateAllocation(newConn(t)), errNoUDPAllocation)
+		assert.ErrorIs(t, turnClient.MigrateAllocation(nil), errNilConn)
+
+		relayConn, err := turnClient.Allocate()
+		require.NoError(t, err)
+		defer relayConn.Close() //nolint:errcheck
+
+		assert.ErrorIs(t, turnClient.MigrateAllocation(newConn(t)), errMigrationFailed)
+	})
+}
+
+func TestClientReconnect(t *testing.T) {
+	serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	require.NoError(t, err)
 
 	server, err := NewServer(ServerConfig{
 		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
@@ -155,46 +1324,265 @@ func TestClientNonceExpiration(t *testing.T) {
 		},
 		PacketConnConfigs: []PacketConnConfig{
 			{
-				PacketConn: udpListener,
+				PacketConn: serverConn,
 				RelayAddressGenerator: &RelayAddressGeneratorStatic{
 					RelayAddress: net.ParseIP("127.0.0.1"),
-					Address:      "0.0.0.0",
+					Address:      "127.0.0.1",
 				},
 			},
 		},
 		Realm: "pion.ly",
 	})
-	assert.NoError(t, err)
+	require.NoError(t, err)
+	defer server.Close() //nolint:errcheck
 
-	conn, err := net.ListenPacket("udp4", "0.0.0.0:0") // nolint: noctx
-	assert.NoError(t, err)
+	newConn := func(t *testing.T) net.PacketConn {
+		t.Helper()
 
-	// nolint: goconst
-	addr := "127.0.0.1:3478"
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = conn.Close() })
 
-	client, err := NewClient(&ClientConfig{
-		Conn:           conn,
-		STUNServerAddr: addr,
-		TURNServerAddr: addr,
+		return conn
+	}
+
+	turnClient, err := NewClient(&ClientConfig{
+		Conn:           newConn(t),
+		TURNServerAddr: serverConn.LocalAddr().String(),
 		Username:       "foo",
 		Password:       "pass",
 	})
-	assert.NoError(t, err)
-	assert.NoError(t, client.Listen())
+	require.NoError(t, err)
+	require.NoError(t, turnClient.Listen())
+	defer turnClient.Close()
 
-	allocation, err := client.Allocate()
-	assert.NoError(t, err)
+	assert.ErrorIs(t, turnClient.Reconnect(newConn(t)), errNoUDPAllocation)
+	assert.ErrorIs(t, turnClient.Reconnect(nil), errNilConn)
 
-	_, err = allocation.WriteTo([]byte{0x00}, &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 8080})
-	assert.NoError(t, err)
+	relayConn, err := turnClient.Allocate()
+	require.NoError(t, err)
+	defer relayConn.Close() //nolint:errcheck
+	udpConn, ok := relayConn.(*client.UDPConn)
+	require.True(t, ok)
 
-	// Shutdown
-	assert.NoError(t, allocation.Close())
-	assert.NoError(t, conn.Close())
-	assert.NoError(t, server.Close())
+	peer := newConn(t)
+	buf := make([]byte, 64)
+	// exchange sends payload to the peer over a channel binding and back.
+	exchange := func(payload string) {
+		t.Helper()
+
+		assert.Eventually(t, func() bool {
+			_, err := relayConn.WriteTo([]byte(payload), peer.LocalAddr())
+
+			return err == nil && udpConn.Stats().ChannelSends > 0
+		}, 5*time.Second, 10*time.Millisecond)
+
+		require.NoError(t, peer.SetReadDeadline(time.Now().Add(5*time.Second)))
+		n, from, err := peer.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.Equal(t, payload, string(buf[:n]))
+		assert.Equal(t, relayConn.LocalAddr().String(), from.String())
+
+		_, err = peer.WriteTo([]byte(payload), relayConn.LocalAddr())
+		require.NoError(t, err)
+		require.NoError(t, relayConn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		n, _, err = relayConn.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.Equal(t, payload, string(buf[:n]))
+	}
+	exchange("before")
+	oldRelayed := relayConn.LocalAddr().String()
+
+	// The old conn is lost, the allocation is made again on the new one
+	newClientConn := newConn(t)
+	require.NoError(t, turnClient.Reconnect(newClientConn))
+	assert.Equal(t, newClientConn, turnClient.baseConn())
+	assert.NotEqual(t, oldRelayed, relayConn.LocalAddr().String(), "a new relayed address should be allocated")
+	assert.Equal(t, uint64(1), udpConn.Stats().Bindings.Ready, "the channel should be bound again")
+
+	// Drop what the peer got from the old relayed address
+	for {
+		require.NoError(t, peer.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+		if _, _, err := peer.ReadFrom(buf); err != nil {
+			break
+		}
+	}
+	exchange("after")
+}
+
+func TestClientResumeAllocation(t *testing.T) {
+	serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	require.NoError(t, err)
+
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			return GenerateAuthKey(username, realm, "pass"), true
+		},
+		PacketConnConfigs: []PacketConnConfig{
+			{
+				PacketConn: serverConn,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "127.0.0.1",
+				},
+			},
+		},
+		Realm: "pion.ly",
+	})
+	require.NoError(t, err)
+	defer server.Close() //nolint:errcheck
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	require.NoError(t, err)
+	defer conn.Close() //nolint:errcheck
+
+	// newClient returns a listening Client on conn, stopping the previous one
+	// from reading it.
+	newClient := func(t *testing.T, realm string) *Client {
+		t.Helper()
+
+		require.NoError(t, conn.SetReadDeadline(time.Now()))
+		time.Sleep(10 * time.Millisecond) // Let the read loop of the previous Client exit
+		require.NoError(t, conn.SetReadDeadline(time.Time{}))
+
+		turnClient, err := NewClient(&ClientConfig{
+			Conn:           conn,
+			TURNServerAddr: serverConn.LocalAddr().String(),
+			Username:       "foo",
+			Password:       "pass",
+			Realm:          realm,
+		})
+		require.NoError(t, err)
+		require.NoError(t, turnClient.Listen())
+		t.Cleanup(turnClient.Close)
+
+		return turnClient
+	}
+
+	// The previous Client goes away without releasing its allocation
+	previous := newClient(t, "")
+	relayConn, err := previous.Allocate()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = relayConn.Close() })
+	udpConn, ok := relayConn.(*client.UDPConn)
+	require.True(t, ok)
+	relayedAddr, nonce := udpConn.RelayAddr(), udpConn.Nonce()
+	assert.NotEmpty(t, nonce)
+
+	parent := t
+	t.Run("Live", func(t *testing.T) {
+		for _, realm := range []string{"pion.ly", ""} {
+			turnClient := newClient(t, realm)
+			_, err := turnClient.ResumeAllocation(context.Background(), &net.TCPAddr{}, nonce)
+			assert.ErrorIs(t, err, errInvalidRelayedAddr)
+
+			resumed, err := turnClient.ResumeAllocation(context.Background(), relayedAddr, nonce)
+			require.NoError(t, err)
+			// Closing releases the allocation, which Expired still resumes
+			parent.Cleanup(func() { _ = resumed.Close() })
+			assert.Equal(t, relayedAddr.String(), resumed.LocalAddr().String())
+			_, err = turnClient.ResumeAllocation(context.Background(), relayedAddr, nonce)
+			assert.ErrorIs(t, err, errAlreadyAllocated)
+
+			// The allocation relays data for the new Client
+			peer, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+			require.NoError(t, err)
+			_, err = resumed.WriteTo([]byte("resumed"), peer.LocalAddr())
+			assert.NoError(t, err)
+			buf := make([]byte, 64)
+			require.NoError(t, peer.SetReadDeadline(time.Now().Add(5*time.Second)))
+			n, from, err := peer.ReadFrom(buf)
+			assert.NoError(t, err)
+			assert.Equal(t, "resumed", string(buf[:n]))
+			assert.Equal(t, relayedAddr.String(), from.String())
+			assert.NoError(t, peer.Close())
+
+			nonce = resumed.Nonce()
+		}
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		turnClient := newClient(t, "pion.ly")
+		resumed, err := turnClient.ResumeAllocation(context.Background(), relayedAddr, nonce)
+		require.NoError(t, err)
+		// Releasing the allocation
+		require.NoError(t, resumed.CloseWithDrain(context.Background()))
+
+		turnClient = newClient(t, "pion.ly")
+		_, err = turnClient.ResumeAllocation(context.Background(), relayedAddr, nonce)
+		assert.ErrorIs(t, err, ErrAllocationExpired)
+	})
 }
 
 // Create a TCP-based allocation and verify allocation can be created.
+func TestClientTrace(t *testing.T) {
+	serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	require.NoError(t, err)
+	defer serverConn.Close() //nolint:errcheck
+	server := &fakeMobilityServer{t: t, conn: serverConn}
+	go server.serve()
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	require.NoError(t, err)
+	defer conn.Close() //nolint:errcheck
+
+	turnClient, err := NewClient(&ClientConfig{
+		Conn:           conn,
+		TURNServerAddr: serverConn.LocalAddr().String(),
+		Username:       "foo",
+		Password:       "pass",
+		RTO:            50 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	require.NoError(t, turnClient.Listen())
+	defer turnClient.Close()
+
+	var mutex sync.Mutex
+	var events []string
+	record := func(format string, args ...any) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		events = append(events, fmt.Sprintf(format, args...))
+	}
+	recorded := func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		return append([]string(nil), events...)
+	}
+	ctx := WithClientTrace(context.Background(), &ClientTrace{
+		AllocateDone:      func(addr net.Addr, err error) { record("allocate %v %v", addr, err) },
+		PermissionCreated: func(peer net.Addr) { record("permission %s", peer) },
+		ChannelBound:      func(peer net.Addr, ch uint16) { record("channel %s %d", peer, ch) },
+	})
+
+	relayConn, err := turnClient.AllocateContext(ctx)
+	require.NoError(t, err)
+	defer relayConn.Close() //nolint:errcheck
+	assert.Equal(t, []string{"allocate 127.0.0.1:5000 <nil>"}, recorded())
+
+	peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+	_, err = relayConn.WriteTo([]byte("hello"), peer)
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		_, binds := server.state()
+
+		return binds == 1 && len(recorded()) == 3
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{
+		"allocate 127.0.0.1:5000 <nil>",
+		"permission 10.0.0.1:5000",
+		"channel 10.0.0.1:5000 16384",
+	}, recorded())
+
+	// Failed allocations are traced too
+	_, err = turnClient.AllocateContext(ctx)
+	assert.ErrorIs(t, err, errAlreadyAllocated)
+	if traced := recorded(); assert.Len(t, traced, 4) {
+		assert.Contains(t, traced[3], "allocate <nil> already allocated")
+	}
+}
+
 func TestTCPClient(t *testing.T) {
 	// Setup server
 	tcpListener, err := net.Listen("tcp4", "0.0.0.0:13478") //nolint: gosec,noctx
@@ -262,6 +1650,74 @@ func TestTCPClient(t *testing.T) {
 	require.NoError(t, server.Close())
 }
 
+func TestTCPClientConcurrentTransactions(t *testing.T) {
+	tcpListener, err := net.Listen("tcp4", "127.0.0.1:0") //nolint: noctx
+	require.NoError(t, err)
+
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			return GenerateAuthKey(username, realm, "pass"), true
+		},
+		ListenerConfigs: []ListenerConfig{
+			{
+				Listener: tcpListener,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "0.0.0.0",
+				},
+			},
+		},
+		Realm: "pion.ly",
+	})
+	require.NoError(t, err)
+	defer server.Close() //nolint:errcheck
+
+	serverAddr := tcpListener.Addr().String()
+	conn, err := net.Dial("tcp", serverAddr) // nolint: noctx
+	require.NoError(t, err)
+	defer conn.Close() //nolint:errcheck
+
+	client, err := NewClient(&ClientConfig{
+		Conn:           NewSTUNConn(conn),
+		STUNServerAddr: serverAddr,
+		TURNServerAddr: serverAddr,
+		Username:       "foo",
+		Password:       "pass",
+	})
+	require.NoError(t, err)
+	require.NoError(t, client.Listen())
+	defer client.Close()
+
+	// All transactions share a single TCP stream, responses must be
+	// demultiplexed back to the right caller by transaction ID.
+	const numTransactions = 16
+	var wg sync.WaitGroup
+	errs := make(chan error, numTransactions)
+	for i := 0; i < numTransactions; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			mappedAddr, reqErr := client.SendBindingRequest()
+			if reqErr == nil && mappedAddr.String() != conn.LocalAddr().String() {
+				reqErr = fmt.Errorf("unexpected mapped address %s", mappedAddr) //nolint:err113
+			}
+			errs <- reqErr
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 0, client.trMap.Size())
+
+	relayConn, err := client.Allocate()
+	require.NoError(t, err)
+	assert.NoError(t, relayConn.Close())
+}
+
 func TestTCPClientWithoutAddress(t *testing.T) {
 	// Setup server
 	tcpListener, err := net.Listen("tcp4", "0.0.0.0:13478") //nolint: gosec,noctx
@@ -331,3 +1787,330 @@ func TestTCPClientWithoutAddress(t *testing.T) {
 	assert.NoError(t, conn.Close())
 	assert.NoError(t, server.Close())
 }
+
+// fakeTCPTURNServer is a TURN server over TCP granting RFC 6062 TCP
+// allocations. Connect requests dial the peer, whose connection is bridged
+// to the data connection bound to it.
+type fakeTCPTURNServer struct {
+	listener net.Listener
+	mutex    sync.Mutex
+	methods  []stun.Method       // Protected by mutex, in order of arrival
+	peers    map[uint32]net.Conn // Protected by mutex, by CONNECTION-ID
+	nextCID  proto.ConnectionID  // Protected by mutex
+}
+
+func (s *fakeTCPTURNServer) serve(t *testing.T) {
+	t.Helper()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(t, conn)
+	}
+}
+
+// readSTUN reads a STUN message framed by its length, RFC 6062 Section 4.
+func readSTUN(conn net.Conn) (*stun.Message, error) {
+	raw := make([]byte, stunHeaderSize)
+	if _, err := io.ReadFull(conn, raw); err != nil {
+		return nil, err
+	}
+	raw = append(raw, make([]byte, binary.BigEndian.Uint16(raw[2:4]))...)
+	if _, err := io.ReadFull(conn, raw[stunHeaderSize:]); err != nil {
+		return nil, err
+	}
+	msg := &stun.Message{Raw: raw}
+
+	return msg, msg.Decode()
+}
+
+func (s *fakeTCPTURNServer) handle(t *testing.T, conn net.Conn) { //nolint:cyclop
+	t.Helper()
+	defer conn.Close() //nolint:errcheck
+
+	for {
+		req, err := readSTUN(conn)
+		if err != nil {
+			return
+		}
+		s.mutex.Lock()
+		s.methods = append(s.methods, req.Type.Method)
+		s.mutex.Unlock()
+
+		resType := stun.NewType(req.Type.Method, stun.ClassSuccessResponse)
+		var attrs []stun.Setter
+		var peer net.Conn
+		switch req.Type.Method {
+		case stun.MethodAllocate:
+			if !req.Contains(stun.AttrUsername) {
+				resType = stun.NewType(stun.MethodAllocate, stun.ClassErrorResponse)
+				attrs = []stun.Setter{stun.CodeUnauthorized, stun.NewNonce("nonce"), stun.NewRealm("pion.ly")}
+
+				break
+			}
+			attrs = []stun.Setter{
+				&proto.RelayedAddress{IP: net.IPv4(127, 0, 0, 1), Port: 5000},
+				&stun.XORMappedAddress{IP: net.IPv4(127, 0, 0, 1), Port: 6000},
+				proto.Lifetime{Duration: time.Minute},
+			}
+		case stun.MethodConnect:
+			var peerAddr proto.PeerAddress
+			require.NoError(t, peerAddr.GetFrom(req))
+			peerConn, err := net.Dial("tcp4", peerAddr.String()) // nolint: noctx
+			require.NoError(t, err)
+			s.mutex.Lock()
+			s.nextCID++
+			cid := s.nextCID
+			s.peers[uint32(cid)] = peerConn
+			s.mutex.Unlock()
+			attrs = []stun.Setter{cid}
+		case stun.MethodConnectionBind:
+			var cid proto.ConnectionID
+			require.NoError(t, cid.GetFrom(req))
+			s.mutex.Lock()
+			peer = s.peers[uint32(cid)]
+			s.mutex.Unlock()
+			if peer == nil {
+				resType = stun.NewType(stun.MethodConnectionBind, stun.ClassErrorResponse)
+				attrs = []stun.Setter{stun.CodeBadRequest}
+			}
+		default:
+		}
+
+		res, err := stun.Build(buildMsg(req.TransactionID, resType, append(attrs, stun.Fingerprint)...)...)
+		require.NoError(t, err)
+		if _, err = conn.Write(res.Raw); err != nil {
+			return
+		}
+
+		// The data connection carries the data of the peer from now on
+		if peer != nil {
+			go func() {
+				_, _ = io.Copy(peer, conn)
+				_ = peer.Close()
+			}()
+			_, _ = io.Copy(conn, peer)
+
+			return
+		}
+	}
+}
+
+func (s *fakeTCPTURNServer) requests() []stun.Method {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]stun.Method(nil), s.methods...)
+}
+
+func TestClientConnectToPeer(t *testing.T) {
+	listener, err := net.Listen("tcp4", "127.0.0.1:0") // nolint: noctx
+	require.NoError(t, err)
+	server := &fakeTCPTURNServer{listener: listener, peers: map[uint32]net.Conn{}}
+	go server.serve(t)
+	defer listener.Close() //nolint:errcheck
+
+	peerListener, err := net.Listen("tcp4", "127.0.0.1:0") // nolint: noctx
+	require.NoError(t, err)
+	defer peerListener.Close() //nolint:errcheck
+
+	newClient := func(t *testing.T) *Client {
+		t.Helper()
+
+		conn, err := net.Dial("tcp4", listener.Addr().String()) // nolint: noctx
+		require.NoError(t, err)
+		turnClient, err := NewClient(&ClientConfig{
+			Conn:           NewSTUNConn(conn),
+			TURNServerAddr: listener.Addr().String(),
+			Username:       "foo",
+			Password:       "pass",
+			RTO:            50 * time.Millisecond,
+		})
+		require.NoError(t, err)
+		require.NoError(t, turnClient.Listen())
+		t.Cleanup(func() {
+			turnClient.Close()
+			_ = conn.Close()
+		})
+
+		return turnClient
+	}
+
+	t.Run("Data flows both ways", func(t *testing.T) {
+		turnClient := newClient(t)
+		allocation, err := turnClient.AllocateTCP()
+		require.NoError(t, err)
+		defer allocation.Close() //nolint:errcheck
+
+		dataConn, err := turnClient.ConnectToPeer(context.Background(), peerListener.Addr())
+		require.NoError(t, err)
+		defer dataConn.Close() //nolint:errcheck
+		assert.Equal(t, peerListener.Addr().String(), dataConn.RemoteAddr().String())
+
+		// Permission, then the Connect and ConnectionBind handshake
+		requests := server.requests()
+		require.GreaterOrEqual(t, len(requests), 3)
+		assert.Equal(t, []stun.Method{
+			stun.MethodCreatePermission, stun.MethodConnect, stun.MethodConnectionBind,
+		}, requests[len(requests)-3:])
+
+		peerConn, err := peerListener.Accept()
+		require.NoError(t, err)
+		defer peerConn.Close() //nolint:errcheck
+		require.NoError(t, peerConn.SetDeadline(time.Now().Add(5*time.Second)))
+		require.NoError(t, dataConn.SetDeadline(time.Now().Add(5*time.Second)))
+
+		_, err = dataConn.Write([]byte("hello"))
+		require.NoError(t, err)
+		buf := make([]byte, 5)
+		_, err = io.ReadFull(peerConn, buf)
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(buf))
+
+		_, err = peerConn.Write([]byte("world"))
+		require.NoError(t, err)
+		_, err = io.ReadFull(dataConn, buf)
+		require.NoError(t, err)
+		assert.Equal(t, "world", string(buf))
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		turnClient := newClient(t)
+		allocation, err := turnClient.AllocateTCP()
+		require.NoError(t, err)
+		defer allocation.Close() //nolint:errcheck
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = turnClient.ConnectToPeer(ctx, peerListener.Addr())
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("Without TCP allocation", func(t *testing.T) {
+		_, err := newClient(t).ConnectToPeer(context.Background(), peerListener.Addr())
+		assert.ErrorIs(t, err, errNoTCPAllocation)
+	})
+
+	t.Run("UDP peer", func(t *testing.T) {
+		turnClient := newClient(t)
+		allocation, err := turnClient.AllocateTCP()
+		require.NoError(t, err)
+		defer allocation.Close() //nolint:errcheck
+
+		_, err = turnClient.ConnectToPeer(context.Background(), &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5000})
+		assert.ErrorIs(t, err, errInvalidPeerAddr)
+	})
+}
+
+func TestClientAllocateAddressFamily(t *testing.T) {
+	// allocate serves a single allocation, relaying an IPv6 address if asked to
+	// unless ignoreFamily is set, and returns the Allocate request
+	allocate := func(t *testing.T, opts AllocateOptions, ignoreFamily bool) (*client.UDPConn, *stun.Message, error) {
+		t.Helper()
+
+		serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = serverConn.Close() })
+		reqCh := make(chan *stun.Message, 1)
+		go func() {
+			buf := make([]byte, 1500)
+			for {
+				n, from, err := serverConn.ReadFrom(buf)
+				if err != nil {
+					return
+				}
+				req := &stun.Message{Raw: append([]byte(nil), buf[:n]...)}
+				if req.Decode() != nil || req.Type.Method != stun.MethodAllocate {
+					continue
+				}
+
+				typ := stun.NewType(stun.MethodAllocate, stun.ClassErrorResponse)
+				attrs := []stun.Setter{stun.CodeUnauthorized, stun.NewNonce("nonce"), stun.NewRealm("pion.ly")}
+				if req.Contains(stun.AttrUsername) {
+					reqCh <- req
+					typ = stun.NewType(stun.MethodAllocate, stun.ClassSuccessResponse)
+					relayed := &proto.RelayedAddress{IP: net.IPv4(127, 0, 0, 1), Port: 5000}
+					var family proto.RequestedAddressFamily
+					if family.GetFrom(req) == nil && family == proto.RequestedFamilyIPv6 && !ignoreFamily {
+						relayed.IP = net.ParseIP("::1")
+					}
+					attrs = []stun.Setter{relayed, proto.Lifetime{Duration: time.Minute}}
+				}
+				res, err := stun.Build(buildMsg(req.TransactionID, typ,
+					append(attrs, stun.Fingerprint)...)...)
+				assert.NoError(t, err)
+				_, err = serverConn.WriteTo(res.Raw, from)
+				assert.NoError(t, err)
+			}
+		}()
+
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = conn.Close() })
+		turnClient, err := NewClient(&ClientConfig{
+			Conn:           conn,
+			TURNServerAddr: serverConn.LocalAddr().String(),
+			Username:       "foo",
+			Password:       "pass",
+			RTO:            50 * time.Millisecond,
+		})
+		require.NoError(t, err)
+		require.NoError(t, turnClient.Listen())
+		t.Cleanup(turnClient.Close)
+
+		relayConn, err := turnClient.AllocateWithOptions(context.Background(), opts)
+		if err == nil {
+			t.Cleanup(func() { _ = relayConn.Close() })
+		}
+		select {
+		case req := <-reqCh:
+			return relayConn, req, err
+		default:
+			return relayConn, nil, err
+		}
+	}
+
+	for _, test := range []struct {
+		name   string
+		family RequestedAddressFamily
+		isIPv4 bool
+	}{
+		{"None", 0, true},
+		{"IPv4", RequestedFamilyIPv4, true},
+		{"IPv6", RequestedFamilyIPv6, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			relayConn, req, err := allocate(t, AllocateOptions{AddressFamily: test.family}, false)
+			require.NoError(t, err)
+
+			var family proto.RequestedAddressFamily
+			if test.family == 0 {
+				assert.False(t, req.Contains(stun.AttrRequestedAddressFamily))
+			} else {
+				assert.NoError(t, family.GetFrom(req))
+				assert.Equal(t, test.family, family)
+			}
+
+			relayAddr, ok := relayConn.RelayAddr().(*net.UDPAddr)
+			require.True(t, ok)
+			assert.Equal(t, test.isIPv4, relayAddr.IP.To4() != nil)
+			if test.isIPv4 {
+				assert.Equal(t, RequestedFamilyIPv4, relayConn.AddressFamily())
+			} else {
+				assert.Equal(t, RequestedFamilyIPv6, relayConn.AddressFamily())
+			}
+		})
+	}
+
+	t.Run("Other family relayed", func(t *testing.T) {
+		_, _, err := allocate(t, AllocateOptions{AddressFamily: RequestedFamilyIPv6}, true)
+		assert.ErrorIs(t, err, errRelayedAddressFamily)
+	})
+
+	t.Run("Invalid family", func(t *testing.T) {
+		_, _, err := allocate(t, AllocateOptions{AddressFamily: 3}, false)
+		assert.ErrorIs(t, err, errInvalidAddressFamily)
+	})
+}
@@ -0,0 +1,37 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+// Package main checks that a TURN server relays data by sending a packet
+// through an allocation back to itself.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/pion/turn/v4/internal/testutil"
+)
+
+func main() {
+	host := flag.String("host", "", "TURN Server name.")
+	port := flag.Int("port", 3478, "Listening port.")
+	user := flag.String("user", "", "A pair of username and password (e.g. \"user=pass\")")
+	flag.Parse()
+
+	if len(*host) == 0 {
+		log.Fatalf("'host' is required")
+	}
+
+	cred := strings.SplitN(*user, "=", 2)
+	if len(cred) != 2 {
+		log.Fatalf("'user' is required")
+	}
+
+	turnServerAddr := fmt.Sprintf("%s:%d", *host, *port)
+	if err := testutil.RunEchoTest(context.Background(), turnServerAddr, cred[0], cred[1]); err != nil {
+		log.Fatalf("Echo test failed: %s", err)
+	}
+}
@@ -0,0 +1,264 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"context"
+	"crypto/md5" //nolint:gosec // Required by RFC 5389
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4/internal/client"
+	"github.com/pion/turn/v4/internal/proto"
+)
+
+// CredentialDeriver derives the key of long-term credentials, from which
+// the Client computes MESSAGE-INTEGRITY or MESSAGE-INTEGRITY-SHA256.
+type CredentialDeriver interface {
+	// Algorithm returns the algorithm the key is used with.
+	Algorithm() CredentialAlgorithm
+	// Key returns the key for username, realm and password, which must be
+	// SASL-prepared.
+	Key(username, realm, password string) []byte
+}
+
+// CredentialRefresher fetches new long-term credentials for a Client whose
+// credentials were rejected, e.g. from a token service issuing short-lived
+// TURN credentials.
+type CredentialRefresher interface {
+	// Refresh returns the username and password to use from now on.
+	Refresh(ctx context.Context) (username, password string, err error)
+}
+
+// RealmCredentialRefresher is a CredentialRefresher that can also fetch the
+// credentials of another realm, e.g. for federated TURN servers answering
+// with a REALM different from the configured one. RefreshRealm returns
+// ErrUnknownRealm for realms it has no credentials for.
+type RealmCredentialRefresher interface {
+	CredentialRefresher
+	// RefreshRealm returns the username and password to use in realm.
+	RefreshRealm(ctx context.Context, realm string) (username, password string, err error)
+}
+
+// MD5LTC derives the RFC 5389 long-term credential key
+// MD5(username ":" realm ":" password), used with HMAC-SHA1.
+type MD5LTC struct{}
+
+// Algorithm implements CredentialDeriver.
+func (MD5LTC) Algorithm() CredentialAlgorithm {
+	return CredentialAlgorithmSHA1
+}
+
+// Key implements CredentialDeriver.
+func (MD5LTC) Key(username, realm, password string) []byte {
+	key := md5.Sum([]byte(strings.Join([]string{username, realm, password}, ":"))) //nolint:gosec
+
+	return key[:]
+}
+
+// SHA256LTC derives the RFC 8489 Section 9.2.2 long-term credential key
+// SHA-256(username ":" realm ":" password), used with HMAC-SHA256.
+type SHA256LTC struct{}
+
+// Algorithm implements CredentialDeriver.
+func (SHA256LTC) Algorithm() CredentialAlgorithm {
+	return CredentialAlgorithmSHA256
+}
+
+// Key implements CredentialDeriver.
+func (SHA256LTC) Key(username, realm, password string) []byte {
+	key := sha256.Sum256([]byte(strings.Join([]string{username, realm, password}, ":")))
+
+	return key[:]
+}
+
+// credentialDeriverFor returns the default CredentialDeriver of algorithm.
+// CredentialAlgorithmAuto starts with the SHA1 one until negotiated.
+func credentialDeriverFor(algorithm CredentialAlgorithm) CredentialDeriver {
+	if algorithm == CredentialAlgorithmSHA256 {
+		return SHA256LTC{}
+	}
+
+	return MD5LTC{}
+}
+
+// integrityFor returns the message integrity attribute for key.
+func integrityFor(algorithm CredentialAlgorithm, key []byte) proto.Integrity {
+	if algorithm == CredentialAlgorithmSHA256 {
+		return proto.MessageIntegritySHA256(key)
+	}
+
+	return stun.MessageIntegrity(key)
+}
+
+// verifyMessageSHA256 checks the MESSAGE-INTEGRITY-SHA256 of msg with key,
+// accepting truncated values. It is the SHA-256 variant of
+// stun.MessageIntegrity.Check.
+func verifyMessageSHA256(msg *stun.Message, key []byte) error {
+	return proto.MessageIntegritySHA256(key).Check(msg)
+}
+
+// negotiateCredentialAlgorithm returns the algorithm CredentialAlgorithmAuto
+// uses with a server offering algorithms: SHA256 if offered, SHA1 otherwise.
+func negotiateCredentialAlgorithm(algorithms []CredentialAlgorithm) CredentialAlgorithm {
+	if slices.Contains(algorithms, CredentialAlgorithmSHA256) {
+		return CredentialAlgorithmSHA256
+	}
+
+	return CredentialAlgorithmSHA1
+}
+
+// Password algorithm numbers, RFC 8489 Section 18.5.
+const (
+	passwordAlgorithmMD5    uint16 = 0x0001
+	passwordAlgorithmSHA256 uint16 = 0x0002
+)
+
+// passwordAlgorithms returns the algorithms of the PASSWORD-ALGORITHMS
+// attribute of msg (RFC 8489 Section 14.11), or false if it has none.
+func passwordAlgorithms(msg *stun.Message) ([]CredentialAlgorithm, bool) {
+	value, err := msg.Get(stun.AttrPasswordAlgorithms)
+	if err != nil {
+		return nil, false
+	}
+
+	var algorithms []CredentialAlgorithm
+	for len(value) >= 4 {
+		number := binary.BigEndian.Uint16(value[0:2])
+		paramsLen := int(binary.BigEndian.Uint16(value[2:4]))
+		switch number {
+		case passwordAlgorithmMD5:
+			algorithms = append(algorithms, CredentialAlgorithmSHA1)
+		case passwordAlgorithmSHA256:
+			algorithms = append(algorithms, CredentialAlgorithmSHA256)
+		}
+		next := 4 + paramsLen + (4-paramsLen%4)%4
+		if next > len(value) {
+			break
+		}
+		value = value[next:]
+	}
+
+	return algorithms, true
+}
+
+// passwordAlgorithmAttrs returns the PASSWORD-ALGORITHMS and
+// PASSWORD-ALGORITHM attributes of an authenticated request, RFC 8489
+// Section 9.2.4. offer is the PASSWORD-ALGORITHMS value of the 401 response,
+// which is sent back unchanged along with the algorithm selected from it.
+// Without an offer only SHA-256 is named, as MD5 is the default.
+func passwordAlgorithmAttrs(algorithm CredentialAlgorithm, offer []byte) []stun.Setter {
+	number := passwordAlgorithmMD5
+	if algorithm == CredentialAlgorithmSHA256 {
+		number = passwordAlgorithmSHA256
+	}
+	// The algorithms defined so far have no parameters
+	selected := stun.RawAttribute{Type: stun.AttrPasswordAlgorithm, Value: []byte{byte(number >> 8), byte(number), 0, 0}}
+
+	switch {
+	case offer != nil:
+		return []stun.Setter{stun.RawAttribute{Type: stun.AttrPasswordAlgorithms, Value: offer}, selected}
+	case number == passwordAlgorithmSHA256:
+		return []stun.Setter{selected}
+	default:
+		return nil
+	}
+}
+
+// credentialsExpired reports whether res rejects the credentials req was
+// signed with, by a 401 carrying a new nonce to retry with.
+func credentialsExpired(req, res *stun.Message) bool {
+	if !req.Contains(stun.AttrUsername) || res.Type.Class != stun.ClassErrorResponse || !res.Contains(stun.AttrNonce) {
+		return false
+	}
+	var code stun.ErrorCodeAttribute
+
+	return code.GetFrom(res) == nil && code.Code == stun.CodeUnauthorized
+}
+
+// realmChanged reports whether the 401 response res names a realm other
+// than the one req was signed for.
+func realmChanged(req, res *stun.Message) bool {
+	var reqRealm, resRealm stun.Realm
+	if resRealm.GetFrom(res) != nil {
+		return false
+	}
+
+	return reqRealm.GetFrom(req) != nil || reqRealm.String() != resRealm.String()
+}
+
+// refreshCredentials gets new credentials from the CredentialRefresher and
+// hands them, with the nonce of the 401 response res, to the allocations. It
+// returns req signed with them. The credentials of a new realm in res are
+// fetched with RefreshRealm if the refresher is a RealmCredentialRefresher.
+func (c *Client) refreshCredentials(ctx context.Context, req, res *stun.Message) (*stun.Message, error) {
+	var nonce stun.Nonce
+	if err := nonce.GetFrom(res); err != nil {
+		return nil, err
+	}
+	var realm stun.Realm
+	if err := realm.GetFrom(res); err != nil {
+		realm = c.Realm()
+	}
+
+	var username, password string
+	var err error
+	if refresher, ok := c.credRefresher.(RealmCredentialRefresher); ok && realmChanged(req, res) {
+		c.log.Debugf("TURN server changed the realm to %s", realm)
+		username, password, err = refresher.RefreshRealm(ctx, realm.String())
+	} else {
+		username, password, err = c.credRefresher.Refresh(ctx)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCredentialRefreshFailed, err)
+	}
+
+	c.mutex.Lock()
+	c.username = stun.NewUsername(username)
+	c.password = password
+	c.realm = append(stun.Realm(nil), realm...)
+	c.integrity = c.newIntegrity()
+	c.mutex.Unlock()
+	c.log.Debug("Refreshed credentials after 401 response")
+
+	creds := c.credentials()
+	creds.Nonce = nonce
+	if conn := c.relayedUDPConn(); conn != nil {
+		conn.SetCredentials(creds)
+	}
+	if allocation := c.getTCPAllocation(); allocation != nil {
+		allocation.SetCredentials(creds)
+	}
+
+	return resign(req, creds)
+}
+
+// resign returns a copy of req with a new transaction ID and the extra
+// attributes, signed with creds.
+func resign(req *stun.Message, creds client.Credentials, extra ...stun.Setter) (*stun.Message, error) {
+	setters := []stun.Setter{stun.TransactionID, req.Type}
+	for _, attr := range req.Attributes {
+		switch attr.Type {
+		case stun.AttrUsername, stun.AttrRealm, stun.AttrNonce,
+			stun.AttrMessageIntegrity, stun.AttrMessageIntegritySHA256, stun.AttrFingerprint:
+			continue
+		default:
+			setters = append(setters, attr)
+		}
+	}
+
+	setters = append(append(setters, extra...), creds.Username)
+	if len(creds.Realm) > 0 {
+		setters = append(setters, creds.Realm)
+	}
+	if len(creds.Nonce) > 0 {
+		setters = append(setters, creds.Nonce)
+	}
+
+	return stun.Build(append(setters, creds.Integrity, stun.Fingerprint)...)
+}
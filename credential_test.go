@@ -0,0 +1,607 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package turn
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4/internal/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCredentialDeriver(t *testing.T) {
+	// RFC 5769 Section 2.4, the password is SASLprep("The\u00adM\u00aarIX")
+	const username, realm, password = "マトリックス", "example.org", "TheMatrIX"
+
+	t.Run("MD5LTC", func(t *testing.T) {
+		key := MD5LTC{}.Key(username, realm, password)
+		assert.Equal(t, []byte(stun.NewLongTermIntegrity(username, realm, password)), key)
+
+		msg, err := stun.Build(
+			stun.NewTransactionIDSetter([stun.TransactionIDSize]byte{
+				0x78, 0xad, 0x34, 0x33, 0xc6, 0xad, 0x72, 0xc0, 0x29, 0xda, 0x41, 0x2e,
+			}),
+			stun.BindingRequest,
+			stun.NewUsername(username),
+			stun.NewNonce("f//499k954d6OL34oL9FSTvy64sA"),
+			stun.NewRealm(realm),
+			integrityFor(MD5LTC{}.Algorithm(), key),
+		)
+		require.NoError(t, err)
+		integrity, err := msg.Get(stun.AttrMessageIntegrity)
+		require.NoError(t, err)
+		assert.Equal(t, "f67024656dd64a3e02b8e0712e85c9a28ca89666", hex.EncodeToString(integrity))
+	})
+
+	t.Run("SHA256LTC", func(t *testing.T) {
+		// The credentials of RFC 8489 Appendix B.1, which only prints the
+		// request signed with this key
+		key := SHA256LTC{}.Key(username, realm, password)
+		assert.Equal(t, "dd295a613b9058c3c23d6dc7165bda072304d989c9d0af3a8c7e184b4f9bb4a1", hex.EncodeToString(key))
+		assert.Equal(t, []byte(proto.NewLongTermIntegritySHA256(username, realm, password)), key)
+		assert.Equal(t, CredentialAlgorithmSHA256, SHA256LTC{}.Algorithm())
+		assert.IsType(t, proto.MessageIntegritySHA256{}, integrityFor(SHA256LTC{}.Algorithm(), key))
+	})
+}
+
+// fixedKeyDeriver derives the same SHA1 key for all credentials.
+type fixedKeyDeriver []byte
+
+func (fixedKeyDeriver) Algorithm() CredentialAlgorithm { return CredentialAlgorithmSHA1 }
+
+func (d fixedKeyDeriver) Key(string, string, string) []byte { return d }
+
+func TestClientCredentialDeriver(t *testing.T) {
+	const username, password = "foo", "pass"
+
+	allocate := func(
+		t *testing.T,
+		config ClientConfig,
+		opts []ClientOption,
+		respIntegrity proto.Integrity,
+		challenge ...stun.Setter,
+	) (chan *stun.Message, error) {
+		t.Helper()
+
+		serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		require.NoError(t, err)
+		defer serverConn.Close() //nolint:errcheck
+		reqCh := make(chan *stun.Message, 1)
+		go fakeAuthServer(t, serverConn, respIntegrity, reqCh, challenge...)
+
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		require.NoError(t, err)
+		defer conn.Close() //nolint:errcheck
+
+		config.Conn = conn
+		config.TURNServerAddr = serverConn.LocalAddr().String()
+		config.Username = username
+		config.Password = password
+		config.RTO = 50 * time.Millisecond
+		turnClient, err := NewClient(&config, opts...)
+		require.NoError(t, err)
+		require.NoError(t, turnClient.Listen())
+		defer turnClient.Close()
+
+		relayConn, err := turnClient.Allocate()
+		if err == nil {
+			assert.NoError(t, relayConn.Close())
+		}
+
+		return reqCh, err
+	}
+
+	t.Run("injected deriver", func(t *testing.T) {
+		key := fixedKeyDeriver("0123456789abcdef")
+		reqCh, err := allocate(t, ClientConfig{}, []ClientOption{WithCredentialDeriver(key)}, stun.MessageIntegrity(key))
+		assert.NoError(t, err)
+		assert.NoError(t, stun.MessageIntegrity(key).Check(<-reqCh))
+	})
+
+	t.Run("deriver overrides the algorithm", func(t *testing.T) {
+		sha256Key := proto.NewLongTermIntegritySHA256(username, "pion.ly", password)
+		reqCh, err := allocate(t, ClientConfig{}, []ClientOption{WithCredentialDeriver(SHA256LTC{})}, sha256Key)
+		assert.NoError(t, err)
+		assert.NoError(t, sha256Key.Check(<-reqCh))
+	})
+
+	t.Run("rejected credentials", func(t *testing.T) {
+		_, err := allocate(t, ClientConfig{CredentialAlgorithm: CredentialAlgorithmSHA256}, nil, nil)
+		assert.ErrorIs(t, err, errCredentialsRejected)
+		assert.ErrorContains(t, err, "SHA256")
+	})
+
+	t.Run("algorithm not offered by the server", func(t *testing.T) {
+		// PASSWORD-ALGORITHMS with MD5 only
+		md5Only := stun.RawAttribute{Type: stun.AttrPasswordAlgorithms, Value: []byte{0x00, 0x01, 0x00, 0x00}}
+		reqCh, err := allocate(t, ClientConfig{CredentialAlgorithm: CredentialAlgorithmSHA256}, nil,
+			proto.NewLongTermIntegritySHA256(username, "pion.ly", password), md5Only)
+		assert.ErrorIs(t, err, errCredentialAlgorithmMismatch)
+		assert.Empty(t, reqCh, "no authenticated request should be sent")
+
+		// An offered algorithm is used as usual, and the offer sent back
+		reqCh, err = allocate(t, ClientConfig{}, nil, stun.NewLongTermIntegrity(username, "pion.ly", password), md5Only)
+		assert.NoError(t, err)
+		req := <-reqCh
+		offer, err := req.Get(stun.AttrPasswordAlgorithms)
+		assert.NoError(t, err)
+		assert.Equal(t, md5Only.Value, offer)
+		algorithm, err := req.Get(stun.AttrPasswordAlgorithm)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{0x00, 0x01, 0x00, 0x00}, algorithm)
+	})
+
+	t.Run("negotiated algorithm", func(t *testing.T) {
+		sha1Key := stun.NewLongTermIntegrity(username, "pion.ly", password)
+		sha256Key := proto.NewLongTermIntegritySHA256(username, "pion.ly", password)
+		auto := ClientConfig{CredentialAlgorithm: CredentialAlgorithmAuto}
+		both := stun.RawAttribute{
+			Type:  stun.AttrPasswordAlgorithms,
+			Value: []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00},
+		}
+		md5Only := stun.RawAttribute{Type: stun.AttrPasswordAlgorithms, Value: []byte{0x00, 0x01, 0x00, 0x00}}
+
+		// SHA-256 is used when offered, and required in the response
+		reqCh, err := allocate(t, auto, nil, sha256Key, both)
+		assert.NoError(t, err)
+		req := <-reqCh
+		assert.NoError(t, sha256Key.Check(req))
+		// The offer is sent back with the selected algorithm, RFC 8489 Section 9.2.4
+		offer, err := req.Get(stun.AttrPasswordAlgorithms)
+		assert.NoError(t, err)
+		assert.Equal(t, both.Value, offer)
+		algorithm, err := req.Get(stun.AttrPasswordAlgorithm)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{0x00, 0x02, 0x00, 0x00}, algorithm)
+		_, err = allocate(t, auto, nil, sha1Key, both)
+		assert.ErrorIs(t, err, errResponseIntegrity)
+
+		// SHA1 otherwise
+		for _, challenge := range [][]stun.Setter{{md5Only}, nil} {
+			reqCh, err = allocate(t, auto, nil, sha1Key, challenge...)
+			assert.NoError(t, err)
+			req = <-reqCh
+			assert.NoError(t, sha1Key.Check(req))
+			assert.False(t, req.Contains(stun.AttrMessageIntegritySHA256))
+			assert.Equal(t, challenge != nil, req.Contains(stun.AttrPasswordAlgorithm))
+		}
+
+		// An injected deriver is not replaced
+		reqCh, err = allocate(t, auto, []ClientOption{WithCredentialDeriver(MD5LTC{})}, sha1Key, both)
+		assert.NoError(t, err)
+		assert.NoError(t, sha1Key.Check(<-reqCh))
+	})
+}
+
+func TestMessageIntegritySHA256(t *testing.T) {
+	// The request of RFC 8489 Appendix B.1
+	const username, realm, password = "マトリックス", "example.org", "TheMatrIX"
+	key := SHA256LTC{}.Key(username, realm, password)
+	build := func(t *testing.T) *stun.Message {
+		t.Helper()
+
+		userHash := sha256.Sum256([]byte(username + ":" + realm))
+		msg, err := stun.Build(
+			stun.NewTransactionIDSetter([stun.TransactionIDSize]byte{
+				0x78, 0xad, 0x34, 0x33, 0xc6, 0xad, 0x72, 0xc0, 0x29, 0xda, 0x41, 0x2e,
+			}),
+			stun.BindingRequest,
+			stun.RawAttribute{Type: stun.AttrUserhash, Value: userHash[:]},
+			stun.NewNonce("obMatJos2AAACf//499k954d6OL34oL9FSTvy64sA"),
+			stun.NewRealm(realm),
+			stun.RawAttribute{Type: stun.AttrPasswordAlgorithm, Value: []byte{0x00, 0x02, 0x00, 0x00}},
+		)
+		require.NoError(t, err)
+
+		return msg
+	}
+
+	t.Run("Sign", func(t *testing.T) {
+		msg := build(t)
+		// The attributes preceding MESSAGE-INTEGRITY-SHA256 as printed in B.1
+		assert.Equal(t, ""+
+			"001e0020"+"4a3cf38fef6992bda952c6780417da0f24819415569e60b205c46e41407f1704"+
+			"00150029"+"6f624d61744a6f733241414143662f2f3439396b39353464364f4c33346f4c39465354767936347341000000"+
+			"0014000b"+"6578616d706c652e6f726700"+
+			"001d0004"+"00020000", hex.EncodeToString(msg.Raw[20:]))
+
+		require.NoError(t, proto.MessageIntegritySHA256(key).AddTo(msg))
+		integrity, err := msg.Get(stun.AttrMessageIntegritySHA256)
+		require.NoError(t, err)
+		// The value printed in B.1 does not verify against the request printed
+		// along with it, whose length field is off as well. This one is computed
+		// with an independent HMAC-SHA256 over the request as printed above.
+		assert.Equal(t, "b5c7bf005b6c52a21c51c5e892f81924136296cb927c43149309278cc6518e65", hex.EncodeToString(integrity))
+	})
+
+	t.Run("Verify", func(t *testing.T) {
+		msg := build(t)
+		require.NoError(t, proto.MessageIntegritySHA256(key).AddTo(msg))
+		require.NoError(t, stun.Fingerprint.AddTo(msg))
+
+		decoded := new(stun.Message)
+		_, err := decoded.Write(append([]byte(nil), msg.Raw...))
+		require.NoError(t, err)
+		assert.NoError(t, verifyMessageSHA256(decoded, key))
+		assert.ErrorIs(t, verifyMessageSHA256(decoded, MD5LTC{}.Key(username, realm, password)), stun.ErrIntegrityMismatch)
+	})
+
+	t.Run("Tampered", func(t *testing.T) {
+		msg := build(t)
+		require.NoError(t, proto.MessageIntegritySHA256(key).AddTo(msg))
+
+		// Change the last byte of the realm
+		raw := append([]byte(nil), msg.Raw...)
+		realmAttr, ok := msg.Attributes.Get(stun.AttrRealm)
+		require.True(t, ok)
+		offset := bytes.Index(raw, realmAttr.Value) + len(realmAttr.Value) - 1
+		raw[offset] ^= 0xff
+		tampered := new(stun.Message)
+		_, err := tampered.Write(raw)
+		require.NoError(t, err)
+		assert.ErrorIs(t, verifyMessageSHA256(tampered, key), stun.ErrIntegrityMismatch)
+	})
+}
+
+func TestNegotiateCredentialAlgorithm(t *testing.T) {
+	assert.Equal(t, CredentialAlgorithmSHA256,
+		negotiateCredentialAlgorithm([]CredentialAlgorithm{CredentialAlgorithmSHA1, CredentialAlgorithmSHA256}))
+	assert.Equal(t, CredentialAlgorithmSHA1, negotiateCredentialAlgorithm([]CredentialAlgorithm{CredentialAlgorithmSHA1}))
+	assert.Equal(t, CredentialAlgorithmSHA1, negotiateCredentialAlgorithm(nil))
+}
+
+func TestPasswordAlgorithms(t *testing.T) {
+	msg, err := stun.Build(stun.BindingRequest)
+	require.NoError(t, err)
+	_, ok := passwordAlgorithms(msg)
+	assert.False(t, ok)
+
+	msg, err = stun.Build(stun.BindingRequest, stun.RawAttribute{
+		Type: stun.AttrPasswordAlgorithms,
+		Value: []byte{
+			0x00, 0x02, 0x00, 0x00, // SHA-256
+			0x00, 0x09, 0x00, 0x01, 0xff, 0x00, 0x00, 0x00, // Unknown, with padded parameters
+			0x00, 0x01, 0x00, 0x00, // MD5
+		},
+	})
+	require.NoError(t, err)
+	algorithms, ok := passwordAlgorithms(msg)
+	assert.True(t, ok)
+	assert.Equal(t, []CredentialAlgorithm{CredentialAlgorithmSHA256, CredentialAlgorithmSHA1}, algorithms)
+}
+
+// countingRefresher is a CredentialRefresher returning user-1, user-2, ...
+type countingRefresher struct {
+	calls atomic.Int32
+	err   error
+}
+
+func (r *countingRefresher) Refresh(context.Context) (string, string, error) {
+	n := r.calls.Add(1)
+	if r.err != nil {
+		return "", "", r.err
+	}
+
+	return fmt.Sprintf("user-%d", n), "pass", nil
+}
+
+// rotatingAuthServer is a TURN server accepting only the current username,
+// rejecting others with 401 and a new nonce. CreatePermission requests for
+// forbidden peers are rejected with 403.
+type rotatingAuthServer struct {
+	conn      net.PacketConn
+	username  atomic.Value // string
+	forbidden net.IP
+}
+
+// forbids reports whether the CreatePermission request req is for the
+// forbidden peer.
+func (s *rotatingAuthServer) forbids(req *stun.Message) bool {
+	var peer proto.PeerAddress
+
+	return peer.GetFrom(req) == nil && peer.IP.Equal(s.forbidden)
+}
+
+func (s *rotatingAuthServer) serve(t *testing.T) {
+	t.Helper()
+
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		req := new(stun.Message)
+		if _, err = req.Write(append([]byte(nil), buf[:n]...)); err != nil {
+			continue
+		}
+
+		resType := stun.NewType(req.Type.Method, stun.ClassErrorResponse)
+		var username stun.Username
+		var attrs []stun.Setter
+		switch {
+		case username.GetFrom(req) != nil || username.String() != s.username.Load().(string): //nolint:forcetypeassert
+			attrs = []stun.Setter{stun.CodeUnauthorized, stun.NewNonce("nonce"), stun.NewRealm("pion.ly")}
+		case stun.NewLongTermIntegrity(username.String(), "pion.ly", "pass").Check(req) != nil:
+			attrs = []stun.Setter{stun.CodeBadRequest}
+		case req.Type.Method == stun.MethodCreatePermission && s.forbids(req):
+			attrs = []stun.Setter{stun.CodeForbidden}
+		case req.Type.Method == stun.MethodAllocate:
+			resType = stun.NewType(stun.MethodAllocate, stun.ClassSuccessResponse)
+			attrs = []stun.Setter{
+				&proto.RelayedAddress{IP: net.IPv4(127, 0, 0, 1), Port: 5000},
+				proto.Lifetime{Duration: time.Minute},
+			}
+		default:
+			resType = stun.NewType(req.Type.Method, stun.ClassSuccessResponse)
+		}
+
+		res, err := stun.Build(buildMsg(req.TransactionID, resType, append(attrs, stun.Fingerprint)...)...)
+		assert.NoError(t, err)
+		_, err = s.conn.WriteTo(res.Raw, from)
+		assert.NoError(t, err)
+	}
+}
+
+func TestClientCredentialRefresher(t *testing.T) {
+	newClient := func(t *testing.T, refresher CredentialRefresher) (*Client, *rotatingAuthServer) {
+		t.Helper()
+
+		serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = serverConn.Close() })
+		server := &rotatingAuthServer{conn: serverConn, forbidden: net.IPv4(10, 0, 0, 66)}
+		server.username.Store("user-1")
+		go server.serve(t)
+
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = conn.Close() })
+
+		turnClient, err := NewClient(&ClientConfig{
+			Conn:           conn,
+			TURNServerAddr: serverConn.LocalAddr().String(),
+			Username:       "expired",
+			Password:       "pass",
+			RTO:            50 * time.Millisecond,
+		}, WithCredentialRefresher(refresher))
+		require.NoError(t, err)
+		require.NoError(t, turnClient.Listen())
+		t.Cleanup(turnClient.Close)
+
+		return turnClient, server
+	}
+	peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+
+	t.Run("rotation", func(t *testing.T) {
+		refresher := &countingRefresher{}
+		turnClient, server := newClient(t, refresher)
+
+		// The configured credentials already expired
+		relayConn, err := turnClient.Allocate()
+		require.NoError(t, err)
+		defer relayConn.Close() //nolint:errcheck
+		assert.Equal(t, int32(1), refresher.calls.Load())
+		assert.Equal(t, "user-1", turnClient.Username().String())
+
+		// The allocation uses the refreshed credentials
+		require.NoError(t, turnClient.CreatePermission(peer))
+		assert.Equal(t, int32(1), refresher.calls.Load())
+
+		// They expire again
+		server.username.Store("user-2")
+		require.NoError(t, turnClient.CreatePermission(peer))
+		assert.Equal(t, int32(2), refresher.calls.Load())
+		require.NoError(t, turnClient.CreatePermission(peer))
+		assert.Equal(t, int32(2), refresher.calls.Load())
+
+		// Other errors do not refresh
+		assert.Error(t, turnClient.CreatePermission(&net.UDPAddr{IP: server.forbidden, Port: 5000}))
+		assert.Equal(t, int32(2), refresher.calls.Load())
+
+		// The request is retried only once
+		server.username.Store("user-9")
+		assert.Error(t, turnClient.CreatePermission(peer))
+		assert.Equal(t, int32(3), refresher.calls.Load())
+	})
+
+	t.Run("refresh fails", func(t *testing.T) {
+		errUnavailable := errors.New("token service unavailable")
+		refresher := &countingRefresher{err: errUnavailable}
+		turnClient, _ := newClient(t, refresher)
+
+		_, err := turnClient.Allocate()
+		assert.ErrorIs(t, err, errCredentialRefreshFailed)
+		assert.ErrorIs(t, err, errUnavailable)
+		assert.Equal(t, int32(1), refresher.calls.Load())
+	})
+}
+
+// realmRefresher is a RealmCredentialRefresher with the credentials
+// <realm>-user and pass of its realms.
+type realmRefresher struct {
+	mutex  sync.Mutex
+	realms []string
+	calls  []string
+}
+
+func (r *realmRefresher) Refresh(context.Context) (string, string, error) {
+	return "", "", ErrUnknownRealm
+}
+
+func (r *realmRefresher) RefreshRealm(_ context.Context, realm string) (string, string, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.calls = append(r.calls, realm)
+	if !slices.Contains(r.realms, realm) {
+		return "", "", ErrUnknownRealm
+	}
+
+	return realm + "-user", "pass", nil
+}
+
+func (r *realmRefresher) refreshed() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]string(nil), r.calls...)
+}
+
+// federatedAuthServer is a TURN server accepting requests signed for a realm
+// with the credentials of realmRefresher, unless redirect returns another
+// realm to authenticate with. Unsigned requests are challenged with the
+// first realm.
+type federatedAuthServer struct {
+	conn     net.PacketConn
+	first    string
+	redirect func(realm string) string
+	requests atomic.Int32
+}
+
+func (s *federatedAuthServer) serve(t *testing.T) {
+	t.Helper()
+
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		req := new(stun.Message)
+		if _, err = req.Write(append([]byte(nil), buf[:n]...)); err != nil || req.Type.Method != stun.MethodAllocate {
+			continue
+		}
+		s.requests.Add(1)
+
+		var realm stun.Realm
+		var username stun.Username
+		challenge := s.first
+		if realm.GetFrom(req) == nil && username.GetFrom(req) == nil {
+			challenge = s.redirect(realm.String())
+			if challenge == "" && stun.NewLongTermIntegrity(username.String(), realm.String(), "pass").Check(req) != nil {
+				challenge = realm.String()
+			}
+		}
+
+		resType := stun.NewType(stun.MethodAllocate, stun.ClassErrorResponse)
+		attrs := []stun.Setter{stun.CodeUnauthorized, stun.NewNonce("nonce"), stun.NewRealm(challenge)}
+		if challenge == "" {
+			resType = stun.NewType(stun.MethodAllocate, stun.ClassSuccessResponse)
+			attrs = []stun.Setter{
+				&proto.RelayedAddress{IP: net.IPv4(127, 0, 0, 1), Port: 5000},
+				proto.Lifetime{Duration: time.Minute},
+			}
+		}
+		res, err := stun.Build(buildMsg(req.TransactionID, resType, append(attrs, stun.Fingerprint)...)...)
+		assert.NoError(t, err)
+		_, err = s.conn.WriteTo(res.Raw, from)
+		assert.NoError(t, err)
+	}
+}
+
+func TestClientRealmChange(t *testing.T) {
+	// allocate allocates with a server redirecting along realms, the last
+	// one accepts the credentials
+	allocate := func(
+		t *testing.T,
+		refresher *realmRefresher,
+		redirect func(realm string) string,
+	) (*Client, *federatedAuthServer, error) {
+		t.Helper()
+
+		serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = serverConn.Close() })
+		server := &federatedAuthServer{conn: serverConn, first: "a.example", redirect: redirect}
+		go server.serve(t)
+
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = conn.Close() })
+
+		turnClient, err := NewClient(&ClientConfig{
+			Conn:           conn,
+			TURNServerAddr: serverConn.LocalAddr().String(),
+			Username:       "a.example-user",
+			Password:       "pass",
+			RTO:            50 * time.Millisecond,
+		}, WithCredentialRefresher(refresher))
+		require.NoError(t, err)
+		require.NoError(t, turnClient.Listen())
+		t.Cleanup(turnClient.Close)
+
+		relayConn, err := turnClient.Allocate()
+		if err == nil {
+			t.Cleanup(func() { _ = relayConn.Close() })
+		}
+
+		return turnClient, server, err
+	}
+	chain := func(realms ...string) func(string) string {
+		return func(realm string) string {
+			if i := slices.Index(realms, realm); i >= 0 && i < len(realms)-1 {
+				return realms[i+1]
+			}
+
+			return ""
+		}
+	}
+
+	t.Run("single change", func(t *testing.T) {
+		refresher := &realmRefresher{realms: []string{"b.example"}}
+		turnClient, server, err := allocate(t, refresher, chain("a.example", "b.example"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"b.example"}, refresher.refreshed())
+		assert.Equal(t, "b.example", turnClient.Realm().String())
+		assert.Equal(t, "b.example-user", turnClient.Username().String())
+		assert.Equal(t, int32(3), server.requests.Load())
+	})
+
+	t.Run("double change", func(t *testing.T) {
+		refresher := &realmRefresher{realms: []string{"b.example", "c.example"}}
+		turnClient, server, err := allocate(t, refresher, chain("a.example", "b.example", "c.example"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"b.example", "c.example"}, refresher.refreshed())
+		assert.Equal(t, "c.example", turnClient.Realm().String())
+		assert.Equal(t, int32(4), server.requests.Load())
+	})
+
+	t.Run("unknown realm", func(t *testing.T) {
+		refresher := &realmRefresher{realms: []string{"b.example"}}
+		_, server, err := allocate(t, refresher, chain("a.example", "b.example", "c.example"))
+		assert.ErrorIs(t, err, ErrUnknownRealm)
+		assert.Equal(t, []string{"b.example", "c.example"}, refresher.refreshed())
+		assert.Equal(t, int32(3), server.requests.Load())
+	})
+
+	t.Run("endless changes", func(t *testing.T) {
+		refresher := &realmRefresher{}
+		var hops atomic.Int32
+		redirect := func(string) string { return fmt.Sprintf("realm-%d.example", hops.Add(1)) }
+		for i := 1; i <= 10; i++ {
+			refresher.realms = append(refresher.realms, fmt.Sprintf("realm-%d.example", i))
+		}
+		_, server, err := allocate(t, refresher, redirect)
+		assert.ErrorIs(t, err, errCredentialsRejected)
+		assert.Len(t, refresher.refreshed(), maxRealmChanges)
+		assert.Equal(t, int32(2+maxRealmChanges), server.requests.Load())
+	})
+}
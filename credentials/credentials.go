@@ -0,0 +1,53 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+// Package credentials implements the time-limited TURN credentials of the
+// TURN REST API, as used by coturn (use-auth-secret), Twilio and Xirsys.
+// See https://datatracker.ietf.org/doc/html/draft-uberti-behave-turn-rest-00.
+//
+// The username is the expiry as a Unix timestamp, optionally followed by a
+// colon and a user id, and the password is base64(HMAC-SHA1(secret, username)).
+package credentials
+
+import (
+	"crypto/hmac"
+	"crypto/sha1" //nolint:gosec,gci
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// now is replaced in tests.
+var now = time.Now //nolint:gochecknoglobals
+
+// GenerateToken returns credentials for username that expire after ttl. An
+// empty username yields a username of just the expiry timestamp.
+func GenerateToken(secret, username string, ttl time.Duration) (user, pass string) {
+	user = strconv.FormatInt(now().Add(ttl).Unix(), 10)
+	if username != "" {
+		user += ":" + username
+	}
+
+	return user, Password(secret, user)
+}
+
+// ValidateToken reports whether password was generated for username with
+// secret and the credentials have not expired yet.
+func ValidateToken(secret, username, password string) bool {
+	timestamp, _, _ := strings.Cut(username, ":")
+	expiry, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || expiry < now().Unix() {
+		return false
+	}
+
+	return hmac.Equal([]byte(Password(secret, username)), []byte(password))
+}
+
+// Password returns the password of username, base64(HMAC-SHA1(secret, username)).
+func Password(secret, username string) string {
+	mac := hmac.New(sha1.New, []byte(secret))
+	_, _ = mac.Write([]byte(username)) // Never fails
+
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,80 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package credentials
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setNow(t *testing.T, at time.Time) {
+	t.Helper()
+
+	now = func() time.Time { return at }
+	t.Cleanup(func() { now = time.Now })
+}
+
+func TestPassword(t *testing.T) {
+	// Generated the way the coturn documentation does:
+	// echo -n "$username" | openssl dgst -binary -sha1 -hmac "$secret" | openssl base64
+	for _, vector := range []struct {
+		secret, username, password string
+	}{
+		{"north", "4102444800:alice", "58Tl4e2VjINId23vxEnD/7NNBaQ="},
+		{"north", "1700000000:bob", "7tNSWpJ3gOxGfEgOjt+kaWhBC20="},
+		{"north", "4102444800", "d0Uryi/l8kTQb5l25d+yiu0DiyI="},
+		{"foobar", "1599491771", "Tpz/nKkyvX/vMSLKvL4sbtBt8Vs="},
+	} {
+		assert.Equal(t, vector.password, Password(vector.secret, vector.username), vector.username)
+	}
+}
+
+func TestGenerateToken(t *testing.T) {
+	setNow(t, time.Unix(4102444800, 0).Add(-time.Hour))
+
+	user, pass := GenerateToken("north", "alice", time.Hour)
+	assert.Equal(t, "4102444800:alice", user)
+	assert.Equal(t, "58Tl4e2VjINId23vxEnD/7NNBaQ=", pass)
+
+	user, pass = GenerateToken("north", "", time.Hour)
+	assert.Equal(t, "4102444800", user)
+	assert.Equal(t, "d0Uryi/l8kTQb5l25d+yiu0DiyI=", pass)
+}
+
+func TestValidateToken(t *testing.T) {
+	expiry := time.Unix(4102444800, 0)
+
+	t.Run("Valid until expiry", func(t *testing.T) {
+		setNow(t, expiry)
+		assert.True(t, ValidateToken("north", "4102444800:alice", "58Tl4e2VjINId23vxEnD/7NNBaQ="))
+		assert.True(t, ValidateToken("north", "4102444800", "d0Uryi/l8kTQb5l25d+yiu0DiyI="))
+	})
+	t.Run("Expired", func(t *testing.T) {
+		setNow(t, expiry.Add(time.Second))
+		assert.False(t, ValidateToken("north", "4102444800:alice", "58Tl4e2VjINId23vxEnD/7NNBaQ="))
+
+		setNow(t, time.Now())
+		user, pass := GenerateToken("north", "alice", -time.Minute)
+		assert.False(t, ValidateToken("north", user, pass))
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		setNow(t, expiry.Add(-time.Hour))
+		for _, test := range []struct {
+			name, secret, username, password string
+		}{
+			{"wrong secret", "south", "4102444800:alice", "58Tl4e2VjINId23vxEnD/7NNBaQ="},
+			{"wrong password", "north", "4102444800:alice", "d0Uryi/l8kTQb5l25d+yiu0DiyI="},
+			{"changed user", "north", "4102444800:mallory", "58Tl4e2VjINId23vxEnD/7NNBaQ="},
+			{"no timestamp", "north", "alice", Password("north", "alice")},
+		} {
+			assert.False(t, ValidateToken(test.secret, test.username, test.password), test.name)
+		}
+	})
+	t.Run("Round trip", func(t *testing.T) {
+		user, pass := GenerateToken("north", "alice", time.Minute)
+		assert.True(t, ValidateToken("north", user, pass))
+	})
+}
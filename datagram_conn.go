@@ -0,0 +1,67 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"net"
+	"time"
+)
+
+// DatagramConn wraps a connected, message oriented net.Conn and implements
+// net.PacketConn. Every Read of the wrapped conn must return exactly one
+// STUN or ChannelData message, so no reframing is done as in STUNConn.
+//
+// Use it as ClientConfig.Conn to run TURN over DTLS as described in RFC 7350,
+// wrapping a *dtls.Conn from github.com/pion/dtls. On the server side a DTLS
+// net.Listener can be passed as ListenerConfig.Listener as is.
+type DatagramConn struct {
+	nextConn net.Conn
+}
+
+// NewDatagramConn creates a DatagramConn.
+func NewDatagramConn(nextConn net.Conn) *DatagramConn {
+	return &DatagramConn{nextConn: nextConn}
+}
+
+// ReadFrom implements ReadFrom from net.PacketConn. The address returned is
+// always the remote address of the wrapped conn.
+func (d *DatagramConn) ReadFrom(payload []byte) (n int, addr net.Addr, err error) {
+	n, err = d.nextConn.Read(payload)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return n, d.nextConn.RemoteAddr(), nil
+}
+
+// WriteTo implements WriteTo from net.PacketConn. The address is ignored,
+// payload is always written to the remote end of the wrapped conn.
+func (d *DatagramConn) WriteTo(payload []byte, _ net.Addr) (n int, err error) {
+	return d.nextConn.Write(payload)
+}
+
+// Close implements Close from net.PacketConn.
+func (d *DatagramConn) Close() error {
+	return d.nextConn.Close()
+}
+
+// LocalAddr implements LocalAddr from net.PacketConn.
+func (d *DatagramConn) LocalAddr() net.Addr {
+	return d.nextConn.LocalAddr()
+}
+
+// SetDeadline implements SetDeadline from net.PacketConn.
+func (d *DatagramConn) SetDeadline(t time.Time) error {
+	return d.nextConn.SetDeadline(t)
+}
+
+// SetReadDeadline implements SetReadDeadline from net.PacketConn.
+func (d *DatagramConn) SetReadDeadline(t time.Time) error {
+	return d.nextConn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline implements SetWriteDeadline from net.PacketConn.
+func (d *DatagramConn) SetWriteDeadline(t time.Time) error {
+	return d.nextConn.SetWriteDeadline(t)
+}
@@ -0,0 +1,131 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package turn
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pion/dtls/v3"
+	"github.com/pion/dtls/v3/pkg/crypto/selfsign"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDatagramConn(t *testing.T) {
+	local, remote := net.Pipe()
+	conn := NewDatagramConn(local)
+	defer conn.Close() //nolint:errcheck
+
+	// Writes go to the remote end whatever the address
+	go func() {
+		_, _ = conn.WriteTo([]byte("foo"), &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1234})
+	}()
+	buf := make([]byte, 16)
+	n, err := remote.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", string(buf[:n]))
+
+	// Reads return one message each, from the remote address
+	go func() {
+		_, _ = remote.Write([]byte("bar"))
+	}()
+	n, addr, err := conn.ReadFrom(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "bar", string(buf[:n]))
+	assert.Equal(t, local.RemoteAddr(), addr)
+	assert.Equal(t, local.LocalAddr(), conn.LocalAddr())
+
+	assert.NoError(t, conn.SetReadDeadline(time.Now().Add(-time.Second)))
+	_, _, err = conn.ReadFrom(buf)
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+
+	assert.NoError(t, conn.SetDeadline(time.Time{}))
+	assert.NoError(t, remote.Close())
+	_, _, err = conn.ReadFrom(buf)
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestDTLSClient(t *testing.T) {
+	certificate, err := selfsign.GenerateSelfSigned()
+	require.NoError(t, err)
+
+	dtlsListener, err := dtls.Listen("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}, &dtls.Config{
+		Certificates: []tls.Certificate{certificate},
+	})
+	require.NoError(t, err)
+
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			return GenerateAuthKey(username, realm, "pass"), true
+		},
+		ListenerConfigs: []ListenerConfig{
+			{
+				Listener: dtlsListener,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "127.0.0.1",
+				},
+			},
+		},
+		Realm: "pion.ly",
+	})
+	require.NoError(t, err)
+
+	serverAddr, ok := dtlsListener.Addr().(*net.UDPAddr)
+	require.True(t, ok)
+	dtlsConn, err := dtls.Dial("udp4", serverAddr, &dtls.Config{
+		InsecureSkipVerify: true, //nolint:gosec
+	})
+	require.NoError(t, err)
+
+	client, err := NewClient(&ClientConfig{
+		Conn:           NewDatagramConn(dtlsConn),
+		TURNServerAddr: serverAddr.String(),
+		Username:       "foo",
+		Password:       "pass",
+	})
+	require.NoError(t, err)
+	require.NoError(t, client.Listen())
+
+	relayConn, err := client.Allocate()
+	require.NoError(t, err)
+
+	peer, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	require.NoError(t, err)
+	defer peer.Close() //nolint:errcheck
+
+	// Relayed traffic travels over DTLS between the client and the server
+	_, err = relayConn.WriteTo([]byte("hello"), peer.LocalAddr())
+	require.NoError(t, err)
+
+	buf := make([]byte, 1600)
+	require.NoError(t, peer.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, from, err := peer.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf[:n]))
+	assert.Equal(t, relayConn.LocalAddr().String(), from.String())
+
+	_, err = peer.WriteTo([]byte("world"), from)
+	require.NoError(t, err)
+
+	require.NoError(t, relayConn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, from, err = relayConn.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "world", string(buf[:n]))
+	assert.Equal(t, peer.LocalAddr().String(), from.String())
+
+	// Shutdown
+	require.NoError(t, relayConn.Close())
+	client.Close()
+	require.NoError(t, dtlsConn.Close())
+	require.NoError(t, server.Close())
+}
@@ -3,7 +3,54 @@
 
 package turn
 
-import "errors"
+import (
+	"errors"
+
+	"github.com/pion/turn/v4/internal/client"
+)
+
+// ErrCircuitOpen is returned by a Client created with WithCircuitBreaker, and
+// by its allocations, instead of sending while the circuit is open.
+var ErrCircuitOpen = client.ErrCircuitOpen
+
+// ErrReconnecting is returned by writes to the relayed conn while
+// Client.Reconnect moves it to a new allocation. The write may be retried.
+var ErrReconnecting = client.ErrReconnecting
+
+// ErrClosing is returned by writes to the relayed conn while its
+// CloseWithDrain sends the writes in progress.
+var ErrClosing = client.ErrClosing
+
+// ErrChannelNotReady is returned by writes to a relayed conn that requires
+// channels when the channel to the peer is not bound in time.
+var ErrChannelNotReady = client.ErrChannelNotReady
+
+// ErrPermissionRateLimited is returned by writes to a relayed conn created
+// with WithPermissionRateLimiter when a new permission is not allowed yet.
+var ErrPermissionRateLimited = client.ErrPermissionRateLimited
+
+// ErrPacketTooLarge is returned by writes to a relayed conn created with
+// WithMaxPacketSize with a payload larger than the maximum, or created with
+// WithICMPListener with a payload that does not fit the path MTU.
+var ErrPacketTooLarge = client.ErrPacketTooLarge
+
+// ErrTransactionCanceled is returned by PerformTransaction when the
+// transaction is aborted with Client.CancelTransaction.
+var ErrTransactionCanceled = client.ErrTransactionCanceled
+
+// ErrAllocationQuotaReached is returned by Allocate and AllocateTCP when the
+// TURN server answers with 486 Allocation Quota Reached, RFC 5766 Section 6.2.
+// The allocation may be retried once another one of the user is released.
+var ErrAllocationQuotaReached = errors.New("TURN server allocation quota reached")
+
+// ErrAllocationExpired is returned by ResumeAllocation when the TURN server
+// no longer holds the allocation, 437 Allocation Mismatch. A new allocation
+// must be made with Allocate.
+var ErrAllocationExpired = errors.New("TURN allocation expired")
+
+// ErrUnknownRealm is returned by a RealmCredentialRefresher that has no
+// credentials for the realm of a TURN server. Allocate fails with it then.
+var ErrUnknownRealm = errors.New("unknown TURN realm")
 
 var (
 	errRelayAddressInvalid           = errors.New("turn: RelayAddress must be valid IP to use RelayAddressGeneratorStatic")
@@ -29,4 +76,36 @@ var (
 	errFailedToDecodeSTUN            = errors.New("failed to decode STUN message")
 	errUnexpectedSTUNRequestMessage  = errors.New("unexpected STUN request message")
 	errRelayAddressGeneratorNil      = errors.New("RelayAddressGenerator is nil")
+	errUnknownCredentialAlgorithm    = errors.New("unsupported credential algorithm")
+	errCredentialAlgorithmMismatch   = errors.New("TURN server does not support the credential algorithm")
+	errCredentialsRejected           = errors.New("TURN server rejected the credentials, check the password and algorithm")
+	errResponseIntegrity             = errors.New("response failed integrity check")
+	errCredentialRefreshFailed       = errors.New("failed to refresh credentials")
+	errInvalidAccessToken            = errors.New("access token must have a key ID, a token and a MAC key")
+	errNoUDPAllocation               = errors.New("no UDP allocation")
+	errNoTCPAllocation               = errors.New("no TCP allocation")
+	errInvalidPeerAddr               = errors.New("peer must be a TCP address")
+	errInvalidRelayedAddr            = errors.New("relayed address must be a UDP address")
+	errInvalidAddressFamily          = errors.New("address family must be RequestedFamilyIPv4 or RequestedFamilyIPv6")
+	errRelayedAddressFamily          = errors.New("TURN server relayed an address of another family")
+	errMigrationFailed               = errors.New("failed to migrate allocation")
+	errReconnectFailed               = errors.New("failed to reconnect allocation")
+	errNegativeRTO                   = errors.New("RTO must not be negative")
+	errNegativeTransactionCacheTTL   = errors.New("turn: TransactionCacheTTL must not be negative")
+	errNegativeRateLimit             = errors.New("turn: RateLimit and RateLimitBurst must not be negative")
+	errNegativeBandwidthQuota        = errors.New("turn: BandwidthQuota must not be negative")
+	errNegativeRetransmitCount       = errors.New("retransmit count must not be negative")
+	errNegativeRetransmitMax         = errors.New("retransmit max must not be negative")
+	errTLSHandshakeFailed            = errors.New("TLS handshake with the TURN server failed")
+	errUnexpectedALPNProtocol        = errors.New("TURN server negotiated an unexpected ALPN protocol")
+	errConnWithTLS                   = errors.New("ClientConfig.Conn must be nil when WithTLS is used")
+	errConnWithWebSocket             = errors.New("ClientConfig.Conn must be nil when WithWebSocket is used")
+	errNoServerAddr                  = errors.New("ClientConfig needs a STUN or TURN server address")
+	errInvalidServerAddr             = errors.New("invalid server address")
+	errMissingUsername               = errors.New("ClientConfig.Password is set without a Username")
+	errMissingPassword               = errors.New("ClientConfig.Username is set without a Password")
+	errRetransmitMaxBelowRTO         = errors.New("retransmit max must not be below the RTO")
+	errUnsupportedClientTransport    = errors.New("unsupported client transport")
+	errTLSConfigWithUDP              = errors.New("ClientConfig.TLSConfig cannot be used with ClientTransportUDP")
+	errTLSWithoutTURNServer          = errors.New("ClientTransportTLS needs ClientConfig.TURNServerAddr")
 )
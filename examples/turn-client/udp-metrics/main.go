@@ -0,0 +1,150 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+// Package main implements a TURN client using UDP that exports the state of
+// its allocation as Prometheus metrics
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/pion/logging"
+	"github.com/pion/turn/v4"
+	"github.com/pion/turn/v4/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// collector adapts metrics.Collector to prometheus.Collector.
+type collector struct {
+	*metrics.Collector
+	descs map[*metrics.Desc]*prometheus.Desc
+}
+
+func newCollector(c *metrics.Collector) *collector {
+	adapter := &collector{Collector: c, descs: map[*metrics.Desc]*prometheus.Desc{}}
+
+	ch := make(chan *metrics.Desc)
+	go func() {
+		c.Describe(ch)
+		close(ch)
+	}()
+	for desc := range ch {
+		adapter.descs[desc] = prometheus.NewDesc(desc.Name, desc.Help, desc.Labels, nil)
+	}
+
+	return adapter
+}
+
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range c.descs {
+		ch <- desc
+	}
+}
+
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	samples := make(chan metrics.Sample)
+	go func() {
+		c.Collector.Collect(samples)
+		close(samples)
+	}()
+	for sample := range samples {
+		valueType := prometheus.CounterValue
+		if sample.Desc.Kind == metrics.Gauge {
+			valueType = prometheus.GaugeValue
+		}
+		ch <- prometheus.MustNewConstMetric(c.descs[sample.Desc], valueType, sample.Value, sample.LabelValues...)
+	}
+}
+
+func main() {
+	host := flag.String("host", "", "TURN Server name.")
+	port := flag.Int("port", 3478, "Listening port.")
+	user := flag.String("user", "", "A pair of username and password (e.g. \"user=pass\")")
+	realm := flag.String("realm", "pion.ly", "Realm (defaults to \"pion.ly\")")
+	metricsAddr := flag.String("metrics", ":9100", "Address to serve /metrics on.")
+	flag.Parse()
+
+	if len(*host) == 0 {
+		log.Fatalf("'host' is required")
+	}
+
+	if len(*user) == 0 {
+		log.Fatalf("'user' is required")
+	}
+
+	cred := strings.SplitN(*user, "=", 2)
+
+	// TURN client won't create a local listening socket by itself.
+	conn, err := net.ListenPacket("udp4", "0.0.0.0:0") // nolint: noctx
+	if err != nil {
+		log.Panicf("Failed to listen: %s", err)
+	}
+	defer func() {
+		if closeErr := conn.Close(); closeErr != nil {
+			log.Panicf("Failed to close connection: %s", closeErr)
+		}
+	}()
+
+	turnServerAddr := fmt.Sprintf("%s:%d", *host, *port)
+
+	client, err := turn.NewClient(&turn.ClientConfig{
+		STUNServerAddr: turnServerAddr,
+		TURNServerAddr: turnServerAddr,
+		Conn:           conn,
+		Username:       cred[0],
+		Password:       cred[1],
+		Realm:          *realm,
+		LoggerFactory:  logging.NewDefaultLoggerFactory(),
+	})
+	if err != nil {
+		log.Panicf("Failed to create TURN client: %s", err)
+	}
+	defer client.Close()
+
+	if err = client.Listen(); err != nil {
+		log.Panicf("Failed to listen: %s", err)
+	}
+
+	relayConn, err := client.Allocate()
+	if err != nil {
+		log.Panicf("Failed to allocate: %s", err)
+	}
+	defer func() {
+		if closeErr := relayConn.Close(); closeErr != nil {
+			log.Panicf("Failed to close connection: %s", closeErr)
+		}
+	}()
+	log.Printf("relayed-address=%s", relayConn.LocalAddr().String())
+
+	// Report the allocation's stats and register them with the default registry
+	turnMetrics := metrics.NewCollector()
+	if err = turnMetrics.Add(relayConn); err != nil {
+		log.Panicf("Failed to collect metrics: %s", err)
+	}
+	defer turnMetrics.Remove(relayConn)
+	prometheus.DefaultRegisterer.MustRegister(newCollector(turnMetrics))
+
+	// Echo everything received on the relayed address back to the sender
+	go func() {
+		buf := make([]byte, 1600)
+		for {
+			n, from, readErr := relayConn.ReadFrom(buf)
+			if readErr != nil {
+				return
+			}
+			if _, readErr = relayConn.WriteTo(buf[:n], from); readErr != nil {
+				return
+			}
+		}
+	}()
+
+	http.Handle("/metrics", promhttp.Handler())
+	log.Printf("Serving metrics on %s/metrics", *metricsAddr)
+	log.Panic(http.ListenAndServe(*metricsAddr, nil)) //nolint:gosec
+}
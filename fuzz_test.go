@@ -0,0 +1,153 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package turn
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4/internal/proto"
+)
+
+// newFuzzClient returns a client with an allocation on a local server and
+// channel 0x4000 bound to peer, so that inbound frames reach the relayed conn.
+func newFuzzClient(f *testing.F, peer net.Addr) (*Client, net.Addr) {
+	f.Helper()
+
+	serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			return GenerateAuthKey(username, realm, "pass"), true
+		},
+		PacketConnConfigs: []PacketConnConfig{
+			{
+				PacketConn: serverConn,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "127.0.0.1",
+				},
+			},
+		},
+		Realm: "pion.ly",
+	})
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	turnClient, err := NewClient(&ClientConfig{
+		Conn:           conn,
+		TURNServerAddr: serverConn.LocalAddr().String(),
+		Username:       "foo",
+		Password:       "pass",
+	})
+	if err != nil {
+		f.Fatal(err)
+	}
+	if err = turnClient.Listen(); err != nil {
+		f.Fatal(err)
+	}
+
+	relayConn, err := turnClient.Allocate()
+	if err != nil {
+		f.Fatal(err)
+	}
+	if _, err = relayConn.WriteTo([]byte("hello"), peer); err != nil {
+		f.Fatal(err)
+	}
+
+	f.Cleanup(func() {
+		_ = relayConn.Close()
+		turnClient.Close()
+		_ = conn.Close()
+		_ = server.Close()
+	})
+
+	return turnClient, serverConn.LocalAddr()
+}
+
+// assertParseError fails if err is neither nil nor one of the errors the
+// inbound parsers are documented to return.
+func assertParseError(t *testing.T, err error) {
+	t.Helper()
+
+	if err == nil {
+		return
+	}
+
+	for _, sentinel := range []error{
+		errFailedToDecodeSTUN,
+		errUnexpectedSTUNRequestMessage,
+		errChannelBindNotFound,
+		proto.ErrInvalidChannelNumber,
+		proto.ErrBadChannelDataLength,
+		io.ErrUnexpectedEOF,
+		stun.ErrAttributeNotFound,
+		stun.ErrAttributeSizeInvalid,
+		stun.ErrAttributeSizeOverflow,
+	} {
+		if errors.Is(err, sentinel) {
+			return
+		}
+	}
+
+	var decodeErr *stun.DecodeErr
+	if errors.As(err, &decodeErr) {
+		return
+	}
+
+	t.Fatalf("unexpected error: %v", err)
+}
+
+func FuzzReadChannelData(f *testing.F) {
+	peer := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5000}
+	turnClient, _ := newFuzzClient(f, peer)
+
+	for _, data := range [][]byte{nil, []byte("hello"), make([]byte, 3)} {
+		chData := &proto.ChannelData{Number: proto.MinChannelNumber, Data: data}
+		chData.Encode()
+		f.Add(chData.Raw)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		assertParseError(t, turnClient.handleChannelData(data))
+	})
+}
+
+func FuzzReadDataIndication(f *testing.F) {
+	peer := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5000}
+	turnClient, serverAddr := newFuzzClient(f, peer)
+
+	for _, data := range [][]byte{nil, []byte("hello")} {
+		msg, err := stun.Build(
+			stun.TransactionID,
+			stun.NewType(stun.MethodData, stun.ClassIndication),
+			proto.PeerAddress{IP: peer.IP, Port: peer.Port},
+			proto.Data(data),
+			stun.Fingerprint,
+		)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(msg.Raw)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		assertParseError(t, turnClient.handleSTUNMessage(data, serverAddr))
+	})
+}
@@ -3,17 +3,18 @@ module github.com/pion/turn/v4
 go 1.21
 
 require (
+	github.com/pion/dtls/v3 v3.0.1
 	github.com/pion/logging v0.2.4
 	github.com/pion/randutil v0.1.0
 	github.com/pion/stun/v3 v3.0.0
 	github.com/pion/transport/v3 v3.0.8
 	github.com/stretchr/testify v1.11.1
+	golang.org/x/net v0.34.0
 	golang.org/x/sys v0.30.0
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/pion/dtls/v3 v3.0.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/wlynxg/anet v0.0.5 // indirect
 	golang.org/x/crypto v0.32.0 // indirect
@@ -0,0 +1,206 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+// Package ice turns TURN allocations into ICE relay candidates (RFC 8445),
+// so that ICE implementations do not have to derive candidate fields from
+// the allocation themselves.
+package ice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"net"
+	"strconv"
+	"strings"
+)
+
+var (
+	errNotRelayConn     = errors.New("ice: conn is not a TURN allocation")
+	errInvalidComponent = errors.New("ice: component ID must be in [1, 256]")
+	errNotUDPAddr       = errors.New("ice: relayed address is not a UDP address")
+)
+
+// CandidateType is the type of an ICE candidate, RFC 8445 Section 4.
+type CandidateType int
+
+const (
+	// CandidateHost is a candidate on a local interface.
+	CandidateHost CandidateType = iota
+	// CandidateServerReflexive is a candidate learned from a STUN or TURN server.
+	CandidateServerReflexive
+	// CandidatePeerReflexive is a candidate learned from a connectivity check.
+	CandidatePeerReflexive
+	// CandidateRelay is a candidate on a TURN server.
+	CandidateRelay
+)
+
+func (t CandidateType) String() string {
+	switch t {
+	case CandidateHost:
+		return "host"
+	case CandidateServerReflexive:
+		return "srflx"
+	case CandidatePeerReflexive:
+		return "prflx"
+	case CandidateRelay:
+		return "relay"
+	default:
+		return "unknown"
+	}
+}
+
+// Preference returns the type preference recommended by RFC 8445
+// Section 5.1.2.2.
+func (t CandidateType) Preference() uint32 {
+	switch t {
+	case CandidateHost:
+		return 126
+	case CandidatePeerReflexive:
+		return 110
+	case CandidateServerReflexive:
+		return 100
+	default:
+		return 0
+	}
+}
+
+// DefaultLocalPreference is the local preference of a candidate of a host
+// with a single IP address, RFC 8445 Section 5.1.2.2.
+const DefaultLocalPreference = 65535
+
+// Priority computes the priority of a candidate, RFC 8445 Section 5.1.2.1.
+func Priority(typ CandidateType, localPreference uint16, component uint16) uint32 {
+	return (1<<24)*typ.Preference() + (1<<8)*uint32(localPreference) + 256 - uint32(component)
+}
+
+// Foundation returns the foundation of a candidate, which is the same for
+// candidates of the same type, base IP address, STUN or TURN server IP
+// address and transport protocol, RFC 8445 Section 5.1.1.3.
+func Foundation(typ CandidateType, baseIP, serverIP net.IP, protocol string) string {
+	key := strings.Join([]string{typ.String(), baseIP.String(), serverIP.String(), protocol}, "/")
+
+	return strconv.FormatUint(uint64(crc32.ChecksumIEEE([]byte(key))), 10)
+}
+
+// Candidate is an ICE candidate.
+type Candidate struct {
+	Foundation string
+	Component  uint16
+	Protocol   string
+	Priority   uint32
+	Address    net.IP
+	Port       int
+	Type       CandidateType
+
+	// RelatedAddress and RelatedPort are the server reflexive address of a
+	// relay candidate, unset if unknown.
+	RelatedAddress net.IP
+	RelatedPort    int
+}
+
+// String returns the candidate as an SDP candidate attribute value,
+// RFC 8839 Section 5.1.
+func (c Candidate) String() string {
+	s := fmt.Sprintf("%s %d %s %d %s %d typ %s",
+		c.Foundation, c.Component, c.Protocol, c.Priority, c.Address, c.Port, c.Type)
+	if c.RelatedAddress != nil {
+		s += fmt.Sprintf(" raddr %s rport %d", c.RelatedAddress, c.RelatedPort)
+	}
+
+	return s
+}
+
+// Option customizes the candidate returned by GatherRelayCandidate.
+type Option func(*gatherConfig) error
+
+type gatherConfig struct {
+	component       uint16
+	localPreference uint16
+}
+
+// WithComponent sets the component ID of the candidate, e.g. 2 for RTCP.
+// The default is 1.
+func WithComponent(component uint16) Option {
+	return func(c *gatherConfig) error {
+		if component < 1 || component > 256 {
+			return errInvalidComponent
+		}
+		c.component = component
+
+		return nil
+	}
+}
+
+// WithLocalPreference sets the local preference of the candidate, e.g. to
+// rank allocations on several TURN servers. The default is
+// DefaultLocalPreference.
+func WithLocalPreference(preference uint16) Option {
+	return func(c *gatherConfig) error {
+		c.localPreference = preference
+
+		return nil
+	}
+}
+
+// ipOf returns the IP address of addr, nil if it has none.
+func ipOf(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP
+	case *net.TCPAddr:
+		return a.IP
+	default:
+		return nil
+	}
+}
+
+type relayConn interface {
+	LocalAddr() net.Addr
+	MappedAddr() net.Addr
+	ServerAddr() net.Addr
+}
+
+// GatherRelayCandidate returns the relay candidate of conn, a UDP allocation
+// returned by turn.Client.Allocate. Its related address is the server
+// reflexive address the TURN server reported, if any.
+func GatherRelayCandidate(ctx context.Context, conn net.PacketConn, opts ...Option) (Candidate, error) {
+	if err := ctx.Err(); err != nil {
+		return Candidate{}, err
+	}
+
+	relay, ok := conn.(relayConn)
+	if !ok {
+		return Candidate{}, errNotRelayConn
+	}
+
+	config := gatherConfig{component: 1, localPreference: DefaultLocalPreference}
+	for _, opt := range opts {
+		if err := opt(&config); err != nil {
+			return Candidate{}, err
+		}
+	}
+
+	relayed, ok := relay.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return Candidate{}, errNotUDPAddr
+	}
+
+	// The base of a relay candidate is the candidate itself, RFC 8445 Section 5.1.1.2.
+	candidate := Candidate{
+		Foundation: Foundation(CandidateRelay, relayed.IP, ipOf(relay.ServerAddr()), "udp"),
+		Component:  config.component,
+		Protocol:   "udp",
+		Priority:   Priority(CandidateRelay, config.localPreference, config.component),
+		Address:    relayed.IP,
+		Port:       relayed.Port,
+		Type:       CandidateRelay,
+	}
+	if mapped, ok := relay.MappedAddr().(*net.UDPAddr); ok {
+		candidate.RelatedAddress = mapped.IP
+		candidate.RelatedPort = mapped.Port
+	}
+
+	return candidate, nil
+}
@@ -0,0 +1,109 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package ice
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeRelayConn struct {
+	net.PacketConn
+	relayed, mapped, server net.Addr
+}
+
+func (c *fakeRelayConn) LocalAddr() net.Addr  { return c.relayed }
+func (c *fakeRelayConn) MappedAddr() net.Addr { return c.mapped }
+func (c *fakeRelayConn) ServerAddr() net.Addr { return c.server }
+
+func TestPriority(t *testing.T) {
+	// (2^24)*type preference + (2^8)*local preference + (256 - component ID)
+	assert.Equal(t, uint32(0xffff<<8+255), Priority(CandidateRelay, DefaultLocalPreference, 1))
+	assert.Equal(t, uint32(0xffff<<8+254), Priority(CandidateRelay, DefaultLocalPreference, 2))
+	assert.Equal(t, uint32(126<<24+10<<8+255), Priority(CandidateHost, 10, 1))
+	assert.Equal(t, uint32(100<<24+255), Priority(CandidateServerReflexive, 0, 1))
+	assert.Equal(t, uint32(110<<24), Priority(CandidatePeerReflexive, 0, 256))
+
+	assert.Greater(t, Priority(CandidateHost, 0, 1), Priority(CandidatePeerReflexive, DefaultLocalPreference, 1))
+	assert.Greater(t, Priority(CandidateServerReflexive, 0, 1), Priority(CandidateRelay, DefaultLocalPreference, 1))
+}
+
+func TestFoundation(t *testing.T) {
+	relayIP, serverIP := net.ParseIP("203.0.113.1"), net.ParseIP("198.51.100.1")
+	foundation := Foundation(CandidateRelay, relayIP, serverIP, "udp")
+
+	assert.Equal(t, foundation, Foundation(CandidateRelay, net.ParseIP("203.0.113.1"), serverIP, "udp"),
+		"same type, base, server and protocol should share the foundation")
+	for _, other := range []string{
+		Foundation(CandidateServerReflexive, relayIP, serverIP, "udp"),
+		Foundation(CandidateRelay, net.ParseIP("203.0.113.2"), serverIP, "udp"),
+		Foundation(CandidateRelay, relayIP, net.ParseIP("198.51.100.2"), "udp"),
+		Foundation(CandidateRelay, relayIP, serverIP, "tcp"),
+	} {
+		assert.NotEqual(t, foundation, other)
+	}
+	assert.LessOrEqual(t, len(foundation), 32, "foundations are at most 32 characters")
+}
+
+func TestGatherRelayCandidate(t *testing.T) {
+	conn := &fakeRelayConn{
+		relayed: &net.UDPAddr{IP: net.ParseIP("203.0.113.1"), Port: 50000},
+		mapped:  &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 40000},
+		server:  &net.UDPAddr{IP: net.ParseIP("198.51.100.1"), Port: 3478},
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		candidate, err := GatherRelayCandidate(context.Background(), conn)
+		assert.NoError(t, err)
+		assert.Equal(t, Candidate{
+			Foundation:     Foundation(CandidateRelay, net.ParseIP("203.0.113.1"), net.ParseIP("198.51.100.1"), "udp"),
+			Component:      1,
+			Protocol:       "udp",
+			Priority:       Priority(CandidateRelay, DefaultLocalPreference, 1),
+			Address:        net.ParseIP("203.0.113.1"),
+			Port:           50000,
+			Type:           CandidateRelay,
+			RelatedAddress: net.ParseIP("192.0.2.1"),
+			RelatedPort:    40000,
+		}, candidate)
+		assert.Equal(t, candidate.Foundation+" 1 udp 16777215 203.0.113.1 50000 typ relay raddr 192.0.2.1 rport 40000",
+			candidate.String())
+	})
+
+	t.Run("options", func(t *testing.T) {
+		candidate, err := GatherRelayCandidate(context.Background(), conn, WithComponent(2), WithLocalPreference(10))
+		assert.NoError(t, err)
+		assert.Equal(t, uint16(2), candidate.Component)
+		assert.Equal(t, Priority(CandidateRelay, 10, 2), candidate.Priority)
+
+		_, err = GatherRelayCandidate(context.Background(), conn, WithComponent(0))
+		assert.ErrorIs(t, err, errInvalidComponent)
+	})
+
+	t.Run("without mapped address", func(t *testing.T) {
+		candidate, err := GatherRelayCandidate(context.Background(), &fakeRelayConn{
+			relayed: conn.relayed,
+			server:  conn.server,
+		})
+		assert.NoError(t, err)
+		assert.Nil(t, candidate.RelatedAddress)
+		assert.NotContains(t, candidate.String(), "raddr")
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		pc, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		assert.NoError(t, err)
+		defer pc.Close() //nolint:errcheck
+		_, err = GatherRelayCandidate(context.Background(), pc)
+		assert.ErrorIs(t, err, errNotRelayConn)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = GatherRelayCandidate(ctx, conn)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
@@ -0,0 +1,133 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build integration && !js
+// +build integration,!js
+
+package turn
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/turn/v4/internal/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startEchoServer echoes every packet back to its sender until conn is closed.
+func startEchoServer(t *testing.T) net.PacketConn {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	go func() {
+		buf := make([]byte, 1600)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if _, err = conn.WriteTo(buf[:n], from); err != nil {
+				return
+			}
+		}
+	}()
+
+	return conn
+}
+
+// Run with: go test -tags integration -run TestIntegration .
+func TestIntegrationUDPConnSendPath(t *testing.T) {
+	serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	require.NoError(t, err)
+
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			return GenerateAuthKey(username, realm, "pass"), true
+		},
+		PacketConnConfigs: []PacketConnConfig{
+			{
+				PacketConn: serverConn,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "127.0.0.1",
+				},
+			},
+		},
+		Realm: "pion.ly",
+	})
+	require.NoError(t, err)
+	defer server.Close() //nolint:errcheck
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	require.NoError(t, err)
+	defer conn.Close() //nolint:errcheck
+	recorder := &inboundRecorder{PacketConn: conn}
+
+	turnClient, err := NewClient(&ClientConfig{
+		Conn:           recorder,
+		TURNServerAddr: serverConn.LocalAddr().String(),
+		Username:       "foo",
+		Password:       "pass",
+	})
+	require.NoError(t, err)
+	require.NoError(t, turnClient.Listen())
+	defer turnClient.Close()
+
+	relayConn, err := turnClient.Allocate()
+	require.NoError(t, err)
+	defer relayConn.Close() //nolint:errcheck
+	udpConn, ok := relayConn.(*client.UDPConn)
+	require.True(t, ok)
+
+	echo := startEchoServer(t)
+
+	// roundTrip sends payload to the echo server through the relay and reads
+	// the echo back, skipping echoes of earlier writes.
+	roundTrip := func(payload string) {
+		t.Helper()
+
+		_, err := relayConn.WriteTo([]byte(payload), echo.LocalAddr())
+		require.NoError(t, err)
+
+		buf := make([]byte, 1600)
+		require.NoError(t, relayConn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		for {
+			n, from, err := relayConn.ReadFrom(buf)
+			require.NoError(t, err)
+			if string(buf[:n]) != payload {
+				continue
+			}
+			assert.Equal(t, echo.LocalAddr().String(), from.String(), "echo server should be the source")
+
+			return
+		}
+	}
+
+	// The first write creates a permission and goes out as a Send indication
+	// while the channel is being bound
+	roundTrip("hello")
+	assert.Equal(t, uint64(1), udpConn.Stats().Permissions)
+	assert.Equal(t, uint64(1), udpConn.Stats().IndicationSends)
+
+	// Once the channel is bound both directions use ChannelData
+	assert.Eventually(t, func() bool {
+		return udpConn.Stats().Bindings.Ready == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	sends := udpConn.Stats().ChannelSends
+	for i := 0; i < 10; i++ {
+		roundTrip(fmt.Sprintf("via channel %d", i))
+	}
+	assert.Equal(t, sends+10, udpConn.Stats().ChannelSends)
+	assert.Equal(t, "ChannelData", recorder.lastFraming())
+
+	stats := udpConn.Stats()
+	assert.Zero(t, stats.BindingErrors)
+	assert.Zero(t, stats.PermissionErrors)
+	assert.Equal(t, stats.BytesSent, stats.BytesReceived, "everything sent should be echoed")
+}
@@ -5,6 +5,7 @@
 package allocation
 
 import (
+	"fmt"
 	"net"
 	"sync"
 	"sync/atomic"
@@ -38,6 +39,7 @@ type Allocation struct {
 	username, realm     string
 	eventHandler        EventHandler
 	log                 logging.LeveledLogger
+	bandwidth           bandwidthQuota
 
 	// Some clients (Firefox or others using resiprocate's nICE lib) may retry allocation
 	// with same 5 tuple when received 413, for compatible with these clients,
@@ -52,8 +54,9 @@ func NewAllocation(
 	fiveTuple *FiveTuple,
 	eventHandler EventHandler,
 	log logging.LeveledLogger,
+	opts ...Option,
 ) *Allocation {
-	return &Allocation{
+	alloc := &Allocation{
 		TurnSocket:   turnSocket,
 		fiveTuple:    fiveTuple,
 		permissions:  make(map[string]*Permission, 64),
@@ -61,6 +64,11 @@ func NewAllocation(
 		eventHandler: eventHandler,
 		log:          log,
 	}
+	for _, opt := range opts {
+		opt(alloc)
+	}
+
+	return alloc
 }
 
 // GetPermission gets the Permission from the allocation.
@@ -248,6 +256,24 @@ func (a *Allocation) GetResponseCache() (id [stun.TransactionIDSize]byte, attrs
 	return
 }
 
+// Relay sends data received from the client on to peer through the relayed
+// transport address. Only peers the allocation has a permission for are
+// relayed to, see RFC 5766 Section 10.2 and 11.6.
+func (a *Allocation) Relay(data []byte, peer net.Addr) error {
+	if perm := a.GetPermission(peer); perm == nil {
+		return fmt.Errorf("%w: %v", errNoPermission, peer)
+	}
+
+	n, err := a.RelaySocket.WriteTo(data, peer)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errFailedWriteSocket, err.Error())
+	} else if n != len(data) {
+		return fmt.Errorf("%w %d != %d (expected)", errShortWrite, n, len(data))
+	}
+
+	return nil
+}
+
 // Close closes the allocation.
 func (a *Allocation) Close() error {
 	select {
@@ -311,6 +337,11 @@ func (a *Allocation) packetHandler(manager *Manager) {
 			srcAddr)
 
 		if channel := a.GetChannelByAddr(srcAddr); channel != nil { // nolint:nestif
+			if !a.bandwidth.allow(n) {
+				a.log.Debugf("Dropping %d bytes from %v over the bandwidth quota of allocation %v", n, srcAddr, a.RelayAddr)
+
+				continue
+			}
 			channelData := &proto.ChannelData{
 				Data:   buffer[:n],
 				Number: channel.Number,
@@ -327,6 +358,11 @@ func (a *Allocation) packetHandler(manager *Manager) {
 
 				return
 			}
+			if !a.bandwidth.allow(n) {
+				a.log.Debugf("Dropping %d bytes from %v over the bandwidth quota of allocation %v", n, srcAddr, a.RelayAddr)
+
+				continue
+			}
 
 			peerAddressAttr := proto.PeerAddress{IP: udpAddr.IP, Port: udpAddr.Port}
 			dataAttr := proto.Data(buffer[:n])
@@ -19,6 +19,10 @@ type ManagerConfig struct {
 	AllocateConn       func(network string, requestedPort int) (net.Conn, net.Addr, error)
 	PermissionHandler  func(sourceAddr net.Addr, peerIP net.IP) bool
 	EventHandler       EventHandler
+
+	// BandwidthQuota limits the bytes per second each allocation relays to
+	// its client, zero means no limit.
+	BandwidthQuota int64
 }
 
 type reservation struct {
@@ -37,6 +41,7 @@ type Manager struct {
 	allocatePacketConn func(network string, requestedPort int) (net.PacketConn, net.Addr, error)
 	allocateConn       func(network string, requestedPort int) (net.Conn, net.Addr, error)
 	permissionHandler  func(sourceAddr net.Addr, peerIP net.IP) bool
+	bandwidthQuota     int64
 	EventHandler       EventHandler
 }
 
@@ -57,6 +62,7 @@ func NewManager(config ManagerConfig) (*Manager, error) {
 		allocatePacketConn: config.AllocatePacketConn,
 		allocateConn:       config.AllocateConn,
 		permissionHandler:  config.PermissionHandler,
+		bandwidthQuota:     config.BandwidthQuota,
 		EventHandler:       config.EventHandler,
 	}, nil
 }
@@ -77,6 +83,20 @@ func (m *Manager) AllocationCount() int {
 	return len(m.allocations)
 }
 
+// BandwidthUsage returns the bandwidth usage of each allocation, in no
+// particular order.
+func (m *Manager) BandwidthUsage() []BandwidthUsage {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	usage := make([]BandwidthUsage, 0, len(m.allocations))
+	for _, a := range m.allocations {
+		usage = append(usage, a.BandwidthUsage())
+	}
+
+	return usage
+}
+
 // Close closes the manager and closes all allocations it manages.
 func (m *Manager) Close() error {
 	m.lock.Lock()
@@ -115,7 +135,11 @@ func (m *Manager) CreateAllocation(
 	if alloc := m.GetAllocation(fiveTuple); alloc != nil {
 		return nil, fmt.Errorf("%w: %v", errDupeFiveTuple, fiveTuple)
 	}
-	alloc := NewAllocation(turnSocket, fiveTuple, m.EventHandler, m.log)
+	var opts []Option
+	if m.bandwidthQuota > 0 {
+		opts = append(opts, BandwidthQuota(m.bandwidthQuota))
+	}
+	alloc := NewAllocation(turnSocket, fiveTuple, m.EventHandler, m.log, opts...)
 	alloc.username = username
 	alloc.realm = realm
 
@@ -34,6 +34,7 @@ func TestAllocation(t *testing.T) {
 		{"Refresh", subTestAllocationRefresh},
 		{"Close", subTestAllocationClose},
 		{"packetHandler", subTestPacketHandler},
+		{"Relay", subTestRelay},
 		{"ResponseCache", subTestResponseCache},
 	}
 
@@ -342,6 +343,62 @@ func subTestPacketHandler(t *testing.T) {
 	_ = peerListener2.Close()
 }
 
+func subTestRelay(t *testing.T) {
+	t.Helper()
+
+	manager, _ := newTestManager()
+	defer manager.Close() //nolint:errcheck
+
+	turnSocket, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	assert.NoError(t, err)
+
+	clientListener, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	assert.NoError(t, err)
+	defer clientListener.Close() //nolint:errcheck
+
+	peerListener, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	assert.NoError(t, err)
+	defer peerListener.Close() //nolint:errcheck
+
+	alloc, err := manager.CreateAllocation(&FiveTuple{
+		SrcAddr: clientListener.LocalAddr(),
+		DstAddr: turnSocket.LocalAddr(),
+	}, turnSocket, 0, proto.DefaultLifetime, "", "")
+	assert.NoError(t, err)
+
+	buffer := make([]byte, rtpMTU)
+
+	// Peers without a permission are not relayed to
+	err = alloc.Relay([]byte("denied"), peerListener.LocalAddr())
+	assert.ErrorIs(t, err, errNoPermission)
+
+	// Client to peer
+	alloc.AddPermission(NewPermission(peerListener.LocalAddr(), manager.log))
+	assert.NoError(t, alloc.Relay([]byte("to peer"), peerListener.LocalAddr()))
+	n, from, err := peerListener.ReadFrom(buffer)
+	assert.NoError(t, err)
+	assert.Equal(t, "to peer", string(buffer[:n]))
+	_, relayPort, _ := ipnet.AddrIPPort(alloc.RelaySocket.LocalAddr())
+	_, fromPort, _ := ipnet.AddrIPPort(from)
+	assert.Equal(t, relayPort, fromPort, "should be sent from the relayed address")
+
+	// Peer to client, back through the relayed address
+	_, err = peerListener.WriteTo([]byte("to client"), from)
+	assert.NoError(t, err)
+	n, _, err = clientListener.ReadFrom(buffer)
+	assert.NoError(t, err)
+	var msg stun.Message
+	assert.NoError(t, stun.Decode(buffer[:n], &msg))
+	var msgData proto.Data
+	assert.NoError(t, msgData.GetFrom(&msg))
+	assert.Equal(t, "to client", string(msgData))
+
+	// Closed allocations can no longer relay
+	assert.NoError(t, alloc.Close())
+	err = alloc.Relay([]byte("closed"), peerListener.LocalAddr())
+	assert.Error(t, err)
+}
+
 func subTestResponseCache(t *testing.T) {
 	t.Helper()
 
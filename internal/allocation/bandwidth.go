@@ -0,0 +1,106 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package allocation
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// Option configures an Allocation created by NewAllocation.
+type Option func(*Allocation)
+
+// BandwidthQuota limits the data relayed to the client to bytesPerSecond
+// bytes in each second. ChannelData and Data indications over the limit are
+// dropped and counted in BandwidthUsage.
+func BandwidthQuota(bytesPerSecond int64) Option {
+	return func(a *Allocation) {
+		a.bandwidth.limit = bytesPerSecond
+	}
+}
+
+// BandwidthUsage describes the data an allocation relayed to its client.
+type BandwidthUsage struct {
+	ClientAddr net.Addr
+	RelayAddr  net.Addr
+	Username   string
+
+	// Quota is the bytes per second limit, zero if there is none.
+	Quota int64
+	// CurrentBytes are the bytes relayed in the current second.
+	CurrentBytes int64
+	// RelayedBytes are all bytes relayed to the client.
+	RelayedBytes uint64
+	// DroppedPackets and DroppedBytes count the data dropped for exceeding
+	// the quota.
+	DroppedPackets uint64
+	DroppedBytes   uint64
+}
+
+// bandwidthQuota counts the bytes relayed in fixed one second windows.
+type bandwidthQuota struct {
+	limit          int64 // Read-only, zero if unlimited
+	now            func() time.Time
+	mutex          sync.Mutex
+	windowStart    time.Time
+	windowBytes    int64
+	relayedBytes   uint64
+	droppedPackets uint64
+	droppedBytes   uint64
+}
+
+// allow counts n bytes to be relayed, and reports false if they exceed the
+// limit of the current second. Dropped bytes do not count against the limit.
+func (q *bandwidthQuota) allow(n int) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.resetWindow()
+	if q.limit > 0 && q.windowBytes+int64(n) > q.limit {
+		q.droppedPackets++
+		q.droppedBytes += uint64(n) // nolint:gosec // G115
+
+		return false
+	}
+	q.windowBytes += int64(n)
+	q.relayedBytes += uint64(n) // nolint:gosec // G115
+
+	return true
+}
+
+// resetWindow starts a new window if the current one is over.
+func (q *bandwidthQuota) resetWindow() {
+	now := time.Now()
+	if q.now != nil {
+		now = q.now()
+	}
+	if now.Sub(q.windowStart) >= time.Second {
+		q.windowStart = now
+		q.windowBytes = 0
+	}
+}
+
+// BandwidthUsage returns the data relayed to the client so far.
+func (a *Allocation) BandwidthUsage() BandwidthUsage {
+	q := &a.bandwidth
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.resetWindow()
+	usage := BandwidthUsage{
+		RelayAddr:      a.RelayAddr,
+		Username:       a.username,
+		Quota:          q.limit,
+		CurrentBytes:   q.windowBytes,
+		RelayedBytes:   q.relayedBytes,
+		DroppedPackets: q.droppedPackets,
+		DroppedBytes:   q.droppedBytes,
+	}
+	if a.fiveTuple != nil {
+		usage.ClientAddr = a.fiveTuple.SrcAddr
+	}
+
+	return usage
+}
@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package allocation
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/turn/v4/internal/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBandwidthQuota(t *testing.T) {
+	t.Run("Window", func(t *testing.T) {
+		now := time.Unix(1000, 0)
+		alloc := NewAllocation(nil, nil, EventHandler{}, nil, BandwidthQuota(100))
+		alloc.bandwidth.now = func() time.Time { return now }
+
+		// Below the quota
+		assert.True(t, alloc.bandwidth.allow(60))
+		assert.True(t, alloc.bandwidth.allow(40))
+
+		// Above it, a smaller packet may still fit
+		assert.False(t, alloc.bandwidth.allow(1))
+		now = now.Add(999 * time.Millisecond)
+		assert.False(t, alloc.bandwidth.allow(50))
+
+		usage := alloc.BandwidthUsage()
+		assert.Equal(t, int64(100), usage.Quota)
+		assert.Equal(t, int64(100), usage.CurrentBytes)
+		assert.Equal(t, uint64(100), usage.RelayedBytes)
+		assert.Equal(t, uint64(2), usage.DroppedPackets)
+		assert.Equal(t, uint64(51), usage.DroppedBytes)
+
+		// The next second starts over
+		now = now.Add(time.Millisecond)
+		assert.Equal(t, int64(0), alloc.BandwidthUsage().CurrentBytes)
+		assert.True(t, alloc.bandwidth.allow(100))
+		assert.False(t, alloc.bandwidth.allow(1))
+	})
+
+	t.Run("Unlimited", func(t *testing.T) {
+		alloc := NewAllocation(nil, nil, EventHandler{}, nil)
+		for i := 0; i < 100; i++ {
+			assert.True(t, alloc.bandwidth.allow(1500))
+		}
+		usage := alloc.BandwidthUsage()
+		assert.Equal(t, int64(0), usage.Quota)
+		assert.Equal(t, uint64(150000), usage.RelayedBytes)
+		assert.Equal(t, uint64(0), usage.DroppedPackets)
+	})
+
+	t.Run("packetHandler", func(t *testing.T) {
+		manager, err := newTestManager()
+		assert.NoError(t, err)
+		manager.bandwidthQuota = 100
+		defer manager.Close() //nolint:errcheck
+
+		turnSocket, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		assert.NoError(t, err)
+		defer turnSocket.Close() //nolint:errcheck
+
+		clientListener, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		assert.NoError(t, err)
+		defer clientListener.Close() //nolint:errcheck
+
+		alloc, err := manager.CreateAllocation(&FiveTuple{
+			SrcAddr: clientListener.LocalAddr(),
+			DstAddr: turnSocket.LocalAddr(),
+		}, turnSocket, 0, proto.DefaultLifetime, "user", "")
+		assert.NoError(t, err)
+
+		peer, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		assert.NoError(t, err)
+		defer peer.Close() //nolint:errcheck
+		alloc.AddPermission(NewPermission(peer.LocalAddr(), manager.log))
+		_ = alloc.AddChannelBind(NewChannelBind(proto.MinChannelNumber, peer.LocalAddr(), manager.log), proto.DefaultLifetime)
+
+		relayAddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: alloc.RelaySocket.LocalAddr().(*net.UDPAddr).Port}
+		for i := 0; i < 5; i++ {
+			_, err = peer.WriteTo(make([]byte, 40), relayAddr)
+			assert.NoError(t, err)
+		}
+
+		// Five 40 byte packets within a second exceed the quota of 100 bytes
+		assert.Eventually(t, func() bool {
+			usage := alloc.BandwidthUsage()
+
+			return usage.RelayedBytes+usage.DroppedBytes == 200
+		}, time.Second, time.Millisecond)
+		usage := manager.BandwidthUsage()
+		assert.Len(t, usage, 1)
+		assert.Equal(t, uint64(80), usage[0].RelayedBytes)
+		assert.Equal(t, uint64(3), usage[0].DroppedPackets)
+		assert.Equal(t, "user", usage[0].Username)
+		assert.Equal(t, clientListener.LocalAddr(), usage[0].ClientAddr)
+
+		buf := make([]byte, rtpMTU)
+		for i := 0; i < 2; i++ {
+			assert.NoError(t, clientListener.SetReadDeadline(time.Now().Add(time.Second)))
+			n, _, err := clientListener.ReadFrom(buf)
+			assert.NoError(t, err)
+			assert.True(t, proto.IsChannelData(buf[:n]))
+		}
+	})
+}
@@ -19,4 +19,7 @@ var (
 	errFailedToCastUDPAddr         = errors.New("failed to cast net.Addr to *net.UDPAddr")
 	errFailedToAllocateEvenPort    = errors.New("failed to allocate an even port")
 	errAdminProhibited             = errors.New("permission request administratively prohibited")
+	errNoPermission                = errors.New("no permission for peer")
+	errShortWrite                  = errors.New("packet write smaller than packet")
+	errFailedWriteSocket           = errors.New("failed writing to socket")
 )
@@ -4,10 +4,13 @@
 package client
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pion/logging"
@@ -20,62 +23,182 @@ import (
 type AllocationConfig struct {
 	Client      Client
 	RelayedAddr net.Addr
+	MappedAddr  net.Addr // Server reflexive address from the Allocate response, may be nil
 	ServerAddr  net.Addr
-	Integrity   stun.MessageIntegrity
+	Integrity   proto.Integrity // stun.MessageIntegrity or proto.MessageIntegritySHA256
 	Nonce       stun.Nonce
 	Username    stun.Username
 	Realm       stun.Realm
 	Lifetime    time.Duration
 	Net         transport.Net
 	Log         logging.LeveledLogger
+	Software    stun.Software // Added to every request unless empty
+
+	// MobilityTicket returned by the server in the Allocate response, RFC 8016.
+	// If empty the allocation cannot be migrated.
+	MobilityTicket proto.MobilityTicket
+
+	// AddressFamily of the relayed address. If zero it is derived from RelayedAddr.
+	AddressFamily proto.RequestedAddressFamily
+
+	// Trace is called on the events of the allocation, may be nil.
+	Trace *ClientTrace
+}
+
+// integrity returns the configured message integrity, an empty
+// MESSAGE-INTEGRITY key if none is set.
+func (c *AllocationConfig) integrity() proto.Integrity {
+	if c.Integrity == nil {
+		return stun.MessageIntegrity(nil)
+	}
+
+	return c.Integrity
+}
+
+// optionalSoftware is a SOFTWARE attribute that is omitted when empty.
+type optionalSoftware stun.Software
+
+// AddTo adds SOFTWARE to the message unless it is empty.
+func (s optionalSoftware) AddTo(m *stun.Message) error {
+	if len(s) == 0 {
+		return nil
+	}
+
+	return stun.Software(s).AddTo(m)
+}
+
+// optionalRealm is a REALM attribute that is omitted when empty, as with
+// short-term credentials.
+type optionalRealm stun.Realm
+
+// AddTo adds REALM to the message unless it is empty.
+func (r optionalRealm) AddTo(m *stun.Message) error {
+	if len(r) == 0 {
+		return nil
+	}
+
+	return stun.Realm(r).AddTo(m)
+}
+
+// optionalNonce is a NONCE attribute that is omitted when empty, as with
+// short-term credentials.
+type optionalNonce stun.Nonce
+
+// AddTo adds NONCE to the message unless it is empty.
+func (n optionalNonce) AddTo(m *stun.Message) error {
+	if len(n) == 0 {
+		return nil
+	}
+
+	return stun.Nonce(n).AddTo(m)
 }
 
 type allocation struct {
-	client            Client                // Read-only
-	relayedAddr       net.Addr              // Read-only
-	serverAddr        net.Addr              // Read-only
-	permMap           *permissionMap        // Thread-safe
-	integrity         stun.MessageIntegrity // Read-only
-	username          stun.Username         // Read-only
-	realm             stun.Realm            // Read-only
-	_nonce            stun.Nonce            // Needs mutex x
-	_lifetime         time.Duration         // Needs mutex x
-	net               transport.Net         // Thread-safe
-	refreshAllocTimer *PeriodicTimer        // Thread-safe
-	refreshPermsTimer *PeriodicTimer        // Thread-safe
-	readTimer         *time.Timer           // Thread-safe
-	mutex             sync.RWMutex          // Thread-safe
-	log               logging.LeveledLogger // Read-only
-}
-
-func (a *allocation) setNonceFromMsg(msg *stun.Message) {
-	// Update nonce
+	client              Client                     // Read-only
+	_relayedAddr        net.Addr                   // Needs mutex x, replaced by Reconnect
+	_mappedAddr         net.Addr                   // Needs mutex x, may be nil
+	serverAddr          net.Addr                   // Read-only
+	permMap             *PermissionMap             // Thread-safe
+	permBatcher         *permissionBatcher         // Thread-safe, nil if batching is disabled
+	permLimiter         PermissionRateLimiter      // Thread-safe, nil if not rate limited
+	permRefreshInterval time.Duration              // Read-only
+	permLifetime        time.Duration              // Read-only, zero means default
+	permRefreshMargin   time.Duration              // Read-only, zero means default
+	_integrity          proto.Integrity            // Needs mutex x, replaced by SetCredentials
+	_username           stun.Username              // Needs mutex x, replaced by SetCredentials
+	_realm              stun.Realm                 // Needs mutex x, replaced by SetCredentials
+	software            optionalSoftware           // Read-only
+	_nonce              atomic.Pointer[stun.Nonce] // Thread-safe, read by every request
+	_lifetime           time.Duration              // Needs mutex x
+	_mobilityTicket     proto.MobilityTicket       // Needs mutex x
+	net                 transport.Net              // Thread-safe
+	refreshAllocTimer   *PeriodicTimer             // Thread-safe
+	refreshPermsTimer   *PeriodicTimer             // Thread-safe
+	gcPermsTimer        *PeriodicTimer             // Thread-safe
+	permGCInterval      time.Duration              // Read-only
+	readTimer           *time.Timer                // Thread-safe
+	mutex               sync.RWMutex               // Thread-safe
+	log                 logging.LeveledLogger      // Read-only
+	trace               *ClientTrace               // Read-only, may be nil
+	events              *EventLog                  // Thread-safe, nil unless WithEventLog is used
+	rtt                 rttWindow                  // Thread-safe
+	lastActivity        atomic.Int64               // Thread-safe, UnixNano of the last send or receive
+}
+
+// performTransaction performs a transaction with the TURN server, recording
+// its round-trip time.
+func (a *allocation) performTransaction(
+	ctx context.Context,
+	msg *stun.Message,
+	dontWait bool,
+) (TransactionResult, error) {
+	trRes, err := a.client.PerformTransactionContext(ctx, msg, a.serverAddr, dontWait)
+	if err == nil {
+		a.touch()
+	}
+	if err == nil && !dontWait {
+		a.rtt.add(trRes.RTT)
+	}
+
+	return trRes, err
+}
+
+// setNonceFromMsg stores the nonce of the 438 (Stale Nonce) response msg to
+// a request sent with the nonce sent, see requestNonce. Pipelined requests
+// may all be answered with 438, so the nonce is only replaced if it is still
+// sent: a late response must not bring back a nonce older than the one
+// another response already stored.
+func (a *allocation) setNonceFromMsg(sent *stun.Nonce, msg *stun.Message) {
 	var nonce stun.Nonce
-	if err := nonce.GetFrom(msg); err == nil {
-		a.setNonce(nonce)
-		a.log.Debug("Refresh allocation: 438, got new nonce.")
-	} else {
-		a.log.Warn("Refresh allocation: 438 but no nonce.")
+	if err := nonce.GetFrom(msg); err != nil {
+		a.log.Warnf("%s: 438 but no nonce", msg.Type)
+
+		return
+	}
+	if !a._nonce.CompareAndSwap(sent, &nonce) {
+		a.log.Debugf("%s: 438, nonce already replaced by another response", msg.Type)
+
+		return
 	}
+	a.log.Debugf("%s: 438, got new nonce with %d bytes", msg.Type, len(nonce))
+	a.events.add(EventNonceUpdated, nil, fmt.Sprintf("%d bytes", len(nonce)))
+}
+
+func (a *allocation) refreshAllocation(ctx context.Context, lifetime time.Duration, dontWait bool) error {
+	return a.sendRefresh(ctx, lifetime, dontWait, nil)
 }
 
-func (a *allocation) refreshAllocation(lifetime time.Duration, dontWait bool) error {
-	msg, err := stun.Build(
+// sendRefresh sends a Refresh request, with MOBILITY-TICKET if ticket is
+// not nil. A ticket in the response replaces the stored one.
+func (a *allocation) sendRefresh(
+	ctx context.Context,
+	lifetime time.Duration,
+	dontWait bool,
+	ticket proto.MobilityTicket,
+) error {
+	setters := []stun.Setter{
 		stun.TransactionID,
 		stun.NewType(stun.MethodRefresh, stun.ClassRequest),
 		proto.Lifetime{Duration: lifetime},
-		a.username,
-		a.realm,
-		a.nonce(),
-		a.integrity,
+	}
+	if ticket != nil {
+		setters = append(setters, ticket)
+	}
+	nonce := a.requestNonce()
+	msg, err := stun.Build(append(setters,
+		a.username(),
+		optionalRealm(a.realm()),
+		a.software,
+		optionalNonce(nonceValue(nonce)),
+		a.integrity(),
 		stun.Fingerprint,
-	)
+	)...)
 	if err != nil {
 		return fmt.Errorf("%w: %s", errFailedToBuildRefreshRequest, err.Error())
 	}
 
 	a.log.Debugf("Send refresh request (dontWait=%v)", dontWait)
-	trRes, err := a.client.PerformTransaction(msg, a.serverAddr, dontWait)
+	trRes, err := a.performTransaction(ctx, msg, dontWait)
 	if err != nil {
 		return fmt.Errorf("%w: %s", errFailedToRefreshAllocation, err.Error())
 	}
@@ -93,12 +216,15 @@ func (a *allocation) refreshAllocation(lifetime time.Duration, dontWait bool) er
 		var code stun.ErrorCodeAttribute
 		if err = code.GetFrom(res); err == nil {
 			if code.Code == stun.CodeStaleNonce {
-				a.setNonceFromMsg(res)
+				a.setNonceFromMsg(nonce, res)
 
 				return errTryAgain
 			}
+			if code.Code == stun.CodeAllocMismatch {
+				return fmt.Errorf("%w: %s (error %s)", errAllocationMismatch, res.Type, code)
+			}
 
-			return err
+			return fmt.Errorf("%s (error %s)", res.Type, code) //nolint:err113
 		}
 
 		return fmt.Errorf("%s", res.Type) //nolint:err113
@@ -111,52 +237,144 @@ func (a *allocation) refreshAllocation(lifetime time.Duration, dontWait bool) er
 	}
 
 	a.setLifetime(updatedLifetime.Duration)
-	a.log.Debugf("Updated lifetime: %d seconds", int(a.lifetime().Seconds()))
+	logEvent(a.log, "Allocation refreshed", slog.Duration("lifetime", a.lifetime()))
+	a.trace.allocationRefreshed(updatedLifetime.Duration)
+	a.events.add(EventAllocationRefreshed, nil, "lifetime "+updatedLifetime.Duration.String())
+
+	var updatedTicket proto.MobilityTicket
+	if err := updatedTicket.GetFrom(res); err == nil {
+		a.setMobilityTicket(updatedTicket)
+	}
 
 	return nil
 }
 
-func (a *allocation) refreshPermissions() error {
-	addrs := a.permMap.addrs()
+// migrate moves the allocation to the 5-tuple the client now sends from,
+// retrying on stale nonce. RFC 8016 Section 3.2.
+func (a *allocation) migrate(ctx context.Context) error {
+	ticket := a.mobilityTicket()
+	if len(ticket) == 0 {
+		return errNoMobilityTicket
+	}
+
+	var err error
+	lifetime := a.lifetime()
+	for i := 0; i < maxRetryAttempts; i++ {
+		err = a.sendRefresh(ctx, lifetime, false, ticket)
+		if !errors.Is(err, errTryAgain) {
+			break
+		}
+	}
+
+	return err
+}
+
+// refreshAllocationWithRetry refreshes the allocation with its current lifetime,
+// retrying on stale nonce.
+func (a *allocation) refreshAllocationWithRetry(ctx context.Context) error {
+	var err error
+	lifetime := a.lifetime()
+	// Limit the max retries on errTryAgain to 3
+	// when stale nonce returns, sencond retry should succeed
+	for i := 0; i < maxRetryAttempts; i++ {
+		err = a.refreshAllocation(ctx, lifetime, false)
+		if !errors.Is(err, errTryAgain) {
+			break
+		}
+	}
+
+	return err
+}
+
+// permLifetimeOrDefault returns how long the server keeps a permission.
+func (a *allocation) permLifetimeOrDefault() time.Duration {
+	if a.permLifetime == 0 {
+		return defaultPermLifetime
+	}
+
+	return a.permLifetime
+}
+
+// permRefreshMarginOrDefault returns how long before expiry a permission is refreshed.
+func (a *allocation) permRefreshMarginOrDefault() time.Duration {
+	if a.permRefreshMargin == 0 {
+		return defaultPermRefreshMargin
+	}
+
+	return a.permRefreshMargin
+}
+
+// permissionDue reports whether perm would get within the refresh margin of
+// its expiry before the next refresh tick.
+func (a *allocation) permissionDue(perm *permission, now time.Time) bool {
+	if perm.state() != PermissionStatePermitted {
+		return false
+	}
+	age := now.Sub(perm.refreshedAt())
+
+	return age+a.permRefreshInterval >= a.permLifetimeOrDefault()-a.permRefreshMarginOrDefault()
+}
+
+func (a *allocation) refreshPermissions(ctx context.Context) error {
+	now := time.Now()
+	perms := []*permission{}
+	addrs := []net.Addr{}
+	for _, perm := range a.permMap.all() {
+		if a.permissionDue(perm, now) {
+			perms = append(perms, perm)
+			addrs = append(addrs, perm.addr)
+		}
+	}
 	if len(addrs) == 0 {
 		a.log.Debug("No permission to refresh")
 
 		return nil
 	}
-	if err := a.CreatePermissions(addrs...); err != nil {
+	if err := a.createPermissions(ctx, addrs...); err != nil {
 		if errors.Is(err, errTryAgain) {
 			return errTryAgain
 		}
 		a.log.Errorf("Fail to refresh permissions: %s", err)
 
+		// The permissions will expire, make the next write request them again
+		for _, perm := range perms {
+			perm.setState(PermissionStateFailed)
+		}
+
 		return err
 	}
+	for _, perm := range perms {
+		perm.setRefreshedAt(now)
+	}
 	a.log.Debug("Refresh permissions successful")
 
 	return nil
 }
 
+// gcPermissions removes the permissions that failed or expired, the next
+// write to such a peer requests a new permission.
+func (a *allocation) gcPermissions() {
+	now := time.Now()
+	lifetime := a.permLifetimeOrDefault()
+	for _, addr := range a.permMap.expired(lifetime, now) {
+		if a.permMap.deleteExpired(addr, lifetime, now) {
+			a.log.Debugf("Removed expired permission for %s", addr)
+			a.events.add(EventPermissionExpired, addr, "")
+		}
+	}
+}
+
 func (a *allocation) onRefreshTimers(id int) {
 	a.log.Debugf("Refresh timer %d expired", id)
 	switch id {
 	case timerIDRefreshAlloc:
-		var err error
-		lifetime := a.lifetime()
-		// Limit the max retries on errTryAgain to 3
-		// when stale nonce returns, sencond retry should succeed
-		for i := 0; i < maxRetryAttempts; i++ {
-			err = a.refreshAllocation(lifetime, false)
-			if !errors.Is(err, errTryAgain) {
-				break
-			}
-		}
-		if err != nil {
+		if err := a.refreshAllocationWithRetry(context.Background()); err != nil {
 			a.log.Warnf("Failed to refresh allocation: %s", err)
 		}
 	case timerIDRefreshPerms:
 		var err error
 		for i := 0; i < maxRetryAttempts; i++ {
-			err = a.refreshPermissions()
+			err = a.refreshPermissions(context.Background())
 			if !errors.Is(err, errTryAgain) {
 				break
 			}
@@ -164,22 +382,34 @@ func (a *allocation) onRefreshTimers(id int) {
 		if err != nil {
 			a.log.Warnf("Failed to refresh permissions: %s", err)
 		}
+	case timerIDGCPerms:
+		a.gcPermissions()
 	}
 }
 
 func (a *allocation) nonce() stun.Nonce {
-	a.mutex.RLock()
-	defer a.mutex.RUnlock()
+	return nonceValue(a._nonce.Load())
+}
 
-	return a._nonce
+// requestNonce returns the nonce to send a request with. Pass it with a
+// 438 (Stale Nonce) response to the request to setNonceFromMsg.
+func (a *allocation) requestNonce() *stun.Nonce {
+	return a._nonce.Load()
 }
 
-func (a *allocation) setNonce(nonce stun.Nonce) {
-	a.mutex.Lock()
-	defer a.mutex.Unlock()
+// nonceValue returns the nonce at nonce, or nil if nonce is nil.
+func nonceValue(nonce *stun.Nonce) stun.Nonce {
+	if nonce == nil {
+		return nil
+	}
 
+	return *nonce
+}
+
+func (a *allocation) setNonce(nonce stun.Nonce) {
 	a.log.Debugf("Set new nonce with %d bytes", len(nonce))
-	a._nonce = nonce
+	a._nonce.Store(&nonce)
+	a.events.add(EventNonceUpdated, nil, fmt.Sprintf("%d bytes", len(nonce)))
 }
 
 func (a *allocation) lifetime() time.Duration {
@@ -195,3 +425,73 @@ func (a *allocation) setLifetime(lifetime time.Duration) {
 
 	a._lifetime = lifetime
 }
+
+// Credentials are the long-term credentials an allocation signs its
+// requests with.
+type Credentials struct {
+	Username  stun.Username
+	Realm     stun.Realm
+	Integrity proto.Integrity
+	Nonce     stun.Nonce
+}
+
+// SetCredentials replaces the credentials of the allocation, e.g. after the
+// client rotated them. The next request is signed with them.
+func (a *allocation) SetCredentials(creds Credentials) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a._username = creds.Username
+	a._realm = creds.Realm
+	a._integrity = creds.Integrity
+	a._nonce.Store(&creds.Nonce)
+}
+
+func (a *allocation) username() stun.Username {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	return a._username
+}
+
+func (a *allocation) realm() stun.Realm {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	return a._realm
+}
+
+func (a *allocation) integrity() proto.Integrity {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	return a._integrity
+}
+
+func (a *allocation) relayedAddr() net.Addr {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	return a._relayedAddr
+}
+
+func (a *allocation) mappedAddr() net.Addr {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	return a._mappedAddr
+}
+
+func (a *allocation) mobilityTicket() proto.MobilityTicket {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	return a._mobilityTicket
+}
+
+func (a *allocation) setMobilityTicket(ticket proto.MobilityTicket) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a._mobilityTicket = append(proto.MobilityTicket(nil), ticket...)
+}
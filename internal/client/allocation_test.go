@@ -0,0 +1,161 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4/internal/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllocationNonce(t *testing.T) {
+	conn := newTestUDPConn(t, &mockClient{})
+	assert.Empty(t, conn.nonce())
+
+	conn.setNonce(stun.NewNonce("nonce"))
+	assert.Equal(t, stun.NewNonce("nonce"), conn.nonce())
+
+	// Run with -race: readers build requests while writers handle stale
+	// nonces and credential rotation
+	const writers, readers, iterations = 4, 4, 1000
+	written := map[string]bool{"nonce": true}
+	for w := 0; w < writers; w++ {
+		for i := 0; i < iterations; i++ {
+			written[fmt.Sprintf("nonce-%d-%d", w, i)] = true
+		}
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				nonce := stun.NewNonce(fmt.Sprintf("nonce-%d-%d", w, i))
+				if w%2 == 0 {
+					conn.setNonce(nonce)
+				} else {
+					conn.SetCredentials(Credentials{
+						Username:  conn.username(),
+						Realm:     conn.realm(),
+						Integrity: conn.integrity(),
+						Nonce:     nonce,
+					})
+				}
+			}
+		}(w)
+	}
+	for r := 0; r < readers; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				if nonce := conn.nonce(); !written[string(nonce)] {
+					t.Errorf("read a nonce that was never written: %q", nonce)
+
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.True(t, written[string(conn.nonce())])
+}
+
+func TestAllocationPipelinedStaleNonce(t *testing.T) {
+	// The server moved on to nonce-3. Three CreatePermission requests are in
+	// flight with nonce-1 when it does, the response to the first arrives
+	// last and carries nonce-2, a nonce older than that of the others.
+	peers := []*net.UDPAddr{
+		{IP: net.IPv4(10, 0, 0, 1), Port: 5000},
+		{IP: net.IPv4(10, 0, 0, 2), Port: 5000},
+		{IP: net.IPv4(10, 0, 0, 3), Port: 5000},
+	}
+	var conn *UDPConn
+	var mutex sync.Mutex
+	var sent []string // Nonces of the CreatePermission requests
+	pipelined := make(chan struct{})
+	var inFlight sync.WaitGroup
+	inFlight.Add(len(peers))
+	go func() {
+		inFlight.Wait()
+		close(pipelined)
+	}()
+	// replaced waits for the nonce of the conn to become nonce-3
+	replaced := func() {
+		assert.Eventually(t, func() bool { return string(conn.nonce()) == "nonce-3" }, 5*time.Second, time.Millisecond)
+	}
+
+	client := &mockClient{}
+	client.SetWriteTo(func(data []byte, _ net.Addr) (int, error) { return len(data), nil })
+	client.SetPerformTransaction(func(_ context.Context, msg *stun.Message, _ net.Addr, _ bool) (
+		TransactionResult, error,
+	) {
+		var nonce stun.Nonce
+		assert.NoError(t, nonce.GetFrom(msg))
+		if nonce.String() == "nonce-3" {
+			if msg.Type.Method == stun.MethodCreatePermission {
+				mutex.Lock()
+				sent = append(sent, nonce.String())
+				mutex.Unlock()
+			}
+
+			return TransactionResult{Msg: stun.MustBuild(stun.NewType(msg.Type.Method, stun.ClassSuccessResponse))}, nil
+		}
+
+		mutex.Lock()
+		sent = append(sent, nonce.String())
+		mutex.Unlock()
+		var peer proto.PeerAddress
+		assert.NoError(t, peer.GetFrom(msg))
+		inFlight.Done()
+		<-pipelined
+		stale := "nonce-3"
+		switch {
+		case peer.IP.Equal(peers[0].IP):
+			replaced()
+			stale = "nonce-2"
+		case peer.IP.Equal(peers[2].IP):
+			replaced()
+		}
+
+		return TransactionResult{Msg: stun.MustBuild(
+			stun.NewType(msg.Type.Method, stun.ClassErrorResponse), stun.CodeStaleNonce, stun.NewNonce(stale),
+		)}, nil
+	})
+	conn = newTestUDPConn(t, client)
+	conn.setNonce(stun.NewNonce("nonce-1"))
+
+	var writes sync.WaitGroup
+	for _, peer := range peers {
+		writes.Add(1)
+		peer := peer
+		go func() {
+			defer writes.Done()
+			_, err := conn.WriteTo([]byte("hello"), peer)
+			assert.NoError(t, err)
+		}()
+	}
+	writes.Wait()
+
+	assert.Equal(t, "nonce-3", string(conn.nonce()))
+	for _, peer := range peers {
+		perm, ok := conn.permMap.find(peer)
+		assert.True(t, ok)
+		assert.Equal(t, PermissionStatePermitted, perm.state())
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.NotContains(t, sent, "nonce-2", "the late response must not replace the newer nonce")
+	assert.ElementsMatch(t, []string{"nonce-1", "nonce-1", "nonce-1", "nonce-3", "nonce-3", "nonce-3"}, sent,
+		"each request is retried once")
+}
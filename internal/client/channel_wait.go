@@ -0,0 +1,71 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pion/turn/v4/binding"
+)
+
+// changeNotifier wakes up the goroutines waiting for the next change.
+type changeNotifier struct {
+	mutex sync.Mutex
+	ch    chan struct{} // Closed by notify, nil while nobody waits
+}
+
+// wait returns a channel closed by the next notify.
+func (n *changeNotifier) wait() <-chan struct{} {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if n.ch == nil {
+		n.ch = make(chan struct{})
+	}
+
+	return n.ch
+}
+
+func (n *changeNotifier) notify() {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if n.ch != nil {
+		close(n.ch)
+		n.ch = nil
+	}
+}
+
+// waitForChannel waits for the channel of bound to be ready, for at most
+// timeout. It fails with ErrChannelNotReady if the time runs out or the
+// ChannelBind fails.
+func (c *UDPConn) waitForChannel(ctx context.Context, bound *binding.Binding, timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		// Take the channel first, so that no change after the check is missed
+		changed := c.bindingChanges.wait()
+		if bound.OK() {
+			return nil
+		}
+		if state := bound.State(); state == binding.StateFailed {
+			return fmt.Errorf("%w: channel %d to %s is %s", ErrChannelNotReady, bound.Number(), bound.Addr(), state)
+		}
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			return fmt.Errorf("%w: channel %d to %s not bound within %s",
+				ErrChannelNotReady, bound.Number(), bound.Addr(), timeout)
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.closeCh:
+			return c.closedError()
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4/internal/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUDPConnRequireChannelTimeout(t *testing.T) {
+	peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+
+	// bindClient answers ChannelBind requests once bind returns, and records
+	// the packets written to the server
+	bindClient := func(bind func(ctx context.Context) error) (*mockClient, chan []byte) {
+		written := make(chan []byte, 10)
+		client := &mockClient{}
+		client.SetPerformTransaction(func(ctx context.Context, msg *stun.Message, _ net.Addr, _ bool) (
+			TransactionResult, error,
+		) {
+			if msg.Type.Method != stun.MethodChannelBind {
+				return TransactionResult{}, errFake
+			}
+			if err := bind(ctx); err != nil {
+				return TransactionResult{}, err
+			}
+
+			return TransactionResult{Msg: new(stun.Message)}, nil
+		})
+		client.SetWriteTo(func(data []byte, _ net.Addr) (int, error) {
+			written <- append([]byte(nil), data...)
+
+			return len(data), nil
+		})
+
+		return client, written
+	}
+
+	t.Run("Waits for the channel", func(t *testing.T) {
+		client, written := bindClient(func(context.Context) error {
+			time.Sleep(20 * time.Millisecond)
+
+			return nil
+		})
+		conn := newTestUDPConn(t, client, WithRequireChannelTimeout(time.Second))
+		conn.permMap.insert(peer, &permission{st: PermissionStatePermitted})
+
+		n, err := conn.WriteTo([]byte("data"), peer)
+		assert.NoError(t, err)
+		assert.Equal(t, 4, n)
+		assert.True(t, proto.IsChannelData(<-written))
+		assert.Empty(t, written)
+	})
+
+	t.Run("Times out", func(t *testing.T) {
+		client, written := bindClient(func(ctx context.Context) error {
+			<-ctx.Done()
+
+			return ctx.Err()
+		})
+		conn := newTestUDPConn(t, client, WithRequireChannelTimeout(20*time.Millisecond))
+		conn.permMap.insert(peer, &permission{st: PermissionStatePermitted})
+
+		start := time.Now()
+		_, err := conn.WriteTo([]byte("data"), peer)
+		assert.ErrorIs(t, err, ErrChannelNotReady)
+		assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+		assert.Empty(t, written, "no Send indication while the channel is required")
+	})
+
+	t.Run("Failed channel", func(t *testing.T) {
+		client, written := bindClient(func(context.Context) error { return errFake })
+		conn := newTestUDPConn(t, client, WithRequireChannelTimeout(time.Second))
+		conn.permMap.insert(peer, &permission{st: PermissionStatePermitted})
+
+		start := time.Now()
+		_, err := conn.WriteTo([]byte("data"), peer)
+		assert.ErrorIs(t, err, ErrChannelNotReady)
+		assert.Less(t, time.Since(start), time.Second, "a failed ChannelBind does not wait for the timeout")
+		assert.Empty(t, written)
+	})
+
+	t.Run("Zero sends indications", func(t *testing.T) {
+		client, written := bindClient(func(ctx context.Context) error {
+			<-ctx.Done()
+
+			return ctx.Err()
+		})
+		conn := newTestUDPConn(t, client, WithRequireChannelTimeout(0))
+		conn.permMap.insert(peer, &permission{st: PermissionStatePermitted})
+
+		_, err := conn.WriteTo([]byte("data"), peer)
+		assert.NoError(t, err)
+		msg := &stun.Message{Raw: <-written}
+		assert.NoError(t, msg.Decode())
+		assert.Equal(t, stun.NewType(stun.MethodSend, stun.ClassIndication), msg.Type)
+	})
+
+	t.Run("Negative timeout", func(t *testing.T) {
+		_, err := NewUDPConn(&AllocationConfig{Client: &mockClient{}}, WithRequireChannelTimeout(-time.Second))
+		assert.ErrorIs(t, err, errNegativeRequireChannelTimeout)
+	})
+}
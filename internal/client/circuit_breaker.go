@@ -0,0 +1,160 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// CircuitState is the state of a CircuitBreaker.
+type CircuitState int
+
+const (
+	// CircuitClosed lets every request through.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen rejects every request until the timeout has passed.
+	CircuitOpen
+	// CircuitHalfOpen lets a single probe transaction through, whose outcome
+	// closes or reopens the circuit.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreakerConfig is a bag of config parameters for CircuitBreaker.
+type CircuitBreakerConfig struct {
+	// Threshold is the number of consecutive failed transactions that opens
+	// the circuit.
+	Threshold int
+	// Timeout is how long the circuit stays open before a probe is let through.
+	Timeout time.Duration
+}
+
+func (c CircuitBreakerConfig) validate() error {
+	if c.Threshold <= 0 {
+		return errInvalidCircuitThreshold
+	}
+	if c.Timeout <= 0 {
+		return errInvalidCircuitTimeout
+	}
+
+	return nil
+}
+
+// CircuitBreaker stops sending to a TURN server whose transactions keep
+// failing, e.g. because of ICMP unreachable errors. After Threshold
+// consecutive failures the circuit opens and requests fail with
+// ErrCircuitOpen without being sent. Once Timeout has passed one transaction
+// is let through: the circuit closes if it succeeds and opens again if not.
+//
+// Error responses from the server count as successes, only transactions
+// that got no response or could not be sent count as failures.
+type CircuitBreaker struct {
+	config   CircuitBreakerConfig // Read-only
+	now      func() time.Time     // Read-only
+	state    CircuitState         // Protected by mutex
+	failures int                  // Protected by mutex
+	openedAt time.Time            // Protected by mutex
+	probing  bool                 // Protected by mutex
+	mutex    sync.Mutex
+}
+
+// NewCircuitBreaker creates a closed CircuitBreaker.
+func NewCircuitBreaker(config CircuitBreakerConfig) (*CircuitBreaker, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	return &CircuitBreaker{
+		config: config,
+		now:    time.Now,
+	}, nil
+}
+
+// State returns the current state of the circuit.
+func (b *CircuitBreaker) State() CircuitState {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.checkTimeout()
+
+	return b.state
+}
+
+// checkTimeout moves an open circuit to half-open once the timeout passed.
+func (b *CircuitBreaker) checkTimeout() {
+	if b.state == CircuitOpen && b.now().Sub(b.openedAt) >= b.config.Timeout {
+		b.state = CircuitHalfOpen
+		b.probing = false
+	}
+}
+
+// AllowWrite returns ErrCircuitOpen if the circuit is open. Data written
+// while the circuit is half-open is still sent.
+func (b *CircuitBreaker) AllowWrite() error {
+	if b.State() == CircuitOpen {
+		return ErrCircuitOpen
+	}
+
+	return nil
+}
+
+// AllowTransaction returns ErrCircuitOpen if a transaction may not be sent
+// now. Otherwise the caller must report its outcome with Done.
+func (b *CircuitBreaker) AllowTransaction() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.checkTimeout()
+	switch {
+	case b.state == CircuitOpen:
+		return ErrCircuitOpen
+	case b.state == CircuitHalfOpen && b.probing:
+		return ErrCircuitOpen
+	case b.state == CircuitHalfOpen:
+		b.probing = true
+	}
+
+	return nil
+}
+
+// Done records the outcome of a transaction allowed by AllowTransaction.
+// Canceled transactions neither open nor close the circuit.
+func (b *CircuitBreaker) Done(err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	wasProbe := b.state == CircuitHalfOpen && b.probing
+	switch {
+	case err != nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)):
+		if wasProbe {
+			b.probing = false
+		}
+	case err != nil:
+		b.failures++
+		if wasProbe || b.failures >= b.config.Threshold {
+			b.state = CircuitOpen
+			b.openedAt = b.now()
+			b.probing = false
+		}
+	default:
+		b.failures = 0
+		b.state = CircuitClosed
+		b.probing = false
+	}
+}
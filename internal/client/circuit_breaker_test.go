@@ -0,0 +1,109 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	newBreaker := func(t *testing.T) (*CircuitBreaker, *time.Time) {
+		t.Helper()
+
+		breaker, err := NewCircuitBreaker(CircuitBreakerConfig{Threshold: 3, Timeout: time.Second})
+		assert.NoError(t, err)
+		now := time.Now()
+		breaker.now = func() time.Time { return now }
+
+		return breaker, &now
+	}
+
+	fail := func(t *testing.T, breaker *CircuitBreaker, n int) {
+		t.Helper()
+
+		for i := 0; i < n; i++ {
+			assert.NoError(t, breaker.AllowTransaction())
+			breaker.Done(errFake)
+		}
+	}
+
+	t.Run("validate", func(t *testing.T) {
+		_, err := NewCircuitBreaker(CircuitBreakerConfig{Timeout: time.Second})
+		assert.ErrorIs(t, err, errInvalidCircuitThreshold)
+		_, err = NewCircuitBreaker(CircuitBreakerConfig{Threshold: 1})
+		assert.ErrorIs(t, err, errInvalidCircuitTimeout)
+	})
+
+	t.Run("opens after threshold failures", func(t *testing.T) {
+		breaker, _ := newBreaker(t)
+
+		fail(t, breaker, 2)
+		assert.Equal(t, CircuitClosed, breaker.State())
+
+		// A success resets the count
+		assert.NoError(t, breaker.AllowTransaction())
+		breaker.Done(nil)
+		fail(t, breaker, 2)
+		assert.Equal(t, CircuitClosed, breaker.State())
+
+		fail(t, breaker, 1)
+		assert.Equal(t, CircuitOpen, breaker.State())
+		assert.ErrorIs(t, breaker.AllowTransaction(), ErrCircuitOpen)
+		assert.ErrorIs(t, breaker.AllowWrite(), ErrCircuitOpen)
+	})
+
+	t.Run("cancellation does not count", func(t *testing.T) {
+		breaker, _ := newBreaker(t)
+
+		for i := 0; i < 5; i++ {
+			assert.NoError(t, breaker.AllowTransaction())
+			breaker.Done(context.Canceled)
+		}
+		assert.Equal(t, CircuitClosed, breaker.State())
+	})
+
+	t.Run("half-open after timeout", func(t *testing.T) {
+		breaker, now := newBreaker(t)
+		fail(t, breaker, 3)
+
+		*now = now.Add(999 * time.Millisecond)
+		assert.Equal(t, CircuitOpen, breaker.State())
+		*now = now.Add(time.Millisecond)
+		assert.Equal(t, CircuitHalfOpen, breaker.State())
+
+		// A single probe is let through, data is still sent
+		assert.NoError(t, breaker.AllowTransaction())
+		assert.ErrorIs(t, breaker.AllowTransaction(), ErrCircuitOpen)
+		assert.NoError(t, breaker.AllowWrite())
+	})
+
+	t.Run("closes on success in half-open", func(t *testing.T) {
+		breaker, now := newBreaker(t)
+		fail(t, breaker, 3)
+		*now = now.Add(time.Second)
+
+		assert.NoError(t, breaker.AllowTransaction())
+		breaker.Done(nil)
+		assert.Equal(t, CircuitClosed, breaker.State())
+
+		// It takes threshold failures again to open it
+		fail(t, breaker, 2)
+		assert.Equal(t, CircuitClosed, breaker.State())
+	})
+
+	t.Run("reopens on failure in half-open", func(t *testing.T) {
+		breaker, now := newBreaker(t)
+		fail(t, breaker, 3)
+		*now = now.Add(time.Second)
+
+		fail(t, breaker, 1)
+		assert.Equal(t, CircuitOpen, breaker.State())
+		*now = now.Add(time.Second)
+		assert.Equal(t, CircuitHalfOpen, breaker.State())
+	})
+}
@@ -5,6 +5,7 @@
 package client
 
 import (
+	"context"
 	"net"
 
 	"github.com/pion/stun/v3"
@@ -13,6 +14,14 @@ import (
 // Client is an interface for the public turn.Client in order to break cyclic dependencies.
 type Client interface {
 	WriteTo(data []byte, to net.Addr) (int, error)
-	PerformTransaction(msg *stun.Message, to net.Addr, dontWait bool) (TransactionResult, error)
+	PerformTransactionContext(
+		ctx context.Context,
+		msg *stun.Message,
+		to net.Addr,
+		dontWait bool,
+	) (TransactionResult, error)
+	// CancelTransaction aborts the pending transaction with transactionID,
+	// making PerformTransactionContext return ErrTransactionCanceled.
+	CancelTransaction(transactionID [stun.TransactionIDSize]byte)
 	OnDeallocated(relayedAddr net.Addr)
 }
@@ -0,0 +1,157 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// PoolMember is a client talking to a single TURN server that can create
+// allocations on it, e.g. turn.Client.
+type PoolMember interface {
+	TURNServerAddr() net.Addr
+	Allocate() (net.PacketConn, error)
+}
+
+// ClientPool spreads allocations over several TURN servers. Each allocation
+// goes to the member with the fewest active allocations, falling back to the
+// next one if Allocate fails.
+type ClientPool struct {
+	members []*poolMember
+	mutex   sync.Mutex
+}
+
+type poolMember struct {
+	PoolMember
+	active int
+}
+
+// closeNotifier is an allocation that reports when it is torn down, also on
+// its own, like UDPConn.
+type closeNotifier interface {
+	Closed() <-chan CloseEvent
+}
+
+// NewClientPool creates a pool of the given members.
+func NewClientPool(members ...PoolMember) (*ClientPool, error) {
+	if len(members) == 0 {
+		return nil, errEmptyClientPool
+	}
+
+	pool := &ClientPool{}
+	for _, member := range members {
+		if member == nil {
+			return nil, errNilPoolMember
+		}
+		pool.members = append(pool.members, &poolMember{PoolMember: member})
+	}
+
+	return pool, nil
+}
+
+// Allocate creates an allocation on the least-loaded member, trying the
+// others in order of load if it fails. The returned conn releases its slot
+// in the pool when closed, or when the allocation reports on Closed that it
+// was torn down on its own.
+func (p *ClientPool) Allocate() (net.PacketConn, error) {
+	var errs []error
+	for _, member := range p.byLoad() {
+		conn, err := member.Allocate()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", member.TURNServerAddr(), err))
+
+			continue
+		}
+
+		p.mutex.Lock()
+		member.active++
+		p.mutex.Unlock()
+
+		member := member
+		pooled := &pooledConn{PacketConn: conn, release: func() { p.release(member) }}
+		if notifier, ok := conn.(closeNotifier); ok {
+			pooled.closed = make(chan CloseEvent, 1)
+			go pooled.watch(notifier.Closed())
+		}
+
+		return pooled, nil
+	}
+
+	return nil, fmt.Errorf("%w: %w", errAllPoolMembersFailed, errors.Join(errs...))
+}
+
+// Load returns the number of active allocations of each member, in the
+// order the members were given to NewClientPool.
+func (p *ClientPool) Load() []int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	load := make([]int, len(p.members))
+	for i, member := range p.members {
+		load[i] = member.active
+	}
+
+	return load
+}
+
+// byLoad returns the members sorted by active allocations, ties in the order
+// the members were given to NewClientPool.
+func (p *ClientPool) byLoad() []*poolMember {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	members := append([]*poolMember(nil), p.members...)
+	// Insertion sort is stable and the pool is small
+	for i := 1; i < len(members); i++ {
+		for j := i; j > 0 && members[j].active < members[j-1].active; j-- {
+			members[j], members[j-1] = members[j-1], members[j]
+		}
+	}
+
+	return members
+}
+
+// release frees a slot of member.
+func (p *ClientPool) release(member *poolMember) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	member.active--
+}
+
+// pooledConn is an allocation handed out by ClientPool.
+type pooledConn struct {
+	net.PacketConn
+	release func()
+	once    sync.Once
+	closed  chan CloseEvent // Nil if the allocation does not report closing
+}
+
+// Close closes the allocation and frees its slot in the pool.
+func (c *pooledConn) Close() error {
+	c.once.Do(c.release)
+
+	return c.PacketConn.Close()
+}
+
+// Closed forwards the CloseEvent of the allocation, which the pool consumes
+// to free the slot. It never receives if the allocation does not report
+// closing.
+func (c *pooledConn) Closed() <-chan CloseEvent {
+	return c.closed
+}
+
+// watch frees the slot once the allocation is torn down, however that
+// happens, and forwards the event on Closed.
+func (c *pooledConn) watch(closed <-chan CloseEvent) {
+	event, ok := <-closed
+	c.once.Do(c.release)
+	if ok {
+		c.closed <- event
+	}
+	close(c.closed)
+}
@@ -0,0 +1,174 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePoolMember hands out allocations on loopback sockets.
+type fakePoolMember struct {
+	serverAddr  net.Addr
+	allocateErr error
+	allocations []*closingConn
+}
+
+func (m *fakePoolMember) TURNServerAddr() net.Addr {
+	return m.serverAddr
+}
+
+func (m *fakePoolMember) Allocate() (net.PacketConn, error) {
+	if m.allocateErr != nil {
+		return nil, m.allocateErr
+	}
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	if err != nil {
+		return nil, err
+	}
+	allocation := &closingConn{PacketConn: conn, closed: make(chan CloseEvent, 1)}
+	m.allocations = append(m.allocations, allocation)
+
+	return allocation, nil
+}
+
+// closingConn is an allocation that reports on Closed when it is torn down,
+// like UDPConn.
+type closingConn struct {
+	net.PacketConn
+	closed chan CloseEvent
+	once   sync.Once
+}
+
+func (c *closingConn) Close() error {
+	return c.tearDown(CloseEvent{Reason: CloseReasonLocal})
+}
+
+func (c *closingConn) Closed() <-chan CloseEvent {
+	return c.closed
+}
+
+// tearDown closes the conn and reports event, as if the allocation failed
+// on its own.
+func (c *closingConn) tearDown(event CloseEvent) error {
+	err := errAlreadyClosed
+	c.once.Do(func() {
+		err = c.PacketConn.Close()
+		c.closed <- event
+		close(c.closed)
+	})
+
+	return err
+}
+
+func newFakePoolMembers(n int) []*fakePoolMember {
+	members := make([]*fakePoolMember, n)
+	for i := range members {
+		members[i] = &fakePoolMember{
+			serverAddr: &net.UDPAddr{IP: net.IPv4(10, 0, 0, byte(i+1)), Port: 3478},
+		}
+	}
+
+	return members
+}
+
+func newTestClientPool(t *testing.T, members []*fakePoolMember) *ClientPool {
+	t.Helper()
+
+	poolMembers := make([]PoolMember, len(members))
+	for i, member := range members {
+		poolMembers[i] = member
+	}
+	pool, err := NewClientPool(poolMembers...)
+	assert.NoError(t, err)
+
+	return pool
+}
+
+func TestClientPool(t *testing.T) {
+	t.Run("NewClientPool()", func(t *testing.T) {
+		_, err := NewClientPool()
+		assert.ErrorIs(t, err, errEmptyClientPool)
+
+		_, err = NewClientPool(nil)
+		assert.ErrorIs(t, err, errNilPoolMember)
+	})
+
+	t.Run("load balancing", func(t *testing.T) {
+		members := newFakePoolMembers(3)
+		pool := newTestClientPool(t, members)
+
+		conns := []net.PacketConn{}
+		for i := 0; i < 6; i++ {
+			conn, err := pool.Allocate()
+			assert.NoError(t, err)
+			conns = append(conns, conn)
+		}
+		assert.Equal(t, []int{2, 2, 2}, pool.Load())
+		for _, member := range members {
+			assert.Len(t, member.allocations, 2)
+		}
+
+		// Freed slots are reused first
+		assert.NoError(t, conns[1].Close())
+		_ = conns[1].Close() // Closing twice must not free another slot
+		assert.Equal(t, []int{2, 1, 2}, pool.Load())
+		conn, err := pool.Allocate()
+		assert.NoError(t, err)
+		conns[1] = conn
+		assert.Len(t, members[1].allocations, 3)
+
+		for _, conn := range conns {
+			assert.NoError(t, conn.Close())
+		}
+		assert.Equal(t, []int{0, 0, 0}, pool.Load())
+	})
+
+	t.Run("failover", func(t *testing.T) {
+		members := newFakePoolMembers(3)
+		members[0].allocateErr = errFake
+		pool := newTestClientPool(t, members)
+
+		for i := 0; i < 2; i++ {
+			conn, err := pool.Allocate()
+			assert.NoError(t, err)
+			defer conn.Close() //nolint:errcheck
+		}
+		assert.Equal(t, []int{0, 1, 1}, pool.Load())
+
+		for _, member := range members {
+			member.allocateErr = errFake
+		}
+		_, err := pool.Allocate()
+		assert.ErrorIs(t, err, errAllPoolMembersFailed)
+		assert.ErrorIs(t, err, errFake)
+	})
+
+	t.Run("allocation closed on its own", func(t *testing.T) {
+		members := newFakePoolMembers(2)
+		pool := newTestClientPool(t, members)
+
+		conn, err := pool.Allocate()
+		assert.NoError(t, err)
+		assert.Equal(t, []int{1, 0}, pool.Load())
+
+		// E.g. a failed refresh or the idle watchdog
+		event := CloseEvent{Reason: CloseReasonIdleProbeFailed, Err: errFake}
+		assert.NoError(t, members[0].allocations[0].tearDown(event))
+		notifier, ok := conn.(closeNotifier)
+		assert.True(t, ok)
+		assert.Equal(t, event, <-notifier.Closed(), "the event is forwarded")
+		_, ok = <-notifier.Closed()
+		assert.False(t, ok)
+		assert.Equal(t, []int{0, 0}, pool.Load())
+
+		// Closing it afterwards does not free another slot
+		_ = conn.Close()
+		assert.Equal(t, []int{0, 0}, pool.Load())
+	})
+}
@@ -4,35 +4,142 @@
 package client
 
 import (
+	"context"
+	"fmt"
 	"net"
+	"sync"
+	"testing"
+	"time"
 
 	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4/binding"
+	"github.com/stretchr/testify/assert"
 )
 
+type performTransactionFunc func(ctx context.Context, msg *stun.Message, to net.Addr, dontWait bool) (
+	TransactionResult, error,
+)
+
+// mockRTT is the round-trip time of the successful transactions without
+// retransmissions of a mockClient whose performTransaction sets none.
+const mockRTT = 10 * time.Millisecond
+
+// mockClient is a Client calling the given functions. They are set in the
+// literal or swapped with the setters while the client is in use; the calls
+// themselves run unlocked, so they may block or call back into the conn.
 type mockClient struct {
-	writeTo            func(data []byte, to net.Addr) (int, error)
-	performTransaction func(msg *stun.Message, to net.Addr, dontWait bool) (TransactionResult, error)
+	writeTo            func(data []byte, to net.Addr) (int, error) // Protected by mutex
+	performTransaction performTransactionFunc                      // Protected by mutex
 	onDeallocated      func(relayedAddr net.Addr)
+	canceled           [][stun.TransactionIDSize]byte // Protected by mutex
+	mutex              sync.RWMutex
+}
+
+// SetWriteTo replaces the WriteTo behavior.
+func (c *mockClient) SetWriteTo(fn func(data []byte, to net.Addr) (int, error)) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.writeTo = fn
+}
+
+// SetPerformTransaction replaces the PerformTransactionContext behavior.
+func (c *mockClient) SetPerformTransaction(fn performTransactionFunc) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.performTransaction = fn
 }
 
 func (c *mockClient) WriteTo(data []byte, to net.Addr) (int, error) {
-	if c.writeTo != nil {
-		return c.writeTo(data, to)
+	c.mutex.RLock()
+	writeTo := c.writeTo
+	c.mutex.RUnlock()
+
+	if writeTo != nil {
+		return writeTo(data, to)
 	}
 
 	return 0, nil
 }
 
-func (c *mockClient) PerformTransaction(msg *stun.Message, to net.Addr, dontWait bool) (TransactionResult, error) {
-	if c.performTransaction != nil {
-		return c.performTransaction(msg, to, dontWait)
+func (c *mockClient) PerformTransactionContext(
+	ctx context.Context,
+	msg *stun.Message,
+	to net.Addr,
+	dontWait bool,
+) (TransactionResult, error) {
+	c.mutex.RLock()
+	performTransaction := c.performTransaction
+	c.mutex.RUnlock()
+
+	if performTransaction != nil {
+		res, err := performTransaction(ctx, msg, to, dontWait)
+		if err == nil && !dontWait && res.RTT == 0 && res.Retries == 0 {
+			res.RTT = mockRTT
+		}
+
+		return res, err
 	}
 
 	return TransactionResult{}, errFake
 }
 
+func (c *mockClient) CancelTransaction(transactionID [stun.TransactionIDSize]byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.canceled = append(c.canceled, transactionID)
+}
+
 func (c *mockClient) OnDeallocated(relayedAddr net.Addr) {
 	if c.onDeallocated != nil {
 		c.onDeallocated(relayedAddr)
 	}
 }
+
+// assertBindingState asserts that the binding of addr in mgr reaches
+// expected within timeout, reporting its last state otherwise.
+func assertBindingState(
+	tb testing.TB,
+	mgr *binding.Manager,
+	addr net.Addr,
+	expected binding.State,
+	timeout time.Duration,
+) bool {
+	tb.Helper()
+
+	actual := "not found"
+	deadline := time.Now().Add(timeout)
+	for {
+		if b, ok := mgr.FindByAddr(addr); ok {
+			state := b.State()
+			if state == expected {
+				return true
+			}
+			actual = state.String()
+		}
+		if time.Now().After(deadline) {
+			return assert.Fail(tb, fmt.Sprintf("binding of %s is %s after %s, expected %s", addr, actual, timeout, expected))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// mustCreateBinding creates a binding for addr, failing the test on error.
+func mustCreateBinding(tb testing.TB, mgr *binding.Manager, addr net.Addr) *binding.Binding {
+	tb.Helper()
+
+	b, err := mgr.Create(addr)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	return b
+}
+
+type channelNumberAllocatorFunc func(peer net.Addr, inUse func(number uint16) bool) (uint16, error)
+
+func (f channelNumberAllocatorFunc) AllocateChannelNumber(peer net.Addr, inUse func(uint16) bool) (uint16, error) {
+	return f(peer, inUse)
+}
@@ -0,0 +1,61 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import "errors"
+
+// CloseReason tells why a UDPConn was closed.
+type CloseReason int
+
+const (
+	// CloseReasonLocal means that Close was called.
+	CloseReasonLocal CloseReason = iota
+	// CloseReasonAllocationRefreshFailed means that the server rejected the
+	// allocation refresh.
+	CloseReasonAllocationRefreshFailed
+	// CloseReasonNetworkError means that the allocation refresh got no
+	// response, e.g. because the connection to the server dropped.
+	CloseReasonNetworkError
+	// CloseReasonLifetimeExpired means that the server no longer knew the
+	// allocation when it was refreshed, so its lifetime had run out.
+	CloseReasonLifetimeExpired
+	// CloseReasonIdleProbeFailed means that the Binding request sent by the
+	// WithIdleWatchdog after a period of silence got no response.
+	CloseReasonIdleProbeFailed
+)
+
+func (r CloseReason) String() string {
+	switch r {
+	case CloseReasonLocal:
+		return "local close"
+	case CloseReasonAllocationRefreshFailed:
+		return "allocation refresh failed"
+	case CloseReasonNetworkError:
+		return "network error"
+	case CloseReasonLifetimeExpired:
+		return "lifetime expired"
+	case CloseReasonIdleProbeFailed:
+		return "idle probe failed"
+	default:
+		return "unknown"
+	}
+}
+
+// CloseEvent is delivered on UDPConn.Closed when the UDPConn is torn down.
+type CloseEvent struct {
+	Reason CloseReason
+	Err    error // Cause of the close, nil for CloseReasonLocal
+}
+
+// closeReasonOf classifies the error of a failed allocation refresh.
+func closeReasonOf(err error) CloseReason {
+	switch {
+	case errors.Is(err, errAllocationMismatch):
+		return CloseReasonLifetimeExpired
+	case errors.Is(err, errFailedToRefreshAllocation):
+		return CloseReasonNetworkError
+	default:
+		return CloseReasonAllocationRefreshFailed
+	}
+}
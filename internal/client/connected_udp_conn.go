@@ -0,0 +1,207 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pion/transport/v3/deadline"
+	"github.com/pion/turn/v4/internal/ipnet"
+)
+
+var _ net.Conn = (*connectedUDPConn)(nil)
+
+// connectedUDPConn is a net.Conn relaying to a single peer over a UDPConn.
+type connectedUDPConn struct {
+	conn          *UDPConn
+	remoteAddr    net.Addr
+	key           string
+	readCh        chan *inboundData
+	closeCh       chan struct{}
+	closeOnce     sync.Once
+	readDeadline  *deadline.Deadline
+	writeDeadline *deadline.Deadline
+}
+
+// dialedConns is a thread-safe map of connectedUDPConns keyed by peer address.
+type dialedConns struct {
+	conns map[string]*connectedUDPConn
+	mutex sync.RWMutex
+}
+
+func newDialedConns() *dialedConns {
+	return &dialedConns{conns: map[string]*connectedUDPConn{}}
+}
+
+// insert adds conn unless a conn for the same peer exists.
+func (d *dialedConns) insert(conn *connectedUDPConn) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, ok := d.conns[conn.key]; ok {
+		return false
+	}
+	d.conns[conn.key] = conn
+
+	return true
+}
+
+func (d *dialedConns) find(addr net.Addr) (*connectedUDPConn, bool) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	if len(d.conns) == 0 { // Skip fingerprinting addr on the common path
+		return nil, false
+	}
+	conn, ok := d.conns[ipnet.FingerprintAddrPort(addr)]
+
+	return conn, ok
+}
+
+func (d *dialedConns) delete(conn *connectedUDPConn) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.conns[conn.key] == conn {
+		delete(d.conns, conn.key)
+	}
+}
+
+// Dial returns a net.Conn that writes to and reads from addr only.
+// Data from addr is no longer returned by ReadFrom while the returned conn is
+// open. Closing it leaves the UDPConn open.
+func (c *UDPConn) Dial(addr net.Addr) (net.Conn, error) {
+	if _, ok := addr.(*net.UDPAddr); !ok {
+		return nil, errUDPAddrCast
+	}
+
+	select {
+	case <-c.closeCh:
+		return nil, c.closedError()
+	default:
+	}
+
+	conn := &connectedUDPConn{
+		conn:          c,
+		remoteAddr:    addr,
+		key:           ipnet.FingerprintAddrPort(addr),
+		readCh:        make(chan *inboundData, c.readQueueSize),
+		closeCh:       make(chan struct{}),
+		readDeadline:  deadline.New(),
+		writeDeadline: deadline.New(),
+	}
+	if !c.dialed.insert(conn) {
+		return nil, errAlreadyDialed
+	}
+
+	return conn, nil
+}
+
+// Read reads data sent by the peer.
+func (c *connectedUDPConn) Read(p []byte) (int, error) {
+	select {
+	case ibData := <-c.readCh:
+		n := copy(p, ibData.data)
+		short := n < len(ibData.data)
+		c.conn.readRing.release(ibData)
+		if short {
+			return 0, io.ErrShortBuffer
+		}
+		c.conn.stats.bytesReceived.Add(uint64(n)) //nolint:gosec // G115, n is non-negative
+
+		return n, nil
+	case <-c.readDeadline.Done():
+		return 0, c.opError("read", newTimeoutError("i/o timeout"))
+	case <-c.closeCh:
+		return 0, c.opError("read", errClosed)
+	case <-c.conn.closeCh:
+		return 0, c.opError("read", c.conn.closedError())
+	}
+}
+
+// Write sends data to the peer.
+func (c *connectedUDPConn) Write(p []byte) (int, error) {
+	select {
+	case <-c.closeCh:
+		return 0, c.opError("write", errClosed)
+	case <-c.writeDeadline.Done():
+		return 0, c.opError("write", newTimeoutError("i/o timeout"))
+	default:
+	}
+
+	n, err := c.conn.WriteToContext(c.writeDeadline, p, c.remoteAddr)
+	if err != nil {
+		return n, c.opError("write", err)
+	}
+
+	return n, nil
+}
+
+func (c *connectedUDPConn) opError(op string, err error) error {
+	return &net.OpError{
+		Op:     op,
+		Net:    c.LocalAddr().Network(),
+		Source: c.LocalAddr(),
+		Addr:   c.remoteAddr,
+		Err:    err,
+	}
+}
+
+// Close stops relaying data from the peer to this conn.
+func (c *connectedUDPConn) Close() error {
+	err := errAlreadyClosed
+	c.closeOnce.Do(func() {
+		c.conn.dialed.delete(c)
+		close(c.closeCh)
+		err = nil
+
+		// Hand unread packets back to the read ring
+		for {
+			select {
+			case ibData := <-c.readCh:
+				c.conn.readRing.release(ibData)
+			default:
+				return
+			}
+		}
+	})
+
+	return err
+}
+
+// LocalAddr returns the relayed address of the allocation.
+func (c *connectedUDPConn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// RemoteAddr returns the peer address.
+func (c *connectedUDPConn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+// SetDeadline sets the read and write deadlines.
+func (c *connectedUDPConn) SetDeadline(t time.Time) error {
+	c.readDeadline.Set(t)
+	c.writeDeadline.Set(t)
+
+	return nil
+}
+
+// SetReadDeadline sets the deadline for future and pending Read calls.
+func (c *connectedUDPConn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.Set(t)
+
+	return nil
+}
+
+// SetWriteDeadline sets the deadline for future Write calls and for
+// Write calls waiting for a permission.
+func (c *connectedUDPConn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.Set(t)
+
+	return nil
+}
@@ -0,0 +1,162 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4/internal/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectedUDPConn(t *testing.T) {
+	peerA := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+	peerB := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 5000}
+
+	// newConn returns a UDPConn whose writes to peers are recorded, always
+	// as Send indications because ChannelBind fails.
+	newConn := func(t *testing.T) (*UDPConn, func() []string) {
+		t.Helper()
+
+		var mu sync.Mutex
+		var sent []string
+		conn := newTestUDPConn(t, &mockClient{
+			writeTo: func(data []byte, _ net.Addr) (int, error) {
+				msg := &stun.Message{Raw: append([]byte(nil), data...)}
+				assert.NoError(t, msg.Decode())
+				var peer proto.PeerAddress
+				assert.NoError(t, peer.GetFrom(msg))
+				var payload proto.Data
+				assert.NoError(t, payload.GetFrom(msg))
+
+				mu.Lock()
+				sent = append(sent, peer.String()+" "+string(payload))
+				mu.Unlock()
+
+				return len(data), nil
+			},
+			performTransaction: func(_ context.Context, msg *stun.Message, _ net.Addr, _ bool) (TransactionResult, error) {
+				if msg.Type.Method == stun.MethodChannelBind {
+					return TransactionResult{}, errFake
+				}
+
+				return TransactionResult{Msg: new(stun.Message)}, nil
+			},
+		})
+
+		return conn, func() []string {
+			mu.Lock()
+			defer mu.Unlock()
+
+			return append([]string(nil), sent...)
+		}
+	}
+
+	t.Run("independent peers", func(t *testing.T) {
+		conn, sent := newConn(t)
+
+		connA, err := conn.Dial(peerA)
+		assert.NoError(t, err)
+		connB, err := conn.Dial(peerB)
+		assert.NoError(t, err)
+		assert.Equal(t, conn.LocalAddr(), connA.LocalAddr())
+		assert.Equal(t, peerA, connA.RemoteAddr())
+
+		_, err = connA.Write([]byte("to A"))
+		assert.NoError(t, err)
+		_, err = connB.Write([]byte("to B"))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"10.0.0.1:5000 to A", "10.0.0.2:5000 to B"}, sent())
+
+		other := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 3), Port: 5000}
+		conn.HandleInbound([]byte("from B"), peerB)
+		conn.HandleInbound([]byte("from other"), other)
+		conn.HandleInbound([]byte("from A"), &net.UDPAddr{IP: net.ParseIP("::ffff:10.0.0.1"), Port: 5000})
+
+		buf := make([]byte, 64)
+		n, err := connA.Read(buf)
+		assert.NoError(t, err)
+		assert.Equal(t, "from A", string(buf[:n]))
+		n, err = connB.Read(buf)
+		assert.NoError(t, err)
+		assert.Equal(t, "from B", string(buf[:n]))
+		n, from, err := conn.ReadFrom(buf)
+		assert.NoError(t, err)
+		assert.Equal(t, "from other", string(buf[:n]))
+		assert.Equal(t, other, from)
+
+		// A closed conn hands its peer back to ReadFrom
+		assert.NoError(t, connA.Close())
+		assert.ErrorIs(t, connA.Close(), errAlreadyClosed)
+		_, err = connA.Read(buf)
+		assert.ErrorIs(t, err, errClosed)
+		_, err = connA.Write([]byte("to A"))
+		assert.ErrorIs(t, err, errClosed)
+		conn.HandleInbound([]byte("from A"), peerA)
+		n, from, err = conn.ReadFrom(buf)
+		assert.NoError(t, err)
+		assert.Equal(t, "from A", string(buf[:n]))
+		assert.Equal(t, peerA, from)
+		assert.NoError(t, connB.Close())
+	})
+
+	t.Run("Dial() errors", func(t *testing.T) {
+		conn, _ := newConn(t)
+
+		_, err := conn.Dial(&net.TCPAddr{IP: peerA.IP, Port: peerA.Port})
+		assert.ErrorIs(t, err, errUDPAddrCast)
+
+		connA, err := conn.Dial(peerA)
+		assert.NoError(t, err)
+		_, err = conn.Dial(peerA)
+		assert.ErrorIs(t, err, errAlreadyDialed)
+		assert.NoError(t, connA.Close())
+		connA, err = conn.Dial(peerA)
+		assert.NoError(t, err, "peer can be dialed again once closed")
+
+		// Closing the allocation unblocks reads
+		readErr := make(chan error)
+		go func() {
+			_, err := connA.Read(make([]byte, 64))
+			readErr <- err
+		}()
+		assert.NoError(t, conn.Close())
+		assert.ErrorIs(t, <-readErr, errClosed)
+		_, err = conn.Dial(peerB)
+		assert.ErrorIs(t, err, errClosed)
+	})
+
+	t.Run("deadlines", func(t *testing.T) {
+		conn, sent := newConn(t)
+		connA, err := conn.Dial(peerA)
+		assert.NoError(t, err)
+		defer connA.Close() //nolint:errcheck
+
+		assert.NoError(t, connA.SetReadDeadline(time.Now().Add(20*time.Millisecond)))
+		_, err = connA.Read(make([]byte, 64))
+		var netErr net.Error
+		assert.ErrorAs(t, err, &netErr)
+		assert.True(t, netErr.Timeout())
+
+		assert.NoError(t, connA.SetWriteDeadline(time.Now().Add(-time.Second)))
+		_, err = connA.Write([]byte("late"))
+		assert.ErrorAs(t, err, &netErr)
+		assert.True(t, netErr.Timeout())
+		assert.Empty(t, sent())
+
+		// Clearing the deadlines makes the conn usable again
+		assert.NoError(t, connA.SetDeadline(time.Time{}))
+		_, err = connA.Write([]byte("on time"))
+		assert.NoError(t, err)
+		conn.HandleInbound([]byte("reply"), peerA)
+		n, err := connA.Read(make([]byte, 64))
+		assert.NoError(t, err)
+		assert.Equal(t, len("reply"), n)
+	})
+}
@@ -0,0 +1,93 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// CloseWithDrain closes the connection gracefully. New writes fail with
+// ErrClosing, while the writes in progress, and those queued with
+// WithWriteQueue, are still sent. Then the allocation is deleted with a
+// Refresh of lifetime zero, waiting for the server to answer, RFC 5766
+// Section 7, and the connection is closed as by Close.
+//
+// If ctx is done before the writes are sent, the connection is closed as by
+// Close right away and ctx.Err() is returned.
+func (c *UDPConn) CloseWithDrain(ctx context.Context) error {
+	c.drainMutex.Lock()
+	draining := c.draining
+	c.draining = true
+	c.drainMutex.Unlock()
+	if draining {
+		return errAlreadyClosed
+	}
+
+	err := waitContext(ctx, &c.inflight)
+	if err == nil && c.writeQueue != nil {
+		// No write can be queued anymore
+		err = waitContext(ctx, &c.writeQueue.pending)
+	}
+	if err != nil {
+		if closeErr := c.Close(); closeErr != nil {
+			c.log.Debugf("Failed to close after drain timeout: %s", closeErr)
+		}
+
+		return err
+	}
+
+	return c.shutdown(CloseEvent{Reason: CloseReasonLocal}, func() error {
+		return c.releaseAllocation(ctx)
+	})
+}
+
+// beginWrite registers a write in progress, to be ended with inflight.Done,
+// unless the connection is closed or closing.
+func (c *UDPConn) beginWrite() error {
+	c.drainMutex.RLock()
+	defer c.drainMutex.RUnlock()
+
+	select {
+	case <-c.closeCh:
+		return c.closedError()
+	default:
+	}
+	if c.draining {
+		return ErrClosing
+	}
+	c.inflight.Add(1)
+
+	return nil
+}
+
+// releaseAllocation deletes the allocation on the server, retrying on stale
+// nonce.
+func (c *UDPConn) releaseAllocation(ctx context.Context) error {
+	var err error
+	for i := 0; i < maxRetryAttempts; i++ {
+		if err = c.refreshAllocation(ctx, 0, false); !errors.Is(err, errTryAgain) {
+			break
+		}
+	}
+
+	return err
+}
+
+// waitContext waits for wg, or returns ctx.Err() if ctx is done first.
+func waitContext(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
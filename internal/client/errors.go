@@ -7,6 +7,35 @@ import (
 	"errors"
 )
 
+// ErrPermissionRateLimited is returned by WriteTo when a new permission is
+// needed but the PermissionRateLimiter does not allow requesting it yet.
+var ErrPermissionRateLimited = errors.New("permission request rate limited")
+
+// ErrReconnecting is returned by writes to a UDPConn while Reconnect moves it
+// to a new allocation. The write may be retried once Reconnect returns.
+var ErrReconnecting = errors.New("allocation is reconnecting")
+
+// ErrClosing is returned by writes to a UDPConn while CloseWithDrain waits
+// for the writes in progress.
+var ErrClosing = errors.New("connection is closing")
+
+// ErrPacketTooLarge is returned by writes with a payload larger than the
+// maximum packet size set with WithMaxPacketSize, or than what fits the path
+// MTU estimated with WithICMPListener.
+var ErrPacketTooLarge = errors.New("packet exceeds the maximum packet size")
+
+// ErrTransactionCanceled is returned by PerformTransactionContext when the
+// transaction is aborted with CancelTransaction.
+var ErrTransactionCanceled = errors.New("transaction canceled")
+
+// ErrCircuitOpen is returned instead of sending to a TURN server while the
+// CircuitBreaker of the client is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// ErrChannelNotReady is returned by writes to a UDPConn created with
+// WithRequireChannelTimeout when the channel to the peer is not bound in time.
+var ErrChannelNotReady = errors.New("channel binding not ready")
+
 var (
 	errFake                                = errors.New("fake error")
 	errTryAgain                            = errors.New("try again")
@@ -19,9 +48,56 @@ var (
 	errWaitForResultOnNonResultTransaction = errors.New("WaitForResult called on non-result transaction")
 	errFailedToBuildRefreshRequest         = errors.New("failed to build refresh request")
 	errFailedToRefreshAllocation           = errors.New("failed to refresh allocation")
+	errAllocationMismatch                  = errors.New("allocation mismatch")
 	errFailedToGetLifetime                 = errors.New("failed to get lifetime from refresh response")
 	errInvalidTURNAddress                  = errors.New("invalid TURN server address")
 	errUnexpectedSTUNRequestMessage        = errors.New("unexpected STUN request message")
+	errNegativeRetryInterval               = errors.New("retry interval must not be negative")
+	errInvalidRetryMultiplier              = errors.New("retry multiplier must be at least 1")
+	errNegativeMaxRetries                  = errors.New("max retries must not be negative")
+	errInvalidRetryJitter                  = errors.New("retry jitter must be in [0, 1)")
+	errNegativeBindingRefreshInterval      = errors.New("binding refresh interval must not be negative")
+	errNegativeAllocRefreshInterval        = errors.New("allocation refresh interval must not be negative")
+	errInvalidAllocRefreshJitter           = errors.New("allocation refresh jitter must be in [0, 1)")
+	errNegativePermBatchWindow             = errors.New("permission batch window must not be negative")
+	errNegativePermRefreshInterval         = errors.New("permission refresh interval must not be negative")
+	errNilAllocationClient                 = errors.New("allocation config must have a client")
+	errNegativeFailedCooldown              = errors.New("failed binding cooldown must not be negative")
+	errNegativePermLifetime                = errors.New("permission lifetime must not be negative")
+	errNegativePermRefreshMargin           = errors.New("permission refresh margin must not be negative")
+	errEmptyClientPool                     = errors.New("client pool needs at least one member")
+	errNilPoolMember                       = errors.New("client pool member must not be nil")
+	errAllPoolMembersFailed                = errors.New("all client pool members failed to allocate")
+	errAlreadyDialed                       = errors.New("peer is already dialed")
+	errNilChannelNumberAllocator           = errors.New("channel number allocator must not be nil")
+	errInvalidChannelRange                 = errors.New("channel range must be within [0x4000, 0x7FFF]")
+	errInvalidReadQueueSize                = errors.New("read queue size must be positive")
+	errNegativePermGCInterval              = errors.New("permission GC interval must not be negative")
+	errNoMobilityTicket                    = errors.New("allocation has no mobility ticket")
+	errInvalidWriteQueueSize               = errors.New("write queue size must be positive")
+	errSendBufferProbeUnsupported          = errors.New("send buffer probe is not supported on this platform")
+	errNilSendBufferProbe                  = errors.New("flow control needs a send buffer probe")
+	errInvalidFlowControlThreshold         = errors.New("flow control threshold must be in [0, 1]")
+	errNegativeFlowControlInterval         = errors.New("flow control interval must not be negative")
+	errNegativeMaxPacketSize               = errors.New("max packet size must not be negative")
+	errNegativeSlowWriteThreshold          = errors.New("slow write threshold must not be negative")
+	errNegativeDrainTimeout                = errors.New("write queue drain timeout must not be negative")
+	errInvalidCircuitThreshold             = errors.New("circuit breaker threshold must be positive")
+	errInvalidCircuitTimeout               = errors.New("circuit breaker timeout must be positive")
+	errUnexpectedPingResponse              = errors.New("unexpected response to Binding request")
+	errFailedToRecreatePermissions         = errors.New("failed to create permissions again")
+	errFailedToRecreateBinding             = errors.New("failed to bind channel again")
+	errNilICMPConn                         = errors.New("ICMP listener needs a conn")
+	errInvalidICMPProtocol                 = errors.New("ICMP protocol must be ProtocolICMP or ProtocolIPv6ICMP")
+	errInvalidIdleTimeout                  = errors.New("idle timeout must be positive")
+	errNegativeRequireChannelTimeout       = errors.New("require channel timeout must not be negative")
+	errIdleProbeFailed                     = errors.New("idle probe of the TURN server failed")
+	errMTUProbeFailed                      = errors.New("MTU probe was not echoed by the peer")
+	errInvalidEventLogSize                 = errors.New("event log size must be positive")
+	errInvalidHighWaterMark                = errors.New("binding high-water mark must be positive")
+	errInvalidThroughputPayload            = errors.New("throughput payload size out of range")
+	errInvalidThroughputDuration           = errors.New("throughput duration must be positive")
+	errThroughputInProgress                = errors.New("throughput measurement already in progress")
 )
 
 type timeoutError struct {
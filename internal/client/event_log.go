@@ -0,0 +1,148 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// EventType is the kind of an Event.
+type EventType int
+
+const (
+	// EventBindingCreated means a channel was bound to a peer.
+	EventBindingCreated EventType = iota + 1
+	// EventBindingRefreshed means the channel binding of a peer was refreshed.
+	EventBindingRefreshed
+	// EventBindingFailed means a ChannelBind transaction failed.
+	EventBindingFailed
+	// EventPermissionGranted means the server granted a permission for a peer.
+	EventPermissionGranted
+	// EventPermissionExpired means an expired permission was removed.
+	EventPermissionExpired
+	// EventNonceUpdated means the server handed out a new nonce.
+	EventNonceUpdated
+	// EventAllocationRefreshed means a Refresh succeeded.
+	EventAllocationRefreshed
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventBindingCreated:
+		return "BindingCreated"
+	case EventBindingRefreshed:
+		return "BindingRefreshed"
+	case EventBindingFailed:
+		return "BindingFailed"
+	case EventPermissionGranted:
+		return "PermissionGranted"
+	case EventPermissionExpired:
+		return "PermissionExpired"
+	case EventNonceUpdated:
+		return "NonceUpdated"
+	case EventAllocationRefreshed:
+		return "AllocationRefreshed"
+	default:
+		return "Unknown"
+	}
+}
+
+// Event is an action of a UDPConn recorded in its EventLog.
+type Event struct {
+	Time   time.Time
+	Type   EventType
+	Addr   net.Addr // The peer, nil for events of the whole allocation
+	Detail string
+}
+
+func (e Event) String() string {
+	s := e.Time.Format(time.RFC3339Nano) + " " + e.Type.String()
+	if e.Addr != nil {
+		s += " " + e.Addr.String()
+	}
+	if e.Detail != "" {
+		s += ": " + e.Detail
+	}
+
+	return s
+}
+
+// EventLog keeps the most recent events of a UDPConn in a ring buffer, to
+// diagnose intermittent failures such as stale nonce loops or bindings that
+// flap. It is safe for concurrent use.
+type EventLog struct {
+	mutex  sync.Mutex
+	events []Event // Protected by mutex, a ring buffer with room for size events
+	next   int     // Protected by mutex, index of the oldest event once full
+	full   bool    // Protected by mutex
+}
+
+func newEventLog(size int) *EventLog {
+	return &EventLog{events: make([]Event, 0, size)}
+}
+
+// add records an event at the current time, evicting the oldest event if
+// the log is full. It does nothing if l is nil.
+func (l *EventLog) add(typ EventType, addr net.Addr, detail string) {
+	if l == nil {
+		return
+	}
+	event := Event{Time: time.Now(), Type: typ, Addr: addr, Detail: detail}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if !l.full {
+		l.events = append(l.events, event)
+		l.full = len(l.events) == cap(l.events)
+
+		return
+	}
+	l.events[l.next] = event
+	l.next = (l.next + 1) % len(l.events)
+}
+
+// Events returns the recorded events, oldest first.
+func (l *EventLog) Events() []Event {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.snapshot()
+}
+
+// Drain returns the recorded events, oldest first, and clears the log.
+func (l *EventLog) Drain() []Event {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	events := l.snapshot()
+	l.events = l.events[:0]
+	l.next = 0
+	l.full = false
+
+	return events
+}
+
+// Dump writes the recorded events to w, one per line, oldest first.
+func (l *EventLog) Dump(w io.Writer) error {
+	for _, event := range l.Events() {
+		if _, err := fmt.Fprintln(w, event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// snapshot returns a copy of the events in order. The caller holds the mutex.
+func (l *EventLog) snapshot() []Event {
+	events := make([]Event, 0, len(l.events))
+	events = append(events, l.events[l.next:]...)
+
+	return append(events, l.events[:l.next]...)
+}
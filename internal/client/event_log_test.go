@@ -0,0 +1,120 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/stun/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func eventTypes(events []Event) []EventType {
+	types := make([]EventType, len(events))
+	for i, event := range events {
+		types[i] = event.Type
+	}
+
+	return types
+}
+
+func TestEventLog(t *testing.T) {
+	peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+
+	t.Run("Eviction", func(t *testing.T) {
+		log := newEventLog(3)
+		log.add(EventBindingCreated, peer, "")
+		log.add(EventBindingRefreshed, peer, "")
+		assert.Equal(t, []EventType{EventBindingCreated, EventBindingRefreshed}, eventTypes(log.Events()))
+
+		// The oldest events make room for new ones
+		log.add(EventBindingFailed, peer, "")
+		log.add(EventPermissionGranted, peer, "")
+		log.add(EventPermissionExpired, peer, "")
+		assert.Equal(t, []EventType{
+			EventBindingFailed, EventPermissionGranted, EventPermissionExpired,
+		}, eventTypes(log.Events()))
+		log.add(EventNonceUpdated, nil, "")
+		log.add(EventAllocationRefreshed, nil, "")
+		log.add(EventBindingCreated, peer, "")
+		assert.Equal(t, []EventType{
+			EventNonceUpdated, EventAllocationRefreshed, EventBindingCreated,
+		}, eventTypes(log.Events()))
+	})
+
+	t.Run("Drain", func(t *testing.T) {
+		log := newEventLog(2)
+		for _, typ := range []EventType{EventBindingCreated, EventBindingRefreshed, EventBindingFailed} {
+			log.add(typ, peer, "")
+		}
+		assert.Equal(t, []EventType{EventBindingRefreshed, EventBindingFailed}, eventTypes(log.Drain()))
+		assert.Empty(t, log.Drain())
+
+		log.add(EventNonceUpdated, nil, "")
+		assert.Equal(t, []EventType{EventNonceUpdated}, eventTypes(log.Drain()))
+	})
+
+	t.Run("Dump", func(t *testing.T) {
+		log := newEventLog(4)
+		log.add(EventBindingCreated, peer, "channel 0x4000")
+		log.add(EventNonceUpdated, nil, "")
+
+		var b strings.Builder
+		assert.NoError(t, log.Dump(&b))
+		lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+		assert.Len(t, lines, 2)
+		assert.True(t, strings.HasSuffix(lines[0], " BindingCreated 10.0.0.1:5000: channel 0x4000"), lines[0])
+		assert.True(t, strings.HasSuffix(lines[1], " NonceUpdated"), lines[1])
+		_, err := time.Parse(time.RFC3339Nano, strings.Fields(lines[0])[0])
+		assert.NoError(t, err)
+	})
+
+	t.Run("Nil", func(t *testing.T) {
+		var log *EventLog
+		log.add(EventNonceUpdated, nil, "")
+	})
+
+	t.Run("UDPConn", func(t *testing.T) {
+		client := &mockClient{}
+		client.SetPerformTransaction(func(_ context.Context, msg *stun.Message, _ net.Addr, _ bool) (
+			TransactionResult, error,
+		) {
+			return TransactionResult{Msg: stun.MustBuild(stun.NewType(msg.Type.Method, stun.ClassSuccessResponse))}, nil
+		})
+		client.SetWriteTo(func(data []byte, _ net.Addr) (int, error) { return len(data), nil })
+		conn := newTestUDPConn(t, client, WithEventLog(16))
+		assert.Nil(t, newTestUDPConn(t, &mockClient{}).EventLog())
+
+		_, err := conn.WriteTo([]byte("hello"), peer)
+		assert.NoError(t, err)
+		assert.Eventually(t, func() bool { return len(conn.EventLog().Events()) == 2 }, time.Second, time.Millisecond)
+		conn.setNonce(stun.NewNonce("nonce"))
+
+		// An expired permission is removed by the next collection
+		perm, ok := conn.permMap.find(peer)
+		assert.True(t, ok)
+		perm.setRefreshedAt(time.Now().Add(-time.Hour))
+		conn.gcPermissions()
+
+		events := conn.EventLog().Drain()
+		assert.Equal(t, []EventType{
+			EventPermissionGranted, EventBindingCreated, EventNonceUpdated, EventPermissionExpired,
+		}, eventTypes(events))
+		assert.Equal(t, peer, events[0].Addr)
+		assert.Equal(t, "channel 0x4000", events[1].Detail)
+		assert.Nil(t, events[2].Addr)
+		for i := 1; i < len(events); i++ {
+			assert.False(t, events[i].Time.Before(events[i-1].Time))
+		}
+	})
+
+	t.Run("Invalid size", func(t *testing.T) {
+		_, err := NewUDPConn(&AllocationConfig{Client: &mockClient{}}, WithEventLog(0))
+		assert.ErrorIs(t, err, errInvalidEventLogSize)
+	})
+}
@@ -0,0 +1,124 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	defaultFlowControlThreshold = 0.8
+	defaultFlowControlInterval  = 5 * time.Millisecond
+)
+
+// SendBufferProbe reports how full the send buffer of the socket to the TURN
+// server is, as a fraction in [0, 1].
+type SendBufferProbe interface {
+	SendBufferLevel() (float64, error)
+}
+
+// SendBufferProbeFunc adapts a function to SendBufferProbe.
+type SendBufferProbeFunc func() (float64, error)
+
+// SendBufferLevel calls f.
+func (f SendBufferProbeFunc) SendBufferLevel() (float64, error) {
+	return f()
+}
+
+// FlowControlConfig configures pausing writes while the send buffer is
+// filling up, see WithFlowControl.
+type FlowControlConfig struct {
+	Probe     SendBufferProbe // Must be set
+	Threshold float64         // Level above which writes pause, in (0, 1], zero selects 0.8
+	Interval  time.Duration   // How often Probe is polled, zero selects 5 milliseconds
+}
+
+func (c FlowControlConfig) validate() error {
+	switch {
+	case c.Probe == nil:
+		return errNilSendBufferProbe
+	case c.Threshold < 0 || c.Threshold > 1:
+		return errInvalidFlowControlThreshold
+	case c.Interval < 0:
+		return errNegativeFlowControlInterval
+	}
+
+	return nil
+}
+
+// flowControl polls a SendBufferProbe and holds writes back while the level
+// is above the threshold.
+type flowControl struct {
+	config  FlowControlConfig // Read-only
+	mutex   sync.Mutex
+	resumed chan struct{} // Protected by mutex, nil unless paused
+}
+
+func newFlowControl(config FlowControlConfig) *flowControl {
+	if config.Threshold == 0 {
+		config.Threshold = defaultFlowControlThreshold
+	}
+	if config.Interval == 0 {
+		config.Interval = defaultFlowControlInterval
+	}
+
+	return &flowControl{config: config}
+}
+
+// run polls the probe until ctx is done. Writes paused by then are released.
+func (f *flowControl) run(ctx context.Context, onError func(err error)) {
+	ticker := time.NewTicker(f.config.Interval)
+	defer ticker.Stop()
+	defer f.update(false)
+
+	for {
+		level, err := f.config.Probe.SendBufferLevel()
+		if err != nil {
+			onError(err)
+		}
+		// Keep writing if the level is unknown
+		f.update(err == nil && level > f.config.Threshold)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (f *flowControl) update(full bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	switch {
+	case full && f.resumed == nil:
+		f.resumed = make(chan struct{})
+	case !full && f.resumed != nil:
+		close(f.resumed)
+		f.resumed = nil
+	}
+}
+
+// wait blocks while writes are paused, until ctx is done or closeCh is
+// closed. It reports whether the write had to wait.
+func (f *flowControl) wait(ctx context.Context, closeCh <-chan struct{}) (bool, error) {
+	f.mutex.Lock()
+	resumed := f.resumed
+	f.mutex.Unlock()
+	if resumed == nil {
+		return false, nil
+	}
+
+	select {
+	case <-resumed:
+		return true, nil
+	case <-ctx.Done():
+		return true, ctx.Err()
+	case <-closeCh:
+		return true, errClosed
+	}
+}
@@ -0,0 +1,43 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+// +build linux
+
+package client
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// NewSocketSendBufferProbe returns a SendBufferProbe that compares the bytes
+// queued in the send buffer of conn (SIOCOUTQ) with its size (SO_SNDBUF).
+func NewSocketSendBufferProbe(conn syscall.Conn) (SendBufferProbe, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	return SendBufferProbeFunc(func() (float64, error) {
+		var queued, size int
+		var sockErr error
+		if err := raw.Control(func(fd uintptr) {
+			if queued, sockErr = unix.IoctlGetInt(int(fd), unix.SIOCOUTQ); sockErr != nil {
+				return
+			}
+			size, sockErr = unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_SNDBUF)
+		}); err != nil {
+			return 0, err
+		}
+		if sockErr != nil {
+			return 0, sockErr
+		}
+		if size <= 0 {
+			return 0, nil
+		}
+
+		return float64(queued) / float64(size), nil
+	}), nil
+}
@@ -0,0 +1,33 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+// +build linux
+
+package client
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSocketSendBufferProbe(t *testing.T) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer conn.Close() //nolint:errcheck
+
+	probe, err := NewSocketSendBufferProbe(conn)
+	require.NoError(t, err)
+
+	level, err := probe.SendBufferLevel()
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, level, 0.0)
+	assert.LessOrEqual(t, level, 1.0)
+
+	require.NoError(t, conn.Close())
+	_, err = probe.SendBufferLevel()
+	assert.Error(t, err)
+}
@@ -0,0 +1,16 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !linux
+// +build !linux
+
+package client
+
+import (
+	"syscall"
+)
+
+// NewSocketSendBufferProbe is only supported on Linux.
+func NewSocketSendBufferProbe(syscall.Conn) (SendBufferProbe, error) {
+	return nil, errSendBufferProbeUnsupported
+}
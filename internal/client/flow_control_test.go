@@ -0,0 +1,117 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"context"
+	"math"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/turn/v4/binding"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithFlowControl(t *testing.T) {
+	peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+
+	var level atomic.Uint64
+	setLevel := func(l float64) { level.Store(math.Float64bits(l)) }
+	probe := SendBufferProbeFunc(func() (float64, error) {
+		return math.Float64frombits(level.Load()), nil
+	})
+	newConn := func(t *testing.T) *UDPConn {
+		t.Helper()
+
+		setLevel(0)
+		conn := newWriteBenchConn(t, peer, func([]byte) {}, WithFlowControl(FlowControlConfig{
+			Probe:    probe,
+			Interval: time.Millisecond,
+		}))
+		mustCreateBinding(t, conn.bindingMgr, peer).SetState(binding.StateReady)
+
+		return conn
+	}
+	waitPaused := func(t *testing.T, conn *UDPConn, paused bool) {
+		t.Helper()
+
+		assert.Eventually(t, func() bool {
+			conn.flowControl.mutex.Lock()
+			defer conn.flowControl.mutex.Unlock()
+
+			return (conn.flowControl.resumed != nil) == paused
+		}, time.Second, time.Millisecond)
+	}
+
+	t.Run("Pauses above the threshold", func(t *testing.T) {
+		conn := newConn(t)
+		_, err := conn.WriteTo([]byte("hello"), peer)
+		assert.NoError(t, err)
+
+		setLevel(0.9)
+		waitPaused(t, conn, true)
+		done := make(chan error)
+		go func() {
+			_, err := conn.WriteTo([]byte("paused"), peer)
+			done <- err
+		}()
+		select {
+		case <-done:
+			assert.Fail(t, "write went through with a full send buffer")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		setLevel(0.8)
+		assert.NoError(t, <-done)
+		assert.Equal(t, uint64(1), conn.Stats().FlowControlPauses)
+		assert.Equal(t, uint64(2), conn.Stats().ChannelSends)
+	})
+
+	t.Run("Deadline and Close", func(t *testing.T) {
+		conn := newConn(t)
+		setLevel(1)
+		waitPaused(t, conn, true)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err := conn.WriteToContext(ctx, []byte("hello"), peer)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		done := make(chan error)
+		go func() {
+			_, err := conn.WriteTo([]byte("hello"), peer)
+			done <- err
+		}()
+		time.Sleep(10 * time.Millisecond)
+		_ = conn.Close() // The mock client fails the final refresh
+		assert.ErrorIs(t, <-done, errClosed)
+		assert.Equal(t, uint64(2), conn.Stats().FlowControlPauses)
+		assert.Equal(t, uint64(0), conn.Stats().ChannelSends)
+	})
+
+	t.Run("Unknown level", func(t *testing.T) {
+		conn := newWriteBenchConn(t, peer, func([]byte) {}, WithFlowControl(FlowControlConfig{
+			Probe: SendBufferProbeFunc(func() (float64, error) { return 1, errFake }),
+		}))
+		_, err := conn.WriteTo([]byte("hello"), peer)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(0), conn.Stats().FlowControlPauses)
+	})
+
+	t.Run("Invalid config", func(t *testing.T) {
+		for _, test := range []struct {
+			config FlowControlConfig
+			err    error
+		}{
+			{FlowControlConfig{}, errNilSendBufferProbe},
+			{FlowControlConfig{Probe: probe, Threshold: 1.5}, errInvalidFlowControlThreshold},
+			{FlowControlConfig{Probe: probe, Interval: -time.Second}, errNegativeFlowControlInterval},
+		} {
+			_, err := NewUDPConn(&AllocationConfig{Client: &mockClient{}}, WithFlowControl(test.config))
+			assert.ErrorIs(t, err, test.err)
+		}
+	})
+}
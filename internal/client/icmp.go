@@ -0,0 +1,156 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	// ProtocolICMP is the protocol of ICMPv4 messages read by WithICMPListener.
+	ProtocolICMP = 1
+	// ProtocolIPv6ICMP is the protocol of ICMPv6 messages read by WithICMPListener.
+	ProtocolIPv6ICMP = 58
+
+	defaultMTU    = 1500
+	minMTUIPv4    = 576  // RFC 791, smaller values in PTB messages are ignored
+	minMTUIPv6    = 1280 // RFC 8200 Section 5
+	ipv4HeaderLen = 20
+	ipv6HeaderLen = 40
+	udpHeaderLen  = 8
+	udpProtocol   = 17
+
+	// Largest size a Send indication adds to its data, with an IPv6
+	// XOR-PEER-ADDRESS, DATA padding, DONT-FRAGMENT and FINGERPRINT.
+	sendIndicationOverhead = 64
+
+	// Code of an ICMPv4 destination unreachable for a packet with DF set
+	// that needs to be fragmented, RFC 1191.
+	icmpv4FragmentationNeeded = 4
+)
+
+// ICMPConn reads ICMP messages without their IP header, e.g. an
+// *icmp.PacketConn listening on "ip4:icmp" or "ip6:ipv6-icmp".
+type ICMPConn interface {
+	ReadFrom(b []byte) (n int, addr net.Addr, err error)
+}
+
+type icmpListener struct {
+	conn     ICMPConn
+	protocol int
+}
+
+// CurrentMTU returns the path MTU to the TURN server as estimated from the
+// Packet Too Big messages read with WithICMPListener, 1500 until one arrives.
+func (c *UDPConn) CurrentMTU() int {
+	return int(c.mtu.Load())
+}
+
+// readICMP reads ICMP messages until the ICMPConn fails or ctx is done.
+func (c *UDPConn) readICMP(ctx context.Context) {
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := c.icmp.conn.ReadFrom(buf)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			c.log.Debugf("Stopped reading ICMP messages: %s", err)
+
+			return
+		}
+		c.handleICMP(buf[:n])
+	}
+}
+
+// handleICMP lowers the MTU estimate if msg is a Packet Too Big message for
+// a packet sent to the TURN server.
+func (c *UDPConn) handleICMP(raw []byte) {
+	msg, err := icmp.ParseMessage(c.icmp.protocol, raw)
+	if err != nil {
+		return
+	}
+
+	var mtu, minMTU int
+	var original []byte
+	switch body := msg.Body.(type) {
+	case *icmp.DstUnreach:
+		// The next-hop MTU is in the otherwise unused header field, RFC 1191
+		if msg.Type != ipv4.ICMPTypeDestinationUnreachable || msg.Code != icmpv4FragmentationNeeded || len(raw) < 8 {
+			return
+		}
+		mtu, minMTU, original = int(binary.BigEndian.Uint16(raw[6:8])), minMTUIPv4, body.Data
+	case *icmp.PacketTooBig:
+		if msg.Type != ipv6.ICMPTypePacketTooBig {
+			return
+		}
+		mtu, minMTU, original = body.MTU, minMTUIPv6, body.Data
+	default:
+		return
+	}
+
+	if !c.sentToServer(original) {
+		return
+	}
+	if mtu < minMTU {
+		// Bogus or from an attacker trying to make us send tiny packets
+		c.log.Debugf("Ignoring Packet Too Big with MTU %d", mtu)
+
+		return
+	}
+	for {
+		current := c.mtu.Load()
+		if int32(mtu) >= current { //nolint:gosec // G115, mtu fits in 16 bits
+			return
+		}
+		if c.mtu.CompareAndSwap(current, int32(mtu)) { //nolint:gosec // G115
+			c.log.Debugf("Path MTU to the TURN server lowered to %d", mtu)
+
+			return
+		}
+	}
+}
+
+// sentToServer reports whether the leading bytes of an IP packet quoted by
+// an ICMP error belong to a UDP datagram sent to the TURN server.
+func (c *UDPConn) sentToServer(original []byte) bool {
+	server, ok := c.serverAddr.(*net.UDPAddr)
+	if !ok {
+		return false
+	}
+
+	var dst net.IP
+	var udp []byte
+	if c.icmp.protocol == ProtocolICMP {
+		header, err := ipv4.ParseHeader(original)
+		if err != nil || header.Protocol != udpProtocol || len(original) < header.Len+4 {
+			return false
+		}
+		dst, udp = header.Dst, original[header.Len:]
+	} else {
+		if len(original) < ipv6HeaderLen+4 || original[6] != udpProtocol {
+			return false
+		}
+		dst, udp = net.IP(original[24:40]), original[ipv6HeaderLen:]
+	}
+
+	return dst.Equal(server.IP) && int(binary.BigEndian.Uint16(udp[2:4])) == server.Port
+}
+
+// maxMTUPayload returns the largest payload that is relayed without
+// exceeding mtu.
+func (c *UDPConn) maxMTUPayload(mtu int) int {
+	ipHeaderLen := ipv6HeaderLen
+	if c.icmp.protocol == ProtocolICMP {
+		ipHeaderLen = ipv4HeaderLen
+	}
+
+	return mtu - ipHeaderLen - udpHeaderLen - sendIndicationOverhead
+}
@@ -0,0 +1,191 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/turn/v4/binding"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// icmpInjector is an ICMPConn returning the messages sent to it.
+type icmpInjector chan []byte
+
+func (c icmpInjector) ReadFrom(b []byte) (int, net.Addr, error) {
+	msg, ok := <-c
+	if !ok {
+		return 0, nil, io.EOF
+	}
+
+	return copy(b, msg), &net.IPAddr{}, nil
+}
+
+// quotedUDP returns the IP and UDP headers of a datagram to dst, as quoted
+// by ICMP errors.
+func quotedUDP(t *testing.T, dst *net.UDPAddr) []byte {
+	t.Helper()
+
+	udp := make([]byte, udpHeaderLen)
+	binary.BigEndian.PutUint16(udp[0:2], 50000)
+	binary.BigEndian.PutUint16(udp[2:4], uint16(dst.Port)) // nolint:gosec // G115
+
+	if dst.IP.To4() != nil {
+		header, err := (&ipv4.Header{
+			Version:  ipv4.Version,
+			Len:      ipv4.HeaderLen,
+			TotalLen: 1500,
+			TTL:      64,
+			Protocol: udpProtocol,
+			Src:      net.IPv4(192, 0, 2, 1),
+			Dst:      dst.IP,
+		}).Marshal()
+		assert.NoError(t, err)
+
+		return append(header, udp...)
+	}
+
+	header := make([]byte, ipv6HeaderLen)
+	header[0] = 6 << 4
+	header[6] = udpProtocol
+	copy(header[8:24], net.ParseIP("2001:db8::1"))
+	copy(header[24:40], dst.IP.To16())
+
+	return append(header, udp...)
+}
+
+// packetTooBig returns a Packet Too Big message with mtu quoting a datagram to dst.
+func packetTooBig(t *testing.T, dst *net.UDPAddr, mtu int) []byte {
+	t.Helper()
+
+	if dst.IP.To4() != nil {
+		raw, err := (&icmp.Message{
+			Type: ipv4.ICMPTypeDestinationUnreachable,
+			Code: icmpv4FragmentationNeeded,
+			Body: &icmp.DstUnreach{Data: quotedUDP(t, dst)},
+		}).Marshal(nil)
+		assert.NoError(t, err)
+		binary.BigEndian.PutUint16(raw[6:8], uint16(mtu)) // nolint:gosec // G115
+
+		return raw
+	}
+
+	raw, err := (&icmp.Message{
+		Type: ipv6.ICMPTypePacketTooBig,
+		Body: &icmp.PacketTooBig{MTU: mtu, Data: quotedUDP(t, dst)},
+	}).Marshal(nil)
+	assert.NoError(t, err)
+
+	return raw
+}
+
+func TestUDPConnICMPListener(t *testing.T) {
+	newConn := func(t *testing.T, server *net.UDPAddr, protocol int, client Client) (*UDPConn, icmpInjector) {
+		t.Helper()
+
+		icmpConn := make(icmpInjector)
+		conn, err := NewUDPConn(&AllocationConfig{
+			Client:      client,
+			RelayedAddr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 3478},
+			ServerAddr:  server,
+			Lifetime:    time.Hour,
+			Log:         logging.NewDefaultLoggerFactory().NewLogger("test"),
+		}, WithICMPListener(icmpConn, protocol))
+		assert.NoError(t, err)
+		t.Cleanup(func() {
+			_ = conn.Close()
+			close(icmpConn)
+		})
+
+		return conn, icmpConn
+	}
+
+	for _, test := range []struct {
+		name     string
+		server   *net.UDPAddr
+		protocol int
+		mtu      int
+		tooSmall int
+	}{
+		{"IPv4", &net.UDPAddr{IP: net.IPv4(198, 51, 100, 1), Port: 3478}, ProtocolICMP, 1400, 500},
+		{"IPv6", &net.UDPAddr{IP: net.ParseIP("2001:db8::2"), Port: 3478}, ProtocolIPv6ICMP, 1350, 1200},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			conn, icmpConn := newConn(t, test.server, test.protocol, &mockClient{})
+			assert.Equal(t, 1500, conn.CurrentMTU())
+
+			icmpConn <- packetTooBig(t, test.server, test.mtu)
+			assert.Eventually(t, func() bool {
+				return conn.CurrentMTU() == test.mtu
+			}, time.Second, time.Millisecond)
+
+			// Neither higher MTUs, implausible ones nor packets to other
+			// hosts change the estimate. The last message shows that the
+			// ones before it were handled.
+			other := &net.UDPAddr{IP: test.server.IP, Port: test.server.Port + 1}
+			icmpConn <- packetTooBig(t, test.server, test.mtu+100)
+			icmpConn <- packetTooBig(t, test.server, test.tooSmall)
+			icmpConn <- packetTooBig(t, other, test.mtu-100)
+			icmpConn <- []byte("not ICMP")
+			icmpConn <- packetTooBig(t, test.server, test.mtu-1)
+			assert.Eventually(t, func() bool {
+				return conn.CurrentMTU() == test.mtu-1
+			}, time.Second, time.Millisecond)
+		})
+	}
+
+	t.Run("Rejects writes above the MTU", func(t *testing.T) {
+		server := &net.UDPAddr{IP: net.IPv4(198, 51, 100, 1), Port: 3478}
+		peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+		var mutex sync.Mutex
+		var sizes []int
+		client := &mockClient{writeTo: func(data []byte, _ net.Addr) (int, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			sizes = append(sizes, len(data))
+
+			return len(data), nil
+		}}
+		conn, icmpConn := newConn(t, server, ProtocolICMP, client)
+		conn.permMap.insert(peer, &permission{st: PermissionStatePermitted})
+		mustCreateBinding(t, conn.bindingMgr, peer).SetState(binding.StateReady)
+
+		icmpConn <- packetTooBig(t, server, 1000)
+		assert.Eventually(t, func() bool {
+			return conn.CurrentMTU() == 1000
+		}, time.Second, time.Millisecond)
+
+		max := 1000 - ipv4HeaderLen - udpHeaderLen - sendIndicationOverhead
+		n, err := conn.WriteTo(make([]byte, max+1), peer)
+		assert.ErrorIs(t, err, ErrPacketTooLarge)
+		assert.ErrorContains(t, err, "path MTU of 1000")
+		assert.Equal(t, 0, n)
+		_, err = conn.WriteBatch([]Message{{Payload: make([]byte, max+1), Addr: peer}})
+		assert.ErrorIs(t, err, ErrPacketTooLarge)
+
+		// A payload that fits is sent whole, ChannelData adds 4 bytes
+		n, err = conn.WriteTo(make([]byte, max), peer)
+		assert.NoError(t, err)
+		assert.Equal(t, max, n)
+		mutex.Lock()
+		defer mutex.Unlock()
+		assert.Equal(t, []int{max + 4}, sizes)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := NewUDPConn(&AllocationConfig{Client: &mockClient{}}, WithICMPListener(nil, ProtocolICMP))
+		assert.ErrorIs(t, err, errNilICMPConn)
+		_, err = NewUDPConn(&AllocationConfig{Client: &mockClient{}}, WithICMPListener(make(icmpInjector), 6))
+		assert.ErrorIs(t, err, errInvalidICMPProtocol)
+	})
+}
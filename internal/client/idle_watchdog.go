@@ -0,0 +1,67 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// touch records a send to or a receive from the TURN server, which resets
+// the idle watchdog.
+func (a *allocation) touch() {
+	a.lastActivity.Store(time.Now().UnixNano())
+}
+
+// idleFor returns how long nothing was sent to or received from the server.
+func (a *allocation) idleFor() time.Duration {
+	return time.Since(time.Unix(0, a.lastActivity.Load()))
+}
+
+// runIdleWatchdog sends a Binding request to the server whenever nothing was
+// sent or received for the idle timeout, and closes the connection if it
+// fails, as the NAT mapping to the server is likely lost. It returns once
+// ctx is done.
+func (c *UDPConn) runIdleWatchdog(ctx context.Context) {
+	timer := time.NewTimer(c.idleTimeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		if c.reconnecting.Load() {
+			timer.Reset(c.idleTimeout)
+
+			continue
+		}
+		idle := c.idleFor()
+		if idle < c.idleTimeout {
+			timer.Reset(c.idleTimeout - idle)
+
+			continue
+		}
+
+		c.log.Debugf("Nothing sent or received for %s, probing the TURN server", idle)
+		err := c.Ping(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			err = fmt.Errorf("%w: %w", errIdleProbeFailed, err)
+			c.log.Warnf("Closing: %s", err)
+			c.closeErr.Store(err)
+			if err := c.close(CloseEvent{Reason: CloseReasonIdleProbeFailed, Err: err}); err != nil {
+				c.log.Debugf("Failed to close after idle probe failure: %s", err)
+			}
+
+			return
+		}
+		timer.Reset(c.idleTimeout)
+	}
+}
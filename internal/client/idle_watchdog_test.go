@@ -0,0 +1,113 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4/binding"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUDPConnIdleWatchdog(t *testing.T) {
+	// pingClient answers Binding requests with ok, counting them
+	pingClient := func(probes *atomic.Int32, ok func() bool) *mockClient {
+		client := &mockClient{}
+		client.SetPerformTransaction(func(_ context.Context, msg *stun.Message, _ net.Addr, _ bool) (
+			TransactionResult, error,
+		) {
+			if msg.Type != stun.BindingRequest {
+				return TransactionResult{}, errFake
+			}
+			probes.Add(1)
+			if !ok() {
+				return TransactionResult{}, errFake
+			}
+
+			return TransactionResult{Msg: stun.MustBuild(stun.BindingSuccess)}, nil
+		})
+
+		return client
+	}
+
+	t.Run("Probes after the idle timeout", func(t *testing.T) {
+		var probes atomic.Int32
+		conn := newTestUDPConn(t, pingClient(&probes, func() bool { return true }), WithIdleWatchdog(30*time.Millisecond))
+
+		assert.Eventually(t, func() bool { return probes.Load() >= 2 }, time.Second, time.Millisecond)
+		select {
+		case event := <-conn.Closed():
+			t.Fatalf("closed after successful probes: %v", event)
+		default:
+		}
+	})
+
+	t.Run("Sends and receives reset the timeout", func(t *testing.T) {
+		var probes atomic.Int32
+		client := pingClient(&probes, func() bool { return true })
+		client.SetWriteTo(func(data []byte, _ net.Addr) (int, error) { return len(data), nil })
+		conn := newTestUDPConn(t, client, WithIdleWatchdog(100*time.Millisecond))
+		peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+		conn.permMap.insert(peer, &permission{st: PermissionStatePermitted})
+
+		for i := 0; i < 20; i++ {
+			if i%2 == 0 {
+				_, err := conn.WriteTo([]byte("data"), peer)
+				assert.NoError(t, err)
+			} else {
+				conn.HandleInbound([]byte("data"), peer)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.Equal(t, int32(0), probes.Load())
+
+		assert.Eventually(t, func() bool { return probes.Load() == 1 }, time.Second, time.Millisecond)
+	})
+
+	t.Run("WriteBatch resets the timeout", func(t *testing.T) {
+		var probes atomic.Int32
+		client := pingClient(&probes, func() bool { return true })
+		client.SetWriteTo(func(data []byte, _ net.Addr) (int, error) { return len(data), nil })
+		conn := newTestUDPConn(t, client, WithIdleWatchdog(100*time.Millisecond))
+		peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+		conn.permMap.insert(peer, &permission{st: PermissionStatePermitted})
+		// Sent as ChannelData frames, not through WriteTo
+		mustCreateBinding(t, conn.bindingMgr, peer).SetState(binding.StateReady)
+
+		for i := 0; i < 20; i++ {
+			n, err := conn.WriteBatch([]Message{{Payload: []byte("data"), Addr: peer}})
+			assert.NoError(t, err)
+			assert.Equal(t, 1, n)
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.Equal(t, int32(0), probes.Load())
+	})
+
+	t.Run("Failed probe closes", func(t *testing.T) {
+		var probes atomic.Int32
+		conn := newTestUDPConn(t, pingClient(&probes, func() bool { return false }), WithIdleWatchdog(20*time.Millisecond))
+
+		select {
+		case event := <-conn.Closed():
+			assert.Equal(t, CloseReasonIdleProbeFailed, event.Reason)
+			assert.ErrorIs(t, event.Err, errIdleProbeFailed)
+			assert.ErrorIs(t, event.Err, errFake)
+		case <-time.After(time.Second):
+			t.Fatal("not closed after a failed probe")
+		}
+		assert.Equal(t, int32(1), probes.Load())
+		_, err := conn.WriteTo([]byte("data"), &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000})
+		assert.ErrorIs(t, err, errIdleProbeFailed)
+	})
+
+	t.Run("Invalid timeout", func(t *testing.T) {
+		_, err := NewUDPConn(&AllocationConfig{Client: &mockClient{}}, WithIdleWatchdog(0))
+		assert.ErrorIs(t, err, errInvalidIdleTimeout)
+	})
+}
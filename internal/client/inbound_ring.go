@@ -0,0 +1,55 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"net"
+	"sync/atomic"
+)
+
+// inboundRing is a bounded set of reusable slots for received packets.
+// HandleInbound copies each packet into a free slot and readers give the slot
+// back once they copied the data out, so the read path does not allocate once
+// the slots have grown to the packet size. Slots are created on demand.
+type inboundRing struct {
+	free    chan *inboundData
+	created atomic.Int32
+	size    int32
+}
+
+func newInboundRing(size int) *inboundRing {
+	return &inboundRing{
+		free: make(chan *inboundData, size),
+		size: int32(size), //nolint:gosec // G115, size is validated by WithReadQueueSize
+	}
+}
+
+// acquire copies data into a free slot. It returns nil if all slots are
+// waiting to be read.
+func (r *inboundRing) acquire(data []byte, from net.Addr) *inboundData {
+	var slot *inboundData
+	select {
+	case slot = <-r.free:
+	default:
+		if r.created.Add(1) > r.size {
+			r.created.Add(-1)
+
+			return nil
+		}
+		slot = &inboundData{}
+	}
+	slot.data = append(slot.data[:0], data...)
+	slot.from = from
+
+	return slot
+}
+
+// release makes slot available to acquire again.
+func (r *inboundRing) release(slot *inboundData) {
+	slot.from = nil
+	select {
+	case r.free <- slot:
+	default: // Never happens, there are at most size slots
+	}
+}
@@ -0,0 +1,37 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInboundRing(t *testing.T) {
+	from := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+	ring := newInboundRing(2)
+
+	first := ring.acquire([]byte("first"), from)
+	assert.Equal(t, "first", string(first.data))
+	assert.Equal(t, from, first.from)
+	second := ring.acquire([]byte("second"), from)
+	assert.NotNil(t, second)
+	assert.Nil(t, ring.acquire([]byte("third"), from), "all slots are in use")
+
+	// A released slot is reused without growing its buffer
+	ring.release(first)
+	third := ring.acquire([]byte("third"), from)
+	assert.Same(t, first, third)
+	assert.Equal(t, "third", string(third.data))
+	assert.Equal(t, int32(2), ring.created.Load())
+
+	ring.release(second)
+	ring.release(third)
+	allocs := testing.AllocsPerRun(100, func() {
+		ring.release(ring.acquire([]byte("steady"), from))
+	})
+	assert.Zero(t, allocs)
+}
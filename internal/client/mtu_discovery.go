@@ -0,0 +1,153 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	// Time to wait for the echo of an MTU probe before it counts as lost.
+	defaultMTUProbeTimeout = 500 * time.Millisecond
+	// Probes sent per size, so that a single loss does not lower the MTU.
+	mtuProbeAttempts = 2
+)
+
+// mtuProbeMagic starts the data of the probes sent by DiscoverMTU, followed
+// by a random token of the discovery.
+var mtuProbeMagic = []byte("pion/turn mtu probe") //nolint:gochecknoglobals
+
+const mtuProbeTokenLen = 8
+
+// mtuProbe is a DiscoverMTU in progress, waiting for the echoes of its probes.
+type mtuProbe struct {
+	peer     net.Addr
+	token    [mtuProbeTokenLen]byte
+	received chan int // Sizes of the echoed probes
+}
+
+// DiscoverMTU returns the path MTU from the TURN server to peer, the largest
+// IP packet size between 576 and 1500 bytes that is relayed to the peer and
+// back. It binary searches the sizes with Send indications carrying
+// DONT-FRAGMENT, so the peer must echo every packet it receives back to the
+// relayed address unchanged. Echoes of the probes are not returned by
+// ReadFrom. Only one discovery runs at a time.
+func (c *UDPConn) DiscoverMTU(ctx context.Context, peer net.Addr) (int, error) {
+	udpAddr, ok := peer.(*net.UDPAddr)
+	if !ok {
+		return 0, errUDPAddrCast
+	}
+
+	c.mtuMutex.Lock()
+	defer c.mtuMutex.Unlock()
+
+	probe := &mtuProbe{peer: peer, received: make(chan int, mtuProbeAttempts)}
+	if _, err := rand.Read(probe.token[:]); err != nil {
+		return 0, err
+	}
+	c.mtuProbe.Store(probe)
+	defer c.mtuProbe.Store(nil)
+
+	headerLen := ipv4HeaderLen + udpHeaderLen
+	if udpAddr.IP.To4() == nil {
+		headerLen = ipv6HeaderLen + udpHeaderLen
+	}
+
+	// The minimum is expected to be relayed, the search stays above it
+	low, high := minMTUIPv4, defaultMTU
+	if delivered, err := c.probeMTU(ctx, probe, low-headerLen); err != nil {
+		return 0, err
+	} else if !delivered {
+		return 0, fmt.Errorf("%w: no echo of %d bytes from %s", errMTUProbeFailed, low, peer)
+	}
+	for low < high {
+		mtu := (low + high + 1) / 2
+		delivered, err := c.probeMTU(ctx, probe, mtu-headerLen)
+		if err != nil {
+			return 0, err
+		}
+		if delivered {
+			low = mtu
+		} else {
+			high = mtu - 1
+		}
+	}
+	c.log.Debugf("Discovered path MTU %d to %s", low, peer)
+
+	return low, nil
+}
+
+// probeMTU sends probes with size bytes of data to the peer of probe, and
+// reports whether one of them is echoed back.
+func (c *UDPConn) probeMTU(ctx context.Context, probe *mtuProbe, size int) (bool, error) {
+	data := make([]byte, size)
+	copy(data, mtuProbeMagic)
+	copy(data[len(mtuProbeMagic):], probe.token[:])
+
+	for i := 0; i < mtuProbeAttempts; i++ {
+		if err := c.sendMTUProbe(ctx, data, probe.peer); err != nil {
+			return false, err
+		}
+
+		timer := time.NewTimer(c.mtuProbeTimeout)
+		for waiting := true; waiting; {
+			select {
+			case n := <-probe.received:
+				if n == size {
+					timer.Stop()
+
+					return true, nil
+				}
+				// A late echo of a previous probe
+			case <-timer.C:
+				waiting = false
+			case <-ctx.Done():
+				timer.Stop()
+
+				return false, ctx.Err()
+			case <-c.closeCh:
+				timer.Stop()
+
+				return false, c.closedError()
+			}
+		}
+	}
+
+	return false, nil
+}
+
+func (c *UDPConn) sendMTUProbe(ctx context.Context, data []byte, peer net.Addr) error {
+	if err := c.beginWrite(); err != nil {
+		return err
+	}
+	defer c.inflight.Done()
+
+	_, err := c.writeTo(ctx, data, peer, SendOptions{DontFragment: true})
+
+	return err
+}
+
+// handleMTUProbe reports whether data from addr is the echo of a probe of
+// the DiscoverMTU in progress, and hands it to it.
+func (c *UDPConn) handleMTUProbe(data []byte, from net.Addr) bool {
+	probe := c.mtuProbe.Load()
+	if probe == nil || len(data) < len(mtuProbeMagic)+mtuProbeTokenLen ||
+		!bytes.HasPrefix(data, mtuProbeMagic) ||
+		!bytes.Equal(data[len(mtuProbeMagic):len(mtuProbeMagic)+mtuProbeTokenLen], probe.token[:]) ||
+		from.String() != probe.peer.String() {
+		return false
+	}
+
+	select {
+	case probe.received <- len(data):
+	default:
+	}
+
+	return true
+}
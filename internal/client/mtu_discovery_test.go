@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4/internal/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUDPConnDiscoverMTU(t *testing.T) {
+	peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+
+	// newEchoConn returns a UDPConn whose peer echoes the probes of IP
+	// packets up to dropAbove bytes, unless lose drops them first
+	newEchoConn := func(t *testing.T, dropAbove int, lose func() bool) (*UDPConn, *atomic.Int32) {
+		t.Helper()
+
+		var probes atomic.Int32
+		var conn *UDPConn
+		client := &mockClient{}
+		client.SetWriteTo(func(raw []byte, _ net.Addr) (int, error) {
+			msg := &stun.Message{Raw: append([]byte(nil), raw...)}
+			assert.NoError(t, msg.Decode())
+			assert.True(t, msg.Contains(stun.AttrDontFragment))
+			var data proto.Data
+			assert.NoError(t, data.GetFrom(msg))
+			probes.Add(1)
+			if len(data)+ipv4HeaderLen+udpHeaderLen <= dropAbove && (lose == nil || !lose()) {
+				conn.HandleInbound(data, peer)
+			}
+
+			return len(raw), nil
+		})
+		conn = newTestUDPConn(t, client)
+		conn.mtuProbeTimeout = 5 * time.Millisecond
+		conn.permMap.insert(peer, &permission{st: PermissionStatePermitted})
+
+		return conn, &probes
+	}
+
+	t.Run("Converges", func(t *testing.T) {
+		for _, test := range []struct {
+			dropAbove, mtu int
+		}{
+			{576, 576},
+			{577, 577},
+			{1000, 1000},
+			{1280, 1280},
+			{1499, 1499},
+			{1500, 1500},
+			{9000, 1500},
+		} {
+			conn, probes := newEchoConn(t, test.dropAbove, nil)
+			mtu, err := conn.DiscoverMTU(context.Background(), peer)
+			assert.NoError(t, err)
+			assert.Equal(t, test.mtu, mtu, "dropping above %d", test.dropAbove)
+			// The minimum and a binary search of the 924 sizes above it,
+			// each lost probe is sent twice
+			assert.LessOrEqual(t, probes.Load(), int32(1+2*10))
+		}
+	})
+
+	t.Run("Retries lost probes", func(t *testing.T) {
+		var sent atomic.Int32
+		conn, _ := newEchoConn(t, 1200, func() bool { return sent.Add(1)%2 == 1 })
+		mtu, err := conn.DiscoverMTU(context.Background(), peer)
+		assert.NoError(t, err)
+		assert.Equal(t, 1200, mtu)
+	})
+
+	t.Run("No echo", func(t *testing.T) {
+		conn, probes := newEchoConn(t, 0, nil)
+		_, err := conn.DiscoverMTU(context.Background(), peer)
+		assert.ErrorIs(t, err, errMTUProbeFailed)
+		assert.Equal(t, int32(mtuProbeAttempts), probes.Load())
+	})
+
+	t.Run("Echoes are not read", func(t *testing.T) {
+		conn, _ := newEchoConn(t, 1500, nil)
+		_, err := conn.DiscoverMTU(context.Background(), peer)
+		assert.NoError(t, err)
+		assert.Empty(t, conn.readCh)
+
+		// Data after the discovery is read as usual
+		conn.HandleInbound([]byte("data"), peer)
+		assert.Len(t, conn.readCh, 1)
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		conn, _ := newEchoConn(t, 0, nil)
+		conn.mtuProbeTimeout = time.Minute
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err := conn.DiscoverMTU(ctx, peer)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("Invalid peer", func(t *testing.T) {
+		conn, _ := newEchoConn(t, 1500, nil)
+		_, err := conn.DiscoverMTU(context.Background(), &net.TCPAddr{IP: peer.IP, Port: peer.Port})
+		assert.ErrorIs(t, err, errUDPAddrCast)
+	})
+}
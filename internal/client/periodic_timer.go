@@ -15,6 +15,7 @@ type PeriodicTimerTimeoutHandler func(timerID int)
 type PeriodicTimer struct {
 	id             int
 	interval       time.Duration
+	intervalFunc   func() time.Duration
 	timeoutHandler PeriodicTimerTimeoutHandler
 	stopFunc       func()
 	mutex          sync.RWMutex
@@ -29,6 +30,28 @@ func NewPeriodicTimer(id int, timeoutHandler PeriodicTimerTimeoutHandler, interv
 	}
 }
 
+// NewPeriodicTimerFunc creates a new timer whose interval is recomputed by
+// intervalFunc before every period, e.g. to add jitter.
+func NewPeriodicTimerFunc(
+	id int,
+	timeoutHandler PeriodicTimerTimeoutHandler,
+	intervalFunc func() time.Duration,
+) *PeriodicTimer {
+	return &PeriodicTimer{
+		id:             id,
+		intervalFunc:   intervalFunc,
+		timeoutHandler: timeoutHandler,
+	}
+}
+
+func (t *PeriodicTimer) nextInterval() time.Duration {
+	if t.intervalFunc != nil {
+		return t.intervalFunc()
+	}
+
+	return t.interval
+}
+
 // Start starts the timer.
 func (t *PeriodicTimer) Start() bool {
 	t.mutex.Lock()
@@ -45,7 +68,7 @@ func (t *PeriodicTimer) Start() bool {
 		canceling := false
 
 		for !canceling {
-			timer := time.NewTimer(t.interval)
+			timer := time.NewTimer(t.nextInterval())
 
 			select {
 			case <-timer.C:
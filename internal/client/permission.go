@@ -5,49 +5,169 @@ package client
 
 import (
 	"net"
+	"sort"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/pion/turn/v4/internal/ipnet"
 )
 
-type permState int32
+// PermissionState is the state of a permission.
+type PermissionState int32
 
 const (
-	permStateIdle permState = iota
-	permStatePermitted
+	// PermissionStateIdle is a permission for which no CreatePermission was sent yet.
+	PermissionStateIdle PermissionState = iota
+	// PermissionStatePermitted is a permission granted by the server.
+	PermissionStatePermitted
+	// PermissionStatePending is a permission whose CreatePermission is in flight.
+	PermissionStatePending
+	// PermissionStateFailed is a permission whose last CreatePermission was
+	// rejected or failed.
+	PermissionStateFailed
 )
 
+func (s PermissionState) String() string {
+	switch s {
+	case PermissionStateIdle:
+		return "idle"
+	case PermissionStatePermitted:
+		return "permitted"
+	case PermissionStatePending:
+		return "pending"
+	case PermissionStateFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// PermissionInfo describes a permission as of a PermissionMap.List call.
+type PermissionInfo struct {
+	Addr        net.Addr // Peer address, the port is ignored by the server
+	State       PermissionState
+	CreatedAt   time.Time // When the permission was first requested
+	RefreshedAt time.Time // When the server last granted the permission, or CreatedAt
+	ExpiresAt   time.Time // RefreshedAt plus the permission lifetime
+}
+
 type permission struct {
-	addr  net.Addr
-	st    permState    // Thread-safe (atomic op)
-	mutex sync.RWMutex // Thread-safe
+	addr         net.Addr
+	createdAt    time.Time       // Set by insert
+	st           PermissionState // Thread-safe (atomic op)
+	done         chan struct{}   // Protected by mutex, closed when the pending request completes
+	err          error           // Protected by mutex, result of the last request
+	_refreshedAt time.Time       // Protected by mutex
+	mutex        sync.RWMutex    // Thread-safe
 }
 
-func (p *permission) setState(state permState) {
+func (p *permission) setState(state PermissionState) {
 	atomic.StoreInt32((*int32)(&p.st), int32(state))
 }
 
-func (p *permission) state() permState {
-	return permState(atomic.LoadInt32((*int32)(&p.st)))
+func (p *permission) state() PermissionState {
+	return PermissionState(atomic.LoadInt32((*int32)(&p.st)))
+}
+
+func (p *permission) setRefreshedAt(at time.Time) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p._refreshedAt = at
+}
+
+func (p *permission) refreshedAt() time.Time {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return p._refreshedAt
+}
+
+// begin moves an idle, failed or expired permission to pending. It returns the
+// channel that is closed once the request completes, or nil if the permission
+// is granted and younger than lifetime. initiator reports whether the caller
+// must send the request.
+func (p *permission) begin(lifetime time.Duration) (done <-chan struct{}, initiator bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	switch {
+	case p.state() == PermissionStatePermitted && time.Since(p._refreshedAt) < lifetime:
+		return nil, false
+	case p.state() == PermissionStatePending:
+		return p.done, false
+	default:
+		p.done = make(chan struct{})
+		p.err = nil
+		p.setState(PermissionStatePending)
+
+		return p.done, true
+	}
+}
+
+// expired reports whether the permission failed, or was granted or created
+// more than lifetime ago without a refresh. Pending permissions never expire.
+func (p *permission) expired(lifetime time.Duration, now time.Time) bool {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	switch p.state() {
+	case PermissionStateFailed:
+		return true
+	case PermissionStatePending:
+		return false
+	default:
+		return now.Sub(p._refreshedAt) >= lifetime
+	}
+}
+
+// finish completes the pending request with err and wakes up all waiters.
+func (p *permission) finish(err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.err = err
+	if err != nil {
+		p.setState(PermissionStateFailed)
+	} else {
+		p._refreshedAt = time.Now()
+		p.setState(PermissionStatePermitted)
+	}
+	close(p.done)
+}
+
+func (p *permission) result() error {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return p.err
 }
 
-// Thread-safe permission map.
-type permissionMap struct {
-	permMap map[string]*permission
-	mutex   sync.RWMutex
+// PermissionMap is the thread-safe set of permissions of an allocation,
+// indexed by peer IP address.
+type PermissionMap struct {
+	permMap  map[string]*permission
+	lifetime time.Duration // Read-only once the allocation is created
+	mutex    sync.RWMutex
 }
 
-func (m *permissionMap) insert(addr net.Addr, p *permission) bool {
+func (m *PermissionMap) insert(addr net.Addr, p *permission) bool {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 	p.addr = addr
+	if p.refreshedAt().IsZero() {
+		p.setRefreshedAt(time.Now())
+	}
+	if p.createdAt.IsZero() {
+		p.createdAt = p.refreshedAt()
+	}
 	m.permMap[ipnet.FingerprintAddr(addr)] = p
 
 	return true
 }
 
-func (m *permissionMap) find(addr net.Addr) (*permission, bool) {
+func (m *PermissionMap) find(addr net.Addr) (*permission, bool) {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
 	p, ok := m.permMap[ipnet.FingerprintAddr(addr)]
@@ -55,13 +175,56 @@ func (m *permissionMap) find(addr net.Addr) (*permission, bool) {
 	return p, ok
 }
 
-func (m *permissionMap) delete(addr net.Addr) {
+func (m *PermissionMap) delete(addr net.Addr) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 	delete(m.permMap, ipnet.FingerprintAddr(addr))
 }
 
-func (m *permissionMap) addrs() []net.Addr {
+// expired returns the addresses of the permissions that failed or outlived
+// lifetime, see permission.expired.
+func (m *PermissionMap) expired(lifetime time.Duration, now time.Time) []net.Addr {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	addrs := []net.Addr{}
+	for _, p := range m.permMap {
+		if p.expired(lifetime, now) {
+			addrs = append(addrs, p.addr)
+		}
+	}
+
+	return addrs
+}
+
+// deleteExpired deletes the permission of addr if it is still expired, so a
+// permission requested again since expired was called is kept.
+func (m *PermissionMap) deleteExpired(addr net.Addr, lifetime time.Duration, now time.Time) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	key := ipnet.FingerprintAddr(addr)
+	if p, ok := m.permMap[key]; !ok || !p.expired(lifetime, now) {
+		return false
+	}
+	delete(m.permMap, key)
+
+	return true
+}
+
+func (m *PermissionMap) all() []*permission {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	perms := make([]*permission, 0, len(m.permMap))
+	for _, p := range m.permMap {
+		perms = append(perms, p)
+	}
+
+	return perms
+}
+
+func (m *PermissionMap) addrs() []net.Addr {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
 
@@ -73,8 +236,33 @@ func (m *permissionMap) addrs() []net.Addr {
 	return addrs
 }
 
-func newPermissionMap() *permissionMap {
-	return &permissionMap{
-		permMap: map[string]*permission{},
+// List returns all permissions ordered by address, e.g. to find the ones
+// about to expire.
+func (m *PermissionMap) List() []PermissionInfo {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	infos := make([]PermissionInfo, 0, len(m.permMap))
+	for _, p := range m.permMap {
+		refreshedAt := p.refreshedAt()
+		infos = append(infos, PermissionInfo{
+			Addr:        p.addr,
+			State:       p.state(),
+			CreatedAt:   p.createdAt,
+			RefreshedAt: refreshedAt,
+			ExpiresAt:   refreshedAt.Add(m.lifetime),
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Addr.String() < infos[j].Addr.String()
+	})
+
+	return infos
+}
+
+func newPermissionMap() *PermissionMap {
+	return &PermissionMap{
+		permMap:  map[string]*permission{},
+		lifetime: defaultPermLifetime,
 	}
 }
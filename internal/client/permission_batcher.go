@@ -0,0 +1,70 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// permissionBatcher coalesces permission requests made within a short window
+// into a single CreatePermission request carrying several XOR-PEER-ADDRESS
+// attributes, as allowed by RFC 5766 Section 9.
+type permissionBatcher struct {
+	window  time.Duration                                      // Read-only
+	send    func(ctx context.Context, addrs ...net.Addr) error // Read-only
+	pending *permissionBatch                                   // Protected by mutex
+	mutex   sync.Mutex
+}
+
+type permissionBatch struct {
+	addrs []net.Addr
+	err   error
+	done  chan struct{}
+}
+
+func newPermissionBatcher(
+	window time.Duration,
+	send func(ctx context.Context, addrs ...net.Addr) error,
+) *permissionBatcher {
+	return &permissionBatcher{
+		window: window,
+		send:   send,
+	}
+}
+
+// request adds addr to the batch currently being collected, opening a new one
+// if there is none, and blocks until that batch has been answered or ctx is done.
+// The transaction itself is shared, so canceling ctx only stops the wait.
+func (b *permissionBatcher) request(ctx context.Context, addr net.Addr) error {
+	b.mutex.Lock()
+	batch := b.pending
+	if batch == nil {
+		batch = &permissionBatch{done: make(chan struct{})}
+		b.pending = batch
+		time.AfterFunc(b.window, func() { b.flush(batch) })
+	}
+	batch.addrs = append(batch.addrs, addr)
+	b.mutex.Unlock()
+
+	select {
+	case <-batch.done:
+		return batch.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *permissionBatcher) flush(batch *permissionBatch) {
+	b.mutex.Lock()
+	if b.pending == batch {
+		b.pending = nil
+	}
+	b.mutex.Unlock()
+
+	batch.err = b.send(context.Background(), batch.addrs...)
+	close(batch.done)
+}
@@ -0,0 +1,96 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPermissionBatcher(t *testing.T) {
+	type sent struct {
+		addrs []net.Addr
+	}
+
+	newBatcher := func(window time.Duration, err error) (*permissionBatcher, func() []sent) {
+		var mu sync.Mutex
+		var msgs []sent
+		batcher := newPermissionBatcher(window, func(_ context.Context, addrs ...net.Addr) error {
+			mu.Lock()
+			defer mu.Unlock()
+			msgs = append(msgs, sent{addrs: addrs})
+
+			return err
+		})
+
+		return batcher, func() []sent {
+			mu.Lock()
+			defer mu.Unlock()
+
+			return append([]sent(nil), msgs...)
+		}
+	}
+
+	t.Run("requests within the window share one message", func(t *testing.T) {
+		batcher, msgs := newBatcher(50*time.Millisecond, nil)
+
+		const numPeers = 10
+		var wg sync.WaitGroup
+		for i := 0; i < numPeers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				assert.NoError(t, batcher.request(context.Background(), &net.UDPAddr{IP: net.IPv4(10, 0, 0, byte(i))}))
+			}(i)
+		}
+		wg.Wait()
+
+		assert.Len(t, msgs(), 1)
+		assert.Len(t, msgs()[0].addrs, numPeers)
+	})
+
+	t.Run("request after the window gets its own message", func(t *testing.T) {
+		batcher, msgs := newBatcher(time.Millisecond, nil)
+
+		assert.NoError(t, batcher.request(context.Background(), &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1)}))
+		assert.NoError(t, batcher.request(context.Background(), &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2)}))
+
+		assert.Len(t, msgs(), 2)
+		assert.Len(t, msgs()[0].addrs, 1)
+		assert.Len(t, msgs()[1].addrs, 1)
+	})
+
+	t.Run("error is reported to every waiter", func(t *testing.T) {
+		batcher, _ := newBatcher(10*time.Millisecond, errFake)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				err := batcher.request(context.Background(), &net.UDPAddr{IP: net.IPv4(10, 0, 0, byte(i))})
+				assert.ErrorIs(t, err, errFake)
+			}(i)
+		}
+		wg.Wait()
+	})
+
+	t.Run("canceled wait", func(t *testing.T) {
+		batcher, msgs := newBatcher(50*time.Millisecond, nil)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.ErrorIs(t, batcher.request(ctx, &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1)}), context.Canceled)
+
+		// The batch is still sent for the other waiters
+		assert.Eventually(t, func() bool {
+			return len(msgs()) == 1
+		}, time.Second, 5*time.Millisecond)
+	})
+}
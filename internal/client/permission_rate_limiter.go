@@ -0,0 +1,71 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// PermissionRateLimiter decides whether a CreatePermission request may be sent
+// for a new permission, e.g. to stay below the quota of a TURN server that
+// answers bursts of requests with 486 Allocation Quota Reached.
+type PermissionRateLimiter interface {
+	// Allow reports whether a permission for addr may be requested now. It
+	// must not block.
+	Allow(addr net.Addr) bool
+}
+
+// tokenBucket is a PermissionRateLimiter shared by all peers. It holds up to
+// burst tokens, refilled at rate tokens per second, and every allowed request
+// takes one.
+type tokenBucket struct {
+	rate   float64          // Read-only
+	burst  float64          // Read-only
+	now    func() time.Time // Read-only
+	tokens float64          // Protected by mutex
+	last   time.Time        // Protected by mutex
+	mutex  sync.Mutex
+}
+
+// NewTokenBucketRateLimiter returns a PermissionRateLimiter allowing bursts of
+// up to burst requests and rate requests per second on average. A burst below
+// one is treated as one.
+func NewTokenBucketRateLimiter(rate float64, burst int) PermissionRateLimiter {
+	return newTokenBucket(rate, burst, time.Now)
+}
+
+func newTokenBucket(rate float64, burst int, now func() time.Time) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		now:    now,
+		tokens: float64(burst),
+		last:   now(),
+	}
+}
+
+// Allow implements PermissionRateLimiter.
+func (b *tokenBucket) Allow(net.Addr) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	now := b.now()
+	if elapsed := now.Sub(b.last); elapsed > 0 && b.rate > 0 {
+		b.tokens = min(b.burst, b.tokens+elapsed.Seconds()*b.rate)
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+
+	return true
+}
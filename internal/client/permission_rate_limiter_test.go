@@ -0,0 +1,35 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenBucket(t *testing.T) {
+	peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+	now := time.Now()
+	bucket := newTokenBucket(2, 3, func() time.Time { return now })
+
+	for i := 0; i < 3; i++ {
+		assert.True(t, bucket.Allow(peer), "request %d should fit in the burst", i)
+	}
+	assert.False(t, bucket.Allow(peer), "request beyond the burst should be rejected")
+
+	now = now.Add(500 * time.Millisecond)
+	assert.True(t, bucket.Allow(peer), "one token should be refilled")
+	assert.False(t, bucket.Allow(peer))
+
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		assert.True(t, bucket.Allow(peer), "refill should stop at the burst")
+	}
+	assert.False(t, bucket.Allow(peer))
+
+	assert.True(t, newTokenBucket(0, 0, time.Now).Allow(peer), "burst should be at least one")
+}
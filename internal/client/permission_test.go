@@ -8,6 +8,7 @@ import (
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -16,9 +17,42 @@ func TestPermission(t *testing.T) {
 	t.Run("Getter and setter", func(t *testing.T) {
 		perm := &permission{}
 
-		assert.Equal(t, permStateIdle, perm.state())
-		perm.setState(permStatePermitted)
-		assert.Equal(t, permStatePermitted, perm.state())
+		assert.Equal(t, PermissionStateIdle, perm.state())
+		perm.setState(PermissionStatePermitted)
+		assert.Equal(t, PermissionStatePermitted, perm.state())
+	})
+
+	t.Run("Pending lifecycle", func(t *testing.T) {
+		perm := &permission{}
+
+		done, initiator := perm.begin(time.Minute)
+		assert.True(t, initiator)
+		assert.Equal(t, PermissionStatePending, perm.state())
+
+		waitDone, waitInitiator := perm.begin(time.Minute)
+		assert.False(t, waitInitiator, "only one caller should send the request")
+		assert.Equal(t, done, waitDone)
+
+		perm.finish(errFake)
+		<-done
+		assert.Equal(t, PermissionStateFailed, perm.state())
+		assert.ErrorIs(t, perm.result(), errFake)
+
+		// A failed permission may be requested again
+		done, initiator = perm.begin(time.Minute)
+		assert.True(t, initiator)
+		perm.finish(nil)
+		<-done
+		assert.Equal(t, PermissionStatePermitted, perm.state())
+		assert.NoError(t, perm.result())
+
+		done, _ = perm.begin(time.Minute)
+		assert.Nil(t, done, "granted permission needs no request")
+
+		// An expired permission must be requested again
+		perm.setRefreshedAt(time.Now().Add(-2 * time.Minute))
+		_, initiator = perm.begin(time.Minute)
+		assert.True(t, initiator)
 	})
 }
 
@@ -28,9 +62,9 @@ func TestPermissionMap(t *testing.T) {
 		assert.NotNil(t, pm)
 		assert.NotNil(t, pm.permMap)
 
-		perm1 := &permission{st: permStateIdle}
-		perm2 := &permission{st: permStatePermitted}
-		perm3 := &permission{st: permStateIdle}
+		perm1 := &permission{st: PermissionStateIdle}
+		perm2 := &permission{st: PermissionStatePermitted}
+		perm3 := &permission{st: PermissionStateIdle}
 		udpAddr1, _ := net.ResolveUDPAddr("udp", "1.2.3.4:5000")
 		udpAddr2, _ := net.ResolveUDPAddr("udp", "5.6.7.8:8888")
 		tcpAddr, _ := net.ResolveTCPAddr("tcp", "7.8.9.10:5000")
@@ -44,17 +78,17 @@ func TestPermissionMap(t *testing.T) {
 		perms, ok := pm.find(udpAddr1)
 		assert.True(t, ok)
 		assert.Equal(t, perm1, perms)
-		assert.Equal(t, permStateIdle, perms.st)
+		assert.Equal(t, PermissionStateIdle, perms.st)
 
 		perms, ok = pm.find(udpAddr2)
 		assert.True(t, ok)
 		assert.Equal(t, perm2, perms)
-		assert.Equal(t, permStatePermitted, perms.st)
+		assert.Equal(t, PermissionStatePermitted, perms.st)
 
 		perms, ok = pm.find(tcpAddr)
 		assert.True(t, ok)
 		assert.Equal(t, perm3, perms)
-		assert.Equal(t, permStateIdle, perms.st)
+		assert.Equal(t, PermissionStateIdle, perms.st)
 
 		addrs := pm.addrs()
 		ips := []net.IP{}
@@ -90,4 +124,81 @@ func TestPermissionMap(t *testing.T) {
 		pm.delete(udpAddr2)
 		assert.Equal(t, 0, len(pm.permMap))
 	})
+
+	t.Run("List", func(t *testing.T) {
+		pm := newPermissionMap()
+		assert.Empty(t, pm.List())
+
+		refreshed := time.Now().Add(-time.Minute)
+		refreshedPerm := &permission{st: PermissionStatePermitted}
+		refreshedPerm.setRefreshedAt(refreshed)
+		pm.insert(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 5000}, refreshedPerm)
+		pm.insert(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}, &permission{st: PermissionStatePending})
+
+		infos := pm.List()
+		if assert.Len(t, infos, 2, "one entry per permission") {
+			assert.Equal(t, "10.0.0.1:5000", infos[0].Addr.String())
+			assert.Equal(t, PermissionStatePending, infos[0].State)
+			assert.Equal(t, infos[0].CreatedAt, infos[0].RefreshedAt)
+			assert.True(t, infos[0].ExpiresAt.After(time.Now()), "fresh permissions expire in the future")
+			assert.Equal(t, defaultPermLifetime, infos[0].ExpiresAt.Sub(infos[0].CreatedAt))
+
+			assert.Equal(t, "10.0.0.2:5000", infos[1].Addr.String())
+			assert.Equal(t, "permitted", infos[1].State.String())
+			assert.Equal(t, refreshed.Add(defaultPermLifetime), infos[1].ExpiresAt)
+		}
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		pm := newPermissionMap()
+		now := time.Now()
+		peer := func(i byte) net.Addr {
+			return &net.UDPAddr{IP: net.IPv4(10, 0, 0, i), Port: 5000}
+		}
+		for i, tc := range []struct {
+			state   PermissionState
+			age     time.Duration
+			expired bool
+		}{
+			{PermissionStatePermitted, time.Second, false},
+			{PermissionStatePermitted, 2 * time.Minute, true},
+			{PermissionStateIdle, 2 * time.Minute, true},
+			{PermissionStateFailed, time.Second, true},
+			{PermissionStatePending, 2 * time.Minute, false},
+		} {
+			perm := &permission{st: tc.state, _refreshedAt: now.Add(-tc.age)}
+			assert.True(t, pm.insert(peer(byte(i)), perm))
+			assert.Equal(t, tc.expired, perm.expired(time.Minute, now), "state %d, age %s", tc.state, tc.age)
+		}
+
+		expired := pm.expired(time.Minute, now)
+		assert.ElementsMatch(t, []net.Addr{peer(1), peer(2), peer(3)}, expired)
+		for _, addr := range expired {
+			assert.True(t, pm.deleteExpired(addr, time.Minute, now))
+		}
+		assert.Equal(t, 2, len(pm.permMap))
+
+		// Not removed once requested again
+		perm := &permission{st: PermissionStateFailed}
+		assert.True(t, pm.insert(peer(5), perm))
+		perm.begin(time.Minute)
+		assert.False(t, pm.deleteExpired(peer(5), time.Minute, now))
+		assert.False(t, pm.deleteExpired(peer(6), time.Minute, now))
+	})
+
+	t.Run("IPv6 normalization", func(t *testing.T) {
+		pm := newPermissionMap()
+		perm := &permission{}
+
+		assert.True(t, pm.insert(&net.UDPAddr{IP: net.ParseIP("fe80::1"), Zone: "lo", Port: 5000}, perm))
+		found, ok := pm.find(&net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: 5000})
+		assert.True(t, ok, "zone should be ignored")
+		assert.Equal(t, perm, found)
+
+		assert.True(t, pm.insert(&net.UDPAddr{IP: net.ParseIP("::ffff:127.0.0.1"), Port: 5000}, perm))
+		found, ok = pm.find(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1).To4(), Port: 5000})
+		assert.True(t, ok, "IPv4-mapped IPv6 should match IPv4")
+		assert.Equal(t, perm, found)
+		assert.Equal(t, 2, len(pm.permMap))
+	})
 }
@@ -0,0 +1,136 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4/binding"
+	"github.com/pion/turn/v4/internal/proto"
+)
+
+// Reallocation is the allocation that replaces the one of a UDPConn on
+// Reconnect.
+type Reallocation struct {
+	RelayedAddr    net.Addr
+	MappedAddr     net.Addr // May be nil
+	Nonce          stun.Nonce
+	Lifetime       time.Duration
+	MobilityTicket proto.MobilityTicket
+}
+
+// ReallocateFunc requests a new allocation, e.g. on the conn that replaced a
+// lost one.
+type ReallocateFunc func() (Reallocation, error)
+
+// Reconnect moves the UDPConn to a new allocation returned by reallocate,
+// e.g. after the client conn was replaced and the old allocation can no
+// longer be reached. The permissions and channel bindings of the UDPConn are
+// created again on the new allocation, whose relayed address is returned by
+// LocalAddr from then on.
+//
+// Writes fail with ErrReconnecting until Reconnect returns, and the refresh
+// timers are paused. If reallocate fails the UDPConn keeps its allocation.
+// Permissions and bindings that could not be created again are reported in
+// the returned error, but the UDPConn is reconnected and the next write
+// requests them again.
+func (c *UDPConn) Reconnect(ctx context.Context, reallocate ReallocateFunc) error {
+	select {
+	case <-c.closeCh:
+		return c.closedError()
+	default:
+	}
+	if !c.reconnecting.CompareAndSwap(false, true) {
+		return ErrReconnecting
+	}
+	defer c.reconnecting.Store(false)
+
+	realloc, err := reallocate()
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	c._relayedAddr = realloc.RelayedAddr
+	c._mappedAddr = realloc.MappedAddr
+	c._nonce.Store(&realloc.Nonce)
+	c._lifetime = realloc.Lifetime
+	c._mobilityTicket = append(proto.MobilityTicket(nil), realloc.MobilityTicket...)
+	c.mutex.Unlock()
+	logEvent(c.log, "Allocation reconnected", slog.String("relayed", realloc.RelayedAddr.String()))
+
+	return errors.Join(c.recreatePermissions(ctx), c.recreateBindings(ctx))
+}
+
+// recreatePermissions requests the granted permissions on the new allocation
+// in a single CreatePermission request.
+func (c *UDPConn) recreatePermissions(ctx context.Context) error {
+	perms := []*permission{}
+	addrs := []net.Addr{}
+	for _, perm := range c.permMap.all() {
+		if perm.state() == PermissionStatePermitted {
+			perms = append(perms, perm)
+			addrs = append(addrs, perm.addr)
+		}
+	}
+	if len(addrs) == 0 {
+		return nil
+	}
+
+	var err error
+	for i := 0; i < maxRetryAttempts; i++ {
+		if err = c.createPermissions(ctx, addrs...); !errors.Is(err, errTryAgain) {
+			break
+		}
+	}
+	if err != nil {
+		// Make the next write request them again
+		for _, perm := range perms {
+			perm.setState(PermissionStateFailed)
+		}
+
+		return fmt.Errorf("%w: %w", errFailedToRecreatePermissions, err)
+	}
+
+	now := time.Now()
+	for _, perm := range perms {
+		perm.setRefreshedAt(now)
+	}
+
+	return nil
+}
+
+// recreateBindings binds the ready channels again, keeping their numbers.
+func (c *UDPConn) recreateBindings(ctx context.Context) error {
+	var errs []error
+	for _, bound := range c.bindingMgr.All() {
+		if !bound.OK() {
+			// Idle or failed bindings are bound by the next write
+			continue
+		}
+
+		c.applyBindingInput(bound, binding.InputRebind)
+		if err := c.bindWithRetry(ctx, bound); err != nil {
+			c.stats.bindingErrors.Add(1)
+			c.events.add(EventBindingFailed, bound.Addr(), fmt.Sprintf("channel 0x%x: %s", bound.Number(), err))
+			c.applyBindingInput(bound, binding.InputFailed)
+			c.scheduleBindingRecovery(bound)
+			errs = append(errs, fmt.Errorf("%w %d: %w", errFailedToRecreateBinding, bound.Number(), err))
+
+			continue
+		}
+		bound.SetRefreshedAt(time.Now())
+		c.applyBindingInput(bound, binding.InputSucceeded)
+		c.trace.channelBound(bound.Addr(), bound.Number())
+		c.events.add(EventBindingCreated, bound.Addr(), fmt.Sprintf("channel 0x%x", bound.Number()))
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,143 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4/binding"
+	"github.com/pion/turn/v4/internal/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUDPConnReconnect(t *testing.T) {
+	peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+	newRelayed := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 9), Port: 6000}
+
+	// newReconnectConn returns a conn with a permission and a channel bound to
+	// peer, whose transactions are recorded.
+	newReconnectConn := func(t *testing.T, respond func(*stun.Message) *stun.Message) (*UDPConn, func() []*stun.Message) {
+		t.Helper()
+
+		var requests []*stun.Message
+		var mutex sync.Mutex
+		conn := newTestUDPConn(t, &mockClient{
+			performTransaction: func(_ context.Context, msg *stun.Message, _ net.Addr, dontWait bool) (
+				TransactionResult, error,
+			) {
+				if dontWait { // Refresh sent by Close
+					return TransactionResult{}, nil
+				}
+				mutex.Lock()
+				requests = append(requests, msg)
+				mutex.Unlock()
+
+				return TransactionResult{Msg: respond(msg)}, nil
+			},
+		})
+		perm := &permission{addr: peer}
+		perm.setState(PermissionStatePermitted)
+		perm.setRefreshedAt(time.Now())
+		conn.permMap.insert(peer, perm)
+		mustCreateBinding(t, conn.bindingMgr, peer).SetState(binding.StateReady)
+
+		return conn, func() []*stun.Message {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			return append([]*stun.Message(nil), requests...)
+		}
+	}
+	success := func(req *stun.Message) *stun.Message {
+		return stun.MustBuild(stun.NewType(req.Type.Method, stun.ClassSuccessResponse))
+	}
+
+	t.Run("success", func(t *testing.T) {
+		conn, requests := newReconnectConn(t, success)
+
+		err := conn.Reconnect(context.Background(), func() (Reallocation, error) {
+			// Writes are paused meanwhile
+			_, err := conn.WriteTo([]byte("hello"), peer)
+			assert.ErrorIs(t, err, ErrReconnecting)
+			_, err = conn.WriteBatch([]Message{{Payload: []byte("hello"), Addr: peer}})
+			assert.ErrorIs(t, err, ErrReconnecting)
+			assert.ErrorIs(t, conn.Reconnect(context.Background(), nil), ErrReconnecting)
+
+			return Reallocation{
+				RelayedAddr: newRelayed,
+				Nonce:       stun.NewNonce("new-nonce"),
+				Lifetime:    time.Hour,
+			}, nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, newRelayed, conn.LocalAddr())
+		assert.Equal(t, stun.NewNonce("new-nonce"), conn.nonce())
+
+		// The permission and the channel binding are created again
+		reqs := requests()
+		assert.Len(t, reqs, 2)
+		assert.Equal(t, stun.MethodCreatePermission, reqs[0].Type.Method)
+		assert.Equal(t, stun.MethodChannelBind, reqs[1].Type.Method)
+		var peerAddr proto.PeerAddress
+		assert.NoError(t, peerAddr.GetFrom(reqs[1]))
+		assert.True(t, peerAddr.IP.Equal(peer.IP))
+		bound, ok := conn.bindingMgr.FindByAddr(peer)
+		assert.True(t, ok)
+		assert.Equal(t, binding.StateReady, bound.State())
+
+		_, err = conn.WriteTo([]byte("hello"), peer)
+		assert.NoError(t, err)
+	})
+
+	t.Run("reallocation fails", func(t *testing.T) {
+		conn, requests := newReconnectConn(t, success)
+		relayed := conn.LocalAddr()
+
+		err := conn.Reconnect(context.Background(), func() (Reallocation, error) {
+			return Reallocation{}, errFake
+		})
+		assert.ErrorIs(t, err, errFake)
+		assert.Equal(t, relayed, conn.LocalAddr())
+		assert.Empty(t, requests())
+
+		_, err = conn.WriteTo([]byte("hello"), peer)
+		assert.NoError(t, err, "writes should resume")
+	})
+
+	t.Run("permissions rejected", func(t *testing.T) {
+		conn, _ := newReconnectConn(t, func(req *stun.Message) *stun.Message {
+			if req.Type.Method == stun.MethodCreatePermission {
+				return stun.MustBuild(stun.NewType(req.Type.Method, stun.ClassErrorResponse), stun.CodeForbidden)
+			}
+
+			return success(req)
+		})
+
+		err := conn.Reconnect(context.Background(), func() (Reallocation, error) {
+			return Reallocation{RelayedAddr: newRelayed, Lifetime: time.Hour}, nil
+		})
+		assert.ErrorIs(t, err, errFailedToRecreatePermissions)
+		assert.Equal(t, newRelayed, conn.LocalAddr(), "the conn should be reconnected regardless")
+		perm, ok := conn.permMap.find(peer)
+		assert.True(t, ok)
+		assert.Equal(t, PermissionStateFailed, perm.state())
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		conn, _ := newReconnectConn(t, success)
+		assert.NoError(t, conn.Close())
+
+		err := conn.Reconnect(context.Background(), func() (Reallocation, error) {
+			t.Fatal("should not reallocate")
+
+			return Reallocation{}, nil
+		})
+		assert.ErrorIs(t, err, errClosed)
+	})
+}
@@ -0,0 +1,84 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/pion/randutil"
+)
+
+//nolint:gochecknoglobals
+var globalMathRandomGenerator = randutil.NewMathRandomGenerator()
+
+// RetryPolicy controls how a ChannelBind request that failed with a stale
+// nonce is retried. The first retry is sent at once with the new nonce, the
+// delay before retry n (1-based) is InitialInterval * Multiplier^(n-2),
+// randomized by +/- Jitter.
+type RetryPolicy struct {
+	InitialInterval time.Duration // Delay before the first retry that backs off
+	Multiplier      float64       // Growth factor of the delay, must be >= 1
+	MaxRetries      int           // Retries before the binding is marked as failed
+	Jitter          float64       // Randomization factor in [0, 1)
+}
+
+// DefaultRetryPolicy returns the RetryPolicy used when none is configured.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		InitialInterval: 100 * time.Millisecond,
+		Multiplier:      2,
+		MaxRetries:      maxRetryAttempts - 1,
+		Jitter:          0.2,
+	}
+}
+
+func (p RetryPolicy) validate() error {
+	switch {
+	case p.InitialInterval < 0:
+		return errNegativeRetryInterval
+	case p.Multiplier < 1:
+		return errInvalidRetryMultiplier
+	case p.MaxRetries < 0:
+		return errNegativeMaxRetries
+	case p.Jitter < 0 || p.Jitter >= 1:
+		return errInvalidRetryJitter
+	}
+
+	return nil
+}
+
+// delay returns the randomized back-off for the given (0-based) retry.
+func (p RetryPolicy) delay(retry int) time.Duration {
+	d := float64(p.InitialInterval) * math.Pow(p.Multiplier, float64(retry))
+	if p.Jitter > 0 {
+		// Spread d uniformly over [d*(1-Jitter), d*(1+Jitter)]
+		d *= 1 + p.Jitter*(2*randFloat64()-1)
+	}
+
+	if d > math.MaxInt64 {
+		return time.Duration(math.MaxInt64)
+	}
+
+	return time.Duration(d)
+}
+
+// wait blocks for the back-off of the given retry, or until ctx is done.
+func (p RetryPolicy) wait(ctx context.Context, retry int) error {
+	timer := time.NewTimer(p.delay(retry))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// randFloat64 returns a pseudo-random number in [0, 1).
+func randFloat64() float64 {
+	return float64(globalMathRandomGenerator.Uint64()>>11) / (1 << 53)
+}
@@ -0,0 +1,53 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	t.Run("validate()", func(t *testing.T) {
+		assert.NoError(t, DefaultRetryPolicy().validate())
+		assert.NoError(t, RetryPolicy{Multiplier: 1}.validate())
+
+		assert.ErrorIs(t, RetryPolicy{InitialInterval: -1, Multiplier: 1}.validate(), errNegativeRetryInterval)
+		assert.ErrorIs(t, RetryPolicy{Multiplier: 0.5}.validate(), errInvalidRetryMultiplier)
+		assert.ErrorIs(t, RetryPolicy{Multiplier: 1, MaxRetries: -1}.validate(), errNegativeMaxRetries)
+		assert.ErrorIs(t, RetryPolicy{Multiplier: 1, Jitter: -0.1}.validate(), errInvalidRetryJitter)
+		assert.ErrorIs(t, RetryPolicy{Multiplier: 1, Jitter: 1}.validate(), errInvalidRetryJitter)
+	})
+
+	t.Run("delay() without jitter", func(t *testing.T) {
+		policy := RetryPolicy{InitialInterval: 10 * time.Millisecond, Multiplier: 2}
+		assert.Equal(t, 10*time.Millisecond, policy.delay(0))
+		assert.Equal(t, 20*time.Millisecond, policy.delay(1))
+		assert.Equal(t, 40*time.Millisecond, policy.delay(2))
+	})
+
+	t.Run("delay() with jitter", func(t *testing.T) {
+		policy := RetryPolicy{InitialInterval: 100 * time.Millisecond, Multiplier: 1, Jitter: 0.5}
+
+		seen := map[time.Duration]struct{}{}
+		for i := 0; i < 100; i++ {
+			d := policy.delay(0)
+			assert.GreaterOrEqual(t, d, 50*time.Millisecond)
+			assert.LessOrEqual(t, d, 150*time.Millisecond)
+			seen[d] = struct{}{}
+		}
+		assert.Greater(t, len(seen), 1, "jitter should spread the delays")
+	})
+
+	t.Run("wait() canceled", func(t *testing.T) {
+		policy := RetryPolicy{InitialInterval: time.Hour, Multiplier: 1}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.ErrorIs(t, policy.wait(ctx, 0), context.Canceled)
+	})
+}
@@ -0,0 +1,124 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/pion/logging"
+)
+
+// LevelTrace is the slog level of messages logged with Trace and Tracef.
+const LevelTrace = slog.LevelDebug - 4
+
+// slogLogger adapts a slog.Handler to logging.LeveledLogger. Messages logged
+// through the LeveledLogger methods carry no attributes, TURN events are
+// logged with attributes through logAttrs.
+type slogLogger struct {
+	handler slog.Handler
+}
+
+// NewSlogLogger returns a logging.LeveledLogger that writes to handler.
+func NewSlogLogger(handler slog.Handler) logging.LeveledLogger {
+	return &slogLogger{handler: handler}
+}
+
+// Trace implements logging.LeveledLogger.
+func (l *slogLogger) Trace(msg string) {
+	l.logAttrs(LevelTrace, msg)
+}
+
+// Tracef implements logging.LeveledLogger.
+func (l *slogLogger) Tracef(format string, args ...any) {
+	if l.handler.Enabled(context.Background(), LevelTrace) {
+		l.logAttrs(LevelTrace, fmt.Sprintf(format, args...))
+	}
+}
+
+// Debug implements logging.LeveledLogger.
+func (l *slogLogger) Debug(msg string) {
+	l.logAttrs(slog.LevelDebug, msg)
+}
+
+// Debugf implements logging.LeveledLogger.
+func (l *slogLogger) Debugf(format string, args ...any) {
+	if l.handler.Enabled(context.Background(), slog.LevelDebug) {
+		l.logAttrs(slog.LevelDebug, fmt.Sprintf(format, args...))
+	}
+}
+
+// Info implements logging.LeveledLogger.
+func (l *slogLogger) Info(msg string) {
+	l.logAttrs(slog.LevelInfo, msg)
+}
+
+// Infof implements logging.LeveledLogger.
+func (l *slogLogger) Infof(format string, args ...any) {
+	if l.handler.Enabled(context.Background(), slog.LevelInfo) {
+		l.logAttrs(slog.LevelInfo, fmt.Sprintf(format, args...))
+	}
+}
+
+// Warn implements logging.LeveledLogger.
+func (l *slogLogger) Warn(msg string) {
+	l.logAttrs(slog.LevelWarn, msg)
+}
+
+// Warnf implements logging.LeveledLogger.
+func (l *slogLogger) Warnf(format string, args ...any) {
+	if l.handler.Enabled(context.Background(), slog.LevelWarn) {
+		l.logAttrs(slog.LevelWarn, fmt.Sprintf(format, args...))
+	}
+}
+
+// Error implements logging.LeveledLogger.
+func (l *slogLogger) Error(msg string) {
+	l.logAttrs(slog.LevelError, msg)
+}
+
+// Errorf implements logging.LeveledLogger.
+func (l *slogLogger) Errorf(format string, args ...any) {
+	if l.handler.Enabled(context.Background(), slog.LevelError) {
+		l.logAttrs(slog.LevelError, fmt.Sprintf(format, args...))
+	}
+}
+
+// logAttrs hands a record to the handler, attributing it to the caller of
+// the logging method rather than to the adapter.
+func (l *slogLogger) logAttrs(level slog.Level, msg string, attrs ...slog.Attr) {
+	ctx := context.Background()
+	if !l.handler.Enabled(ctx, level) {
+		return
+	}
+
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:]) // Skip runtime.Callers, logAttrs and the logging method
+	record := slog.NewRecord(time.Now(), level, msg, pcs[0])
+	record.AddAttrs(attrs...)
+	_ = l.handler.Handle(ctx, record)
+}
+
+// logEvent logs a TURN event at debug level. Loggers created by NewSlogLogger
+// get attrs as structured attributes, other loggers get them appended to msg
+// as key=value pairs.
+func logEvent(log logging.LeveledLogger, msg string, attrs ...slog.Attr) {
+	if l, ok := log.(*slogLogger); ok {
+		l.logAttrs(slog.LevelDebug, msg, attrs...)
+
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString(msg)
+	for _, attr := range attrs {
+		b.WriteByte(' ')
+		b.WriteString(attr.String())
+	}
+	log.Debug(b.String())
+}
@@ -0,0 +1,134 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/pion/logging"
+	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4/binding"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingHandler keeps the records it handles.
+type recordingHandler struct {
+	level   slog.Level
+	records []slog.Record
+	mutex   sync.Mutex
+}
+
+func (h *recordingHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *recordingHandler) Handle(_ context.Context, record slog.Record) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.records = append(h.records, record.Clone())
+
+	return nil
+}
+
+func (h *recordingHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+func (h *recordingHandler) WithGroup(string) slog.Handler { return h }
+
+// find returns the attributes of the records with message msg.
+func (h *recordingHandler) find(msg string) []map[string]string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	var found []map[string]string
+	for _, record := range h.records {
+		if record.Message != msg {
+			continue
+		}
+		attrs := map[string]string{}
+		record.Attrs(func(attr slog.Attr) bool {
+			attrs[attr.Key] = attr.Value.String()
+
+			return true
+		})
+		found = append(found, attrs)
+	}
+
+	return found
+}
+
+func TestSlogLogger(t *testing.T) {
+	t.Run("levels", func(t *testing.T) {
+		handler := &recordingHandler{level: slog.LevelDebug}
+		log := NewSlogLogger(handler)
+
+		log.Tracef("dropped %d", 1)
+		log.Debugf("debug %d", 2)
+		log.Info("info")
+		log.Warnf("warn %s", "three")
+		log.Error("error")
+
+		assert.Len(t, handler.records, 4, "trace should be below the handler level")
+		for i, want := range []struct {
+			level slog.Level
+			msg   string
+		}{
+			{slog.LevelDebug, "debug 2"},
+			{slog.LevelInfo, "info"},
+			{slog.LevelWarn, "warn three"},
+			{slog.LevelError, "error"},
+		} {
+			assert.Equal(t, want.level, handler.records[i].Level)
+			assert.Equal(t, want.msg, handler.records[i].Message)
+		}
+	})
+
+	t.Run("source", func(t *testing.T) {
+		var buf bytes.Buffer
+		log := NewSlogLogger(slog.NewTextHandler(&buf, &slog.HandlerOptions{AddSource: true}))
+		log.Infof("hello")
+		assert.Contains(t, buf.String(), "slog_test.go", "source should be the caller of the logger")
+	})
+
+	t.Run("logEvent() without slog", func(t *testing.T) {
+		var buf bytes.Buffer
+		factory := logging.NewDefaultLoggerFactory()
+		factory.DefaultLogLevel = logging.LogLevelDebug
+		factory.Writer = &buf
+
+		logEvent(factory.NewLogger("test"), "Permission granted", slog.String("peer", "10.0.0.1:5000"))
+		assert.Contains(t, buf.String(), "Permission granted peer=10.0.0.1:5000")
+	})
+
+	t.Run("UDPConn events", func(t *testing.T) {
+		handler := &recordingHandler{level: slog.LevelDebug}
+		var changes int
+		conn := newTestUDPConn(t, &mockClient{
+			performTransaction: func(context.Context, *stun.Message, net.Addr, bool) (TransactionResult, error) {
+				return TransactionResult{Msg: new(stun.Message)}, nil
+			},
+		}, WithSlogHandler(handler),
+			WithBindingStateChangeHandler(func(net.Addr, binding.State, binding.State) { changes++ }))
+
+		peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+		bound := mustCreateBinding(t, conn.bindingMgr, peer)
+		bound.SetState(binding.StateRequest)
+		bound.SetState(binding.StateReady)
+
+		assert.Equal(t, []map[string]string{
+			{"peer": "10.0.0.1:5000", "from": "idle", "to": "request"},
+			{"peer": "10.0.0.1:5000", "from": "request", "to": "ready"},
+		}, handler.find("Channel binding state changed"))
+		assert.Equal(t, 2, changes, "the configured handler should still be called")
+
+		perm := &permission{}
+		conn.permMap.insert(peer, perm)
+		assert.NoError(t, conn.createPermission(context.Background(), perm, peer))
+		assert.Equal(t, []map[string]string{{"peer": "10.0.0.1:5000"}}, handler.find("Permission granted"))
+	})
+}
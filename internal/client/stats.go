@@ -0,0 +1,144 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/turn/v4/binding"
+)
+
+// Stats is a snapshot of the traffic and error counters of a UDPConn,
+// along with its current channel bindings and permissions.
+type Stats struct {
+	BytesSent         uint64        // Payload bytes written to peers
+	BytesReceived     uint64        // Payload bytes read from peers
+	ChannelSends      uint64        // Writes sent as ChannelData
+	IndicationSends   uint64        // Writes sent as Send indications
+	BindingErrors     uint64        // Failed ChannelBind attempts
+	PermissionErrors  uint64        // Writes that failed to obtain a permission
+	WritesDropped     uint64        // Writes dropped because the write queue was full
+	WritesExpired     uint64        // Queued writes dropped after the drain timeout
+	SlowWrites        uint64        // Writes that took longer than the slow write threshold
+	FlowControlPauses uint64        // Writes held back because the send buffer was full
+	Bindings          BindingCounts // Channel bindings by state
+	Permissions       uint64        // Permissions currently granted
+	RTT               RTTStats      // Round-trip times of the latest transactions with the TURN server
+}
+
+// RTTStats aggregates the round-trip times of the latest transactions, e.g.
+// Refresh or ChannelBind, with the TURN server. All are zero without samples.
+type RTTStats struct {
+	Samples int           // Transactions in the window, at most 32
+	Min     time.Duration // Shortest round-trip time
+	Max     time.Duration // Longest round-trip time
+	Mean    time.Duration // Average round-trip time
+	P95     time.Duration // 95th percentile, nearest rank
+}
+
+// BindingCounts is the number of channel bindings in each state.
+type BindingCounts struct {
+	Idle    uint64 // Not bound yet
+	Request uint64 // ChannelBind in flight
+	Ready   uint64 // Bound
+	Refresh uint64 // Bound, refresh in flight
+	Failed  uint64 // Last ChannelBind failed
+}
+
+func (b *BindingCounts) add(state binding.State) {
+	switch state {
+	case binding.StateIdle:
+		b.Idle++
+	case binding.StateRequest:
+		b.Request++
+	case binding.StateReady:
+		b.Ready++
+	case binding.StateRefresh:
+		b.Refresh++
+	case binding.StateFailed:
+		b.Failed++
+	}
+}
+
+// connStats holds the live counters behind Stats.
+type connStats struct {
+	bytesSent        atomic.Uint64
+	bytesReceived    atomic.Uint64
+	channelSends     atomic.Uint64
+	indicationSends  atomic.Uint64
+	bindingErrors    atomic.Uint64
+	permissionErrors atomic.Uint64
+	writesDropped    atomic.Uint64
+	writesExpired    atomic.Uint64
+	slowWrites       atomic.Uint64
+	flowPauses       atomic.Uint64
+}
+
+func (s *connStats) snapshot() Stats {
+	return Stats{
+		BytesSent:         s.bytesSent.Load(),
+		BytesReceived:     s.bytesReceived.Load(),
+		ChannelSends:      s.channelSends.Load(),
+		IndicationSends:   s.indicationSends.Load(),
+		BindingErrors:     s.bindingErrors.Load(),
+		PermissionErrors:  s.permissionErrors.Load(),
+		WritesDropped:     s.writesDropped.Load(),
+		WritesExpired:     s.writesExpired.Load(),
+		SlowWrites:        s.slowWrites.Load(),
+		FlowControlPauses: s.flowPauses.Load(),
+	}
+}
+
+// rttWindowSize is the number of round-trip times RTTStats is computed from.
+const rttWindowSize = 32
+
+// rttWindow keeps the latest round-trip times, evicting the oldest one once full.
+type rttWindow struct {
+	samples [rttWindowSize]time.Duration // Protected by mutex
+	count   int                          // Protected by mutex
+	next    int                          // Protected by mutex
+	mutex   sync.Mutex
+}
+
+// add records rtt. Non-positive values, e.g. from clients not measuring
+// round-trip times, are ignored.
+func (w *rttWindow) add(rtt time.Duration) {
+	if rtt <= 0 {
+		return
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.samples[w.next] = rtt
+	w.next = (w.next + 1) % rttWindowSize
+	w.count = min(w.count+1, rttWindowSize)
+}
+
+func (w *rttWindow) snapshot() RTTStats {
+	w.mutex.Lock()
+	sorted := slices.Clone(w.samples[:w.count])
+	w.mutex.Unlock()
+
+	if len(sorted) == 0 {
+		return RTTStats{}
+	}
+	slices.Sort(sorted)
+
+	var sum time.Duration
+	for _, rtt := range sorted {
+		sum += rtt
+	}
+
+	return RTTStats{
+		Samples: len(sorted),
+		Min:     sorted[0],
+		Max:     sorted[len(sorted)-1],
+		Mean:    sum / time.Duration(len(sorted)),
+		P95:     sorted[(len(sorted)*95+99)/100-1],
+	}
+}
@@ -0,0 +1,72 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4/internal/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRTTWindow(t *testing.T) {
+	t.Run("Empty", func(t *testing.T) {
+		var window rttWindow
+		window.add(0)
+		window.add(-time.Second)
+		assert.Equal(t, RTTStats{}, window.snapshot())
+	})
+
+	t.Run("Aggregates", func(t *testing.T) {
+		var window rttWindow
+		for _, rtt := range []time.Duration{30, 10, 20, 40} {
+			window.add(rtt * time.Millisecond)
+		}
+		assert.Equal(t, RTTStats{
+			Samples: 4,
+			Min:     10 * time.Millisecond,
+			Max:     40 * time.Millisecond,
+			Mean:    25 * time.Millisecond,
+			P95:     40 * time.Millisecond,
+		}, window.snapshot())
+	})
+
+	t.Run("Evicts old samples", func(t *testing.T) {
+		var window rttWindow
+		window.add(time.Second) // Evicted by the samples below
+		for i := 1; i <= rttWindowSize; i++ {
+			window.add(time.Duration(i) * time.Millisecond)
+		}
+
+		stats := window.snapshot()
+		assert.Equal(t, rttWindowSize, stats.Samples)
+		assert.Equal(t, time.Millisecond, stats.Min)
+		assert.Equal(t, rttWindowSize*time.Millisecond, stats.Max)
+		assert.Equal(t, 31*time.Millisecond, stats.P95, "the 31st of 32 samples")
+	})
+}
+
+func TestUDPConnStatsRTT(t *testing.T) {
+	client := &mockClient{
+		performTransaction: func(_ context.Context, msg *stun.Message, _ net.Addr, _ bool) (TransactionResult, error) {
+			return TransactionResult{
+				Msg: stun.MustBuild(stun.NewType(msg.Type.Method, stun.ClassSuccessResponse), proto.Lifetime{Duration: time.Hour}),
+			}, nil
+		},
+	}
+	conn := newTestUDPConn(t, client)
+	assert.Equal(t, RTTStats{}, conn.Stats().RTT)
+
+	assert.NoError(t, conn.refreshAllocation(context.Background(), time.Hour, false))
+	assert.NoError(t, conn.refreshAllocation(context.Background(), time.Hour, true), "not waited for, so not sampled")
+
+	rtt := conn.Stats().RTT
+	assert.Equal(t, 1, rtt.Samples)
+	assert.Equal(t, mockRTT, rtt.Mean)
+	assert.Greater(t, rtt.Min, time.Duration(0))
+}
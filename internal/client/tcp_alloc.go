@@ -4,6 +4,7 @@
 package client
 
 import (
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -31,6 +32,7 @@ func noDeadline() time.Time {
 type TCPAllocation struct {
 	connAttemptCh chan *connectionAttempt
 	acceptTimer   *time.Timer
+	bindingMgr    *tcpBindingManager // Thread-safe
 	allocation
 }
 
@@ -39,20 +41,26 @@ func NewTCPAllocation(config *AllocationConfig) *TCPAllocation {
 	alloc := &TCPAllocation{
 		connAttemptCh: make(chan *connectionAttempt, 10),
 		acceptTimer:   time.NewTimer(time.Duration(math.MaxInt64)),
+		bindingMgr:    newTCPBindingManager(),
 		allocation: allocation{
-			client:      config.Client,
-			relayedAddr: config.RelayedAddr,
-			serverAddr:  config.ServerAddr,
-			username:    config.Username,
-			realm:       config.Realm,
-			permMap:     newPermissionMap(),
-			integrity:   config.Integrity,
-			_nonce:      config.Nonce,
-			_lifetime:   config.Lifetime,
-			net:         config.Net,
-			log:         config.Log,
+			client:       config.Client,
+			_relayedAddr: config.RelayedAddr,
+			serverAddr:   config.ServerAddr,
+			trace:        config.Trace,
+			_username:    config.Username,
+			_realm:       config.Realm,
+			software:     optionalSoftware(config.Software),
+			permMap:      newPermissionMap(),
+			_integrity:   config.integrity(),
+			_lifetime:    config.Lifetime,
+			net:          config.Net,
+			log:          config.Log,
+
+			permRefreshInterval: defaultPermRefreshInterval,
+			permGCInterval:      defaultPermGCInterval,
 		},
 	}
+	alloc._nonce.Store(&config.Nonce)
 
 	alloc.log.Debugf("Initial lifetime: %d seconds", int(alloc.lifetime().Seconds()))
 
@@ -65,7 +73,13 @@ func NewTCPAllocation(config *AllocationConfig) *TCPAllocation {
 	alloc.refreshPermsTimer = NewPeriodicTimer(
 		timerIDRefreshPerms,
 		alloc.onRefreshTimers,
-		permRefreshInterval,
+		alloc.permRefreshInterval,
+	)
+
+	alloc.gcPermsTimer = NewPeriodicTimer(
+		timerIDGCPerms,
+		alloc.onRefreshTimers,
+		alloc.permGCInterval,
 	)
 
 	if alloc.refreshAllocTimer.Start() {
@@ -74,20 +88,28 @@ func NewTCPAllocation(config *AllocationConfig) *TCPAllocation {
 	if alloc.refreshPermsTimer.Start() {
 		alloc.log.Debug("Started refreshPermsTimer")
 	}
+	if alloc.gcPermsTimer.Start() {
+		alloc.log.Debug("Started gcPermsTimer")
+	}
 
 	return alloc
 }
 
 // Connect sends a Connect request to the turn server and returns a chosen connection ID.
 func (a *TCPAllocation) Connect(peer net.Addr) (proto.ConnectionID, error) {
+	return a.connect(context.Background(), peer)
+}
+
+func (a *TCPAllocation) connect(ctx context.Context, peer net.Addr) (proto.ConnectionID, error) {
 	setters := []stun.Setter{
 		stun.TransactionID,
 		stun.NewType(stun.MethodConnect, stun.ClassRequest),
 		addr2PeerAddress(peer),
-		a.username,
-		a.realm,
-		a.nonce(),
-		a.integrity,
+		a.username(),
+		optionalRealm(a.realm()),
+		a.software,
+		optionalNonce(a.nonce()),
+		a.integrity(),
 		stun.Fingerprint,
 	}
 
@@ -97,7 +119,7 @@ func (a *TCPAllocation) Connect(peer net.Addr) (proto.ConnectionID, error) {
 	}
 
 	a.log.Debugf("Send connect request (peer=%v)", peer)
-	trRes, err := a.client.PerformTransaction(msg, a.serverAddr, false)
+	trRes, err := a.performTransaction(ctx, msg, false)
 	if err != nil {
 		return 0, err
 	}
@@ -146,6 +168,16 @@ func (a *TCPAllocation) DialWithConn(conn net.Conn, network, rAddrStr string) (*
 
 // DialTCP acts like Dial for TCP networks.
 func (a *TCPAllocation) DialTCP(network string, lAddr, rAddr *net.TCPAddr) (*TCPConn, error) {
+	return a.DialTCPContext(context.Background(), network, lAddr, rAddr)
+}
+
+// DialTCPContext acts like DialTCP. Once ctx is done the connection attempt
+// is aborted and the data connection closed.
+func (a *TCPAllocation) DialTCPContext(
+	ctx context.Context,
+	network string,
+	lAddr, rAddr *net.TCPAddr,
+) (*TCPConn, error) {
 	var rAddrServer *net.TCPAddr
 	if addr, ok := a.serverAddr.(*net.TCPAddr); ok {
 		rAddrServer = &net.TCPAddr{
@@ -161,21 +193,46 @@ func (a *TCPAllocation) DialTCP(network string, lAddr, rAddr *net.TCPAddr) (*TCP
 		return nil, errInvalidTURNAddress
 	}
 
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	conn, err := a.net.DialTCP(network, lAddr, rAddrServer)
 	if err != nil {
 		return nil, err
 	}
 
-	dataConn, err := a.DialTCPWithConn(conn, network, rAddr)
+	// Closing the conn unblocks the ConnectionBind
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close() //nolint:errcheck,gosec
+	})
+	dataConn, err := a.dialTCPWithConn(ctx, conn, rAddr)
+	if !stop() {
+		return nil, ctx.Err()
+	}
 	if err != nil {
 		conn.Close() //nolint:errcheck,gosec
+
+		return nil, err
 	}
+	a.bindingMgr.insert(dataConn)
 
-	return dataConn, err
+	return dataConn, nil
 }
 
 // DialTCPWithConn acts like DialWithConn for TCP networks.
 func (a *TCPAllocation) DialTCPWithConn(conn net.Conn, _ string, rAddr *net.TCPAddr) (*TCPConn, error) {
+	dataConn, err := a.dialTCPWithConn(context.Background(), conn, rAddr)
+	if err != nil {
+		return nil, err
+	}
+	a.bindingMgr.insert(dataConn)
+
+	return dataConn, nil
+}
+
+// dialTCPWithConn connects conn to rAddr with a Connect request followed by
+// a ConnectionBind on conn, RFC 6062 Section 4.3.
+func (a *TCPAllocation) dialTCPWithConn(ctx context.Context, conn net.Conn, rAddr *net.TCPAddr) (*TCPConn, error) {
 	var err error
 
 	// Check if we have a permission for the destination IP addr
@@ -186,7 +243,7 @@ func (a *TCPAllocation) DialTCPWithConn(conn net.Conn, _ string, rAddr *net.TCPA
 	}
 
 	for i := 0; i < maxRetryAttempts; i++ {
-		if err = a.createPermission(perm, rAddr); !errors.Is(err, errTryAgain) {
+		if err = a.createPermission(ctx, perm, rAddr); !errors.Is(err, errTryAgain) {
 			break
 		}
 	}
@@ -195,7 +252,7 @@ func (a *TCPAllocation) DialTCPWithConn(conn net.Conn, _ string, rAddr *net.TCPA
 	}
 
 	// Send connect request if haven't done so.
-	cid, err := a.Connect(rAddr)
+	cid, err := a.connect(ctx, rAddr)
 	if err != nil {
 		return nil, err
 	}
@@ -225,10 +282,11 @@ func (a *TCPAllocation) BindConnection(dataConn *TCPConn, cid proto.ConnectionID
 		stun.TransactionID,
 		stun.NewType(stun.MethodConnectionBind, stun.ClassRequest),
 		cid,
-		a.username,
-		a.realm,
-		a.nonce(),
-		a.integrity,
+		a.username(),
+		optionalRealm(a.realm()),
+		a.software,
+		optionalNonce(a.nonce()),
+		a.integrity(),
 		stun.Fingerprint,
 	)
 	if err != nil {
@@ -329,6 +387,7 @@ func (a *TCPAllocation) AcceptTCPWithConn(conn net.Conn) (*TCPConn, error) {
 		if err := a.BindConnection(dataConn, attempt.cid); err != nil {
 			return nil, fmt.Errorf("failed to bind connection: %w", err)
 		}
+		a.bindingMgr.insert(dataConn)
 
 		return dataConn, nil
 	case <-a.acceptTimer.C:
@@ -360,15 +419,22 @@ func (a *TCPAllocation) SetDeadline(t time.Time) error {
 func (a *TCPAllocation) Close() error {
 	a.refreshAllocTimer.Stop()
 	a.refreshPermsTimer.Stop()
+	a.gcPermsTimer.Stop()
+
+	for _, conn := range a.bindingMgr.all() {
+		if err := conn.Close(); err != nil {
+			a.log.Debugf("Failed to close data connection (cid=%v): %v", conn.ConnectionID, err)
+		}
+	}
 
-	a.client.OnDeallocated(a.relayedAddr)
+	a.client.OnDeallocated(a.relayedAddr())
 
-	return a.refreshAllocation(0, true /* dontWait=true */)
+	return a.refreshAllocation(context.Background(), 0, true /* dontWait=true */)
 }
 
 // Addr returns the relayed address of the allocation.
 func (a *TCPAllocation) Addr() net.Addr {
-	return a.relayedAddr
+	return a.relayedAddr()
 }
 
 // HandleConnectionAttempt is called by the TURN client
@@ -6,6 +6,7 @@ package client
 import (
 	"errors"
 	"net"
+	"sync"
 
 	"github.com/pion/transport/v3"
 	"github.com/pion/turn/v4/internal/proto"
@@ -36,6 +37,15 @@ type connectionAttempt struct {
 	cid  proto.ConnectionID
 }
 
+// Close unregisters the connection from its allocation and closes it.
+func (c *TCPConn) Close() error {
+	if c.allocation != nil {
+		c.allocation.bindingMgr.deleteIf(c.ConnectionID, c)
+	}
+
+	return c.TCPConn.Close()
+}
+
 // LocalAddr returns the local network address.
 // The Addr returned is shared by all invocations of LocalAddr, so do not modify it.
 func (c *TCPConn) LocalAddr() net.Addr {
@@ -47,3 +57,54 @@ func (c *TCPConn) LocalAddr() net.Addr {
 func (c *TCPConn) RemoteAddr() net.Addr {
 	return c.remoteAddress
 }
+
+// Thread-safe map of bound data connections, keyed by CONNECTION-ID.
+type tcpBindingManager struct {
+	conns map[proto.ConnectionID]*TCPConn
+	mutex sync.RWMutex
+}
+
+func newTCPBindingManager() *tcpBindingManager {
+	return &tcpBindingManager{
+		conns: map[proto.ConnectionID]*TCPConn{},
+	}
+}
+
+func (mgr *tcpBindingManager) insert(conn *TCPConn) {
+	mgr.mutex.Lock()
+	defer mgr.mutex.Unlock()
+
+	mgr.conns[conn.ConnectionID] = conn
+}
+
+// deleteIf removes the entry for cid only if it still refers to conn.
+func (mgr *tcpBindingManager) deleteIf(cid proto.ConnectionID, conn *TCPConn) bool {
+	mgr.mutex.Lock()
+	defer mgr.mutex.Unlock()
+
+	if cur, ok := mgr.conns[cid]; !ok || cur != conn {
+		return false
+	}
+	delete(mgr.conns, cid)
+
+	return true
+}
+
+func (mgr *tcpBindingManager) size() int {
+	mgr.mutex.RLock()
+	defer mgr.mutex.RUnlock()
+
+	return len(mgr.conns)
+}
+
+func (mgr *tcpBindingManager) all() []*TCPConn {
+	mgr.mutex.RLock()
+	defer mgr.mutex.RUnlock()
+
+	list := make([]*TCPConn, 0, len(mgr.conns))
+	for _, conn := range mgr.conns {
+		list = append(list, conn)
+	}
+
+	return list
+}
@@ -4,6 +4,7 @@
 package client
 
 import (
+	"context"
 	"net"
 	"testing"
 	"time"
@@ -49,7 +50,7 @@ func TestTCPConn(t *testing.T) {
 	t.Run("Connect()", func(t *testing.T) {
 		var cid proto.ConnectionID = 5
 		client := &mockClient{
-			performTransaction: func(msg *stun.Message, _ net.Addr, _ bool) (TransactionResult, error) {
+			performTransaction: func(_ context.Context, msg *stun.Message, _ net.Addr, _ bool) (TransactionResult, error) {
 				if msg.Type.Class == stun.ClassRequest && msg.Type.Method == stun.MethodConnect {
 					msg, err := stun.Build(
 						stun.TransactionID,
@@ -72,16 +73,17 @@ func TestTCPConn(t *testing.T) {
 
 		pm := newPermissionMap()
 		assert.True(t, pm.insert(addr, &permission{
-			st: permStatePermitted,
+			st: PermissionStatePermitted,
 		}))
 
 		loggerFactory := logging.NewDefaultLoggerFactory()
 		log := loggerFactory.NewLogger("test")
 		alloc := TCPAllocation{
 			allocation: allocation{
-				client:  client,
-				permMap: pm,
-				log:     log,
+				client:     client,
+				permMap:    pm,
+				_integrity: stun.MessageIntegrity(nil),
+				log:        log,
 			},
 		}
 
@@ -90,7 +92,7 @@ func TestTCPConn(t *testing.T) {
 		assert.Equal(t, cid, actualCid)
 
 		client = &mockClient{
-			performTransaction: func(msg *stun.Message, _ net.Addr, _ bool) (TransactionResult, error) {
+			performTransaction: func(_ context.Context, msg *stun.Message, _ net.Addr, _ bool) (TransactionResult, error) {
 				if msg.Type.Class == stun.ClassRequest && msg.Type.Method == stun.MethodConnect {
 					msg, buildErr := stun.Build(
 						stun.TransactionID,
@@ -107,9 +109,10 @@ func TestTCPConn(t *testing.T) {
 		}
 		alloc = TCPAllocation{
 			allocation: allocation{
-				client:  client,
-				permMap: pm,
-				log:     log,
+				client:     client,
+				permMap:    pm,
+				_integrity: stun.MessageIntegrity(nil),
+				log:        log,
 			},
 		}
 
@@ -168,7 +171,7 @@ func TestTCPConn(t *testing.T) {
 		var cid proto.ConnectionID = 5
 		loggerFactory := logging.NewDefaultLoggerFactory()
 		client := &mockClient{
-			performTransaction: func(msg *stun.Message, _ net.Addr, _ bool) (TransactionResult, error) {
+			performTransaction: func(_ context.Context, msg *stun.Message, _ net.Addr, _ bool) (TransactionResult, error) {
 				typ := stun.NewType(stun.MethodConnect, stun.ClassSuccessResponse)
 				if msg.Type.Method == stun.MethodCreatePermission {
 					typ = stun.NewType(stun.MethodCreatePermission, stun.ClassSuccessResponse)
@@ -196,4 +199,106 @@ func TestTCPConn(t *testing.T) {
 		assert.Equal(t, cid, dataConn.ConnectionID)
 		assert.NoError(t, err)
 	})
+
+	t.Run("Round-trip and Close()", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		defer listener.Close() //nolint:errcheck
+
+		// Simulated TURN server: answer ConnectionBind, then echo peer data
+		go func() {
+			conn, acceptErr := listener.Accept()
+			if acceptErr != nil {
+				return
+			}
+			defer conn.Close() //nolint:errcheck
+
+			buf := make([]byte, 1500)
+			n, readErr := conn.Read(buf)
+			if readErr != nil {
+				return
+			}
+			req := &stun.Message{Raw: buf[:n]}
+			if req.Decode() != nil || req.Type.Method != stun.MethodConnectionBind {
+				return
+			}
+			res, buildErr := stun.Build(
+				buildMsg(req.TransactionID, stun.NewType(stun.MethodConnectionBind, stun.ClassSuccessResponse))...,
+			)
+			if buildErr != nil {
+				return
+			}
+			if _, writeErr := conn.Write(res.Raw); writeErr != nil {
+				return
+			}
+
+			for {
+				n, readErr = conn.Read(buf)
+				if readErr != nil {
+					return
+				}
+				if _, writeErr := conn.Write(buf[:n]); writeErr != nil {
+					return
+				}
+			}
+		}()
+
+		relayedAddr, err := net.ResolveTCPAddr("tcp", "127.0.0.1:13478")
+		assert.NoError(t, err)
+
+		alloc := NewTCPAllocation(&AllocationConfig{
+			Client: &mockClient{
+				performTransaction: func(context.Context, *stun.Message, net.Addr, bool) (TransactionResult, error) {
+					return TransactionResult{}, nil
+				},
+			},
+			Lifetime:    time.Second,
+			Log:         logging.NewDefaultLoggerFactory().NewLogger("test"),
+			RelayedAddr: relayedAddr,
+		})
+
+		from, err := net.ResolveTCPAddr("tcp", "127.0.0.1:11111")
+		assert.NoError(t, err)
+		var cid proto.ConnectionID = 7
+		alloc.HandleConnectionAttempt(from, cid)
+
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		assert.NoError(t, err)
+
+		dataConn, err := alloc.AcceptTCPWithConn(conn)
+		assert.NoError(t, err)
+		assert.Equal(t, cid, dataConn.ConnectionID)
+		assert.Equal(t, relayedAddr, dataConn.LocalAddr())
+		assert.Equal(t, from, dataConn.RemoteAddr())
+
+		alloc.bindingMgr.mutex.RLock()
+		assert.Equal(t, dataConn, alloc.bindingMgr.conns[cid])
+		alloc.bindingMgr.mutex.RUnlock()
+
+		_, err = dataConn.Write([]byte("hello"))
+		assert.NoError(t, err)
+		buf := make([]byte, 16)
+		n, err := dataConn.Read(buf)
+		assert.NoError(t, err)
+		assert.Equal(t, "hello", string(buf[:n]))
+
+		// Closing the allocation must close every bound data connection
+		assert.NoError(t, alloc.Close())
+		assert.Equal(t, 0, alloc.bindingMgr.size())
+		_, err = dataConn.Read(buf)
+		assert.ErrorIs(t, err, net.ErrClosed)
+	})
+
+	t.Run("tcpBindingManager", func(t *testing.T) {
+		mgr := newTCPBindingManager()
+		conn1 := &TCPConn{ConnectionID: 1}
+		conn2 := &TCPConn{ConnectionID: 1}
+
+		mgr.insert(conn1)
+		assert.Equal(t, 1, mgr.size())
+		assert.False(t, mgr.deleteIf(1, conn2), "should not delete a different conn")
+		assert.True(t, mgr.deleteIf(1, conn1))
+		assert.False(t, mgr.deleteIf(1, conn1))
+		assert.Equal(t, 0, len(mgr.all()))
+	})
 }
@@ -0,0 +1,224 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// Time to wait for the echoes of the last frames once sending stopped.
+	throughputDrainTimeout = time.Second
+	// Time to wait for the channel to the peer before sending frames.
+	throughputChannelTimeout = 5 * time.Second
+)
+
+// throughputMagic starts the data of the frames sent by
+// BenchmarkRelayThroughput, followed by a random token of the measurement, a
+// sequence number and the send time.
+const throughputMagic = "pion/turn throughput"
+
+const (
+	throughputTokenLen = 8
+	throughputSeqAt    = len(throughputMagic) + throughputTokenLen
+	// Smallest frame, the magic, token, sequence number and send time
+	throughputHeaderLen = throughputSeqAt + 8 + 8
+	// Largest frame, the UDP payload of an IPv4 packet less the ChannelData header
+	maxThroughputPayload = 1<<16 - 1 - ipv4HeaderLen - udpHeaderLen - 4
+)
+
+// BandwidthResult is the outcome of BenchmarkRelayThroughput.
+type BandwidthResult struct {
+	Sent        int           // Frames sent
+	Received    int           // Frames echoed back, without duplicates
+	SendMbps    float64       // Payload sent, in megabits per second
+	ReceiveMbps float64       // Payload echoed back, in megabits per second
+	LossPercent float64       // Frames sent but not echoed back
+	MeanRTT     time.Duration // Mean time from sending a frame to receiving its echo
+}
+
+// throughputTest is a BenchmarkRelayThroughput in progress, counting the
+// echoes of its frames.
+type throughputTest struct {
+	peer     net.Addr
+	token    [throughputTokenLen]byte
+	mutex    sync.Mutex
+	received map[uint64]struct{} // Protected by mutex, sequence numbers echoed back
+	bytes    int                 // Protected by mutex
+	rttSum   time.Duration       // Protected by mutex
+	last     time.Time           // Protected by mutex, arrival of the last echo
+}
+
+// BenchmarkRelayThroughput measures the throughput of the relay from conn
+// to peer and back. It sends frames of payloadSize bytes over the channel to
+// peer as fast as it can for durationSec seconds, then waits up to a second
+// for the last echoes. The peer must echo every packet it receives back to
+// the relayed address unchanged. Echoes of the frames are not returned by
+// ReadFrom. Only one measurement runs on a conn at a time.
+func BenchmarkRelayThroughput(
+	ctx context.Context,
+	c *UDPConn,
+	peer net.Addr,
+	payloadSize, durationSec int,
+) (BandwidthResult, error) {
+	if _, ok := peer.(*net.UDPAddr); !ok {
+		return BandwidthResult{}, errUDPAddrCast
+	}
+	if payloadSize < throughputHeaderLen || payloadSize > maxThroughputPayload {
+		return BandwidthResult{}, fmt.Errorf("%w: %d not in [%d, %d]",
+			errInvalidThroughputPayload, payloadSize, throughputHeaderLen, maxThroughputPayload)
+	}
+	if durationSec <= 0 {
+		return BandwidthResult{}, errInvalidThroughputDuration
+	}
+	if err := c.checkSize(make([]byte, payloadSize)); err != nil {
+		return BandwidthResult{}, err
+	}
+
+	test := &throughputTest{peer: peer, received: map[uint64]struct{}{}}
+	if _, err := rand.Read(test.token[:]); err != nil {
+		return BandwidthResult{}, err
+	}
+	if !c.throughputTest.CompareAndSwap(nil, test) {
+		return BandwidthResult{}, errThroughputInProgress
+	}
+	defer c.throughputTest.Store(nil)
+
+	if err := c.beginWrite(); err != nil {
+		return BandwidthResult{}, err
+	}
+	defer c.inflight.Done()
+
+	if err := c.bindChannel(ctx, peer); err != nil {
+		return BandwidthResult{}, err
+	}
+
+	frame := make([]byte, payloadSize)
+	copy(frame, throughputMagic)
+	copy(frame[len(throughputMagic):], test.token[:])
+
+	start := time.Now()
+	end := start.Add(time.Duration(durationSec) * time.Second)
+	var sent uint64
+	for now := start; now.Before(end); now = time.Now() {
+		binary.BigEndian.PutUint64(frame[throughputSeqAt:], sent)
+		binary.BigEndian.PutUint64(frame[throughputSeqAt+8:], uint64(now.UnixNano())) //nolint:gosec // G115
+		if _, err := c.writeTo(ctx, frame, peer, SendOptions{}); err != nil {
+			return BandwidthResult{}, err
+		}
+		sent++
+	}
+	elapsed := time.Since(start)
+
+	// Echoes of the last frames are still on their way
+	drain := time.NewTimer(throughputDrainTimeout)
+	defer drain.Stop()
+	poll := time.NewTicker(10 * time.Millisecond)
+	defer poll.Stop()
+wait:
+	for test.count() < sent {
+		select {
+		case <-poll.C:
+		case <-drain.C:
+			break wait
+		case <-ctx.Done():
+			return BandwidthResult{}, ctx.Err()
+		case <-c.closeCh:
+			return BandwidthResult{}, c.closedError()
+		}
+	}
+
+	return test.result(sent, payloadSize, start, elapsed), nil
+}
+
+// bindChannel binds a channel to peer and waits until it is ready, so that
+// frames are sent as ChannelData.
+func (c *UDPConn) bindChannel(ctx context.Context, peer net.Addr) error {
+	perm, ok := c.permMap.find(peer)
+	if !ok {
+		perm = &permission{}
+		c.permMap.insert(peer, perm)
+	}
+	if err := c.createPermission(ctx, perm, peer); err != nil {
+		return err
+	}
+
+	bound, ok := c.bindingMgr.FindByAddr(peer)
+	if !ok {
+		var err error
+		if bound, err = c.bindingMgr.Create(peer); err != nil {
+			return err
+		}
+	}
+	if !bound.OK() {
+		c.maybeBind(bound)
+	}
+
+	return c.waitForChannel(ctx, bound, throughputChannelTimeout)
+}
+
+// count returns the number of frames echoed back.
+func (t *throughputTest) count() uint64 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return uint64(len(t.received))
+}
+
+// result computes the outcome of sending sent frames of size bytes from
+// start on for elapsed.
+func (t *throughputTest) result(sent uint64, size int, start time.Time, elapsed time.Duration) BandwidthResult {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	result := BandwidthResult{
+		Sent:     int(sent), //nolint:gosec // G115
+		Received: len(t.received),
+		SendMbps: float64(sent) * float64(size) * 8 / elapsed.Seconds() / 1e6,
+	}
+	if sent > 0 {
+		result.LossPercent = float64(sent-uint64(len(t.received))) / float64(sent) * 100
+	}
+	if len(t.received) > 0 {
+		result.ReceiveMbps = float64(t.bytes) * 8 / t.last.Sub(start).Seconds() / 1e6
+		result.MeanRTT = t.rttSum / time.Duration(len(t.received))
+	}
+
+	return result
+}
+
+// handleThroughputEcho reports whether data from addr is the echo of a frame
+// of the BenchmarkRelayThroughput in progress, and counts it.
+func (c *UDPConn) handleThroughputEcho(data []byte, from net.Addr) bool {
+	test := c.throughputTest.Load()
+	if test == nil || len(data) < throughputHeaderLen ||
+		string(data[:len(throughputMagic)]) != throughputMagic ||
+		!bytes.Equal(data[len(throughputMagic):throughputSeqAt], test.token[:]) ||
+		from.String() != test.peer.String() {
+		return false
+	}
+
+	now := time.Now()
+	seq := binary.BigEndian.Uint64(data[throughputSeqAt:])
+	sentAt := time.Unix(0, int64(binary.BigEndian.Uint64(data[throughputSeqAt+8:]))) //nolint:gosec // G115
+
+	test.mutex.Lock()
+	defer test.mutex.Unlock()
+
+	if _, ok := test.received[seq]; !ok {
+		test.received[seq] = struct{}{}
+		test.bytes += len(data)
+		test.rttSum += now.Sub(sentAt)
+		test.last = now
+	}
+
+	return true
+}
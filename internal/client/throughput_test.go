@@ -0,0 +1,113 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4/internal/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBenchmarkRelayThroughput(t *testing.T) {
+	peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+
+	t.Run("Echo", func(t *testing.T) {
+		// The server and peer echo every ChannelData frame but every tenth
+		var conn *UDPConn
+		var indications atomic.Int32
+		client := &mockClient{}
+		client.SetPerformTransaction(func(_ context.Context, msg *stun.Message, _ net.Addr, _ bool) (
+			TransactionResult, error,
+		) {
+			return TransactionResult{Msg: stun.MustBuild(stun.NewType(msg.Type.Method, stun.ClassSuccessResponse))}, nil
+		})
+		client.SetWriteTo(func(data []byte, _ net.Addr) (int, error) {
+			if !proto.IsChannelData(data) {
+				indications.Add(1)
+
+				return len(data), nil
+			}
+			chData := &proto.ChannelData{Raw: append([]byte(nil), data...)}
+			assert.NoError(t, chData.Decode())
+			if binary.BigEndian.Uint64(chData.Data[throughputSeqAt:])%10 != 0 {
+				conn.HandleInbound(chData.Data, peer)
+			}
+
+			return len(data), nil
+		})
+		conn = newTestUDPConn(t, client)
+
+		result, err := BenchmarkRelayThroughput(context.Background(), conn, peer, 200, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, int32(0), indications.Load(), "frames are only sent once the channel is bound")
+		assert.Greater(t, result.Sent, 10)
+		dropped := (result.Sent + 9) / 10
+		assert.Equal(t, result.Sent-dropped, result.Received)
+		assert.InDelta(t, float64(dropped)/float64(result.Sent)*100, result.LossPercent, 1e-9)
+		assert.Greater(t, result.SendMbps, 0.0)
+		assert.Greater(t, result.ReceiveMbps, 0.0)
+		assert.LessOrEqual(t, result.ReceiveMbps, result.SendMbps*1.1)
+		assert.Less(t, result.MeanRTT, time.Second)
+
+		select {
+		case <-conn.readCh:
+			t.Fatal("echoes must not be returned by ReadFrom")
+		default:
+		}
+	})
+
+	t.Run("Result", func(t *testing.T) {
+		conn := newTestUDPConn(t, &mockClient{})
+		test := &throughputTest{peer: peer, received: map[uint64]struct{}{}, token: [throughputTokenLen]byte{1}}
+		conn.throughputTest.Store(test)
+		start := time.Now().Add(-time.Second)
+
+		frame := make([]byte, 1000)
+		copy(frame, throughputMagic)
+		copy(frame[len(throughputMagic):], test.token[:])
+		for seq := uint64(0); seq < 3; seq++ {
+			binary.BigEndian.PutUint64(frame[throughputSeqAt:], seq)
+			sentAt := time.Now().Add(-100 * time.Millisecond)
+			binary.BigEndian.PutUint64(frame[throughputSeqAt+8:], uint64(sentAt.UnixNano())) //nolint:gosec // G115
+			assert.True(t, conn.handleThroughputEcho(frame, peer))
+		}
+		assert.True(t, conn.handleThroughputEcho(frame, peer), "duplicates are not counted")
+		assert.False(t, conn.handleThroughputEcho(frame, &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 5000}))
+		assert.False(t, conn.handleThroughputEcho([]byte("hello"), peer))
+		other := append([]byte(nil), frame...)
+		other[len(throughputMagic)] = 2
+		assert.False(t, conn.handleThroughputEcho(other, peer), "frames of another measurement")
+
+		result := test.result(4, 1000, start, time.Second)
+		assert.Equal(t, 4, result.Sent)
+		assert.Equal(t, 3, result.Received)
+		assert.InDelta(t, 25, result.LossPercent, 1e-9)
+		assert.InDelta(t, 0.032, result.SendMbps, 1e-9)
+		assert.InDelta(t, 0.024, result.ReceiveMbps, 0.001)
+		assert.GreaterOrEqual(t, result.MeanRTT, 100*time.Millisecond)
+	})
+
+	t.Run("Invalid arguments", func(t *testing.T) {
+		conn := newTestUDPConn(t, &mockClient{})
+		ctx := context.Background()
+
+		_, err := BenchmarkRelayThroughput(ctx, conn, &net.TCPAddr{}, 200, 1)
+		assert.ErrorIs(t, err, errUDPAddrCast)
+		_, err = BenchmarkRelayThroughput(ctx, conn, peer, throughputHeaderLen-1, 1)
+		assert.ErrorIs(t, err, errInvalidThroughputPayload)
+		_, err = BenchmarkRelayThroughput(ctx, conn, peer, 200, 0)
+		assert.ErrorIs(t, err, errInvalidThroughputDuration)
+
+		conn.throughputTest.Store(&throughputTest{})
+		_, err = BenchmarkRelayThroughput(ctx, conn, peer, 200, 1)
+		assert.ErrorIs(t, err, errThroughputInProgress)
+	})
+}
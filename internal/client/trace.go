@@ -0,0 +1,114 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// ClientTrace is a set of hooks run at stages of the life of an allocation,
+// like httptrace.ClientTrace for HTTP requests. Any hook may be nil. Hooks
+// may be called from several goroutines at once and must not block.
+type ClientTrace struct {
+	// AllocateDone is called when an Allocate transaction completes, with the
+	// relayed address or the error.
+	AllocateDone func(addr net.Addr, err error)
+
+	// PermissionCreated is called when the server granted a new permission
+	// for the IP of peer.
+	PermissionCreated func(peer net.Addr)
+
+	// ChannelBound is called when the channel ch was bound to peer.
+	ChannelBound func(peer net.Addr, ch uint16)
+
+	// BindingRefreshed is called when the channel binding of peer was
+	// refreshed.
+	BindingRefreshed func(peer net.Addr)
+
+	// AllocationRefreshed is called when a Refresh succeeded, with the
+	// lifetime the server granted.
+	AllocationRefreshed func(remaining time.Duration)
+}
+
+type clientTraceKey struct{}
+
+// WithClientTrace returns a new context based on ctx that carries trace.
+// Hooks already in ctx are still called, after those of trace.
+func WithClientTrace(ctx context.Context, trace *ClientTrace) context.Context {
+	if trace == nil {
+		return ctx
+	}
+	if old := ContextClientTrace(ctx); old != nil {
+		trace = trace.compose(old)
+	}
+
+	return context.WithValue(ctx, clientTraceKey{}, trace)
+}
+
+// ContextClientTrace returns the ClientTrace of ctx, or nil if there is none.
+func ContextClientTrace(ctx context.Context) *ClientTrace {
+	trace, _ := ctx.Value(clientTraceKey{}).(*ClientTrace)
+
+	return trace
+}
+
+// compose returns a trace calling the hooks of t, then those of old.
+func (t *ClientTrace) compose(old *ClientTrace) *ClientTrace {
+	return &ClientTrace{
+		AllocateDone: func(addr net.Addr, err error) {
+			t.allocateDone(addr, err)
+			old.allocateDone(addr, err)
+		},
+		PermissionCreated: func(peer net.Addr) {
+			t.permissionCreated(peer)
+			old.permissionCreated(peer)
+		},
+		ChannelBound: func(peer net.Addr, ch uint16) {
+			t.channelBound(peer, ch)
+			old.channelBound(peer, ch)
+		},
+		BindingRefreshed: func(peer net.Addr) {
+			t.bindingRefreshed(peer)
+			old.bindingRefreshed(peer)
+		},
+		AllocationRefreshed: func(remaining time.Duration) {
+			t.allocationRefreshed(remaining)
+			old.allocationRefreshed(remaining)
+		},
+	}
+}
+
+// allocateDone calls the AllocateDone hook. Like the other helpers below, it
+// does nothing if t or the hook is nil.
+func (t *ClientTrace) allocateDone(addr net.Addr, err error) {
+	if t != nil && t.AllocateDone != nil {
+		t.AllocateDone(addr, err)
+	}
+}
+
+func (t *ClientTrace) permissionCreated(peer net.Addr) {
+	if t != nil && t.PermissionCreated != nil {
+		t.PermissionCreated(peer)
+	}
+}
+
+func (t *ClientTrace) channelBound(peer net.Addr, ch uint16) {
+	if t != nil && t.ChannelBound != nil {
+		t.ChannelBound(peer, ch)
+	}
+}
+
+func (t *ClientTrace) bindingRefreshed(peer net.Addr) {
+	if t != nil && t.BindingRefreshed != nil {
+		t.BindingRefreshed(peer)
+	}
+}
+
+func (t *ClientTrace) allocationRefreshed(remaining time.Duration) {
+	if t != nil && t.AllocationRefreshed != nil {
+		t.AllocationRefreshed(remaining)
+	}
+}
@@ -0,0 +1,129 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4/internal/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+// traceRecorder is a ClientTrace recording the hooks called.
+type traceRecorder struct {
+	mutex  sync.Mutex
+	events []string
+}
+
+func (r *traceRecorder) record(format string, args ...any) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.events = append(r.events, fmt.Sprintf(format, args...))
+}
+
+func (r *traceRecorder) has(event string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, e := range r.events {
+		if e == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *traceRecorder) trace() *ClientTrace {
+	return &ClientTrace{
+		AllocateDone:        func(addr net.Addr, err error) { r.record("allocate %v %v", addr, err) },
+		PermissionCreated:   func(peer net.Addr) { r.record("permission %s", peer) },
+		ChannelBound:        func(peer net.Addr, ch uint16) { r.record("channel %s %d", peer, ch) },
+		BindingRefreshed:    func(peer net.Addr) { r.record("binding refreshed %s", peer) },
+		AllocationRefreshed: func(remaining time.Duration) { r.record("allocation refreshed %s", remaining) },
+	}
+}
+
+func TestClientTrace(t *testing.T) {
+	t.Run("WithClientTrace()", func(t *testing.T) {
+		ctx := context.Background()
+		assert.Nil(t, ContextClientTrace(ctx))
+		assert.Equal(t, ctx, WithClientTrace(ctx, nil))
+
+		var calls []string
+		ctx = WithClientTrace(ctx, &ClientTrace{
+			PermissionCreated: func(net.Addr) { calls = append(calls, "first") },
+		})
+		ctx = WithClientTrace(ctx, &ClientTrace{
+			PermissionCreated: func(net.Addr) { calls = append(calls, "second") },
+			ChannelBound:      func(net.Addr, uint16) { calls = append(calls, "bound") },
+		})
+
+		trace := ContextClientTrace(ctx)
+		trace.permissionCreated(nil)
+		trace.channelBound(nil, 0x4000)
+		trace.allocationRefreshed(time.Minute) // Set by neither
+		assert.Equal(t, []string{"second", "first", "bound"}, calls)
+
+		var nilTrace *ClientTrace
+		nilTrace.allocateDone(nil, nil)
+	})
+
+	t.Run("UDPConn hooks", func(t *testing.T) {
+		peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+		client := &mockClient{
+			performTransaction: func(_ context.Context, msg *stun.Message, _ net.Addr, _ bool) (TransactionResult, error) {
+				attrs := []stun.Setter{stun.NewType(msg.Type.Method, stun.ClassSuccessResponse)}
+				if msg.Type.Method == stun.MethodRefresh {
+					attrs = append(attrs, proto.Lifetime{Duration: time.Minute})
+				}
+
+				return TransactionResult{Msg: stun.MustBuild(attrs...)}, nil
+			},
+		}
+		recorder := &traceRecorder{}
+		conn, err := NewUDPConn(&AllocationConfig{
+			Client:      client,
+			RelayedAddr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 3478},
+			Lifetime:    time.Minute,
+			Log:         logging.NewDefaultLoggerFactory().NewLogger("test"),
+			Trace:       recorder.trace(),
+		},
+			WithAllocationRefreshInterval(20*time.Millisecond),
+			WithAllocationRefreshJitter(0),
+			WithBindingRefreshInterval(20*time.Millisecond),
+		)
+		assert.NoError(t, err)
+		defer conn.Close() //nolint:errcheck
+
+		_, err = conn.WriteTo([]byte("hello"), peer)
+		assert.NoError(t, err)
+		assert.True(t, recorder.has("permission "+peer.String()), "the permission precedes the write")
+		assert.Eventually(t, func() bool {
+			return recorder.has(fmt.Sprintf("channel %s %d", peer, 0x4000)) // The first channel number
+		}, time.Second, 5*time.Millisecond)
+		assert.False(t, recorder.has("binding refreshed "+peer.String()))
+
+		// Once the binding is older than the refresh interval, the next check refreshes it
+		time.Sleep(30 * time.Millisecond)
+		bound, ok := conn.bindingMgr.FindByAddr(peer)
+		assert.True(t, ok)
+		conn.maybeBind(bound)
+		assert.Eventually(t, func() bool {
+			return recorder.has("binding refreshed " + peer.String())
+		}, time.Second, 5*time.Millisecond)
+
+		assert.Eventually(t, func() bool {
+			return recorder.has("allocation refreshed 1m0s")
+		}, time.Second, 5*time.Millisecond)
+	})
+}
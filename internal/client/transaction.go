@@ -4,6 +4,7 @@
 package client
 
 import (
+	"context"
 	"net"
 	"sync"
 	"time"
@@ -20,6 +21,7 @@ type TransactionResult struct {
 	Msg     *stun.Message
 	From    net.Addr
 	Retries int
+	RTT     time.Duration // From sending the request until the response, zero if it was retransmitted
 	Err     error
 }
 
@@ -30,6 +32,9 @@ type TransactionConfig struct {
 	To           net.Addr
 	Interval     time.Duration
 	IgnoreResult bool // True to throw away the result of this transaction (it will not be readable using WaitForResult)
+	// MaxInterval caps the doubling retransmission interval, zero selects
+	// 1.6 seconds.
+	MaxInterval time.Duration
 }
 
 // Transaction represents a transaction.
@@ -37,8 +42,10 @@ type Transaction struct {
 	Key      string                 // Read-only
 	Raw      []byte                 // Read-only
 	To       net.Addr               // Read-only
+	created  time.Time              // Read-only
 	nRtx     int                    // Modified only by the timer thread
 	interval time.Duration          // Modified only by the timer thread
+	maxIntvl time.Duration          // Read-only
 	timer    *time.Timer            // Thread-safe, set only by the creator, and stopper
 	resultCh chan TransactionResult // Thread-safe
 	mutex    sync.RWMutex
@@ -48,14 +55,22 @@ type Transaction struct {
 func NewTransaction(config *TransactionConfig) *Transaction {
 	var resultCh chan TransactionResult
 	if !config.IgnoreResult {
-		resultCh = make(chan TransactionResult)
+		// Buffered so that a late result never blocks the writer
+		// after the waiter has given up (see WaitForResultContext).
+		resultCh = make(chan TransactionResult, 1)
+	}
+	maxInterval := config.MaxInterval
+	if maxInterval == 0 {
+		maxInterval = maxRtxInterval
 	}
 
 	return &Transaction{
 		Key:      config.Key,      // Read-only
 		Raw:      config.Raw,      // Read-only
 		To:       config.To,       // Read-only
+		created:  time.Now(),      // Read-only
 		interval: config.Interval, // Modified only by the timer thread
+		maxIntvl: maxInterval,     // Read-only
 		resultCh: resultCh,        // Thread-safe
 	}
 }
@@ -70,8 +85,8 @@ func (t *Transaction) StartRtxTimer(onTimeout func(trKey string, nRtx int)) {
 		t.nRtx++
 		nRtx := t.nRtx
 		t.interval *= 2
-		if t.interval > maxRtxInterval {
-			t.interval = maxRtxInterval
+		if t.interval > t.maxIntvl {
+			t.interval = t.maxIntvl
 		}
 		t.mutex.Unlock()
 		onTimeout(t.Key, nRtx)
@@ -115,6 +130,29 @@ func (t *Transaction) WaitForResult() TransactionResult {
 	return result
 }
 
+// WaitForResultContext waits for the transaction result or until ctx is done.
+// If ctx is done first, the returned result carries ctx.Err().
+func (t *Transaction) WaitForResultContext(ctx context.Context) TransactionResult {
+	if t.resultCh == nil {
+		return TransactionResult{
+			Err: errWaitForResultOnNonResultTransaction,
+		}
+	}
+
+	select {
+	case result, ok := <-t.resultCh:
+		if !ok {
+			result.Err = errTransactionClosed
+		}
+
+		return result
+	case <-ctx.Done():
+		return TransactionResult{
+			Err: ctx.Err(),
+		}
+	}
+}
+
 // Close closes the transaction.
 func (t *Transaction) Close() {
 	if t.resultCh != nil {
@@ -122,6 +160,17 @@ func (t *Transaction) Close() {
 	}
 }
 
+// RTT returns the time since the transaction was created, right before its
+// request was first sent. Following Karn's algorithm it is zero once the
+// request was retransmitted, as the response may answer any of the sends.
+func (t *Transaction) RTT() time.Duration {
+	if t.Retries() > 0 {
+		return 0
+	}
+
+	return time.Since(t.created)
+}
+
 // Retries returns the number of retransmission it has made.
 func (t *Transaction) Retries() int {
 	t.mutex.RLock()
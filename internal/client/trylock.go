@@ -22,6 +22,11 @@ func (c *TryLock) Lock() error {
 	return nil
 }
 
+// Locked reports whether the try-lock is locked.
+func (c *TryLock) Locked() bool {
+	return atomic.LoadInt32(&c.n) == 1
+}
+
 // Unlock unlocks the try-lock.
 func (c *TryLock) Unlock() {
 	atomic.StoreInt32(&c.n, 0)
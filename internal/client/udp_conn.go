@@ -5,29 +5,47 @@
 package client
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"math"
 	"net"
+	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/pion/logging"
 	"github.com/pion/stun/v3"
+	"github.com/pion/transport/v3/deadline"
+	"github.com/pion/turn/v4/binding"
+	"github.com/pion/turn/v4/internal/ipnet"
 	"github.com/pion/turn/v4/internal/proto"
 )
 
 const (
-	maxReadQueueSize       = 1024
-	permRefreshInterval    = 120 * time.Second
-	bindingRefreshInterval = 5 * time.Minute
-	bindingCheckInterval   = 30 * time.Second
-	maxRetryAttempts       = 3
+	defaultReadQueueSize          = 1024
+	defaultPermRefreshInterval    = 120 * time.Second
+	defaultPermLifetime           = 300 * time.Second // RFC 5766 Section 8
+	defaultPermRefreshMargin      = 60 * time.Second
+	defaultPermGCInterval         = 60 * time.Second
+	defaultBindingRefreshInterval = 5 * time.Minute
+	bindingCheckInterval          = 30 * time.Second
+	maxRetryAttempts              = 3
+
+	// The allocation is refreshed at allocRefreshRatio of its lifetime,
+	// randomized by +/- defaultAllocRefreshJitter of that interval.
+	allocRefreshRatio         = 0.8
+	defaultAllocRefreshJitter = 0.1
 )
 
 const (
 	timerIDRefreshAlloc int = iota
 	timerIDRefreshPerms
 	timerIDCheckBindings
+	timerIDGCPerms
 )
 
 type inboundData struct {
@@ -38,53 +56,181 @@ type inboundData struct {
 // UDPConn is the implementation of the Conn and PacketConn interfaces for UDP network connections.
 // compatible with net.PacketConn and net.Conn.
 type UDPConn struct {
-	bindingMgr         *bindingManager   // Thread-safe
-	checkBindingsTimer *PeriodicTimer    // Thread-safe
-	readCh             chan *inboundData // Thread-safe
-	closeCh            chan struct{}     // Thread-safe
+	bindingMgr             *binding.Manager               // Thread-safe
+	bindingConfig          binding.ManagerConfig          // Read-only, set by options for bindingMgr
+	checkBindingsTimer     *PeriodicTimer                 // Thread-safe
+	readCh                 chan *inboundData              // Thread-safe
+	readRing               *inboundRing                   // Thread-safe
+	readQueueSize          int                            // Read-only
+	dialed                 *dialedConns                   // Thread-safe
+	closeCh                chan struct{}                  // Thread-safe
+	closing                atomic.Bool                    // Thread-safe, set by the shutdown that closes closeCh
+	closedCh               chan CloseEvent                // Thread-safe, gets one event when closeCh is closed
+	writeDeadline          *deadline.Deadline             // Thread-safe
+	bindRetryPolicy        RetryPolicy                    // Read-only
+	bindingRefreshInterval time.Duration                  // Read-only, zero means default
+	failedCooldown         time.Duration                  // Read-only, zero disables recovery
+	addressFamily          proto.RequestedAddressFamily   // Read-only
+	allocRefreshInterval   time.Duration                  // Read-only, zero means derived from lifetime
+	allocRefreshJitter     float64                        // Read-only
+	closeErr               atomic.Value                   // Thread-safe, cause of an unsolicited close
+	stats                  connStats                      // Thread-safe
+	writeQueue             *writeQueue                    // Read-only, nil unless WithWriteQueue is used
+	slowWriteThreshold     time.Duration                  // Read-only, zero disables counting slow writes
+	maxPacketSize          int                            // Read-only, zero means no limit
+	flowControl            *flowControl                   // Read-only, nil unless WithFlowControl is used
+	icmp                   *icmpListener                  // Read-only, nil unless WithICMPListener is used
+	mtu                    atomic.Int32                   // Thread-safe, path MTU to the server
+	mtuMutex               sync.Mutex                     // Serializes DiscoverMTU
+	mtuProbe               atomic.Pointer[mtuProbe]       // Thread-safe, the DiscoverMTU in progress
+	mtuProbeTimeout        time.Duration                  // Read-only, echo wait of DiscoverMTU
+	throughputTest         atomic.Pointer[throughputTest] // Thread-safe, the BenchmarkRelayThroughput in progress
+	onData                 atomic.Pointer[DataHandler]    // Thread-safe, set by OnDataReceived
+	readers                atomic.Int32                   // Thread-safe, ReadFrom calls in progress
+	onRTT                  func(rtt time.Duration)        // Read-only, may be nil
+	idleTimeout            time.Duration                  // Read-only, zero disables the idle watchdog
+	requireChannelTimeout  time.Duration                  // Read-only, zero allows Send indications
+	bindingChanges         changeNotifier                 // Thread-safe, notified on binding state changes
+	reconnecting           atomic.Bool                    // Thread-safe, set while Reconnect runs
+	drainMutex             sync.RWMutex                   // Guards draining against new writes
+	draining               bool                           // Protected by drainMutex, set by CloseWithDrain
+	inflight               sync.WaitGroup                 // Thread-safe, writes in progress
 	allocation
 }
 
 // NewUDPConn creates a new instance of UDPConn.
-func NewUDPConn(config *AllocationConfig) *UDPConn {
+// config must carry the Client used to talk to the TURN server.
+func NewUDPConn(config *AllocationConfig, opts ...UDPConnOption) (*UDPConn, error) {
+	if config == nil || config.Client == nil {
+		return nil, errNilAllocationClient
+	}
+
 	conn := &UDPConn{
-		bindingMgr: newBindingManager(),
-		readCh:     make(chan *inboundData, maxReadQueueSize),
-		closeCh:    make(chan struct{}),
+		readQueueSize:      defaultReadQueueSize,
+		dialed:             newDialedConns(),
+		closeCh:            make(chan struct{}),
+		closedCh:           make(chan CloseEvent, 1),
+		writeDeadline:      deadline.New(),
+		bindRetryPolicy:    DefaultRetryPolicy(),
+		addressFamily:      config.AddressFamily,
+		allocRefreshJitter: defaultAllocRefreshJitter,
 		allocation: allocation{
-			client:      config.Client,
-			relayedAddr: config.RelayedAddr,
-			serverAddr:  config.ServerAddr,
-			readTimer:   time.NewTimer(time.Duration(math.MaxInt64)),
-			permMap:     newPermissionMap(),
-			username:    config.Username,
-			realm:       config.Realm,
-			integrity:   config.Integrity,
-			_nonce:      config.Nonce,
-			_lifetime:   config.Lifetime,
-			net:         config.Net,
-			log:         config.Log,
+			client:       config.Client,
+			_relayedAddr: config.RelayedAddr,
+			_mappedAddr:  config.MappedAddr,
+			trace:        config.Trace,
+			serverAddr:   config.ServerAddr,
+			readTimer:    time.NewTimer(time.Duration(math.MaxInt64)),
+			permMap:      newPermissionMap(),
+			_username:    config.Username,
+			_realm:       config.Realm,
+			software:     optionalSoftware(config.Software),
+			_integrity:   config.integrity(),
+			_lifetime:    config.Lifetime,
+			net:          config.Net,
+			log:          config.Log,
+
+			permRefreshInterval: defaultPermRefreshInterval,
+			permGCInterval:      defaultPermGCInterval,
+			_mobilityTicket:     config.MobilityTicket,
 		},
 	}
 
+	conn._nonce.Store(&config.Nonce)
+	if conn.addressFamily == 0 {
+		conn.addressFamily = addressFamilyOf(config.RelayedAddr)
+	}
+
+	for _, opt := range opts {
+		if err := opt(conn); err != nil {
+			return nil, err
+		}
+	}
+
+	if conn.log == nil {
+		conn.log = logging.NewDefaultLoggerFactory().NewLogger("turnc")
+	}
+	conn.permMap.lifetime = conn.permLifetimeOrDefault()
+	onStateChange := conn.bindingConfig.OnStateChange
+	conn.bindingConfig.OnStateChange = func(addr net.Addr, oldState, newState binding.State) {
+		logEvent(conn.log, "Channel binding state changed",
+			slog.String("peer", addr.String()),
+			slog.String("from", oldState.String()),
+			slog.String("to", newState.String()))
+		conn.bindingChanges.notify()
+		if onStateChange != nil {
+			onStateChange(addr, oldState, newState)
+		}
+	}
+	if conn.bindingConfig.HighWaterMark > 0 {
+		onHighWater := conn.bindingConfig.OnHighWaterMark
+		conn.bindingConfig.OnHighWaterMark = func(current, max int) {
+			conn.log.Warnf("%d channel bindings exceed the high-water mark, %d channel numbers are available",
+				current, max)
+			if onHighWater != nil {
+				onHighWater(current, max)
+			}
+		}
+	}
+	conn.bindingMgr = binding.NewManager(conn.bindingConfig)
+	conn.readCh = make(chan *inboundData, conn.readQueueSize)
+	conn.readRing = newInboundRing(conn.readQueueSize)
+	if conn.writeQueue != nil {
+		ctx, cancel := conn.closeContext()
+		go func() {
+			defer cancel()
+			conn.writeQueue.run(ctx, func() {
+				conn.stats.writesExpired.Add(1)
+			}, func(err error) {
+				conn.log.Debugf("Failed to send queued write: %s", err)
+			})
+		}()
+	}
+
+	conn.mtu.Store(defaultMTU)
+	conn.mtuProbeTimeout = defaultMTUProbeTimeout
+	if conn.icmp != nil {
+		ctx, cancel := conn.closeContext()
+		go func() {
+			defer cancel()
+			conn.readICMP(ctx)
+		}()
+	}
+
+	if conn.flowControl != nil {
+		ctx, cancel := conn.closeContext()
+		go func() {
+			defer cancel()
+			conn.flowControl.run(ctx, func(err error) {
+				conn.log.Debugf("Failed to probe send buffer: %s", err)
+			})
+		}()
+	}
+
 	conn.log.Debugf("Initial lifetime: %d seconds", int(conn.lifetime().Seconds()))
 
-	conn.refreshAllocTimer = NewPeriodicTimer(
+	conn.refreshAllocTimer = NewPeriodicTimerFunc(
 		timerIDRefreshAlloc,
-		conn.onRefreshTimers,
-		conn.lifetime()/2,
+		conn.onRefreshAllocTimer,
+		conn.nextAllocRefresh,
 	)
 
 	conn.refreshPermsTimer = NewPeriodicTimer(
 		timerIDRefreshPerms,
-		conn.onRefreshTimers,
-		permRefreshInterval,
+		conn.onPermissionTimers,
+		conn.permRefreshInterval,
+	)
+
+	conn.gcPermsTimer = NewPeriodicTimer(
+		timerIDGCPerms,
+		conn.onPermissionTimers,
+		conn.permGCInterval,
 	)
 
 	conn.checkBindingsTimer = NewPeriodicTimer(
 		timerIDCheckBindings,
 		func(timerID int) {
-			for _, bound := range conn.bindingMgr.all() {
+			for _, bound := range conn.bindingMgr.All() {
 				conn.maybeBind(bound)
 			}
 		},
@@ -97,11 +243,24 @@ func NewUDPConn(config *AllocationConfig) *UDPConn {
 	if conn.refreshPermsTimer.Start() {
 		conn.log.Debugf("Started refresh permission timer")
 	}
+	if conn.gcPermsTimer.Start() {
+		conn.log.Debugf("Started permission GC timer")
+	}
 	if conn.checkBindingsTimer.Start() {
 		conn.log.Debugf("Started check bindings timer")
 	}
 
-	return conn
+	if conn.idleTimeout > 0 {
+		// The watchdog may close the connection, so it starts last
+		conn.touch()
+		ctx, cancel := conn.closeContext()
+		go func() {
+			defer cancel()
+			conn.runIdleWatchdog(ctx)
+		}()
+	}
+
+	return conn, nil
 }
 
 // ReadFrom reads a packet from the connection,
@@ -115,15 +274,22 @@ func NewUDPConn(config *AllocationConfig) *UDPConn {
 // an Error with Timeout() == true after a fixed time limit;
 // see SetDeadline and SetReadDeadline.
 func (c *UDPConn) ReadFrom(p []byte) (n int, addr net.Addr, err error) {
+	c.readers.Add(1)
+	defer c.readers.Add(-1)
+
 	for {
 		select {
 		case ibData := <-c.readCh:
 			n := copy(p, ibData.data)
-			if n < len(ibData.data) {
+			short := n < len(ibData.data)
+			from := ibData.from
+			c.readRing.release(ibData)
+			if short {
 				return 0, nil, io.ErrShortBuffer
 			}
+			c.stats.bytesReceived.Add(uint64(n)) //nolint:gosec // G115, n is non-negative
 
-			return n, ibData.from, nil
+			return n, from, nil
 
 		case <-c.readTimer.C:
 			return 0, nil, &net.OpError{
@@ -138,41 +304,186 @@ func (c *UDPConn) ReadFrom(p []byte) (n int, addr net.Addr, err error) {
 				Op:   "read",
 				Net:  c.LocalAddr().Network(),
 				Addr: c.LocalAddr(),
-				Err:  errClosed,
+				Err:  c.closedError(),
 			}
 		}
 	}
 }
 
-func (a *allocation) createPermission(perm *permission, addr net.Addr) error {
-	perm.mutex.Lock()
-	defer perm.mutex.Unlock()
-
-	if perm.state() == permStateIdle {
-		// Punch a hole! (this would block a bit..)
-		if err := a.CreatePermissions(addr); err != nil {
-			a.permMap.delete(addr)
+// createPermission makes sure a permission for addr is granted. Only one
+// caller sends the CreatePermission request; concurrent callers for the same
+// permission wait for its outcome until their ctx is done.
+func (a *allocation) createPermission(ctx context.Context, perm *permission, addr net.Addr) error {
+	done, initiator := perm.begin(a.permLifetimeOrDefault())
+	if done == nil {
+		return nil
+	}
 
-			return err
+	if !initiator {
+		select {
+		case <-done:
+			return perm.result()
+		case <-ctx.Done():
+			return ctx.Err()
 		}
-		perm.setState(permStatePermitted)
 	}
 
-	return nil
+	// Punch a hole! (this would block a bit..)
+	var err error
+	switch {
+	case a.permLimiter != nil && !a.permLimiter.Allow(addr):
+		err = ErrPermissionRateLimited
+	case a.permBatcher != nil:
+		err = a.permBatcher.request(ctx, addr)
+	default:
+		err = a.createPermissions(ctx, addr)
+	}
+	switch {
+	case errors.Is(err, errTryAgain):
+		// Kept for the retry with the new nonce, which reuses perm
+	case err != nil:
+		a.permMap.delete(addr)
+	default:
+		logEvent(a.log, "Permission granted", slog.String("peer", addr.String()))
+		a.trace.permissionCreated(addr)
+		a.events.add(EventPermissionGranted, addr, "")
+	}
+	perm.finish(err)
+
+	return err
 }
 
 // WriteTo writes a packet with payload to addr.
+// On success it returns len(payload), whether it was relayed in a
+// ChannelData message or a Send indication, as net.PacketConn requires.
 // WriteTo can be made to time out and return
 // an Error with Timeout() == true after a fixed time limit;
 // see SetDeadline and SetWriteDeadline.
-// On packet-oriented connections, write timeouts are rare.
-func (c *UDPConn) WriteTo(payload []byte, addr net.Addr) (int, error) { //nolint:gocognit,cyclop
+// The deadline also bounds waiting for a permission and, with a write
+// queue, for room in the queue.
+func (c *UDPConn) WriteTo(payload []byte, addr net.Addr) (int, error) {
+	select {
+	case <-c.writeDeadline.Done():
+		return 0, c.writeTimeoutError()
+	default:
+	}
+
+	n, err := c.WriteToContext(c.writeDeadline, payload, addr)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return n, c.writeTimeoutError()
+	}
+
+	return n, err
+}
+
+// writeTimeoutError returns the error of a WriteTo that missed the write deadline.
+func (c *UDPConn) writeTimeoutError() error {
+	return &net.OpError{
+		Op:   "write",
+		Net:  c.LocalAddr().Network(),
+		Addr: c.LocalAddr(),
+		Err:  os.ErrDeadlineExceeded,
+	}
+}
+
+// WriteToContext acts like WriteTo but aborts any blocking TURN transaction
+// (e.g. CreatePermission) once ctx is done, returning ctx.Err().
+// With a write queue, ctx only bounds the wait for room in the queue.
+func (c *UDPConn) WriteToContext(ctx context.Context, payload []byte, addr net.Addr) (int, error) {
+	return c.WriteToWithOptions(ctx, payload, addr, SendOptions{})
+}
+
+// SendOptions control how a single write is relayed.
+type SendOptions struct {
+	// DontFragment asks the server to set the DF bit on the IPv4 packet it
+	// relays to the peer, RFC 5766 Section 14.8. The data is then sent in a
+	// Send indication with DONT-FRAGMENT, since ChannelData cannot carry it.
+	DontFragment bool
+}
+
+// WriteToWithOptions acts like WriteToContext, relaying payload as set by opts.
+func (c *UDPConn) WriteToWithOptions(
+	ctx context.Context,
+	payload []byte,
+	addr net.Addr,
+	opts SendOptions,
+) (int, error) {
+	if err := c.checkSize(payload); err != nil {
+		return 0, err
+	}
+	if err := c.beginWrite(); err != nil {
+		return 0, err
+	}
+	defer c.inflight.Done()
+
+	return c.sendPacket(ctx, payload, addr, opts)
+}
+
+// sendPacket writes payload to addr directly or through the write queue.
+func (c *UDPConn) sendPacket(ctx context.Context, payload []byte, addr net.Addr, opts SendOptions) (int, error) {
+	if c.writeQueue == nil {
+		return c.writeTo(ctx, payload, addr, opts)
+	}
+
+	if _, ok := addr.(*net.UDPAddr); !ok {
+		return 0, errUDPAddrCast
+	}
+
+	select {
+	case <-c.closeCh:
+		return 0, c.closedError()
+	default:
+	}
+
+	queued, err := c.writeQueue.enqueue(ctx, c.closeCh, payload, addr, opts)
+	switch {
+	case errors.Is(err, errClosed):
+		return 0, c.closedError()
+	case err != nil:
+		return 0, err
+	case !queued:
+		c.stats.writesDropped.Add(1)
+	}
+
+	return len(payload), nil
+}
+
+// writeTo sends payload to addr, creating a permission and a channel binding
+// for addr as needed.
+func (c *UDPConn) writeTo( //nolint:gocognit,cyclop
+	ctx context.Context,
+	payload []byte,
+	addr net.Addr,
+	opts SendOptions,
+) (int, error) {
 	var err error
 	_, ok := addr.(*net.UDPAddr)
 	if !ok {
 		return 0, errUDPAddrCast
 	}
 
+	if c.slowWriteThreshold > 0 {
+		defer c.countSlowWrite(time.Now())
+	}
+
+	if err = ctx.Err(); err != nil {
+		return 0, err
+	}
+	if c.reconnecting.Load() {
+		return 0, ErrReconnecting
+	}
+	if c.flowControl != nil {
+		paused, err := c.flowControl.wait(ctx, c.closeCh)
+		if paused {
+			c.stats.flowPauses.Add(1)
+		}
+		if errors.Is(err, errClosed) {
+			return 0, c.closedError()
+		} else if err != nil {
+			return 0, err
+		}
+	}
+
 	// Check if we have a permission for the destination IP addr
 	perm, ok := c.permMap.find(addr)
 	if !ok {
@@ -182,51 +493,56 @@ func (c *UDPConn) WriteTo(payload []byte, addr net.Addr) (int, error) { //nolint
 
 	for i := 0; i < maxRetryAttempts; i++ {
 		// c.createPermission() would block, per destination IP (, or perm),
-		// until the perm state becomes "requested". Purpose of this is to
+		// until the perm leaves the pending state. Purpose of this is to
 		// guarantee the order of packets (within the same perm).
 		// Note that CreatePermission transaction may not be complete before
 		// all the data transmission. This is done assuming that the request
 		// will be most likely successful and we can tolerate some loss of
 		// UDP packet (or reorder), inorder to minimize the latency in most cases.
-		if err = c.createPermission(perm, addr); !errors.Is(err, errTryAgain) {
+		if err = c.createPermission(ctx, perm, addr); !errors.Is(err, errTryAgain) {
 			break
 		}
 	}
 	if err != nil {
+		c.stats.permissionErrors.Add(1)
+
 		return 0, err
 	}
 
+	if opts.DontFragment {
+		return c.sendIndication(payload, addr, opts)
+	}
+
 	// Bind channel
-	bound, ok := c.bindingMgr.findByAddr(addr)
+	bound, ok := c.bindingMgr.FindByAddr(addr)
 	if !ok {
-		bound = c.bindingMgr.create(addr)
+		if bound, err = c.bindingMgr.Create(addr); err != nil {
+			if c.requireChannelTimeout > 0 {
+				return 0, fmt.Errorf("%w: %w", ErrChannelNotReady, err)
+			}
+			// No channel for this peer, keep relaying with indications
+			c.log.Debugf("Failed to create channel binding for %s: %s", addr, err)
+
+			return c.sendIndication(payload, addr, opts)
+		}
 	}
 
 	//nolint:nestif
-	if !bound.ok() {
+	if !bound.OK() {
 		// Try to establish an initial binding with the server.
-		// Writes still occur via indications meanwhile.
+		// Writes still occur via indications meanwhile, unless
+		// they must wait for the channel.
 		c.maybeBind(bound)
-
-		// Send data using SendIndication
-		peerAddr := addr2PeerAddress(addr)
-		var msg *stun.Message
-		msg, err = stun.Build(
-			stun.TransactionID,
-			stun.NewType(stun.MethodSend, stun.ClassIndication),
-			proto.Data(payload),
-			peerAddr,
-			stun.Fingerprint,
-		)
-		if err != nil {
+		if c.requireChannelTimeout == 0 {
+			return c.sendIndication(payload, addr, opts)
+		}
+		if err = c.waitForChannel(ctx, bound, c.requireChannelTimeout); err != nil {
 			return 0, err
 		}
-
-		return c.client.WriteTo(msg.Raw, c.serverAddr)
 	}
 
 	// Binding is ready beyond this point, so send over it.
-	_, err = c.sendChannelData(payload, bound.number)
+	_, err = c.sendChannelData(payload, bound.Number())
 	if err != nil {
 		return 0, err
 	}
@@ -237,25 +553,233 @@ func (c *UDPConn) WriteTo(payload []byte, addr net.Addr) (int, error) { //nolint
 // Close closes the connection.
 // Any blocked ReadFrom or WriteTo operations will be unblocked and return errors.
 func (c *UDPConn) Close() error {
+	return c.close(CloseEvent{Reason: CloseReasonLocal})
+}
+
+// Closed returns a channel that receives a CloseEvent telling why the UDPConn
+// was torn down, and is closed afterwards.
+func (c *UDPConn) Closed() <-chan CloseEvent {
+	return c.closedCh
+}
+
+// close tears the UDPConn down and delivers event on Closed.
+func (c *UDPConn) close(event CloseEvent) error {
+	return c.shutdown(event, func() error {
+		return c.refreshAllocation(context.Background(), 0, true /* dontWait=true */)
+	})
+}
+
+// shutdown tears the UDPConn down, calls release to delete the allocation on
+// the server and delivers event on Closed.
+func (c *UDPConn) shutdown(event CloseEvent, release func() error) error {
 	c.refreshAllocTimer.Stop()
 	c.refreshPermsTimer.Stop()
+	c.gcPermsTimer.Stop()
 	c.checkBindingsTimer.Stop()
 
-	select {
-	case <-c.closeCh:
+	// Close may race with the refresh timer or the idle watchdog, only the
+	// first caller shuts down
+	if !c.closing.CompareAndSwap(false, true) {
 		return errAlreadyClosed
-	default:
-		close(c.closeCh)
+	}
+	close(c.closeCh)
+
+	if deleted := c.bindingMgr.DeleteByState(binding.StateFailed); deleted > 0 {
+		c.log.Debugf("Deleted %d failed channel bindings", deleted)
+	}
+	// Stop binding channels before the allocation is released
+	if err := c.bindingMgr.Close(); err != nil {
+		c.log.Debugf("Failed to close binding manager: %s", err)
+	}
+
+	if c.writeQueue != nil {
+		// Writes still queued are discarded
+		<-c.writeQueue.done
+	}
+
+	c.client.OnDeallocated(c.relayedAddr())
+
+	err := release()
+	c.closedCh <- event
+	close(c.closedCh)
+
+	return err
+}
+
+// nextAllocRefresh returns the randomized delay until the next allocation refresh.
+func (c *UDPConn) nextAllocRefresh() time.Duration {
+	interval := c.allocRefreshInterval
+	if interval == 0 {
+		interval = time.Duration(float64(c.lifetime()) * allocRefreshRatio)
+	}
+	if c.allocRefreshJitter > 0 {
+		interval = time.Duration(float64(interval) * (1 + c.allocRefreshJitter*(2*randFloat64()-1)))
+	}
+
+	return interval
+}
+
+// onRefreshAllocTimer refreshes the allocation. If that fails the allocation
+// is about to expire on the server, so the UDPConn is closed.
+func (c *UDPConn) onRefreshAllocTimer(id int) {
+	c.log.Debugf("Refresh timer %d expired", id)
+	if c.reconnecting.Load() {
+		return
+	}
+
+	err := c.refreshAllocationWithRetry(context.Background())
+	if err == nil {
+		return
+	}
+
+	c.log.Warnf("Failed to refresh allocation, closing: %s", err)
+	c.closeErr.Store(err)
+	if err := c.close(CloseEvent{Reason: closeReasonOf(err), Err: err}); err != nil {
+		c.log.Debugf("Failed to close after refresh failure: %s", err)
+	}
+}
+
+// onPermissionTimers refreshes and collects permissions, unless Reconnect is
+// moving the allocation.
+func (c *UDPConn) onPermissionTimers(id int) {
+	if c.reconnecting.Load() {
+		return
+	}
+	c.onRefreshTimers(id)
+}
+
+// closedError returns the error reported by operations on a closed UDPConn.
+func (c *UDPConn) closedError() error {
+	if cause, ok := c.closeErr.Load().(error); ok {
+		return fmt.Errorf("%w: %w", errClosed, cause)
 	}
 
-	c.client.OnDeallocated(c.relayedAddr)
+	return errClosed
+}
+
+// DataHandler is passed data received from peer.
+type DataHandler func(data []byte, peer net.Addr)
+
+// OnDataReceived makes data that arrives from peers while no ReadFrom is
+// waiting go to handler instead of being queued for the next ReadFrom, e.g.
+// to react to data pushed by a peer right away. Data for conns returned by
+// Dial is not affected. handler runs on the goroutine receiving from the
+// TURN server and must not block. Nil restores queueing.
+func (c *UDPConn) OnDataReceived(handler DataHandler) {
+	if handler == nil {
+		c.onData.Store(nil)
+
+		return
+	}
+	c.onData.Store(&handler)
+}
+
+// Stats returns a snapshot of the connection's traffic and error counters,
+// channel bindings and permissions.
+func (c *UDPConn) Stats() Stats {
+	stats := c.stats.snapshot()
+	stats.RTT = c.rtt.snapshot()
+	for _, bound := range c.bindingMgr.All() {
+		stats.Bindings.add(bound.State())
+	}
+	for _, perm := range c.permMap.all() {
+		if perm.state() == PermissionStatePermitted {
+			stats.Permissions++
+		}
+	}
+
+	return stats
+}
+
+// Migrate moves the allocation to the 5-tuple the client now sends from, after
+// the client switched to a new local address or network (RFC 8016). Permissions
+// and channel bindings are kept by the server, so no state is renegotiated.
+// It fails if the server did not grant a mobility ticket at allocation time.
+func (c *UDPConn) Migrate(ctx context.Context) error {
+	return c.migrate(ctx)
+}
+
+// Ping sends a STUN Binding request to the TURN server to check that it is
+// alive, without refreshing the allocation. It fails if no success response
+// arrives before ctx is done. The round-trip time is reported to the handler
+// set with WithRTTHandler, unless the request was retransmitted.
+func (c *UDPConn) Ping(ctx context.Context) error {
+	msg, err := stun.Build(
+		stun.TransactionID,
+		stun.BindingRequest,
+		c.software,
+		stun.Fingerprint,
+	)
+	if err != nil {
+		return err
+	}
+
+	trRes, err := c.performTransaction(ctx, msg, false)
+	if err != nil {
+		return err
+	}
+
+	if trRes.Msg.Type != stun.BindingSuccess {
+		return fmt.Errorf("%w: %s", errUnexpectedPingResponse, trRes.Msg.Type)
+	}
+	if c.onRTT != nil && trRes.RTT > 0 {
+		c.onRTT(trRes.RTT)
+	}
+
+	return nil
+}
+
+// EventLog returns the log of recent events, or nil unless the UDPConn was
+// created with WithEventLog.
+func (c *UDPConn) EventLog() *EventLog {
+	return c.events
+}
 
-	return c.refreshAllocation(0, true /* dontWait=true */)
+// Permissions returns the permissions of the allocation, ordered by address.
+func (c *UDPConn) Permissions() []PermissionInfo {
+	return c.permMap.List()
+}
+
+// Bindings returns the channel bindings of the allocation, ordered by
+// channel number.
+func (c *UDPConn) Bindings() []binding.Info {
+	return c.bindingMgr.Snapshot()
+}
+
+// AddressFamily returns the address family of the relayed transport address.
+func (c *UDPConn) AddressFamily() proto.RequestedAddressFamily {
+	return c.addressFamily
 }
 
 // LocalAddr returns the local network address.
 func (c *UDPConn) LocalAddr() net.Addr {
-	return c.relayedAddr
+	return c.relayedAddr()
+}
+
+// RelayAddr returns the relayed transport address the TURN server assigned
+// to the allocation in the XOR-RELAYED-ADDRESS of its Allocate response. This
+// is the address to hand to remote peers, e.g. as a relay candidate. It is
+// the same as LocalAddr.
+func (c *UDPConn) RelayAddr() net.Addr {
+	return c.relayedAddr()
+}
+
+// ServerAddr returns the address of the TURN server holding the allocation.
+func (c *UDPConn) ServerAddr() net.Addr {
+	return c.serverAddr
+}
+
+// MappedAddr returns the server reflexive address the TURN server saw the
+// allocation requested from, or nil if it did not tell.
+func (c *UDPConn) MappedAddr() net.Addr {
+	return c.mappedAddr()
+}
+
+// Nonce returns the NONCE the allocation is currently authenticated with.
+// Store it with the RelayAddr to resume the allocation from a new Client with
+// ResumeAllocation.
+func (c *UDPConn) Nonce() []byte {
+	return append([]byte(nil), c.nonce()...)
 }
 
 // SetDeadline sets the read and write deadlines associated
@@ -274,6 +798,8 @@ func (c *UDPConn) LocalAddr() net.Addr {
 //
 // A zero value for t means I/O operations will not time out.
 func (c *UDPConn) SetDeadline(t time.Time) error {
+	c.writeDeadline.Set(t)
+
 	return c.SetReadDeadline(t)
 }
 
@@ -293,12 +819,12 @@ func (c *UDPConn) SetReadDeadline(t time.Time) error {
 }
 
 // SetWriteDeadline sets the deadline for future WriteTo calls
-// and any currently-blocked WriteTo call.
-// Even if write times out, it may return n > 0, indicating that
-// some of the data was successfully written.
+// and any currently-blocked WriteTo call. WriteTo calls that have not
+// handed their data to the Client by then fail with os.ErrDeadlineExceeded.
 // A zero value for t means WriteTo will not time out.
-func (c *UDPConn) SetWriteDeadline(time.Time) error {
-	// Write never blocks.
+func (c *UDPConn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.Set(t)
+
 	return nil
 }
 
@@ -319,6 +845,10 @@ func addr2PeerAddress(addr net.Addr) proto.PeerAddress {
 // CreatePermissions Issues a CreatePermission request for the supplied addresses
 // as described in https://datatracker.ietf.org/doc/html/rfc5766#section-9
 func (a *allocation) CreatePermissions(addrs ...net.Addr) error {
+	return a.createPermissions(context.Background(), addrs...)
+}
+
+func (a *allocation) createPermissions(ctx context.Context, addrs ...net.Addr) error {
 	setters := []stun.Setter{
 		stun.TransactionID,
 		stun.NewType(stun.MethodCreatePermission, stun.ClassRequest),
@@ -328,11 +858,13 @@ func (a *allocation) CreatePermissions(addrs ...net.Addr) error {
 		setters = append(setters, addr2PeerAddress(addr))
 	}
 
+	nonce := a.requestNonce()
 	setters = append(setters,
-		a.username,
-		a.realm,
-		a.nonce(),
-		a.integrity,
+		a.username(),
+		optionalRealm(a.realm()),
+		a.software,
+		optionalNonce(nonceValue(nonce)),
+		a.integrity(),
 		stun.Fingerprint)
 
 	msg, err := stun.Build(setters...)
@@ -340,7 +872,7 @@ func (a *allocation) CreatePermissions(addrs ...net.Addr) error {
 		return err
 	}
 
-	trRes, err := a.client.PerformTransaction(msg, a.serverAddr, false)
+	trRes, err := a.performTransaction(ctx, msg, false)
 	if err != nil {
 		return err
 	}
@@ -351,7 +883,7 @@ func (a *allocation) CreatePermissions(addrs ...net.Addr) error {
 		var code stun.ErrorCodeAttribute
 		if err = code.GetFrom(res); err == nil {
 			if code.Code == stun.CodeStaleNonce {
-				a.setNonceFromMsg(res)
+				a.setNonceFromMsg(nonce, res)
 
 				return errTryAgain
 			}
@@ -367,13 +899,32 @@ func (a *allocation) CreatePermissions(addrs ...net.Addr) error {
 
 // HandleInbound passes inbound data in UDPConn.
 func (c *UDPConn) HandleInbound(data []byte, from net.Addr) {
-	// Copy data
-	copied := make([]byte, len(data))
-	copy(copied, data)
+	c.touch()
+	if c.handleMTUProbe(data, from) || c.handleThroughputEcho(data, from) {
+		return
+	}
+	readCh := c.readCh
+	if dialed, ok := c.dialed.find(from); ok {
+		readCh = dialed.readCh
+	} else if handler := c.onData.Load(); handler != nil && c.readers.Load() == 0 {
+		c.stats.bytesReceived.Add(uint64(len(data)))
+		(*handler)(append([]byte(nil), data...), from)
+
+		return
+	}
+
+	// Copy data into a reusable slot
+	slot := c.readRing.acquire(data, from)
+	if slot == nil {
+		c.log.Warnf("Receive buffer full")
+
+		return
+	}
 
 	select {
-	case c.readCh <- &inboundData{data: copied, from: from}:
+	case readCh <- slot:
 	default:
+		c.readRing.release(slot)
 		c.log.Warnf("Receive buffer full")
 	}
 }
@@ -381,62 +932,145 @@ func (c *UDPConn) HandleInbound(data []byte, from net.Addr) {
 // FindAddrByChannelNumber returns a peer address associated with the
 // channel number on this UDPConn.
 func (c *UDPConn) FindAddrByChannelNumber(chNum uint16) (net.Addr, bool) {
-	b, ok := c.bindingMgr.findByNumber(chNum)
+	b, ok := c.bindingMgr.FindByChannel(chNum)
 	if !ok {
 		return nil, false
 	}
 
-	return b.addr, true
+	return b.Addr(), true
 }
 
-func (c *UDPConn) maybeBind(bound *binding) {
-	bind := func() {
-		var err error
-		for i := 0; i < maxRetryAttempts; i++ {
-			if err = c.bind(bound); !errors.Is(err, errTryAgain) {
-				break
-			}
-		}
-		if err != nil {
-			c.log.Warnf("Failed to bind channel %d: %s", bound.number, err)
-			bound.setState(bindingStateFailed)
+func (c *UDPConn) maybeBind(bound *binding.Binding) {
+	if c.reconnecting.Load() {
+		// Reconnect binds the channels again once the new allocation exists
+		return
+	}
+
+	// The binding outlives the WriteTo call that triggered it,
+	// so only closing the connection may cancel it.
+	bind := func(ctx context.Context, refresh bool) {
+		if err := c.bindWithRetry(ctx, bound); err != nil {
+			c.log.Warnf("Failed to bind channel %d: %s", bound.Number(), err)
+			c.stats.bindingErrors.Add(1)
+			c.events.add(EventBindingFailed, bound.Addr(), fmt.Sprintf("channel 0x%x: %s", bound.Number(), err))
+			c.applyBindingInput(bound, binding.InputFailed)
+			c.scheduleBindingRecovery(bound)
 
 			return
 		}
-		bound.setRefreshedAt(time.Now())
-		bound.setState(bindingStateReady)
+		bound.SetRefreshedAt(time.Now())
+		c.applyBindingInput(bound, binding.InputSucceeded)
+		if refresh {
+			c.trace.bindingRefreshed(bound.Addr())
+			c.events.add(EventBindingRefreshed, bound.Addr(), fmt.Sprintf("channel 0x%x", bound.Number()))
+		} else {
+			c.trace.channelBound(bound.Addr(), bound.Number())
+			c.events.add(EventBindingCreated, bound.Addr(), fmt.Sprintf("channel 0x%x", bound.Number()))
+		}
 	}
 
 	// Block only callers with the same binding until
 	// the binding transaction has been complete
-	bound.muBind.Lock()
-	defer bound.muBind.Unlock()
+	bound.Lock()
+	defer bound.Unlock()
 
-	state := bound.state()
-	switch {
-	case state == bindingStateIdle:
-		bound.setState(bindingStateRequest)
-	case state == bindingStateReady && time.Since(bound.refreshedAt()) > bindingRefreshInterval:
-		bound.setState(bindingStateRefresh)
-	default:
+	input := binding.InputBind
+	if bound.State() == binding.StateReady && time.Since(bound.RefreshedAt()) > c.bindingRefreshIntervalOrDefault() {
+		input = binding.InputRefreshDue
+	}
+
+	// Establish binding with the server only if the binding
+	// is idle or due for a refresh.
+	if _, err := bound.Apply(input); err != nil {
+		return
+	}
+	refresh := input == binding.InputRefreshDue
+	if !c.bindingMgr.Go(func(ctx context.Context) { bind(ctx, refresh) }) {
+		c.log.Debugf("Not binding channel %d, the connection is closed", bound.Number())
+	}
+}
+
+// applyBindingInput moves bound through its lifecycle, logging inputs that
+// do not apply, e.g. a ChannelBind completing after a reconnect rebound it.
+func (c *UDPConn) applyBindingInput(bound *binding.Binding, input binding.Input) {
+	if _, err := bound.Apply(input); err != nil {
+		c.log.Debugf("Channel %d: %s", bound.Number(), err)
+	}
+}
+
+// bindWithRetry binds the channel of bound, retrying on stale nonce as the
+// RetryPolicy allows. The resend of bind is the first retry, so that at most
+// MaxRetries+1 ChannelBind requests are sent in total.
+func (c *UDPConn) bindWithRetry(ctx context.Context, bound *binding.Binding) error {
+	if c.bindRetryPolicy.MaxRetries == 0 {
+		return c.sendChannelBind(ctx, bound)
+	}
+
+	err := c.bind(ctx, bound)
+	for retry := 1; errors.Is(err, errTryAgain) && retry < c.bindRetryPolicy.MaxRetries; retry++ {
+		// Back off before retrying with the new nonce, so that
+		// a server churning nonces does not get hammered.
+		if err = c.bindRetryPolicy.wait(ctx, retry-1); err != nil {
+			return err
+		}
+		err = c.sendChannelBind(ctx, bound)
+	}
+
+	return err
+}
+
+// bindingRefreshIntervalOrDefault returns the age after which a ready
+// binding is refreshed.
+func (c *UDPConn) bindingRefreshIntervalOrDefault() time.Duration {
+	if c.bindingRefreshInterval == 0 {
+		return defaultBindingRefreshInterval
+	}
+
+	return c.bindingRefreshInterval
+}
+
+// scheduleBindingRecovery resets a failed binding to idle once the cooldown
+// has passed, so that the next write or binding check tries to bind again.
+func (c *UDPConn) scheduleBindingRecovery(bound *binding.Binding) {
+	if c.failedCooldown <= 0 {
 		return
 	}
 
-	// Establish binding with the server if eligible
-	// with regard to cases right above.
-	go bind()
+	time.AfterFunc(c.failedCooldown, func() {
+		select {
+		case <-c.closeCh:
+			return
+		default:
+		}
+
+		if _, err := bound.Apply(binding.InputCooldownElapsed); err == nil {
+			c.log.Debugf("Retrying failed channel binding %d after cooldown", bound.Number())
+		}
+	})
+}
+
+// bind binds the channel of bound. A stale nonce response is retried once
+// right away with the nonce it carries, a second one returns errTryAgain.
+func (c *UDPConn) bind(ctx context.Context, bound *binding.Binding) error {
+	if err := c.sendChannelBind(ctx, bound); !errors.Is(err, errTryAgain) {
+		return err
+	}
+
+	return c.sendChannelBind(ctx, bound)
 }
 
-func (c *UDPConn) bind(bound *binding) error {
+func (c *UDPConn) sendChannelBind(ctx context.Context, bound *binding.Binding) error {
+	nonce := c.requestNonce()
 	setters := []stun.Setter{
 		stun.TransactionID,
 		stun.NewType(stun.MethodChannelBind, stun.ClassRequest),
-		addr2PeerAddress(bound.addr),
-		proto.ChannelNumber(bound.number),
-		c.username,
-		c.realm,
-		c.nonce(),
-		c.integrity,
+		addr2PeerAddress(bound.Addr()),
+		proto.ChannelNumber(bound.Number()),
+		c.username(),
+		optionalRealm(c.realm()),
+		c.software,
+		optionalNonce(nonceValue(nonce)),
+		c.integrity(),
 		stun.Fingerprint,
 	}
 
@@ -445,9 +1079,9 @@ func (c *UDPConn) bind(bound *binding) error {
 		return err
 	}
 
-	trRes, err := c.client.PerformTransaction(msg, c.serverAddr, false)
+	trRes, err := c.performTransaction(ctx, msg, false)
 	if err != nil {
-		c.bindingMgr.deleteByAddr(bound.addr)
+		c.bindingMgr.DeleteByAddr(bound.Addr())
 
 		return err
 	}
@@ -457,7 +1091,7 @@ func (c *UDPConn) bind(bound *binding) error {
 		var code stun.ErrorCodeAttribute
 		if err = code.GetFrom(res); err == nil {
 			if code.Code == stun.CodeStaleNonce {
-				c.setNonceFromMsg(res)
+				c.setNonceFromMsg(nonce, res)
 
 				return errTryAgain
 			}
@@ -465,12 +1099,81 @@ func (c *UDPConn) bind(bound *binding) error {
 		return fmt.Errorf("unexpected response type %s", res.Type) //nolint // dynamic errors
 	}
 
-	c.log.Debugf("Channel binding successful: %s %d", bound.addr, bound.number)
+	c.log.Debugf("Channel binding successful: %s %d", bound.Addr(), bound.Number())
 
 	// Success.
 	return nil
 }
 
+// closeContext returns a context that is canceled once the connection is closed.
+func (c *UDPConn) closeContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-c.closeCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
+// checkSize fails with ErrPacketTooLarge if payload exceeds the maximum
+// packet size, or the path MTU estimated with WithICMPListener. Payloads are
+// never split, as that would break the datagram boundaries seen by the peer.
+func (c *UDPConn) checkSize(payload []byte) error {
+	if c.maxPacketSize > 0 && len(payload) > c.maxPacketSize {
+		return ErrPacketTooLarge
+	}
+	if c.icmp != nil {
+		mtu := c.CurrentMTU()
+		if size := c.maxMTUPayload(mtu); len(payload) > size {
+			return fmt.Errorf("%w: %d bytes exceed the %d that fit the path MTU of %d",
+				ErrPacketTooLarge, len(payload), size, mtu)
+		}
+	}
+
+	return nil
+}
+
+// countSlowWrite counts a write that started at start as slow if it took
+// longer than the slow write threshold.
+func (c *UDPConn) countSlowWrite(start time.Time) {
+	if time.Since(start) > c.slowWriteThreshold {
+		c.stats.slowWrites.Add(1)
+	}
+}
+
+// sendIndication sends data to peer wrapped in a Send indication. This is the
+// fallback used until a channel binding for peer is ready.
+func (c *UDPConn) sendIndication(data []byte, peer net.Addr, opts SendOptions) (int, error) {
+	attrs := []stun.Setter{
+		stun.TransactionID,
+		stun.NewType(stun.MethodSend, stun.ClassIndication),
+		proto.Data(data),
+		addr2PeerAddress(peer),
+	}
+	if opts.DontFragment {
+		attrs = append(attrs, proto.DontFragment{})
+	}
+	msg, err := stun.Build(append(attrs, stun.Fingerprint)...)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err = c.client.WriteTo(msg.Raw, c.serverAddr); err != nil {
+		return 0, err
+	}
+	c.touch()
+	c.stats.indicationSends.Add(1)
+	c.stats.bytesSent.Add(uint64(len(data)))
+
+	return len(data), nil
+}
+
+// sendChannelData sends data over the channel chNum using the 4-byte
+// ChannelData header instead of a full STUN message.
 func (c *UDPConn) sendChannelData(data []byte, chNum uint16) (int, error) {
 	chData := &proto.ChannelData{
 		Data:   data,
@@ -481,6 +1184,18 @@ func (c *UDPConn) sendChannelData(data []byte, chNum uint16) (int, error) {
 	if err != nil {
 		return 0, err
 	}
+	c.touch()
+	c.stats.channelSends.Add(1)
+	c.stats.bytesSent.Add(uint64(len(data)))
 
 	return len(data), nil
 }
+
+func addressFamilyOf(addr net.Addr) proto.RequestedAddressFamily {
+	ip, _, err := ipnet.AddrIPPort(addr)
+	if err != nil || ip.To4() != nil {
+		return proto.RequestedFamilyIPv4
+	}
+
+	return proto.RequestedFamilyIPv6
+}
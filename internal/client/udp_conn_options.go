@@ -0,0 +1,404 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/turn/v4/binding"
+)
+
+// UDPConnOption customizes a UDPConn created by NewUDPConn.
+type UDPConnOption func(c *UDPConn) error
+
+// WithLogger sets the logger, overriding AllocationConfig.Log.
+func WithLogger(log logging.LeveledLogger) UDPConnOption {
+	return func(c *UDPConn) error {
+		if log != nil {
+			c.log = log
+		}
+
+		return nil
+	}
+}
+
+// WithSlogHandler makes the UDPConn log to handler, overriding
+// AllocationConfig.Log. Events such as binding state changes, permission
+// grants and allocation refreshes carry their details, e.g. the peer
+// address, as attributes.
+func WithSlogHandler(handler slog.Handler) UDPConnOption {
+	return func(c *UDPConn) error {
+		if handler != nil {
+			c.log = NewSlogLogger(handler)
+		}
+
+		return nil
+	}
+}
+
+// WithPermissionRefreshInterval sets how often the permissions of the
+// allocation are refreshed. Zero selects the default of 120 seconds.
+// Permissions expire after 300 seconds, see RFC 5766 Section 8.
+func WithPermissionRefreshInterval(interval time.Duration) UDPConnOption {
+	return func(c *UDPConn) error {
+		switch {
+		case interval < 0:
+			return errNegativePermRefreshInterval
+		case interval == 0:
+			c.permRefreshInterval = defaultPermRefreshInterval
+		default:
+			c.permRefreshInterval = interval
+		}
+
+		return nil
+	}
+}
+
+// WithPermissionLifetime sets how long the server keeps a permission without
+// refresh. Zero selects the RFC 5766 default of 300 seconds.
+func WithPermissionLifetime(lifetime time.Duration) UDPConnOption {
+	return func(c *UDPConn) error {
+		if lifetime < 0 {
+			return errNegativePermLifetime
+		}
+		c.permLifetime = lifetime
+
+		return nil
+	}
+}
+
+// WithPermissionRefreshMargin sets how long before its expiry a permission is
+// refreshed at the latest. Zero selects the default of 60 seconds.
+func WithPermissionRefreshMargin(margin time.Duration) UDPConnOption {
+	return func(c *UDPConn) error {
+		if margin < 0 {
+			return errNegativePermRefreshMargin
+		}
+		c.permRefreshMargin = margin
+
+		return nil
+	}
+}
+
+// WithPermissionGCInterval sets how often permissions that failed or expired
+// are removed, so that the next write to the peer requests a new one. Zero
+// selects the default of 60 seconds.
+func WithPermissionGCInterval(interval time.Duration) UDPConnOption {
+	return func(c *UDPConn) error {
+		switch {
+		case interval < 0:
+			return errNegativePermGCInterval
+		case interval == 0:
+			c.permGCInterval = defaultPermGCInterval
+		default:
+			c.permGCInterval = interval
+		}
+
+		return nil
+	}
+}
+
+// WithRetryPolicy sets the back-off used to retry ChannelBind requests
+// rejected with a stale nonce.
+func WithRetryPolicy(policy RetryPolicy) UDPConnOption {
+	return func(c *UDPConn) error {
+		if err := policy.validate(); err != nil {
+			return err
+		}
+		c.bindRetryPolicy = policy
+
+		return nil
+	}
+}
+
+// WithBindingRefreshInterval sets how old a channel binding may get before it
+// is refreshed. Zero selects the default of 5 minutes.
+func WithBindingRefreshInterval(interval time.Duration) UDPConnOption {
+	return func(c *UDPConn) error {
+		if interval < 0 {
+			return errNegativeBindingRefreshInterval
+		}
+		c.bindingRefreshInterval = interval
+
+		return nil
+	}
+}
+
+// WithAllocationRefreshInterval sets a fixed interval between allocation refreshes.
+// Zero, the default, refreshes at 80% of the allocation lifetime.
+func WithAllocationRefreshInterval(interval time.Duration) UDPConnOption {
+	return func(c *UDPConn) error {
+		if interval < 0 {
+			return errNegativeAllocRefreshInterval
+		}
+		c.allocRefreshInterval = interval
+
+		return nil
+	}
+}
+
+// WithAllocationRefreshJitter sets the fraction, in [0, 1), by which each
+// allocation refresh interval is randomized so that many allocations do not
+// refresh in lockstep. The default is 0.1.
+func WithAllocationRefreshJitter(jitter float64) UDPConnOption {
+	return func(c *UDPConn) error {
+		if jitter < 0 || jitter >= 1 {
+			return errInvalidAllocRefreshJitter
+		}
+		c.allocRefreshJitter = jitter
+
+		return nil
+	}
+}
+
+// WithPermissionBatchWindow makes WriteTo collect the peers that need a new
+// permission for the given window and request them in a single CreatePermission
+// transaction. Zero, the default, disables batching.
+func WithPermissionBatchWindow(window time.Duration) UDPConnOption {
+	return func(c *UDPConn) error {
+		if window < 0 {
+			return errNegativePermBatchWindow
+		}
+		c.permBatcher = nil
+		if window > 0 {
+			c.permBatcher = newPermissionBatcher(window, c.createPermissions)
+		}
+
+		return nil
+	}
+}
+
+// WithPermissionRateLimiter makes WriteTo ask limiter before requesting a new
+// permission, and fail with ErrPermissionRateLimited instead of sending the
+// request if it is not allowed. Nil, the default, sends requests unlimited.
+func WithPermissionRateLimiter(limiter PermissionRateLimiter) UDPConnOption {
+	return func(c *UDPConn) error {
+		c.permLimiter = limiter
+
+		return nil
+	}
+}
+
+// WithFailedBindingCooldown makes a channel binding that failed eligible for
+// another ChannelBind attempt once cooldown has passed, e.g. after the server
+// recovered from an outage. Zero, the default, keeps failed bindings failed.
+func WithFailedBindingCooldown(cooldown time.Duration) UDPConnOption {
+	return func(c *UDPConn) error {
+		if cooldown < 0 {
+			return errNegativeFailedCooldown
+		}
+		c.failedCooldown = cooldown
+
+		return nil
+	}
+}
+
+// WithReadQueueSize sets how many received packets are buffered until they
+// are read. Packets arriving while the queue is full are dropped. The default
+// is 1024.
+func WithReadQueueSize(size int) UDPConnOption {
+	return func(c *UDPConn) error {
+		if size <= 0 || size > math.MaxInt32 {
+			return errInvalidReadQueueSize
+		}
+		c.readQueueSize = size
+
+		return nil
+	}
+}
+
+// WithWriteQueue makes WriteTo queue writes and return right away, while a
+// single goroutine sends them to the TURN server. This keeps callers such as
+// real-time media senders from stalling on permissions or a full socket
+// buffer. By default writes are sent by the caller of WriteTo.
+func WithWriteQueue(config WriteQueueConfig) UDPConnOption {
+	return func(c *UDPConn) error {
+		if err := config.validate(); err != nil {
+			return err
+		}
+		c.writeQueue = newWriteQueue(config, c.writeTo)
+
+		return nil
+	}
+}
+
+// WithSlowWriteThreshold makes every write that takes longer than threshold,
+// including creating its permission and channel binding, count in
+// Stats.SlowWrites. Slow writes often point at network congestion or an
+// overloaded TURN server. Zero, the default, disables counting.
+func WithSlowWriteThreshold(threshold time.Duration) UDPConnOption {
+	return func(c *UDPConn) error {
+		if threshold < 0 {
+			return errNegativeSlowWriteThreshold
+		}
+		c.slowWriteThreshold = threshold
+
+		return nil
+	}
+}
+
+// WithMaxPacketSize makes writes with a payload larger than size fail with
+// ErrPacketTooLarge before anything is sent, e.g. to stay below the MTU of
+// the path to the TURN server. Zero, the default, means no limit.
+func WithMaxPacketSize(size int) UDPConnOption {
+	return func(c *UDPConn) error {
+		if size < 0 {
+			return errNegativeMaxPacketSize
+		}
+		c.maxPacketSize = size
+
+		return nil
+	}
+}
+
+// WithFlowControl makes writes wait while the send buffer of the socket to
+// the TURN server is fuller than config.Threshold, so that the client does
+// not overwhelm the local NIC queue. The level is polled from config.Probe,
+// e.g. NewSocketSendBufferProbe on Linux. Writes that waited are counted in
+// Stats.FlowControlPauses.
+func WithFlowControl(config FlowControlConfig) UDPConnOption {
+	return func(c *UDPConn) error {
+		if err := config.validate(); err != nil {
+			return err
+		}
+		c.flowControl = newFlowControl(config)
+
+		return nil
+	}
+}
+
+// WithICMPListener makes the UDPConn read the ICMP messages of protocol,
+// ProtocolICMP or ProtocolIPv6ICMP, from conn. Packet Too Big messages for
+// packets sent to the TURN server lower the MTU returned by CurrentMTU, and
+// writes with payloads that no longer fit fail with ErrPacketTooLarge. conn
+// must be closed by the caller after the UDPConn, which stops reading from
+// it.
+func WithICMPListener(conn ICMPConn, protocol int) UDPConnOption {
+	return func(c *UDPConn) error {
+		switch {
+		case conn == nil:
+			return errNilICMPConn
+		case protocol != ProtocolICMP && protocol != ProtocolIPv6ICMP:
+			return errInvalidICMPProtocol
+		}
+		c.icmp = &icmpListener{conn: conn, protocol: protocol}
+
+		return nil
+	}
+}
+
+// WithRequireChannelTimeout makes writes to peers whose channel is not bound
+// yet wait up to timeout for the ChannelBind, and fail with
+// ErrChannelNotReady if it does not succeed in time, instead of being sent in
+// Send indications meanwhile. Writes with SendOptions.DontFragment are still
+// sent in Send indications, as ChannelData cannot carry DONT-FRAGMENT. Zero
+// allows Send indications, which is the default.
+func WithRequireChannelTimeout(timeout time.Duration) UDPConnOption {
+	return func(c *UDPConn) error {
+		if timeout < 0 {
+			return errNegativeRequireChannelTimeout
+		}
+		c.requireChannelTimeout = timeout
+
+		return nil
+	}
+}
+
+// WithIdleWatchdog makes the UDPConn send a Binding request to the TURN
+// server when nothing was sent to or received from it for timeout, e.g. when
+// data only flows in channels that are not in use. Any send or receive,
+// including refreshes, restarts the wait. If the probe fails the NAT mapping
+// to the server is likely lost, so the UDPConn is closed with
+// CloseReasonIdleProbeFailed.
+func WithIdleWatchdog(timeout time.Duration) UDPConnOption {
+	return func(c *UDPConn) error {
+		if timeout <= 0 {
+			return errInvalidIdleTimeout
+		}
+		c.idleTimeout = timeout
+
+		return nil
+	}
+}
+
+// WithRTTHandler registers a handler that is passed the round-trip time
+// measured by every successful Ping whose request was not retransmitted.
+func WithRTTHandler(handler func(rtt time.Duration)) UDPConnOption {
+	return func(c *UDPConn) error {
+		c.onRTT = handler
+
+		return nil
+	}
+}
+
+// WithChannelNumberAllocator sets how channel numbers are picked for new
+// channel bindings. The default assigns them in ascending order.
+func WithChannelNumberAllocator(allocator binding.ChannelNumberAllocator) UDPConnOption {
+	return func(c *UDPConn) error {
+		if allocator == nil {
+			return errNilChannelNumberAllocator
+		}
+		c.bindingConfig.ChannelNumberAllocator = allocator
+
+		return nil
+	}
+}
+
+// WithChannelRange restricts the channel numbers of new channel bindings to
+// [first, last], a sub-range of [0x4000, 0x7FFF]. Peers without a free
+// number get Send indications instead.
+func WithChannelRange(first, last uint16) UDPConnOption {
+	return func(c *UDPConn) error {
+		if first < 0x4000 || last > 0x7FFF || first > last {
+			return errInvalidChannelRange
+		}
+		c.bindingConfig.MinChannel = first
+		c.bindingConfig.MaxChannel = last
+
+		return nil
+	}
+}
+
+// WithBindingStateChangeHandler registers a handler that is notified of every
+// channel binding state transition, e.g. from ready to failed.
+func WithBindingStateChangeHandler(handler binding.StateChangeHandler) UDPConnOption {
+	return func(c *UDPConn) error {
+		c.bindingConfig.OnStateChange = handler
+
+		return nil
+	}
+}
+
+// WithBindingHighWaterMark makes the UDPConn log a warning, and call handler
+// if it is not nil, once it holds more than mark channel bindings. Each peer
+// written to keeps its binding for the lifetime of the UDPConn, so a growing
+// count hints at running out of the 16384 channel numbers.
+func WithBindingHighWaterMark(mark int, handler func(current, max int)) UDPConnOption {
+	return func(c *UDPConn) error {
+		if mark <= 0 {
+			return errInvalidHighWaterMark
+		}
+		c.bindingConfig.HighWaterMark = mark
+		c.bindingConfig.OnHighWaterMark = handler
+
+		return nil
+	}
+}
+
+// WithEventLog makes the UDPConn keep its size most recent events, such as
+// channel binding failures and nonce updates, in the EventLog returned by
+// UDPConn.EventLog.
+func WithEventLog(size int) UDPConnOption {
+	return func(c *UDPConn) error {
+		if size <= 0 {
+			return errInvalidEventLogSize
+		}
+		c.events = newEventLog(size)
+
+		return nil
+	}
+}
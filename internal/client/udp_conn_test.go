@@ -4,26 +4,47 @@
 package client
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log/slog"
 	"net"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/pion/logging"
 	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4/binding"
+	"github.com/pion/turn/v4/internal/proto"
 	"github.com/stretchr/testify/assert"
 )
 
-func TestUDPConn(t *testing.T) {
-	makeConn := func(client *mockClient, bm *bindingManager) UDPConn {
-		return UDPConn{
-			allocation: allocation{
-				client: client,
-				log:    logging.NewDefaultLoggerFactory().NewLogger("test"),
-			},
-			bindingMgr: bm,
-		}
+// newTestUDPConn creates a UDPConn on top of client that is closed when the test ends.
+func newTestUDPConn(tb testing.TB, client Client, opts ...UDPConnOption) *UDPConn {
+	tb.Helper()
+
+	conn, err := NewUDPConn(&AllocationConfig{
+		Client:      client,
+		RelayedAddr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 3478},
+		Lifetime:    time.Hour, // Keep the refresh timer out of the way
+	}, append([]UDPConnOption{WithLogger(logging.NewDefaultLoggerFactory().NewLogger("test"))}, opts...)...)
+	if err != nil {
+		tb.Fatal(err)
 	}
+	tb.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	return conn
+}
 
+func TestUDPConn(t *testing.T) {
 	staleNonceMsg := func() *stun.Message {
 		return stun.MustBuild(
 			stun.NewType(stun.MethodChannelBind, stun.ClassErrorResponse),
@@ -35,32 +56,30 @@ func TestUDPConn(t *testing.T) {
 	t.Run("maybeBind()", func(t *testing.T) {
 		tests := []struct {
 			name          string
-			initialState  bindingState
-			interimState  bindingState
-			finalState    bindingState
+			initialState  binding.State
+			interimState  binding.State
+			finalState    binding.State
 			pastInterval  bool
 			shouldSucceed bool
 		}{
-			{"idle -> request -> ready", bindingStateIdle, bindingStateRequest, bindingStateReady, false, true},
-			{"idle -> request -> failed", bindingStateIdle, bindingStateRequest, bindingStateFailed, false, false},
-			{"ready (stale) -> refresh -> ready", bindingStateReady, bindingStateRefresh, bindingStateReady, true, true},
-			{"ready (stale) -> refresh -> failed", bindingStateReady, bindingStateRefresh, bindingStateFailed, true, false},
+			{"idle -> request -> ready", binding.StateIdle, binding.StateRequest, binding.StateReady, false, true},
+			{"idle -> request -> failed", binding.StateIdle, binding.StateRequest, binding.StateFailed, false, false},
+			{"ready (stale) -> refresh -> ready", binding.StateReady, binding.StateRefresh, binding.StateReady, true, true},
+			{"ready (stale) -> refresh -> failed", binding.StateReady, binding.StateRefresh, binding.StateFailed, true, false},
 
 			// Noop cases:
-			{"ready (noop)", bindingStateReady, bindingStateReady, bindingStateReady, false, true},
-			{"request (noop)", bindingStateRequest, bindingStateRequest, bindingStateRequest, false, true},
-			{"refresh (noop)", bindingStateRefresh, bindingStateRefresh, bindingStateRefresh, false, true},
-			{"failed (noop)", bindingStateFailed, bindingStateFailed, bindingStateFailed, false, true},
+			{"ready (noop)", binding.StateReady, binding.StateReady, binding.StateReady, false, true},
+			{"request (noop)", binding.StateRequest, binding.StateRequest, binding.StateRequest, false, true},
+			{"refresh (noop)", binding.StateRefresh, binding.StateRefresh, binding.StateRefresh, false, true},
+			{"failed (noop)", binding.StateFailed, binding.StateFailed, binding.StateFailed, false, true},
 		}
 
 		for _, tt := range tests {
 			t.Run(tt.name, func(t *testing.T) {
 				unblock := make(chan struct{})
 
-				bm := newBindingManager()
-				bound := bm.create(&net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1234})
-				conn := makeConn(&mockClient{
-					performTransaction: func(msg *stun.Message, addr net.Addr, dontWait bool) (TransactionResult, error) {
+				conn := newTestUDPConn(t, &mockClient{
+					performTransaction: func(context.Context, *stun.Message, net.Addr, bool) (TransactionResult, error) {
 						<-unblock
 						if tt.shouldSucceed {
 							return TransactionResult{Msg: new(stun.Message)}, nil
@@ -68,70 +87,1249 @@ func TestUDPConn(t *testing.T) {
 
 						return TransactionResult{Msg: staleNonceMsg()}, nil
 					},
-				}, bm)
+				})
+				bound := mustCreateBinding(t, conn.bindingMgr, &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1234})
 
-				bound.setState(tt.initialState)
+				bound.SetState(tt.initialState)
 				if tt.pastInterval {
-					bound.setRefreshedAt(time.Now().Add(-(bindingRefreshInterval + 1*time.Minute)))
+					bound.SetRefreshedAt(time.Now().Add(-(defaultBindingRefreshInterval + 1*time.Minute)))
 				}
 
 				conn.maybeBind(bound)
-				assert.Equal(t, tt.interimState, bound.state())
+				assert.Equal(t, tt.interimState, bound.State())
 
 				// Release barrier so inner bind() can move forward.
 				close(unblock)
 
-				assert.Eventually(t, func() bool {
-					return bound.state() == tt.finalState
-				}, 5*time.Second, 10*time.Millisecond)
+				assertBindingState(t, conn.bindingMgr, bound.Addr(), tt.finalState, 5*time.Second)
+			})
+		}
+	})
+
+	t.Run("maybeBind() with custom binding refresh interval", func(t *testing.T) {
+		unblock := make(chan struct{})
+
+		conn := newTestUDPConn(t, &mockClient{
+			performTransaction: func(context.Context, *stun.Message, net.Addr, bool) (TransactionResult, error) {
+				<-unblock
+
+				return TransactionResult{Msg: new(stun.Message)}, nil
+			},
+		}, WithBindingRefreshInterval(time.Minute))
+		bound := mustCreateBinding(t, conn.bindingMgr, &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1234})
+		assert.Equal(t, time.Minute, conn.bindingRefreshIntervalOrDefault())
+
+		// Fresh enough for the default interval, but stale for ours
+		bound.SetState(binding.StateReady)
+		bound.SetRefreshedAt(time.Now().Add(-2 * time.Minute))
+
+		conn.maybeBind(bound)
+		assert.Equal(t, binding.StateRefresh, bound.State())
+
+		close(unblock)
+		assertBindingState(t, conn.bindingMgr, bound.Addr(), binding.StateReady, 5*time.Second)
+	})
+
+	t.Run("WithBindingRefreshInterval()", func(t *testing.T) {
+		conn := newTestUDPConn(t, &mockClient{})
+		assert.Equal(t, defaultBindingRefreshInterval, conn.bindingRefreshIntervalOrDefault())
+
+		conn = newTestUDPConn(t, &mockClient{}, WithBindingRefreshInterval(0))
+		assert.Equal(t, defaultBindingRefreshInterval, conn.bindingRefreshIntervalOrDefault())
+	})
+
+	t.Run("AddressFamily()", func(t *testing.T) {
+		for _, tc := range []struct {
+			relayedAddr net.Addr
+			family      proto.RequestedAddressFamily
+		}{
+			{&net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 3478}, proto.RequestedFamilyIPv4},
+			{&net.UDPAddr{IP: net.ParseIP("::ffff:10.0.0.1"), Port: 3478}, proto.RequestedFamilyIPv4},
+			{&net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 3478}, proto.RequestedFamilyIPv6},
+		} {
+			conn, err := NewUDPConn(&AllocationConfig{
+				Client:      &mockClient{},
+				RelayedAddr: tc.relayedAddr,
+				Lifetime:    time.Minute,
+				Log:         logging.NewDefaultLoggerFactory().NewLogger("test"),
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, tc.family, conn.AddressFamily(), tc.relayedAddr.String())
+			assert.Error(t, conn.Close()) // mockClient fails the refresh
+		}
+	})
+
+	t.Run("nextAllocRefresh()", func(t *testing.T) {
+		conn := newTestUDPConn(t, &mockClient{}, WithAllocationRefreshJitter(0))
+		conn.setLifetime(10 * time.Second)
+		assert.Equal(t, 8*time.Second, conn.nextAllocRefresh())
+
+		conn = newTestUDPConn(t, &mockClient{}) // Default jitter
+		conn.setLifetime(10 * time.Second)
+		seen := map[time.Duration]struct{}{}
+		for i := 0; i < 100; i++ {
+			d := conn.nextAllocRefresh()
+			assert.GreaterOrEqual(t, d, 7200*time.Millisecond)
+			assert.LessOrEqual(t, d, 8800*time.Millisecond)
+			seen[d] = struct{}{}
+		}
+		assert.Greater(t, len(seen), 1, "jitter should spread the refreshes")
+
+		conn = newTestUDPConn(t, &mockClient{}, WithAllocationRefreshJitter(0), WithAllocationRefreshInterval(time.Second))
+		assert.Equal(t, time.Second, conn.nextAllocRefresh())
+	})
+
+	t.Run("allocation refresh", func(t *testing.T) {
+		var refreshes atomic.Int32
+		client := &mockClient{
+			performTransaction: func(_ context.Context, msg *stun.Message, _ net.Addr, dontWait bool) (
+				TransactionResult, error,
+			) {
+				if msg.Type.Method != stun.MethodRefresh || dontWait {
+					return TransactionResult{Msg: new(stun.Message)}, nil
+				}
+
+				if refreshes.Add(1) == 1 {
+					return TransactionResult{Msg: stun.MustBuild(
+						stun.NewType(stun.MethodRefresh, stun.ClassSuccessResponse),
+						proto.Lifetime{Duration: time.Minute},
+					)}, nil
+				}
+
+				return TransactionResult{Msg: stun.MustBuild(
+					stun.NewType(stun.MethodRefresh, stun.ClassErrorResponse),
+					stun.CodeAllocMismatch,
+				)}, nil
+			},
+		}
+
+		conn, err := NewUDPConn(&AllocationConfig{
+			Client:      client,
+			RelayedAddr: &net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 3478},
+			Lifetime:    time.Minute,
+			Log:         logging.NewDefaultLoggerFactory().NewLogger("test"),
+		}, WithAllocationRefreshInterval(20*time.Millisecond), WithAllocationRefreshJitter(0))
+		assert.NoError(t, err)
+
+		// The first refresh succeeds, the second fails and closes the conn
+		_, _, err = conn.ReadFrom(make([]byte, 16))
+		assert.ErrorIs(t, err, errClosed)
+		assert.ErrorContains(t, err, "Allocation Mismatch")
+		assert.Equal(t, int32(2), refreshes.Load())
+		assert.Equal(t, time.Minute, conn.lifetime())
+
+		assert.False(t, conn.refreshAllocTimer.IsRunning())
+		assert.ErrorIs(t, conn.Close(), errAlreadyClosed)
+	})
+
+	t.Run("Close() deletes failed bindings", func(t *testing.T) {
+		handler := &recordingHandler{level: slog.LevelDebug}
+		conn := newTestUDPConn(t, &mockClient{}, WithSlogHandler(handler))
+		failed := mustCreateBinding(t, conn.bindingMgr, &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000})
+		failed.SetState(binding.StateFailed)
+		ready := mustCreateBinding(t, conn.bindingMgr, &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 5000})
+		ready.SetState(binding.StateReady)
+
+		_ = conn.Close() // The mock fails the final refresh
+		assert.Len(t, handler.find("Deleted 1 failed channel bindings"), 1)
+		// Closing the binding manager deletes the rest
+		assert.Empty(t, conn.Bindings())
+	})
+
+	t.Run("concurrent Close()", func(t *testing.T) {
+		conn := newTestUDPConn(t, &mockClient{})
+
+		const n = 10
+		var alreadyClosed atomic.Int32
+		var wg sync.WaitGroup
+		start := make(chan struct{})
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				if errors.Is(conn.Close(), errAlreadyClosed) {
+					alreadyClosed.Add(1)
+				}
+			}()
+		}
+		close(start)
+		wg.Wait()
+
+		// Only one of them shuts down
+		assert.Equal(t, int32(n-1), alreadyClosed.Load())
+		assert.Equal(t, CloseEvent{Reason: CloseReasonLocal}, <-conn.Closed())
+	})
+
+	t.Run("Close() stops binding", func(t *testing.T) {
+		var inflight atomic.Int32
+		client := &mockClient{}
+		client.SetPerformTransaction(func(ctx context.Context, msg *stun.Message, _ net.Addr, _ bool) (
+			TransactionResult, error,
+		) {
+			if msg.Type.Method != stun.MethodChannelBind {
+				return TransactionResult{}, errFake
+			}
+			inflight.Add(1)
+			defer inflight.Add(-1)
+			<-ctx.Done()
+
+			return TransactionResult{}, ctx.Err()
+		})
+		conn := newTestUDPConn(t, client)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 20; j++ {
+					bound, err := conn.bindingMgr.Create(&net.UDPAddr{IP: net.IPv4(10, 0, byte(i), byte(j)), Port: 5000})
+					if err != nil {
+						assert.ErrorIs(t, err, binding.ErrManagerClosed)
+
+						return
+					}
+					conn.maybeBind(bound)
+				}
+			}(i)
+		}
+		assert.Eventually(t, func() bool { return inflight.Load() > 0 }, time.Second, time.Millisecond)
+
+		_ = conn.Close() // The mock fails the final refresh
+		assert.Equal(t, int32(0), inflight.Load(), "Close returned with ChannelBind transactions in flight")
+		wg.Wait()
+		assert.Equal(t, int32(0), inflight.Load())
+		assert.Empty(t, conn.Bindings())
+	})
+
+	t.Run("CloseWithDrain()", func(t *testing.T) {
+		peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+		unblock := make(chan struct{})
+		var delivered atomic.Int32
+		var refresh atomic.Pointer[stun.Message]
+		client := &mockClient{
+			writeTo: func(data []byte, _ net.Addr) (int, error) {
+				<-unblock
+				delivered.Add(1)
+
+				return len(data), nil
+			},
+			performTransaction: func(_ context.Context, msg *stun.Message, _ net.Addr, dontWait bool) (
+				TransactionResult, error,
+			) {
+				assert.False(t, dontWait, "the release should wait for the response")
+				refresh.Store(msg)
+
+				return TransactionResult{Msg: stun.MustBuild(
+					stun.NewType(stun.MethodRefresh, stun.ClassSuccessResponse),
+					proto.Lifetime{},
+				)}, nil
+			},
+		}
+		conn := newTestUDPConn(t, client, WithWriteQueue(WriteQueueConfig{Size: 64}))
+		conn.permMap.insert(peer, &permission{st: PermissionStatePermitted})
+		mustCreateBinding(t, conn.bindingMgr, peer).SetState(binding.StateReady)
+
+		// The first write blocks the queue, the ones after it wait in the queue
+		accepted := int32(0)
+		for i := 0; i < 3; i++ {
+			_, err := conn.WriteTo([]byte("queued"), peer)
+			assert.NoError(t, err)
+			accepted++
+		}
+
+		drained := make(chan error)
+		go func() { drained <- conn.CloseWithDrain(context.Background()) }()
+		assert.Eventually(t, func() bool {
+			_, err := conn.WriteTo([]byte("late"), peer)
+			if err == nil {
+				accepted++
+			}
+
+			return errors.Is(err, ErrClosing)
+		}, time.Second, time.Millisecond)
+
+		select {
+		case err := <-drained:
+			assert.Fail(t, "CloseWithDrain returned before the writes were sent", err)
+		case <-time.After(20 * time.Millisecond):
+		}
+		assert.Nil(t, refresh.Load(), "the allocation should be released after the writes")
+
+		close(unblock)
+		assert.NoError(t, <-drained)
+		assert.Equal(t, accepted, delivered.Load())
+
+		msg := refresh.Load()
+		if assert.NotNil(t, msg) {
+			assert.Equal(t, stun.MethodRefresh, msg.Type.Method)
+			var lifetime proto.Lifetime
+			assert.NoError(t, lifetime.GetFrom(msg))
+			assert.Zero(t, lifetime.Duration)
+		}
+
+		assert.Equal(t, CloseEvent{Reason: CloseReasonLocal}, <-conn.Closed())
+		_, err := conn.WriteTo([]byte("closed"), peer)
+		assert.ErrorIs(t, err, errClosed)
+		assert.ErrorIs(t, conn.CloseWithDrain(context.Background()), errAlreadyClosed)
+	})
+
+	t.Run("CloseWithDrain() timeout", func(t *testing.T) {
+		peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+		writing, unblock := make(chan struct{}), make(chan struct{})
+		defer close(unblock)
+		client := &mockClient{
+			writeTo: func(data []byte, _ net.Addr) (int, error) {
+				close(writing)
+				<-unblock
+
+				return len(data), nil
+			},
+		}
+		conn := newTestUDPConn(t, client)
+		conn.permMap.insert(peer, &permission{st: PermissionStatePermitted})
+		mustCreateBinding(t, conn.bindingMgr, peer).SetState(binding.StateReady)
+
+		go func() { _, _ = conn.WriteTo([]byte("stuck"), peer) }()
+		<-writing
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, conn.CloseWithDrain(ctx), context.DeadlineExceeded)
+		assert.Equal(t, CloseEvent{Reason: CloseReasonLocal}, <-conn.Closed())
+	})
+
+	t.Run("Closed()", func(t *testing.T) {
+		conn := newTestUDPConn(t, &mockClient{})
+		_ = conn.Close() // The mock fails the final refresh
+		assert.Equal(t, CloseEvent{Reason: CloseReasonLocal}, <-conn.Closed())
+		_, ok := <-conn.Closed()
+		assert.False(t, ok, "Closed() should be closed after the event")
+
+		for _, test := range []struct {
+			name   string
+			result TransactionResult
+			err    error
+			reason CloseReason
+		}{
+			{
+				name: "error response",
+				result: TransactionResult{Msg: stun.MustBuild(
+					stun.NewType(stun.MethodRefresh, stun.ClassErrorResponse),
+					stun.CodeForbidden,
+				)},
+				reason: CloseReasonAllocationRefreshFailed,
+			},
+			{
+				name:   "no response",
+				err:    errFake,
+				reason: CloseReasonNetworkError,
+			},
+			{
+				name: "allocation mismatch",
+				result: TransactionResult{Msg: stun.MustBuild(
+					stun.NewType(stun.MethodRefresh, stun.ClassErrorResponse),
+					stun.CodeAllocMismatch,
+				)},
+				reason: CloseReasonLifetimeExpired,
+			},
+		} {
+			t.Run(test.name, func(t *testing.T) {
+				conn := newTestUDPConn(t, &mockClient{
+					performTransaction: func(_ context.Context, msg *stun.Message, _ net.Addr, dontWait bool) (
+						TransactionResult, error,
+					) {
+						if msg.Type.Method != stun.MethodRefresh || dontWait {
+							return TransactionResult{Msg: new(stun.Message)}, nil
+						}
+
+						return test.result, test.err
+					},
+				}, WithAllocationRefreshInterval(10*time.Millisecond), WithAllocationRefreshJitter(0))
+
+				event := <-conn.Closed()
+				assert.Equal(t, test.reason, event.Reason, event.Reason.String())
+				assert.Error(t, event.Err)
+				_, _, err := conn.ReadFrom(make([]byte, 16))
+				assert.ErrorIs(t, err, event.Err, "reads should fail with the same cause")
+			})
+		}
+	})
+
+	t.Run("WriteTo() with permission batching", func(t *testing.T) {
+		var createPermissions atomic.Int32
+		var peersInRequest atomic.Int32
+		conn := newTestUDPConn(t, &mockClient{
+			performTransaction: func(_ context.Context, msg *stun.Message, _ net.Addr, _ bool) (TransactionResult, error) {
+				if msg.Type.Method == stun.MethodCreatePermission {
+					createPermissions.Add(1)
+					var peers int32
+					for _, attr := range msg.Attributes {
+						if attr.Type == stun.AttrXORPeerAddress {
+							peers++
+						}
+					}
+					peersInRequest.Store(peers)
+				}
+
+				return TransactionResult{Msg: new(stun.Message)}, nil
+			},
+		}, WithPermissionBatchWindow(20*time.Millisecond))
+
+		const numPeers = 8
+		var wg sync.WaitGroup
+		for i := 0; i < numPeers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, err := conn.WriteTo([]byte("hello"), &net.UDPAddr{IP: net.IPv4(10, 0, 0, byte(i+1)), Port: 5000})
+				assert.NoError(t, err)
+			}(i)
+		}
+		wg.Wait()
+		assert.Equal(t, int32(1), createPermissions.Load())
+		assert.Equal(t, int32(numPeers), peersInRequest.Load())
+
+		// A peer added after the window gets its own request
+		_, err := conn.WriteTo([]byte("hello"), &net.UDPAddr{IP: net.IPv4(10, 0, 1, 1), Port: 5000})
+		assert.NoError(t, err)
+		assert.Equal(t, int32(2), createPermissions.Load())
+
+		conn = newTestUDPConn(t, &mockClient{}, WithPermissionBatchWindow(0))
+		assert.Nil(t, conn.permBatcher)
+	})
+
+	t.Run("WriteTo() with permission rate limiting", func(t *testing.T) {
+		var createPermissions atomic.Int32
+		conn := newTestUDPConn(t, &mockClient{
+			performTransaction: func(_ context.Context, msg *stun.Message, _ net.Addr, _ bool) (TransactionResult, error) {
+				if msg.Type.Method == stun.MethodCreatePermission {
+					createPermissions.Add(1)
+				}
+
+				return TransactionResult{Msg: new(stun.Message)}, nil
+			},
+		}, WithPermissionRateLimiter(NewTokenBucketRateLimiter(0, 2)))
+
+		for i := 0; i < 2; i++ {
+			_, err := conn.WriteTo([]byte("hello"), &net.UDPAddr{IP: net.IPv4(10, 0, 0, byte(i+1)), Port: 5000})
+			assert.NoError(t, err)
+		}
+
+		// The burst is used up, so a new peer is rejected without a request
+		peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 3), Port: 5000}
+		_, err := conn.WriteTo([]byte("hello"), peer)
+		assert.ErrorIs(t, err, ErrPermissionRateLimited)
+		assert.Equal(t, int32(2), createPermissions.Load())
+		_, ok := conn.permMap.find(peer)
+		assert.False(t, ok, "rejected permission should be retried on the next write")
+
+		// Peers with a permission are not limited
+		_, err = conn.WriteTo([]byte("hello"), &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000})
+		assert.NoError(t, err)
+	})
+
+	t.Run("WriteTo() send paths", func(t *testing.T) {
+		peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+
+		// n is the length of the payload, never that of its TURN framing
+		for _, size := range []int{0, 1, 3, 4, 5, 1200} {
+			payload := bytes.Repeat([]byte{'a'}, size)
+
+			var written []byte
+			conn := newWriteBenchConn(t, peer, func(data []byte) { written = data })
+			bound := mustCreateBinding(t, conn.bindingMgr, peer)
+
+			// Not bound yet: Send indication
+			bound.SetState(binding.StateFailed)
+			n, err := conn.WriteTo(payload, peer)
+			assert.NoError(t, err)
+			assert.Equal(t, len(payload), n)
+			assert.True(t, stun.IsMessage(written))
+			assert.Greater(t, len(written), n)
+
+			// Bound: ChannelData with the binding's channel number
+			bound.SetState(binding.StateReady)
+			n, err = conn.WriteTo(payload, peer)
+			assert.NoError(t, err)
+			assert.Equal(t, len(payload), n)
+			chData := &proto.ChannelData{Raw: written}
+			assert.NoError(t, chData.Decode())
+			assert.Equal(t, proto.ChannelNumber(bound.Number()), chData.Number)
+			assert.Equal(t, payload, chData.Data)
+			assert.Greater(t, len(written), n)
+
+			// DontFragment: Send indication even with a channel
+			n, err = conn.WriteToWithOptions(context.Background(), payload, peer, SendOptions{DontFragment: true})
+			assert.NoError(t, err)
+			assert.Equal(t, len(payload), n)
+			assert.True(t, stun.IsMessage(written))
+		}
+	})
+
+	t.Run("WriteTo() without free channel number", func(t *testing.T) {
+		peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+
+		var written []byte
+		conn := newWriteBenchConn(t, peer, func(data []byte) { written = data },
+			WithChannelNumberAllocator(channelNumberAllocatorFunc(func(net.Addr, func(uint16) bool) (uint16, error) {
+				return 0, binding.ErrChannelNumbersExhausted
+			})))
+
+		n, err := conn.WriteTo([]byte("hello"), peer)
+		assert.NoError(t, err)
+		assert.Equal(t, 5, n)
+		assert.True(t, stun.IsMessage(written), "should fall back to a Send indication")
+		assert.Equal(t, 0, conn.bindingMgr.Size())
+	})
+
+	t.Run("WithChannelRange()", func(t *testing.T) {
+		peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+		conn := newWriteBenchConn(t, peer, func([]byte) {}, WithChannelRange(0x5000, 0x5000))
+
+		_, err := conn.WriteTo([]byte("hello"), peer)
+		assert.NoError(t, err)
+		bound, ok := conn.bindingMgr.FindByAddr(peer)
+		assert.True(t, ok)
+		assert.Equal(t, uint16(0x5000), bound.Number())
+	})
+
+	t.Run("WithBindingHighWaterMark()", func(t *testing.T) {
+		var calls [][2]int
+		conn := newWriteBenchConn(t, &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}, func([]byte) {},
+			WithChannelRange(0x5000, 0x5001),
+			WithBindingHighWaterMark(1, func(current, max int) { calls = append(calls, [2]int{current, max}) }))
+
+		for i := 1; i <= 3; i++ {
+			peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, byte(i)), Port: 5000}
+			conn.permMap.insert(peer, &permission{st: PermissionStatePermitted})
+			_, err := conn.WriteTo([]byte("hello"), peer)
+			assert.NoError(t, err, "writes fall back to Send indications once the channels run out")
+		}
+		assert.Equal(t, [][2]int{{2, 2}}, calls)
+		assert.Equal(t, 2, conn.bindingMgr.Size())
+
+		_, err := NewUDPConn(&AllocationConfig{Client: &mockClient{}}, WithBindingHighWaterMark(0, nil))
+		assert.ErrorIs(t, err, errInvalidHighWaterMark)
+	})
+
+	t.Run("Permissions()", func(t *testing.T) {
+		peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+		conn := newTestUDPConn(t, &mockClient{}, WithPermissionLifetime(time.Minute))
+		conn.permMap.insert(peer, &permission{st: PermissionStatePermitted})
+
+		perms := conn.Permissions()
+		if assert.Len(t, perms, 1) {
+			assert.Equal(t, peer, perms[0].Addr)
+			assert.Equal(t, time.Minute, perms[0].ExpiresAt.Sub(perms[0].RefreshedAt), "the configured lifetime is used")
+		}
+	})
+
+	t.Run("WithReadQueueSize()", func(t *testing.T) {
+		peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+		conn := newTestUDPConn(t, &mockClient{}, WithReadQueueSize(2))
+
+		conn.HandleInbound([]byte("one"), peer)
+		conn.HandleInbound([]byte("two"), peer)
+		conn.HandleInbound([]byte("dropped"), peer)
+
+		buf := make([]byte, 16)
+		for _, want := range []string{"one", "two"} {
+			n, _, err := conn.ReadFrom(buf)
+			assert.NoError(t, err)
+			assert.Equal(t, want, string(buf[:n]))
+		}
+
+		// Slots are reused once read, also across dialed conns
+		dialed, err := conn.Dial(peer)
+		assert.NoError(t, err)
+		conn.HandleInbound([]byte("three"), peer)
+		conn.HandleInbound([]byte("four"), peer)
+		assert.NoError(t, dialed.Close())
+		conn.HandleInbound([]byte("five"), peer)
+		conn.HandleInbound([]byte("six"), peer)
+		for _, want := range []string{"five", "six"} {
+			n, _, err := conn.ReadFrom(buf)
+			assert.NoError(t, err)
+			assert.Equal(t, want, string(buf[:n]))
+		}
+
+		// A short buffer drops the packet but frees its slot
+		conn.HandleInbound([]byte("too long"), peer)
+		_, _, err = conn.ReadFrom(buf[:2])
+		assert.ErrorIs(t, err, io.ErrShortBuffer)
+		conn.HandleInbound([]byte("seven"), peer)
+		conn.HandleInbound([]byte("eight"), peer)
+		n, _, err := conn.ReadFrom(buf)
+		assert.NoError(t, err)
+		assert.Equal(t, "seven", string(buf[:n]))
+	})
+
+	t.Run("WithWriteQueue()", func(t *testing.T) {
+		peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+
+		// The first write to the server blocks until released
+		release := make(chan struct{})
+		written := make(chan string, 8)
+		client := &mockClient{}
+		client.SetWriteTo(func(data []byte, _ net.Addr) (int, error) {
+			<-release
+			chData := &proto.ChannelData{Raw: data}
+			assert.NoError(t, chData.Decode())
+			written <- string(chData.Data)
+
+			return len(data), nil
+		})
+		conn := newTestUDPConn(t, client, WithWriteQueue(WriteQueueConfig{Size: 2, DropOnFull: true}))
+		conn.permMap.insert(peer, &permission{st: PermissionStatePermitted})
+		mustCreateBinding(t, conn.bindingMgr, peer).SetState(binding.StateReady)
+
+		// One write is in flight, two are queued and the rest is dropped
+		_, err := conn.WriteTo([]byte("one"), peer)
+		assert.NoError(t, err)
+		assert.Eventually(t, func() bool { return len(conn.writeQueue.ch) == 0 }, time.Second, time.Millisecond)
+		for _, payload := range []string{"two", "three", "four", "five"} {
+			n, err := conn.WriteTo([]byte(payload), peer)
+			assert.NoError(t, err)
+			assert.Equal(t, len(payload), n, "dropped writes are not reported as errors")
+		}
+		assert.Equal(t, uint64(2), conn.Stats().WritesDropped)
+
+		close(release)
+		for _, want := range []string{"one", "two", "three"} {
+			assert.Equal(t, want, <-written)
+		}
+		assert.Equal(t, uint64(3), conn.Stats().ChannelSends)
+
+		_, err = conn.WriteTo([]byte("hello"), &net.TCPAddr{})
+		assert.ErrorIs(t, err, errUDPAddrCast)
+
+		_ = conn.Close() // The mock client fails the final refresh
+		_, err = conn.WriteTo([]byte("closed"), peer)
+		assert.ErrorIs(t, err, errClosed)
+	})
+
+	t.Run("OnDataReceived()", func(t *testing.T) {
+		peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+		conn := newTestUDPConn(t, &mockClient{})
+
+		type received struct {
+			data string
+			peer string
+		}
+		var mutex sync.Mutex
+		got := []received{}
+		conn.OnDataReceived(func(data []byte, from net.Addr) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			got = append(got, received{string(data), from.String()})
+		})
+		gotCount := func() int {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			return len(got)
+		}
+
+		buf := []byte("one")
+		conn.HandleInbound(buf, peer)
+		copy(buf, "xxx") // The handler gets a copy
+		conn.HandleInbound([]byte("two"), peer)
+		assert.Equal(t, []received{{"one", peer.String()}, {"two", peer.String()}}, got)
+		assert.Empty(t, conn.readCh)
+
+		// A waiting ReadFrom takes precedence
+		readCh := make(chan string)
+		go func() {
+			readBuf := make([]byte, 16)
+			n, _, err := conn.ReadFrom(readBuf)
+			assert.NoError(t, err)
+			readCh <- string(readBuf[:n])
+		}()
+		assert.Eventually(t, func() bool { return conn.readers.Load() == 1 }, time.Second, time.Millisecond)
+		conn.HandleInbound([]byte("three"), peer)
+		assert.Equal(t, "three", <-readCh)
+		assert.Equal(t, 2, gotCount())
+
+		// Dialed conns keep their own queue
+		dialed, err := conn.Dial(peer)
+		assert.NoError(t, err)
+		conn.HandleInbound([]byte("four"), peer)
+		assert.NoError(t, dialed.Close())
+		assert.Equal(t, 2, gotCount())
+
+		conn.OnDataReceived(nil)
+		conn.HandleInbound([]byte("five"), peer)
+		assert.Equal(t, 2, gotCount())
+		assert.Len(t, conn.readCh, 1)
+		assert.Equal(t, uint64(3+3+5), conn.Stats().BytesReceived)
+	})
+
+	t.Run("WriteToWithOptions() DontFragment", func(t *testing.T) {
+		peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+		written := make(chan []byte, 4)
+		for _, opts := range [][]UDPConnOption{nil, {WithWriteQueue(WriteQueueConfig{Size: 4})}} {
+			conn := newWriteBenchConn(t, peer, func(data []byte) {
+				written <- append([]byte(nil), data...)
+			}, opts...)
+			mustCreateBinding(t, conn.bindingMgr, peer).SetState(binding.StateReady)
+
+			// The ready channel is bypassed
+			n, err := conn.WriteToWithOptions(context.Background(), []byte("df"), peer, SendOptions{DontFragment: true})
+			assert.NoError(t, err)
+			assert.Equal(t, 2, n)
+			msg := &stun.Message{Raw: <-written}
+			if assert.NoError(t, msg.Decode()) {
+				assert.Equal(t, stun.NewType(stun.MethodSend, stun.ClassIndication), msg.Type)
+				assert.True(t, msg.Contains(stun.AttrDontFragment))
+				var data proto.Data
+				assert.NoError(t, data.GetFrom(msg))
+				assert.Equal(t, "df", string(data))
+			}
+
+			_, err = conn.WriteToWithOptions(context.Background(), []byte("channel"), peer, SendOptions{})
+			assert.NoError(t, err)
+			assert.True(t, proto.IsChannelData(<-written))
+
+			assert.Eventually(t, func() bool {
+				stats := conn.Stats()
+
+				return stats.IndicationSends == 1 && stats.ChannelSends == 1
+			}, time.Second, time.Millisecond)
+		}
+
+		// Indications without the option do not carry the attribute
+		conn := newWriteBenchConn(t, peer, func(data []byte) {
+			written <- append([]byte(nil), data...)
+		})
+		_, err := conn.WriteTo([]byte("plain"), peer)
+		assert.NoError(t, err)
+		msg := &stun.Message{Raw: <-written}
+		if assert.NoError(t, msg.Decode()) {
+			assert.Equal(t, stun.MethodSend, msg.Type.Method)
+			assert.False(t, msg.Contains(stun.AttrDontFragment))
+		}
+	})
+
+	t.Run("WithMaxPacketSize()", func(t *testing.T) {
+		peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+		var writes atomic.Int32
+		conn := newWriteBenchConn(t, peer, func([]byte) { writes.Add(1) }, WithMaxPacketSize(1200))
+		mustCreateBinding(t, conn.bindingMgr, peer).SetState(binding.StateReady)
+
+		n, err := conn.WriteTo(make([]byte, 1200), peer)
+		assert.NoError(t, err)
+		assert.Equal(t, 1200, n)
+		assert.Equal(t, int32(1), writes.Load())
+
+		// Rejected before a permission is even looked up
+		n, err = conn.WriteTo(make([]byte, 1201), &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 5000})
+		assert.ErrorIs(t, err, ErrPacketTooLarge)
+		assert.Equal(t, 0, n)
+		_, ok := conn.permMap.find(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 5000})
+		assert.False(t, ok)
+
+		n, err = conn.WriteBatch([]Message{
+			{Payload: make([]byte, 10), Addr: peer},
+			{Payload: make([]byte, 1201), Addr: peer},
+			{Payload: make([]byte, 10), Addr: peer},
+		})
+		assert.ErrorIs(t, err, ErrPacketTooLarge)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, int32(2), writes.Load())
+
+		// No limit by default
+		conn = newWriteBenchConn(t, peer, func([]byte) {})
+		_, err = conn.WriteTo(make([]byte, 64*1024), peer)
+		assert.NoError(t, err)
+
+		_, err = NewUDPConn(&AllocationConfig{Client: &mockClient{}}, WithMaxPacketSize(-1))
+		assert.ErrorIs(t, err, errNegativeMaxPacketSize)
+	})
+
+	t.Run("WithSlowWriteThreshold()", func(t *testing.T) {
+		peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+		var delay atomic.Int64
+		newConn := func(opts ...UDPConnOption) *UDPConn {
+			conn := newWriteBenchConn(t, peer, func([]byte) {
+				time.Sleep(time.Duration(delay.Load()))
+			}, opts...)
+			mustCreateBinding(t, conn.bindingMgr, peer).SetState(binding.StateReady)
+
+			return conn
+		}
+
+		conn := newConn(WithSlowWriteThreshold(20 * time.Millisecond))
+		_, err := conn.WriteTo([]byte("fast"), peer)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(0), conn.Stats().SlowWrites)
+
+		delay.Store(int64(50 * time.Millisecond))
+		for i := 0; i < 2; i++ {
+			_, err = conn.WriteTo([]byte("slow"), peer)
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, uint64(2), conn.Stats().SlowWrites)
+		assert.Equal(t, uint64(3), conn.Stats().ChannelSends)
+
+		// Disabled by default
+		conn = newConn()
+		_, err = conn.WriteTo([]byte("slow"), peer)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(0), conn.Stats().SlowWrites)
+
+		_, err = NewUDPConn(&AllocationConfig{Client: &mockClient{}}, WithSlowWriteThreshold(-time.Second))
+		assert.ErrorIs(t, err, errNegativeSlowWriteThreshold)
+	})
+
+	t.Run("WriteTo() IPv6 peer", func(t *testing.T) {
+		peer := &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 5000}
+
+		var written []byte
+		conn := newWriteBenchConn(t, peer, func(data []byte) { written = data })
+		mustCreateBinding(t, conn.bindingMgr, peer).SetState(binding.StateFailed)
+
+		_, err := conn.WriteTo([]byte("hello"), peer)
+		assert.NoError(t, err)
+
+		msg := &stun.Message{Raw: written}
+		assert.NoError(t, msg.Decode())
+		raw, err := msg.Get(stun.AttrXORPeerAddress)
+		assert.NoError(t, err)
+		assert.Len(t, raw, 20)
+		assert.Equal(t, []byte{0x00, 0x02}, raw[:2], "IPv6 family")
+
+		// Undo the XOR with magic cookie and transaction ID, RFC 5389 Section 15.2
+		const magicCookie = 0x2112A442
+		key := binary.BigEndian.AppendUint32(nil, magicCookie)
+		key = append(key, msg.TransactionID[:]...)
+		port := binary.BigEndian.Uint16(raw[2:4]) ^ uint16(magicCookie>>16)
+		ip := make(net.IP, net.IPv6len)
+		for i := range ip {
+			ip[i] = raw[4+i] ^ key[i]
+		}
+		assert.Equal(t, uint16(peer.Port), port)
+		assert.True(t, peer.IP.Equal(ip))
+	})
+
+	t.Run("Stats()", func(t *testing.T) {
+		peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+		conn := newWriteBenchConn(t, peer, func([]byte) {})
+		bound := mustCreateBinding(t, conn.bindingMgr, peer)
+		assert.Equal(t, Stats{Bindings: BindingCounts{Idle: 1}, Permissions: 1}, conn.Stats())
+
+		bound.SetState(binding.StateFailed)
+		_, err := conn.WriteTo([]byte("hello"), peer)
+		assert.NoError(t, err)
+
+		bound.SetState(binding.StateReady)
+		_, err = conn.WriteTo([]byte("hello, world"), peer)
+		assert.NoError(t, err)
+
+		// No permission and the mock client fails the CreatePermission
+		_, err = conn.WriteTo([]byte("lost"), &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 5000})
+		assert.ErrorIs(t, err, errFake)
+
+		// The bind itself fails as well
+		failing := mustCreateBinding(t, conn.bindingMgr, &net.UDPAddr{IP: net.IPv4(10, 0, 0, 3), Port: 5000})
+		conn.maybeBind(failing)
+		// The failed transaction deletes the binding, so it cannot be found by address
+		assert.Eventually(t, func() bool {
+			return failing.State() == binding.StateFailed
+		}, 5*time.Second, 10*time.Millisecond)
+
+		conn.HandleInbound([]byte("reply"), peer)
+		_, _, err = conn.ReadFrom(make([]byte, 16))
+		assert.NoError(t, err)
+
+		assert.Equal(t, Stats{
+			BytesSent:        17,
+			BytesReceived:    5,
+			ChannelSends:     1,
+			IndicationSends:  1,
+			BindingErrors:    1,
+			PermissionErrors: 1,
+			Bindings:         BindingCounts{Ready: 1},
+			Permissions:      1,
+		}, conn.Stats())
+
+		bindings := conn.Bindings()
+		if assert.Len(t, bindings, 1) {
+			assert.Equal(t, peer.String(), bindings[0].RemoteAddr.String())
+			assert.Equal(t, binding.StateReady, bindings[0].State)
+		}
+	})
+
+	t.Run("Ping()", func(t *testing.T) {
+		t.Run("success", func(t *testing.T) {
+			var rtts []time.Duration
+			conn := newTestUDPConn(t, &mockClient{
+				performTransaction: func(_ context.Context, msg *stun.Message, _ net.Addr, _ bool) (TransactionResult, error) {
+					if msg.Type != stun.BindingRequest {
+						return TransactionResult{}, errFake
+					}
+
+					return TransactionResult{Msg: stun.MustBuild(msg, stun.BindingSuccess)}, nil
+				},
+			}, WithRTTHandler(func(rtt time.Duration) { rtts = append(rtts, rtt) }))
+
+			assert.NoError(t, conn.Ping(context.Background()))
+			assert.Equal(t, []time.Duration{mockRTT}, rtts)
+		})
+
+		t.Run("retransmitted", func(t *testing.T) {
+			conn := newTestUDPConn(t, &mockClient{
+				performTransaction: func(_ context.Context, msg *stun.Message, _ net.Addr, _ bool) (TransactionResult, error) {
+					if msg.Type != stun.BindingRequest {
+						return TransactionResult{}, errFake
+					}
+
+					return TransactionResult{Msg: stun.MustBuild(msg, stun.BindingSuccess), Retries: 1}, nil
+				},
+			}, WithRTTHandler(func(time.Duration) { t.Error("no RTT should be reported") }))
+
+			assert.NoError(t, conn.Ping(context.Background()))
+			assert.Equal(t, RTTStats{}, conn.Stats().RTT)
+		})
+
+		t.Run("timeout", func(t *testing.T) {
+			conn := newTestUDPConn(t, &mockClient{
+				performTransaction: func(ctx context.Context, msg *stun.Message, _ net.Addr, _ bool) (TransactionResult, error) {
+					if msg.Type != stun.BindingRequest {
+						return TransactionResult{}, errFake
+					}
+					<-ctx.Done() // The server never answers
+
+					return TransactionResult{}, ctx.Err()
+				},
+			}, WithRTTHandler(func(time.Duration) { t.Error("no RTT should be reported") }))
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			assert.ErrorIs(t, conn.Ping(ctx), context.DeadlineExceeded)
+		})
+
+		t.Run("error response", func(t *testing.T) {
+			conn := newTestUDPConn(t, &mockClient{
+				performTransaction: func(_ context.Context, msg *stun.Message, _ net.Addr, _ bool) (TransactionResult, error) {
+					return TransactionResult{Msg: stun.MustBuild(msg, stun.BindingError, stun.CodeBadRequest)}, nil
+				},
+			})
+
+			assert.ErrorIs(t, conn.Ping(context.Background()), errUnexpectedPingResponse)
+		})
+	})
+
+	t.Run("NewUDPConn() validation", func(t *testing.T) {
+		conn, err := NewUDPConn(&AllocationConfig{Lifetime: time.Minute})
+		assert.ErrorIs(t, err, errNilAllocationClient)
+		assert.Nil(t, conn)
+
+		conn, err = NewUDPConn(nil)
+		assert.ErrorIs(t, err, errNilAllocationClient)
+		assert.Nil(t, conn)
+
+		for _, tc := range []struct {
+			name string
+			opt  UDPConnOption
+			err  error
+		}{
+			{"RetryPolicy", WithRetryPolicy(RetryPolicy{Multiplier: 0.5}), errInvalidRetryMultiplier},
+			{"BindingRefreshInterval", WithBindingRefreshInterval(-time.Second), errNegativeBindingRefreshInterval},
+			{"AllocationRefreshInterval", WithAllocationRefreshInterval(-time.Second), errNegativeAllocRefreshInterval},
+			{"AllocationRefreshJitter", WithAllocationRefreshJitter(1), errInvalidAllocRefreshJitter},
+			{"PermissionBatchWindow", WithPermissionBatchWindow(-time.Millisecond), errNegativePermBatchWindow},
+			{"PermissionRefreshInterval", WithPermissionRefreshInterval(-time.Second), errNegativePermRefreshInterval},
+			{"FailedBindingCooldown", WithFailedBindingCooldown(-time.Second), errNegativeFailedCooldown},
+			{"ChannelNumberAllocator", WithChannelNumberAllocator(nil), errNilChannelNumberAllocator},
+			{"ChannelRange", WithChannelRange(0x5000, 0x4fff), errInvalidChannelRange},
+			{"ChannelRange below 0x4000", WithChannelRange(0x3fff, 0x4fff), errInvalidChannelRange},
+			{"ReadQueueSize", WithReadQueueSize(0), errInvalidReadQueueSize},
+			{"PermissionLifetime", WithPermissionLifetime(-time.Second), errNegativePermLifetime},
+			{"PermissionRefreshMargin", WithPermissionRefreshMargin(-time.Second), errNegativePermRefreshMargin},
+			{"PermissionGCInterval", WithPermissionGCInterval(-time.Second), errNegativePermGCInterval},
+			{"WriteQueueSize", WithWriteQueue(WriteQueueConfig{}), errInvalidWriteQueueSize},
+			{"WriteQueueDrainTimeout", WithWriteQueue(WriteQueueConfig{Size: 1, DrainTimeout: -1}), errNegativeDrainTimeout},
+		} {
+			conn, err := NewUDPConn(&AllocationConfig{
+				Client:   &mockClient{},
+				Lifetime: time.Minute,
+			}, tc.opt)
+			assert.ErrorIs(t, err, tc.err, tc.name)
+			assert.Nil(t, conn, tc.name)
+		}
+	})
+
+	t.Run("NewUDPConn() options", func(t *testing.T) {
+		conn, err := NewUDPConn(&AllocationConfig{
+			Client:   &mockClient{},
+			Lifetime: time.Minute,
+		})
+		assert.NoError(t, err)
+		assert.NotNil(t, conn.log, "should fall back to a default logger")
+		assert.Equal(t, defaultPermRefreshInterval, conn.permRefreshInterval)
+		assert.Equal(t, DefaultRetryPolicy(), conn.bindRetryPolicy)
+		_ = conn.Close()
+
+		var refreshed atomic.Int32
+		conn = newTestUDPConn(t, &mockClient{
+			performTransaction: func(_ context.Context, msg *stun.Message, _ net.Addr, _ bool) (TransactionResult, error) {
+				if msg.Type.Method == stun.MethodCreatePermission {
+					refreshed.Add(1)
+				}
+
+				return TransactionResult{Msg: new(stun.Message)}, nil
+			},
+		}, WithPermissionRefreshInterval(20*time.Millisecond),
+			WithPermissionLifetime(100*time.Millisecond), WithPermissionRefreshMargin(50*time.Millisecond))
+		assert.Equal(t, 20*time.Millisecond, conn.permRefreshInterval)
+
+		conn.permMap.insert(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}, &permission{st: PermissionStatePermitted})
+		assert.Eventually(t, func() bool {
+			return refreshed.Load() >= 2
+		}, 5*time.Second, 10*time.Millisecond, "permissions should be refreshed periodically")
+	})
+
+	t.Run("maybeBind() with RetryPolicy", func(t *testing.T) {
+		policy := RetryPolicy{
+			InitialInterval: 20 * time.Millisecond,
+			Multiplier:      2,
+			MaxRetries:      2,
+			Jitter:          0.5,
+		}
+
+		newConn := func(fn func(context.Context, *stun.Message, net.Addr, bool) (TransactionResult, error)) (
+			*UDPConn, *binding.Manager,
+		) {
+			conn := newTestUDPConn(t, &mockClient{performTransaction: fn}, WithRetryPolicy(policy))
+
+			return conn, conn.bindingMgr
+		}
+
+		t.Run("stale nonce retried at once", func(t *testing.T) {
+			var attempts atomic.Int32
+			conn, bm := newConn(func(context.Context, *stun.Message, net.Addr, bool) (TransactionResult, error) {
+				if attempts.Add(1) == 1 {
+					return TransactionResult{Msg: staleNonceMsg()}, nil
+				}
+
+				return TransactionResult{Msg: new(stun.Message)}, nil
+			})
+			bound := mustCreateBinding(t, bm, &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1234})
+
+			start := time.Now()
+			conn.maybeBind(bound)
+			assertBindingState(t, conn.bindingMgr, bound.Addr(), binding.StateReady, 5*time.Second)
+			assert.Equal(t, int32(2), attempts.Load())
+			assert.Less(t, time.Since(start), policy.InitialInterval, "no back-off before the first retry")
+		})
+
+		t.Run("failure after max retries", func(t *testing.T) {
+			var attempts atomic.Int32
+			conn, bm := newConn(func(context.Context, *stun.Message, net.Addr, bool) (TransactionResult, error) {
+				attempts.Add(1)
+
+				return TransactionResult{Msg: staleNonceMsg()}, nil
+			})
+			bound := mustCreateBinding(t, bm, &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1234})
+
+			conn.maybeBind(bound)
+			assertBindingState(t, conn.bindingMgr, bound.Addr(), binding.StateFailed, 5*time.Second)
+			// The resend at once with the new nonce is the first retry
+			assert.Equal(t, int32(policy.MaxRetries+1), attempts.Load()) //nolint:gosec // G115
+		})
+
+		t.Run("no retries", func(t *testing.T) {
+			var attempts atomic.Int32
+			conn := newTestUDPConn(t, &mockClient{performTransaction: func(
+				context.Context, *stun.Message, net.Addr, bool,
+			) (TransactionResult, error) {
+				attempts.Add(1)
+
+				return TransactionResult{Msg: staleNonceMsg()}, nil
+			}}, WithRetryPolicy(RetryPolicy{Multiplier: 1}))
+			bound := mustCreateBinding(t, conn.bindingMgr, &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1234})
+
+			conn.maybeBind(bound)
+			assertBindingState(t, conn.bindingMgr, bound.Addr(), binding.StateFailed, 5*time.Second)
+			assert.Equal(t, int32(1), attempts.Load(), "MaxRetries of zero disables the resend at once")
+		})
+
+		t.Run("jitter spreads simultaneous retries", func(t *testing.T) {
+			var mu sync.Mutex
+			attemptTimes := map[string][]time.Time{}
+			conn, bm := newConn(func(_ context.Context, msg *stun.Message, _ net.Addr, _ bool) (
+				TransactionResult, error,
+			) {
+				if msg.Type.Method != stun.MethodChannelBind {
+					return TransactionResult{Msg: new(stun.Message)}, nil
+				}
+
+				var peerAddr proto.PeerAddress
+				assert.NoError(t, peerAddr.GetFrom(msg))
+
+				mu.Lock()
+				key := peerAddr.String()
+				attemptTimes[key] = append(attemptTimes[key], time.Now())
+				n := len(attemptTimes[key])
+				mu.Unlock()
+
+				if n <= 2 {
+					return TransactionResult{Msg: staleNonceMsg()}, nil
+				}
+
+				return TransactionResult{Msg: new(stun.Message)}, nil
 			})
+			bound1 := mustCreateBinding(t, bm, &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1234})
+			bound2 := mustCreateBinding(t, bm, &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 5678})
+
+			conn.maybeBind(bound1)
+			conn.maybeBind(bound2)
+			assertBindingState(t, bm, bound1.Addr(), binding.StateReady, 5*time.Second)
+			assertBindingState(t, bm, bound2.Addr(), binding.StateReady, 5*time.Second)
+
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Len(t, attemptTimes, 2)
+			var backoffs []time.Duration
+			for _, times := range attemptTimes {
+				assert.Len(t, times, 3)
+				backoffs = append(backoffs, times[2].Sub(times[1]))
+			}
+			assert.NotEqual(t, backoffs[0], backoffs[1], "retries should not be synchronized")
+		})
+	})
+
+	t.Run("failed binding recovery", func(t *testing.T) {
+		peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+
+		var binds atomic.Int32
+		reject := func(_ context.Context, msg *stun.Message, _ net.Addr, _ bool) (TransactionResult, error) {
+			if msg.Type.Method == stun.MethodChannelBind {
+				binds.Add(1)
+
+				return TransactionResult{Msg: stun.MustBuild(
+					stun.NewType(stun.MethodChannelBind, stun.ClassErrorResponse),
+					stun.CodeServerError,
+				)}, nil
+			}
+
+			return TransactionResult{Msg: new(stun.Message)}, nil
 		}
+		client := &mockClient{performTransaction: reject}
+		conn := newTestUDPConn(t, client, WithFailedBindingCooldown(20*time.Millisecond))
+
+		// The server rejects the first ChannelBind
+		_, err := conn.WriteTo([]byte("hello"), peer)
+		assert.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			return conn.Stats().BindingErrors == 1
+		}, 5*time.Second, 10*time.Millisecond)
+
+		// And accepts the retry while the conn is in use
+		client.SetPerformTransaction(func(_ context.Context, msg *stun.Message, _ net.Addr, _ bool) (
+			TransactionResult, error,
+		) {
+			if msg.Type.Method == stun.MethodChannelBind {
+				binds.Add(1)
+			}
+
+			return TransactionResult{Msg: new(stun.Message)}, nil
+		})
+
+		// Keep writing: after the cooldown the binding is retried and
+		// data flows over the channel
+		assert.Eventually(t, func() bool {
+			_, err := conn.WriteTo([]byte("hello"), peer)
+
+			return err == nil && conn.Stats().ChannelSends > 0
+		}, 5*time.Second, 10*time.Millisecond)
+		assert.Equal(t, int32(2), binds.Load())
+		assert.Equal(t, uint64(1), conn.Stats().BindingErrors)
+	})
+
+	t.Run("failed binding without cooldown", func(t *testing.T) {
+		peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+
+		conn := newTestUDPConn(t, &mockClient{})
+		bound := mustCreateBinding(t, conn.bindingMgr, peer)
+		bound.SetState(binding.StateFailed)
+		conn.scheduleBindingRecovery(bound)
+
+		time.Sleep(20 * time.Millisecond)
+		assert.Equal(t, binding.StateFailed, bound.State())
 	})
 
 	t.Run("bind()", func(t *testing.T) {
 		tests := []struct {
 			name                 string
-			transactionFn        func(*stun.Message, net.Addr, bool) (TransactionResult, error)
+			transactionFn        func(context.Context, *stun.Message, net.Addr, bool) (TransactionResult, error)
 			expectErr            error
 			expectBindingDeleted bool
 			expectNonceChanged   bool
+			expectAttempts       int32
 		}{
 			{
 				name: "PerformTransaction returns error",
-				transactionFn: func(*stun.Message, net.Addr, bool) (TransactionResult, error) {
+				transactionFn: func(context.Context, *stun.Message, net.Addr, bool) (TransactionResult, error) {
 					return TransactionResult{}, errFake
 				},
 				expectErr:            errFake,
 				expectBindingDeleted: true,
+				expectAttempts:       1,
+			},
+			{
+				name: "ErrorResponse with CodeStaleNonce is retried with the new nonce",
+				transactionFn: func(_ context.Context, msg *stun.Message, _ net.Addr, _ bool) (TransactionResult, error) {
+					var nonce stun.Nonce
+					if err := nonce.GetFrom(msg); err == nil && nonce.String() == "new-nonce-123" {
+						return TransactionResult{Msg: new(stun.Message)}, nil
+					}
+
+					return TransactionResult{Msg: staleNonceMsg()}, nil
+				},
+				expectNonceChanged: true,
+				expectAttempts:     2,
 			},
 			{
-				name: "ErrorResponse with CodeStaleNonce triggers nonce update",
-				transactionFn: func(*stun.Message, net.Addr, bool) (TransactionResult, error) {
+				name: "Second CodeStaleNonce in a row is not retried",
+				transactionFn: func(context.Context, *stun.Message, net.Addr, bool) (TransactionResult, error) {
 					return TransactionResult{Msg: staleNonceMsg()}, nil
 				},
 				expectErr:          errTryAgain,
 				expectNonceChanged: true,
+				expectAttempts:     2,
 			},
 		}
 
 		for _, tt := range tests {
 			t.Run(tt.name, func(t *testing.T) {
-				bm := newBindingManager()
-				bound := bm.create(&net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1234})
-				conn := makeConn(&mockClient{performTransaction: tt.transactionFn}, bm)
+				var attempts atomic.Int32
+				conn := newTestUDPConn(t, &mockClient{performTransaction: func(
+					ctx context.Context, msg *stun.Message, addr net.Addr, dontWait bool,
+				) (TransactionResult, error) {
+					attempts.Add(1)
+
+					return tt.transactionFn(ctx, msg, addr, dontWait)
+				}})
+				bm := conn.bindingMgr
+				bound := mustCreateBinding(t, bm, &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1234})
 
 				nonceT0 := conn.nonce()
 
-				err := conn.bind(bound)
+				err := conn.bind(context.Background(), bound)
 				if tt.expectErr == nil {
 					assert.NoError(t, err)
 				} else {
 					assert.ErrorIs(t, err, tt.expectErr)
 				}
+				assert.Equal(t, tt.expectAttempts, attempts.Load())
 
 				if tt.expectBindingDeleted {
-					assert.Empty(t, bm.chanMap)
-					assert.Empty(t, bm.addrMap)
+					assert.Zero(t, bm.Size())
+					_, ok := bm.FindByAddr(bound.Addr())
+					assert.False(t, ok)
 				}
 
 				nonceT1 := conn.nonce()
@@ -147,7 +1345,7 @@ func TestUDPConn(t *testing.T) {
 
 	t.Run("WriteTo()", func(t *testing.T) {
 		client := &mockClient{
-			performTransaction: func(*stun.Message, net.Addr, bool) (TransactionResult, error) {
+			performTransaction: func(context.Context, *stun.Message, net.Addr, bool) (TransactionResult, error) {
 				return TransactionResult{}, errFake
 			},
 			writeTo: func(data []byte, _ net.Addr) (int, error) {
@@ -160,26 +1358,520 @@ func TestUDPConn(t *testing.T) {
 			Port: 1234,
 		}
 
-		pm := newPermissionMap()
-		assert.True(t, pm.insert(addr, &permission{
-			st: permStatePermitted,
+		conn := newTestUDPConn(t, client)
+		assert.True(t, conn.permMap.insert(addr, &permission{
+			st: PermissionStatePermitted,
 		}))
 
-		bm := newBindingManager()
-		binding := bm.create(addr)
-		binding.setState(bindingStateReady)
-
-		conn := UDPConn{
-			allocation: allocation{
-				client:  client,
-				permMap: pm,
-			},
-			bindingMgr: bm,
-		}
+		bound := mustCreateBinding(t, conn.bindingMgr, addr)
+		bound.SetState(binding.StateReady)
 
 		buf := []byte("Hello")
 		n, err := conn.WriteTo(buf, addr)
 		assert.NoError(t, err, "should fail")
 		assert.Equal(t, len(buf), n)
 	})
+
+	t.Run("WriteTo() with pending permission", func(t *testing.T) {
+		peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+
+		t.Run("rejected", func(t *testing.T) {
+			var written atomic.Int32
+			conn := newTestUDPConn(t, &mockClient{
+				performTransaction: func(_ context.Context, msg *stun.Message, _ net.Addr, _ bool) (TransactionResult, error) {
+					if msg.Type.Method == stun.MethodCreatePermission {
+						return TransactionResult{Msg: stun.MustBuild(
+							stun.NewType(stun.MethodCreatePermission, stun.ClassErrorResponse),
+							stun.CodeForbidden,
+						)}, nil
+					}
+
+					return TransactionResult{Msg: new(stun.Message)}, nil
+				},
+				writeTo: func(data []byte, _ net.Addr) (int, error) {
+					written.Add(1)
+
+					return len(data), nil
+				},
+			})
+
+			n, err := conn.WriteTo([]byte("hello"), peer)
+			assert.ErrorContains(t, err, "Forbidden")
+			assert.Equal(t, 0, n)
+			assert.Equal(t, int32(0), written.Load(), "nothing should be sent without a permission")
+		})
+
+		t.Run("waiters honor their context", func(t *testing.T) {
+			unblock := make(chan struct{})
+			started := make(chan struct{})
+			conn := newTestUDPConn(t, &mockClient{
+				performTransaction: func(_ context.Context, msg *stun.Message, _ net.Addr, _ bool) (TransactionResult, error) {
+					if msg.Type.Method == stun.MethodCreatePermission {
+						close(started)
+						<-unblock
+					}
+
+					return TransactionResult{Msg: new(stun.Message)}, nil
+				},
+			})
+
+			firstErr := make(chan error, 1)
+			go func() {
+				_, err := conn.WriteTo([]byte("first"), peer)
+				firstErr <- err
+			}()
+			<-started
+
+			perm, ok := conn.permMap.find(peer)
+			assert.True(t, ok)
+			assert.Equal(t, PermissionStatePending, perm.state())
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			_, err := conn.WriteToContext(ctx, []byte("second"), peer)
+			assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+			close(unblock)
+			assert.NoError(t, <-firstErr)
+			assert.Equal(t, PermissionStatePermitted, perm.state())
+		})
+	})
+
+	t.Run("permission GC", func(t *testing.T) {
+		peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+
+		var createPermissions atomic.Int32
+		var reject atomic.Bool
+		reject.Store(true)
+		conn := newTestUDPConn(t, &mockClient{
+			performTransaction: func(_ context.Context, msg *stun.Message, _ net.Addr, _ bool) (TransactionResult, error) {
+				if msg.Type.Method == stun.MethodCreatePermission {
+					createPermissions.Add(1)
+					if reject.Load() {
+						return TransactionResult{Msg: stun.MustBuild(
+							stun.NewType(stun.MethodCreatePermission, stun.ClassErrorResponse),
+							stun.CodeForbidden,
+						)}, nil
+					}
+				}
+
+				return TransactionResult{Msg: new(stun.Message)}, nil
+			},
+		}, WithPermissionGCInterval(10*time.Millisecond), WithPermissionRefreshInterval(time.Hour))
+
+		// A failed permission is removed
+		_, err := conn.WriteTo([]byte("hello"), peer)
+		assert.ErrorContains(t, err, "Forbidden")
+		assert.Eventually(t, func() bool {
+			_, ok := conn.permMap.find(peer)
+
+			return !ok
+		}, 5*time.Second, 5*time.Millisecond)
+
+		// The next write requests a new one
+		reject.Store(false)
+		_, err = conn.WriteTo([]byte("hello"), peer)
+		assert.NoError(t, err)
+		assert.Equal(t, int32(2), createPermissions.Load())
+		perm, ok := conn.permMap.find(peer)
+		assert.True(t, ok)
+
+		// So is one that outlived its lifetime without refresh
+		perm.setRefreshedAt(time.Now().Add(-defaultPermLifetime))
+		assert.Eventually(t, func() bool {
+			_, ok := conn.permMap.find(peer)
+
+			return !ok
+		}, 5*time.Second, 5*time.Millisecond)
+		_, err = conn.WriteTo([]byte("hello"), peer)
+		assert.NoError(t, err)
+		assert.Equal(t, int32(3), createPermissions.Load())
+	})
+
+	t.Run("permission refresh", func(t *testing.T) {
+		peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+		const lifetime = 300 * time.Millisecond
+
+		var mu sync.Mutex
+		var refreshTimes []time.Time
+		var reject atomic.Bool
+		conn := newTestUDPConn(t, &mockClient{
+			performTransaction: func(_ context.Context, msg *stun.Message, _ net.Addr, _ bool) (TransactionResult, error) {
+				if msg.Type.Method != stun.MethodCreatePermission {
+					return TransactionResult{Msg: new(stun.Message)}, nil
+				}
+				mu.Lock()
+				refreshTimes = append(refreshTimes, time.Now())
+				mu.Unlock()
+
+				if reject.Load() {
+					return TransactionResult{Msg: stun.MustBuild(
+						stun.NewType(stun.MethodCreatePermission, stun.ClassErrorResponse),
+						stun.CodeForbidden,
+					)}, nil
+				}
+
+				return TransactionResult{Msg: new(stun.Message)}, nil
+			},
+		}, WithPermissionRefreshInterval(20*time.Millisecond),
+			WithPermissionLifetime(lifetime), WithPermissionRefreshMargin(100*time.Millisecond))
+
+		// Created by the write
+		start := time.Now()
+		_, err := conn.WriteTo([]byte("hello"), peer)
+		assert.NoError(t, err)
+		perm, ok := conn.permMap.find(peer)
+		assert.True(t, ok)
+
+		// Refreshed before it expires, but not right away
+		assert.Eventually(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+
+			return len(refreshTimes) >= 2
+		}, 5*time.Second, 5*time.Millisecond)
+		mu.Lock()
+		age := refreshTimes[1].Sub(start)
+		mu.Unlock()
+		assert.Greater(t, age, 100*time.Millisecond)
+		assert.Less(t, age, lifetime)
+		assert.Equal(t, PermissionStatePermitted, perm.state())
+
+		// A failed refresh fails the permission and the next write errors out
+		reject.Store(true)
+		assert.Eventually(t, func() bool {
+			return perm.state() == PermissionStateFailed
+		}, 5*time.Second, 5*time.Millisecond)
+		_, err = conn.WriteTo([]byte("hello"), peer)
+		assert.ErrorContains(t, err, "Forbidden")
+	})
+
+	t.Run("SOFTWARE", func(t *testing.T) {
+		for _, software := range []string{"test software", ""} {
+			var mu sync.Mutex
+			var requests []*stun.Message
+			client := &mockClient{
+				performTransaction: func(_ context.Context, msg *stun.Message, _ net.Addr, _ bool) (TransactionResult, error) {
+					mu.Lock()
+					requests = append(requests, msg)
+					mu.Unlock()
+
+					return TransactionResult{Msg: new(stun.Message)}, nil
+				},
+			}
+			conn, err := NewUDPConn(&AllocationConfig{
+				Client:      client,
+				RelayedAddr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 3478},
+				Lifetime:    time.Hour,
+				Software:    stun.NewSoftware(software),
+			})
+			assert.NoError(t, err)
+
+			peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+			assert.NoError(t, conn.CreatePermissions(peer))
+			assert.NoError(t, conn.bind(context.Background(), mustCreateBinding(t, conn.bindingMgr, peer)))
+			assert.NoError(t, conn.refreshAllocation(context.Background(), time.Minute, true))
+
+			mu.Lock()
+			assert.Len(t, requests, 3)
+			for _, req := range requests {
+				var got stun.Software
+				err := got.GetFrom(req)
+				if software == "" {
+					assert.ErrorIs(t, err, stun.ErrAttributeNotFound, req.Type.String())
+				} else {
+					assert.NoError(t, err, req.Type.String())
+					assert.Equal(t, software, got.String())
+				}
+			}
+			mu.Unlock()
+			assert.NoError(t, conn.Close())
+		}
+	})
+
+	t.Run("SetWriteDeadline()", func(t *testing.T) {
+		addr := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1234}
+		var transactions atomic.Int32
+		conn := newTestUDPConn(t, &mockClient{
+			performTransaction: func(ctx context.Context, _ *stun.Message, _ net.Addr, dontWait bool) (
+				TransactionResult, error,
+			) {
+				if dontWait { // Refresh sent by Close
+					return TransactionResult{}, nil
+				}
+				transactions.Add(1)
+				<-ctx.Done()
+
+				return TransactionResult{}, ctx.Err()
+			},
+		})
+
+		// A deadline in the past fails right away, without a transaction
+		assert.NoError(t, conn.SetWriteDeadline(time.Now()))
+		start := time.Now()
+		_, err := conn.WriteTo([]byte("Hello"), addr)
+		assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+		var netErr net.Error
+		assert.ErrorAs(t, err, &netErr)
+		assert.True(t, netErr.Timeout())
+		assert.Less(t, time.Since(start), time.Second)
+		assert.Equal(t, int32(0), transactions.Load())
+
+		// The deadline bounds the wait for the permission
+		assert.NoError(t, conn.SetWriteDeadline(time.Now().Add(10*time.Millisecond)))
+		_, err = conn.WriteTo([]byte("Hello"), addr)
+		assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+		assert.Equal(t, int32(1), transactions.Load())
+
+		// A blocked WriteTo is released by a new deadline
+		assert.NoError(t, conn.SetWriteDeadline(time.Time{}))
+		done := make(chan error)
+		go func() {
+			_, err := conn.WriteTo([]byte("Hello"), addr)
+			done <- err
+		}()
+		assert.Eventually(t, func() bool { return transactions.Load() == 2 }, time.Second, time.Millisecond)
+		assert.NoError(t, conn.SetDeadline(time.Now()))
+		assert.ErrorIs(t, <-done, os.ErrDeadlineExceeded)
+	})
+
+	t.Run("WriteToContext()", func(t *testing.T) {
+		addr := &net.UDPAddr{
+			IP:   net.ParseIP("127.0.0.1"),
+			Port: 1234,
+		}
+
+		newConn := func(client *mockClient) *UDPConn {
+			return newTestUDPConn(t, client)
+		}
+
+		t.Run("canceled before transaction", func(t *testing.T) {
+			var called bool
+			conn := newConn(&mockClient{
+				performTransaction: func(context.Context, *stun.Message, net.Addr, bool) (TransactionResult, error) {
+					called = true
+
+					return TransactionResult{}, errFake
+				},
+			})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			n, err := conn.WriteToContext(ctx, []byte("Hello"), addr)
+			assert.ErrorIs(t, err, context.Canceled)
+			assert.Equal(t, 0, n)
+			assert.False(t, called, "should not start a transaction")
+		})
+
+		t.Run("deadline during CreatePermission", func(t *testing.T) {
+			conn := newConn(&mockClient{
+				performTransaction: func(ctx context.Context, _ *stun.Message, _ net.Addr, dontWait bool) (
+					TransactionResult, error,
+				) {
+					if dontWait { // Refresh sent by Close
+						return TransactionResult{}, nil
+					}
+					<-ctx.Done()
+
+					return TransactionResult{}, ctx.Err()
+				},
+			})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+
+			n, err := conn.WriteToContext(ctx, []byte("Hello"), addr)
+			assert.ErrorIs(t, err, context.DeadlineExceeded)
+			assert.Equal(t, 0, n)
+
+			_, ok := conn.permMap.find(addr)
+			assert.False(t, ok, "failed permission should be removed")
+		})
+	})
+}
+
+// newWriteBenchConn returns a UDPConn, already permitted to send to peer,
+// whose writes to the server are passed to onWrite.
+func newWriteBenchConn(tb testing.TB, peer net.Addr, onWrite func(data []byte), opts ...UDPConnOption) *UDPConn {
+	tb.Helper()
+
+	conn := newTestUDPConn(tb, &mockClient{
+		writeTo: func(data []byte, _ net.Addr) (int, error) {
+			onWrite(data)
+
+			return len(data), nil
+		},
+	}, opts...)
+
+	perm := &permission{}
+	perm.setState(PermissionStatePermitted)
+	perm.setRefreshedAt(time.Now())
+	conn.permMap.insert(peer, perm)
+
+	return conn
+}
+
+func BenchmarkUDPConnWriteTo(b *testing.B) {
+	peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+	payload := make([]byte, 1200)
+
+	for _, bc := range []struct {
+		name  string
+		state binding.State
+	}{
+		{"ChannelData", binding.StateReady},
+		{"SendIndication", binding.StateFailed}, // Failed bindings are not retried by WriteTo
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			var wireBytes int
+			conn := newWriteBenchConn(b, peer, func(data []byte) { wireBytes = len(data) })
+			mustCreateBinding(b, conn.bindingMgr, peer).SetState(bc.state)
+
+			b.ReportAllocs()
+			b.SetBytes(int64(len(payload)))
+			for i := 0; i < b.N; i++ {
+				if _, err := conn.WriteTo(payload, peer); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(wireBytes-len(payload)), "overhead-bytes/op")
+		})
+	}
+}
+
+// writeBenchPeers is the number of peers written to by BenchmarkWriteToSerial
+// and BenchmarkWriteToParallel.
+const writeBenchPeers = 8
+
+// newContentionBenchConn returns a conn with a permission and a ready channel
+// binding for each of writeBenchPeers peers.
+func newContentionBenchConn(b *testing.B) (*UDPConn, []net.Addr) {
+	b.Helper()
+
+	peers := make([]net.Addr, writeBenchPeers)
+	for i := range peers {
+		peers[i] = &net.UDPAddr{IP: net.IPv4(10, 0, 0, byte(i+1)), Port: 5000}
+	}
+	conn := newWriteBenchConn(b, peers[0], func([]byte) {})
+	for _, peer := range peers {
+		perm := &permission{}
+		perm.setState(PermissionStatePermitted)
+		perm.setRefreshedAt(time.Now())
+		conn.permMap.insert(peer, perm)
+		mustCreateBinding(b, conn.bindingMgr, peer).SetState(binding.StateReady)
+	}
+
+	return conn, peers
+}
+
+// BenchmarkWriteToSerial writes to the peers in turn from one goroutine, the
+// baseline for BenchmarkWriteToParallel.
+func BenchmarkWriteToSerial(b *testing.B) {
+	conn, peers := newContentionBenchConn(b)
+	payload := make([]byte, 1200)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(payload)))
+	for i := 0; i < b.N; i++ {
+		if _, err := conn.WriteTo(payload, peers[i%len(peers)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkWriteToParallel writes from at least writeBenchPeers goroutines,
+// each to its own peer, to measure the contention on the locks taken by
+// WriteTo. The mock client returns at once, so the time is all TURN overhead.
+//
+// PermissionMap and the binding manager are already guarded by a
+// sync.RWMutex, and WriteTo only takes their read locks, so writers do not
+// wait on each other. What remains is every RLock updating the shared reader
+// count of the RWMutex, a cache line bouncing between cores. If ns/op grows
+// with -cpu instead of staying close to BenchmarkWriteToSerial divided by
+// GOMAXPROCS, a sharded map would not help as long as the shard is picked
+// under a common lock; a copy-on-write map behind an atomic.Pointer, as
+// permissions change rarely compared to writes, would remove the lock from
+// the write path altogether.
+func BenchmarkWriteToParallel(b *testing.B) {
+	conn, peers := newContentionBenchConn(b)
+	payload := make([]byte, 1200)
+	var next atomic.Int32
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(payload)))
+	b.SetParallelism((writeBenchPeers + runtime.GOMAXPROCS(0) - 1) / runtime.GOMAXPROCS(0))
+	b.RunParallel(func(pb *testing.PB) {
+		peer := peers[int(next.Add(1)-1)%len(peers)]
+		for pb.Next() {
+			if _, err := conn.WriteTo(payload, peer); err != nil {
+				b.Error(err)
+
+				return
+			}
+		}
+	})
+}
+
+// BenchmarkUDPConnWriteToStalled writes to a server conn that stalls now and
+// then, as a full socket buffer would, and measures the time spent by callers.
+func BenchmarkUDPConnWriteToStalled(b *testing.B) {
+	peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+	payload := make([]byte, 1200)
+
+	for _, bc := range []struct {
+		name string
+		opts []UDPConnOption
+	}{
+		{"Direct", nil},
+		{"Queue", []UDPConnOption{WithWriteQueue(WriteQueueConfig{Size: 256})}},
+		{"QueueDropOnFull", []UDPConnOption{WithWriteQueue(WriteQueueConfig{Size: 256, DropOnFull: true})}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			var writes int
+			client := &mockClient{}
+			client.SetWriteTo(func(data []byte, _ net.Addr) (int, error) {
+				if writes++; writes%64 == 0 {
+					time.Sleep(100 * time.Microsecond)
+				}
+
+				return len(data), nil
+			})
+			conn := newTestUDPConn(b, client, bc.opts...)
+			conn.permMap.insert(peer, &permission{st: PermissionStatePermitted})
+			mustCreateBinding(b, conn.bindingMgr, peer).SetState(binding.StateReady)
+
+			b.SetBytes(int64(len(payload)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := conn.WriteTo(payload, peer); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+			b.ReportMetric(float64(conn.Stats().WritesDropped)/float64(b.N), "drops/op")
+		})
+	}
+}
+
+func BenchmarkUDPConnReadFrom(b *testing.B) {
+	peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+	payload := make([]byte, 1200)
+	buf := make([]byte, 1500)
+	conn := newTestUDPConn(b, &mockClient{})
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(payload)))
+	for i := 0; i < b.N; i++ {
+		conn.HandleInbound(payload, peer)
+		if _, _, err := conn.ReadFrom(buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	runtime.ReadMemStats(&after)
+	b.ReportMetric(float64(after.NumGC-before.NumGC), "gc-cycles")
+	b.ReportMetric(float64(after.PauseTotalNs-before.PauseTotalNs)/float64(b.N), "gc-pause-ns/op")
 }
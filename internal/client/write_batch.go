@@ -0,0 +1,138 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/pion/turn/v4/internal/proto"
+)
+
+// Message is a packet written by WriteBatch.
+type Message struct {
+	Payload []byte
+	Addr    net.Addr
+}
+
+// BatchWriter is implemented by Clients that can send several packets to
+// the TURN server at once, e.g. with sendmmsg on Linux.
+type BatchWriter interface {
+	// WriteBatch sends msgs in order and returns how many were sent.
+	WriteBatch(msgs []Message) (int, error)
+}
+
+// WriteBatch writes msgs in order and returns how many were written. Packets
+// to peers with a ready channel binding are framed as ChannelData and handed
+// to the Client together, in a single syscall if it implements BatchWriter.
+// Other packets go through WriteTo, creating permissions and bindings as
+// needed.
+func (c *UDPConn) WriteBatch(msgs []Message) (int, error) {
+	select {
+	case <-c.closeCh:
+		return 0, c.closedError()
+	case <-c.writeDeadline.Done():
+		return 0, c.writeTimeoutError()
+	default:
+	}
+	if err := c.beginWrite(); err != nil {
+		return 0, err
+	}
+	defer c.inflight.Done()
+
+	frames := make([]Message, 0, len(msgs))
+	payloadSizes := make([]int, 0, len(msgs))
+	written := 0
+	flush := func() error {
+		n, err := c.writeFrames(frames)
+		for _, size := range payloadSizes[:n] {
+			c.stats.channelSends.Add(1)
+			c.stats.bytesSent.Add(uint64(size))
+		}
+		written += n
+		frames, payloadSizes = frames[:0], payloadSizes[:0]
+
+		return err
+	}
+
+	now := time.Now()
+	for _, msg := range msgs {
+		if sizeErr := c.checkSize(msg.Payload); sizeErr != nil {
+			if err := flush(); err != nil {
+				return written, err
+			}
+
+			return written, sizeErr
+		}
+		if number, ok := c.readyChannel(msg.Addr, now); ok && c.writeQueue == nil {
+			chData := &proto.ChannelData{Data: msg.Payload, Number: proto.ChannelNumber(number)}
+			chData.Encode()
+			frames = append(frames, Message{Payload: chData.Raw, Addr: c.serverAddr})
+			payloadSizes = append(payloadSizes, len(msg.Payload))
+
+			continue
+		}
+
+		// Keep the order of packets
+		if err := flush(); err != nil {
+			return written, err
+		}
+		// Not through WriteTo, this write is already in progress for CloseWithDrain
+		if _, err := c.sendPacket(c.writeDeadline, msg.Payload, msg.Addr, SendOptions{}); err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				err = c.writeTimeoutError()
+			}
+
+			return written, err
+		}
+		written++
+	}
+
+	return written, flush()
+}
+
+// readyChannel returns the channel number bound to addr if data can be sent
+// to it as ChannelData right away.
+func (c *UDPConn) readyChannel(addr net.Addr, now time.Time) (uint16, bool) {
+	if _, ok := addr.(*net.UDPAddr); !ok || c.reconnecting.Load() {
+		return 0, false
+	}
+	perm, ok := c.permMap.find(addr)
+	if !ok || perm.state() != PermissionStatePermitted || perm.expired(c.permLifetimeOrDefault(), now) {
+		return 0, false
+	}
+	bound, ok := c.bindingMgr.FindByAddr(addr)
+	if !ok || !bound.OK() {
+		return 0, false
+	}
+
+	return bound.Number(), true
+}
+
+// writeFrames hands frames to the Client and returns how many were sent.
+func (c *UDPConn) writeFrames(frames []Message) (int, error) {
+	if len(frames) == 0 {
+		return 0, nil
+	}
+
+	var n int
+	var err error
+	if batch, ok := c.client.(BatchWriter); ok {
+		n, err = batch.WriteBatch(frames)
+	} else {
+		for _, frame := range frames {
+			if _, err = c.client.WriteTo(frame.Payload, frame.Addr); err != nil {
+				break
+			}
+			n++
+		}
+	}
+	if n > 0 {
+		c.touch()
+	}
+
+	return n, err
+}
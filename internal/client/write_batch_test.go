@@ -0,0 +1,185 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4/binding"
+	"github.com/pion/turn/v4/internal/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+// batchMockClient is a mockClient implementing BatchWriter.
+type batchMockClient struct {
+	*mockClient
+	writeBatch func(msgs []Message) (int, error)
+	batches    [][]Message // Protected by mutex
+	mutex      sync.Mutex
+}
+
+func (c *batchMockClient) WriteBatch(msgs []Message) (int, error) {
+	c.mutex.Lock()
+	c.batches = append(c.batches, append([]Message(nil), msgs...))
+	c.mutex.Unlock()
+
+	if c.writeBatch != nil {
+		return c.writeBatch(msgs)
+	}
+
+	return len(msgs), nil
+}
+
+// decodeChannelData returns the payload of a ChannelData frame on channel number.
+func decodeChannelData(t *testing.T, raw []byte, number uint16) []byte {
+	t.Helper()
+
+	chData := &proto.ChannelData{Raw: raw}
+	assert.NoError(t, chData.Decode())
+	assert.Equal(t, proto.ChannelNumber(number), chData.Number)
+
+	return chData.Data
+}
+
+func TestUDPConnWriteBatch(t *testing.T) {
+	bound := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+	unbound := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 5000}
+
+	t.Run("ChannelData in batches", func(t *testing.T) {
+		var written [][]byte
+		client := &batchMockClient{mockClient: &mockClient{
+			writeTo: func(data []byte, _ net.Addr) (int, error) {
+				written = append(written, data)
+
+				return len(data), nil
+			},
+		}}
+		conn := newTestUDPConn(t, client)
+		for _, peer := range []net.Addr{bound, unbound} {
+			perm := &permission{}
+			perm.setState(PermissionStatePermitted)
+			perm.setRefreshedAt(time.Now())
+			conn.permMap.insert(peer, perm)
+		}
+		number := mustCreateBinding(t, conn.bindingMgr, bound)
+		number.SetState(binding.StateReady)
+		mustCreateBinding(t, conn.bindingMgr, unbound).SetState(binding.StateFailed)
+
+		n, err := conn.WriteBatch([]Message{
+			{Payload: []byte("1"), Addr: bound},
+			{Payload: []byte("2"), Addr: bound},
+			{Payload: []byte("3"), Addr: unbound},
+			{Payload: []byte("4"), Addr: bound},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 4, n)
+
+		// The Send indication splits the batch to keep the order of packets
+		assert.Len(t, client.batches, 2)
+		assert.Len(t, client.batches[0], 2)
+		assert.Len(t, client.batches[1], 1)
+		for i, want := range []string{"1", "2"} {
+			assert.Equal(t, conn.serverAddr, client.batches[0][i].Addr)
+			assert.Equal(t, []byte(want), decodeChannelData(t, client.batches[0][i].Payload, number.Number()))
+		}
+		assert.Equal(t, []byte("4"), decodeChannelData(t, client.batches[1][0].Payload, number.Number()))
+		assert.Len(t, written, 1)
+		assert.True(t, stun.IsMessage(written[0]))
+
+		stats := conn.Stats()
+		assert.Equal(t, uint64(3), stats.ChannelSends)
+		assert.Equal(t, uint64(1), stats.IndicationSends)
+		assert.Equal(t, uint64(4), stats.BytesSent)
+	})
+
+	t.Run("without BatchWriter", func(t *testing.T) {
+		var written [][]byte
+		conn := newWriteBenchConn(t, bound, func(data []byte) { written = append(written, data) })
+		number := mustCreateBinding(t, conn.bindingMgr, bound)
+		number.SetState(binding.StateReady)
+
+		n, err := conn.WriteBatch([]Message{{Payload: []byte("1"), Addr: bound}, {Payload: []byte("2"), Addr: bound}})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, n)
+		assert.Len(t, written, 2)
+		assert.Equal(t, []byte("2"), decodeChannelData(t, written[1], number.Number()))
+	})
+
+	t.Run("partial write", func(t *testing.T) {
+		client := &batchMockClient{
+			mockClient: &mockClient{},
+			writeBatch: func([]Message) (int, error) { return 1, errFake },
+		}
+		conn := newTestUDPConn(t, client)
+		perm := &permission{}
+		perm.setState(PermissionStatePermitted)
+		perm.setRefreshedAt(time.Now())
+		conn.permMap.insert(bound, perm)
+		mustCreateBinding(t, conn.bindingMgr, bound).SetState(binding.StateReady)
+
+		n, err := conn.WriteBatch([]Message{{Payload: []byte("1"), Addr: bound}, {Payload: []byte("2"), Addr: bound}})
+		assert.ErrorIs(t, err, errFake)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, uint64(1), conn.Stats().ChannelSends)
+	})
+
+	t.Run("invalid address", func(t *testing.T) {
+		conn := newWriteBenchConn(t, bound, func([]byte) {})
+
+		n, err := conn.WriteBatch([]Message{{Payload: []byte("1"), Addr: &net.TCPAddr{}}})
+		assert.ErrorIs(t, err, errUDPAddrCast)
+		assert.Equal(t, 0, n)
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		conn := newWriteBenchConn(t, bound, func([]byte) {})
+		_ = conn.Close() // The mock fails the final refresh
+
+		_, err := conn.WriteBatch([]Message{{Payload: []byte("1"), Addr: bound}})
+		assert.ErrorIs(t, err, errClosed)
+	})
+}
+
+func BenchmarkUDPConnWriteBatch(b *testing.B) {
+	peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+	payload := make([]byte, 1200)
+	const batchSize = 32
+
+	msgs := make([]Message, batchSize)
+	for i := range msgs {
+		msgs[i] = Message{Payload: payload, Addr: peer}
+	}
+
+	b.Run("WriteTo", func(b *testing.B) {
+		conn := newWriteBenchConn(b, peer, func([]byte) {})
+		mustCreateBinding(b, conn.bindingMgr, peer).SetState(binding.StateReady)
+
+		b.ReportAllocs()
+		b.SetBytes(int64(len(payload) * batchSize))
+		for i := 0; i < b.N; i++ {
+			for _, msg := range msgs {
+				if _, err := conn.WriteTo(msg.Payload, msg.Addr); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+
+	b.Run("WriteBatch", func(b *testing.B) {
+		conn := newWriteBenchConn(b, peer, func([]byte) {})
+		mustCreateBinding(b, conn.bindingMgr, peer).SetState(binding.StateReady)
+
+		b.ReportAllocs()
+		b.SetBytes(int64(len(payload) * batchSize))
+		for i := 0; i < b.N; i++ {
+			if _, err := conn.WriteBatch(msgs); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,132 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// WriteQueueConfig configures the queue that decouples UDPConn.WriteTo from
+// the writes to the TURN server, see WithWriteQueue.
+type WriteQueueConfig struct {
+	Size         int           // Writes buffered until they are sent, must be positive
+	DropOnFull   bool          // Drop writes while the queue is full instead of blocking
+	DrainTimeout time.Duration // Writes queued for longer are dropped, zero disables
+}
+
+func (c WriteQueueConfig) validate() error {
+	switch {
+	case c.Size <= 0:
+		return errInvalidWriteQueueSize
+	case c.DrainTimeout < 0:
+		return errNegativeDrainTimeout
+	}
+
+	return nil
+}
+
+// writeFunc sends payload to addr through the allocation.
+type writeFunc func(ctx context.Context, payload []byte, addr net.Addr, opts SendOptions) (int, error)
+
+type queuedWrite struct {
+	payload  []byte
+	addr     net.Addr
+	opts     SendOptions
+	queuedAt time.Time
+}
+
+// writeQueue sends the writes of a UDPConn from a single goroutine, so that
+// callers do not wait for permissions or a full socket buffer. Writes are
+// sent in the order they were queued.
+type writeQueue struct {
+	config  WriteQueueConfig // Read-only
+	send    writeFunc        // Read-only
+	ch      chan *queuedWrite
+	done    chan struct{}
+	pending sync.WaitGroup // Writes queued and not handled yet
+}
+
+func newWriteQueue(config WriteQueueConfig, send writeFunc) *writeQueue {
+	return &writeQueue{
+		config: config,
+		send:   send,
+		ch:     make(chan *queuedWrite, config.Size),
+		done:   make(chan struct{}),
+	}
+}
+
+// enqueue queues a copy of payload. If the queue is full it either returns
+// false right away or, without DropOnFull, blocks until there is room, ctx is
+// done or closeCh is closed.
+func (q *writeQueue) enqueue(
+	ctx context.Context,
+	closeCh <-chan struct{},
+	payload []byte,
+	addr net.Addr,
+	opts SendOptions,
+) (bool, error) {
+	write := &queuedWrite{
+		payload:  append([]byte(nil), payload...),
+		addr:     addr,
+		opts:     opts,
+		queuedAt: time.Now(),
+	}
+
+	q.pending.Add(1)
+	if q.config.DropOnFull {
+		select {
+		case q.ch <- write:
+			return true, nil
+		default:
+			q.pending.Done()
+
+			return false, nil
+		}
+	}
+
+	select {
+	case q.ch <- write:
+		return true, nil
+	case <-ctx.Done():
+		q.pending.Done()
+
+		return false, ctx.Err()
+	case <-closeCh:
+		q.pending.Done()
+
+		return false, errClosed
+	}
+}
+
+// run sends queued writes until ctx is done. onExpired is called for every
+// write that waited longer than DrainTimeout, onError for every failed send.
+func (q *writeQueue) run(ctx context.Context, onExpired func(), onError func(error)) {
+	defer close(q.done)
+
+	for {
+		select {
+		case write := <-q.ch:
+			q.handle(ctx, write, onExpired, onError)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// handle sends write unless it expired.
+func (q *writeQueue) handle(ctx context.Context, write *queuedWrite, onExpired func(), onError func(error)) {
+	defer q.pending.Done()
+
+	if q.config.DrainTimeout > 0 && time.Since(write.queuedAt) > q.config.DrainTimeout {
+		onExpired()
+
+		return
+	}
+	if _, err := q.send(ctx, write.payload, write.addr, write.opts); err != nil {
+		onError(err)
+	}
+}
@@ -0,0 +1,98 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteQueue(t *testing.T) {
+	peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+	noWrite := func(context.Context, []byte, net.Addr, SendOptions) (int, error) { return 0, nil }
+
+	t.Run("validate", func(t *testing.T) {
+		assert.ErrorIs(t, WriteQueueConfig{}.validate(), errInvalidWriteQueueSize)
+		assert.ErrorIs(t, WriteQueueConfig{Size: 1, DrainTimeout: -time.Second}.validate(), errNegativeDrainTimeout)
+		assert.NoError(t, WriteQueueConfig{Size: 1}.validate())
+	})
+
+	t.Run("enqueue copies the payload", func(t *testing.T) {
+		queue := newWriteQueue(WriteQueueConfig{Size: 1}, noWrite)
+
+		payload := []byte("hello")
+		queued, err := queue.enqueue(context.Background(), nil, payload, peer, SendOptions{})
+		assert.NoError(t, err)
+		assert.True(t, queued)
+		copy(payload, "world")
+
+		write := <-queue.ch
+		assert.Equal(t, "hello", string(write.payload))
+		assert.Equal(t, peer, write.addr)
+	})
+
+	t.Run("full queue with DropOnFull", func(t *testing.T) {
+		queue := newWriteQueue(WriteQueueConfig{Size: 1, DropOnFull: true}, noWrite)
+
+		queued, err := queue.enqueue(context.Background(), nil, []byte("one"), peer, SendOptions{})
+		assert.NoError(t, err)
+		assert.True(t, queued)
+		queued, err = queue.enqueue(context.Background(), nil, []byte("two"), peer, SendOptions{})
+		assert.NoError(t, err)
+		assert.False(t, queued, "should drop instead of blocking")
+	})
+
+	t.Run("full queue blocks", func(t *testing.T) {
+		queue := newWriteQueue(WriteQueueConfig{Size: 1}, noWrite)
+		_, err := queue.enqueue(context.Background(), nil, []byte("one"), peer, SendOptions{})
+		assert.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		queued, err := queue.enqueue(ctx, nil, []byte("two"), peer, SendOptions{})
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.False(t, queued)
+
+		closeCh := make(chan struct{})
+		close(closeCh)
+		queued, err = queue.enqueue(context.Background(), closeCh, []byte("two"), peer, SendOptions{})
+		assert.ErrorIs(t, err, errClosed)
+		assert.False(t, queued)
+	})
+
+	t.Run("run sends in order and drops expired writes", func(t *testing.T) {
+		sent := make(chan string, 4)
+		queue := newWriteQueue(WriteQueueConfig{Size: 4, DrainTimeout: time.Minute}, func(
+			_ context.Context, payload []byte, _ net.Addr, _ SendOptions,
+		) (int, error) {
+			sent <- string(payload)
+
+			return len(payload), nil
+		})
+
+		// "stale" has been waiting for longer than the drain timeout
+		queue.pending.Add(1)
+		queue.ch <- &queuedWrite{payload: []byte("stale"), addr: peer, queuedAt: time.Now().Add(-time.Hour)}
+		for _, payload := range []string{"one", "two"} {
+			_, err := queue.enqueue(context.Background(), nil, []byte(payload), peer, SendOptions{})
+			assert.NoError(t, err)
+		}
+
+		expired := make(chan struct{}, 1)
+		ctx, cancel := context.WithCancel(context.Background())
+		go queue.run(ctx, func() { expired <- struct{}{} }, func(err error) { assert.NoError(t, err) })
+
+		<-expired
+		assert.Equal(t, "one", <-sent)
+		assert.Equal(t, "two", <-sent)
+
+		cancel()
+		<-queue.done
+		assert.Empty(t, sent)
+	})
+}
@@ -7,6 +7,7 @@ package ipnet
 import (
 	"errors"
 	"net"
+	"strconv"
 )
 
 var errFailedToCastAddr = errors.New("failed to cast net.Addr to *net.UDPAddr or *net.TCPAddr")
@@ -47,10 +48,32 @@ func AddrEqual(a, b net.Addr) bool {
 func FingerprintAddr(addr net.Addr) string {
 	switch a := addr.(type) {
 	case *net.UDPAddr:
-		return a.IP.String()
+		return canonicalIP(a.IP).String()
 	case *net.TCPAddr: // Do we really need this case?
-		return a.IP.String()
+		return canonicalIP(a.IP).String()
 	}
 
 	return "" // Should never happen
 }
+
+// FingerprintAddrPort is like FingerprintAddr but includes the port.
+// The IPv6 zone is dropped and IPv4-mapped IPv6 addresses are treated
+// as their IPv4 equivalent, so ::ffff:127.0.0.1 and 127.0.0.1 share a key.
+func FingerprintAddrPort(addr net.Addr) string {
+	ip, port, err := AddrIPPort(addr)
+	if err != nil {
+		return addr.String()
+	}
+
+	return net.JoinHostPort(canonicalIP(ip).String(), strconv.Itoa(port))
+}
+
+// canonicalIP returns the 4-byte form of IPv4 (and IPv4-mapped IPv6)
+// addresses and the 16-byte form of everything else.
+func canonicalIP(ip net.IP) net.IP {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+
+	return ip.To16()
+}
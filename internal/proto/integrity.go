@@ -0,0 +1,123 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package proto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pion/stun/v3"
+)
+
+// Integrity is a message integrity attribute that can be added to and
+// checked against a message, e.g. stun.MessageIntegrity or MessageIntegritySHA256.
+type Integrity interface {
+	AddTo(m *stun.Message) error
+	Check(m *stun.Message) error
+}
+
+// MessageIntegritySHA256 represents MESSAGE-INTEGRITY-SHA256 attribute.
+//
+// The value is the HMAC key, see NewLongTermIntegritySHA256.
+//
+// RFC 8489 Section 14.6.
+type MessageIntegritySHA256 []byte
+
+const (
+	messageIntegritySHA256Size    = sha256.Size
+	messageIntegritySHA256MinSize = 16
+	attributeHeaderSize           = 4
+	messageHeaderSize             = 20
+)
+
+// ErrBadIntegritySHA256Length means that MESSAGE-INTEGRITY-SHA256 has a
+// length that is not allowed by RFC 8489 Section 14.6.
+var ErrBadIntegritySHA256Length = errors.New("invalid MESSAGE-INTEGRITY-SHA256 length")
+
+// NewLongTermIntegritySHA256 returns new MessageIntegritySHA256 with the key
+// for long-term credentials with the SHA-256 password algorithm, see RFC 8489
+// Section 9.2.2. Password, username, and realm must be SASL-prepared.
+func NewLongTermIntegritySHA256(username, realm, password string) MessageIntegritySHA256 {
+	key := sha256.Sum256([]byte(strings.Join([]string{username, realm, password}, ":")))
+
+	return MessageIntegritySHA256(key[:])
+}
+
+func (i MessageIntegritySHA256) String() string {
+	return fmt.Sprintf("KEY: 0x%x", []byte(i))
+}
+
+func (i MessageIntegritySHA256) sum(message []byte) []byte {
+	mac := hmac.New(sha256.New, i)
+	_, _ = mac.Write(message)
+
+	return mac.Sum(nil)
+}
+
+// AddTo adds MESSAGE-INTEGRITY-SHA256 attribute to message.
+func (i MessageIntegritySHA256) AddTo(m *stun.Message) error {
+	for _, a := range m.Attributes {
+		// Message should not contain FINGERPRINT attribute
+		// before MESSAGE-INTEGRITY-SHA256.
+		if a.Type == stun.AttrFingerprint {
+			return stun.ErrFingerprintBeforeIntegrity
+		}
+	}
+	// The HMAC covers the message up to and including the attribute preceding
+	// MESSAGE-INTEGRITY-SHA256, with the length field already accounting for it.
+	length := m.Length
+	m.Length += messageIntegritySHA256Size + attributeHeaderSize
+	m.WriteLength()
+	v := i.sum(m.Raw)
+	m.Length = length
+
+	m.Add(stun.AttrMessageIntegritySHA256, v)
+
+	return nil
+}
+
+// Check checks MESSAGE-INTEGRITY-SHA256 attribute. Truncated values are
+// accepted as allowed by RFC 8489 Section 14.6.
+func (i MessageIntegritySHA256) Check(m *stun.Message) error {
+	v, err := m.Get(stun.AttrMessageIntegritySHA256)
+	if err != nil {
+		return err
+	}
+	if len(v) < messageIntegritySHA256MinSize || len(v) > messageIntegritySHA256Size || len(v)%4 != 0 {
+		return ErrBadIntegritySHA256Length
+	}
+
+	// Adjusting length in header to match m.Raw that was
+	// used when computing HMAC.
+	var (
+		length         = m.Length
+		afterIntegrity = false
+		sizeReduced    int
+	)
+	for _, a := range m.Attributes {
+		if afterIntegrity {
+			sizeReduced += nearestPaddedValueLength(int(a.Length))
+			sizeReduced += attributeHeaderSize
+		}
+		if a.Type == stun.AttrMessageIntegritySHA256 {
+			afterIntegrity = true
+		}
+	}
+	m.Length -= uint32(sizeReduced) //nolint:gosec // G115
+	m.WriteLength()
+	// startOfHMAC should be first byte of integrity attribute.
+	startOfHMAC := messageHeaderSize + int(m.Length) - (attributeHeaderSize + len(v))
+	expected := i.sum(m.Raw[:startOfHMAC])
+	m.Length = length
+	m.WriteLength() // Writing length back
+
+	if !hmac.Equal(v, expected[:len(v)]) {
+		return stun.ErrIntegrityMismatch
+	}
+
+	return nil
+}
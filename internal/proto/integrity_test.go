@@ -0,0 +1,109 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package proto
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/pion/stun/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageIntegritySHA256(t *testing.T) {
+	const (
+		username = "user"
+		realm    = "pion.ly"
+		password = "secret"
+	)
+	build := func(t *testing.T, integrity Integrity, setters ...stun.Setter) *stun.Message {
+		t.Helper()
+
+		msg, err := stun.Build(append([]stun.Setter{
+			stun.NewTransactionIDSetter([stun.TransactionIDSize]byte{1, 2, 3}),
+			AllocateRequest(),
+			stun.NewUsername(username),
+			stun.NewRealm(realm),
+			integrity,
+		}, setters...)...)
+		assert.NoError(t, err)
+
+		return msg
+	}
+
+	t.Run("Key", func(t *testing.T) {
+		key := NewLongTermIntegritySHA256(username, realm, password)
+		assert.Len(t, key, 32)
+		assert.NotEqual(t, []byte(stun.NewLongTermIntegrity(username, realm, password)), []byte(key))
+	})
+	t.Run("DistinctFromSHA1", func(t *testing.T) {
+		sha1Msg := build(t, stun.NewLongTermIntegrity(username, realm, password))
+		sha256Msg := build(t, NewLongTermIntegritySHA256(username, realm, password))
+		assert.NotEqual(t, sha1Msg.Raw, sha256Msg.Raw)
+
+		assert.True(t, sha1Msg.Contains(stun.AttrMessageIntegrity))
+		assert.False(t, sha1Msg.Contains(stun.AttrMessageIntegritySHA256))
+		assert.True(t, sha256Msg.Contains(stun.AttrMessageIntegritySHA256))
+		assert.False(t, sha256Msg.Contains(stun.AttrMessageIntegrity))
+	})
+	t.Run("Check", func(t *testing.T) {
+		integrity := NewLongTermIntegritySHA256(username, realm, password)
+		msg := build(t, integrity, stun.Fingerprint)
+
+		decoded := new(stun.Message)
+		_, err := decoded.Write(msg.Raw)
+		assert.NoError(t, err)
+		assert.NoError(t, integrity.Check(decoded))
+		assert.NoError(t, stun.Fingerprint.Check(decoded), "message must be restored after check")
+
+		wrong := NewLongTermIntegritySHA256(username, realm, "wrong")
+		assert.ErrorIs(t, wrong.Check(decoded), stun.ErrIntegrityMismatch)
+		assert.Error(t, stun.NewLongTermIntegrity(username, realm, password).Check(decoded))
+	})
+	t.Run("Truncated", func(t *testing.T) {
+		integrity := NewLongTermIntegritySHA256(username, realm, password)
+		msg := build(t, integrity)
+
+		// Re-encode with the HMAC truncated to 16 bytes
+		truncated := new(stun.Message)
+		truncated.TransactionID = msg.TransactionID
+		truncated.Type = msg.Type
+		truncated.WriteHeader()
+		for _, a := range msg.Attributes {
+			if a.Type != stun.AttrMessageIntegritySHA256 {
+				truncated.Add(a.Type, a.Value)
+			}
+		}
+		length := truncated.Length
+		truncated.Length += 16 + attributeHeaderSize
+		truncated.WriteLength()
+		mac := integrity.sum(truncated.Raw)
+		truncated.Length = length
+		truncated.Add(stun.AttrMessageIntegritySHA256, mac[:16])
+		assert.NoError(t, integrity.Check(truncated))
+
+		bad := new(stun.Message)
+		bad.WriteHeader()
+		bad.Add(stun.AttrMessageIntegritySHA256, make([]byte, 8))
+		assert.ErrorIs(t, integrity.Check(bad), ErrBadIntegritySHA256Length)
+	})
+	t.Run("HMAC", func(t *testing.T) {
+		// RFC 4231 Section 4.3, test case 2
+		mac := MessageIntegritySHA256("Jefe").sum([]byte("what do ya want for nothing?"))
+		assert.Equal(t, "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843", hex.EncodeToString(mac))
+	})
+	t.Run("FingerprintBefore", func(t *testing.T) {
+		msg := new(stun.Message)
+		msg.WriteHeader()
+		assert.NoError(t, stun.Fingerprint.AddTo(msg))
+		assert.ErrorIs(t,
+			NewLongTermIntegritySHA256(username, realm, password).AddTo(msg),
+			stun.ErrFingerprintBeforeIntegrity,
+		)
+	})
+	t.Run("Missing", func(t *testing.T) {
+		msg := build(t, stun.NewLongTermIntegrity(username, realm, password))
+		assert.ErrorIs(t, NewLongTermIntegritySHA256(username, realm, password).Check(msg), stun.ErrAttributeNotFound)
+	})
+}
@@ -0,0 +1,38 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package proto
+
+import "github.com/pion/stun/v3"
+
+// AttrMobilityTicket is the MOBILITY-TICKET attribute type, RFC 8016 Section 3.4.
+const AttrMobilityTicket stun.AttrType = 0x8030
+
+// MobilityTicket represents MOBILITY-TICKET attribute.
+//
+// The MOBILITY-TICKET attribute is used to retain an allocation on the TURN
+// server when the client moves to a new 5-tuple. The client includes an empty
+// ticket in an Allocate request to request mobility support, and the server
+// returns an opaque ticket in the success response. The client sends the
+// ticket in a Refresh request from the new 5-tuple to move the allocation.
+//
+// RFC 8016 Section 3.4.
+type MobilityTicket []byte
+
+// AddTo adds MOBILITY-TICKET to message.
+func (t MobilityTicket) AddTo(m *stun.Message) error {
+	m.Add(AttrMobilityTicket, t)
+
+	return nil
+}
+
+// GetFrom decodes MOBILITY-TICKET from message.
+func (t *MobilityTicket) GetFrom(m *stun.Message) error {
+	v, err := m.Get(AttrMobilityTicket)
+	if err != nil {
+		return err
+	}
+	*t = v
+
+	return nil
+}
@@ -0,0 +1,49 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package proto
+
+import (
+	"testing"
+
+	"github.com/pion/stun/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMobilityTicket(t *testing.T) {
+	t.Run("Empty", func(t *testing.T) {
+		stunMsg := new(stun.Message)
+		assert.NoError(t, MobilityTicket(nil).AddTo(stunMsg))
+		stunMsg.WriteHeader()
+
+		decoded := new(stun.Message)
+		_, err := decoded.Write(stunMsg.Raw)
+		assert.NoError(t, err)
+		assert.True(t, decoded.Contains(AttrMobilityTicket))
+
+		var ticket MobilityTicket
+		assert.NoError(t, ticket.GetFrom(decoded))
+		assert.Empty(t, ticket)
+	})
+	t.Run("AddTo", func(t *testing.T) {
+		stunMsg := new(stun.Message)
+		ticket := MobilityTicket{1, 2, 3, 4, 5}
+		assert.NoError(t, ticket.AddTo(stunMsg))
+		stunMsg.WriteHeader()
+
+		t.Run("GetFrom", func(t *testing.T) {
+			decoded := new(stun.Message)
+			_, err := decoded.Write(stunMsg.Raw)
+			assert.NoError(t, err)
+
+			var got MobilityTicket
+			assert.NoError(t, got.GetFrom(decoded))
+			assert.Equal(t, ticket, got)
+
+			t.Run("HandleErr", func(t *testing.T) {
+				var handle MobilityTicket
+				assert.ErrorIs(t, handle.GetFrom(new(stun.Message)), stun.ErrAttributeNotFound)
+			})
+		})
+	})
+}
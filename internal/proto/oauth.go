@@ -0,0 +1,68 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package proto
+
+import "github.com/pion/stun/v3"
+
+const (
+	// AttrAccessToken is the ACCESS-TOKEN attribute type, RFC 7635 Section 6.2.
+	AttrAccessToken stun.AttrType = 0x001B
+	// AttrThirdPartyAuthorization is the THIRD-PARTY-AUTHORIZATION attribute
+	// type, RFC 7635 Section 6.1.
+	AttrThirdPartyAuthorization stun.AttrType = 0x802E
+)
+
+// AccessToken represents ACCESS-TOKEN attribute.
+//
+// The ACCESS-TOKEN attribute carries the OAuth access token the client got
+// from the authorization server. It is opaque to the client: the TURN server
+// decrypts it to get the session key the request is signed with.
+//
+// RFC 7635 Section 6.2.
+type AccessToken []byte
+
+// AddTo adds ACCESS-TOKEN to message.
+func (t AccessToken) AddTo(m *stun.Message) error {
+	m.Add(AttrAccessToken, t)
+
+	return nil
+}
+
+// GetFrom decodes ACCESS-TOKEN from message.
+func (t *AccessToken) GetFrom(m *stun.Message) error {
+	v, err := m.Get(AttrAccessToken)
+	if err != nil {
+		return err
+	}
+	*t = v
+
+	return nil
+}
+
+// ThirdPartyAuthorization represents THIRD-PARTY-AUTHORIZATION attribute.
+//
+// The THIRD-PARTY-AUTHORIZATION attribute is sent by a TURN server in a 401
+// response to tell that it accepts access tokens. It carries the server
+// name, which identifies the TURN server to the authorization server.
+//
+// RFC 7635 Section 6.1.
+type ThirdPartyAuthorization string
+
+// AddTo adds THIRD-PARTY-AUTHORIZATION to message.
+func (a ThirdPartyAuthorization) AddTo(m *stun.Message) error {
+	m.Add(AttrThirdPartyAuthorization, []byte(a))
+
+	return nil
+}
+
+// GetFrom decodes THIRD-PARTY-AUTHORIZATION from message.
+func (a *ThirdPartyAuthorization) GetFrom(m *stun.Message) error {
+	v, err := m.Get(AttrThirdPartyAuthorization)
+	if err != nil {
+		return err
+	}
+	*a = ThirdPartyAuthorization(v)
+
+	return nil
+}
@@ -0,0 +1,60 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package proto
+
+import (
+	"testing"
+
+	"github.com/pion/stun/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessToken(t *testing.T) {
+	t.Run("AddTo", func(t *testing.T) {
+		stunMsg := new(stun.Message)
+		token := AccessToken{0x00, 0x02, 0xaa, 0xbb, 0xcc}
+		assert.NoError(t, token.AddTo(stunMsg))
+		stunMsg.WriteHeader()
+
+		// Type 0x001B, length 5, value padded to 4 bytes
+		assert.Equal(t, []byte{
+			0x00, 0x1b, 0x00, 0x05,
+			0x00, 0x02, 0xaa, 0xbb,
+			0xcc, 0x00, 0x00, 0x00,
+		}, stunMsg.Raw[messageHeaderSize:])
+
+		t.Run("GetFrom", func(t *testing.T) {
+			decoded := new(stun.Message)
+			_, err := decoded.Write(stunMsg.Raw)
+			assert.NoError(t, err)
+
+			var got AccessToken
+			assert.NoError(t, got.GetFrom(decoded))
+			assert.Equal(t, token, got)
+
+			t.Run("HandleErr", func(t *testing.T) {
+				var handle AccessToken
+				assert.ErrorIs(t, handle.GetFrom(new(stun.Message)), stun.ErrAttributeNotFound)
+			})
+		})
+	})
+}
+
+func TestThirdPartyAuthorization(t *testing.T) {
+	stunMsg := new(stun.Message)
+	assert.NoError(t, ThirdPartyAuthorization("turn.example.com").AddTo(stunMsg))
+	stunMsg.WriteHeader()
+	assert.Equal(t, []byte{0x80, 0x2e, 0x00, 0x10}, stunMsg.Raw[messageHeaderSize:messageHeaderSize+4])
+
+	decoded := new(stun.Message)
+	_, err := decoded.Write(stunMsg.Raw)
+	assert.NoError(t, err)
+
+	var got ThirdPartyAuthorization
+	assert.NoError(t, got.GetFrom(decoded))
+	assert.Equal(t, ThirdPartyAuthorization("turn.example.com"), got)
+
+	var handle ThirdPartyAuthorization
+	assert.ErrorIs(t, handle.GetFrom(new(stun.Message)), stun.ErrAttributeNotFound)
+}
@@ -32,3 +32,52 @@ func TestPeerAddress(t *testing.T) {
 	var aGot PeerAddress
 	assert.NoError(t, aGot.GetFrom(decoded))
 }
+
+func TestPeerAddressVectors(t *testing.T) {
+	// Test vectors for XOR-MAPPED-ADDRESS from RFC 5769 Sections 2.2 and 2.3,
+	// XOR-PEER-ADDRESS uses the same encoding, RFC 5766 Section 14.3.
+	transactionID := [stun.TransactionIDSize]byte{
+		0xb7, 0xe7, 0xa7, 0x01, 0xbc, 0x34, 0xd6, 0x86, 0xfa, 0x87, 0xdf, 0xae,
+	}
+	for _, tc := range []struct {
+		name string
+		addr PeerAddress
+		raw  []byte
+	}{
+		{
+			name: "IPv4",
+			addr: PeerAddress{IP: net.ParseIP("192.0.2.1"), Port: 32853},
+			raw:  []byte{0x00, 0x01, 0xa1, 0x47, 0xe1, 0x12, 0xa6, 0x43},
+		},
+		{
+			name: "IPv6",
+			addr: PeerAddress{IP: net.ParseIP("2001:db8:1234:5678:11:2233:4455:6677"), Port: 32853},
+			raw: []byte{
+				0x00, 0x02, 0xa1, 0x47,
+				0x01, 0x13, 0xa9, 0xfa, 0xa5, 0xd3, 0xf1, 0x79,
+				0xbc, 0x25, 0xf4, 0xb5, 0xbe, 0xd2, 0xb9, 0xd9,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			msg, err := stun.Build(
+				stun.NewTransactionIDSetter(transactionID),
+				SendIndication(),
+				tc.addr,
+			)
+			assert.NoError(t, err)
+
+			raw, err := msg.Get(stun.AttrXORPeerAddress)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.raw, raw)
+
+			decoded := new(stun.Message)
+			_, err = decoded.Write(msg.Raw)
+			assert.NoError(t, err)
+			var got PeerAddress
+			assert.NoError(t, got.GetFrom(decoded))
+			assert.True(t, tc.addr.IP.Equal(got.IP))
+			assert.Equal(t, tc.addr.Port, got.Port)
+		})
+	}
+}
@@ -4,6 +4,8 @@
 package proto
 
 import (
+	"errors"
+	"fmt"
 	"strconv"
 
 	"github.com/pion/stun/v3"
@@ -72,3 +74,26 @@ func (t *RequestedTransport) GetFrom(m *stun.Message) error {
 
 	return nil
 }
+
+// ErrUnsupportedProtocol means that REQUESTED-TRANSPORT holds a protocol
+// other than UDP or TCP.
+var ErrUnsupportedProtocol = errors.New("requested transport must be UDP or TCP")
+
+// ParseRequestedTransport decodes the REQUESTED-TRANSPORT attribute attr,
+// returning ErrUnsupportedProtocol for protocols other than UDP and TCP.
+// Unlike GetFrom, a malformed attribute is told apart from an unsupported
+// protocol, which RFC 5766 Section 6.2 answers with 400 and 442 errors.
+func ParseRequestedTransport(attr stun.RawAttribute) (Protocol, error) {
+	if attr.Type != stun.AttrRequestedTransport {
+		return 0, fmt.Errorf("%w: %s", stun.ErrAttributeNotFound, attr.Type)
+	}
+	if err := stun.CheckSize(stun.AttrRequestedTransport, len(attr.Value), requestedTransportSize); err != nil {
+		return 0, err
+	}
+	protocol := Protocol(attr.Value[0])
+	if protocol != ProtoUDP && protocol != ProtoTCP {
+		return protocol, fmt.Errorf("%w: %s", ErrUnsupportedProtocol, protocol)
+	}
+
+	return protocol, nil
+}
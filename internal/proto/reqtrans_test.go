@@ -81,3 +81,27 @@ func TestRequestedTransport(t *testing.T) {
 		})
 	})
 }
+
+func TestParseRequestedTransport(t *testing.T) {
+	for _, protocol := range []Protocol{ProtoUDP, ProtoTCP} {
+		m := new(stun.Message)
+		assert.NoError(t, RequestedTransport{Protocol: protocol}.AddTo(m))
+		attr, ok := m.Attributes.Get(stun.AttrRequestedTransport)
+		assert.True(t, ok)
+
+		parsed, err := ParseRequestedTransport(attr)
+		assert.NoError(t, err)
+		assert.Equal(t, protocol, parsed)
+	}
+
+	unknown := stun.RawAttribute{Type: stun.AttrRequestedTransport, Value: []byte{254, 0, 0, 0}}
+	parsed, err := ParseRequestedTransport(unknown)
+	assert.ErrorIs(t, err, ErrUnsupportedProtocol)
+	assert.Equal(t, Protocol(254), parsed)
+
+	_, err = ParseRequestedTransport(stun.RawAttribute{Type: stun.AttrRequestedTransport, Value: []byte{17, 0, 0}})
+	assert.True(t, stun.IsAttrSizeInvalid(err))
+
+	_, err = ParseRequestedTransport(stun.RawAttribute{Type: stun.AttrLifetime, Value: []byte{17, 0, 0, 0}})
+	assert.ErrorIs(t, err, stun.ErrAttributeNotFound)
+}
@@ -0,0 +1,130 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package proto
+
+import (
+	"encoding/hex"
+	"net"
+	"testing"
+
+	"github.com/pion/stun/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+// spacePadded adds an attribute with its padding set to spaces, as in the
+// RFC 5769 samples, instead of the zeros written by stun.Message.Add.
+type spacePadded struct {
+	stun.Setter
+}
+
+func (s spacePadded) AddTo(m *stun.Message) error {
+	if err := s.Setter.AddTo(m); err != nil {
+		return err
+	}
+	attr := m.Attributes[len(m.Attributes)-1]
+	padding := nearestPaddedValueLength(int(attr.Length)) - int(attr.Length)
+	for i := len(m.Raw) - padding; i < len(m.Raw); i++ {
+		m.Raw[i] = ' '
+	}
+
+	return nil
+}
+
+// TestRFC5769Vectors builds the sample messages of RFC 5769 and compares
+// them byte for byte with the ones in the RFC.
+func TestRFC5769Vectors(t *testing.T) {
+	transactionID := [stun.TransactionIDSize]byte{
+		0xb7, 0xe7, 0xa7, 0x01, 0xbc, 0x34, 0xd6, 0x86, 0xfa, 0x87, 0xdf, 0xae,
+	}
+	for _, tc := range []struct {
+		name    string
+		setters []stun.Setter
+		want    string
+	}{
+		{
+			name: "Request",
+			setters: []stun.Setter{
+				stun.NewTransactionIDSetter(transactionID),
+				stun.BindingRequest,
+				stun.NewSoftware("STUN test client"),
+				stun.RawAttribute{Type: stun.AttrPriority, Value: []byte{0x6e, 0x00, 0x01, 0xff}},
+				stun.RawAttribute{
+					Type:  stun.AttrICEControlled,
+					Value: []byte{0x93, 0x2f, 0xf9, 0xb1, 0x51, 0x26, 0x3b, 0x36},
+				},
+				spacePadded{stun.NewUsername("evtj:h6vY")},
+				stun.NewShortTermIntegrity("VOkJxbRl1RmTxUk/WvJxBt"),
+				stun.Fingerprint,
+			},
+			want: "000100582112a442b7e7a701bc34d686fa87dfae" +
+				"802200105354554e207465737420636c69656e74" +
+				"002400046e0001ff" +
+				"80290008932ff9b151263b36" +
+				"000600096576746a3a68367659202020" +
+				"000800149aeaa70cbfd8cb56781ef2b5b2d3f249c1b571a2" +
+				"80280004e57a3bcf",
+		},
+		{
+			name: "IPv4 response",
+			setters: []stun.Setter{
+				stun.NewTransactionIDSetter(transactionID),
+				stun.BindingSuccess,
+				spacePadded{stun.NewSoftware("test vector")},
+				&stun.XORMappedAddress{IP: net.ParseIP("192.0.2.1").To4(), Port: 32853},
+				stun.NewShortTermIntegrity("VOkJxbRl1RmTxUk/WvJxBt"),
+				stun.Fingerprint,
+			},
+			want: "0101003c2112a442b7e7a701bc34d686fa87dfae" +
+				"8022000b7465737420766563746f7220" +
+				"002000080001a147e112a643" +
+				"000800142b91f599fd9e90c38c7489f92af9ba53f06be7d7" +
+				"80280004c07d4c96",
+		},
+		{
+			name: "IPv6 response",
+			setters: []stun.Setter{
+				stun.NewTransactionIDSetter(transactionID),
+				stun.BindingSuccess,
+				spacePadded{stun.NewSoftware("test vector")},
+				&stun.XORMappedAddress{IP: net.ParseIP("2001:db8:1234:5678:11:2233:4455:6677"), Port: 32853},
+				stun.NewShortTermIntegrity("VOkJxbRl1RmTxUk/WvJxBt"),
+				stun.Fingerprint,
+			},
+			want: "010100482112a442b7e7a701bc34d686fa87dfae" +
+				"8022000b7465737420766563746f7220" +
+				"002000140002a1470113a9faa5d3f179bc25f4b5bed2b9d9" +
+				"00080014a382954e4be67bf11784c97c8292c275bfe3ed41" +
+				"80280004c8fb0b4c",
+		},
+		{
+			name: "Request with long-term credentials",
+			setters: []stun.Setter{
+				stun.NewTransactionIDSetter([stun.TransactionIDSize]byte{
+					0x78, 0xad, 0x34, 0x33, 0xc6, 0xad, 0x72, 0xc0, 0x29, 0xda, 0x41, 0x2e,
+				}),
+				stun.BindingRequest,
+				stun.NewUsername("マトリックス"),
+				stun.NewNonce("f//499k954d6OL34oL9FSTvy64sA"),
+				stun.NewRealm("example.org"),
+				// SASLprep("The\u00adM\u00aarIX")
+				stun.NewLongTermIntegrity("マトリックス", "example.org", "TheMatrIX"),
+			},
+			want: "000100602112a44278ad3433c6ad72c029da412e" +
+				"00060012e3839ee38388e383aae38383e382afe382b90000" +
+				"0015001c662f2f3439396b39353464364f4c33346f4c39465354767936347341" +
+				"0014000b6578616d706c652e6f726700" +
+				"00080014f67024656dd64a3e02b8e0712e85c9a28ca89666",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			want, err := hex.DecodeString(tc.want)
+			assert.NoError(t, err)
+			msg, err := stun.Build(tc.setters...)
+			assert.NoError(t, err)
+
+			// Comparing hex dumps shows the differing bytes on failure
+			assert.Equal(t, hex.Dump(want), hex.Dump(msg.Raw), "encoding differs from RFC 5769")
+		})
+	}
+}
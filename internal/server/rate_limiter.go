@@ -0,0 +1,140 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package server
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4/internal/proto"
+)
+
+// Handler processes a single incoming datagram, like HandleRequest.
+type Handler func(Request) error
+
+// RateLimiter limits the STUN requests of each source IP with a token bucket.
+// A bucket holds up to burst tokens and refills at rate tokens per second,
+// each request takes one token. It is safe for concurrent use.
+type RateLimiter struct {
+	rate      float64
+	burst     float64
+	now       func() time.Time
+	mutex     sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates a RateLimiter allowing rate requests per second and
+// bursts of up to burst requests from each source IP. rate must be positive.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		now:     time.Now,
+		buckets: map[string]*tokenBucket{},
+	}
+}
+
+// Allow takes a token from the bucket of the IP of src, and reports whether
+// there was one.
+func (l *RateLimiter) Allow(src net.Addr) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	key := sourceIP(src)
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = bucket
+	}
+
+	bucket.tokens = min(l.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate)
+	bucket.last = now
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+
+	return true
+}
+
+// sweep drops the buckets that have refilled completely, as a new bucket is
+// the same, at most once per refill time.
+func (l *RateLimiter) sweep(now time.Time) {
+	refill := time.Duration(l.burst / l.rate * float64(time.Second))
+	if now.Sub(l.lastSweep) < max(refill, time.Second) {
+		return
+	}
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.last) >= refill {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// RateLimit returns a Handler passing requests to next while their source IP
+// is within the limit. Requests over the limit are answered with 486
+// Allocation Quota Reached, RFC 5766 Section 6.2, without calling next.
+// ChannelData, indications and retransmits answered by the TransactionCache
+// of the request are not limited.
+func (l *RateLimiter) RateLimit(next Handler) Handler {
+	return func(req Request) error {
+		if proto.IsChannelData(req.Buff) || !stun.IsMessage(req.Buff) {
+			return next(req)
+		}
+		// Only the header is needed, so the message is not decoded
+		var msgType stun.MessageType
+		msgType.ReadValue(binary.BigEndian.Uint16(req.Buff[0:2]))
+		if msgType.Class != stun.ClassRequest {
+			return next(req)
+		}
+		var transactionID [stun.TransactionIDSize]byte
+		copy(transactionID[:], req.Buff[8:20])
+
+		// A retransmit must get the cached response, RFC 5389 Section 7.3.1
+		if req.TransactionCache != nil {
+			if _, ok := req.TransactionCache.Get(req.SrcAddr, transactionID); ok {
+				return next(req)
+			}
+		}
+		if l.Allow(req.SrcAddr) {
+			return next(req)
+		}
+
+		err := fmt.Errorf("%w: %v from %v", errRateLimited, msgType, req.SrcAddr)
+
+		return buildAndSendErr(req.Conn, req.SrcAddr, err, buildMsg(transactionID,
+			stun.NewType(msgType.Method, stun.ClassErrorResponse),
+			&stun.ErrorCodeAttribute{Code: stun.CodeAllocQuotaReached},
+		)...)
+	}
+}
+
+// sourceIP returns the IP of addr, or addr itself if it has no IP.
+func sourceIP(addr net.Addr) string {
+	switch addr := addr.(type) {
+	case *net.UDPAddr:
+		return addr.IP.String()
+	case *net.TCPAddr:
+		return addr.IP.String()
+	}
+	if host, _, err := net.SplitHostPort(addr.String()); err == nil {
+		return host
+	}
+
+	return addr.String()
+}
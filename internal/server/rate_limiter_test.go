@@ -0,0 +1,157 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package server
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4/internal/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	src := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5000}
+
+	t.Run("Within limit", func(t *testing.T) {
+		limiter := NewRateLimiter(1, 3)
+		for i := 0; i < 3; i++ {
+			assert.True(t, limiter.Allow(src))
+		}
+		assert.False(t, limiter.Allow(src))
+
+		// Buckets are per IP, not per port
+		assert.False(t, limiter.Allow(&net.UDPAddr{IP: src.IP, Port: 5001}))
+		assert.True(t, limiter.Allow(&net.TCPAddr{IP: net.IPv4(127, 0, 0, 2), Port: 5000}))
+	})
+
+	t.Run("Refill", func(t *testing.T) {
+		now := time.Unix(1000, 0)
+		limiter := NewRateLimiter(2, 2)
+		limiter.now = func() time.Time { return now }
+
+		assert.True(t, limiter.Allow(src))
+		assert.True(t, limiter.Allow(src))
+		assert.False(t, limiter.Allow(src))
+
+		now = now.Add(500 * time.Millisecond)
+		assert.True(t, limiter.Allow(src))
+		assert.False(t, limiter.Allow(src))
+
+		// A long pause refills the bucket up to burst
+		now = now.Add(time.Hour)
+		assert.True(t, limiter.Allow(src))
+		assert.True(t, limiter.Allow(src))
+		assert.False(t, limiter.Allow(src))
+
+		// Refilled buckets are dropped
+		now = now.Add(time.Hour)
+		limiter.Allow(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 2), Port: 5000})
+		assert.Len(t, limiter.buckets, 1)
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		now := time.Unix(1000, 0)
+		limiter := NewRateLimiter(1, 50)
+		limiter.now = func() time.Time { return now }
+
+		var allowed atomic.Int32
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 10; j++ {
+					if limiter.Allow(src) {
+						allowed.Add(1)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, int32(50), allowed.Load())
+	})
+
+	t.Run("RateLimit", func(t *testing.T) {
+		serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		assert.NoError(t, err)
+		defer serverConn.Close() //nolint:errcheck
+
+		clientConn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		assert.NoError(t, err)
+		defer clientConn.Close() //nolint:errcheck
+
+		var handled int
+		handler := NewRateLimiter(1, 1).RateLimit(func(Request) error {
+			handled++
+
+			return nil
+		})
+		req := Request{
+			Conn:    serverConn,
+			SrcAddr: clientConn.LocalAddr(),
+			Log:     logging.NewDefaultLoggerFactory().NewLogger("turn"),
+		}
+		newRequest := func(class stun.MessageClass) []byte {
+			return stun.MustBuild(stun.TransactionID, stun.NewType(stun.MethodAllocate, class)).Raw
+		}
+
+		req.Buff = newRequest(stun.ClassRequest)
+		assert.NoError(t, handler(req))
+		assert.Equal(t, 1, handled)
+
+		req.Buff = newRequest(stun.ClassRequest)
+		assert.ErrorIs(t, handler(req), errRateLimited)
+		assert.Equal(t, 1, handled)
+
+		buf := make([]byte, 1500)
+		assert.NoError(t, clientConn.SetReadDeadline(time.Now().Add(time.Second)))
+		n, _, err := clientConn.ReadFrom(buf)
+		assert.NoError(t, err)
+		res := &stun.Message{Raw: buf[:n]}
+		assert.NoError(t, res.Decode())
+		assert.Equal(t, stun.NewType(stun.MethodAllocate, stun.ClassErrorResponse), res.Type)
+		var code stun.ErrorCodeAttribute
+		assert.NoError(t, code.GetFrom(res))
+		assert.Equal(t, stun.CodeAllocQuotaReached, code.Code)
+
+		// Indications and ChannelData are passed on
+		req.Buff = newRequest(stun.ClassIndication)
+		assert.NoError(t, handler(req))
+		channelData := &proto.ChannelData{Number: proto.MinChannelNumber, Data: []byte("data")}
+		channelData.Encode()
+		req.Buff = channelData.Raw
+		assert.NoError(t, handler(req))
+		assert.Equal(t, 3, handled)
+	})
+
+	t.Run("Cached retransmit", func(t *testing.T) {
+		var handled int
+		handler := NewRateLimiter(1, 1).RateLimit(func(Request) error {
+			handled++
+
+			return nil
+		})
+		src := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5000}
+		req := Request{SrcAddr: src, TransactionCache: NewTransactionCache(time.Minute)}
+
+		msg := stun.MustBuild(stun.TransactionID, stun.NewType(stun.MethodAllocate, stun.ClassRequest))
+		req.Buff = msg.Raw
+		assert.NoError(t, handler(req))
+		req.TransactionCache.Set(src, msg.TransactionID, []byte("response"))
+
+		// The retransmit is passed on to be answered from the cache, although
+		// the bucket is empty
+		assert.NoError(t, handler(req))
+		assert.Equal(t, 2, handled)
+	})
+}
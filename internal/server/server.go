@@ -35,6 +35,9 @@ type Request struct {
 	Log                logging.LeveledLogger
 	Realm              string
 	ChannelBindTimeout time.Duration
+
+	// TransactionCache answers retransmitted requests, nil disables it.
+	TransactionCache *TransactionCache
 }
 
 // HandleRequest processes the give Request.
@@ -71,6 +74,21 @@ func handleTURNPacket(req Request) error {
 		return fmt.Errorf("%w: %v", errFailedToCreateSTUNPacket, err)
 	}
 
+	if req.TransactionCache != nil && stunMsg.Type.Class == stun.ClassRequest {
+		if raw, ok := req.TransactionCache.Get(req.SrcAddr, stunMsg.TransactionID); ok {
+			req.Log.Debugf("Resending cached response to retransmitted %s from %s", stunMsg.Type, req.SrcAddr)
+			_, err := req.Conn.WriteTo(raw, req.SrcAddr)
+
+			return err
+		}
+		req.Conn = &cachingConn{
+			PacketConn:    req.Conn,
+			cache:         req.TransactionCache,
+			src:           req.SrcAddr,
+			transactionID: stunMsg.TransactionID,
+		}
+	}
+
 	handler, err := getMessageHandler(stunMsg.Type.Class, stunMsg.Type.Method)
 	if err != nil {
 		// nolint:errorlint
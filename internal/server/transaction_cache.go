@@ -0,0 +1,105 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package server
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pion/stun/v3"
+)
+
+// TransactionCache remembers the responses sent to STUN requests, so that a
+// retransmitted request is answered with the same response instead of being
+// processed again. RFC 5389 Section 7.3.1.
+type TransactionCache struct {
+	ttl       time.Duration
+	now       func() time.Time
+	mutex     sync.Mutex
+	entries   map[transactionKey]cachedResponse
+	lastSweep time.Time
+}
+
+type transactionKey struct {
+	src string
+	id  [stun.TransactionIDSize]byte
+}
+
+type cachedResponse struct {
+	raw    []byte
+	expiry time.Time
+}
+
+// NewTransactionCache creates a TransactionCache keeping responses for ttl.
+func NewTransactionCache(ttl time.Duration) *TransactionCache {
+	return &TransactionCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: map[transactionKey]cachedResponse{},
+	}
+}
+
+// Get returns the response sent to the request with transactionID from src,
+// if it is still cached.
+func (c *TransactionCache) Get(src net.Addr, transactionID [stun.TransactionIDSize]byte) ([]byte, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, ok := c.entries[transactionKey{src: src.String(), id: transactionID}]
+	if !ok || !c.now().Before(entry.expiry) {
+		return nil, false
+	}
+
+	return entry.raw, true
+}
+
+// Set caches a copy of the response raw sent to the request with
+// transactionID from src. Expired responses are dropped at most once per ttl.
+func (c *TransactionCache) Set(src net.Addr, transactionID [stun.TransactionIDSize]byte, raw []byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := c.now()
+	if now.Sub(c.lastSweep) >= c.ttl {
+		for key, entry := range c.entries {
+			if !now.Before(entry.expiry) {
+				delete(c.entries, key)
+			}
+		}
+		c.lastSweep = now
+	}
+
+	c.entries[transactionKey{src: src.String(), id: transactionID}] = cachedResponse{
+		raw:    append([]byte(nil), raw...),
+		expiry: now.Add(c.ttl),
+	}
+}
+
+// cachingConn caches the response to a request written to its source.
+type cachingConn struct {
+	net.PacketConn
+	cache         *TransactionCache
+	src           net.Addr
+	transactionID [stun.TransactionIDSize]byte
+}
+
+func (c *cachingConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	n, err := c.PacketConn.WriteTo(b, addr)
+	if err == nil && addr.String() == c.src.String() {
+		c.cache.Set(c.src, c.transactionID, b)
+	}
+
+	return n, err
+}
+
+// unwrapConn returns the conn wrapped by a cachingConn, or conn itself. Conns
+// outliving the request, like that of an allocation, must not cache writes.
+func unwrapConn(conn net.PacketConn) net.PacketConn {
+	if caching, ok := conn.(*cachingConn); ok {
+		return caching.PacketConn
+	}
+
+	return conn
+}
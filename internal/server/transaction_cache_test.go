@@ -0,0 +1,154 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package server
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4/internal/allocation"
+	"github.com/pion/turn/v4/internal/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransactionCache(t *testing.T) {
+	src := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5000}
+	other := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5001}
+	id := [stun.TransactionIDSize]byte{1, 2, 3}
+
+	t.Run("Get and Set", func(t *testing.T) {
+		cache := NewTransactionCache(time.Minute)
+		_, ok := cache.Get(src, id)
+		assert.False(t, ok)
+
+		response := []byte("response")
+		cache.Set(src, id, response)
+		response[0] = 'R' // The cache keeps a copy
+
+		raw, ok := cache.Get(src, id)
+		assert.True(t, ok)
+		assert.Equal(t, []byte("response"), raw)
+
+		_, ok = cache.Get(other, id)
+		assert.False(t, ok, "transaction IDs are scoped to the source")
+		_, ok = cache.Get(src, [stun.TransactionIDSize]byte{4})
+		assert.False(t, ok)
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		now := time.Unix(1000, 0)
+		cache := NewTransactionCache(time.Minute)
+		cache.now = func() time.Time { return now }
+
+		cache.Set(src, id, []byte("response"))
+		now = now.Add(59 * time.Second)
+		_, ok := cache.Get(src, id)
+		assert.True(t, ok)
+
+		now = now.Add(time.Second)
+		_, ok = cache.Get(src, id)
+		assert.False(t, ok)
+
+		// Expired entries are dropped by the next Set
+		cache.Set(other, id, []byte("response"))
+		assert.Len(t, cache.entries, 1)
+	})
+
+	t.Run("Retransmitted request", func(t *testing.T) {
+		serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		assert.NoError(t, err)
+		defer serverConn.Close() //nolint:errcheck
+
+		clientConn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		assert.NoError(t, err)
+		defer clientConn.Close() //nolint:errcheck
+
+		logger := logging.NewDefaultLoggerFactory().NewLogger("turn")
+		allocationManager, err := allocation.NewManager(allocation.ManagerConfig{
+			AllocatePacketConn: func(network string, _ int) (net.PacketConn, net.Addr, error) {
+				conn, listenErr := net.ListenPacket(network, "127.0.0.1:0") // nolint: noctx
+				if listenErr != nil {
+					return nil, nil, listenErr
+				}
+
+				return conn, conn.LocalAddr(), nil
+			},
+			AllocateConn: func(string, int) (net.Conn, net.Addr, error) {
+				return nil, nil, nil
+			},
+			LeveledLogger: logger,
+		})
+		assert.NoError(t, err)
+		defer allocationManager.Close() //nolint:errcheck
+
+		nonceHash, err := NewShortNonceHash(0)
+		assert.NoError(t, err)
+		nonce, err := nonceHash.Generate()
+		assert.NoError(t, err)
+
+		var authenticated atomic.Int32
+		req := Request{
+			AllocationManager: allocationManager,
+			NonceHash:         nonceHash,
+			Conn:              serverConn,
+			SrcAddr:           clientConn.LocalAddr(),
+			Log:               logger,
+			AuthHandler: func(string, string, net.Addr) ([]byte, bool) {
+				authenticated.Add(1)
+
+				return []byte(nonce), true
+			},
+			TransactionCache: NewTransactionCache(time.Minute),
+		}
+		fiveTuple := &allocation.FiveTuple{SrcAddr: req.SrcAddr, DstAddr: serverConn.LocalAddr(), Protocol: allocation.UDP}
+		_, err = allocationManager.CreateAllocation(fiveTuple, serverConn, 0, time.Hour, "", "")
+		assert.NoError(t, err)
+
+		newRefresh := func() *stun.Message {
+			return stun.MustBuild(
+				stun.TransactionID,
+				stun.NewType(stun.MethodRefresh, stun.ClassRequest),
+				proto.Lifetime{Duration: 10 * time.Minute},
+				stun.Username(nonce),
+				stun.Realm(nonce),
+				stun.Nonce(nonce),
+				stun.MessageIntegrity(nonce),
+			)
+		}
+
+		readResponse := func() []byte {
+			buf := make([]byte, 1500)
+			assert.NoError(t, clientConn.SetReadDeadline(time.Now().Add(time.Second)))
+			n, _, err := clientConn.ReadFrom(buf)
+			assert.NoError(t, err)
+
+			return buf[:n]
+		}
+
+		req.Buff = newRefresh().Raw
+		assert.NoError(t, HandleRequest(req))
+		first := readResponse()
+		res := &stun.Message{Raw: first}
+		assert.NoError(t, res.Decode())
+		assert.Equal(t, stun.NewType(stun.MethodRefresh, stun.ClassSuccessResponse), res.Type)
+
+		// The retransmission gets the same response without being processed
+		assert.NoError(t, HandleRequest(req))
+		assert.Equal(t, first, readResponse())
+		assert.Equal(t, int32(1), authenticated.Load())
+
+		// A new transaction is processed
+		req.Buff = newRefresh().Raw
+		assert.NoError(t, HandleRequest(req))
+		readResponse()
+		assert.Equal(t, int32(2), authenticated.Load())
+	})
+}
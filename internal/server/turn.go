@@ -4,6 +4,7 @@
 package server
 
 import (
+	"errors"
 	"fmt"
 	"net"
 
@@ -80,17 +81,20 @@ func handleAllocateRequest(req Request, stunMsg *stun.Message) error { //nolint:
 	//    Request) error.  Otherwise, if the attribute is included but
 	//    specifies a protocol other that UDP/TCP, the server rejects the
 	//    request with a 442 (Unsupported Transport Protocol) error.
-	var requestedTransport proto.RequestedTransport
-	if err = requestedTransport.GetFrom(stunMsg); err != nil {
-		return buildAndSendErr(req.Conn, req.SrcAddr, err, badRequestMsg...)
-	} else if requestedTransport.Protocol != proto.ProtoUDP && requestedTransport.Protocol != proto.ProtoTCP {
+	transportAttr, ok := stunMsg.Attributes.Get(stun.AttrRequestedTransport)
+	if !ok {
+		return buildAndSendErr(req.Conn, req.SrcAddr, stun.ErrAttributeNotFound, badRequestMsg...)
+	}
+	if _, err = proto.ParseRequestedTransport(transportAttr); errors.Is(err, proto.ErrUnsupportedProtocol) {
 		msg := buildMsg(
 			stunMsg.TransactionID,
 			stun.NewType(stun.MethodAllocate, stun.ClassErrorResponse),
 			&stun.ErrorCodeAttribute{Code: stun.CodeUnsupportedTransProto},
 		)
 
-		return buildAndSendErr(req.Conn, req.SrcAddr, errUnsupportedTransportProtocol, msg...)
+		return buildAndSendErr(req.Conn, req.SrcAddr, err, msg...)
+	} else if err != nil {
+		return buildAndSendErr(req.Conn, req.SrcAddr, err, badRequestMsg...)
 	}
 
 	// 4. The request may contain a DONT-FRAGMENT attribute.  If it does,
@@ -172,7 +176,7 @@ func handleAllocateRequest(req Request, stunMsg *stun.Message) error { //nolint:
 	lifetimeDuration := allocationLifeTime(stunMsg)
 	alloc, err := req.AllocationManager.CreateAllocation(
 		fiveTuple,
-		req.Conn,
+		unwrapConn(req.Conn),
 		requestedPort,
 		lifetimeDuration,
 		usernameAttr.String(),
@@ -252,7 +256,14 @@ func handleRefreshRequest(req Request, stunMsg *stun.Message) error {
 		a := req.AllocationManager.GetAllocation(fiveTuple)
 
 		if a == nil {
-			return fmt.Errorf("%w %v:%v", errNoAllocationFound, req.SrcAddr, req.Conn.LocalAddr())
+			// The client may be resuming an allocation that expired, RFC 5766 Section 7.2
+			return buildAndSendErr(req.Conn, req.SrcAddr,
+				fmt.Errorf("%w %v:%v", errNoAllocationFound, req.SrcAddr, req.Conn.LocalAddr()),
+				buildMsg(stunMsg.TransactionID,
+					stun.NewType(stun.MethodRefresh, stun.ClassErrorResponse),
+					&stun.ErrorCodeAttribute{Code: stun.CodeAllocMismatch},
+					messageIntegrity,
+				)...)
 		}
 		a.Refresh(lifetimeDuration)
 	} else {
@@ -357,19 +368,7 @@ func handleSendIndication(req Request, stunMsg *stun.Message) error {
 		return err
 	}
 
-	msgDst := &net.UDPAddr{IP: peerAddress.IP, Port: peerAddress.Port}
-	if perm := alloc.GetPermission(msgDst); perm == nil {
-		return fmt.Errorf("%w: %v", errNoPermission, msgDst)
-	}
-
-	l, err := alloc.RelaySocket.WriteTo(dataAttr, msgDst)
-	if err != nil {
-		return fmt.Errorf("%w: %s", errFailedWriteSocket, err.Error())
-	} else if l != len(dataAttr) {
-		return fmt.Errorf("%w %d != %d (expected)", errShortWrite, l, len(dataAttr))
-	}
-
-	return err
+	return alloc.Relay(dataAttr, &net.UDPAddr{IP: peerAddress.IP, Port: peerAddress.Port})
 }
 
 func handleChannelBindRequest(req Request, stunMsg *stun.Message) error {
@@ -450,12 +449,5 @@ func handleChannelData(req Request, channelData *proto.ChannelData) error {
 		return fmt.Errorf("%w %x", errNoSuchChannelBind, uint16(channelData.Number))
 	}
 
-	l, err := alloc.RelaySocket.WriteTo(channelData.Data, channel.Peer)
-	if err != nil {
-		return fmt.Errorf("%w: %s", errFailedWriteSocket, err.Error())
-	} else if l != len(channelData.Data) {
-		return fmt.Errorf("%w %d != %d (expected)", errShortWrite, l, len(channelData.Data))
-	}
-
-	return nil
+	return alloc.Relay(channelData.Data, channel.Peer)
 }
@@ -107,3 +107,78 @@ func TestAllocationLifeTime(t *testing.T) {
 		assert.Nil(t, req.AllocationManager.GetAllocation(fiveTuple))
 	})
 }
+
+func TestAllocateRequestedTransport(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	assert.NoError(t, err)
+	defer conn.Close() //nolint:errcheck
+
+	clientConn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	assert.NoError(t, err)
+	defer clientConn.Close() //nolint:errcheck
+
+	logger := logging.NewDefaultLoggerFactory().NewLogger("turn")
+	allocationManager, err := allocation.NewManager(allocation.ManagerConfig{
+		AllocatePacketConn: func(string, int) (net.PacketConn, net.Addr, error) {
+			return nil, nil, nil
+		},
+		AllocateConn: func(string, int) (net.Conn, net.Addr, error) {
+			return nil, nil, nil
+		},
+		LeveledLogger: logger,
+	})
+	assert.NoError(t, err)
+
+	nonceHash, err := NewShortNonceHash(0)
+	assert.NoError(t, err)
+	nonce, err := nonceHash.Generate()
+	assert.NoError(t, err)
+	key := []byte("key")
+
+	req := Request{
+		AllocationManager: allocationManager,
+		NonceHash:         nonceHash,
+		Conn:              conn,
+		SrcAddr:           clientConn.LocalAddr(),
+		Log:               logger,
+		AuthHandler: func(string, string, net.Addr) ([]byte, bool) {
+			return key, true
+		},
+	}
+
+	for _, test := range []struct {
+		name      string
+		transport []byte
+		code      stun.ErrorCode
+		err       error
+	}{
+		{"Missing", nil, stun.CodeBadRequest, stun.ErrAttributeNotFound},
+		{"Malformed", []byte{byte(proto.ProtoUDP), 0, 0}, stun.CodeBadRequest, stun.ErrAttributeSizeInvalid},
+		{"Unsupported", []byte{254, 0, 0, 0}, stun.CodeUnsupportedTransProto, proto.ErrUnsupportedProtocol},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			setters := []stun.Setter{stun.TransactionID, stun.NewType(stun.MethodAllocate, stun.ClassRequest)}
+			if test.transport != nil {
+				setters = append(setters, stun.RawAttribute{Type: stun.AttrRequestedTransport, Value: test.transport})
+			}
+			m, err := stun.Build(append(setters,
+				stun.NewUsername("user"), stun.NewRealm("realm"), stun.NewNonce(nonce), stun.MessageIntegrity(key),
+			)...)
+			assert.NoError(t, err)
+
+			err = handleAllocateRequest(req, m)
+			assert.ErrorIs(t, err, test.err)
+
+			buf := make([]byte, 1500)
+			assert.NoError(t, clientConn.SetReadDeadline(time.Now().Add(time.Second)))
+			n, _, err := clientConn.ReadFrom(buf)
+			assert.NoError(t, err)
+			res := &stun.Message{Raw: buf[:n]}
+			assert.NoError(t, res.Decode())
+			assert.Equal(t, stun.NewType(stun.MethodAllocate, stun.ClassErrorResponse), res.Type)
+			var code stun.ErrorCodeAttribute
+			assert.NoError(t, code.GetFrom(res))
+			assert.Equal(t, test.code, code.Code)
+		})
+	}
+}
@@ -0,0 +1,114 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+// Package testutil implements helpers to test TURN servers and clients end
+// to end.
+package testutil
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"github.com/pion/turn/v4"
+)
+
+// EchoTestTimeout bounds how long RunEchoTest waits for the whole round trip.
+const EchoTestTimeout = 5 * time.Second
+
+var errEchoMismatch = errors.New("echoed data does not match the data sent")
+
+// RunEchoTest checks that the TURN server at turnAddr relays data: it
+// allocates a UDP relay, creates a permission for the relayed address
+// itself, sends a packet to it and waits for it to come back. Diagnostics,
+// including the round-trip time, are written to stdout.
+func RunEchoTest(ctx context.Context, turnAddr, username, password string) error {
+	return runEchoTest(ctx, os.Stdout, turnAddr, username, password)
+}
+
+func runEchoTest(ctx context.Context, out io.Writer, turnAddr, username, password string) error {
+	ctx, cancel := context.WithTimeout(ctx, EchoTestTimeout)
+	defer cancel()
+
+	report := func(format string, args ...any) {
+		_, _ = fmt.Fprintf(out, format+"\n", args...)
+	}
+
+	conn, err := net.ListenPacket("udp4", "0.0.0.0:0") // nolint: noctx
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	defer conn.Close() //nolint:errcheck
+
+	client, err := turn.NewClient(&turn.ClientConfig{
+		STUNServerAddr: turnAddr,
+		TURNServerAddr: turnAddr,
+		Conn:           conn,
+		Username:       username,
+		Password:       password,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create TURN client: %w", err)
+	}
+	defer client.Close()
+
+	if err = client.Listen(); err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	report("Testing TURN server %s (%s) from %s", turnAddr, client.TURNServerAddr(), conn.LocalAddr())
+
+	// Abort pending transactions once ctx is done
+	stop := context.AfterFunc(ctx, client.Close)
+	defer stop()
+
+	mappedAddr, err := client.SendBindingRequest()
+	if err != nil {
+		return fmt.Errorf("binding request failed: %w", err)
+	}
+	report("Mapped address: %s", mappedAddr)
+
+	relayConn, err := client.Allocate()
+	if err != nil {
+		return fmt.Errorf("allocation failed: %w", err)
+	}
+	defer relayConn.Close() //nolint:errcheck
+	report("Relayed address: %s", relayConn.LocalAddr())
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err = relayConn.SetDeadline(deadline); err != nil {
+			return err
+		}
+	}
+
+	payload := []byte(fmt.Sprintf("pion/turn echo test %d", time.Now().UnixNano()))
+	start := time.Now()
+	if _, err = relayConn.WriteTo(payload, relayConn.LocalAddr()); err != nil {
+		return fmt.Errorf("failed to send to the relayed address: %w", err)
+	}
+
+	buf := make([]byte, 1600)
+	for {
+		n, from, err := relayConn.ReadFrom(buf)
+		if err != nil {
+			return fmt.Errorf("no echo received: %w", err)
+		}
+		if from.String() != relayConn.LocalAddr().String() {
+			report("Ignoring %d bytes from %s", n, from)
+
+			continue
+		}
+		if !bytes.Equal(payload, buf[:n]) {
+			return errEchoMismatch
+		}
+
+		break
+	}
+	report("Echo received, RTT %s", time.Since(start))
+
+	return nil
+}
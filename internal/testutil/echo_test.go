@@ -0,0 +1,71 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package testutil
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+
+	"github.com/pion/turn/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startTURNServer(t *testing.T) string {
+	t.Helper()
+
+	serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	require.NoError(t, err)
+
+	server, err := turn.NewServer(turn.ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			return turn.GenerateAuthKey(username, realm, "pass"), username == "foo"
+		},
+		PacketConnConfigs: []turn.PacketConnConfig{
+			{
+				PacketConn: serverConn,
+				RelayAddressGenerator: &turn.RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "127.0.0.1",
+				},
+			},
+		},
+		Realm: "pion.ly",
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = server.Close() })
+
+	return serverConn.LocalAddr().String()
+}
+
+func TestRunEchoTest(t *testing.T) {
+	turnAddr := startTURNServer(t)
+
+	t.Run("Passes", func(t *testing.T) {
+		var out bytes.Buffer
+		require.NoError(t, runEchoTest(context.Background(), &out, turnAddr, "foo", "pass"))
+		assert.Contains(t, out.String(), "Mapped address: ")
+		assert.Contains(t, out.String(), "Relayed address: 127.0.0.1:")
+		assert.Contains(t, out.String(), "Echo received, RTT ")
+	})
+
+	t.Run("Wrong password", func(t *testing.T) {
+		var out bytes.Buffer
+		err := runEchoTest(context.Background(), &out, turnAddr, "foo", "wrong")
+		assert.ErrorContains(t, err, "allocation failed")
+		assert.NotContains(t, out.String(), "Echo received")
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		assert.Error(t, runEchoTest(ctx, &bytes.Buffer{}, turnAddr, "foo", "pass"))
+	})
+}
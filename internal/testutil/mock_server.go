@@ -0,0 +1,453 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package testutil
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4/internal/proto"
+)
+
+// EchoHandler returns what a peer answers to payload, or nil if it does not answer.
+type EchoHandler func(payload []byte, peer net.Addr) []byte
+
+// MockTURNServerConfig configures a MockTURNServer.
+type MockTURNServerConfig struct {
+	// RelayAddr returned in Allocate responses, 127.0.0.1:49152 by default.
+	// Allocations with EVEN-PORT get the even ports above it instead.
+	RelayAddr *net.UDPAddr
+
+	// Lifetime granted by Allocate and Refresh, 10 minutes by default.
+	Lifetime time.Duration
+
+	// Echo answers the data sent to peers. Nil echoes it unchanged.
+	Echo EchoHandler
+
+	// MaxAllocationsPerClient limits the allocations of a username. Zero
+	// means no limit.
+	MaxAllocationsPerClient int
+
+	// MaxTotalAllocations limits the allocations of all clients. Zero means
+	// no limit.
+	MaxTotalAllocations int
+
+	// ShortTermPassword makes the server expect short-term credentials with
+	// this password, RFC 5389 Section 10.1.2, instead of challenging for
+	// long-term ones. Requests without USERNAME and MESSAGE-INTEGRITY, or
+	// with REALM or NONCE, are rejected with 400, a wrong MESSAGE-INTEGRITY
+	// with 401. Binding requests need no credentials.
+	ShortTermPassword string
+}
+
+// MockTURNServer is a TURN server for tests of clients. It implements the
+// client side of RFC 5766 closely enough for real Allocate, Refresh,
+// CreatePermission, ChannelBind, Send indication and ChannelData exchanges,
+// but never relays anything: data sent to a permitted peer is passed to the
+// EchoHandler and its answer is delivered back as if the peer had sent it.
+// The long-term credentials of the client are challenged but not verified,
+// short-term ones are verified.
+// Allocations from several sources count towards the quotas, answered with
+// 486 Allocation Quota Reached once exceeded, but only the latest one relays
+// data.
+type MockTURNServer struct {
+	conn                    net.PacketConn
+	relayAddr               *net.UDPAddr
+	lifetime                time.Duration
+	echo                    EchoHandler
+	maxAllocationsPerClient int
+	maxTotalAllocations     int
+	shortTermPassword       string
+
+	mutex        sync.Mutex
+	client       net.Addr                       // Source of the latest allocation, nil if there is none
+	allocations  map[string]string              // Usernames by source of the allocation
+	nextEvenPort int                            // Relayed port of the next EVEN-PORT allocation
+	reservations map[string]int                 // Reserved ports by RESERVATION-TOKEN
+	perms        map[string]bool                // Permitted peer IPs
+	channels     map[uint16]*net.UDPAddr        // Bound peers by channel number
+	errors       map[stun.Method]stun.ErrorCode // Injected error codes
+	requests     map[stun.Method]int            // Received requests
+	closed       chan struct{}
+}
+
+// NewMockTURNServer starts a MockTURNServer listening on a local UDP port.
+func NewMockTURNServer(config MockTURNServerConfig) (*MockTURNServer, error) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	if err != nil {
+		return nil, err
+	}
+
+	server := &MockTURNServer{
+		conn:                    conn,
+		relayAddr:               config.RelayAddr,
+		lifetime:                config.Lifetime,
+		echo:                    config.Echo,
+		maxAllocationsPerClient: config.MaxAllocationsPerClient,
+		maxTotalAllocations:     config.MaxTotalAllocations,
+		shortTermPassword:       config.ShortTermPassword,
+		allocations:             map[string]string{},
+		reservations:            map[string]int{},
+		perms:                   map[string]bool{},
+		channels:                map[uint16]*net.UDPAddr{},
+		errors:                  map[stun.Method]stun.ErrorCode{},
+		requests:                map[stun.Method]int{},
+		closed:                  make(chan struct{}),
+	}
+	if server.relayAddr == nil {
+		server.relayAddr = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 49152}
+	}
+	server.nextEvenPort = (server.relayAddr.Port + 2) &^ 1
+	if server.lifetime == 0 {
+		server.lifetime = 10 * time.Minute
+	}
+	if server.echo == nil {
+		server.echo = func(payload []byte, _ net.Addr) []byte { return payload }
+	}
+
+	go server.serve()
+
+	return server, nil
+}
+
+// Addr returns the address the server listens on.
+func (s *MockTURNServer) Addr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// RelayAddr returns the relayed address handed out by Allocate.
+func (s *MockTURNServer) RelayAddr() net.Addr {
+	return s.relayAddr
+}
+
+// InjectError makes the server answer every following request with method
+// with an error response carrying code. Allocate requests without
+// credentials are still challenged first. A 401 or 438 response comes with a
+// new nonce. Zero stops injecting errors for method.
+func (s *MockTURNServer) InjectError(method stun.Method, code stun.ErrorCode) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if code == 0 {
+		delete(s.errors, method)
+	} else {
+		s.errors[method] = code
+	}
+}
+
+// Requests returns how many requests with method the server received.
+func (s *MockTURNServer) Requests(method stun.Method) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.requests[method]
+}
+
+// Close stops the server.
+func (s *MockTURNServer) Close() error {
+	err := s.conn.Close()
+	<-s.closed
+
+	return err
+}
+
+func (s *MockTURNServer) serve() {
+	defer close(s.closed)
+
+	buf := make([]byte, 1600)
+	for {
+		n, from, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		data := append([]byte(nil), buf[:n]...)
+
+		if proto.IsChannelData(data) {
+			s.handleChannelData(data)
+
+			continue
+		}
+
+		msg := new(stun.Message)
+		if _, err = msg.Write(data); err != nil {
+			continue
+		}
+		if msg.Type.Class == stun.ClassIndication {
+			s.handleSendIndication(msg)
+		} else if res := s.handleRequest(msg, from); res != nil {
+			_, _ = s.conn.WriteTo(res.Raw, from)
+		}
+	}
+}
+
+func (s *MockTURNServer) handleRequest(req *stun.Message, from net.Addr) *stun.Message {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.requests[req.Type.Method]++
+	if s.shortTermPassword != "" && req.Type.Method != stun.MethodBinding {
+		if code := s.checkShortTermCredentials(req); code != 0 {
+			return s.errorResponse(req, code)
+		}
+	} else if req.Type.Method == stun.MethodAllocate && !req.Contains(stun.AttrUsername) {
+		return s.errorResponse(req, stun.CodeUnauthorized)
+	}
+	if code, ok := s.errors[req.Type.Method]; ok {
+		return s.errorResponse(req, code)
+	}
+
+	switch req.Type.Method {
+	case stun.MethodBinding:
+		udpAddr, _ := from.(*net.UDPAddr)
+
+		return s.successResponse(req, &stun.XORMappedAddress{IP: udpAddr.IP, Port: udpAddr.Port})
+	case stun.MethodAllocate:
+		var username stun.Username
+		_ = username.GetFrom(req)
+		if _, ok := s.allocations[from.String()]; !ok && s.quotaReached(username.String()) {
+			return s.errorResponse(req, stun.CodeAllocQuotaReached)
+		}
+		relayedPort, token, code := s.relayedPort(req)
+		if code != 0 {
+			return s.errorResponse(req, code)
+		}
+		s.allocations[from.String()] = username.String()
+		s.client = from
+		udpAddr, _ := from.(*net.UDPAddr)
+
+		attrs := []stun.Setter{
+			&proto.RelayedAddress{IP: s.relayAddr.IP, Port: relayedPort},
+			&stun.XORMappedAddress{IP: udpAddr.IP, Port: udpAddr.Port},
+			proto.Lifetime{Duration: s.lifetime},
+		}
+		if token != nil {
+			attrs = append(attrs, token)
+		}
+
+		return s.successResponse(req, attrs...)
+	case stun.MethodRefresh:
+		var lifetime proto.Lifetime
+		if err := lifetime.GetFrom(req); err == nil && lifetime.Duration == 0 {
+			delete(s.allocations, from.String())
+			s.client = nil
+			s.perms = map[string]bool{}
+			s.channels = map[uint16]*net.UDPAddr{}
+
+			return s.successResponse(req, proto.Lifetime{})
+		}
+
+		return s.successResponse(req, proto.Lifetime{Duration: s.lifetime})
+	case stun.MethodCreatePermission:
+		peers := peerAddresses(req)
+		if len(peers) == 0 {
+			return s.errorResponse(req, stun.CodeBadRequest)
+		}
+		for _, peer := range peers {
+			s.perms[peer.IP.String()] = true
+		}
+
+		return s.successResponse(req)
+	case stun.MethodChannelBind:
+		var number proto.ChannelNumber
+		peers := peerAddresses(req)
+		if err := number.GetFrom(req); err != nil || len(peers) != 1 {
+			return s.errorResponse(req, stun.CodeBadRequest)
+		}
+		s.channels[uint16(number)] = &net.UDPAddr{IP: peers[0].IP, Port: peers[0].Port}
+		s.perms[peers[0].IP.String()] = true
+
+		return s.successResponse(req)
+	default:
+		return s.errorResponse(req, stun.CodeBadRequest)
+	}
+}
+
+// relayedPort picks the relayed port of an Allocate request, following
+// RFC 5766 Section 6.2, and the reservation token of the next port if req
+// asks for one. A non-zero code rejects the request.
+func (s *MockTURNServer) relayedPort(req *stun.Message) (int, proto.ReservationToken, stun.ErrorCode) {
+	if req.Contains(stun.AttrReservationToken) {
+		var token proto.ReservationToken
+		if req.Contains(stun.AttrEvenPort) || token.GetFrom(req) != nil {
+			return 0, nil, stun.CodeBadRequest
+		}
+		port, ok := s.reservations[string(token)]
+		if !ok {
+			return 0, nil, stun.CodeInsufficientCapacity
+		}
+		delete(s.reservations, string(token))
+
+		return port, nil, 0
+	}
+
+	if !req.Contains(stun.AttrEvenPort) {
+		return s.relayAddr.Port, nil, 0
+	}
+	var evenPort proto.EvenPort
+	if err := evenPort.GetFrom(req); err != nil {
+		return 0, nil, stun.CodeBadRequest
+	}
+	port := s.nextEvenPort
+	s.nextEvenPort += 2
+	if !evenPort.ReservePort {
+		return port, nil, 0
+	}
+
+	token := make(proto.ReservationToken, 8)
+	binary.BigEndian.PutUint64(token, uint64(port+1)) // nolint:gosec // G115
+	s.reservations[string(token)] = port + 1
+
+	return port, token, 0
+}
+
+// checkShortTermCredentials returns the error code req is rejected with
+// under short-term credentials, or zero if they are valid.
+func (s *MockTURNServer) checkShortTermCredentials(req *stun.Message) stun.ErrorCode {
+	if !req.Contains(stun.AttrUsername) || !req.Contains(stun.AttrMessageIntegrity) ||
+		req.Contains(stun.AttrRealm) || req.Contains(stun.AttrNonce) {
+		return stun.CodeBadRequest
+	}
+	if stun.NewShortTermIntegrity(s.shortTermPassword).Check(req) != nil {
+		return stun.CodeUnauthorized
+	}
+
+	return 0
+}
+
+// quotaReached reports whether a new allocation for username exceeds a quota.
+func (s *MockTURNServer) quotaReached(username string) bool {
+	if s.maxTotalAllocations > 0 && len(s.allocations) >= s.maxTotalAllocations {
+		return true
+	}
+	if s.maxAllocationsPerClient == 0 {
+		return false
+	}
+
+	count := 0
+	for _, owner := range s.allocations {
+		if owner == username {
+			count++
+		}
+	}
+
+	return count >= s.maxAllocationsPerClient
+}
+
+func (s *MockTURNServer) handleSendIndication(msg *stun.Message) {
+	var data proto.Data
+	var peer proto.PeerAddress
+	if msg.Type.Method != stun.MethodSend || data.GetFrom(msg) != nil || peer.GetFrom(msg) != nil {
+		return
+	}
+
+	s.relay(data, &net.UDPAddr{IP: peer.IP, Port: peer.Port})
+}
+
+func (s *MockTURNServer) handleChannelData(raw []byte) {
+	chData := &proto.ChannelData{Raw: raw}
+	if err := chData.Decode(); err != nil {
+		return
+	}
+
+	s.mutex.Lock()
+	peer, ok := s.channels[uint16(chData.Number)]
+	s.mutex.Unlock()
+	if ok {
+		s.relay(chData.Data, peer)
+	}
+}
+
+// relay passes data to the echo handler of peer and sends its answer to the
+// client, over a channel if one is bound to peer.
+func (s *MockTURNServer) relay(data []byte, peer *net.UDPAddr) {
+	s.mutex.Lock()
+	client := s.client
+	permitted := s.perms[peer.IP.String()]
+	s.mutex.Unlock()
+	if client == nil || !permitted {
+		return
+	}
+
+	answer := s.echo(data, peer)
+	if answer == nil {
+		return
+	}
+
+	if number, ok := s.channelOf(peer); ok {
+		chData := &proto.ChannelData{Data: answer, Number: proto.ChannelNumber(number)}
+		chData.Encode()
+		_, _ = s.conn.WriteTo(chData.Raw, client)
+
+		return
+	}
+
+	msg, err := stun.Build(
+		stun.TransactionID,
+		stun.NewType(stun.MethodData, stun.ClassIndication),
+		proto.Data(answer),
+		proto.PeerAddress{IP: peer.IP, Port: peer.Port},
+	)
+	if err == nil {
+		_, _ = s.conn.WriteTo(msg.Raw, client)
+	}
+}
+
+func (s *MockTURNServer) channelOf(peer net.Addr) (uint16, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for number, bound := range s.channels {
+		if bound.String() == peer.String() {
+			return number, true
+		}
+	}
+
+	return 0, false
+}
+
+func (s *MockTURNServer) successResponse(req *stun.Message, attrs ...stun.Setter) *stun.Message {
+	if s.shortTermPassword != "" && req.Type.Method != stun.MethodBinding {
+		attrs = append(attrs, stun.NewShortTermIntegrity(s.shortTermPassword))
+	}
+
+	return stun.MustBuild(append([]stun.Setter{
+		&stun.Message{TransactionID: req.TransactionID},
+		stun.NewType(req.Type.Method, stun.ClassSuccessResponse),
+	}, append(attrs, stun.Fingerprint)...)...)
+}
+
+func (s *MockTURNServer) errorResponse(req *stun.Message, code stun.ErrorCode) *stun.Message {
+	attrs := []stun.Setter{
+		&stun.Message{TransactionID: req.TransactionID},
+		stun.NewType(req.Type.Method, stun.ClassErrorResponse),
+		code,
+	}
+	if (code == stun.CodeUnauthorized || code == stun.CodeStaleNonce) && s.shortTermPassword == "" {
+		attrs = append(attrs, stun.NewNonce(time.Now().Format(time.RFC3339Nano)), stun.NewRealm("pion.ly"))
+	}
+
+	return stun.MustBuild(append(attrs, stun.Fingerprint)...)
+}
+
+// peerAddresses returns all XOR-PEER-ADDRESS attributes of msg.
+func peerAddresses(msg *stun.Message) []proto.PeerAddress {
+	peers := []proto.PeerAddress{}
+	for _, attr := range msg.Attributes {
+		if attr.Type != stun.AttrXORPeerAddress {
+			continue
+		}
+		single := &stun.Message{TransactionID: msg.TransactionID}
+		single.Add(attr.Type, attr.Value)
+
+		var peer proto.PeerAddress
+		if err := peer.GetFrom(single); err == nil {
+			peers = append(peers, peer)
+		}
+	}
+
+	return peers
+}
@@ -0,0 +1,230 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package testutil
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMockServerClient(
+	t *testing.T,
+	server *MockTURNServer,
+	username string,
+	opts ...turn.ClientOption,
+) *turn.Client {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	client, err := turn.NewClient(&turn.ClientConfig{
+		STUNServerAddr: server.Addr().String(),
+		TURNServerAddr: server.Addr().String(),
+		Conn:           conn,
+		Username:       username,
+		Password:       "pass",
+		RTO:            50 * time.Millisecond,
+	}, opts...)
+	require.NoError(t, err)
+	require.NoError(t, client.Listen())
+	t.Cleanup(client.Close)
+
+	return client
+}
+
+func TestMockTURNServer(t *testing.T) {
+	peer := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 5000}
+
+	t.Run("Echo", func(t *testing.T) {
+		server, err := NewMockTURNServer(MockTURNServerConfig{
+			Echo: func(payload []byte, _ net.Addr) []byte { return bytes.ToUpper(payload) },
+		})
+		require.NoError(t, err)
+		defer server.Close() //nolint:errcheck
+		client := newMockServerClient(t, server, "foo")
+
+		mappedAddr, err := client.SendBindingRequest()
+		require.NoError(t, err)
+		assert.NotNil(t, mappedAddr)
+
+		relayConn, err := client.Allocate()
+		require.NoError(t, err)
+		assert.Equal(t, server.RelayAddr().String(), relayConn.LocalAddr().String())
+
+		// The first answers come in Data indications, later ones over the channel
+		buf := make([]byte, 1500)
+		require.NoError(t, relayConn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		for i := 0; i < 10; i++ {
+			_, err = relayConn.WriteTo([]byte("hello"), peer)
+			require.NoError(t, err)
+
+			n, from, err := relayConn.ReadFrom(buf)
+			require.NoError(t, err)
+			assert.Equal(t, "HELLO", string(buf[:n]))
+			assert.Equal(t, peer.String(), from.String())
+
+			if i == 0 {
+				assert.Eventually(t, func() bool {
+					return server.Requests(stun.MethodChannelBind) == 1
+				}, time.Second, 5*time.Millisecond)
+			}
+		}
+		assert.Equal(t, 1, server.Requests(stun.MethodCreatePermission))
+
+		require.NoError(t, relayConn.Close())
+		assert.Eventually(t, func() bool {
+			return server.Requests(stun.MethodRefresh) == 1
+		}, time.Second, 5*time.Millisecond)
+	})
+
+	t.Run("Short-term credentials", func(t *testing.T) {
+		server, err := NewMockTURNServer(MockTURNServerConfig{ShortTermPassword: "pass"})
+		require.NoError(t, err)
+		defer server.Close() //nolint:errcheck
+
+		// Long-term credentials are a different choice at NewClient, the
+		// rejected anonymous Allocate carries no NONCE to authenticate with
+		_, err = newMockServerClient(t, server, "foo").Allocate()
+		assert.ErrorIs(t, err, stun.ErrAttributeNotFound)
+
+		client := newMockServerClient(t, server, "foo", turn.WithShortTermCredentials())
+		relayConn, err := client.Allocate()
+		require.NoError(t, err)
+		assert.Empty(t, client.Realm())
+
+		buf := make([]byte, 1500)
+		_, err = relayConn.WriteTo([]byte("hello"), peer)
+		require.NoError(t, err)
+		require.NoError(t, relayConn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		n, _, err := relayConn.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(buf[:n]))
+		assert.Eventually(t, func() bool {
+			return server.Requests(stun.MethodChannelBind) == 1
+		}, time.Second, 5*time.Millisecond)
+
+		require.NoError(t, relayConn.Close())
+		assert.Equal(t, 2, server.Requests(stun.MethodAllocate), "no challenge for short-term credentials")
+
+		// A wrong password gets 401, which is not retried with a nonce
+		other, err := NewMockTURNServer(MockTURNServerConfig{ShortTermPassword: "secret"})
+		require.NoError(t, err)
+		defer other.Close() //nolint:errcheck
+		_, err = newMockServerClient(t, other, "foo", turn.WithShortTermCredentials()).Allocate()
+		assert.ErrorContains(t, err, "401")
+		assert.Equal(t, 1, other.Requests(stun.MethodAllocate))
+	})
+
+	t.Run("Injected errors", func(t *testing.T) {
+		server, err := NewMockTURNServer(MockTURNServerConfig{})
+		require.NoError(t, err)
+		defer server.Close() //nolint:errcheck
+		client := newMockServerClient(t, server, "foo")
+
+		server.InjectError(stun.MethodAllocate, stun.CodeInsufficientCapacity)
+		_, err = client.Allocate()
+		assert.ErrorContains(t, err, "508")
+
+		server.InjectError(stun.MethodAllocate, 0)
+		relayConn, err := client.Allocate()
+		require.NoError(t, err)
+		defer relayConn.Close() //nolint:errcheck
+
+		server.InjectError(stun.MethodCreatePermission, stun.CodeForbidden)
+		_, err = relayConn.WriteTo([]byte("hello"), peer)
+		assert.ErrorContains(t, err, "403")
+	})
+
+	t.Run("Quota per client", func(t *testing.T) {
+		server, err := NewMockTURNServer(MockTURNServerConfig{MaxAllocationsPerClient: 1})
+		require.NoError(t, err)
+		defer server.Close() //nolint:errcheck
+
+		relayConn, err := newMockServerClient(t, server, "foo").Allocate()
+		require.NoError(t, err)
+
+		_, err = newMockServerClient(t, server, "foo").Allocate()
+		assert.ErrorIs(t, err, turn.ErrAllocationQuotaReached)
+		assert.ErrorContains(t, err, "486")
+
+		// Other users have their own quota
+		other, err := newMockServerClient(t, server, "bar").Allocate()
+		require.NoError(t, err)
+		defer other.Close() //nolint:errcheck
+
+		// A released allocation no longer counts
+		require.NoError(t, relayConn.Close())
+		assert.Eventually(t, func() bool {
+			return server.Requests(stun.MethodRefresh) == 1
+		}, time.Second, 5*time.Millisecond)
+		relayConn, err = newMockServerClient(t, server, "foo").Allocate()
+		require.NoError(t, err)
+		defer relayConn.Close() //nolint:errcheck
+	})
+
+	t.Run("Total quota", func(t *testing.T) {
+		server, err := NewMockTURNServer(MockTURNServerConfig{MaxTotalAllocations: 2})
+		require.NoError(t, err)
+		defer server.Close() //nolint:errcheck
+
+		for _, username := range []string{"foo", "bar"} {
+			relayConn, err := newMockServerClient(t, server, username).Allocate()
+			require.NoError(t, err)
+			defer relayConn.Close() //nolint:errcheck
+		}
+
+		_, err = newMockServerClient(t, server, "baz").Allocate()
+		assert.ErrorIs(t, err, turn.ErrAllocationQuotaReached)
+	})
+
+	t.Run("Even port", func(t *testing.T) {
+		server, err := NewMockTURNServer(MockTURNServerConfig{})
+		require.NoError(t, err)
+		defer server.Close() //nolint:errcheck
+
+		rtpConn, token, err := newMockServerClient(t, server, "foo").AllocateEvenPort(context.Background(), true)
+		require.NoError(t, err)
+		defer rtpConn.Close() //nolint:errcheck
+		assert.Len(t, token, 8)
+
+		rtcpConn, err := newMockServerClient(t, server, "foo").AllocateWithToken(context.Background(), token)
+		require.NoError(t, err)
+		defer rtcpConn.Close() //nolint:errcheck
+
+		rtpAddr, ok := rtpConn.LocalAddr().(*net.UDPAddr)
+		require.True(t, ok)
+		rtcpAddr, ok := rtcpConn.LocalAddr().(*net.UDPAddr)
+		require.True(t, ok)
+		assert.Zero(t, rtpAddr.Port%2)
+		assert.Equal(t, rtpAddr.Port+1, rtcpAddr.Port)
+		assert.True(t, rtpAddr.IP.Equal(rtcpAddr.IP))
+
+		// A token is only good for one allocation
+		_, err = newMockServerClient(t, server, "foo").AllocateWithToken(context.Background(), token)
+		assert.ErrorContains(t, err, "508")
+
+		// Without a reservation there is no token
+		conn, token, err := newMockServerClient(t, server, "foo").AllocateEvenPort(context.Background(), false)
+		require.NoError(t, err)
+		defer conn.Close() //nolint:errcheck
+		assert.Nil(t, token)
+		addr, ok := conn.LocalAddr().(*net.UDPAddr)
+		require.True(t, ok)
+		assert.Zero(t, addr.Port%2)
+		assert.NotEqual(t, rtpAddr.Port, addr.Port)
+	})
+}
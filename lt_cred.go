@@ -4,15 +4,13 @@
 package turn
 
 import (
-	"crypto/hmac"
-	"crypto/sha1" //nolint:gosec,gci
-	"encoding/base64"
 	"net"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/pion/logging"
+	"github.com/pion/turn/v4/credentials"
 )
 
 // GenerateLongTermCredentials can be used to create credentials valid for [duration] time.
@@ -25,6 +23,7 @@ func GenerateLongTermCredentials(sharedSecret string, duration time.Duration) (s
 }
 
 // GenerateLongTermTURNRESTCredentials can be used to create credentials valid for [duration] time.
+// See also credentials.GenerateToken.
 func GenerateLongTermTURNRESTCredentials(sharedSecret string, user string, duration time.Duration) (
 	string,
 	string,
@@ -39,14 +38,7 @@ func GenerateLongTermTURNRESTCredentials(sharedSecret string, user string, durat
 }
 
 func longTermCredentials(username string, sharedSecret string) (string, error) {
-	mac := hmac.New(sha1.New, []byte(sharedSecret))
-	_, err := mac.Write([]byte(username))
-	if err != nil {
-		return "", err // Not sure if this will ever happen
-	}
-	password := mac.Sum(nil)
-
-	return base64.StdEncoding.EncodeToString(password), nil
+	return credentials.Password(sharedSecret, username), nil
 }
 
 // NewLongTermAuthHandler returns a turn.AuthAuthHandler used with Long Term (or Time Windowed) Credentials.
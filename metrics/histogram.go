@@ -0,0 +1,149 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errInvalidBuckets = errors.New("metrics: histogram buckets must be positive and increasing")
+
+// TransactionDuration is the name of the histogram of STUN transaction wait
+// times recorded by turn.WithTransactionHistogram.
+const TransactionDuration = namespace + "transaction_duration_seconds"
+
+// DefaultTransactionBuckets are the upper bounds of the buckets used by
+// NewHistogram if none are given. They span a single round trip on a LAN
+// up to the full retransmission schedule of RFC 5389.
+var DefaultTransactionBuckets = []time.Duration{ //nolint:gochecknoglobals
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+	40 * time.Second,
+}
+
+// Histogram counts durations in buckets, like a Prometheus histogram. It is
+// safe for concurrent use.
+type Histogram struct {
+	name    string
+	help    string
+	bounds  []time.Duration // Read-only, increasing upper bounds
+	mutex   sync.Mutex
+	counts  []uint64 // Protected by mutex, per bucket, the last one is +Inf
+	sum     time.Duration
+	samples uint64
+}
+
+// Bucket is the number of observations up to and including UpperBound.
+type Bucket struct {
+	UpperBound time.Duration
+	Count      uint64
+}
+
+// HistogramSnapshot is the state of a Histogram at one point in time. The
+// bucket counts are cumulative, observations above the last bound are only
+// part of Count.
+type HistogramSnapshot struct {
+	Buckets []Bucket
+	Count   uint64
+	Sum     time.Duration
+}
+
+// NewHistogram creates a Histogram reported as name with help. bounds are
+// the upper bounds of its buckets, DefaultTransactionBuckets if empty.
+func NewHistogram(name, help string, bounds []time.Duration) (*Histogram, error) {
+	if len(bounds) == 0 {
+		bounds = DefaultTransactionBuckets
+	}
+	for i, bound := range bounds {
+		if bound <= 0 || (i > 0 && bound <= bounds[i-1]) {
+			return nil, fmt.Errorf("%w: %v", errInvalidBuckets, bounds)
+		}
+	}
+
+	return &Histogram{
+		name:   name,
+		help:   help,
+		bounds: append([]time.Duration(nil), bounds...),
+		counts: make([]uint64, len(bounds)+1),
+	}, nil
+}
+
+// Observe records d.
+func (h *Histogram) Observe(d time.Duration) {
+	i := 0
+	for i < len(h.bounds) && d > h.bounds[i] {
+		i++
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.counts[i]++
+	h.sum += d
+	h.samples++
+}
+
+// Snapshot returns the current bucket counts.
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	snapshot := HistogramSnapshot{
+		Buckets: make([]Bucket, len(h.bounds)),
+		Count:   h.samples,
+		Sum:     h.sum,
+	}
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		snapshot.Buckets[i] = Bucket{UpperBound: bound, Count: cumulative}
+	}
+
+	return snapshot
+}
+
+// HTTPHandler returns a handler serving the histogram in the Prometheus
+// text exposition format, with durations in seconds.
+func (h *Histogram) HTTPHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = w.Write([]byte(h.String()))
+	})
+}
+
+// String returns the histogram in the Prometheus text exposition format.
+func (h *Histogram) String() string {
+	snapshot := h.Snapshot()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# HELP %s %s\n", h.name, h.help)
+	fmt.Fprintf(&b, "# TYPE %s histogram\n", h.name)
+	for _, bucket := range snapshot.Buckets {
+		fmt.Fprintf(&b, "%s_bucket{le=\"%s\"} %d\n", h.name, formatSeconds(bucket.UpperBound), bucket.Count)
+	}
+	fmt.Fprintf(&b, "%s_bucket{le=\"+Inf\"} %d\n", h.name, snapshot.Count)
+	fmt.Fprintf(&b, "%s_sum %s\n", h.name, formatSeconds(snapshot.Sum))
+	fmt.Fprintf(&b, "%s_count %d\n", h.name, snapshot.Count)
+
+	return b.String()
+}
+
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'g', -1, 64)
+}
@@ -0,0 +1,98 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogram(t *testing.T) {
+	t.Run("Buckets", func(t *testing.T) {
+		h, err := NewHistogram("test_seconds", "Test durations.", []time.Duration{
+			10 * time.Millisecond, 100 * time.Millisecond, time.Second,
+		})
+		assert.NoError(t, err)
+
+		for _, d := range []time.Duration{
+			time.Millisecond, 10 * time.Millisecond, // Bounds are inclusive
+			50 * time.Millisecond,
+			500 * time.Millisecond, time.Second,
+			2 * time.Second,
+		} {
+			h.Observe(d)
+		}
+
+		assert.Equal(t, HistogramSnapshot{
+			Buckets: []Bucket{
+				{UpperBound: 10 * time.Millisecond, Count: 2},
+				{UpperBound: 100 * time.Millisecond, Count: 3},
+				{UpperBound: time.Second, Count: 5},
+			},
+			Count: 6,
+			Sum:   3561 * time.Millisecond,
+		}, h.Snapshot())
+	})
+
+	t.Run("HTTPHandler", func(t *testing.T) {
+		h, err := NewHistogram(TransactionDuration, "STUN transaction wait times.", []time.Duration{
+			25 * time.Millisecond, time.Second,
+		})
+		assert.NoError(t, err)
+		h.Observe(20 * time.Millisecond)
+		h.Observe(1500 * time.Millisecond)
+
+		rec := httptest.NewRecorder()
+		h.HTTPHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+		assert.Equal(t, `# HELP pion_turn_client_transaction_duration_seconds STUN transaction wait times.
+# TYPE pion_turn_client_transaction_duration_seconds histogram
+pion_turn_client_transaction_duration_seconds_bucket{le="0.025"} 1
+pion_turn_client_transaction_duration_seconds_bucket{le="1"} 1
+pion_turn_client_transaction_duration_seconds_bucket{le="+Inf"} 2
+pion_turn_client_transaction_duration_seconds_sum 1.52
+pion_turn_client_transaction_duration_seconds_count 2
+`, rec.Body.String())
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		h, err := NewHistogram("test_seconds", "Test durations.", nil)
+		assert.NoError(t, err)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					h.Observe(time.Duration(j) * time.Millisecond)
+					_ = h.Snapshot()
+				}
+			}()
+		}
+		wg.Wait()
+
+		snapshot := h.Snapshot()
+		assert.Equal(t, uint64(800), snapshot.Count)
+		assert.Len(t, snapshot.Buckets, len(DefaultTransactionBuckets))
+		assert.Equal(t, uint64(800), snapshot.Buckets[len(snapshot.Buckets)-1].Count)
+	})
+
+	t.Run("Invalid buckets", func(t *testing.T) {
+		for _, bounds := range [][]time.Duration{
+			{0},
+			{time.Second, time.Second},
+			{time.Second, time.Millisecond},
+		} {
+			_, err := NewHistogram("test_seconds", "Test durations.", bounds)
+			assert.ErrorIs(t, err, errInvalidBuckets)
+		}
+	})
+}
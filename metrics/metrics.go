@@ -0,0 +1,177 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+// Package metrics reports the state of TURN client allocations in a form
+// that maps directly onto Prometheus collectors, without depending on the
+// Prometheus client library.
+package metrics
+
+import (
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/pion/turn/v4/internal/client"
+)
+
+var errNoStats = errors.New("metrics: conn does not report stats")
+
+// Kind is the type of a metric.
+type Kind int
+
+const (
+	// Counter is a metric that only goes up.
+	Counter Kind = iota
+	// Gauge is a metric that can go up and down.
+	Gauge
+)
+
+// Desc describes a metric. Its label values are taken from a fixed set, so
+// the number of series per metric is bounded regardless of the peers in use.
+type Desc struct {
+	Name   string
+	Help   string
+	Kind   Kind
+	Labels []string
+}
+
+// Sample is the value of a metric for one set of label values.
+type Sample struct {
+	Desc        *Desc
+	LabelValues []string
+	Value       float64
+}
+
+const namespace = "pion_turn_client_"
+
+var (
+	// ActiveBindings is the number of channel bindings by state.
+	ActiveBindings = &Desc{
+		Name:   namespace + "active_bindings",
+		Help:   "Number of channel bindings by state.",
+		Kind:   Gauge,
+		Labels: []string{"state"},
+	}
+	// ActivePermissions is the number of granted permissions.
+	ActivePermissions = &Desc{
+		Name: namespace + "active_permissions",
+		Help: "Number of granted permissions.",
+		Kind: Gauge,
+	}
+	// BytesSent is the number of payload bytes written to peers.
+	BytesSent = &Desc{
+		Name: namespace + "bytes_sent_total",
+		Help: "Payload bytes written to peers.",
+		Kind: Counter,
+	}
+	// BytesReceived is the number of payload bytes read from peers.
+	BytesReceived = &Desc{
+		Name: namespace + "bytes_received_total",
+		Help: "Payload bytes read from peers.",
+		Kind: Counter,
+	}
+	// BindingRefreshErrors is the number of failed ChannelBind attempts.
+	BindingRefreshErrors = &Desc{
+		Name: namespace + "binding_refresh_errors_total",
+		Help: "Failed ChannelBind attempts.",
+		Kind: Counter,
+	}
+
+	descs = []*Desc{ActiveBindings, ActivePermissions, BytesSent, BytesReceived, BindingRefreshErrors}
+)
+
+type statsConn interface {
+	Stats() client.Stats
+}
+
+// Collector sums the stats of a set of relayed conns returned by
+// turn.Client.Allocate. Stats are read from the conns on every Collect, so
+// the collector keeps no state of its own besides the counters of conns
+// already removed, which keeps the counters monotonic.
+type Collector struct {
+	conns   map[net.PacketConn]statsConn
+	retired client.Stats // Counters of removed conns
+	mutex   sync.Mutex
+}
+
+// NewCollector creates a Collector with no conns.
+func NewCollector() *Collector {
+	return &Collector{conns: map[net.PacketConn]statsConn{}}
+}
+
+// Add starts collecting the stats of conn. Only UDP allocations report stats.
+func (c *Collector) Add(conn net.PacketConn) error {
+	stats, ok := conn.(statsConn)
+	if !ok {
+		return errNoStats
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.conns[conn] = stats
+
+	return nil
+}
+
+// Remove stops collecting the stats of conn, typically once it is closed.
+// Its traffic and error counters remain part of the totals.
+func (c *Collector) Remove(conn net.PacketConn) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	stats, ok := c.conns[conn]
+	if !ok {
+		return
+	}
+	delete(c.conns, conn)
+
+	final := stats.Stats()
+	c.retired.BytesSent += final.BytesSent
+	c.retired.BytesReceived += final.BytesReceived
+	c.retired.BindingErrors += final.BindingErrors
+}
+
+// Describe sends the descriptions of all metrics reported by Collect.
+func (c *Collector) Describe(ch chan<- *Desc) {
+	for _, desc := range descs {
+		ch <- desc
+	}
+}
+
+// Collect sends the current value of every metric.
+func (c *Collector) Collect(ch chan<- Sample) {
+	c.mutex.Lock()
+	total := c.retired
+	for _, conn := range c.conns {
+		stats := conn.Stats()
+		total.BytesSent += stats.BytesSent
+		total.BytesReceived += stats.BytesReceived
+		total.BindingErrors += stats.BindingErrors
+		total.Permissions += stats.Permissions
+		total.Bindings.Idle += stats.Bindings.Idle
+		total.Bindings.Request += stats.Bindings.Request
+		total.Bindings.Ready += stats.Bindings.Ready
+		total.Bindings.Refresh += stats.Bindings.Refresh
+		total.Bindings.Failed += stats.Bindings.Failed
+	}
+	c.mutex.Unlock()
+
+	bindings := []struct {
+		state string
+		count uint64
+	}{
+		{"idle", total.Bindings.Idle},
+		{"request", total.Bindings.Request},
+		{"ready", total.Bindings.Ready},
+		{"refresh", total.Bindings.Refresh},
+		{"failed", total.Bindings.Failed},
+	}
+	for _, b := range bindings {
+		ch <- Sample{Desc: ActiveBindings, LabelValues: []string{b.state}, Value: float64(b.count)}
+	}
+	ch <- Sample{Desc: ActivePermissions, Value: float64(total.Permissions)}
+	ch <- Sample{Desc: BytesSent, Value: float64(total.BytesSent)}
+	ch <- Sample{Desc: BytesReceived, Value: float64(total.BytesReceived)}
+	ch <- Sample{Desc: BindingRefreshErrors, Value: float64(total.BindingErrors)}
+}
@@ -0,0 +1,120 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/pion/turn/v4/internal/client"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeConn struct {
+	net.PacketConn
+	stats client.Stats
+}
+
+func (c *fakeConn) Stats() client.Stats {
+	return c.stats
+}
+
+func collect(c *Collector) map[string]float64 {
+	ch := make(chan Sample, 64)
+	c.Collect(ch)
+	close(ch)
+
+	samples := map[string]float64{}
+	for sample := range ch {
+		key := sample.Desc.Name
+		if len(sample.LabelValues) > 0 {
+			key += "{" + strings.Join(sample.LabelValues, ",") + "}"
+		}
+		samples[key] = sample.Value
+	}
+
+	return samples
+}
+
+func TestCollector(t *testing.T) {
+	t.Run("Add", func(t *testing.T) {
+		collector := NewCollector()
+		assert.ErrorIs(t, collector.Add(&net.UDPConn{}), errNoStats)
+		assert.NoError(t, collector.Add(&fakeConn{}))
+	})
+
+	t.Run("Describe", func(t *testing.T) {
+		ch := make(chan *Desc, 16)
+		NewCollector().Describe(ch)
+		close(ch)
+
+		names := map[string]bool{}
+		for desc := range ch {
+			names[desc.Name] = true
+		}
+		assert.Equal(t, map[string]bool{
+			"pion_turn_client_active_bindings":              true,
+			"pion_turn_client_active_permissions":           true,
+			"pion_turn_client_bytes_sent_total":             true,
+			"pion_turn_client_bytes_received_total":         true,
+			"pion_turn_client_binding_refresh_errors_total": true,
+		}, names)
+	})
+
+	t.Run("Collect", func(t *testing.T) {
+		collector := NewCollector()
+		first := &fakeConn{stats: client.Stats{
+			BytesSent:     10,
+			BytesReceived: 20,
+			BindingErrors: 1,
+			Bindings:      client.BindingCounts{Ready: 2, Failed: 1},
+			Permissions:   3,
+		}}
+		second := &fakeConn{stats: client.Stats{
+			BytesSent:   5,
+			Bindings:    client.BindingCounts{Request: 1},
+			Permissions: 1,
+		}}
+		assert.NoError(t, collector.Add(first))
+		assert.NoError(t, collector.Add(second))
+
+		samples := collect(collector)
+		assert.Equal(t, 15.0, samples["pion_turn_client_bytes_sent_total"])
+		assert.Equal(t, 20.0, samples["pion_turn_client_bytes_received_total"])
+		assert.Equal(t, 1.0, samples["pion_turn_client_binding_refresh_errors_total"])
+		assert.Equal(t, 4.0, samples["pion_turn_client_active_permissions"])
+		assert.Equal(t, 2.0, samples["pion_turn_client_active_bindings{ready}"])
+		assert.Equal(t, 1.0, samples["pion_turn_client_active_bindings{request}"])
+		assert.Equal(t, 1.0, samples["pion_turn_client_active_bindings{failed}"])
+		assert.Equal(t, 0.0, samples["pion_turn_client_active_bindings{idle}"])
+
+		// Counters of removed conns are kept, gauges are not
+		collector.Remove(first)
+		collector.Remove(first)
+		samples = collect(collector)
+		assert.Equal(t, 15.0, samples["pion_turn_client_bytes_sent_total"])
+		assert.Equal(t, 20.0, samples["pion_turn_client_bytes_received_total"])
+		assert.Equal(t, 1.0, samples["pion_turn_client_binding_refresh_errors_total"])
+		assert.Equal(t, 1.0, samples["pion_turn_client_active_permissions"])
+		assert.Equal(t, 0.0, samples["pion_turn_client_active_bindings{ready}"])
+	})
+
+	t.Run("Bounded cardinality", func(t *testing.T) {
+		collector := NewCollector()
+		series := len(collect(collector))
+		assert.Equal(t, 9, series)
+
+		// Many conns with many peers each add no series
+		for i := 0; i < 1000; i++ {
+			assert.NoError(t, collector.Add(&fakeConn{stats: client.Stats{
+				Bindings:    client.BindingCounts{Ready: 500, Refresh: 100},
+				Permissions: 600,
+			}}))
+		}
+		samples := collect(collector)
+		assert.Len(t, samples, series)
+		assert.Equal(t, 500000.0, samples["pion_turn_client_active_bindings{ready}"])
+	})
+}
@@ -7,6 +7,7 @@ package turn
 import (
 	"errors"
 	"fmt"
+	"math"
 	"net"
 	"time"
 
@@ -29,6 +30,9 @@ type Server struct {
 	channelBindTimeout time.Duration
 	nonceHash          server.NonceManager
 	eventHandler       EventHandler
+	transactionCache   *server.TransactionCache // Nil if disabled
+	handleRequest      server.Handler
+	bandwidthQuota     int64
 
 	packetConnConfigs  []PacketConnConfig
 	listenerConfigs    []ListenerConfig
@@ -57,6 +61,20 @@ func NewServer(config ServerConfig) (*Server, error) { //nolint:gocognit,cyclop
 		return nil, err
 	}
 
+	var transactionCache *server.TransactionCache
+	if config.TransactionCacheTTL > 0 {
+		transactionCache = server.NewTransactionCache(config.TransactionCacheTTL)
+	}
+
+	handleRequest := server.HandleRequest
+	if config.RateLimit > 0 {
+		burst := config.RateLimitBurst
+		if burst == 0 {
+			burst = int(math.Ceil(config.RateLimit))
+		}
+		handleRequest = server.NewRateLimiter(config.RateLimit, burst).RateLimit(handleRequest)
+	}
+
 	server := &Server{
 		log:                loggerFactory.NewLogger("turn"),
 		authHandler:        config.AuthHandler,
@@ -68,6 +86,9 @@ func NewServer(config ServerConfig) (*Server, error) { //nolint:gocognit,cyclop
 		nonceHash:          nonceHash,
 		inboundMTU:         mtu,
 		eventHandler:       config.EventHandler,
+		transactionCache:   transactionCache,
+		handleRequest:      handleRequest,
+		bandwidthQuota:     config.BandwidthQuota,
 	}
 
 	if server.channelBindTimeout == 0 {
@@ -118,6 +139,17 @@ func (s *Server) AllocationCount() int {
 	return allocs
 }
 
+// BandwidthUsage returns the data each active allocation relayed to its
+// client, and how much of it was dropped for exceeding the BandwidthQuota.
+func (s *Server) BandwidthUsage() []BandwidthUsage {
+	var usage []BandwidthUsage
+	for _, am := range s.allocationManagers {
+		usage = append(usage, am.BandwidthUsage()...)
+	}
+
+	return usage
+}
+
 // Close stops the TURN Server.
 // It cleans up any associated state and closes all connections it is managing.
 func (s *Server) Close() error {
@@ -202,6 +234,7 @@ func (s *Server) createAllocationManager(
 		PermissionHandler:  handler,
 		EventHandler:       s.eventHandler,
 		LeveledLogger:      s.log,
+		BandwidthQuota:     s.bandwidthQuota,
 	})
 	if err != nil {
 		return am, err
@@ -227,7 +260,7 @@ func (s *Server) readLoop(conn net.PacketConn, allocationManager *allocation.Man
 			continue
 		}
 
-		if err := server.HandleRequest(server.Request{
+		if err := s.handleRequest(server.Request{
 			Conn:               conn,
 			SrcAddr:            addr,
 			Buff:               buf[:n],
@@ -238,6 +271,7 @@ func (s *Server) readLoop(conn net.PacketConn, allocationManager *allocation.Man
 			AllocationManager:  allocationManager,
 			ChannelBindTimeout: s.channelBindTimeout,
 			NonceHash:          s.nonceHash,
+			TransactionCache:   s.transactionCache,
 		}); err != nil {
 			if s.eventHandler.OnAllocationError != nil {
 				s.eventHandler.OnAllocationError(addr, conn.LocalAddr(), allocation.UDP.String(), err.Error())
@@ -113,6 +113,9 @@ func GenerateAuthKey(username, realm, password string) []byte {
 // allocation's lifecycle.
 type EventHandler = allocation.EventHandler
 
+// BandwidthUsage describes the data an allocation relayed to its client.
+type BandwidthUsage = allocation.BandwidthUsage
+
 // QuotaHandler is a callback allows allocations to be rejected when a per-user quota is
 // exceeded. If the callback returns true the allocation request is accepted, otherwise it is
 // rejected and a 486 (Allocation Quota Reached) error is returned to the user.
@@ -147,6 +150,25 @@ type ServerConfig struct {
 
 	// Sets the server inbound MTU(Maximum transmition unit). Defaults to 1600 bytes.
 	InboundMTU int
+
+	// TransactionCacheTTL sets how long the response to a request is kept to
+	// answer retransmissions of the request with, instead of processing it
+	// again. RFC 5389 Section 7.3.1 suggests 40 seconds. Zero disables it.
+	TransactionCacheTTL time.Duration
+
+	// RateLimit sets how many requests per second each source IP may send,
+	// requests over the limit are answered with 486 (Allocation Quota
+	// Reached). Zero disables it.
+	RateLimit float64
+
+	// RateLimitBurst sets how many requests a source IP may send at once
+	// within RateLimit. Defaults to RateLimit rounded up.
+	RateLimitBurst int
+
+	// BandwidthQuota limits the bytes per second each allocation relays to
+	// its client. ChannelData and Data indications over it are dropped and
+	// counted in Server.BandwidthUsage. Zero means no limit.
+	BandwidthQuota int64
 }
 
 func (s *ServerConfig) validate() error {
@@ -166,5 +188,17 @@ func (s *ServerConfig) validate() error {
 		}
 	}
 
+	if s.TransactionCacheTTL < 0 {
+		return errNegativeTransactionCacheTTL
+	}
+
+	if s.RateLimit < 0 || s.RateLimitBurst < 0 {
+		return errNegativeRateLimit
+	}
+
+	if s.BandwidthQuota < 0 {
+		return errNegativeBandwidthQuota
+	}
+
 	return nil
 }
@@ -1268,7 +1268,137 @@ func TestQuotaReached(t *testing.T) {
 	defer client.Close()
 
 	_, err = client.Allocate()
-	assert.Equal(t, err.Error(), "Allocate error response (error 486: )")
+	assert.ErrorIs(t, err, ErrAllocationQuotaReached)
+	assert.ErrorContains(t, err, "Allocate error response (error 486: )")
+}
+
+func TestRateLimit(t *testing.T) {
+	serverConn, err := net.ListenPacket("udp4", "0.0.0.0:3478") // nolint: noctx
+	assert.NoError(t, err)
+
+	defer serverConn.Close() //nolint:errcheck
+
+	packetConnConfigs := []PacketConnConfig{{
+		PacketConn: serverConn,
+		RelayAddressGenerator: &RelayAddressGeneratorStatic{
+			RelayAddress: net.ParseIP("127.0.0.1"),
+			Address:      "0.0.0.0",
+		},
+	}}
+	_, err = NewServer(ServerConfig{PacketConnConfigs: packetConnConfigs, RateLimit: -1})
+	assert.ErrorIs(t, err, errNegativeRateLimit)
+
+	// The anonymous Allocate takes the only token, the authenticated one is rejected
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			return GenerateAuthKey(username, realm, "pass"), true
+		},
+		Realm:             "pion.ly",
+		PacketConnConfigs: packetConnConfigs,
+		RateLimit:         0.01,
+		RateLimitBurst:    1,
+		LoggerFactory:     logging.NewDefaultLoggerFactory(),
+	})
+	assert.NoError(t, err)
+
+	defer server.Close() //nolint:errcheck
+
+	conn, err := net.ListenPacket("udp4", "0.0.0.0:0") // nolint: noctx
+	assert.NoError(t, err)
+
+	client, err := NewClient(&ClientConfig{
+		Conn:           conn,
+		TURNServerAddr: "127.0.0.1:3478",
+		Username:       "user",
+		Password:       "pass",
+		LoggerFactory:  logging.NewDefaultLoggerFactory(),
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, client.Listen())
+	defer client.Close()
+
+	_, err = client.Allocate()
+	assert.ErrorIs(t, err, ErrAllocationQuotaReached)
+	assert.Equal(t, 0, server.AllocationCount())
+}
+
+func TestBandwidthQuota(t *testing.T) {
+	serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	assert.NoError(t, err)
+
+	defer serverConn.Close() //nolint:errcheck
+
+	packetConnConfigs := []PacketConnConfig{{
+		PacketConn: serverConn,
+		RelayAddressGenerator: &RelayAddressGeneratorStatic{
+			RelayAddress: net.ParseIP("127.0.0.1"),
+			Address:      "127.0.0.1",
+		},
+	}}
+	_, err = NewServer(ServerConfig{PacketConnConfigs: packetConnConfigs, BandwidthQuota: -1})
+	assert.ErrorIs(t, err, errNegativeBandwidthQuota)
+
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			return GenerateAuthKey(username, realm, "pass"), true
+		},
+		Realm:             "pion.ly",
+		PacketConnConfigs: packetConnConfigs,
+		BandwidthQuota:    100,
+		LoggerFactory:     logging.NewDefaultLoggerFactory(),
+	})
+	assert.NoError(t, err)
+
+	defer server.Close() //nolint:errcheck
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	assert.NoError(t, err)
+
+	client, err := NewClient(&ClientConfig{
+		Conn:           conn,
+		TURNServerAddr: serverConn.LocalAddr().String(),
+		Username:       "user",
+		Password:       "pass",
+		LoggerFactory:  logging.NewDefaultLoggerFactory(),
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, client.Listen())
+	defer client.Close()
+
+	relayConn, err := client.Allocate()
+	assert.NoError(t, err)
+	defer relayConn.Close() //nolint:errcheck
+
+	peer, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	assert.NoError(t, err)
+	defer peer.Close() //nolint:errcheck
+
+	// The write permits the peer, whose burst exceeds the quota of 100 bytes
+	_, err = relayConn.WriteTo([]byte("hello"), peer.LocalAddr())
+	assert.NoError(t, err)
+	buf := make([]byte, 1600)
+	assert.NoError(t, peer.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, _, err = peer.ReadFrom(buf)
+	assert.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		_, err = peer.WriteTo(make([]byte, 50), relayConn.LocalAddr())
+		assert.NoError(t, err)
+	}
+
+	var usage BandwidthUsage
+	assert.Eventually(t, func() bool {
+		all := server.BandwidthUsage()
+		if len(all) != 1 {
+			return false
+		}
+		usage = all[0]
+
+		return usage.DroppedPackets+usage.RelayedBytes/50 == 10
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int64(100), usage.Quota)
+	assert.Equal(t, "user", usage.Username)
+	assert.NotZero(t, usage.DroppedPackets)
+	assert.Equal(t, 50*usage.DroppedPackets, usage.DroppedBytes)
 }
 
 func RunBenchmarkServer(b *testing.B, clientNum int) { //nolint:cyclop
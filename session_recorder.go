@@ -0,0 +1,188 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// pcap file format with nanosecond timestamps, see
+	// https://www.ietf.org/archive/id/draft-ietf-opsawg-pcap-04.html
+	pcapMagicNanoseconds = 0xa1b23c4d
+	pcapVersionMajor     = 2
+	pcapVersionMinor     = 4
+	pcapSnapLen          = 262144
+	pcapLinkTypeRaw      = 101 // Raw IPv4 or IPv6 packets
+	pcapHeaderLen        = 24
+	pcapRecordHeaderLen  = 16
+
+	recordIPv4HeaderLen = 20
+	recordIPv6HeaderLen = 40
+	recordUDPHeaderLen  = 8
+	recordUDPProtocol   = 17
+	recordTTL           = 64
+)
+
+// sessionRecorder writes the packets of a Client to a pcap file.
+type sessionRecorder struct {
+	mutex sync.Mutex
+	w     io.Writer // Protected by mutex
+	err   error     // Protected by mutex, the write error that stopped the recording
+	now   func() time.Time
+}
+
+func newSessionRecorder(w io.Writer) *sessionRecorder {
+	return &sessionRecorder{w: w, now: time.Now}
+}
+
+// start writes the pcap file header.
+func (r *sessionRecorder) start() error {
+	header := make([]byte, pcapHeaderLen)
+	binary.LittleEndian.PutUint32(header[0:4], pcapMagicNanoseconds)
+	binary.LittleEndian.PutUint16(header[4:6], pcapVersionMajor)
+	binary.LittleEndian.PutUint16(header[6:8], pcapVersionMinor)
+	binary.LittleEndian.PutUint32(header[16:20], pcapSnapLen)
+	binary.LittleEndian.PutUint32(header[20:24], pcapLinkTypeRaw)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	_, err := r.w.Write(header)
+
+	return err
+}
+
+// record writes payload sent from src to dst at as a UDP packet. The first
+// write error stops the recording.
+func (r *sessionRecorder) record(at time.Time, src, dst net.Addr, payload []byte) {
+	packet := udpPacket(src, dst, payload)
+	record := make([]byte, pcapRecordHeaderLen, pcapRecordHeaderLen+len(packet))
+	binary.LittleEndian.PutUint32(record[0:4], uint32(at.Unix()))       // nolint:gosec // G115
+	binary.LittleEndian.PutUint32(record[4:8], uint32(at.Nanosecond())) // nolint:gosec // G115
+	binary.LittleEndian.PutUint32(record[8:12], uint32(len(packet)))    // nolint:gosec // G115
+	binary.LittleEndian.PutUint32(record[12:16], uint32(len(packet)))   // nolint:gosec // G115
+	record = append(record, packet...)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.err == nil {
+		_, r.err = r.w.Write(record)
+	}
+}
+
+// wrap returns conn recording its packets.
+func (r *sessionRecorder) wrap(conn net.PacketConn) net.PacketConn {
+	if _, ok := conn.(*recordingConn); ok {
+		return conn
+	}
+
+	return &recordingConn{PacketConn: conn, recorder: r}
+}
+
+// recordingConn is a net.PacketConn recording its packets.
+type recordingConn struct {
+	net.PacketConn
+	recorder *sessionRecorder
+}
+
+func (c *recordingConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	n, addr, err := c.PacketConn.ReadFrom(p)
+	if n > 0 {
+		c.recorder.record(c.recorder.now(), addr, c.LocalAddr(), p[:n])
+	}
+
+	return n, addr, err
+}
+
+func (c *recordingConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	at := c.recorder.now()
+	n, err := c.PacketConn.WriteTo(p, addr)
+	if err == nil {
+		c.recorder.record(at, c.LocalAddr(), addr, p)
+	}
+
+	return n, err
+}
+
+// udpPacket returns an IP packet with a UDP header carrying payload from src
+// to dst. It is IPv4 if both addresses are, IPv6 otherwise.
+func udpPacket(src, dst net.Addr, payload []byte) []byte {
+	srcIP, srcPort := addrIPPort(src)
+	dstIP, dstPort := addrIPPort(dst)
+
+	udpLen := recordUDPHeaderLen + len(payload)
+	udp := make([]byte, recordUDPHeaderLen, udpLen)
+	binary.BigEndian.PutUint16(udp[0:2], uint16(srcPort)) // nolint:gosec // G115
+	binary.BigEndian.PutUint16(udp[2:4], uint16(dstPort)) // nolint:gosec // G115
+	binary.BigEndian.PutUint16(udp[4:6], uint16(udpLen))  // nolint:gosec // G115
+	udp = append(udp, payload...)
+
+	var header, pseudo []byte
+	if src4, dst4 := srcIP.To4(), dstIP.To4(); src4 != nil && dst4 != nil {
+		header = make([]byte, recordIPv4HeaderLen)
+		// Version 4, 5 words
+		header[0] = 0x45
+		binary.BigEndian.PutUint16(header[2:4], uint16(recordIPv4HeaderLen+udpLen)) // nolint:gosec // G115
+		header[8] = recordTTL
+		header[9] = recordUDPProtocol
+		copy(header[12:16], src4)
+		copy(header[16:20], dst4)
+		binary.BigEndian.PutUint16(header[10:12], checksum(header))
+		pseudo = append(append([]byte{}, src4...), dst4...)
+		pseudo = append(pseudo, 0, recordUDPProtocol, byte(udpLen>>8), byte(udpLen))
+	} else {
+		header = make([]byte, recordIPv6HeaderLen)
+		// Version 6
+		header[0] = 0x60
+		binary.BigEndian.PutUint16(header[4:6], uint16(udpLen)) // nolint:gosec // G115
+		header[6] = recordUDPProtocol
+		header[7] = recordTTL
+		copy(header[8:24], srcIP.To16())
+		copy(header[24:40], dstIP.To16())
+		pseudo = append(append([]byte{}, header[8:40]...), 0, 0, byte(udpLen>>8), byte(udpLen), 0, 0, 0, recordUDPProtocol)
+	}
+
+	sum := checksum(append(pseudo, udp...))
+	if sum == 0 {
+		sum = 0xffff // Zero means no checksum
+	}
+	binary.BigEndian.PutUint16(udp[6:8], sum)
+
+	return append(header, udp...)
+}
+
+// addrIPPort returns the IP and port of addr, the unspecified IPv4 address
+// if it has none.
+func addrIPPort(addr net.Addr) (net.IP, int) {
+	switch addr := addr.(type) {
+	case *net.UDPAddr:
+		return addr.IP, addr.Port
+	case *net.TCPAddr:
+		return addr.IP, addr.Port
+	default:
+		return net.IPv4zero, 0
+	}
+}
+
+// checksum returns the Internet checksum of b, RFC 1071.
+func checksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+
+	return ^uint16(sum) //nolint:gosec // G115
+}
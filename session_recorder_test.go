@@ -0,0 +1,225 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package turn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/stun/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pcapPacket is a packet of a pcap file written by a sessionRecorder.
+type pcapPacket struct {
+	at       time.Time
+	src, dst *net.UDPAddr
+	payload  []byte
+}
+
+// readPcap parses the raw IPv4 UDP packets of a pcap file.
+func readPcap(t *testing.T, file []byte) []pcapPacket {
+	t.Helper()
+
+	require.GreaterOrEqual(t, len(file), pcapHeaderLen)
+	assert.Equal(t, uint32(pcapMagicNanoseconds), binary.LittleEndian.Uint32(file[0:4]))
+	assert.Equal(t, uint16(2), binary.LittleEndian.Uint16(file[4:6]))
+	assert.Equal(t, uint16(4), binary.LittleEndian.Uint16(file[6:8]))
+	assert.Equal(t, uint32(pcapLinkTypeRaw), binary.LittleEndian.Uint32(file[20:24]))
+
+	var packets []pcapPacket
+	for rest := file[pcapHeaderLen:]; len(rest) > 0; {
+		require.GreaterOrEqual(t, len(rest), pcapRecordHeaderLen)
+		sec, nsec := binary.LittleEndian.Uint32(rest[0:4]), binary.LittleEndian.Uint32(rest[4:8])
+		inclLen, origLen := int(binary.LittleEndian.Uint32(rest[8:12])), int(binary.LittleEndian.Uint32(rest[12:16]))
+		assert.Equal(t, origLen, inclLen)
+		require.GreaterOrEqual(t, len(rest), pcapRecordHeaderLen+inclLen)
+		packet := rest[pcapRecordHeaderLen : pcapRecordHeaderLen+inclLen]
+		rest = rest[pcapRecordHeaderLen+inclLen:]
+
+		require.GreaterOrEqual(t, len(packet), recordIPv4HeaderLen+recordUDPHeaderLen)
+		require.Equal(t, byte(0x45), packet[0])
+		assert.Equal(t, len(packet), int(binary.BigEndian.Uint16(packet[2:4])))
+		assert.Equal(t, byte(recordUDPProtocol), packet[9])
+		assert.Zero(t, checksum(packet[:recordIPv4HeaderLen]), "IPv4 header checksum")
+		udp := packet[recordIPv4HeaderLen:]
+		assert.Equal(t, len(udp), int(binary.BigEndian.Uint16(udp[4:6])))
+		pseudo := append(append([]byte{}, packet[12:20]...), 0, recordUDPProtocol, udp[4], udp[5])
+		assert.Zero(t, checksum(append(pseudo, udp...)), "UDP checksum")
+
+		packets = append(packets, pcapPacket{
+			at:      time.Unix(int64(sec), int64(nsec)),
+			src:     &net.UDPAddr{IP: net.IP(packet[12:16]), Port: int(binary.BigEndian.Uint16(udp[0:2]))},
+			dst:     &net.UDPAddr{IP: net.IP(packet[16:20]), Port: int(binary.BigEndian.Uint16(udp[2:4]))},
+			payload: udp[recordUDPHeaderLen:],
+		})
+	}
+
+	return packets
+}
+
+func TestClientSessionRecorder(t *testing.T) {
+	t.Run("Session", func(t *testing.T) {
+		udpListener, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		require.NoError(t, err)
+
+		server, err := NewServer(ServerConfig{
+			AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+				return GenerateAuthKey(username, realm, "pass"), true
+			},
+			PacketConnConfigs: []PacketConnConfig{
+				{
+					PacketConn: udpListener,
+					RelayAddressGenerator: &RelayAddressGeneratorStatic{
+						RelayAddress: net.ParseIP("127.0.0.1"),
+						Address:      "127.0.0.1",
+					},
+				},
+			},
+			Realm: "pion.ly",
+		})
+		require.NoError(t, err)
+		defer server.Close() //nolint:errcheck
+
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		require.NoError(t, err)
+		defer conn.Close() //nolint:errcheck
+
+		file := &syncBuffer{}
+		start := time.Now()
+		turnClient, err := NewClient(&ClientConfig{
+			Conn:           conn,
+			STUNServerAddr: udpListener.LocalAddr().String(),
+			TURNServerAddr: udpListener.LocalAddr().String(),
+			Username:       "foo",
+			Password:       "pass",
+		}, WithSessionRecorder(file))
+		require.NoError(t, err)
+		require.NoError(t, turnClient.Listen())
+
+		relayConn, err := turnClient.Allocate()
+		require.NoError(t, err)
+
+		peer, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		require.NoError(t, err)
+		defer peer.Close() //nolint:errcheck
+
+		_, err = relayConn.WriteTo([]byte("hello"), peer.LocalAddr())
+		require.NoError(t, err)
+		buf := make([]byte, 1500)
+		require.NoError(t, peer.SetReadDeadline(time.Now().Add(5*time.Second)))
+		_, from, err := peer.ReadFrom(buf)
+		require.NoError(t, err)
+		_, err = peer.WriteTo([]byte("world"), from)
+		require.NoError(t, err)
+		require.NoError(t, relayConn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		_, _, err = relayConn.ReadFrom(buf)
+		require.NoError(t, err)
+
+		require.NoError(t, relayConn.Close())
+		turnClient.Close()
+
+		packets := readPcap(t, []byte(file.String()))
+		var sent, received []stun.MessageType
+		for _, packet := range packets {
+			assert.False(t, packet.at.Before(start.Truncate(time.Second)))
+
+			var clientToServer bool
+			switch {
+			case packet.src.String() == conn.LocalAddr().String() && packet.dst.String() == udpListener.LocalAddr().String():
+				clientToServer = true
+			case packet.src.String() == udpListener.LocalAddr().String() && packet.dst.String() == conn.LocalAddr().String():
+			default:
+				t.Fatalf("packet from %s to %s", packet.src, packet.dst)
+			}
+
+			// Every STUN message carries the magic cookie, other packets
+			// are ChannelData
+			if packet.payload[0]&0xc0 != 0 {
+				assert.GreaterOrEqual(t, packet.payload[0], byte(0x40))
+
+				continue
+			}
+			assert.Equal(t, uint32(0x2112a442), binary.BigEndian.Uint32(packet.payload[4:8]), "magic cookie, RFC 5389 Section 6")
+			msg := &stun.Message{Raw: packet.payload}
+			require.NoError(t, msg.Decode())
+			if clientToServer {
+				sent = append(sent, msg.Type)
+			} else {
+				received = append(received, msg.Type)
+			}
+		}
+
+		assert.Contains(t, sent, stun.NewType(stun.MethodAllocate, stun.ClassRequest))
+		assert.Contains(t, sent, stun.NewType(stun.MethodCreatePermission, stun.ClassRequest))
+		assert.Contains(t, sent, stun.NewType(stun.MethodRefresh, stun.ClassRequest), "deallocation on close")
+		assert.Contains(t, received, stun.NewType(stun.MethodAllocate, stun.ClassErrorResponse))
+		assert.Contains(t, received, stun.NewType(stun.MethodAllocate, stun.ClassSuccessResponse))
+		assert.Contains(t, received, stun.NewType(stun.MethodCreatePermission, stun.ClassSuccessResponse))
+	})
+
+	t.Run("IPv6", func(t *testing.T) {
+		src := &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 5000}
+		dst := &net.UDPAddr{IP: net.ParseIP("2001:db8::2"), Port: 3478}
+		packet := udpPacket(src, dst, []byte("data"))
+
+		require.Len(t, packet, recordIPv6HeaderLen+recordUDPHeaderLen+4)
+		assert.Equal(t, byte(0x60), packet[0])
+		assert.Equal(t, uint16(recordUDPHeaderLen+4), binary.BigEndian.Uint16(packet[4:6]))
+		assert.Equal(t, byte(recordUDPProtocol), packet[6])
+		assert.Equal(t, []byte(src.IP), packet[8:24])
+		assert.Equal(t, []byte(dst.IP), packet[24:40])
+		udp := packet[recordIPv6HeaderLen:]
+		pseudo := append(append([]byte{}, packet[8:40]...), 0, 0, udp[4], udp[5], 0, 0, 0, recordUDPProtocol)
+		assert.Zero(t, checksum(append(pseudo, udp...)))
+		assert.Equal(t, []byte("data"), udp[recordUDPHeaderLen:])
+	})
+
+	t.Run("Write error", func(t *testing.T) {
+		errWrite := errors.New("disk full")
+		recorder := newSessionRecorder(&failingWriter{after: 1, err: errWrite})
+		require.NoError(t, recorder.start())
+
+		addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 3478}
+		recorder.record(time.Now(), addr, addr, []byte("first"))
+		recorder.record(time.Now(), addr, addr, []byte("second"))
+		assert.ErrorIs(t, recorder.err, errWrite)
+		assert.Equal(t, 2, recorder.w.(*failingWriter).writes) //nolint:forcetypeassert
+	})
+
+	t.Run("Header write error", func(t *testing.T) {
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		require.NoError(t, err)
+		defer conn.Close() //nolint:errcheck
+
+		errWrite := errors.New("disk full")
+		_, err = NewClient(&ClientConfig{Conn: conn}, WithSessionRecorder(&failingWriter{err: errWrite}))
+		assert.ErrorIs(t, err, errWrite)
+	})
+}
+
+// failingWriter fails the writes after the first ones.
+type failingWriter struct {
+	bytes.Buffer
+	after  int
+	writes int
+	err    error
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	if w.writes > w.after {
+		return 0, w.err
+	}
+
+	return w.Buffer.Write(p)
+}
@@ -21,6 +21,10 @@ var (
 // STUNConn wraps a net.Conn and implements
 // net.PacketConn by being STUN aware and
 // packetizing the stream.
+//
+// Use it as ClientConfig.Conn to run TURN over TCP or TLS. Frames are delimited
+// by the STUN header and ChannelData length fields as described in RFC 5766
+// Section 11.5; no additional RFC 4571 length prefix is used.
 type STUNConn struct {
 	nextConn net.Conn
 	buff     []byte
@@ -0,0 +1,105 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4/internal/proto"
+)
+
+// AccessToken is an OAuth access token issued by an authorization server for
+// third-party authorization with a TURN server, RFC 7635.
+type AccessToken struct {
+	// KeyID is the kid of the token, sent as USERNAME.
+	KeyID string
+	// Token is the encrypted token, sent as ACCESS-TOKEN. It is opaque to the
+	// client.
+	Token []byte
+	// MACKey is the session key the requests are signed with, in place of the
+	// long-term credential key.
+	MACKey []byte
+}
+
+func (t AccessToken) validate() error {
+	if t.KeyID == "" || len(t.Token) == 0 || len(t.MACKey) == 0 {
+		return errInvalidAccessToken
+	}
+
+	return nil
+}
+
+// ThirdPartyAuthClient is a Client authenticating with an AccessToken instead
+// of a username and password, RFC 7635. It is used like a Client: requests
+// are signed with the session key, and the token is sent in Allocate and
+// Refresh requests, also in those of the allocations it creates.
+type ThirdPartyAuthClient struct {
+	*Client
+}
+
+// NewThirdPartyAuthClient returns a ThirdPartyAuthClient using token.
+// ClientConfig.Username and Password are ignored. ClientConfig.CredentialAlgorithm
+// selects MESSAGE-INTEGRITY or MESSAGE-INTEGRITY-SHA256 for the session key.
+func NewThirdPartyAuthClient(
+	config *ClientConfig,
+	token AccessToken,
+	opts ...ClientOption,
+) (*ThirdPartyAuthClient, error) {
+	if err := token.validate(); err != nil {
+		return nil, err
+	}
+
+	c, err := NewClient(config, append(opts, withAccessToken(token))...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ThirdPartyAuthClient{Client: c}, nil
+}
+
+// withAccessToken makes the Client authenticate with token. It must come
+// after any WithCredentialDeriver.
+func withAccessToken(token AccessToken) ClientOption {
+	return func(c *Client) error {
+		c.accessToken = proto.AccessToken(token.Token)
+		c.username = stun.NewUsername(token.KeyID)
+		c.password = ""
+		c.credDeriver = sessionKey{algorithm: c.credDeriver.Algorithm(), key: token.MACKey}
+		c.negotiate = false
+
+		return nil
+	}
+}
+
+// sessionKey is the CredentialDeriver of an AccessToken: the MACKey is used
+// as is.
+type sessionKey struct {
+	algorithm CredentialAlgorithm
+	key       []byte
+}
+
+// Algorithm implements CredentialDeriver.
+func (k sessionKey) Algorithm() CredentialAlgorithm {
+	return k.algorithm
+}
+
+// Key implements CredentialDeriver.
+func (k sessionKey) Key(string, string, string) []byte {
+	return k.key
+}
+
+// addAccessToken returns msg signed again with the ACCESS-TOKEN added to it,
+// if it is a signed Refresh request without one.
+func (c *Client) addAccessToken(msg *stun.Message) (*stun.Message, error) {
+	if msg.Type != stun.NewType(stun.MethodRefresh, stun.ClassRequest) ||
+		!msg.Contains(stun.AttrUsername) || msg.Contains(proto.AttrAccessToken) {
+		return msg, nil
+	}
+
+	creds := c.credentials()
+	if err := creds.Nonce.GetFrom(msg); err != nil {
+		return nil, err
+	}
+
+	return resign(msg, creds, c.accessToken)
+}
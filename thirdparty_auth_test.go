@@ -0,0 +1,147 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package turn
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4/internal/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// oauthServer is a TURN server accepting requests signed with the session
+// key of token, RFC 7635. Requests with another token get 400 Bad Request.
+// The signed requests it accepts are sent on reqCh.
+type oauthServer struct {
+	conn  net.PacketConn
+	token AccessToken
+	reqCh chan *stun.Message
+}
+
+func (s *oauthServer) serve(t *testing.T) {
+	t.Helper()
+
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		req := new(stun.Message)
+		if _, err = req.Write(append([]byte(nil), buf[:n]...)); err != nil {
+			continue
+		}
+
+		resType := stun.NewType(req.Type.Method, stun.ClassErrorResponse)
+		var attrs []stun.Setter
+		var token proto.AccessToken
+		switch {
+		case !req.Contains(stun.AttrUsername):
+			attrs = []stun.Setter{
+				stun.CodeUnauthorized, stun.NewNonce("nonce"), stun.NewRealm("pion.ly"),
+				proto.ThirdPartyAuthorization("turn.example.com"),
+			}
+		case req.Type.Method == stun.MethodAllocate && (token.GetFrom(req) != nil || !bytes.Equal(token, s.token.Token)):
+			attrs = []stun.Setter{stun.CodeBadRequest}
+		case stun.MessageIntegrity(s.token.MACKey).Check(req) != nil:
+			attrs = []stun.Setter{stun.CodeUnauthorized, stun.NewNonce("nonce"), stun.NewRealm("pion.ly")}
+		default:
+			s.reqCh <- req
+			resType = stun.NewType(req.Type.Method, stun.ClassSuccessResponse)
+			attrs = []stun.Setter{
+				&proto.RelayedAddress{IP: net.IPv4(127, 0, 0, 1), Port: 5000},
+				proto.Lifetime{Duration: time.Minute},
+			}
+		}
+
+		res, err := stun.Build(buildMsg(req.TransactionID, resType, append(attrs, stun.Fingerprint)...)...)
+		assert.NoError(t, err)
+		_, err = s.conn.WriteTo(res.Raw, from)
+		assert.NoError(t, err)
+	}
+}
+
+func TestThirdPartyAuthClient(t *testing.T) {
+	token := AccessToken{
+		KeyID:  "north",
+		Token:  []byte("encrypted token"),
+		MACKey: []byte("session key 0123"),
+	}
+
+	newClient := func(t *testing.T, clientToken AccessToken) (*ThirdPartyAuthClient, *oauthServer) {
+		t.Helper()
+
+		serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = serverConn.Close() })
+		server := &oauthServer{conn: serverConn, token: token, reqCh: make(chan *stun.Message, 10)}
+		go server.serve(t)
+
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = conn.Close() })
+
+		turnClient, err := NewThirdPartyAuthClient(&ClientConfig{
+			Conn:           conn,
+			TURNServerAddr: serverConn.LocalAddr().String(),
+			Username:       "ignored",
+			Password:       "ignored",
+			RTO:            50 * time.Millisecond,
+		}, clientToken)
+		require.NoError(t, err)
+		require.NoError(t, turnClient.Listen())
+		t.Cleanup(turnClient.Close)
+
+		return turnClient, server
+	}
+
+	t.Run("Allocate and Refresh", func(t *testing.T) {
+		turnClient, server := newClient(t, token)
+
+		relayConn, err := turnClient.Allocate()
+		require.NoError(t, err)
+		req := <-server.reqCh
+		var username stun.Username
+		require.NoError(t, username.GetFrom(req))
+		assert.Equal(t, "north", username.String(), "the kid should be the username")
+		var sent proto.AccessToken
+		require.NoError(t, sent.GetFrom(req))
+		assert.Equal(t, proto.AccessToken("encrypted token"), sent)
+
+		// Requests of the allocation are signed with the session key too,
+		// and refreshes carry the token
+		require.NoError(t, turnClient.CreatePermission(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}))
+		req = <-server.reqCh
+		assert.Equal(t, stun.MethodCreatePermission, req.Type.Method)
+		assert.False(t, req.Contains(proto.AttrAccessToken))
+
+		require.NoError(t, relayConn.Close())
+		req = <-server.reqCh
+		assert.Equal(t, stun.MethodRefresh, req.Type.Method)
+		require.NoError(t, sent.GetFrom(req))
+		assert.Equal(t, proto.AccessToken("encrypted token"), sent)
+	})
+
+	t.Run("Bad Request", func(t *testing.T) {
+		revoked := token
+		revoked.Token = []byte("revoked token")
+		turnClient, _ := newClient(t, revoked)
+
+		_, err := turnClient.Allocate()
+		assert.ErrorContains(t, err, "400")
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		_, err := NewThirdPartyAuthClient(&ClientConfig{Conn: &net.UDPConn{}}, AccessToken{KeyID: "north"})
+		assert.ErrorIs(t, err, errInvalidAccessToken)
+	})
+}
@@ -0,0 +1,29 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"context"
+	"net"
+
+	"github.com/pion/turn/v4/internal/client"
+)
+
+// BandwidthResult is the outcome of BenchmarkRelayThroughput: the frames sent
+// and echoed back, the send and receive rates in Mbps, the packet loss in
+// percent and the mean round trip time.
+type BandwidthResult = client.BandwidthResult
+
+// BenchmarkRelayThroughput measures the throughput of the relay from conn to
+// peer and back. It sends frames of payloadSize bytes to peer as fast as it
+// can for durationSec seconds. The peer must echo every packet back to the
+// relayed address unchanged.
+func BenchmarkRelayThroughput(
+	ctx context.Context,
+	conn *client.UDPConn,
+	peer net.Addr,
+	payloadSize, durationSec int,
+) (BandwidthResult, error) {
+	return client.BenchmarkRelayThroughput(ctx, conn, peer, payloadSize, durationSec)
+}
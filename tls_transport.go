@@ -0,0 +1,99 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/pion/transport/v3"
+)
+
+// ALPNProtocol is the ALPN protocol ID of STUN and TURN over TLS, registered
+// by RFC 7443 and used by RFC 7350 Section 3.2.2.
+const ALPNProtocol = "stun.turn"
+
+// TLSTransport runs TURN over a TLS connection. It offers ALPNProtocol in the
+// handshake and frames the stream like STUNConn.
+type TLSTransport struct {
+	*STUNConn
+	tlsConn *tls.Conn
+}
+
+// NewTLSTransport performs the TLS client handshake on conn, offering
+// ALPNProtocol in addition to the protocols already set in config, and returns
+// a TLSTransport reading and writing STUN frames over the TLS record layer.
+// config must set either ServerName or InsecureSkipVerify.
+func NewTLSTransport(ctx context.Context, conn net.Conn, config *tls.Config) (*TLSTransport, error) {
+	tlsConn := tls.Client(conn, tlsConfigWithALPN(config))
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, fmt.Errorf("%w: %s", errTLSHandshakeFailed, err.Error())
+	}
+
+	// A server without ALPN support selects no protocol, which is fine
+	if proto := tlsConn.ConnectionState().NegotiatedProtocol; proto != "" && proto != ALPNProtocol {
+		_ = tlsConn.Close()
+
+		return nil, fmt.Errorf("%w: %s", errUnexpectedALPNProtocol, proto)
+	}
+
+	return &TLSTransport{STUNConn: NewSTUNConn(tlsConn), tlsConn: tlsConn}, nil
+}
+
+// ConnectionState returns the state of the TLS connection.
+func (t *TLSTransport) ConnectionState() tls.ConnectionState {
+	return t.tlsConn.ConnectionState()
+}
+
+// dialTLSTransport connects to the TURN server at address over TLS, failing
+// if the connection is not established within timeout. The server name
+// defaults to the host of address.
+func dialTLSTransport(
+	n transport.Net,
+	address string,
+	config *tls.Config,
+	timeout time.Duration,
+) (*TLSTransport, error) {
+	if config.ServerName == "" && !config.InsecureSkipVerify {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		config = config.Clone()
+		config.ServerName = host
+	}
+
+	conn, err := n.CreateDialer(&net.Dialer{Timeout: timeout}).Dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	tlsTransport, err := NewTLSTransport(ctx, conn, config)
+	if err != nil {
+		_ = conn.Close()
+
+		return nil, err
+	}
+
+	return tlsTransport, nil
+}
+
+func tlsConfigWithALPN(config *tls.Config) *tls.Config {
+	if config == nil {
+		config = &tls.Config{} //nolint:gosec
+	} else {
+		config = config.Clone()
+	}
+	if !slices.Contains(config.NextProtos, ALPNProtocol) {
+		config.NextProtos = append([]string{ALPNProtocol}, config.NextProtos...)
+	}
+
+	return config
+}
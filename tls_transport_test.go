@@ -0,0 +1,206 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package turn
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/dtls/v3/pkg/crypto/selfsign"
+	"github.com/pion/transport/v3/stdnet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTLSListener(t *testing.T, nextProtos ...string) (net.Listener, <-chan []string) {
+	t.Helper()
+
+	certificate, err := selfsign.GenerateSelfSigned()
+	require.NoError(t, err)
+
+	offered := make(chan []string, 1)
+	listener, err := tls.Listen("tcp4", "127.0.0.1:0", &tls.Config{ //nolint:gosec
+		Certificates: []tls.Certificate{certificate},
+		NextProtos:   nextProtos,
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			select {
+			case offered <- hello.SupportedProtos:
+			default:
+			}
+
+			return nil, nil //nolint:nilnil
+		},
+	})
+	require.NoError(t, err)
+
+	return listener, offered
+}
+
+func TestTLSTransport(t *testing.T) {
+	t.Run("Allocate", func(t *testing.T) {
+		listener, offered := newTLSListener(t, ALPNProtocol)
+
+		server, err := NewServer(ServerConfig{
+			AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+				return GenerateAuthKey(username, realm, "pass"), true
+			},
+			ListenerConfigs: []ListenerConfig{
+				{
+					Listener: listener,
+					RelayAddressGenerator: &RelayAddressGeneratorStatic{
+						RelayAddress: net.ParseIP("127.0.0.1"),
+						Address:      "127.0.0.1",
+					},
+				},
+			},
+			Realm: "pion.ly",
+		})
+		require.NoError(t, err)
+		defer server.Close() //nolint:errcheck
+
+		serverAddr := listener.Addr().String()
+		client, err := NewClient(&ClientConfig{
+			STUNServerAddr: serverAddr,
+			TURNServerAddr: serverAddr,
+			Username:       "foo",
+			Password:       "pass",
+		}, WithTLS(&tls.Config{InsecureSkipVerify: true})) //nolint:gosec
+		require.NoError(t, err)
+		require.NoError(t, client.Listen())
+		defer client.Close()
+
+		assert.Equal(t, []string{ALPNProtocol}, <-offered)
+		tlsTransport, ok := client.baseConn().(*TLSTransport)
+		require.True(t, ok)
+		assert.Equal(t, ALPNProtocol, tlsTransport.ConnectionState().NegotiatedProtocol)
+
+		// STUN messages are framed over the TLS record layer
+		mappedAddr, err := client.SendBindingRequest()
+		require.NoError(t, err)
+		assert.Equal(t, tlsTransport.LocalAddr().String(), mappedAddr.String())
+
+		relayConn, err := client.Allocate()
+		require.NoError(t, err)
+
+		peer, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		require.NoError(t, err)
+		defer peer.Close() //nolint:errcheck
+
+		_, err = relayConn.WriteTo([]byte("hello"), peer.LocalAddr())
+		require.NoError(t, err)
+
+		buf := make([]byte, 1600)
+		require.NoError(t, peer.SetReadDeadline(time.Now().Add(5*time.Second)))
+		n, from, err := peer.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(buf[:n]))
+
+		_, err = peer.WriteTo([]byte("world"), from)
+		require.NoError(t, err)
+
+		require.NoError(t, relayConn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		n, _, err = relayConn.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.Equal(t, "world", string(buf[:n]))
+
+		require.NoError(t, relayConn.Close())
+	})
+
+	t.Run("Keeps NextProtos", func(t *testing.T) {
+		listener, offered := newTLSListener(t, ALPNProtocol, "h2")
+		defer listener.Close() //nolint:errcheck
+		go acceptAndHandshake(listener)
+
+		conn, err := net.Dial("tcp4", listener.Addr().String()) // nolint: noctx
+		require.NoError(t, err)
+
+		config := &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"h2"}} //nolint:gosec
+		tlsTransport, err := NewTLSTransport(context.Background(), conn, config)
+		require.NoError(t, err)
+		defer tlsTransport.Close() //nolint:errcheck
+
+		assert.Equal(t, []string{ALPNProtocol, "h2"}, <-offered)
+		assert.Equal(t, []string{"h2"}, config.NextProtos)
+		assert.Equal(t, ALPNProtocol, tlsTransport.ConnectionState().NegotiatedProtocol)
+	})
+
+	t.Run("Unexpected protocol", func(t *testing.T) {
+		listener, _ := newTLSListener(t, "h2")
+		defer listener.Close() //nolint:errcheck
+		go acceptAndHandshake(listener)
+
+		conn, err := net.Dial("tcp4", listener.Addr().String()) // nolint: noctx
+		require.NoError(t, err)
+
+		config := &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"h2"}} //nolint:gosec
+		_, err = NewTLSTransport(context.Background(), conn, config)
+		assert.ErrorIs(t, err, errUnexpectedALPNProtocol)
+	})
+
+	t.Run("Handshake timeout", func(t *testing.T) {
+		// The server accepts the connection but never answers the handshake
+		listener, err := net.Listen("tcp4", "127.0.0.1:0") // nolint: noctx
+		require.NoError(t, err)
+		defer listener.Close() //nolint:errcheck
+
+		n, err := stdnet.NewNet()
+		require.NoError(t, err)
+		config := &tls.Config{InsecureSkipVerify: true} //nolint:gosec
+		_, err = dialTLSTransport(n, listener.Addr().String(), config, 50*time.Millisecond)
+		assert.ErrorIs(t, err, errTLSHandshakeFailed)
+	})
+
+	t.Run("Conn and WithTLS", func(t *testing.T) {
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		require.NoError(t, err)
+		defer conn.Close() //nolint:errcheck
+
+		_, err = NewClient(&ClientConfig{
+			TURNServerAddr: "127.0.0.1:5349",
+			Conn:           conn,
+		}, WithTLS(nil))
+		assert.ErrorIs(t, err, errConnWithTLS)
+	})
+
+	t.Run("WithTLS and WithWebSocket", func(t *testing.T) {
+		listener, _ := newTLSListener(t)
+		defer listener.Close() //nolint:errcheck
+		closed := make(chan struct{})
+		go func() {
+			acceptAndHandshake(listener)
+			close(closed)
+		}()
+
+		_, err := NewClient(&ClientConfig{
+			TURNServerAddr: listener.Addr().String(),
+		}, WithTLS(&tls.Config{InsecureSkipVerify: true}), WithWebSocket("ws://127.0.0.1:1", "")) //nolint:gosec
+		assert.ErrorIs(t, err, errConnWithWebSocket)
+
+		// The TLS transport dialed before the error is closed
+		select {
+		case <-closed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("TLS transport left open")
+		}
+	})
+}
+
+func acceptAndHandshake(listener net.Listener) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close() //nolint:errcheck
+
+	if err := conn.(*tls.Conn).Handshake(); err != nil { //nolint:forcetypeassert
+		return
+	}
+	_, _ = conn.Read(make([]byte, 1))
+}
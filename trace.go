@@ -0,0 +1,27 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"context"
+
+	"github.com/pion/turn/v4/internal/client"
+)
+
+// ClientTrace is a set of hooks run at stages of the life of an allocation,
+// like httptrace.ClientTrace. Attach it with WithClientTrace to the context
+// passed to AllocateContext, AllocateEvenPort or AllocateWithToken. The later
+// hooks are called for the relayed conn returned.
+type ClientTrace = client.ClientTrace
+
+// WithClientTrace returns a new context based on ctx that carries trace.
+// Hooks already in ctx are still called, after those of trace.
+func WithClientTrace(ctx context.Context, trace *ClientTrace) context.Context {
+	return client.WithClientTrace(ctx, trace)
+}
+
+// ContextClientTrace returns the ClientTrace of ctx, or nil if there is none.
+func ContextClientTrace(ctx context.Context) *ClientTrace {
+	return client.ContextClientTrace(ctx)
+}
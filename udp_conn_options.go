@@ -0,0 +1,271 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"syscall"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/turn/v4/binding"
+	"github.com/pion/turn/v4/internal/client"
+)
+
+// UDPConnOption customizes the relayed conn of a UDP allocation. Pass it to
+// NewClient with WithUDPConnOptions.
+type UDPConnOption = client.UDPConnOption
+
+// WithUDPConnOptions applies opts to the relayed conns returned by Allocate,
+// its variants and ResumeAllocation. An option that fails makes the
+// allocation fail.
+func WithUDPConnOptions(opts ...UDPConnOption) ClientOption {
+	return func(c *Client) error {
+		c.udpConnOpts = append(c.udpConnOpts, opts...)
+
+		return nil
+	}
+}
+
+// RetryPolicy controls how a ChannelBind request rejected with a stale nonce
+// is retried, see WithRetryPolicy.
+type RetryPolicy = client.RetryPolicy
+
+// DefaultRetryPolicy returns the RetryPolicy used when none is configured.
+func DefaultRetryPolicy() RetryPolicy {
+	return client.DefaultRetryPolicy()
+}
+
+// WithRetryPolicy sets the back-off used to retry ChannelBind requests
+// rejected with a stale nonce.
+func WithRetryPolicy(policy RetryPolicy) UDPConnOption {
+	return client.WithRetryPolicy(policy)
+}
+
+// WithLogger sets the logger of the relayed conn, overriding the logger of
+// the Client.
+func WithLogger(log logging.LeveledLogger) UDPConnOption {
+	return client.WithLogger(log)
+}
+
+// WithBindingRefreshInterval sets how old a channel binding may get before it
+// is refreshed. Zero selects the default of 5 minutes.
+func WithBindingRefreshInterval(interval time.Duration) UDPConnOption {
+	return client.WithBindingRefreshInterval(interval)
+}
+
+// WithAllocationRefreshInterval sets a fixed interval between allocation
+// refreshes. Zero, the default, refreshes at 80% of the allocation lifetime.
+func WithAllocationRefreshInterval(interval time.Duration) UDPConnOption {
+	return client.WithAllocationRefreshInterval(interval)
+}
+
+// WithAllocationRefreshJitter sets the fraction, in [0, 1), by which each
+// allocation refresh interval is randomized. The default is 0.1.
+func WithAllocationRefreshJitter(jitter float64) UDPConnOption {
+	return client.WithAllocationRefreshJitter(jitter)
+}
+
+// WithPermissionBatchWindow makes writes collect the peers that need a new
+// permission for window and request them in a single CreatePermission
+// transaction. Zero, the default, disables batching.
+func WithPermissionBatchWindow(window time.Duration) UDPConnOption {
+	return client.WithPermissionBatchWindow(window)
+}
+
+// WithPermissionRefreshInterval sets how often the permissions of the
+// allocation are refreshed. Zero selects the default of 120 seconds.
+func WithPermissionRefreshInterval(interval time.Duration) UDPConnOption {
+	return client.WithPermissionRefreshInterval(interval)
+}
+
+// WithPermissionLifetime sets how long the server keeps a permission without
+// refresh. Zero selects the RFC 5766 default of 300 seconds.
+func WithPermissionLifetime(lifetime time.Duration) UDPConnOption {
+	return client.WithPermissionLifetime(lifetime)
+}
+
+// WithPermissionRefreshMargin sets how long before its expiry a permission is
+// refreshed at the latest. Zero selects the default of 60 seconds.
+func WithPermissionRefreshMargin(margin time.Duration) UDPConnOption {
+	return client.WithPermissionRefreshMargin(margin)
+}
+
+// WithPermissionGCInterval sets how often permissions that failed or expired
+// are removed. Zero selects the default of 60 seconds.
+func WithPermissionGCInterval(interval time.Duration) UDPConnOption {
+	return client.WithPermissionGCInterval(interval)
+}
+
+// PermissionRateLimiter decides whether a CreatePermission request may be
+// sent for a new permission, see WithPermissionRateLimiter.
+type PermissionRateLimiter = client.PermissionRateLimiter
+
+// NewTokenBucketRateLimiter returns a PermissionRateLimiter allowing bursts of
+// up to burst requests and rate requests per second on average.
+func NewTokenBucketRateLimiter(rate float64, burst int) PermissionRateLimiter {
+	return client.NewTokenBucketRateLimiter(rate, burst)
+}
+
+// WithPermissionRateLimiter makes writes ask limiter before requesting a new
+// permission, and fail with ErrPermissionRateLimited if it is not allowed.
+func WithPermissionRateLimiter(limiter PermissionRateLimiter) UDPConnOption {
+	return client.WithPermissionRateLimiter(limiter)
+}
+
+// WithFailedBindingCooldown makes a channel binding that failed eligible for
+// another ChannelBind attempt once cooldown has passed. Zero, the default,
+// keeps failed bindings failed.
+func WithFailedBindingCooldown(cooldown time.Duration) UDPConnOption {
+	return client.WithFailedBindingCooldown(cooldown)
+}
+
+// WithReadQueueSize sets how many received packets are buffered until they
+// are read. The default is 1024.
+func WithReadQueueSize(size int) UDPConnOption {
+	return client.WithReadQueueSize(size)
+}
+
+// WriteQueueConfig configures the queue of WithWriteQueue.
+type WriteQueueConfig = client.WriteQueueConfig
+
+// WithWriteQueue makes writes return right away, while a single goroutine
+// sends them to the TURN server.
+func WithWriteQueue(config WriteQueueConfig) UDPConnOption {
+	return client.WithWriteQueue(config)
+}
+
+// WithSlowWriteThreshold makes every write that takes longer than threshold
+// count in Stats.SlowWrites. Zero, the default, disables counting.
+func WithSlowWriteThreshold(threshold time.Duration) UDPConnOption {
+	return client.WithSlowWriteThreshold(threshold)
+}
+
+// WithMaxPacketSize makes writes with a payload larger than size fail with
+// ErrPacketTooLarge before anything is sent. Zero, the default, means no
+// limit.
+func WithMaxPacketSize(size int) UDPConnOption {
+	return client.WithMaxPacketSize(size)
+}
+
+// SendBufferProbe reports how full the send buffer of the socket to the TURN
+// server is, as a fraction in [0, 1].
+type SendBufferProbe = client.SendBufferProbe
+
+// SendBufferProbeFunc adapts a function to SendBufferProbe.
+type SendBufferProbeFunc = client.SendBufferProbeFunc
+
+// NewSocketSendBufferProbe returns a SendBufferProbe reading the send buffer
+// of conn, only supported on Linux.
+func NewSocketSendBufferProbe(conn syscall.Conn) (SendBufferProbe, error) {
+	return client.NewSocketSendBufferProbe(conn)
+}
+
+// FlowControlConfig configures WithFlowControl.
+type FlowControlConfig = client.FlowControlConfig
+
+// WithFlowControl makes writes wait while the send buffer of the socket to
+// the TURN server is fuller than config.Threshold.
+func WithFlowControl(config FlowControlConfig) UDPConnOption {
+	return client.WithFlowControl(config)
+}
+
+// ICMPConn reads ICMP messages without their IP header, e.g. an
+// *icmp.PacketConn listening on "ip4:icmp" or "ip6:ipv6-icmp".
+type ICMPConn = client.ICMPConn
+
+const (
+	// ProtocolICMP is the protocol of ICMPv4 messages read by WithICMPListener.
+	ProtocolICMP = client.ProtocolICMP
+	// ProtocolIPv6ICMP is the protocol of ICMPv6 messages read by WithICMPListener.
+	ProtocolIPv6ICMP = client.ProtocolIPv6ICMP
+)
+
+// WithICMPListener makes the relayed conn read the ICMP messages of protocol
+// from conn, so that Packet Too Big messages lower its MTU. Writes that no
+// longer fit fail with ErrPacketTooLarge. conn must be closed by the caller
+// after the relayed conn.
+func WithICMPListener(conn ICMPConn, protocol int) UDPConnOption {
+	return client.WithICMPListener(conn, protocol)
+}
+
+// WithChannelNumberAllocator sets how channel numbers are picked for new
+// channel bindings. The default assigns them in ascending order.
+func WithChannelNumberAllocator(allocator binding.ChannelNumberAllocator) UDPConnOption {
+	return client.WithChannelNumberAllocator(allocator)
+}
+
+// WithChannelRange restricts the channel numbers of new channel bindings to
+// [first, last], a sub-range of [0x4000, 0x7FFF].
+func WithChannelRange(first, last uint16) UDPConnOption {
+	return client.WithChannelRange(first, last)
+}
+
+// WithBindingStateChangeHandler registers a handler that is notified of every
+// channel binding state transition.
+func WithBindingStateChangeHandler(handler binding.StateChangeHandler) UDPConnOption {
+	return client.WithBindingStateChangeHandler(handler)
+}
+
+// WithBindingHighWaterMark makes the relayed conn log a warning, and call
+// handler if it is not nil, once it holds more than mark channel bindings.
+func WithBindingHighWaterMark(mark int, handler func(current, max int)) UDPConnOption {
+	return client.WithBindingHighWaterMark(mark, handler)
+}
+
+// WithRTTHandler registers a handler that is passed the round-trip time
+// measured by every successful Ping of the relayed conn, unless its request
+// was retransmitted.
+func WithRTTHandler(handler func(rtt time.Duration)) UDPConnOption {
+	return client.WithRTTHandler(handler)
+}
+
+// WithIdleWatchdog makes the relayed conn send a Binding request to the TURN
+// server when nothing was sent to or received from it for timeout. If the
+// probe fails the NAT mapping to the server is likely lost, so the relayed
+// conn is closed.
+func WithIdleWatchdog(timeout time.Duration) UDPConnOption {
+	return client.WithIdleWatchdog(timeout)
+}
+
+// WithRequireChannelTimeout makes writes to peers whose channel is not bound
+// yet wait up to timeout for the ChannelBind, and fail with
+// ErrChannelNotReady if it does not succeed in time, instead of being sent in
+// Send indications meanwhile. Zero allows Send indications, which is the
+// default.
+func WithRequireChannelTimeout(timeout time.Duration) UDPConnOption {
+	return client.WithRequireChannelTimeout(timeout)
+}
+
+// EventLog keeps the most recent events of a relayed conn, see WithEventLog.
+type EventLog = client.EventLog
+
+// Event is an action of a relayed conn recorded in its EventLog.
+type Event = client.Event
+
+// EventType is the kind of an Event.
+type EventType = client.EventType
+
+const (
+	// EventBindingCreated means a channel was bound to a peer.
+	EventBindingCreated = client.EventBindingCreated
+	// EventBindingRefreshed means the channel binding of a peer was refreshed.
+	EventBindingRefreshed = client.EventBindingRefreshed
+	// EventBindingFailed means a ChannelBind transaction failed.
+	EventBindingFailed = client.EventBindingFailed
+	// EventPermissionGranted means the server granted a permission for a peer.
+	EventPermissionGranted = client.EventPermissionGranted
+	// EventPermissionExpired means an expired permission was removed.
+	EventPermissionExpired = client.EventPermissionExpired
+	// EventNonceUpdated means the server handed out a new nonce.
+	EventNonceUpdated = client.EventNonceUpdated
+	// EventAllocationRefreshed means a Refresh succeeded.
+	EventAllocationRefreshed = client.EventAllocationRefreshed
+)
+
+// WithEventLog makes the relayed conn keep its size most recent events, such
+// as channel binding failures and nonce updates, in the EventLog returned by
+// its EventLog method.
+func WithEventLog(size int) UDPConnOption {
+	return client.WithEventLog(size)
+}
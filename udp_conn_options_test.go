@@ -0,0 +1,266 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package turn
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/turn/v4/binding"
+	"github.com/pion/turn/v4/internal/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newLoopbackClient returns a listening Client with opts of a Server
+// listening on loopback.
+func newLoopbackClient(t *testing.T, opts ...ClientOption) *Client {
+	t.Helper()
+
+	serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	require.NoError(t, err)
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			return GenerateAuthKey(username, realm, "pass"), true
+		},
+		PacketConnConfigs: []PacketConnConfig{
+			{
+				PacketConn: serverConn,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "127.0.0.1",
+				},
+			},
+		},
+		Realm: "pion.ly",
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = server.Close() })
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	turnClient, err := NewClient(&ClientConfig{
+		Conn:           conn,
+		TURNServerAddr: serverConn.LocalAddr().String(),
+		Username:       "foo",
+		Password:       "pass",
+	}, opts...)
+	require.NoError(t, err)
+	require.NoError(t, turnClient.Listen())
+	t.Cleanup(turnClient.Close)
+
+	return turnClient
+}
+
+// allocateWithOptions allocates through a Client with opts from a Server
+// listening on loopback.
+func allocateWithOptions(t *testing.T, opts ...UDPConnOption) (*client.UDPConn, error) {
+	t.Helper()
+
+	relayConn, err := newLoopbackClient(t, WithUDPConnOptions(opts...)).Allocate()
+	if err != nil {
+		return nil, err
+	}
+	t.Cleanup(func() { _ = relayConn.Close() })
+	udpConn, ok := relayConn.(*client.UDPConn)
+	require.True(t, ok)
+
+	return udpConn, nil
+}
+
+func TestClientUDPConnOptions(t *testing.T) {
+	peer, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	require.NoError(t, err)
+	defer peer.Close() //nolint:errcheck
+
+	t.Run("RetryPolicy", func(t *testing.T) {
+		policy := DefaultRetryPolicy()
+		policy.MaxRetries = 1
+		relayConn, err := allocateWithOptions(t, WithRetryPolicy(policy))
+		require.NoError(t, err)
+
+		_, err = relayConn.WriteTo([]byte("hello"), peer.LocalAddr())
+		assert.NoError(t, err)
+
+		// An invalid policy fails the allocation instead of being ignored
+		_, err = allocateWithOptions(t, WithRetryPolicy(RetryPolicy{Multiplier: 0.5}))
+		assert.Error(t, err)
+	})
+
+	t.Run("Channels", func(t *testing.T) {
+		var ready atomic.Int32
+		var highWater atomic.Int32
+		relayConn, err := allocateWithOptions(t,
+			WithChannelRange(0x5000, 0x5001),
+			WithBindingStateChangeHandler(func(_ net.Addr, _, newState binding.State) {
+				if newState == binding.StateReady {
+					ready.Add(1)
+				}
+			}),
+			WithBindingHighWaterMark(1, func(int, int) { highWater.Add(1) }),
+		)
+		require.NoError(t, err)
+
+		peer2, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		require.NoError(t, err)
+		defer peer2.Close() //nolint:errcheck
+		for _, addr := range []net.Addr{peer.LocalAddr(), peer2.LocalAddr()} {
+			_, err = relayConn.WriteTo([]byte("hello"), addr)
+			require.NoError(t, err)
+		}
+		assert.Eventually(t, func() bool { return ready.Load() == 2 }, 5*time.Second, 10*time.Millisecond)
+		assert.Equal(t, int32(1), highWater.Load())
+		for _, number := range []uint16{0x5000, 0x5001} {
+			_, ok := relayConn.FindAddrByChannelNumber(number)
+			assert.True(t, ok, "channel 0x%x", number)
+		}
+	})
+
+	t.Run("Writes", func(t *testing.T) {
+		relayConn, err := allocateWithOptions(t,
+			WithMaxPacketSize(4),
+			WithPermissionRateLimiter(NewTokenBucketRateLimiter(0, 0)),
+			WithSlowWriteThreshold(time.Hour),
+		)
+		require.NoError(t, err)
+
+		_, err = relayConn.WriteTo([]byte("hello"), peer.LocalAddr())
+		assert.ErrorIs(t, err, ErrPacketTooLarge)
+
+		// The only token goes to the permission of the first peer IP
+		_, err = relayConn.WriteTo([]byte("hi"), peer.LocalAddr())
+		assert.NoError(t, err)
+		_, err = relayConn.WriteTo([]byte("hi"), &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2), Port: 5000})
+		assert.ErrorIs(t, err, ErrPermissionRateLimited)
+	})
+
+	t.Run("Refreshes", func(t *testing.T) {
+		_, err := allocateWithOptions(t,
+			WithLogger(logging.NewDefaultLoggerFactory().NewLogger("relay")),
+			WithBindingRefreshInterval(time.Minute),
+			WithAllocationRefreshInterval(time.Minute),
+			WithAllocationRefreshJitter(0.2),
+			WithPermissionBatchWindow(time.Millisecond),
+			WithPermissionRefreshInterval(time.Minute),
+			WithPermissionLifetime(5*time.Minute),
+			WithPermissionRefreshMargin(time.Minute),
+			WithPermissionGCInterval(time.Minute),
+			WithFailedBindingCooldown(time.Second),
+			WithReadQueueSize(16),
+			WithWriteQueue(WriteQueueConfig{Size: 16}),
+			WithChannelNumberAllocator(binding.NewSequentialChannelNumberAllocator()),
+		)
+		require.NoError(t, err)
+	})
+
+	t.Run("RTTHandler", func(t *testing.T) {
+		rtts := make(chan time.Duration, 1)
+		relayConn, err := allocateWithOptions(t, WithRTTHandler(func(rtt time.Duration) { rtts <- rtt }))
+		require.NoError(t, err)
+
+		require.NoError(t, relayConn.Ping(context.Background()))
+		assert.Greater(t, <-rtts, time.Duration(0))
+	})
+
+	t.Run("IdleWatchdog", func(t *testing.T) {
+		// The probes of the watchdog are Pings, which report their RTT
+		var probes atomic.Int32
+		_, err := allocateWithOptions(t,
+			WithIdleWatchdog(20*time.Millisecond),
+			WithRTTHandler(func(time.Duration) { probes.Add(1) }),
+		)
+		require.NoError(t, err)
+		assert.Eventually(t, func() bool { return probes.Load() >= 2 }, 5*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("RequireChannelTimeout", func(t *testing.T) {
+		relayConn, err := allocateWithOptions(t,
+			WithRequireChannelTimeout(5*time.Second),
+			WithChannelRange(0x4000, 0x4000),
+		)
+		require.NoError(t, err)
+
+		// The write waits for the only channel
+		_, err = relayConn.WriteTo([]byte("hello"), peer.LocalAddr())
+		require.NoError(t, err)
+		_, ok := relayConn.FindAddrByChannelNumber(0x4000)
+		assert.True(t, ok)
+
+		// No channel is left for a second peer, which would get an indication
+		_, err = relayConn.WriteTo([]byte("hello"), &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5000})
+		assert.ErrorIs(t, err, ErrChannelNotReady)
+	})
+
+	t.Run("EventLog", func(t *testing.T) {
+		withoutLog, err := allocateWithOptions(t)
+		require.NoError(t, err)
+		assert.Nil(t, withoutLog.EventLog())
+
+		relayConn, err := allocateWithOptions(t, WithEventLog(16))
+		require.NoError(t, err)
+		_, err = relayConn.WriteTo([]byte("hello"), peer.LocalAddr())
+		require.NoError(t, err)
+
+		log := relayConn.EventLog()
+		require.NotNil(t, log)
+		assert.Eventually(t, func() bool {
+			for _, event := range log.Events() {
+				if event.Type == EventBindingCreated {
+					return true
+				}
+			}
+
+			return false
+		}, 5*time.Second, 10*time.Millisecond)
+		var types []EventType
+		for _, event := range log.Events() {
+			types = append(types, event.Type)
+		}
+		assert.Contains(t, types, EventPermissionGranted)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, opt := range []UDPConnOption{
+			WithBindingRefreshInterval(-1),
+			WithAllocationRefreshInterval(-1),
+			WithAllocationRefreshJitter(1),
+			WithPermissionBatchWindow(-1),
+			WithPermissionRefreshInterval(-1),
+			WithPermissionLifetime(-1),
+			WithPermissionRefreshMargin(-1),
+			WithPermissionGCInterval(-1),
+			WithFailedBindingCooldown(-1),
+			WithReadQueueSize(0),
+			WithWriteQueue(WriteQueueConfig{}),
+			WithSlowWriteThreshold(-1),
+			WithMaxPacketSize(-1),
+			WithFlowControl(FlowControlConfig{}),
+			WithICMPListener(nil, ProtocolICMP),
+			WithChannelNumberAllocator(nil),
+			WithChannelRange(0x7000, 0x6000),
+			WithBindingHighWaterMark(0, nil),
+			WithIdleWatchdog(0),
+			WithRequireChannelTimeout(-1),
+			WithEventLog(0),
+		} {
+			_, err := allocateWithOptions(t, opt)
+			assert.Error(t, err)
+		}
+	})
+
+	t.Run("Failing option", func(t *testing.T) {
+		errOption := errors.New("option failed")
+		_, err := allocateWithOptions(t, func(*client.UDPConn) error { return errOption })
+		assert.ErrorIs(t, err, errOption)
+	})
+}
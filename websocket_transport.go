@@ -0,0 +1,48 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"context"
+
+	"golang.org/x/net/websocket"
+)
+
+// WebSocketTransport runs TURN over a WebSocket connection, for networks that
+// block UDP and TCP to the TURN server but let HTTPS through. Each STUN and
+// ChannelData message is written as a binary frame of its own, received
+// frames are read as a stream like STUNConn does.
+type WebSocketTransport struct {
+	*STUNConn
+	ws *websocket.Conn
+}
+
+// NewWebSocketTransport returns a WebSocketTransport over the established
+// WebSocket connection ws, which is switched to binary frames.
+func NewWebSocketTransport(ws *websocket.Conn) *WebSocketTransport {
+	ws.PayloadType = websocket.BinaryFrame
+
+	return &WebSocketTransport{STUNConn: NewSTUNConn(ws), ws: ws}
+}
+
+// DialWebSocketTransport opens a WebSocket to url, a ws:// or wss:// URL,
+// sending origin as the Origin header, and returns a WebSocketTransport over
+// it.
+func DialWebSocketTransport(ctx context.Context, url, origin string) (*WebSocketTransport, error) {
+	config, err := websocket.NewConfig(url, origin)
+	if err != nil {
+		return nil, err
+	}
+	ws, err := config.DialContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWebSocketTransport(ws), nil
+}
+
+// Config returns the configuration of the WebSocket connection.
+func (t *WebSocketTransport) Config() *websocket.Config {
+	return t.ws.Config()
+}
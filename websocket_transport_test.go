@@ -0,0 +1,180 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package turn
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+// webSocketListener is a net.Listener accepting the WebSockets upgraded by
+// its handler, like a TURN server behind an HTTPS front end.
+type webSocketListener struct {
+	addr      net.Addr
+	conns     chan net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newWebSocketListener() *webSocketListener {
+	return &webSocketListener{conns: make(chan net.Conn), closed: make(chan struct{})}
+}
+
+func (l *webSocketListener) handler(ws *websocket.Conn) {
+	ws.PayloadType = websocket.BinaryFrame
+	remoteAddr, err := net.ResolveTCPAddr("tcp4", ws.Request().RemoteAddr)
+	if err != nil {
+		return
+	}
+	conn := &webSocketServerConn{Conn: ws, remoteAddr: remoteAddr, localAddr: l.addr, done: make(chan struct{})}
+	select {
+	case l.conns <- conn:
+	case <-l.closed:
+		return
+	}
+
+	// The WebSocket is closed once the handler returns
+	select {
+	case <-conn.done:
+	case <-l.closed:
+	}
+}
+
+func (l *webSocketListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *webSocketListener) Close() error {
+	l.closeOnce.Do(func() { close(l.closed) })
+
+	return nil
+}
+
+func (l *webSocketListener) Addr() net.Addr {
+	return l.addr
+}
+
+// webSocketServerConn reports the TCP addresses of a server side WebSocket,
+// for the 5-tuple of its allocation.
+type webSocketServerConn struct {
+	*websocket.Conn
+	remoteAddr, localAddr net.Addr
+	done                  chan struct{}
+	closeOnce             sync.Once
+}
+
+func (c *webSocketServerConn) RemoteAddr() net.Addr { return c.remoteAddr }
+
+func (c *webSocketServerConn) LocalAddr() net.Addr { return c.localAddr }
+
+func (c *webSocketServerConn) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+
+	return c.Conn.Close()
+}
+
+func TestWebSocketTransport(t *testing.T) {
+	listener := newWebSocketListener()
+	httpServer := httptest.NewServer(websocket.Handler(listener.handler))
+	defer httpServer.Close()
+	listener.addr = httpServer.Listener.Addr()
+
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			return GenerateAuthKey(username, realm, "pass"), true
+		},
+		ListenerConfigs: []ListenerConfig{
+			{
+				Listener: listener,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "127.0.0.1",
+				},
+			},
+		},
+		Realm: "pion.ly",
+	})
+	require.NoError(t, err)
+	defer server.Close() //nolint:errcheck
+
+	url := "ws" + strings.TrimPrefix(httpServer.URL, "http")
+
+	t.Run("Allocate", func(t *testing.T) {
+		serverAddr := httpServer.Listener.Addr().String()
+		client, err := NewClient(&ClientConfig{
+			STUNServerAddr: serverAddr,
+			TURNServerAddr: serverAddr,
+			Username:       "foo",
+			Password:       "pass",
+		}, WithWebSocket(url, httpServer.URL))
+		require.NoError(t, err)
+		require.NoError(t, client.Listen())
+		defer client.Close()
+
+		wsTransport, ok := client.baseConn().(*WebSocketTransport)
+		require.True(t, ok)
+		assert.Equal(t, url, wsTransport.Config().Location.String())
+
+		relayConn, err := client.Allocate()
+		require.NoError(t, err)
+
+		peer, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		require.NoError(t, err)
+		defer peer.Close() //nolint:errcheck
+
+		// The first write creates the permission
+		_, err = relayConn.WriteTo([]byte("hello"), peer.LocalAddr())
+		require.NoError(t, err)
+
+		buf := make([]byte, 1600)
+		require.NoError(t, peer.SetReadDeadline(time.Now().Add(5*time.Second)))
+		n, from, err := peer.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(buf[:n]))
+
+		_, err = peer.WriteTo([]byte("world"), from)
+		require.NoError(t, err)
+
+		require.NoError(t, relayConn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		n, _, err = relayConn.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.Equal(t, "world", string(buf[:n]))
+
+		require.NoError(t, relayConn.Close())
+	})
+
+	t.Run("Binary frames", func(t *testing.T) {
+		wsTransport, err := DialWebSocketTransport(context.Background(), url, httpServer.URL)
+		require.NoError(t, err)
+		defer wsTransport.Close() //nolint:errcheck
+
+		assert.Equal(t, byte(websocket.BinaryFrame), wsTransport.ws.PayloadType)
+	})
+
+	t.Run("With Conn", func(t *testing.T) {
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+		require.NoError(t, err)
+		defer conn.Close() //nolint:errcheck
+
+		_, err = NewClient(&ClientConfig{Conn: conn}, WithWebSocket(url, httpServer.URL))
+		assert.ErrorIs(t, err, errConnWithWebSocket)
+	})
+}
@@ -0,0 +1,41 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+package turn
+
+import (
+	"net"
+
+	"github.com/pion/turn/v4/internal/client"
+)
+
+// Message is a packet written with WriteBatch.
+type Message = client.Message
+
+// WriteBatch sends msgs to the TURN server in order and returns how many were
+// sent. On Linux, when the conn given in ClientConfig is a *net.UDPConn, the
+// whole batch is sent with a single sendmmsg syscall. Otherwise the packets
+// are written one by one. The relayed conns returned by Allocate use this to
+// send ChannelData in batches, see UDPConn.WriteBatch.
+func (c *Client) WriteBatch(msgs []Message) (int, error) {
+	if c.breaker != nil {
+		if err := c.breaker.AllowWrite(); err != nil {
+			return 0, err
+		}
+	}
+
+	conn := c.baseConn()
+	if udpConn, ok := conn.(*net.UDPConn); ok {
+		if n, ok, err := writeBatchUDP(udpConn, msgs); ok {
+			return n, err
+		}
+	}
+
+	for i, msg := range msgs {
+		if _, err := conn.WriteTo(msg.Payload, msg.Addr); err != nil {
+			return i, err
+		}
+	}
+
+	return len(msgs), nil
+}
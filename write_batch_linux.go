@@ -0,0 +1,54 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build linux
+// +build linux
+
+package turn
+
+import (
+	"net"
+
+	"github.com/pion/turn/v4/internal/client"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// writeBatchUDP sends msgs over conn with sendmmsg. It returns false, without
+// sending anything, if an address of msgs does not match the family of conn.
+func writeBatchUDP(conn *net.UDPConn, msgs []client.Message) (int, bool, error) {
+	local, ok := conn.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return 0, false, nil
+	}
+	isIPv4 := local.IP.To4() != nil
+
+	batch := make([]ipv4.Message, len(msgs))
+	for i, msg := range msgs {
+		addr, ok := msg.Addr.(*net.UDPAddr)
+		// A dual-stack socket can not be given an AF_INET address
+		if !ok || isIPv4 != (addr.IP.To4() != nil) {
+			return 0, false, nil
+		}
+		batch[i] = ipv4.Message{Buffers: [][]byte{msg.Payload}, Addr: addr}
+	}
+
+	var writeBatch func([]ipv4.Message, int) (int, error)
+	if isIPv4 {
+		writeBatch = ipv4.NewPacketConn(conn).WriteBatch
+	} else {
+		writeBatch = ipv6.NewPacketConn(conn).WriteBatch
+	}
+
+	// sendmmsg may stop early, e.g. when the socket buffer is full
+	sent := 0
+	for sent < len(batch) {
+		n, err := writeBatch(batch[sent:], 0)
+		sent += n
+		if err != nil || n == 0 {
+			return sent, true, err
+		}
+	}
+
+	return sent, true, nil
+}
@@ -0,0 +1,18 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !linux
+// +build !linux
+
+package turn
+
+import (
+	"net"
+
+	"github.com/pion/turn/v4/internal/client"
+)
+
+// writeBatchUDP always returns false, packets are written one by one.
+func writeBatchUDP(*net.UDPConn, []client.Message) (int, bool, error) {
+	return 0, false, nil
+}
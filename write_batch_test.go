@@ -0,0 +1,147 @@
+// SPDX-FileCopyrightText: 2023 The Pion community <https://pion.ly>
+// SPDX-License-Identifier: MIT
+
+//go:build !js
+// +build !js
+
+package turn
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/turn/v4/internal/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientWriteBatch(t *testing.T) {
+	serverConn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	require.NoError(t, err)
+
+	server, err := NewServer(ServerConfig{
+		AuthHandler: func(username, realm string, _ net.Addr) (key []byte, ok bool) {
+			return GenerateAuthKey(username, realm, "pass"), true
+		},
+		PacketConnConfigs: []PacketConnConfig{
+			{
+				PacketConn: serverConn,
+				RelayAddressGenerator: &RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address:      "127.0.0.1",
+				},
+			},
+		},
+		Realm: "pion.ly",
+	})
+	require.NoError(t, err)
+	defer server.Close() //nolint:errcheck
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	require.NoError(t, err)
+	defer conn.Close() //nolint:errcheck
+
+	turnClient, err := NewClient(&ClientConfig{
+		Conn:           conn,
+		TURNServerAddr: serverConn.LocalAddr().String(),
+		Username:       "foo",
+		Password:       "pass",
+	})
+	require.NoError(t, err)
+	require.NoError(t, turnClient.Listen())
+	defer turnClient.Close()
+
+	relayConn, err := turnClient.Allocate()
+	require.NoError(t, err)
+	defer relayConn.Close() //nolint:errcheck
+
+	peer, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	require.NoError(t, err)
+	defer peer.Close() //nolint:errcheck
+
+	// Bind a channel to the peer first, so that the batch is sent as ChannelData
+	udpConn, ok := relayConn.(*client.UDPConn)
+	require.True(t, ok)
+	assert.Eventually(t, func() bool {
+		_, err := relayConn.WriteTo([]byte("ping"), peer.LocalAddr())
+
+		return err == nil && udpConn.Stats().ChannelSends > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, peer.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+	const count = 16
+	msgs := make([]Message, count)
+	for i := range msgs {
+		msgs[i] = Message{Payload: []byte(fmt.Sprintf("packet %d", i)), Addr: peer.LocalAddr()}
+	}
+	channelSends := udpConn.Stats().ChannelSends
+	n, err := udpConn.WriteBatch(msgs)
+	require.NoError(t, err)
+	assert.Equal(t, count, n)
+	assert.Equal(t, channelSends+count, udpConn.Stats().ChannelSends)
+
+	// The pings may still be in flight
+	var received []string
+	buf := make([]byte, 64)
+	for len(received) < count {
+		n, from, err := peer.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.Equal(t, relayConn.LocalAddr().String(), from.String())
+		if payload := string(buf[:n]); payload != "ping" {
+			received = append(received, payload)
+		}
+	}
+	for i, payload := range received {
+		assert.Equal(t, fmt.Sprintf("packet %d", i), payload, "the order of packets should be kept")
+	}
+}
+
+// BenchmarkClientWriteBatch compares writing packets to the TURN server one by
+// one with writing them in batches, e.g. at 10k packets/s in batches of 32.
+func BenchmarkClientWriteBatch(b *testing.B) {
+	sink, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	require.NoError(b, err)
+	defer sink.Close() //nolint:errcheck
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0") // nolint: noctx
+	require.NoError(b, err)
+	defer conn.Close() //nolint:errcheck
+
+	turnClient, err := NewClient(&ClientConfig{
+		Conn:           conn,
+		TURNServerAddr: sink.LocalAddr().String(),
+	})
+	require.NoError(b, err)
+	defer turnClient.Close()
+
+	const batchSize = 32
+	payload := make([]byte, 1200)
+	msgs := make([]Message, batchSize)
+	for i := range msgs {
+		msgs[i] = Message{Payload: payload, Addr: sink.LocalAddr()}
+	}
+
+	b.Run("WriteTo", func(b *testing.B) {
+		b.SetBytes(int64(len(payload) * batchSize))
+		for i := 0; i < b.N; i++ {
+			for _, msg := range msgs {
+				if _, err := turnClient.WriteTo(msg.Payload, msg.Addr); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+		b.ReportMetric(float64(b.N*batchSize)/b.Elapsed().Seconds(), "packets/s")
+	})
+
+	b.Run("WriteBatch", func(b *testing.B) {
+		b.SetBytes(int64(len(payload) * batchSize))
+		for i := 0; i < b.N; i++ {
+			if _, err := turnClient.WriteBatch(msgs); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric(float64(b.N*batchSize)/b.Elapsed().Seconds(), "packets/s")
+	})
+}